@@ -60,6 +60,10 @@ type Task struct {
 	Log      []string     `json:"log,omitempty"`
 	Progress TaskProgress `json:"progress"`
 
+	// Lanes lists the lanes the task is in. Tasks that aren't in any lane
+	// are in the default lane 0, and Lanes is empty for them.
+	Lanes []int `json:"lanes,omitempty"`
+
 	SpawnTime time.Time `json:"spawn-time,omitempty"`
 	ReadyTime time.Time `json:"ready-time,omitempty"`
 
@@ -111,14 +115,30 @@ func (client *Client) Change(id string) (*Change, error) {
 
 // Abort attempts to abort a change that is not yet ready.
 func (client *Client) Abort(id string) (*Change, error) {
-	if !changeIDRegexp.MatchString(id) {
-		return nil, fmt.Errorf("invalid change ID %q", id)
+	var postData struct {
+		Action string `json:"action"`
 	}
+	postData.Action = "abort"
+	return client.postChangeAction(id, &postData)
+}
 
+// AbortLanes attempts to abort only the given lanes of a change that is not
+// yet ready. The tasks in those lanes, and any tasks waiting on them, are
+// undone, while tasks in other lanes proceed.
+func (client *Client) AbortLanes(id string, lanes []int) (*Change, error) {
 	var postData struct {
 		Action string `json:"action"`
+		Lanes  []int  `json:"lanes"`
+	}
+	postData.Action = "abort-lanes"
+	postData.Lanes = lanes
+	return client.postChangeAction(id, &postData)
+}
+
+func (client *Client) postChangeAction(id string, postData interface{}) (*Change, error) {
+	if !changeIDRegexp.MatchString(id) {
+		return nil, fmt.Errorf("invalid change ID %q", id)
 	}
-	postData.Action = "abort"
 
 	var body bytes.Buffer
 	if err := json.NewEncoder(&body).Encode(postData); err != nil {
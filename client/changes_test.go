@@ -272,6 +272,30 @@ func (cs *clientSuite) TestClientAbort(c *check.C) {
 	c.Assert(string(body), check.Equals, "{\"action\":\"abort\"}\n")
 }
 
+func (cs *clientSuite) TestClientAbortLanes(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": {
+  "id":   "uno",
+  "kind": "foo",
+  "summary": "...",
+  "status": "Doing",
+  "tasks": [{"kind": "bar", "summary": "...", "status": "Undo", "lanes": [1, 2], "progress": {"done": 0, "total": 1}}]
+}}`
+
+	chg, err := cs.cli.AbortLanes("uno", []int{2})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/changes/uno")
+	c.Assert(chg.Tasks, check.HasLen, 1)
+	c.Check(chg.Tasks[0].Lanes, check.DeepEquals, []int{1, 2})
+
+	body, err := io.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Equals, "{\"action\":\"abort-lanes\",\"lanes\":[2]}\n")
+
+	_, err = cs.cli.AbortLanes("<foo>", []int{1})
+	c.Assert(err, check.ErrorMatches, "invalid change ID.*")
+}
+
 func (cs *clientSuite) TestChangeInvalidID(c *check.C) {
 	_, err := cs.cli.Change("select * from users;")
 	c.Assert(err, check.ErrorMatches, "invalid change ID.*")
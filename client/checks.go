@@ -71,6 +71,14 @@ type CheckInfo struct {
 	// The change will be of kind "perform-check" if the check is up, or
 	// "recover-check" if it's down.
 	ChangeID string `json:"change-id"`
+
+	// Skipped is the number of times this check didn't run because too many
+	// exec checks were already running.
+	Skipped int `json:"skipped,omitempty"`
+
+	// Overlapping is the number of times this check was due to run while
+	// the previous run was still going, and so didn't run.
+	Overlapping int `json:"overlapping,omitempty"`
 }
 
 // Checks fetches information about specific health checks (or all of them),
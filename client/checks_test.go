@@ -26,7 +26,7 @@ func (cs *clientSuite) TestChecksGet(c *check.C) {
 	cs.rsp = `{
 		"result": [
 			{"name": "chk1", "status": "up"},
-			{"name": "chk3", "status": "down", "failures": 42}
+			{"name": "chk3", "status": "down", "failures": 42, "skipped": 2, "overlapping": 5}
 		],
 		"status": "OK",
 		"status-code": 200,
@@ -44,9 +44,11 @@ func (cs *clientSuite) TestChecksGet(c *check.C) {
 			Name:   "chk1",
 			Status: client.CheckStatusUp,
 		}, {
-			Name:     "chk3",
-			Status:   client.CheckStatusDown,
-			Failures: 42,
+			Name:        "chk3",
+			Status:      client.CheckStatusDown,
+			Failures:    42,
+			Skipped:     2,
+			Overlapping: 5,
 		}})
 	c.Assert(cs.req.Method, check.Equals, "GET")
 	c.Assert(cs.req.URL.Path, check.Equals, "/v1/checks")
@@ -141,6 +141,30 @@ type Config struct {
 
 	// UserAgent is the User-Agent header sent to the Pebble daemon.
 	UserAgent string
+
+	// Retry configures how requests are retried when the daemon can't be
+	// reached. If nil, GET requests are retried for up to 5 seconds.
+	Retry *RetryPolicy
+}
+
+// RetryPolicy configures retries of requests that fail because the Pebble
+// daemon can't be reached, for example because it's restarting. Only
+// idempotent requests (GET, HEAD, OPTIONS, PUT, and DELETE) are retried,
+// and only if their body is nil or implements io.Seeker so it can be sent
+// again.
+//
+// If the daemon last reported that the system is restarting, requests are
+// not retried and the maintenance error is returned instead, as the daemon
+// isn't expected to return soon.
+type RetryPolicy struct {
+	// Timeout is how long to keep retrying a request before returning the
+	// last error. If zero, requests are not retried.
+	Timeout time.Duration
+
+	// Delay is the time to wait before the first retry. The delay doubles
+	// after each retry, up to MaxDelay (if set).
+	Delay    time.Duration
+	MaxDelay time.Duration
 }
 
 // A Client knows how to talk to the Pebble daemon.
@@ -272,51 +296,104 @@ func (rq *defaultRequester) dispatch(ctx context.Context, method, urlpath string
 }
 
 var (
-	doRetry   = 250 * time.Millisecond
-	doTimeout = 5 * time.Second
+	doRetry    = 250 * time.Millisecond
+	doMaxDelay = 2 * time.Second
+	doTimeout  = 5 * time.Second
 )
 
 // FakeDoRetry fakes the delays used by the do retry loop (intended for
 // testing). Calling restore will revert the changes.
 func FakeDoRetry(retry, timeout time.Duration) (restore func()) {
 	oldRetry := doRetry
+	oldMaxDelay := doMaxDelay
 	oldTimeout := doTimeout
 	doRetry = retry
+	doMaxDelay = retry
 	doTimeout = timeout
 	return func() {
 		doRetry = oldRetry
+		doMaxDelay = oldMaxDelay
 		doTimeout = oldTimeout
 	}
 }
 
-// retry builds in a retry mechanism for GET failures.
+// retryPolicy returns the configured retry policy, or the default one
+// (which only retries GET requests).
+func (rq *defaultRequester) retryPolicy(method string) RetryPolicy {
+	if rq.retryConfig != nil {
+		return *rq.retryConfig
+	}
+	if method != "GET" {
+		return RetryPolicy{}
+	}
+	return RetryPolicy{Timeout: doTimeout, Delay: doRetry, MaxDelay: doMaxDelay}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// retry builds in a retry mechanism for idempotent requests that fail to
+// reach the server, with exponential backoff.
 func (rq *defaultRequester) retry(ctx context.Context, method, urlpath string, query url.Values, headers map[string]string, body io.Reader) (*http.Response, error) {
-	retry := time.NewTicker(doRetry)
-	defer retry.Stop()
-	timeout := time.After(doTimeout)
-	var rsp *http.Response
-	var err error
+	policy := rq.retryPolicy(method)
+	canRetry := policy.Timeout > 0 && isIdempotent(method)
+
+	// The body must be rewound before each retry.
+	var seeker io.Seeker
+	var bodyStart int64
+	if body != nil && canRetry {
+		var ok bool
+		seeker, ok = body.(io.Seeker)
+		if ok {
+			var err error
+			bodyStart, err = seeker.Seek(0, io.SeekCurrent)
+			ok = err == nil
+		}
+		canRetry = ok
+	}
+
+	deadline := time.Now().Add(policy.Timeout)
+	delay := policy.Delay
 	for {
-		rsp, err = rq.dispatch(ctx, method, urlpath, query, headers, body)
-		if err == nil || method != "GET" {
-			break
+		rsp, err := rq.dispatch(ctx, method, urlpath, query, headers, body)
+		if err == nil {
+			return rsp, nil
+		}
+		if maintErr, ok := rq.client.maintenance.(*Error); ok && maintErr.Kind == ErrorKindSystemRestart {
+			return nil, maintErr
+		}
+		if !canRetry || ctx.Err() != nil || !time.Now().Add(delay).Before(deadline) {
+			return nil, err
 		}
+
+		timer := time.NewTimer(delay)
 		select {
-		case <-retry.C:
-			continue
-		case <-timeout:
+		case <-timer.C:
 		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		delay *= 2
+		if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+
+		if seeker != nil {
+			_, seekErr := seeker.Seek(bodyStart, io.SeekStart)
+			if seekErr != nil {
+				return nil, err
+			}
 		}
-		break
-	}
-	if err != nil {
-		return nil, err
 	}
-	return rsp, nil
 }
 
-// Do performs the HTTP request according to the provided options, possibly retrying GET requests
-// if appropriate for the status reported by the server.
+// Do performs the HTTP request according to the provided options, possibly retrying idempotent
+// requests according to the client's RetryPolicy.
 func (rq *defaultRequester) Do(ctx context.Context, opts *RequestOptions) (*RequestResponse, error) {
 	httpResp, err := rq.retry(ctx, opts.Method, opts.Path, opts.Query, opts.Headers, opts.Body)
 	if err != nil {
@@ -333,6 +410,15 @@ func (rq *defaultRequester) Do(ctx context.Context, opts *RequestOptions) (*Requ
 	}
 
 	defer httpResp.Body.Close()
+
+	// A response to a conditional request has no body.
+	if httpResp.StatusCode == http.StatusNotModified {
+		return &RequestResponse{
+			StatusCode: httpResp.StatusCode,
+			Headers:    httpResp.Header,
+		}, nil
+	}
+
 	var serverResp response
 	if err := decodeInto(httpResp.Body, &serverResp); err != nil {
 		return nil, err
@@ -481,6 +567,7 @@ const (
 	ErrorKindGenericFileError  = "generic-file-error"
 	ErrorKindSystemRestart     = "system-restart"
 	ErrorKindDaemonRestart     = "daemon-restart"
+	ErrorKindChangeConflict    = "change-conflict"
 )
 
 // err extracts the error in case of an error type response
@@ -522,6 +609,34 @@ type SysInfo struct {
 
 	// BootID is a unique string that represents this boot of the server.
 	BootID string `json:"boot-id,omitempty"`
+
+	// Architecture is the server host's architecture, for example "amd64".
+	Architecture string `json:"architecture,omitempty"`
+
+	// PlanHash is a hash of the combined plan, which changes whenever the
+	// plan does. It's the same as the hash returned by PlanBytesHash.
+	PlanHash string `json:"plan-hash,omitempty"`
+
+	// StartTime is the time the server started.
+	StartTime time.Time `json:"start-time,omitempty"`
+
+	// BootTime is the time the system's kernel booted.
+	BootTime time.Time `json:"boot-time,omitempty"`
+}
+
+// ConfigSourceInfo holds the state of the server's remote config source.
+type ConfigSourceInfo struct {
+	// URL is the URL the layer bundle is fetched from.
+	URL string `json:"url"`
+
+	// Version is the version of the bundle currently applied, if any.
+	Version string `json:"version,omitempty"`
+
+	// LastCheck is when the config source was last checked successfully.
+	LastCheck time.Time `json:"last-check,omitempty"`
+
+	// Error is the error from the last check, if it failed.
+	Error string `json:"error,omitempty"`
 }
 
 // SysInfo gets system information from the remote API.
@@ -535,6 +650,98 @@ func (client *Client) SysInfo() (*SysInfo, error) {
 	return &sysInfo, nil
 }
 
+// SystemStatus holds the operational status of the server. Unlike SysInfo,
+// it's only available to users.
+type SystemStatus struct {
+	// StateSize is the size of the server's state file in bytes.
+	StateSize int64 `json:"state-size,omitempty"`
+
+	// ConfigSource is the state of the remote config source, if the server
+	// was started with one.
+	ConfigSource *ConfigSourceInfo `json:"config-source,omitempty"`
+
+	// MaintenanceMode is set if the server is in maintenance mode.
+	MaintenanceMode *MaintenanceModeInfo `json:"maintenance-mode,omitempty"`
+
+	// ManagersReady is true if all the server's managers are ready. See
+	// Managers for details.
+	ManagersReady bool `json:"managers-ready"`
+}
+
+// SystemStatus gets the operational status of the server.
+func (client *Client) SystemStatus() (*SystemStatus, error) {
+	var status SystemStatus
+	_, err := client.doSync("GET", "/v1/system-status", nil, nil, nil, &status)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain system status: %w", err)
+	}
+	return &status, nil
+}
+
+// StateInfo holds statistics about the server's state, for diagnostics.
+type StateInfo struct {
+	// Path is the path of the file the state is persisted to.
+	Path string `json:"path,omitempty"`
+
+	// Size and Modified are the size and modification time of the state
+	// file. Modified is zero if the state hasn't been written yet.
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified,omitempty"`
+
+	// Changes, Tasks, Warnings, and Notices are the number of each in the
+	// state.
+	Changes  int `json:"changes"`
+	Tasks    int `json:"tasks"`
+	Warnings int `json:"warnings"`
+	Notices  int `json:"notices"`
+
+	// Lock holds statistics about the use of the state lock.
+	Lock StateLockStats `json:"lock"`
+
+	// TaskWait holds histograms of how long tasks waited to be run after
+	// they were ready to run, by task kind.
+	TaskWait StateTaskWaitStats `json:"task-wait"`
+}
+
+// StateLockStats holds histograms of how long the server's state lock was
+// waited for and held.
+type StateLockStats struct {
+	// Bounds are the upper bounds of the histogram buckets.
+	Bounds []time.Duration `json:"bounds"`
+
+	Wait StateLockHistogram `json:"wait"`
+	Hold StateLockHistogram `json:"hold"`
+}
+
+// StateTaskWaitStats holds histograms of how long tasks of each kind waited
+// to be run after they were ready to run.
+type StateTaskWaitStats struct {
+	// Bounds are the upper bounds of the histogram buckets.
+	Bounds []time.Duration `json:"bounds"`
+
+	Kinds map[string]StateLockHistogram `json:"kinds"`
+}
+
+// StateLockHistogram summarizes a set of durations.
+type StateLockHistogram struct {
+	Count uint64        `json:"count"`
+	Total time.Duration `json:"total"`
+	Max   time.Duration `json:"max"`
+
+	// Buckets holds the number of durations up to each of the bounds, in
+	// the same order, followed by the number longer than the last bound.
+	Buckets []uint64 `json:"buckets"`
+}
+
+// StateInfo gets statistics about the server's state.
+func (client *Client) StateInfo() (*StateInfo, error) {
+	var info StateInfo
+	if _, err := client.doSync("GET", "/v1/state-info", nil, nil, nil, &info); err != nil {
+		return nil, fmt.Errorf("cannot obtain state details: %w", err)
+	}
+	return &info, nil
+}
+
 type debugAction struct {
 	Action string      `json:"action"`
 	Params interface{} `json:"params,omitempty"`
@@ -565,11 +772,12 @@ func (client *Client) DebugGet(action string, result interface{}, params map[str
 }
 
 type defaultRequester struct {
-	baseURL   url.URL
-	doer      doer
-	userAgent string
-	transport *http.Transport
-	client    *Client
+	baseURL     url.URL
+	doer        doer
+	userAgent   string
+	transport   *http.Transport
+	retryConfig *RetryPolicy
+	client      *Client
 }
 
 func newDefaultRequester(client *Client, opts *Config) (*defaultRequester, error) {
@@ -596,6 +804,7 @@ func newDefaultRequester(client *Client, opts *Config) (*defaultRequester, error
 
 	requester.doer = &http.Client{Transport: requester.transport}
 	requester.userAgent = opts.UserAgent
+	requester.retryConfig = opts.Retry
 	requester.client = client
 
 	return requester, nil
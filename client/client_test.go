@@ -123,6 +123,77 @@ func (cs *clientSuite) TestContextCancellation(c *C) {
 	c.Assert(cs.doCalls, Equals, 1)
 }
 
+func (cs *clientSuite) TestClientNoRetryPOST(c *C) {
+	cs.err = errors.New("ouchie")
+	err := cs.cli.Do("POST", "/", nil, nil, nil)
+	c.Check(err, ErrorMatches, "cannot communicate with server: ouchie")
+	c.Assert(cs.doCalls, Equals, 1)
+}
+
+func (cs *clientSuite) TestClientRetryPolicy(c *C) {
+	cli, err := client.New(&client.Config{Retry: &client.RetryPolicy{
+		Timeout:  50 * time.Millisecond,
+		Delay:    time.Millisecond,
+		MaxDelay: 4 * time.Millisecond,
+	}})
+	c.Assert(err, IsNil)
+
+	// Idempotent requests with a seekable body are retried, with the body
+	// rewound each time.
+	doer := &failingDoer{}
+	cli.SetDoer(doer)
+	err = cli.Do("PUT", "/", nil, strings.NewReader("body"), nil)
+	c.Check(err, ErrorMatches, "cannot communicate with server: ouchie")
+	c.Assert(len(doer.bodies) > 2, Equals, true)
+	for _, body := range doer.bodies {
+		c.Check(body, Equals, "body")
+	}
+
+	// But not if the body can't be rewound.
+	doer = &failingDoer{}
+	cli.SetDoer(doer)
+	err = cli.Do("PUT", "/", nil, io.NopCloser(strings.NewReader("body")), nil)
+	c.Check(err, ErrorMatches, "cannot communicate with server: ouchie")
+	c.Check(doer.bodies, HasLen, 1)
+
+	// A zero timeout disables retries.
+	cli, err = client.New(&client.Config{Retry: &client.RetryPolicy{}})
+	c.Assert(err, IsNil)
+	doer = &failingDoer{}
+	cli.SetDoer(doer)
+	err = cli.Do("GET", "/", nil, nil, nil)
+	c.Check(err, ErrorMatches, "cannot communicate with server: ouchie")
+	c.Check(doer.bodies, HasLen, 1)
+}
+
+func (cs *clientSuite) TestClientNoRetrySystemRestart(c *C) {
+	cs.rsp = `{"type":"sync", "result":{}, "maintenance": {"kind": "system-restart", "message": "system is restarting"}}`
+	_, err := cs.cli.SysInfo()
+	c.Assert(err, IsNil)
+
+	cs.err = errors.New("ouchie")
+	cs.doCalls = 0
+	_, err = cs.cli.SysInfo()
+	c.Check(err, ErrorMatches, "cannot obtain system details: system is restarting")
+	var clientErr *client.Error
+	c.Check(errors.As(err, &clientErr), Equals, true)
+	c.Check(clientErr.Kind, Equals, client.ErrorKindSystemRestart)
+	c.Check(cs.doCalls, Equals, 1)
+}
+
+type failingDoer struct {
+	bodies []string
+}
+
+func (d *failingDoer) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+	d.bodies = append(d.bodies, string(body))
+	return nil, errors.New("ouchie")
+}
+
 func (cs *clientSuite) TestClientWorks(c *C) {
 	var v []int
 	cs.rsp = `[1,2]`
@@ -146,10 +217,106 @@ func (cs *clientSuite) TestClientDefaultsToNoAuthorization(c *C) {
 }
 
 func (cs *clientSuite) TestClientSysInfo(c *C) {
-	cs.rsp = `{"type": "sync", "result": {"version": "1"}}`
+	cs.rsp = `{"type": "sync", "result": {
+		"version": "1",
+		"architecture": "arm64",
+		"plan-hash": "abcd",
+		"start-time": "2024-05-01T12:30:00Z",
+		"boot-time": "2024-05-01T12:00:00Z"
+	}}`
 	sysInfo, err := cs.cli.SysInfo()
 	c.Check(err, IsNil)
-	c.Check(sysInfo, DeepEquals, &client.SysInfo{Version: "1"})
+	c.Check(sysInfo, DeepEquals, &client.SysInfo{
+		Version:      "1",
+		Architecture: "arm64",
+		PlanHash:     "abcd",
+		StartTime:    time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		BootTime:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	})
+}
+
+func (cs *clientSuite) TestClientSystemStatus(c *C) {
+	cs.rsp = `{"type": "sync", "result": {
+		"state-size": 1234,
+		"managers-ready": true,
+		"config-source": {
+			"url": "https://example.com/bundle",
+			"version": "v2",
+			"last-check": "2024-05-01T12:35:00Z"
+		}
+	}}`
+	status, err := cs.cli.SystemStatus()
+	c.Check(err, IsNil)
+	c.Check(cs.req.URL.Path, Equals, "/v1/system-status")
+	c.Check(status, DeepEquals, &client.SystemStatus{
+		StateSize:     1234,
+		ManagersReady: true,
+		ConfigSource: &client.ConfigSourceInfo{
+			URL:       "https://example.com/bundle",
+			Version:   "v2",
+			LastCheck: time.Date(2024, 5, 1, 12, 35, 0, 0, time.UTC),
+		},
+	})
+}
+
+func (cs *clientSuite) TestClientStateInfo(c *C) {
+	cs.rsp = `{"type": "sync", "result": {
+		"path": "/pebble/.pebble.state",
+		"size": 1234,
+		"modified": "2024-05-01T12:00:00Z",
+		"changes": 3,
+		"tasks": 7,
+		"warnings": 1,
+		"notices": 4,
+		"lock": {
+			"bounds": [1000000, 10000000],
+			"wait": {"count": 3, "total": 1500000, "max": 1000000, "buckets": [2, 1, 0]},
+			"hold": {"count": 2, "total": 30000000, "max": 25000000, "buckets": [0, 1, 1]}
+		},
+		"task-wait": {
+			"bounds": [10000000],
+			"kinds": {"start": {"count": 1, "total": 20000000, "max": 20000000, "buckets": [0, 1]}}
+		}
+	}}`
+	info, err := cs.cli.StateInfo()
+	c.Assert(err, IsNil)
+	c.Check(cs.req.Method, Equals, "GET")
+	c.Check(cs.req.URL.Path, Equals, "/v1/state-info")
+	c.Check(info, DeepEquals, &client.StateInfo{
+		Path:     "/pebble/.pebble.state",
+		Size:     1234,
+		Modified: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Changes:  3,
+		Tasks:    7,
+		Warnings: 1,
+		Notices:  4,
+		Lock: client.StateLockStats{
+			Bounds: []time.Duration{time.Millisecond, 10 * time.Millisecond},
+			Wait: client.StateLockHistogram{
+				Count:   3,
+				Total:   1500 * time.Microsecond,
+				Max:     time.Millisecond,
+				Buckets: []uint64{2, 1, 0},
+			},
+			Hold: client.StateLockHistogram{
+				Count:   2,
+				Total:   30 * time.Millisecond,
+				Max:     25 * time.Millisecond,
+				Buckets: []uint64{0, 1, 1},
+			},
+		},
+		TaskWait: client.StateTaskWaitStats{
+			Bounds: []time.Duration{10 * time.Millisecond},
+			Kinds: map[string]client.StateLockHistogram{
+				"start": {
+					Count:   1,
+					Total:   20 * time.Millisecond,
+					Max:     20 * time.Millisecond,
+					Buckets: []uint64{0, 1},
+				},
+			},
+		},
+	})
 }
 
 func (cs *clientSuite) TestClientIntegration(c *C) {
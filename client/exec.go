@@ -67,6 +67,11 @@ type ExecOptions struct {
 	Width  int
 	Height int
 
+	// True to record a transcript of the session's input, output, and
+	// control events on the server. Use ExecProcess.TaskID and
+	// Client.ExecTranscript to retrieve it.
+	Record bool
+
 	// Standard input stream. If nil, no input is sent.
 	Stdin io.Reader
 
@@ -93,6 +98,7 @@ type execPayload struct {
 	SplitStderr    bool              `json:"split-stderr,omitempty"`
 	Width          int               `json:"width,omitempty"`
 	Height         int               `json:"height,omitempty"`
+	Record         bool              `json:"record,omitempty"`
 }
 
 type execResult struct {
@@ -102,6 +108,7 @@ type execResult struct {
 // ExecProcess represents a running process. Use Wait to wait for it to finish.
 type ExecProcess struct {
 	changeID    string
+	taskID      string
 	client      *Client
 	timeout     time.Duration
 	writesDone  chan struct{}
@@ -142,6 +149,7 @@ func (client *Client) Exec(opts *ExecOptions) (*ExecProcess, error) {
 		SplitStderr:    opts.Stderr != nil,
 		Width:          opts.Width,
 		Height:         opts.Height,
+		Record:         opts.Record,
 	}
 	var body bytes.Buffer
 	err := json.NewEncoder(&body).Encode(&payload)
@@ -207,6 +215,7 @@ func (client *Client) Exec(opts *ExecOptions) (*ExecProcess, error) {
 
 	process := &ExecProcess{
 		changeID:    resp.ChangeID,
+		taskID:      taskID,
 		client:      client,
 		timeout:     opts.Timeout,
 		writesDone:  writesDone,
@@ -216,6 +225,11 @@ func (client *Client) Exec(opts *ExecOptions) (*ExecProcess, error) {
 	return process, nil
 }
 
+// TaskID returns the ID of the exec task running the process.
+func (p *ExecProcess) TaskID() string {
+	return p.taskID
+}
+
 // Wait waits for the command process to finish. The returned error is nil if
 // the process runs successfully and returns a zero exit code. If the command
 // fails with a nonzero exit code, the error is of type *ExitError.
@@ -304,3 +318,63 @@ func (p *ExecProcess) SendSignal(signal string) error {
 	}
 	return p.controlConn.WriteJSON(msg)
 }
+
+// ExecTranscriptEvent is an event in the transcript of a recorded exec
+// session.
+type ExecTranscriptEvent struct {
+	// Type is "start", "stdin", "stdout", "stderr", "resize", "signal", or
+	// "exit".
+	Type string `json:"type"`
+
+	// Elapsed is the time since the session started.
+	Elapsed time.Duration `json:"-"`
+
+	// Time, Command, Terminal, UserID, and GroupID are set for the "start"
+	// event.
+	Time     time.Time `json:"time"`
+	Command  []string  `json:"command"`
+	Terminal bool      `json:"terminal"`
+	UserID   *int      `json:"user-id"`
+	GroupID  *int      `json:"group-id"`
+
+	// Data is the input or output, for "stdin", "stdout", and "stderr"
+	// events.
+	Data []byte `json:"data"`
+
+	// Width and Height are the terminal size, for "start" and "resize"
+	// events.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// Signal is the name of the signal, for "signal" events.
+	Signal string `json:"signal"`
+
+	// ExitCode is the command's exit code, for the "exit" event.
+	ExitCode *int `json:"exit-code"`
+}
+
+func (e *ExecTranscriptEvent) UnmarshalJSON(data []byte) error {
+	type plainEvent ExecTranscriptEvent
+	var v struct {
+		plainEvent
+		Elapsed float64 `json:"elapsed"`
+	}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	*e = ExecTranscriptEvent(v.plainEvent)
+	e.Elapsed = time.Duration(v.Elapsed * float64(time.Second))
+	return nil
+}
+
+// ExecTranscript fetches the transcript of the recorded exec session with
+// the given task ID.
+func (client *Client) ExecTranscript(taskID string) ([]*ExecTranscriptEvent, error) {
+	var events []*ExecTranscriptEvent
+	_, err := client.doSync("GET", "/v1/tasks/"+taskID+"/transcript", nil, nil, nil, &events)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
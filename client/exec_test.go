@@ -143,6 +143,59 @@ func (s *execSuite) TestOtherOptions(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *execSuite) TestRecord(c *C) {
+	opts := &client.ExecOptions{
+		Command: []string{"true"},
+		Record:  true,
+	}
+	process, reqBody := s.exec(c, opts, 0)
+	c.Assert(reqBody, DeepEquals, map[string]interface{}{
+		"command": []interface{}{"true"},
+		"record":  true,
+	})
+	c.Assert(process.TaskID(), Equals, "T123")
+	err := s.wait(c, process)
+	c.Assert(err, IsNil)
+}
+
+func (s *execSuite) TestExecTranscript(c *C) {
+	s.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"type": "start", "elapsed": 0, "time": "2024-03-04T05:06:07Z", "command": ["cat"], "terminal": true, "width": 80, "height": 25},
+			{"type": "stdin", "elapsed": 0.5, "data": "aGkK"},
+			{"type": "stdout", "elapsed": 0.75, "data": "aGkK"},
+			{"type": "exit", "elapsed": 1.5, "exit-code": 0}
+		]
+	}`
+	events, err := s.cli.ExecTranscript("T42")
+	c.Assert(err, IsNil)
+	c.Assert(s.req.Method, Equals, "GET")
+	c.Assert(s.req.URL.Path, Equals, "/v1/tasks/T42/transcript")
+	exitCode := 0
+	c.Assert(events, DeepEquals, []*client.ExecTranscriptEvent{{
+		Type:     "start",
+		Time:     time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC),
+		Command:  []string{"cat"},
+		Terminal: true,
+		Width:    80,
+		Height:   25,
+	}, {
+		Type:    "stdin",
+		Elapsed: 500 * time.Millisecond,
+		Data:    []byte("hi\n"),
+	}, {
+		Type:    "stdout",
+		Elapsed: 750 * time.Millisecond,
+		Data:    []byte("hi\n"),
+	}, {
+		Type:     "exit",
+		Elapsed:  1500 * time.Millisecond,
+		ExitCode: &exitCode,
+	}})
+}
+
 func (s *execSuite) TestWaitChangeError(c *C) {
 	opts := &client.ExecOptions{
 		Command: []string{"foo"},
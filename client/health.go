@@ -27,12 +27,36 @@ type HealthOptions struct {
 	Names []string
 }
 
-type healthInfo struct {
+// HealthInfo holds the result of a health query.
+type HealthInfo struct {
+	// Healthy is true if all the checks considered are up.
 	Healthy bool `json:"healthy"`
+
+	// Checks holds the status of each check considered.
+	Checks []HealthCheckInfo `json:"checks,omitempty"`
+}
+
+// HealthCheckInfo holds the status of a single check in a health result.
+type HealthCheckInfo struct {
+	Name      string      `json:"name"`
+	Level     CheckLevel  `json:"level,omitempty"`
+	Status    CheckStatus `json:"status"`
+	Failures  int         `json:"failures,omitempty"`
+	Threshold int         `json:"threshold"`
 }
 
 // Health fetches healthy status of specified checks.
 func (client *Client) Health(opts *HealthOptions) (health bool, err error) {
+	info, err := client.HealthInfo(opts)
+	if err != nil {
+		return false, err
+	}
+	return info.Healthy, nil
+}
+
+// HealthInfo fetches the healthy status of the specified checks, along with
+// the status of each check.
+func (client *Client) HealthInfo(opts *HealthOptions) (*HealthInfo, error) {
 	query := make(url.Values)
 	if opts.Level != UnsetLevel {
 		query.Set("level", string(opts.Level))
@@ -41,10 +65,10 @@ func (client *Client) Health(opts *HealthOptions) (health bool, err error) {
 		query["names"] = opts.Names
 	}
 
-	var info healthInfo
-	_, err = client.doSync("GET", "/v1/health", query, nil, nil, &info)
+	var info HealthInfo
+	_, err := client.doSync("GET", "/v1/health", query, nil, nil, &info)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return info.Healthy, nil
+	return &info, nil
 }
@@ -64,3 +64,29 @@ func (cs *clientSuite) TestHealthDefaultOptions(c *check.C) {
 	c.Assert(cs.req.URL.Path, check.Equals, "/v1/health")
 	c.Assert(cs.req.URL.Query(), check.DeepEquals, url.Values{})
 }
+
+func (cs *clientSuite) TestHealthInfo(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 502,
+		"status": "Bad Gateway",
+		"result": {
+			"healthy": false,
+			"checks": [
+				{"name": "chk1", "level": "alive", "status": "up", "threshold": 3},
+				{"name": "chk2", "status": "down", "failures": 3, "threshold": 3}
+			]
+		}
+	}`
+
+	info, err := cs.cli.HealthInfo(&client.HealthOptions{Level: client.ReadyLevel})
+	c.Assert(err, check.IsNil)
+	c.Assert(info, check.DeepEquals, &client.HealthInfo{
+		Healthy: false,
+		Checks: []client.HealthCheckInfo{
+			{Name: "chk1", Level: client.AliveLevel, Status: client.CheckStatusUp, Threshold: 3},
+			{Name: "chk2", Status: client.CheckStatusDown, Failures: 3, Threshold: 3},
+		},
+	})
+	c.Assert(cs.req.URL.Query(), check.DeepEquals, url.Values{"level": {"ready"}})
+}
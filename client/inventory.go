@@ -0,0 +1,66 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+)
+
+// Inventory holds the hardware facts collected by the server when it
+// started. Facts that the server couldn't determine are empty.
+type Inventory struct {
+	Vendor string       `json:"vendor,omitempty"`
+	Model  string       `json:"model,omitempty"`
+	Serial string       `json:"serial,omitempty"`
+	CPU    InventoryCPU `json:"cpu"`
+
+	// Memory is the total memory in bytes.
+	Memory uint64 `json:"memory"`
+
+	Storage []InventoryDisk             `json:"storage"`
+	Network []InventoryNetworkInterface `json:"network"`
+}
+
+// InventoryCPU describes the server's processors.
+type InventoryCPU struct {
+	Model string `json:"model,omitempty"`
+	Count int    `json:"count"`
+}
+
+// InventoryDisk is a hardware block device.
+type InventoryDisk struct {
+	Name string `json:"name"`
+
+	// Size is the size of the device in bytes.
+	Size uint64 `json:"size"`
+
+	Removable bool `json:"removable,omitempty"`
+}
+
+// InventoryNetworkInterface is a hardware network interface.
+type InventoryNetworkInterface struct {
+	Name string `json:"name"`
+	MAC  string `json:"mac,omitempty"`
+}
+
+// Inventory gets the hardware facts of the server's device.
+func (client *Client) Inventory() (*Inventory, error) {
+	var inventory Inventory
+	_, err := client.doSync("GET", "/v1/inventory", nil, nil, nil, &inventory)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain inventory: %w", err)
+	}
+	return &inventory, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+func (cs *clientSuite) TestInventory(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"status": "OK",
+		"result": {
+			"vendor": "ACME",
+			"model": "Gateway 3000",
+			"serial": "SN-1234",
+			"cpu": {"model": "Cortex-A72", "count": 4},
+			"memory": 4294967296,
+			"storage": [{"name": "mmcblk0", "size": 32000000000, "removable": true}],
+			"network": [{"name": "eth0", "mac": "00:11:22:33:44:55"}]
+		}
+	}`
+
+	inventory, err := cs.cli.Inventory()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/inventory")
+	c.Check(inventory, check.DeepEquals, &client.Inventory{
+		Vendor: "ACME",
+		Model:  "Gateway 3000",
+		Serial: "SN-1234",
+		CPU:    client.InventoryCPU{Model: "Cortex-A72", Count: 4},
+		Memory: 4294967296,
+		Storage: []client.InventoryDisk{
+			{Name: "mmcblk0", Size: 32000000000, Removable: true},
+		},
+		Network: []client.InventoryNetworkInterface{
+			{Name: "eth0", MAC: "00:11:22:33:44:55"},
+		},
+	})
+}
+
+func (cs *clientSuite) TestInventoryError(c *check.C) {
+	cs.rsp = `{"type": "error", "status-code": 500, "result": {"message": "boom"}}`
+	_, err := cs.cli.Inventory()
+	c.Assert(err, check.ErrorMatches, "cannot obtain inventory: boom")
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+type logLevelInfo struct {
+	Level string `json:"level"`
+}
+
+// LogLevel gets the minimum level of messages in the server's log: "debug",
+// "notice", "warning" or "error".
+func (client *Client) LogLevel() (string, error) {
+	var info logLevelInfo
+	_, err := client.doSync("GET", "/v1/debug/log-level", nil, nil, nil, &info)
+	if err != nil {
+		return "", err
+	}
+	return info.Level, nil
+}
+
+// SetLogLevel changes the minimum level of messages in the server's log,
+// until it's restarted.
+func (client *Client) SetLogLevel(level string) error {
+	body, err := json.Marshal(logLevelInfo{Level: level})
+	if err != nil {
+		return err
+	}
+	_, err = client.doSync("POST", "/v1/debug/log-level", nil, nil, bytes.NewReader(body), nil)
+	return err
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"encoding/json"
+
+	"gopkg.in/check.v1"
+)
+
+func (cs *clientSuite) TestLogLevel(c *check.C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": {"level": "notice"}}`
+
+	level, err := cs.cli.LogLevel()
+	c.Assert(err, check.IsNil)
+	c.Check(level, check.Equals, "notice")
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/debug/log-level")
+}
+
+func (cs *clientSuite) TestSetLogLevel(c *check.C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": {"level": "debug"}}`
+
+	err := cs.cli.SetLogLevel("debug")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/debug/log-level")
+	var body map[string]any
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.DeepEquals, map[string]any{"level": "debug"})
+}
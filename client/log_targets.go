@@ -0,0 +1,83 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"net/url"
+	"time"
+)
+
+type LogTargetsOptions struct {
+	// Names is the list of log target names to query for. A target is
+	// included in the results if this field is nil or empty slice, or if one
+	// of the values in the slice is equal to the target's name.
+	Names []string
+}
+
+// LogTargetStatus represents the delivery status of a log target.
+type LogTargetStatus string
+
+const (
+	LogTargetStatusActive  LogTargetStatus = "active"
+	LogTargetStatusFailing LogTargetStatus = "failing"
+)
+
+// LogTargetInfo holds delivery status information for a single log target.
+type LogTargetInfo struct {
+	// Name is the name of this log target, from the layer configuration.
+	Name string `json:"name"`
+
+	// Status is "failing" if the most recent attempt to send logs to this
+	// target failed, otherwise "active".
+	Status LogTargetStatus `json:"status"`
+
+	// LastSuccess is the time logs were last sent successfully, or nil if
+	// they never have been.
+	LastSuccess *time.Time `json:"last-success,omitempty"`
+
+	// LastError is the error from the most recent attempt to send logs, if
+	// it failed.
+	LastError string `json:"last-error,omitempty"`
+
+	// FailingSince is the time of the first failure in the current run of
+	// failures, or nil if the target isn't failing.
+	FailingSince *time.Time `json:"failing-since,omitempty"`
+
+	// ConsecutiveFailures is the number of times in a row sending logs to
+	// this target has failed. It is reset to zero on success.
+	ConsecutiveFailures int `json:"consecutive-failures,omitempty"`
+
+	// Buffered is the number of log entries waiting to be sent.
+	Buffered int `json:"buffered"`
+
+	// Dropped is the total number of log entries dropped, because the
+	// buffer was full or the target rejected them.
+	Dropped int `json:"dropped"`
+}
+
+// LogTargets fetches delivery status information about specific log targets
+// (or all of them), ordered by target name.
+func (client *Client) LogTargets(opts *LogTargetsOptions) ([]*LogTargetInfo, error) {
+	query := make(url.Values)
+	if len(opts.Names) > 0 {
+		query["names"] = opts.Names
+	}
+	var targets []*LogTargetInfo
+	_, err := client.doSync("GET", "/v1/log-targets", query, nil, nil, &targets)
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
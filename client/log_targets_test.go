@@ -0,0 +1,72 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+func (cs *clientSuite) TestLogTargets(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"status": "OK",
+		"result": [{
+			"name": "production",
+			"status": "failing",
+			"last-success": "2024-05-01T12:00:00Z",
+			"last-error": "server returned HTTP 503 Service Unavailable",
+			"failing-since": "2024-05-01T12:01:00Z",
+			"consecutive-failures": 4,
+			"buffered": 100,
+			"dropped": 20
+		}, {
+			"name": "staging",
+			"status": "active",
+			"buffered": 0,
+			"dropped": 0
+		}]
+	}`
+
+	targets, err := cs.cli.LogTargets(&client.LogTargetsOptions{
+		Names: []string{"production", "staging"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(cs.req.Method, check.Equals, "GET")
+	c.Assert(cs.req.URL.Path, check.Equals, "/v1/log-targets")
+	c.Assert(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"names": {"production", "staging"},
+	})
+	lastSuccess := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	failingSince := time.Date(2024, 5, 1, 12, 1, 0, 0, time.UTC)
+	c.Assert(targets, check.DeepEquals, []*client.LogTargetInfo{{
+		Name:                "production",
+		Status:              client.LogTargetStatusFailing,
+		LastSuccess:         &lastSuccess,
+		LastError:           "server returned HTTP 503 Service Unavailable",
+		FailingSince:        &failingSince,
+		ConsecutiveFailures: 4,
+		Buffered:            100,
+		Dropped:             20,
+	}, {
+		Name:   "staging",
+		Status: client.LogTargetStatusActive,
+	}})
+}
@@ -44,6 +44,17 @@ type LogsOptions struct {
 	// mode, the default is zero, in non-follow mode it's server-defined
 	// (currently 30). Set to -1 to return the entire buffer.
 	N int
+
+	// Since, if set, excludes logs written before this time.
+	Since time.Time
+
+	// Until, if set, excludes logs written after this time.
+	Until time.Time
+
+	// Grep, if set, is a regular expression (in Go syntax) that log
+	// messages must match to be returned. Filtering is done by the server,
+	// and N counts only the logs that match.
+	Grep string
 }
 
 // LogEntry is the struct passed to the WriteLog function.
@@ -72,6 +83,15 @@ func (client *Client) logs(ctx context.Context, opts *LogsOptions, follow bool)
 	if opts.N != 0 {
 		query.Set("n", strconv.Itoa(opts.N))
 	}
+	if !opts.Since.IsZero() {
+		query.Set("since", opts.Since.Format(time.RFC3339Nano))
+	}
+	if !opts.Until.IsZero() {
+		query.Set("until", opts.Until.Format(time.RFC3339Nano))
+	}
+	if opts.Grep != "" {
+		query.Set("grep", opts.Grep)
+	}
 	if follow {
 		query.Set("follow", "true")
 	}
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -90,6 +91,28 @@ func (cs *clientSuite) TestLogsN(c *check.C) {
 `[1:])
 }
 
+func (cs *clientSuite) TestLogsFilters(c *check.C) {
+	cs.rsp = `
+{"time":"2021-05-03T03:55:49.654334232Z","service":"snappass","message":"log two\n"}
+`[1:]
+	out, writeLog := makeLogWriter()
+	err := cs.cli.Logs(&client.LogsOptions{
+		WriteLog: writeLog,
+		Since:    time.Date(2021, 5, 3, 3, 0, 0, 0, time.UTC),
+		Until:    time.Date(2021, 5, 3, 4, 30, 0, 500000000, time.UTC),
+		Grep:     "two$",
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"since": []string{"2021-05-03T03:00:00Z"},
+		"until": []string{"2021-05-03T04:30:00.5Z"},
+		"grep":  []string{"two$"},
+	})
+	c.Check(out.String(), check.Equals, `
+2021-05-03T03:55:49.654Z [snappass] log two
+`[1:])
+}
+
 func (cs *clientSuite) TestLogsAll(c *check.C) {
 	cs.rsp = `
 {"time":"2021-05-03T03:55:49.360994155Z","service":"thing","message":"log 1\n"}
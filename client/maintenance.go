@@ -0,0 +1,88 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MaintenanceModeInfo holds the server's maintenance mode status. Not to be
+// confused with Maintenance, which reports whether the server is restarting.
+type MaintenanceModeInfo struct {
+	// Active is true if the server is in maintenance mode.
+	Active bool `json:"active"`
+
+	// Since is the time maintenance mode was entered.
+	Since time.Time `json:"since,omitempty"`
+
+	// Services are the services that were stopped when entering maintenance
+	// mode, which will be started again when it's exited.
+	Services []string `json:"services,omitempty"`
+}
+
+// MaintenanceMode returns the server's maintenance mode status.
+func (client *Client) MaintenanceMode() (*MaintenanceModeInfo, error) {
+	var info MaintenanceModeInfo
+	_, err := client.doSync("GET", "/v1/maintenance-mode", nil, nil, nil, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+type EnterMaintenanceModeOptions struct {
+	// Services are the services to stop, together with their dependents.
+	// If empty, the running services that aren't started by default are
+	// stopped.
+	Services []string
+}
+
+// EnterMaintenanceMode puts the server in maintenance mode, in which health
+// check failures don't trigger service restarts, and stops services in a
+// new change.
+func (client *Client) EnterMaintenanceMode(opts *EnterMaintenanceModeOptions) (changeID string, err error) {
+	return client.doMaintenanceAction("enter", opts.Services)
+}
+
+// ExitMaintenanceMode takes the server out of maintenance mode and starts the
+// services stopped when it was entered in a new change.
+func (client *Client) ExitMaintenanceMode() (changeID string, err error) {
+	return client.doMaintenanceAction("exit", nil)
+}
+
+func (client *Client) doMaintenanceAction(action string, services []string) (changeID string, err error) {
+	payload := struct {
+		Action   string   `json:"action"`
+		Services []string `json:"services,omitempty"`
+	}{
+		Action:   action,
+		Services: services,
+	}
+	data, err := json.Marshal(&payload)
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal maintenance action: %w", err)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	resp, err := client.doAsync("POST", "/v1/maintenance-mode", nil, headers, bytes.NewBuffer(data), nil)
+	if err != nil {
+		return "", err
+	}
+	return resp.ChangeID, nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+func (cs *clientSuite) TestMaintenanceMode(c *check.C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": {
+		"active": true,
+		"since": "2024-05-01T12:30:00Z",
+		"services": ["svc1", "svc2"]
+	}}`
+
+	info, err := cs.cli.MaintenanceMode()
+	c.Assert(err, check.IsNil)
+	c.Check(info, check.DeepEquals, &client.MaintenanceModeInfo{
+		Active:   true,
+		Since:    time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Services: []string{"svc1", "svc2"},
+	})
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/maintenance-mode")
+}
+
+func (cs *clientSuite) TestEnterMaintenanceMode(c *check.C) {
+	cs.rsp = `{"type": "async", "status-code": 202, "change": "42"}`
+
+	changeID, err := cs.cli.EnterMaintenanceMode(&client.EnterMaintenanceModeOptions{
+		Services: []string{"svc1"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(changeID, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/maintenance-mode")
+	var body map[string]any
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.DeepEquals, map[string]any{
+		"action":   "enter",
+		"services": []any{"svc1"},
+	})
+}
+
+func (cs *clientSuite) TestExitMaintenanceMode(c *check.C) {
+	cs.rsp = `{"type": "async", "status-code": 202, "change": "43"}`
+
+	changeID, err := cs.cli.ExitMaintenanceMode()
+	c.Assert(err, check.IsNil)
+	c.Check(changeID, check.Equals, "43")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/maintenance-mode")
+	var body map[string]any
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.DeepEquals, map[string]any{"action": "exit"})
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// ManagerHealth holds the health of one of the server's managers.
+type ManagerHealth struct {
+	// Name identifies the manager, for example "servstate.ServiceManager".
+	Name string `json:"name"`
+
+	// Ready is true if the manager started up and the last evaluation of
+	// its state succeeded, and its current evaluation isn't stuck.
+	Ready bool `json:"ready"`
+
+	// StartUpError is the error from starting up the manager, if any.
+	StartUpError string `json:"startup-error,omitempty"`
+
+	// LastEnsure is when the manager last finished evaluating its state,
+	// and EnsureError is the error from that evaluation, if any.
+	LastEnsure  time.Time `json:"last-ensure,omitempty"`
+	EnsureError string    `json:"ensure-error,omitempty"`
+
+	// EnsuringSince is when the manager's current evaluation started, or
+	// zero if it isn't running.
+	EnsuringSince time.Time `json:"ensuring-since,omitempty"`
+}
+
+// Managers gets the health of the server's managers.
+func (client *Client) Managers() ([]*ManagerHealth, error) {
+	var managers []*ManagerHealth
+	_, err := client.doSync("GET", "/v1/managers", nil, nil, nil, &managers)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain managers: %w", err)
+	}
+	return managers, nil
+}
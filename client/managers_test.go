@@ -0,0 +1,52 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+func (cs *clientSuite) TestManagers(c *check.C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": [{
+		"name": "servstate.ServiceManager",
+		"ready": true,
+		"last-ensure": "2024-05-01T12:00:00Z"
+	}, {
+		"name": "logstate.LogManager",
+		"ready": false,
+		"last-ensure": "2024-05-01T11:00:00Z",
+		"ensure-error": "cannot forward logs",
+		"ensuring-since": "2024-05-01T11:00:01Z"
+	}]}`
+
+	managers, err := cs.cli.Managers()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/managers")
+	c.Check(managers, check.DeepEquals, []*client.ManagerHealth{{
+		Name:       "servstate.ServiceManager",
+		Ready:      true,
+		LastEnsure: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}, {
+		Name:          "logstate.LogManager",
+		LastEnsure:    time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC),
+		EnsureError:   "cannot forward logs",
+		EnsuringSince: time.Date(2024, 5, 1, 11, 0, 1, 0, time.UTC),
+	}})
+}
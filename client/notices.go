@@ -130,6 +130,26 @@ const (
 	// The key and data fields are provided by the user. The key must be in
 	// the format "example.com/path" to ensure well-namespaced notice keys.
 	CustomNotice NoticeType = "custom"
+
+	// Recorded when a health check with "notice: true" in its on-recovery
+	// configuration recovers. The key is the check's name, and the data
+	// includes the number of failures before it recovered.
+	CheckRecoveredNotice NoticeType = "check-recovered"
+
+	// Recorded when a health check failure triggers a service's
+	// on-check-failure action. The key is the service's name, and the data
+	// includes the check's name, the action, and the check's last error.
+	ServiceCheckFailureNotice NoticeType = "service-check-failure"
+
+	// Recorded when a device in the plan becomes ready or stops being ready.
+	// The key is the device's name, and the data's "ready" field is "true"
+	// or "false".
+	DeviceNotice NoticeType = "device"
+
+	// Recorded when a task handler panics, which indicates a bug rather than
+	// an operational failure. The key is the change ID, and the data
+	// includes the change kind, the task ID and kind, and the panic value.
+	InternalErrorNotice NoticeType = "internal-error"
 )
 
 type jsonNotice struct {
@@ -194,6 +214,50 @@ func (client *Client) WaitNotices(ctx context.Context, serverTimeout time.Durati
 	return jsonNoticesToNotices(jns), err
 }
 
+// noticesWatchTimeout is the server timeout for each long-polling request
+// made by NoticesWatch.
+var noticesWatchTimeout = 30 * time.Second
+
+// NoticesWatch watches for notices that match the filters given in opts,
+// sending them on the returned notices channel in last-repeated order. It
+// long-polls the server, tracking the last-repeated time of the notices
+// sent so far, so each occurrence is only sent once. If opts.After is
+// zero, existing notices are sent first.
+//
+// The watch continues until ctx is cancelled or a request fails. In either
+// case both channels are closed; if a request failed, its error is sent on
+// the error channel first.
+func (client *Client) NoticesWatch(ctx context.Context, opts *NoticesOptions) (<-chan *Notice, <-chan error) {
+	var watchOpts NoticesOptions
+	if opts != nil {
+		watchOpts = *opts
+	}
+	noticeCh := make(chan *Notice)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		defer close(noticeCh)
+		for ctx.Err() == nil {
+			notices, err := client.WaitNotices(ctx, noticesWatchTimeout, &watchOpts)
+			if err != nil {
+				if ctx.Err() == nil {
+					errCh <- err
+				}
+				return
+			}
+			for _, notice := range notices {
+				select {
+				case noticeCh <- notice:
+				case <-ctx.Done():
+					return
+				}
+				watchOpts.After = notice.LastRepeated
+			}
+		}
+	}()
+	return noticeCh, errCh
+}
+
 func makeNoticesQuery(opts *NoticesOptions) url.Values {
 	query := make(url.Values)
 	if opts == nil {
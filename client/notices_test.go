@@ -221,3 +221,65 @@ func (cs *clientSuite) TestWaitNoticesTimeout(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(notices, HasLen, 0)
 }
+
+func (cs *clientSuite) TestNoticesWatch(c *C) {
+	cs.rsps = []string{`{"type": "sync", "result": [{
+		"id": "1",
+		"type": "custom",
+		"key": "example.com/a",
+		"last-repeated": "2023-09-06T16:43:00Z"
+	}, {
+		"id": "2",
+		"type": "custom",
+		"key": "example.com/b",
+		"last-repeated": "2023-09-06T16:44:00Z"
+	}]}`, `{"type": "sync", "result": []}`, `{"type": "sync", "result": [{
+		"id": "3",
+		"type": "custom",
+		"key": "example.com/c",
+		"last-repeated": "2023-09-06T16:45:00.5Z"
+	}]}`}
+	cs.rsp = `{"type": "sync", "result": []}`
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	noticeCh, errCh := cs.cli.NoticesWatch(ctx, &client.NoticesOptions{
+		Types: []client.NoticeType{client.CustomNotice},
+	})
+	var ids []string
+	for len(ids) < 3 {
+		notice := <-noticeCh
+		c.Assert(notice, NotNil)
+		ids = append(ids, notice.ID)
+	}
+	c.Check(ids, DeepEquals, []string{"1", "2", "3"})
+
+	cancel()
+	for range noticeCh {
+	}
+	c.Check(<-errCh, IsNil)
+
+	c.Assert(len(cs.reqs) >= 3, Equals, true)
+	c.Check(cs.reqs[0].URL.Query(), DeepEquals, url.Values{
+		"types":   {"custom"},
+		"timeout": {"30s"},
+	})
+	c.Check(cs.reqs[1].URL.Query(), DeepEquals, url.Values{
+		"types":   {"custom"},
+		"after":   {"2023-09-06T16:44:00Z"},
+		"timeout": {"30s"},
+	})
+	c.Check(cs.reqs[2].URL.Query(), DeepEquals, url.Values{
+		"types":   {"custom"},
+		"after":   {"2023-09-06T16:44:00Z"},
+		"timeout": {"30s"},
+	})
+}
+
+func (cs *clientSuite) TestNoticesWatchError(c *C) {
+	cs.rsp = `{"type": "error", "result": {"message": "invalid type"}}`
+	noticeCh, errCh := cs.cli.NoticesWatch(context.Background(), nil)
+	_, ok := <-noticeCh
+	c.Check(ok, Equals, false)
+	c.Check(<-errCh, ErrorMatches, "invalid type")
+}
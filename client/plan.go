@@ -17,7 +17,10 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
 )
 
 type AddLayerOptions struct {
@@ -29,44 +32,396 @@ type AddLayerOptions struct {
 	// layer to combine with if Combine is true.
 	Label string
 
-	// LayerData is the new layer in YAML format.
+	// LayerData is the new layer in YAML format (or JSON if Format is
+	// "json").
 	LayerData []byte
+
+	// Format is the format of LayerData, either "yaml" (the default) or
+	// "json".
+	Format string
+
+	// Signature, if set, is the Ed25519 signature of a JSON header line
+	// giving an empty "section", the "label", "combine", and, if set, the
+	// "order" and "insert-before" fields, followed by LayerData. It must be
+	// made by one of the server's trusted keys. The server may require
+	// layers to be signed.
+	Signature []byte
+
+	// Order, if set, is the order to give the new layer, instead of
+	// appending it after the other layers. It must not be used by another
+	// layer.
+	Order *int
+
+	// InsertBefore, if set, is the label of the layer to insert the new layer
+	// before. Layers from that one on are renumbered if there's no room.
+	// Order and InsertBefore are ignored when combining with an existing
+	// layer.
+	InsertBefore string
+}
+
+func (opts *AddLayerOptions) format() string {
+	if opts.Format == "" {
+		return "yaml"
+	}
+	return opts.Format
 }
 
 // AddLayer adds a layer to the plan's configuration layers.
 func (client *Client) AddLayer(opts *AddLayerOptions) error {
+	return client.postLayer("add", opts)
+}
+
+// ValidateLayer checks whether the layer could be added to the plan, and
+// that the resulting plan would be valid, without changing the plan. It
+// takes the same options as AddLayer.
+func (client *Client) ValidateLayer(opts *AddLayerOptions) error {
+	return client.postLayer("validate", opts)
+}
+
+func (client *Client) postLayer(action string, opts *AddLayerOptions) error {
 	var payload = struct {
-		Action  string `json:"action"`
-		Combine bool   `json:"combine"`
-		Label   string `json:"label"`
-		Format  string `json:"format"`
-		Layer   string `json:"layer"`
+		Action       string `json:"action"`
+		Combine      bool   `json:"combine"`
+		Label        string `json:"label"`
+		Format       string `json:"format"`
+		Layer        string `json:"layer"`
+		Signature    []byte `json:"signature,omitempty"`
+		Order        *int   `json:"order,omitempty"`
+		InsertBefore string `json:"insert-before,omitempty"`
 	}{
-		Action:  "add",
-		Combine: opts.Combine,
-		Label:   opts.Label,
-		Format:  "yaml",
-		Layer:   string(opts.LayerData),
+		Action:       action,
+		Combine:      opts.Combine,
+		Label:        opts.Label,
+		Format:       opts.format(),
+		Layer:        string(opts.LayerData),
+		Signature:    opts.Signature,
+		Order:        opts.Order,
+		InsertBefore: opts.InsertBefore,
 	}
+	return client.postLayersAction(&payload)
+}
+
+type RemoveLayerOptions struct {
+	// Label is the label of the layer to remove.
+	Label string
+}
+
+// RemoveLayer removes a layer from the plan's configuration layers.
+func (client *Client) RemoveLayer(opts *RemoveLayerOptions) error {
+	var payload = struct {
+		Action string `json:"action"`
+		Label  string `json:"label"`
+	}{
+		Action: "remove",
+		Label:  opts.Label,
+	}
+	return client.postLayersAction(&payload)
+}
+
+type MoveLayerOptions struct {
+	// Label is the label of the layer to move.
+	Label string
+
+	// Order is the layer's new order. It must not be used by another layer.
+	Order int
+}
+
+// MoveLayer changes the order of a layer, and so its precedence when the
+// layers are combined into the plan.
+func (client *Client) MoveLayer(opts *MoveLayerOptions) error {
+	var payload = struct {
+		Action string `json:"action"`
+		Label  string `json:"label"`
+		Order  int    `json:"order"`
+	}{
+		Action: "move",
+		Label:  opts.Label,
+		Order:  opts.Order,
+	}
+	return client.postLayersAction(&payload)
+}
+
+func (client *Client) postLayersAction(payload interface{}) error {
 	var body bytes.Buffer
-	if err := json.NewEncoder(&body).Encode(&payload); err != nil {
+	if err := json.NewEncoder(&body).Encode(payload); err != nil {
 		return err
 	}
 	_, err := client.doSync("POST", "/v1/layers", nil, nil, &body, nil)
 	return err
 }
 
-type PlanOptions struct{}
+// LayerInfo holds the order and label of a configuration layer.
+type LayerInfo struct {
+	Order int    `json:"order"`
+	Label string `json:"label"`
+}
+
+// Layers fetches the plan's configuration layers, in order.
+func (client *Client) Layers() ([]*LayerInfo, error) {
+	var layers []*LayerInfo
+	_, err := client.doSync("GET", "/v1/layers", nil, nil, nil, &layers)
+	if err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+type PlanOptions struct {
+	// IfNoneMatch is the hash of a plan the caller already has, as returned
+	// by PlanBytesHash. If set and the plan hasn't changed, the plan isn't
+	// fetched again, and nil data is returned.
+	IfNoneMatch string
+
+	// Format is the format to fetch the plan in, either "yaml" (the default)
+	// or "json".
+	Format string
+
+	// Section, if set, is the YAML name of the only plan section to fetch,
+	// for example "services" or "checks".
+	Section string
+}
+
+// PlanBytes fetches the plan in YAML format (or JSON if opts.Format is
+// "json").
+func (client *Client) PlanBytes(opts *PlanOptions) (data []byte, err error) {
+	data, _, err = client.PlanBytesHash(opts)
+	return data, err
+}
+
+// PlanBytesHash fetches the plan like PlanBytes, along with its hash. If
+// opts.IfNoneMatch is set and the plan hasn't changed, it returns nil data
+// and the same hash.
+func (client *Client) PlanBytesHash(opts *PlanOptions) (data []byte, hash string, err error) {
+	format := opts.Format
+	if format == "" {
+		format = "yaml"
+	}
+	query := url.Values{
+		"format": []string{format},
+	}
+	if opts.Section != "" {
+		query.Set("section", opts.Section)
+	}
+	var headers map[string]string
+	if opts.IfNoneMatch != "" {
+		headers = map[string]string{"If-None-Match": `"` + opts.IfNoneMatch + `"`}
+	}
+	resp, err := client.doSync("GET", "/v1/plan", query, headers, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	hash = strings.Trim(resp.Headers.Get("ETag"), `"`)
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, hash, nil
+	}
+	if format == "json" {
+		var planJSON json.RawMessage
+		err = resp.DecodeResult(&planJSON)
+		if err != nil {
+			return nil, "", err
+		}
+		return planJSON, hash, nil
+	}
+	var dataStr string
+	err = resp.DecodeResult(&dataStr)
+	if err != nil {
+		return nil, "", err
+	}
+	return []byte(dataStr), hash, nil
+}
+
+// PlanSystemdUnits converts the plan's services to systemd service units.
+// The result maps each unit's file name ("<service>.service") to its
+// content. The conversion is approximate; settings that systemd has no
+// equivalent for are noted in comments in the units.
+func (client *Client) PlanSystemdUnits() (map[string]string, error) {
+	query := url.Values{
+		"format": []string{"systemd"},
+	}
+	var units map[string]string
+	_, err := client.doSync("GET", "/v1/plan", query, nil, nil, &units)
+	if err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+type PlanSectionOptions struct {
+	// Name is the YAML name of the plan section, for example "services".
+	Name string
+
+	// Format is the format to fetch the section in, either "yaml" (the
+	// default) or "json".
+	Format string
+}
 
-// PlanBytes fetches the plan in YAML format.
-func (client *Client) PlanBytes(_ *PlanOptions) (data []byte, err error) {
+// PlanSection fetches the content of a single section of the plan, without
+// the enclosing section key, in YAML format (or JSON if opts.Format is
+// "json").
+func (client *Client) PlanSection(opts *PlanSectionOptions) ([]byte, error) {
+	format := opts.Format
+	if format == "" {
+		format = "yaml"
+	}
 	query := url.Values{
-		"format": []string{"yaml"},
+		"format": []string{format},
+	}
+	resp, err := client.doSync("GET", "/v1/plan/sections/"+url.PathEscape(opts.Name), query, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if format == "json" {
+		var sectionJSON json.RawMessage
+		err = resp.DecodeResult(&sectionJSON)
+		if err != nil {
+			return nil, err
+		}
+		return sectionJSON, nil
 	}
 	var dataStr string
-	_, err = client.doSync("GET", "/v1/plan", query, nil, nil, &dataStr)
+	err = resp.DecodeResult(&dataStr)
 	if err != nil {
 		return nil, err
 	}
 	return []byte(dataStr), nil
 }
+
+type AddPlanSectionOptions struct {
+	// Name is the YAML name of the plan section, for example "services".
+	Name string
+
+	// Combine true means combine the section with the layer that has the
+	// given label. False (the default) means append a new layer.
+	Combine bool
+
+	// Label is the label for the new layer if appending, and the label of the
+	// layer to combine with if Combine is true.
+	Label string
+
+	// SectionData is the content of the section, without the enclosing
+	// section key, in YAML format (or JSON if Format is "json").
+	SectionData []byte
+
+	// Format is the format of SectionData, either "yaml" (the default) or
+	// "json".
+	Format string
+
+	// Signature, if set, is the Ed25519 signature of a JSON header line
+	// giving the "section" name, the "label", and "combine", followed by
+	// SectionData, and must be made by one of the server's trusted keys.
+	Signature []byte
+}
+
+// AddPlanSection adds a layer to the plan that contains only the given
+// section content.
+func (client *Client) AddPlanSection(opts *AddPlanSectionOptions) error {
+	return client.postPlanSection("add", opts)
+}
+
+// ValidatePlanSection checks whether the section content could be added to
+// the plan, without changing the plan. It takes the same options as
+// AddPlanSection.
+func (client *Client) ValidatePlanSection(opts *AddPlanSectionOptions) error {
+	return client.postPlanSection("validate", opts)
+}
+
+func (client *Client) postPlanSection(action string, opts *AddPlanSectionOptions) error {
+	format := opts.Format
+	if format == "" {
+		format = "yaml"
+	}
+	var payload = struct {
+		Action    string `json:"action"`
+		Combine   bool   `json:"combine"`
+		Label     string `json:"label"`
+		Format    string `json:"format"`
+		Section   string `json:"section"`
+		Signature []byte `json:"signature,omitempty"`
+	}{
+		Action:    action,
+		Combine:   opts.Combine,
+		Label:     opts.Label,
+		Format:    format,
+		Section:   string(opts.SectionData),
+		Signature: opts.Signature,
+	}
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(&payload); err != nil {
+		return err
+	}
+	_, err := client.doSync("POST", "/v1/plan/sections/"+url.PathEscape(opts.Name), nil, nil, &body, nil)
+	return err
+}
+
+type PlanDiffOptions struct {
+	// From is the label of a layer. If set, the plan combined from the layers
+	// up to and including that layer is compared with the current plan.
+	From string
+
+	// Layer is a candidate layer. If set, the current plan is compared with
+	// the plan that would result from adding the layer.
+	Layer *AddLayerOptions
+}
+
+// PlanDiffItem describes how a single item in a plan section, such as a
+// service or a check, differs between two plans.
+type PlanDiffItem struct {
+	// Section is the plan section the item is in, for example "services".
+	Section string `json:"section"`
+
+	// Name is the item's name.
+	Name string `json:"name"`
+
+	// Action is "added", "removed", or "changed".
+	Action string `json:"action"`
+
+	// Fields lists the fields that differ, for changed items.
+	Fields []PlanDiffField `json:"fields,omitempty"`
+}
+
+// PlanDiffField describes how a single field of an item differs between two
+// plans. Old or New is nil if the field is unset in that plan.
+type PlanDiffField struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// PlanDiff fetches the differences between two plans, as specified by opts.
+// Exactly one of opts.From and opts.Layer must be set.
+func (client *Client) PlanDiff(opts *PlanDiffOptions) ([]*PlanDiffItem, error) {
+	if (opts.From == "") == (opts.Layer == nil) {
+		return nil, fmt.Errorf("must specify exactly one of From and Layer")
+	}
+
+	var items []*PlanDiffItem
+	if opts.From != "" {
+		query := url.Values{"from": []string{opts.From}}
+		_, err := client.doSync("GET", "/v1/plan/diff", query, nil, nil, &items)
+		if err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	var payload = struct {
+		Combine bool   `json:"combine"`
+		Label   string `json:"label"`
+		Format  string `json:"format"`
+		Layer   string `json:"layer"`
+	}{
+		Combine: opts.Layer.Combine,
+		Label:   opts.Layer.Label,
+		Format:  opts.Layer.format(),
+		Layer:   string(opts.Layer.LayerData),
+	}
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(&payload); err != nil {
+		return nil, err
+	}
+	_, err := client.doSync("POST", "/v1/plan/diff", nil, nil, &body, &items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
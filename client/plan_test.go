@@ -16,6 +16,7 @@ package client_test
 
 import (
 	"encoding/json"
+	"net/http"
 	"net/url"
 
 	"gopkg.in/check.v1"
@@ -57,6 +58,192 @@ services:
 	}
 }
 
+func (cs *clientSuite) TestAddLayerJSON(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	layerJSON := `{"services": {"foo": {"override": "replace", "command": "cmd"}}}`
+	err := cs.cli.AddLayer(&client.AddLayerOptions{
+		Label:     "foo",
+		LayerData: []byte(layerJSON),
+		Format:    "json",
+	})
+	c.Assert(err, check.IsNil)
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action":  "add",
+		"combine": false,
+		"label":   "foo",
+		"format":  "json",
+		"layer":   layerJSON,
+	})
+}
+
+func (cs *clientSuite) TestAddLayerPosition(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	order := 0
+	err := cs.cli.AddLayer(&client.AddLayerOptions{
+		Label:     "foo",
+		LayerData: []byte("summary: foo\n"),
+		Order:     &order,
+	})
+	c.Assert(err, check.IsNil)
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body["order"], check.Equals, 0.0)
+	c.Assert(body["insert-before"], check.IsNil)
+
+	err = cs.cli.AddLayer(&client.AddLayerOptions{
+		Label:        "foo",
+		LayerData:    []byte("summary: foo\n"),
+		InsertBefore: "vendor",
+	})
+	c.Assert(err, check.IsNil)
+	body = nil
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body["insert-before"], check.Equals, "vendor")
+	_, ok := body["order"]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (cs *clientSuite) TestAddLayerSigned(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	err := cs.cli.AddLayer(&client.AddLayerOptions{
+		Label:     "foo",
+		LayerData: []byte("services: {}\n"),
+		Signature: []byte{1, 2, 3},
+	})
+	c.Assert(err, check.IsNil)
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action":    "add",
+		"combine":   false,
+		"label":     "foo",
+		"format":    "yaml",
+		"layer":     "services: {}\n",
+		"signature": "AQID",
+	})
+}
+
+func (cs *clientSuite) TestValidateLayer(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	layerYAML := `
+services:
+    foo:
+        override: replace
+        command: cmd
+`[1:]
+	err := cs.cli.ValidateLayer(&client.AddLayerOptions{
+		Combine:   true,
+		Label:     "foo",
+		LayerData: []byte(layerYAML),
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/layers")
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action":  "validate",
+		"combine": true,
+		"label":   "foo",
+		"format":  "yaml",
+		"layer":   layerYAML,
+	})
+}
+
+func (cs *clientSuite) TestValidateLayerError(c *check.C) {
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 400,
+		"result": {"message": "service \"bar\" does not exist"}
+	}`
+	err := cs.cli.ValidateLayer(&client.AddLayerOptions{
+		Label:     "foo",
+		LayerData: []byte("services: {}\n"),
+	})
+	c.Assert(err, check.ErrorMatches, `service "bar" does not exist`)
+}
+
+func (cs *clientSuite) TestRemoveLayer(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	err := cs.cli.RemoveLayer(&client.RemoveLayerOptions{Label: "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/layers")
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action": "remove",
+		"label":  "foo",
+	})
+}
+
+func (cs *clientSuite) TestRemoveLayerError(c *check.C) {
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 404,
+		"result": {"message": "layer \"foo\" not found"}
+	}`
+	err := cs.cli.RemoveLayer(&client.RemoveLayerOptions{Label: "foo"})
+	c.Assert(err, check.ErrorMatches, `layer "foo" not found`)
+}
+
+func (cs *clientSuite) TestLayers(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [{"order": 1, "label": "base"}, {"order": 2, "label": "foo"}]
+	}`
+	layers, err := cs.cli.Layers()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/layers")
+	c.Check(layers, check.DeepEquals, []*client.LayerInfo{
+		{Order: 1, Label: "base"},
+		{Order: 2, Label: "foo"},
+	})
+}
+
+func (cs *clientSuite) TestMoveLayer(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	err := cs.cli.MoveLayer(&client.MoveLayerOptions{Label: "foo", Order: 0})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/layers")
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action": "move",
+		"label":  "foo",
+		"order":  0.0,
+	})
+}
+
 func (cs *clientSuite) TestPlanBytes(c *check.C) {
 	cs.rsp = `{
 		"type": "sync",
@@ -75,3 +262,208 @@ services:
         command: cmd
 `[1:])
 }
+
+func (cs *clientSuite) TestPlanBytesJSON(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"services": {"foo": {"override": "replace", "command": "cmd"}}}
+	}`
+	data, err := cs.cli.PlanBytes(&client.PlanOptions{Format: "json"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{"format": []string{"json"}})
+	c.Assert(string(data), check.Equals, `{"services": {"foo": {"override": "replace", "command": "cmd"}}}`)
+}
+
+func (cs *clientSuite) TestPlanBytesSection(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": "checks:\n    chk1:\n        override: replace\n"
+	}`
+	data, err := cs.cli.PlanBytes(&client.PlanOptions{Section: "checks"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"format":  []string{"yaml"},
+		"section": []string{"checks"},
+	})
+	c.Assert(string(data), check.Equals, "checks:\n    chk1:\n        override: replace\n")
+}
+
+func (cs *clientSuite) TestPlanSystemdUnits(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"foo.service": "[Service]\nExecStart=cmd\n"}
+	}`
+	units, err := cs.cli.PlanSystemdUnits()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/plan")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{"format": []string{"systemd"}})
+	c.Assert(units, check.DeepEquals, map[string]string{
+		"foo.service": "[Service]\nExecStart=cmd\n",
+	})
+}
+
+func (cs *clientSuite) TestPlanSection(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": "foo:\n    override: replace\n    command: cmd\n"
+	}`
+	data, err := cs.cli.PlanSection(&client.PlanSectionOptions{Name: "services"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/plan/sections/services")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{"format": []string{"yaml"}})
+	c.Assert(string(data), check.Equals, "foo:\n    override: replace\n    command: cmd\n")
+
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"foo": {"override": "replace", "command": "cmd"}}
+	}`
+	data, err = cs.cli.PlanSection(&client.PlanSectionOptions{Name: "services", Format: "json"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{"format": []string{"json"}})
+	c.Assert(string(data), check.Equals, `{"foo": {"override": "replace", "command": "cmd"}}`)
+}
+
+func (cs *clientSuite) TestAddPlanSection(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	sectionYAML := "foo:\n    override: replace\n    command: cmd\n"
+	err := cs.cli.AddPlanSection(&client.AddPlanSectionOptions{
+		Name:        "services",
+		Combine:     true,
+		Label:       "foo",
+		SectionData: []byte(sectionYAML),
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/plan/sections/services")
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action":  "add",
+		"combine": true,
+		"label":   "foo",
+		"format":  "yaml",
+		"section": sectionYAML,
+	})
+
+	err = cs.cli.ValidatePlanSection(&client.AddPlanSectionOptions{
+		Name:        "checks",
+		Label:       "bar",
+		SectionData: []byte(`{}`),
+		Format:      "json",
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/plan/sections/checks")
+	body = nil
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action":  "validate",
+		"combine": false,
+		"label":   "bar",
+		"format":  "json",
+		"section": `{}`,
+	})
+}
+
+func (cs *clientSuite) TestPlanBytesHash(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": "services: {}\n"
+	}`
+	cs.header = http.Header{"Etag": []string{`"abcd"`}}
+	data, hash, err := cs.cli.PlanBytesHash(&client.PlanOptions{})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Header.Get("If-None-Match"), check.Equals, "")
+	c.Check(string(data), check.Equals, "services: {}\n")
+	c.Check(hash, check.Equals, "abcd")
+}
+
+func (cs *clientSuite) TestPlanBytesNotModified(c *check.C) {
+	cs.rsp = ""
+	cs.status = http.StatusNotModified
+	cs.header = http.Header{"Etag": []string{`"abcd"`}}
+	data, hash, err := cs.cli.PlanBytesHash(&client.PlanOptions{IfNoneMatch: "abcd"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Header.Get("If-None-Match"), check.Equals, `"abcd"`)
+	c.Check(data, check.IsNil)
+	c.Check(hash, check.Equals, "abcd")
+
+	data, err = cs.cli.PlanBytes(&client.PlanOptions{IfNoneMatch: "abcd"})
+	c.Assert(err, check.IsNil)
+	c.Check(data, check.IsNil)
+}
+
+func (cs *clientSuite) TestPlanDiffFrom(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"section": "services", "name": "foo", "action": "added"},
+			{"section": "services", "name": "bar", "action": "changed", "fields": [
+				{"field": "command", "old": "cmd1", "new": "cmd2"},
+				{"field": "after", "new": ["foo"]}
+			]}
+		]
+	}`
+	items, err := cs.cli.PlanDiff(&client.PlanDiffOptions{From: "base"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/plan/diff")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{"from": {"base"}})
+	c.Assert(items, check.DeepEquals, []*client.PlanDiffItem{{
+		Section: "services",
+		Name:    "foo",
+		Action:  "added",
+	}, {
+		Section: "services",
+		Name:    "bar",
+		Action:  "changed",
+		Fields: []client.PlanDiffField{
+			{Field: "command", Old: "cmd1", New: "cmd2"},
+			{Field: "after", New: []interface{}{"foo"}},
+		},
+	}})
+}
+
+func (cs *clientSuite) TestPlanDiffLayer(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": []
+	}`
+	items, err := cs.cli.PlanDiff(&client.PlanDiffOptions{Layer: &client.AddLayerOptions{
+		Combine:   true,
+		Label:     "foo",
+		LayerData: []byte("summary: x\n"),
+	}})
+	c.Assert(err, check.IsNil)
+	c.Assert(items, check.HasLen, 0)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/plan/diff")
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"combine": true,
+		"label":   "foo",
+		"format":  "yaml",
+		"layer":   "summary: x\n",
+	})
+}
+
+func (cs *clientSuite) TestPlanDiffInvalidOptions(c *check.C) {
+	_, err := cs.cli.PlanDiff(&client.PlanDiffOptions{})
+	c.Assert(err, check.ErrorMatches, "must specify exactly one of From and Layer")
+	_, err = cs.cli.PlanDiff(&client.PlanDiffOptions{From: "x", Layer: &client.AddLayerOptions{}})
+	c.Assert(err, check.ErrorMatches, "must specify exactly one of From and Layer")
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"strings"
 	"time"
@@ -60,6 +61,46 @@ func (client *Client) Replan(opts *ServiceOptions) (changeID string, err error)
 	return changeID, err
 }
 
+// ServiceOperation is a single action on a list of services, as part of a
+// batch.
+type ServiceOperation struct {
+	// Action is "start", "stop", or "restart".
+	Action   string   `json:"action"`
+	Services []string `json:"services"`
+}
+
+type BatchOptions struct {
+	Operations []ServiceOperation
+}
+
+// Batch performs the given service operations in a single change. All the
+// stops (including those for restarts) happen first, in dependency order
+// across every operation, followed by all the starts.
+func (client *Client) Batch(opts *BatchOptions) (changeID string, err error) {
+	action := batchActionData{
+		Action:     "batch",
+		Operations: opts.Operations,
+	}
+	data, err := json.Marshal(&action)
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal batch service action: %w", err)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	resp, err := client.doAsync("POST", "/v1/services", nil, headers, bytes.NewBuffer(data), nil)
+	if err != nil {
+		return "", err
+	}
+	return resp.ChangeID, nil
+}
+
+type batchActionData struct {
+	Action     string             `json:"action"`
+	Operations []ServiceOperation `json:"operations"`
+}
+
 type multiActionData struct {
 	Action   string   `json:"action"`
 	Services []string `json:"services"`
@@ -85,6 +126,25 @@ func (client *Client) doMultiServiceAction(actionName string, services []string)
 	return resp.ChangeID, nil
 }
 
+type SendStdinOptions struct {
+	// Service is the name of the service, which must be running with
+	// "stdin: pipe".
+	Service string
+
+	// Data is sent to the service's standard input.
+	Data io.Reader
+}
+
+// SendStdin sends data to the standard input of a running service.
+func (client *Client) SendStdin(opts *SendStdinOptions) error {
+	headers := map[string]string{
+		"Content-Type": "application/octet-stream",
+	}
+	path := "/v1/services/" + url.PathEscape(opts.Service) + "/stdin"
+	_, err := client.doSync("POST", path, nil, headers, opts.Data, nil)
+	return err
+}
+
 type ServicesOptions struct {
 	// Names is the list of service names to query for. If slice is nil or
 	// empty, fetch information for all services.
@@ -16,7 +16,9 @@ package client_test
 
 import (
 	"encoding/json"
+	"io"
 	"net/url"
+	"strings"
 	"time"
 
 	"gopkg.in/check.v1"
@@ -137,6 +139,60 @@ func (cs *clientSuite) TestRestart(c *check.C) {
 	c.Check(body["services"], check.DeepEquals, []interface{}{"one", "two"})
 }
 
+func (cs *clientSuite) TestBatch(c *check.C) {
+	cs.rsp = `{
+		"result": {},
+		"status": "OK",
+		"status-code": 202,
+		"type": "async",
+		"change": "42"
+	}`
+
+	opts := client.BatchOptions{
+		Operations: []client.ServiceOperation{
+			{Action: "stop", Services: []string{"one"}},
+			{Action: "start", Services: []string{"two", "three"}},
+		},
+	}
+
+	changeId, err := cs.cli.Batch(&opts)
+	c.Check(err, check.IsNil)
+	c.Check(changeId, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/services")
+
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.DeepEquals, map[string]interface{}{
+		"action": "batch",
+		"operations": []interface{}{
+			map[string]interface{}{"action": "stop", "services": []interface{}{"one"}},
+			map[string]interface{}{"action": "start", "services": []interface{}{"two", "three"}},
+		},
+	})
+}
+
+func (cs *clientSuite) TestSendStdin(c *check.C) {
+	cs.rsp = `{
+		"result": true,
+		"status": "OK",
+		"status-code": 200,
+		"type": "sync"
+	}`
+
+	err := cs.cli.SendStdin(&client.SendStdinOptions{
+		Service: "console",
+		Data:    strings.NewReader("hello\n"),
+	})
+	c.Check(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/services/console/stdin")
+	c.Check(cs.req.Header.Get("Content-Type"), check.Equals, "application/octet-stream")
+	body, err := io.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, "hello\n")
+}
+
 func (cs *clientSuite) TestReplan(c *check.C) {
 	cs.rsp = `{
 		"result": {},
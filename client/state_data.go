@@ -0,0 +1,27 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"net/url"
+)
+
+// StateData gets the data a manager stored in the server's state under the
+// given key, and unmarshals it into value. The server only allows reading
+// keys it was configured to allow, and only by admins.
+func (client *Client) StateData(key string, value interface{}) error {
+	_, err := client.doSync("GET", "/v1/debug/state-data/"+url.PathEscape(key), nil, nil, nil, value)
+	return err
+}
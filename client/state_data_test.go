@@ -0,0 +1,42 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"gopkg.in/check.v1"
+)
+
+func (cs *clientSuite) TestStateData(c *check.C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": {"fw1": {"version": "1.2"}}}`
+
+	var firmwares map[string]struct {
+		Version string `json:"version"`
+	}
+	err := cs.cli.StateData("firmwares", &firmwares)
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/debug/state-data/firmwares")
+	c.Check(firmwares, check.HasLen, 1)
+	c.Check(firmwares["fw1"].Version, check.Equals, "1.2")
+}
+
+func (cs *clientSuite) TestStateDataError(c *check.C) {
+	cs.status = 403
+	cs.rsp = `{"type": "error", "status-code": 403, "result": {"message": "state data key \"foo\" is not allowed"}}`
+
+	var value interface{}
+	err := cs.cli.StateData("foo", &value)
+	c.Assert(err, check.ErrorMatches, `state data key "foo" is not allowed`)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeSyncStatus holds the time synchronisation status of the system clock.
+type TimeSyncStatus struct {
+	// Synchronized is true if the last synchronisation attempt succeeded.
+	Synchronized bool
+
+	// Server is the name of the time server last synchronised with.
+	Server string
+
+	// Offset is the clock offset corrected at the last synchronisation.
+	Offset time.Duration
+
+	// LastSync is the time of the last successful synchronisation, or the
+	// zero value if the clock has never been synchronised.
+	LastSync time.Time
+
+	// Error is the error from the last synchronisation attempt, if it failed.
+	Error string
+}
+
+type timeSyncInfo struct {
+	Synchronized bool       `json:"synchronized"`
+	Server       string     `json:"server"`
+	Offset       string     `json:"offset"`
+	LastSync     *time.Time `json:"last-sync"`
+	Error        string     `json:"error"`
+}
+
+// TimeSync fetches the time synchronisation status.
+func (client *Client) TimeSync() (*TimeSyncStatus, error) {
+	var info timeSyncInfo
+	_, err := client.doSync("GET", "/v1/time-sync", nil, nil, nil, &info)
+	if err != nil {
+		return nil, err
+	}
+	status := &TimeSyncStatus{
+		Synchronized: info.Synchronized,
+		Server:       info.Server,
+		Error:        info.Error,
+	}
+	if info.Offset != "" {
+		status.Offset, err = time.ParseDuration(info.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time sync offset %q: %w", info.Offset, err)
+		}
+	}
+	if info.LastSync != nil {
+		status.LastSync = *info.LastSync
+	}
+	return status, nil
+}
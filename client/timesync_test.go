@@ -0,0 +1,66 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+func (cs *clientSuite) TestTimeSync(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"status": "OK",
+		"result": {
+			"synchronized": true,
+			"server": "pool",
+			"offset": "-1.5ms",
+			"last-sync": "2024-05-01T12:00:00Z"
+		}
+	}`
+
+	status, err := cs.cli.TimeSync()
+	c.Assert(err, check.IsNil)
+	c.Assert(cs.req.Method, check.Equals, "GET")
+	c.Assert(cs.req.URL.Path, check.Equals, "/v1/time-sync")
+	c.Assert(status, check.DeepEquals, &client.TimeSyncStatus{
+		Synchronized: true,
+		Server:       "pool",
+		Offset:       -1500 * time.Microsecond,
+		LastSync:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	})
+}
+
+func (cs *clientSuite) TestTimeSyncNotSynchronized(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 502,
+		"status": "Bad Gateway",
+		"result": {
+			"synchronized": false,
+			"error": "cannot query time server \"pool\": i/o timeout"
+		}
+	}`
+
+	status, err := cs.cli.TimeSync()
+	c.Assert(err, check.IsNil)
+	c.Assert(status, check.DeepEquals, &client.TimeSyncStatus{
+		Error: `cannot query time server "pool": i/o timeout`,
+	})
+}
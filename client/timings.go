@@ -0,0 +1,91 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timing is a measurement recorded by the server, such as one of the phases
+// of its startup.
+type Timing struct {
+	// Tags identify what was measured, for example {"startup": "load-state"}.
+	Tags map[string]string
+
+	// StartTime is when the measurement started.
+	StartTime time.Time
+
+	// Duration is how long the measured operation took.
+	Duration time.Duration
+
+	// Spans are the nested measurements, in the order they were started.
+	Spans []TimingSpan
+}
+
+// TimingSpan is a nested measurement within a Timing.
+type TimingSpan struct {
+	Label   string
+	Summary string
+
+	// Depth is how deeply the span is nested, starting at 1.
+	Depth int
+
+	// Start is the offset of the start of the span from the timing's
+	// StartTime.
+	Start time.Duration
+
+	// Duration is how long the span took.
+	Duration time.Duration
+}
+
+type timingSpanJSON struct {
+	Label   string            `json:"label"`
+	Summary string            `json:"summary"`
+	Depth   int               `json:"depth"`
+	Tags    map[string]string `json:"tags"`
+	Base    int64             `json:"base"`
+	A       int64             `json:"a"`
+	B       int64             `json:"b"`
+	Spans   []timingSpanJSON  `json:"spans"`
+}
+
+// Timings gets the timings recorded by the server, oldest first.
+func (client *Client) Timings() ([]*Timing, error) {
+	var spans []timingSpanJSON
+	_, err := client.doSync("GET", "/v1/debug/timings", nil, nil, nil, &spans)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain timings: %w", err)
+	}
+	timings := make([]*Timing, len(spans))
+	for i, s := range spans {
+		t := &Timing{
+			Tags:      s.Tags,
+			StartTime: time.Unix(s.Base, s.A),
+			Duration:  time.Duration(s.B - s.A),
+		}
+		for _, n := range s.Spans {
+			t.Spans = append(t.Spans, TimingSpan{
+				Label:    n.Label,
+				Summary:  n.Summary,
+				Depth:    n.Depth,
+				Start:    time.Duration(n.A - s.A),
+				Duration: time.Duration(n.B - n.A),
+			})
+		}
+		timings[i] = t
+	}
+	return timings, nil
+}
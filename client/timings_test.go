@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+func (cs *clientSuite) TestTimings(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"status": "OK",
+		"result": [{
+			"tags": {"startup": "load-state"},
+			"base": 1714564800,
+			"a": 500000000,
+			"b": 520000000
+		}, {
+			"tags": {"startup": "managers"},
+			"base": 1714564801,
+			"a": 100000000,
+			"b": 400000000,
+			"spans": [{
+				"label": "ServiceManager",
+				"summary": "start up ServiceManager",
+				"depth": 1,
+				"a": 150000000,
+				"b": 350000000
+			}]
+		}]
+	}`
+
+	timings, err := cs.cli.Timings()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/debug/timings")
+	c.Check(timings, check.DeepEquals, []*client.Timing{{
+		Tags:      map[string]string{"startup": "load-state"},
+		StartTime: time.Unix(1714564800, 500000000),
+		Duration:  20 * time.Millisecond,
+	}, {
+		Tags:      map[string]string{"startup": "managers"},
+		StartTime: time.Unix(1714564801, 100000000),
+		Duration:  300 * time.Millisecond,
+		Spans: []client.TimingSpan{{
+			Label:    "ServiceManager",
+			Summary:  "start up ServiceManager",
+			Depth:    1,
+			Start:    50 * time.Millisecond,
+			Duration: 200 * time.Millisecond,
+		}},
+	}})
+}
+
+func (cs *clientSuite) TestTimingsError(c *check.C) {
+	cs.rsp = `{"type": "error", "status-code": 500, "result": {"message": "oops"}}`
+	_, err := cs.cli.Timings()
+	c.Assert(err, check.ErrorMatches, "cannot obtain timings: oops")
+}
@@ -22,11 +22,16 @@ import (
 )
 
 // Warning holds a short message that's meant to alert about system events.
-// There'll only ever be one Warning with the same message, and it can be
-// silenced for a while before repeating. After a (supposedly longer) while
-// it'll go away on its own (unless it recurs).
+// There'll only ever be one Warning with the same key (or message, if it has
+// no key), and it can be silenced for a while before repeating. After a
+// (supposedly longer) while it'll go away on its own (unless it recurs).
 type Warning struct {
-	Message     string        `json:"message"`
+	// Key identifies a warning whose message may vary between occurrences.
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+	// Data is structured information about the last occurrence.
+	Data map[string]string `json:"data,omitempty"`
+
 	FirstAdded  time.Time     `json:"first-added"`
 	LastAdded   time.Time     `json:"last-added"`
 	LastShown   time.Time     `json:"last-shown,omitempty"`
@@ -39,7 +39,9 @@ func (cs *clientSuite) testWarnings(c *check.C, all bool) {
 			"expire-after": "672h0m0s",
 			"first-added": "2018-09-19T12:44:19.680362867Z",
 			"last-added": "2018-09-19T12:44:19.680362867Z",
+			"key": "hello/two",
 			"message": "hello world number two",
+			"data": {"number": "2"},
 			"repeat-after": "24h0m0s"
 		    }
 		],
@@ -61,7 +63,9 @@ func (cs *clientSuite) testWarnings(c *check.C, all bool) {
 			RepeatAfter: time.Hour * 24,
 		},
 		{
+			Key:         "hello/two",
 			Message:     "hello world number two",
+			Data:        map[string]string{"number": "2"},
 			FirstAdded:  t2,
 			LastAdded:   t2,
 			ExpireAfter: time.Hour * 24 * 28,
@@ -0,0 +1,365 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package bundle reads and writes signed layer bundles.
+//
+// A bundle is a tar archive containing:
+//
+//   - manifest.yaml, which gives the bundle's version and lists the layer
+//     files with their SHA-256 digests;
+//   - manifest.sig, the Ed25519 signature of manifest.yaml;
+//   - the layer files, named like the files in the layers directory (for
+//     example "layers/001-base.yaml").
+//
+// As the manifest includes the digests of the layers, the signature covers
+// the whole bundle.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+const (
+	manifestName  = "manifest.yaml"
+	signatureName = "manifest.sig"
+	layersDir     = "layers"
+)
+
+// MaxSize is the maximum size of a bundle, to limit the memory used to read
+// one.
+const MaxSize = 16 * 1024 * 1024
+
+// Bundle is a verified layer bundle.
+type Bundle struct {
+	Version string
+	Layers  []*plan.Layer
+}
+
+type manifest struct {
+	Version string          `yaml:"version"`
+	Layers  []manifestLayer `yaml:"layers"`
+}
+
+type manifestLayer struct {
+	File   string `yaml:"file"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// Read reads a bundle from r and verifies that it's signed by one of the
+// given keys. The layers are parsed as if read from the layers directory.
+func Read(r io.Reader, keys []ed25519.PublicKey) (*Bundle, error) {
+	files, err := readTar(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read bundle: %w", err)
+	}
+
+	manifestData, ok := files[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("invalid bundle: no %s", manifestName)
+	}
+	signature, ok := files[signatureName]
+	if !ok {
+		return nil, fmt.Errorf("invalid bundle: no %s", signatureName)
+	}
+	if !Verify(keys, manifestData, signature) {
+		return nil, errors.New("invalid bundle: signature not made by a trusted key")
+	}
+
+	var m manifest
+	err = yaml.Unmarshal(manifestData, &m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	if m.Version == "" {
+		return nil, errors.New("invalid bundle manifest: no version")
+	}
+	if _, err := parseVersion(m.Version); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+
+	layerFiles := make(map[string][]byte, len(m.Layers))
+	for _, layer := range m.Layers {
+		name := path.Join(layersDir, layer.File)
+		if path.Dir(name) != layersDir || !strings.HasSuffix(layer.File, ".yaml") {
+			return nil, fmt.Errorf("invalid bundle manifest: invalid layer file %q", layer.File)
+		}
+		data, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid bundle: layer file %q missing", layer.File)
+		}
+		digest := sha256.Sum256(data)
+		if hex.EncodeToString(digest[:]) != strings.ToLower(layer.SHA256) {
+			return nil, fmt.Errorf("invalid bundle: layer file %q doesn't match its digest", layer.File)
+		}
+		layerFiles[layer.File] = data
+	}
+	for name := range files {
+		if name == manifestName || name == signatureName {
+			continue
+		}
+		if _, ok := layerFiles[strings.TrimPrefix(name, layersDir+"/")]; !ok {
+			return nil, fmt.Errorf("invalid bundle: file %q not in manifest", name)
+		}
+	}
+
+	layers, err := parseLayers(layerFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{Version: m.Version, Layers: layers}, nil
+}
+
+// CompareVersions compares two valid bundle versions, returning a negative
+// number if a is older than b, zero if they're the same, and a positive
+// number if a is newer.
+func CompareVersions(a, b string) int {
+	// Both versions have been checked by Read.
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+	for i := 0; i < len(va) && i < len(vb); i++ {
+		if va[i] != vb[i] {
+			if va[i] < vb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(va) - len(vb)
+}
+
+// parseVersion parses a bundle version, which is one or more numbers
+// separated by dots, optionally prefixed with "v", such as "v3" or
+// "2024.10.1".
+func parseVersion(version string) ([]uint64, error) {
+	fields := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	numbers := make([]uint64, len(fields))
+	for i, field := range fields {
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: must be numbers separated by dots, like \"1.2\" or \"v3\"", version)
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+
+// readTar reads the regular files in a tar archive into memory.
+func readTar(r io.Reader) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	tr := tar.NewReader(io.LimitReader(r, MaxSize+1))
+	total := int64(0)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%q is not a regular file", hdr.Name)
+		}
+		name := path.Clean(hdr.Name)
+		if _, ok := files[name]; ok {
+			return nil, fmt.Errorf("duplicate file %q", hdr.Name)
+		}
+		total += hdr.Size
+		if total > MaxSize {
+			return nil, fmt.Errorf("bundle larger than %d bytes", MaxSize)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+}
+
+// Verify reports whether signature is a valid signature of message made by
+// one of the given keys.
+func Verify(keys []ed25519.PublicKey, message, signature []byte) bool {
+	for _, key := range keys {
+		if ed25519.Verify(key, message, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignedLayerHeader describes where a signed layer is added. It's signed
+// along with the layer's content, so that a signature can't be replayed to
+// add the same content under another label, to another section, or with
+// another precedence.
+type SignedLayerHeader struct {
+	// Section is the plan section, or empty for a whole layer.
+	Section string `json:"section"`
+	Label   string `json:"label"`
+	Combine bool   `json:"combine"`
+
+	// Order and InsertBefore give the layer's position, and are left out
+	// of the header if unset.
+	Order        *int   `json:"order,omitempty"`
+	InsertBefore string `json:"insert-before,omitempty"`
+}
+
+// SignedLayerData returns the message that's signed to add a layer: the
+// header as a line of JSON, followed by the content.
+func SignedLayerData(header *SignedLayerHeader, content []byte) []byte {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// Encoding the header can't fail, and the encoder ends it with a
+	// newline.
+	_ = encoder.Encode(header)
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+// parseLayers parses the layer files using the same rules as the layers
+// directory, by writing them to a temporary one.
+func parseLayers(files map[string][]byte) ([]*plan.Layer, error) {
+	dir, err := os.MkdirTemp("", "pebble-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range files {
+		err := os.WriteFile(filepath.Join(dir, name), data, 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+	layers, err := plan.ReadLayersDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	return layers, nil
+}
+
+// Write writes a bundle containing the given layer files, which are named
+// like the files in the layers directory, signed with key.
+func Write(w io.Writer, version string, layers map[string][]byte, key ed25519.PrivateKey) error {
+	names := make([]string, 0, len(layers))
+	for name := range layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m := manifest{Version: version}
+	for _, name := range names {
+		digest := sha256.Sum256(layers[name])
+		m.Layers = append(m.Layers, manifestLayer{
+			File:   name,
+			SHA256: hex.EncodeToString(digest[:]),
+		})
+	}
+	manifestData, err := yaml.Marshal(&m)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	add := func(name string, data []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+	err = add(manifestName, manifestData)
+	if err != nil {
+		return err
+	}
+	err = add(signatureName, ed25519.Sign(key, manifestData))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = add(path.Join(layersDir, name), layers[name])
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// ParsePublicKey parses an Ed25519 public key encoded in base64, as stored
+// in the trusted keys directory.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: must be %d bytes, not %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// TrustedKeysDir returns the directory containing the trusted keys for the
+// given $PEBBLE directory.
+func TrustedKeysDir(pebbleDir string) string {
+	return filepath.Join(pebbleDir, "trusted-keys")
+}
+
+// ReadKeysDir reads the public keys from the "*.pub" files in dir. It
+// returns no keys, and no error, if dir doesn't exist.
+func ReadKeysDir(dir string) ([]ed25519.PublicKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var keys []ed25519.PublicKey
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read trusted key: %w", err)
+		}
+		key, err := ParsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read trusted key %q: %w", filepath.Base(p), err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
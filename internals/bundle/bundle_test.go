@@ -0,0 +1,292 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package bundle_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/bundle"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type bundleSuite struct {
+	pub  ed25519.PublicKey
+	priv ed25519.PrivateKey
+}
+
+var _ = Suite(&bundleSuite{})
+
+func (s *bundleSuite) SetUpSuite(c *C) {
+	var err error
+	s.pub, s.priv, err = ed25519.GenerateKey(nil)
+	c.Assert(err, IsNil)
+}
+
+var testLayers = map[string][]byte{
+	"001-base.yaml": []byte(`
+services:
+    srv1:
+        override: replace
+        command: sleep 10
+`),
+	"002-extra.yaml": []byte(`
+services:
+    srv2:
+        override: replace
+        command: sleep 20
+`),
+}
+
+func (s *bundleSuite) writeBundle(c *C, layers map[string][]byte) []byte {
+	var buf bytes.Buffer
+	err := bundle.Write(&buf, "v1.2", layers, s.priv)
+	c.Assert(err, IsNil)
+	return buf.Bytes()
+}
+
+func (s *bundleSuite) TestReadWrite(c *C) {
+	data := s.writeBundle(c, testLayers)
+
+	b, err := bundle.Read(bytes.NewReader(data), []ed25519.PublicKey{s.pub})
+	c.Assert(err, IsNil)
+	c.Check(b.Version, Equals, "v1.2")
+	c.Assert(b.Layers, HasLen, 2)
+	c.Check(b.Layers[0].Order, Equals, 1)
+	c.Check(b.Layers[0].Label, Equals, "base")
+	c.Check(b.Layers[0].Services["srv1"].Command, Equals, "sleep 10")
+	c.Check(b.Layers[1].Order, Equals, 2)
+	c.Check(b.Layers[1].Label, Equals, "extra")
+}
+
+func (s *bundleSuite) TestReadOtherKey(c *C) {
+	data := s.writeBundle(c, testLayers)
+	other, _, err := ed25519.GenerateKey(nil)
+	c.Assert(err, IsNil)
+
+	// Any of the keys may have signed the bundle.
+	_, err = bundle.Read(bytes.NewReader(data), []ed25519.PublicKey{other, s.pub})
+	c.Assert(err, IsNil)
+
+	_, err = bundle.Read(bytes.NewReader(data), []ed25519.PublicKey{other})
+	c.Assert(err, ErrorMatches, "invalid bundle: signature not made by a trusted key")
+
+	_, err = bundle.Read(bytes.NewReader(data), nil)
+	c.Assert(err, ErrorMatches, "invalid bundle: signature not made by a trusted key")
+}
+
+type tarFile struct {
+	name string
+	data []byte
+}
+
+func writeTar(c *C, files ...tarFile) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Mode:     0644,
+			Size:     int64(len(f.data)),
+		})
+		c.Assert(err, IsNil)
+		_, err = tw.Write(f.data)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(tw.Close(), IsNil)
+	return buf.Bytes()
+}
+
+// readFiles returns the files in a tar archive, in order.
+func readFiles(c *C, data []byte) []tarFile {
+	var files []tarFile
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(tr)
+		c.Assert(err, IsNil)
+		files = append(files, tarFile{hdr.Name, buf.Bytes()})
+	}
+	return files
+}
+
+func (s *bundleSuite) TestReadErrors(c *C) {
+	valid := readFiles(c, s.writeBundle(c, testLayers))
+	c.Assert(valid, HasLen, 4)
+	manifest, signature := valid[0], valid[1]
+	sign := func(manifest string) []tarFile {
+		return []tarFile{
+			{"manifest.yaml", []byte(manifest)},
+			{"manifest.sig", ed25519.Sign(s.priv, []byte(manifest))},
+		}
+	}
+
+	tests := []struct {
+		files []tarFile
+		error string
+	}{{
+		files: []tarFile{signature, valid[2], valid[3]},
+		error: `invalid bundle: no manifest.yaml`,
+	}, {
+		files: []tarFile{manifest, valid[2], valid[3]},
+		error: `invalid bundle: no manifest.sig`,
+	}, {
+		files: []tarFile{manifest, {"manifest.sig", []byte("bad")}, valid[2], valid[3]},
+		error: `invalid bundle: signature not made by a trusted key`,
+	}, {
+		files: []tarFile{manifest, signature, valid[2], valid[3], valid[3]},
+		error: `cannot read bundle: duplicate file "layers/002-extra.yaml"`,
+	}, {
+		files: []tarFile{manifest, signature, valid[2]},
+		error: `invalid bundle: layer file "002-extra.yaml" missing`,
+	}, {
+		files: []tarFile{manifest, signature, valid[2], {"layers/002-extra.yaml", []byte("changed")}},
+		error: `invalid bundle: layer file "002-extra.yaml" doesn't match its digest`,
+	}, {
+		files: []tarFile{manifest, signature, valid[2], valid[3], {"layers/003-more.yaml", nil}},
+		error: `invalid bundle: file "layers/003-more.yaml" not in manifest`,
+	}, {
+		files: sign("layers: []"),
+		error: `invalid bundle manifest: no version`,
+	}, {
+		files: sign("version: 1\nlayers: [{file: ../001-base.yaml}]"),
+		error: `invalid bundle manifest: invalid layer file "../001-base.yaml"`,
+	}, {
+		files: sign("version: 1\nlayers: [{file: 001-base.txt}]"),
+		error: `invalid bundle manifest: invalid layer file "001-base.txt"`,
+	}, {
+		files: sign("version: 1.x\nlayers: []"),
+		error: `invalid bundle manifest: invalid version "1.x": must be numbers separated by dots, like "1.2" or "v3"`,
+	}, {
+		files: sign("version: [1"),
+		error: `invalid bundle manifest: .*`,
+	}}
+	for _, test := range tests {
+		_, err := bundle.Read(bytes.NewReader(writeTar(c, test.files...)), []ed25519.PublicKey{s.pub})
+		c.Check(err, ErrorMatches, test.error)
+	}
+}
+
+func (s *bundleSuite) TestCompareVersions(c *C) {
+	tests := []struct {
+		a, b   string
+		result int
+	}{
+		{"1", "1", 0},
+		{"v1", "1", 0},
+		{"1", "2", -1},
+		{"v10", "v9", 1},
+		{"1.2", "1.10", -1},
+		{"2024.10.1", "2024.9.30", 1},
+		{"1.2", "1.2.0", -1},
+		{"1.2.1", "1.2", 1},
+	}
+	for _, test := range tests {
+		result := bundle.CompareVersions(test.a, test.b)
+		switch {
+		case result < 0:
+			result = -1
+		case result > 0:
+			result = 1
+		}
+		c.Check(result, Equals, test.result, Commentf("%s vs %s", test.a, test.b))
+	}
+}
+
+func (s *bundleSuite) TestReadInvalidLayer(c *C) {
+	data := s.writeBundle(c, map[string][]byte{"001-base.yaml": []byte("services: [")})
+	_, err := bundle.Read(bytes.NewReader(data), []ed25519.PublicKey{s.pub})
+	c.Assert(err, ErrorMatches, `(?s)invalid bundle: cannot parse layer "base": .*`)
+
+	data = s.writeBundle(c, map[string][]byte{"base.yaml": []byte("")})
+	_, err = bundle.Read(bytes.NewReader(data), []ed25519.PublicKey{s.pub})
+	c.Assert(err, ErrorMatches, `invalid bundle: invalid layer filename: "base.yaml" .*`)
+}
+
+func (s *bundleSuite) TestReadNotRegular(c *C) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "manifest.yaml", Linkname: "/etc/passwd"})
+	c.Assert(err, IsNil)
+	c.Assert(tw.Close(), IsNil)
+
+	_, err = bundle.Read(&buf, []ed25519.PublicKey{s.pub})
+	c.Assert(err, ErrorMatches, `cannot read bundle: "manifest.yaml" is not a regular file`)
+}
+
+func (s *bundleSuite) TestReadKeysDir(c *C) {
+	dir := c.MkDir()
+	keys, err := bundle.ReadKeysDir(filepath.Join(dir, "missing"))
+	c.Assert(err, IsNil)
+	c.Check(keys, HasLen, 0)
+
+	encoded := base64.StdEncoding.EncodeToString(s.pub)
+	err = os.WriteFile(filepath.Join(dir, "a.pub"), []byte(encoded+"\n"), 0644)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(dir, "README"), []byte("not a key"), 0644)
+	c.Assert(err, IsNil)
+	keys, err = bundle.ReadKeysDir(dir)
+	c.Assert(err, IsNil)
+	c.Check(keys, DeepEquals, []ed25519.PublicKey{s.pub})
+
+	err = os.WriteFile(filepath.Join(dir, "b.pub"), []byte("AAAA"), 0644)
+	c.Assert(err, IsNil)
+	_, err = bundle.ReadKeysDir(dir)
+	c.Assert(err, ErrorMatches, `cannot read trusted key "b.pub": invalid public key: must be 32 bytes, not 3`)
+}
+
+func (s *bundleSuite) TestParsePublicKey(c *C) {
+	key, err := bundle.ParsePublicKey([]byte(base64.StdEncoding.EncodeToString(s.pub)))
+	c.Assert(err, IsNil)
+	c.Check(key, DeepEquals, s.pub)
+
+	_, err = bundle.ParsePublicKey([]byte("!"))
+	c.Assert(err, ErrorMatches, `invalid public key: illegal base64 data .*`)
+}
+
+func (s *bundleSuite) TestVerify(c *C) {
+	other, _, err := ed25519.GenerateKey(nil)
+	c.Assert(err, IsNil)
+	message := []byte("services: {}\n")
+	signature := ed25519.Sign(s.priv, message)
+
+	c.Check(bundle.Verify([]ed25519.PublicKey{other, s.pub}, message, signature), Equals, true)
+	c.Check(bundle.Verify([]ed25519.PublicKey{other}, message, signature), Equals, false)
+	c.Check(bundle.Verify([]ed25519.PublicKey{s.pub}, []byte("services: {}"), signature), Equals, false)
+	c.Check(bundle.Verify(nil, message, signature), Equals, false)
+}
+
+func (s *bundleSuite) TestSignedLayerData(c *C) {
+	data := bundle.SignedLayerData(&bundle.SignedLayerHeader{Label: "base"}, []byte("services: {}\n"))
+	c.Check(string(data), Equals, `{"section":"","label":"base","combine":false}`+"\nservices: {}\n")
+	data = bundle.SignedLayerData(&bundle.SignedLayerHeader{Section: "checks", Label: "a&b\nc", Combine: true}, []byte("{}"))
+	c.Check(string(data), Equals, `{"section":"checks","label":"a&b\nc","combine":true}`+"\n{}")
+	order := 0
+	data = bundle.SignedLayerData(&bundle.SignedLayerHeader{Label: "x", Order: &order, InsertBefore: "y"}, nil)
+	c.Check(string(data), Equals, `{"section":"","label":"x","combine":false,"order":0,"insert-before":"y"}`+"\n")
+}
@@ -24,6 +24,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 	"unicode"
@@ -93,6 +94,10 @@ type CmdInfo struct {
 
 	// When set, the command will be a subcommand of the `debug` command.
 	Debug bool
+
+	// When set, the command will be a subcommand of the named top-level
+	// command, which can still be run without a subcommand.
+	Parent string
 }
 
 // commands holds information about all the regular Pebble commands.
@@ -167,6 +172,9 @@ func Parser(opts *ParserOptions) *flags.Parser {
 		},
 	}
 
+	// Positional arguments query the daemon when completing
+	completionClient = opts.Client
+
 	flagOpts := flags.Options(flags.PassDoubleDash)
 	parser := flags.NewParser(&defaultOpts, flagOpts)
 	parser.Command.Name = cmd.ProgramName
@@ -187,8 +195,13 @@ func Parser(opts *ParserOptions) *flags.Parser {
 		logger.Panicf("internal error: cannot add command %q: %v", "debug", err)
 	}
 
-	// Add all commands
-	for _, c := range commands {
+	// Add all commands, with subcommands after their parent commands.
+	sorted := make([]*CmdInfo, len(commands))
+	copy(sorted, commands)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Parent == "" && sorted[j].Parent != ""
+	})
+	for _, c := range sorted {
 		obj := c.New(&CmdOptions{
 			Client:     opts.Client,
 			Parser:     parser,
@@ -197,9 +210,16 @@ func Parser(opts *ParserOptions) *flags.Parser {
 		})
 
 		var target *flags.Command
-		if c.Debug {
+		switch {
+		case c.Debug:
 			target = debugCmd
-		} else {
+		case c.Parent != "":
+			target = parser.Find(c.Parent)
+			if target == nil {
+				logger.Panicf("internal error: cannot find parent command %q for %q", c.Parent, c.Name)
+			}
+			target.SubcommandsOptional = true
+		default:
 			target = parser.Command
 		}
 		cmd, err := target.AddCommand(c.Name, applyPersonality(c.Summary), applyPersonality(strings.TrimSpace(c.Description)), obj)
@@ -301,7 +321,11 @@ func Run(options *RunOptions) error {
 
 	log := options.Logger
 	if log == nil {
-		log = logger.New(os.Stderr, fmt.Sprintf("[%s] ", cmd.ProgramName))
+		if os.Getenv("PEBBLE_LOG_FORMAT") == "json" {
+			log = logger.NewJSON(os.Stderr)
+		} else {
+			log = logger.New(os.Stderr, fmt.Sprintf("[%s] ", cmd.ProgramName))
+		}
 	}
 	logger.SetLogger(log)
 
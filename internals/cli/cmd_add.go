@@ -15,8 +15,10 @@
 package cli
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/canonical/go-flags"
 
@@ -29,15 +31,32 @@ The add command reads the plan's layer YAML from the path specified and
 appends a layer with the given label to the plan's layers. If --combine
 is specified, combine the layer with an existing layer that has the given
 label (or append if the label is not found).
+
+If --order or --insert-before is specified, the new layer is placed at that
+order, or before the layer with the given label, rather than after the other
+layers, so that the layers after it take precedence. Layers are renumbered
+to make room if needed, including the files of layers from the layers
+directory.
+
+If --dry-run is specified, check that the layer could be added and that the
+resulting plan would be valid, without changing the plan.
+
+If --signature is specified, send the base64-encoded Ed25519 signature of
+the layer file read from that path, which the daemon checks against its
+trusted keys.
 `
 
 type cmdAdd struct {
 	client *client.Client
 
-	Combine    bool `long:"combine"`
-	Positional struct {
-		Label     string `positional-arg-name:"<label>" required:"1"`
-		LayerPath string `positional-arg-name:"<layer-path>" required:"1"`
+	Combine      bool   `long:"combine"`
+	DryRun       bool   `long:"dry-run"`
+	Signature    string `long:"signature"`
+	Order        *int   `long:"order"`
+	InsertBefore string `long:"insert-before"`
+	Positional   struct {
+		Label     layerLabel `positional-arg-name:"<label>" required:"1"`
+		LayerPath string     `positional-arg-name:"<layer-path>" required:"1"`
 	} `positional-args:"yes"`
 }
 
@@ -47,7 +66,11 @@ func init() {
 		Summary:     cmdAddSummary,
 		Description: cmdAddDescription,
 		ArgsHelp: map[string]string{
-			"--combine": "Combine the new layer with an existing layer that has the given label (default is to append)",
+			"--combine":       "Combine the new layer with an existing layer that has the given label (default is to append)",
+			"--dry-run":       "Validate the layer against the plan without adding it",
+			"--signature":     "Path of the layer's base64-encoded signature",
+			"--order":         "Order to give the new layer (default is after the other layers)",
+			"--insert-before": "Label of the layer to insert the new layer before",
 		},
 		New: func(opts *CmdOptions) flags.Commander {
 			return &cmdAdd{client: opts.Client}
@@ -64,9 +87,30 @@ func (cmd *cmdAdd) Execute(args []string) error {
 		return err
 	}
 	opts := client.AddLayerOptions{
-		Combine:   cmd.Combine,
-		Label:     cmd.Positional.Label,
-		LayerData: data,
+		Combine:      cmd.Combine,
+		Label:        string(cmd.Positional.Label),
+		LayerData:    data,
+		Order:        cmd.Order,
+		InsertBefore: cmd.InsertBefore,
+	}
+	if cmd.Signature != "" {
+		encoded, err := os.ReadFile(cmd.Signature)
+		if err != nil {
+			return err
+		}
+		opts.Signature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+		if err != nil {
+			return fmt.Errorf("cannot decode signature: %w", err)
+		}
+	}
+	if cmd.DryRun {
+		err = cmd.client.ValidateLayer(&opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "Layer %q from %q is valid\n",
+			cmd.Positional.Label, cmd.Positional.LayerPath)
+		return nil
 	}
 	err = cmd.client.AddLayer(&opts)
 	if err != nil {
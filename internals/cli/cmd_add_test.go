@@ -15,6 +15,7 @@
 package cli_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -109,3 +110,126 @@ services:
 		c.Assert(err, check.Equals, cli.ErrExtraArgs)
 	}
 }
+
+func (s *PebbleSuite) TestAddDryRun(c *check.C) {
+	layerYAML := `
+services:
+   foo:
+    override: replace
+    command: cmd
+`[1:]
+
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/layers")
+		body := DecodedRequestBody(c, r)
+		c.Check(body, check.DeepEquals, map[string]interface{}{
+			"action":  "validate",
+			"combine": true,
+			"label":   "foo",
+			"format":  "yaml",
+			"layer":   layerYAML,
+		})
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": true
+}`)
+	})
+
+	layerPath := filepath.Join(c.MkDir(), "layer.yaml")
+	err := os.WriteFile(layerPath, []byte(layerYAML), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"add", "--dry-run", "--combine", "foo", layerPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf("Layer \"foo\" from %q is valid\n", layerPath))
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestAddPosition(c *check.C) {
+	layerYAML := `
+services:
+   foo:
+    override: replace
+    command: cmd
+`[1:]
+
+	var bodies []map[string]interface{}
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/layers")
+		bodies = append(bodies, DecodedRequestBody(c, r))
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": true
+}`)
+	})
+
+	layerPath := filepath.Join(c.MkDir(), "layer.yaml")
+	err := os.WriteFile(layerPath, []byte(layerYAML), 0644)
+	c.Assert(err, check.IsNil)
+
+	_, err = cli.ParserForTest().ParseArgs([]string{"add", "--insert-before", "vendor", "foo", layerPath})
+	c.Assert(err, check.IsNil)
+	_, err = cli.ParserForTest().ParseArgs([]string{"add", "--order", "0", "bar", layerPath})
+	c.Assert(err, check.IsNil)
+	c.Check(bodies, check.DeepEquals, []map[string]interface{}{{
+		"action":        "add",
+		"combine":       false,
+		"label":         "foo",
+		"format":        "yaml",
+		"layer":         layerYAML,
+		"insert-before": "vendor",
+	}, {
+		"action":  "add",
+		"combine": false,
+		"label":   "bar",
+		"format":  "yaml",
+		"layer":   layerYAML,
+		"order":   json.Number("0"),
+	}})
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestAddSignature(c *check.C) {
+	layerYAML := "services: {}\n"
+
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		body := DecodedRequestBody(c, r)
+		c.Check(body, check.DeepEquals, map[string]interface{}{
+			"action":    "add",
+			"combine":   false,
+			"label":     "foo",
+			"format":    "yaml",
+			"layer":     layerYAML,
+			"signature": "AQID",
+		})
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": true
+}`)
+	})
+
+	tempDir := c.MkDir()
+	layerPath := filepath.Join(tempDir, "layer.yaml")
+	err := os.WriteFile(layerPath, []byte(layerYAML), 0644)
+	c.Assert(err, check.IsNil)
+	sigPath := filepath.Join(tempDir, "layer.sig")
+	err = os.WriteFile(sigPath, []byte("AQID\n"), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"add", "--signature", sigPath, "foo", layerPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf("Layer \"foo\" added successfully from %q\n", layerPath))
+
+	s.ResetStdStreams()
+	err = os.WriteFile(sigPath, []byte("!"), 0644)
+	c.Assert(err, check.IsNil)
+	_, err = cli.ParserForTest().ParseArgs([]string{"add", "--signature", sigPath, "foo", layerPath})
+	c.Assert(err, check.ErrorMatches, "cannot decode signature: .*")
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"time"
 
 	"github.com/canonical/go-flags"
 
@@ -34,8 +35,9 @@ type cmdChanges struct {
 	client *client.Client
 
 	timeMixin
+	formatMixin
 	Positional struct {
-		Service string `positional-arg-name:"<service>"`
+		Service serviceName `positional-arg-name:"<service>"`
 	} `positional-args:"yes"`
 }
 
@@ -57,7 +59,7 @@ func init() {
 		Name:        "changes",
 		Summary:     cmdChangesSummary,
 		Description: cmdChangesDescription,
-		ArgsHelp:    timeArgsHelp,
+		ArgsHelp:    merge(timeArgsHelp, formatArgsHelp),
 		New: func(opts *CmdOptions) flags.Commander {
 			return &cmdChanges{client: opts.Client}
 		},
@@ -97,7 +99,7 @@ func (c *cmdChanges) Execute(args []string) error {
 		return ErrExtraArgs
 	}
 
-	if allDigits(c.Positional.Service) {
+	if allDigits(string(c.Positional.Service)) {
 		return fmt.Errorf(`'%s changes' command expects a service name, try '%s tasks %s'`, cmd.ProgramName, cmd.ProgramName, c.Positional.Service)
 	}
 
@@ -107,7 +109,7 @@ func (c *cmdChanges) Execute(args []string) error {
 	}
 
 	opts := client.ChangesOptions{
-		ServiceName: c.Positional.Service,
+		ServiceName: string(c.Positional.Service),
 		Selector:    client.ChangesAll,
 	}
 
@@ -116,12 +118,15 @@ func (c *cmdChanges) Execute(args []string) error {
 		return err
 	}
 
+	sort.Sort(changesByTime(changes))
+	if c.structured() {
+		return c.writeStructured(changesOutput(changes))
+	}
+
 	if len(changes) == 0 {
 		return fmt.Errorf("no changes found")
 	}
 
-	sort.Sort(changesByTime(changes))
-
 	w := tabWriter()
 
 	fmt.Fprintf(w, "ID\tStatus\tSpawn\tReady\tSummary\n")
@@ -140,6 +145,38 @@ func (c *cmdChanges) Execute(args []string) error {
 	return nil
 }
 
+// changeOutput is the JSON and YAML output format for a change.
+type changeOutput struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Summary   string     `json:"summary"`
+	Status    string     `json:"status"`
+	Ready     bool       `json:"ready"`
+	Err       string     `json:"err,omitempty"`
+	SpawnTime time.Time  `json:"spawn-time"`
+	ReadyTime *time.Time `json:"ready-time,omitempty"`
+}
+
+func changesOutput(changes []*client.Change) []changeOutput {
+	output := make([]changeOutput, len(changes))
+	for i, chg := range changes {
+		output[i] = changeOutput{
+			ID:        chg.ID,
+			Kind:      chg.Kind,
+			Summary:   chg.Summary,
+			Status:    chg.Status,
+			Ready:     chg.Ready,
+			Err:       chg.Err,
+			SpawnTime: chg.SpawnTime,
+		}
+		if !chg.ReadyTime.IsZero() {
+			readyTime := chg.ReadyTime
+			output[i].ReadyTime = &readyTime
+		}
+	}
+	return output
+}
+
 func (c *cmdTasks) Execute([]string) error {
 	chid, err := c.GetChangeID(c.client)
 	if err != nil {
@@ -98,6 +98,55 @@ two +Do +2016-04-21 +2016-04-21 +...
 	c.Check(s.Stderr(), check.Equals, "")
 }
 
+func (s *PebbleSuite) TestChangesJSON(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v1/changes")
+		fmt.Fprintln(w, `{"type": "sync", "result": [{
+			"id": "2",
+			"kind": "start",
+			"summary": "Start service \"svc\"",
+			"status": "Doing",
+			"spawn-time": "2016-04-21T01:02:03Z"
+		}, {
+			"id": "1",
+			"kind": "stop",
+			"summary": "Stop service \"svc\"",
+			"status": "Error",
+			"ready": true,
+			"err": "cannot stop",
+			"spawn-time": "2016-04-20T01:02:03Z",
+			"ready-time": "2016-04-20T01:02:04Z"
+		}]}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"changes", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+[
+    {
+        "id": "1",
+        "kind": "stop",
+        "summary": "Stop service \"svc\"",
+        "status": "Error",
+        "ready": true,
+        "err": "cannot stop",
+        "spawn-time": "2016-04-20T01:02:03Z",
+        "ready-time": "2016-04-20T01:02:04Z"
+    },
+    {
+        "id": "2",
+        "kind": "start",
+        "summary": "Start service \"svc\"",
+        "status": "Doing",
+        "ready": false,
+        "spawn-time": "2016-04-21T01:02:03Z"
+    }
+]
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
 func (s *PebbleSuite) TestChangesUnknownMaintenance(c *check.C) {
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
 		c.Check(r.Method, check.Equals, "GET")
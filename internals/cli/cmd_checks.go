@@ -33,9 +33,10 @@ arguments.
 type cmdChecks struct {
 	client *client.Client
 
+	formatMixin
 	Level      string `long:"level" choice:"alive" choice:"ready"`
 	Positional struct {
-		Checks []string `positional-arg-name:"<check>"`
+		Checks []checkName `positional-arg-name:"<check>"`
 	} `positional-args:"yes"`
 }
 
@@ -44,9 +45,9 @@ func init() {
 		Name:        "checks",
 		Summary:     cmdChecksSummary,
 		Description: cmdChecksDescription,
-		ArgsHelp: map[string]string{
+		ArgsHelp: merge(formatArgsHelp, map[string]string{
 			"--level": "Check level to filter for",
-		},
+		}),
 		New: func(opts *CmdOptions) flags.Commander {
 			return &cmdChecks{client: opts.Client}
 		},
@@ -60,12 +61,15 @@ func (cmd *cmdChecks) Execute(args []string) error {
 
 	opts := client.ChecksOptions{
 		Level: client.CheckLevel(cmd.Level),
-		Names: cmd.Positional.Checks,
+		Names: stringSlice(cmd.Positional.Checks),
 	}
 	checks, err := cmd.client.Checks(&opts)
 	if err != nil {
 		return err
 	}
+	if cmd.structured() {
+		return cmd.writeStructured(checksOutput(checks))
+	}
 	if len(checks) == 0 {
 		if len(cmd.Positional.Checks) == 0 && cmd.Level == "" {
 			fmt.Fprintln(Stderr, "Plan has no health checks.")
@@ -92,6 +96,35 @@ func (cmd *cmdChecks) Execute(args []string) error {
 	return nil
 }
 
+// checkOutput is the JSON and YAML output format for a health check.
+type checkOutput struct {
+	Name        string `json:"name"`
+	Level       string `json:"level,omitempty"`
+	Status      string `json:"status"`
+	Failures    int    `json:"failures"`
+	Threshold   int    `json:"threshold"`
+	ChangeID    string `json:"change-id,omitempty"`
+	Skipped     int    `json:"skipped,omitempty"`
+	Overlapping int    `json:"overlapping,omitempty"`
+}
+
+func checksOutput(checks []*client.CheckInfo) []checkOutput {
+	output := make([]checkOutput, len(checks))
+	for i, check := range checks {
+		output[i] = checkOutput{
+			Name:        check.Name,
+			Level:       string(check.Level),
+			Status:      string(check.Status),
+			Failures:    check.Failures,
+			Threshold:   check.Threshold,
+			ChangeID:    check.ChangeID,
+			Skipped:     check.Skipped,
+			Overlapping: check.Overlapping,
+		}
+	}
+	return output
+}
+
 func (cmd *cmdChecks) changeInfo(check *client.CheckInfo) string {
 	if check.ChangeID == "" {
 		return "-"
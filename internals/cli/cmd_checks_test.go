@@ -99,6 +99,39 @@ chk5   -      down    3/2       5 (error with some\nline breaks\nin it\n)
 	c.Check(s.Stderr(), check.Equals, "")
 }
 
+func (s *PebbleSuite) TestChecksYAML(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, check.Equals, "/v1/checks")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"name": "chk1", "status": "up", "threshold": 3, "change-id": "1"},
+		{"name": "chk2", "level": "alive", "status": "down", "failures": 5, "threshold": 3, "change-id": "2", "skipped": 1, "overlapping": 4}
+	]
+}`)
+	})
+	rest, err := cli.ParserForTest().ParseArgs([]string{"checks", "--format", "yaml"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+- change-id: "1"
+  failures: 0
+  name: chk1
+  status: up
+  threshold: 3
+- change-id: "2"
+  failures: 5
+  level: alive
+  name: chk2
+  overlapping: 4
+  skipped: 1
+  status: down
+  threshold: 3
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
 func (s *PebbleSuite) TestPlanNoChecks(c *check.C) {
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
 		c.Assert(r.Method, check.Equals, "GET")
@@ -0,0 +1,115 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/cmd"
+)
+
+const cmdCompletionSummary = "Generate a shell completion script"
+const cmdCompletionDescription = `
+The completion command prints a script that enables tab completion of
+{{.ProgramName}} commands and options in the given shell (bash, zsh, or fish).
+Service names, check names, change IDs, and layer labels are completed by
+querying the running {{.DisplayName}} daemon.
+
+To enable completion for the current bash session, for example:
+
+    source <({{.ProgramName}} completion bash)
+`
+
+type cmdCompletion struct {
+	Positional struct {
+		Shell string `positional-arg-name:"<shell>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "completion",
+		Summary:     cmdCompletionSummary,
+		Description: cmdCompletionDescription,
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdCompletion{}
+		},
+	})
+}
+
+func (c *cmdCompletion) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	script, ok := completionScripts[c.Positional.Shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q (must be bash, zsh, or fish)", c.Positional.Shell)
+	}
+	r := strings.NewReplacer(
+		"{{.ProgramName}}", cmd.ProgramName,
+		"{{.FuncName}}", completionFuncName(cmd.ProgramName),
+	)
+	fmt.Fprint(Stdout, r.Replace(script))
+	return nil
+}
+
+// completionFuncName returns a shell function name for the program, with
+// any characters that aren't valid in function names replaced.
+func completionFuncName(program string) string {
+	return "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, program)
+}
+
+// The scripts re-run the program with GO_FLAGS_COMPLETION set, which makes
+// the parser print the completions for the arguments instead of running a
+// command.
+var completionScripts = map[string]string{
+	"bash": `{{.FuncName}}() {
+    local IFS=$'\n'
+    COMPREPLY=($(GO_FLAGS_COMPLETION=1 "${COMP_WORDS[0]}" "${COMP_WORDS[@]:1:$COMP_CWORD}" 2>/dev/null))
+    return 0
+}
+
+complete -o default -F {{.FuncName}} {{.ProgramName}}
+`,
+
+	"zsh": `#compdef {{.ProgramName}}
+
+{{.FuncName}}() {
+    local -a completions
+    completions=("${(@f)$(GO_FLAGS_COMPLETION=1 ${words[1]} "${(@)words[2,$CURRENT]}" 2>/dev/null)}")
+    compadd -a completions
+}
+
+compdef {{.FuncName}} {{.ProgramName}}
+`,
+
+	"fish": `function {{.FuncName}}_complete
+    set -l args (commandline -opc)
+    set -e args[1]
+    env GO_FLAGS_COMPLETION=1 {{.ProgramName}} $args (commandline -ct) 2>/dev/null
+end
+
+complete -c {{.ProgramName}} -f -a '({{.FuncName}}_complete)'
+`,
+}
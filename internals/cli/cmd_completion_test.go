@@ -0,0 +1,146 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/canonical/go-flags"
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+)
+
+func (s *PebbleSuite) TestCompletionBash(c *C) {
+	rest, err := cli.ParserForTest().ParseArgs([]string{"completion", "bash"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Matches, `(?s)_pebble\(\) \{\n.*GO_FLAGS_COMPLETION=1 .*\ncomplete -o default -F _pebble pebble\n`)
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestCompletionZsh(c *C) {
+	_, err := cli.ParserForTest().ParseArgs([]string{"completion", "zsh"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Matches, `(?s)#compdef pebble\n.*compdef _pebble pebble\n`)
+}
+
+func (s *PebbleSuite) TestCompletionFish(c *C) {
+	_, err := cli.ParserForTest().ParseArgs([]string{"completion", "fish"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Matches, `(?s)function _pebble_complete\n.*complete -c pebble -f -a '\(_pebble_complete\)'\n`)
+}
+
+func (s *PebbleSuite) TestCompletionUnsupportedShell(c *C) {
+	_, err := cli.ParserForTest().ParseArgs([]string{"completion", "tcsh"})
+	c.Assert(err, ErrorMatches, `unsupported shell "tcsh" \(must be bash, zsh, or fish\)`)
+	c.Check(s.Stdout(), Equals, "")
+}
+
+// complete returns the completions the parser produces for args.
+func (s *PebbleSuite) complete(c *C, args ...string) []string {
+	os.Setenv("GO_FLAGS_COMPLETION", "1")
+	defer os.Unsetenv("GO_FLAGS_COMPLETION")
+
+	var items []string
+	parser := cli.ParserForTest()
+	parser.CompletionHandler = func(completions []flags.Completion) {
+		for _, completion := range completions {
+			items = append(items, completion.Item)
+		}
+	}
+	_, err := parser.ParseArgs(args)
+	c.Assert(err, IsNil)
+	return items
+}
+
+func (s *PebbleSuite) TestCompleteServiceNames(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v1/services")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+        {"name": "svc1", "current": "active"},
+        {"name": "svc2", "current": "inactive"},
+        {"name": "other", "current": "active"}
+    ]
+}`)
+	})
+
+	c.Check(s.complete(c, "start", "sv"), DeepEquals, []string{"svc1", "svc2"})
+	c.Check(s.complete(c, "logs", "svc1", "o"), DeepEquals, []string{"other"})
+}
+
+func (s *PebbleSuite) TestCompleteCheckNames(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v1/checks")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+        {"name": "chk1", "status": "up"},
+        {"name": "disk", "status": "down"}
+    ]
+}`)
+	})
+
+	c.Check(s.complete(c, "checks", "d"), DeepEquals, []string{"disk"})
+}
+
+func (s *PebbleSuite) TestCompleteChangeIDs(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v1/changes")
+		c.Check(r.URL.Query().Get("select"), Equals, "all")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+        {"id": "1", "summary": "Start service"},
+        {"id": "12", "summary": "Stop service"},
+        {"id": "2", "summary": "Replan"}
+    ]
+}`)
+	})
+
+	c.Check(s.complete(c, "tasks", "1"), DeepEquals, []string{"1", "12"})
+}
+
+func (s *PebbleSuite) TestCompleteLayerLabels(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v1/layers")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+        {"order": 1, "label": "base"},
+        {"order": 2, "label": "extra"}
+    ]
+}`)
+	})
+
+	c.Check(s.complete(c, "add", "b"), DeepEquals, []string{"base"})
+}
+
+func (s *PebbleSuite) TestCompleteDaemonError(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		fmt.Fprint(w, `{"type": "error", "result": {"message": "oops"}}`)
+	})
+
+	c.Check(s.complete(c, "stop", ""), HasLen, 0)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+const cmdDebugLogLevelSummary = "Show or change the daemon's log level"
+const cmdDebugLogLevelDescription = `
+The log-level command shows the minimum level of messages in the daemon's
+log. If a level is given ("debug", "notice", "warning" or "error"), the
+log level is changed to that instead, until the daemon is restarted.
+
+For example, to enable debug logging on a running system:
+
+    pebble debug log-level debug
+`
+
+type cmdDebugLogLevel struct {
+	client *client.Client
+
+	Positional struct {
+		Level string `positional-arg-name:"<level>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "log-level",
+		Summary:     cmdDebugLogLevelSummary,
+		Description: cmdDebugLogLevelDescription,
+		Debug:       true,
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdDebugLogLevel{client: opts.Client}
+		},
+	})
+}
+
+func (cmd *cmdDebugLogLevel) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	if cmd.Positional.Level != "" {
+		err := cmd.client.SetLogLevel(cmd.Positional.Level)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "Log level set to %q.\n", cmd.Positional.Level)
+		return nil
+	}
+
+	level, err := cmd.client.LogLevel()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(Stdout, level)
+	return nil
+}
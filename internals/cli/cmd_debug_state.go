@@ -0,0 +1,371 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+const cmdDebugStateSummary = "Inspect a state file"
+const cmdDebugStateDescription = `
+The state command reads the daemon's state file and displays its changes,
+tasks, notices, and the keys of data stored by the managers. It doesn't
+need the daemon to be running, so it can also inspect a state file copied
+from another system.
+
+For each change that isn't ready, it also explains what its unfinished tasks
+are waiting for, such as other tasks, a scheduled time, or a cycle of tasks
+waiting for each other.
+`
+
+type cmdDebugState struct {
+	pebbleDir string
+
+	File string `long:"file"`
+	timeMixin
+	formatMixin
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "state",
+		Summary:     cmdDebugStateSummary,
+		Description: cmdDebugStateDescription,
+		ArgsHelp: merge(timeArgsHelp, formatArgsHelp, map[string]string{
+			"--file": "Path of the state file to read (defaults to $PEBBLE/.pebble.state)",
+		}),
+		Debug: true,
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdDebugState{pebbleDir: opts.PebbleDir}
+		},
+	})
+}
+
+// debugStateOutput is the JSON and YAML output format of the state.
+type debugStateOutput struct {
+	Changes  []debugStateChange `json:"changes"`
+	Notices  []debugStateNotice `json:"notices"`
+	DataKeys []string           `json:"data-keys"`
+}
+
+type debugStateChange struct {
+	ID        string           `json:"id"`
+	Kind      string           `json:"kind"`
+	Summary   string           `json:"summary"`
+	Status    string           `json:"status"`
+	Err       string           `json:"err,omitempty"`
+	SpawnTime time.Time        `json:"spawn-time"`
+	ReadyTime *time.Time       `json:"ready-time,omitempty"`
+	Tasks     []debugStateTask `json:"tasks"`
+
+	// Blocked explains what the unfinished tasks of a change that isn't
+	// ready are waiting for.
+	Blocked []debugStateBlocked `json:"blocked,omitempty"`
+}
+
+type debugStateTask struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Summary   string     `json:"summary"`
+	Status    string     `json:"status"`
+	Lanes     []int      `json:"lanes,omitempty"`
+	WaitTasks []string   `json:"wait-tasks,omitempty"`
+	AtTime    *time.Time `json:"at-time,omitempty"`
+	Log       []string   `json:"log,omitempty"`
+}
+
+type debugStateBlocked struct {
+	TaskID string `json:"task-id"`
+	Reason string `json:"reason"`
+}
+
+type debugStateNotice struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	Key          string    `json:"key"`
+	LastRepeated time.Time `json:"last-repeated"`
+}
+
+func (cmd *cmdDebugState) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	path := cmd.File
+	if path == "" {
+		path = filepath.Join(cmd.pebbleDir, ".pebble.state")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := state.ReadState(nil, f)
+	if err != nil {
+		return err
+	}
+
+	st.Lock()
+	output := debugStateInfo(st, time.Now())
+	st.Unlock()
+
+	if cmd.structured() {
+		return cmd.writeStructured(output)
+	}
+	return cmd.writeText(output)
+}
+
+// debugStateInfo gathers the changes, notices, and data keys of the state,
+// sorted by ID. It must be called with the state locked.
+func debugStateInfo(st *state.State, now time.Time) *debugStateOutput {
+	output := &debugStateOutput{
+		Changes:  []debugStateChange{},
+		Notices:  []debugStateNotice{},
+		DataKeys: st.DataKeys(),
+	}
+
+	changes := st.Changes()
+	sort.Slice(changes, func(i, j int) bool {
+		return idLess(changes[i].ID(), changes[j].ID())
+	})
+	for _, chg := range changes {
+		change := debugStateChange{
+			ID:        chg.ID(),
+			Kind:      chg.Kind(),
+			Summary:   chg.Summary(),
+			Status:    chg.Status().String(),
+			SpawnTime: chg.SpawnTime(),
+			Tasks:     []debugStateTask{},
+		}
+		if err := chg.Err(); err != nil {
+			change.Err = err.Error()
+		}
+		if readyTime := chg.ReadyTime(); !readyTime.IsZero() {
+			change.ReadyTime = &readyTime
+		}
+		tasks := chg.Tasks()
+		sort.Slice(tasks, func(i, j int) bool {
+			return idLess(tasks[i].ID(), tasks[j].ID())
+		})
+		for _, t := range tasks {
+			task := debugStateTask{
+				ID:      t.ID(),
+				Kind:    t.Kind(),
+				Summary: t.Summary(),
+				Status:  t.Status().String(),
+				Log:     t.Log(),
+			}
+			if lanes := t.Lanes(); len(lanes) != 1 || lanes[0] != 0 {
+				task.Lanes = lanes
+			}
+			for _, wt := range t.WaitTasks() {
+				if wt != nil {
+					task.WaitTasks = append(task.WaitTasks, wt.ID())
+				}
+			}
+			if atTime := t.AtTime(); !atTime.IsZero() {
+				task.AtTime = &atTime
+			}
+			change.Tasks = append(change.Tasks, task)
+
+			if !chg.IsReady() {
+				if reason := taskBlockedReason(t, now); reason != "" {
+					change.Blocked = append(change.Blocked, debugStateBlocked{
+						TaskID: t.ID(),
+						Reason: reason,
+					})
+				}
+			}
+		}
+		output.Changes = append(output.Changes, change)
+	}
+
+	for _, notice := range st.Notices(nil) {
+		output.Notices = append(output.Notices, debugStateNotice{
+			ID:           notice.ID(),
+			Type:         string(notice.Type()),
+			Key:          notice.Key(),
+			LastRepeated: notice.LastRepeated(),
+		})
+	}
+	return output
+}
+
+// taskBlockedReason explains why an unfinished task hasn't finished, using
+// the same rules as the task runner to decide whether it can run. It returns
+// "" if the task is ready.
+func taskBlockedReason(t *state.Task, now time.Time) string {
+	switch t.Status() {
+	case state.DoingStatus, state.UndoingStatus:
+		return "is in progress (it's started again if the daemon restarts)"
+	case state.WaitStatus:
+		return "is waiting for an external event, such as a restart"
+	case state.DoStatus:
+		if cycle := findWaitCycle(t); cycle != nil {
+			return "is in a cycle of tasks waiting for each other: " + strings.Join(cycle, " -> ")
+		}
+		var waiting []string
+		for _, wt := range t.WaitTasks() {
+			if wt == nil {
+				waiting = append(waiting, "a missing task")
+			} else if wt.Status() != state.DoneStatus {
+				waiting = append(waiting, describeWaitTask(t, wt))
+			}
+		}
+		if len(waiting) > 0 {
+			return "waits for " + strings.Join(waiting, ", ")
+		}
+	case state.UndoStatus:
+		var waiting []string
+		for _, ht := range t.HaltTasks() {
+			if ht == nil {
+				waiting = append(waiting, "a missing task")
+			} else if !ht.Status().Ready() {
+				waiting = append(waiting, describeWaitTask(t, ht))
+			}
+		}
+		if len(waiting) > 0 {
+			return "waits to be undone until these finish: " + strings.Join(waiting, ", ")
+		}
+	default:
+		return ""
+	}
+	if atTime := t.AtTime(); !atTime.IsZero() && now.Before(atTime) {
+		return "is scheduled to run at " + atTime.Format(time.RFC3339)
+	}
+	return "is ready to run, but may be held back by a conflicting change or the running task limit"
+}
+
+func describeWaitTask(t, wt *state.Task) string {
+	desc := fmt.Sprintf("task %s (%s)", wt.ID(), wt.Status())
+	if wtChg := wt.Change(); wtChg != nil && wtChg != t.Change() {
+		desc += fmt.Sprintf(" of change %s", wtChg.ID())
+	}
+	return desc
+}
+
+// findWaitCycle returns the IDs of a cycle of unfinished tasks that wait for
+// each other, starting and ending with t, or nil if t isn't in a cycle.
+func findWaitCycle(t *state.Task) []string {
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(task *state.Task) bool
+	visit = func(task *state.Task) bool {
+		path = append(path, task.ID())
+		for _, wt := range task.WaitTasks() {
+			if wt == nil || wt.Status() == state.DoneStatus {
+				continue
+			}
+			if wt == t {
+				path = append(path, t.ID())
+				return true
+			}
+			if visited[wt.ID()] {
+				continue
+			}
+			visited[wt.ID()] = true
+			if visit(wt) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if visit(t) {
+		return path
+	}
+	return nil
+}
+
+// idLess orders IDs numerically where possible.
+func idLess(a, b string) bool {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return na < nb
+	}
+	return a < b
+}
+
+func (cmd *cmdDebugState) writeText(output *debugStateOutput) error {
+	w := tabWriter()
+
+	fmt.Fprintln(w, "Changes:")
+	fmt.Fprintln(w, "ID\tStatus\tSpawn\tReady\tKind\tSummary")
+	for _, chg := range output.Changes {
+		readyTime := "-"
+		if chg.ReadyTime != nil {
+			readyTime = cmd.fmtTime(*chg.ReadyTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", chg.ID, chg.Status, cmd.fmtTime(chg.SpawnTime), readyTime, chg.Kind, chg.Summary)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Tasks:")
+	fmt.Fprintln(w, "ID\tChange\tStatus\tLanes\tWaits-For\tKind\tSummary")
+	for _, chg := range output.Changes {
+		for _, t := range chg.Tasks {
+			lanes := "-"
+			if len(t.Lanes) > 0 {
+				laneStrs := make([]string, len(t.Lanes))
+				for i, lane := range t.Lanes {
+					laneStrs[i] = strconv.Itoa(lane)
+				}
+				lanes = strings.Join(laneStrs, ",")
+			}
+			waitTasks := "-"
+			if len(t.WaitTasks) > 0 {
+				waitTasks = strings.Join(t.WaitTasks, ",")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, chg.ID, t.Status, lanes, waitTasks, t.Kind, t.Summary)
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Notices:")
+	fmt.Fprintln(w, "ID\tType\tKey\tLast")
+	for _, notice := range output.Notices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", notice.ID, notice.Type, notice.Key, cmd.fmtTime(notice.LastRepeated))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Data keys:")
+	for _, key := range output.DataKeys {
+		fmt.Fprintln(w, key)
+	}
+	w.Flush()
+
+	for _, chg := range output.Changes {
+		if len(chg.Blocked) == 0 {
+			continue
+		}
+		fmt.Fprintln(Stdout)
+		fmt.Fprintf(Stdout, "Change %s (%q) is not ready:\n", chg.ID, chg.Summary)
+		for _, blocked := range chg.Blocked {
+			fmt.Fprintf(Stdout, "- task %s %s\n", blocked.TaskID, blocked.Reason)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+// writeDebugState writes a state file with a finished change, a change
+// with a task waiting for a running task, and a change with a wait cycle.
+func writeDebugState(c *C, path string) {
+	restore := state.FakeTime(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	defer restore()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg1 := st.NewChange("start", "Start service")
+	t1 := st.NewTask("start", "Start svc1")
+	chg1.AddTask(t1)
+	t1.SetStatus(state.DoneStatus)
+
+	chg2 := st.NewChange("replan", "Replan")
+	t2 := st.NewTask("stop", "Stop svc1")
+	t2.SetStatus(state.DoingStatus)
+	t3 := st.NewTask("start", "Start svc1")
+	t3.WaitFor(t2)
+	t3.JoinLane(st.NewLane())
+	t4 := st.NewTask("start", "Start svc2")
+	t4.At(time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC))
+	chg2.AddTask(t2)
+	chg2.AddTask(t3)
+	chg2.AddTask(t4)
+
+	chg3 := st.NewChange("cycle", "Cycle")
+	t5 := st.NewTask("foo", "Foo")
+	t6 := st.NewTask("bar", "Bar")
+	t5.WaitFor(t6)
+	t6.WaitFor(t5)
+	chg3.AddTask(t5)
+	chg3.AddTask(t6)
+
+	_, err := st.AddNotice(nil, state.CustomNotice, "example.com/x", nil)
+	c.Assert(err, IsNil)
+	st.Set("firmwares", []string{"a"})
+
+	data, err := json.Marshal(st)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(path, data, 0600)
+	c.Assert(err, IsNil)
+}
+
+func (s *PebbleSuite) TestDebugState(c *C) {
+	writeDebugState(c, filepath.Join(s.pebbleDir, ".pebble.state"))
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"debug", "state", "--abs-time"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Matches, `
+Changes:
+ID +Status +Spawn +Ready +Kind +Summary
+1 +Done +2024-05-01T12:00:00Z +2024-05-01T12:00:00Z +start +Start service
+2 +Doing +2024-05-01T12:00:00Z +- +replan +Replan
+3 +Do +2024-05-01T12:00:00Z +- +cycle +Cycle
+
+Tasks:
+ID +Change +Status +Lanes +Waits-For +Kind +Summary
+1 +1 +Done +- +- +start +Start svc1
+2 +2 +Doing +- +- +stop +Stop svc1
+3 +2 +Do +1 +2 +start +Start svc1
+4 +2 +Do +- +- +start +Start svc2
+5 +3 +Do +- +6 +foo +Foo
+6 +3 +Do +- +5 +bar +Bar
+
+Notices:
+ID +Type +Key +Last
+1 +change-update +1 +\S+
+2 +change-update +2 +\S+
+3 +change-update +3 +\S+
+4 +custom +example.com/x +\S+
+
+Data keys:
+firmwares
+
+Change 2 \("Replan"\) is not ready:
+- task 2 is in progress \(it's started again if the daemon restarts\)
+- task 3 waits for task 2 \(Doing\)
+- task 4 is scheduled to run at 2999-01-01T00:00:00Z
+
+Change 3 \("Cycle"\) is not ready:
+- task 5 is in a cycle of tasks waiting for each other: 5 -> 6 -> 5
+- task 6 is in a cycle of tasks waiting for each other: 6 -> 5 -> 6
+`[1:])
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestDebugStateJSON(c *C) {
+	path := filepath.Join(c.MkDir(), "state.json")
+	writeDebugState(c, path)
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"debug", "state", "--file", path, "--format", "json"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	var output map[string]interface{}
+	err = json.Unmarshal([]byte(s.Stdout()), &output)
+	c.Assert(err, IsNil)
+	c.Check(output["data-keys"], DeepEquals, []interface{}{"firmwares"})
+	c.Check(output["notices"], HasLen, 4)
+	changes := output["changes"].([]interface{})
+	c.Assert(changes, HasLen, 3)
+	c.Check(changes[0], DeepEquals, map[string]interface{}{
+		"id":         "1",
+		"kind":       "start",
+		"summary":    "Start service",
+		"status":     "Done",
+		"spawn-time": "2024-05-01T12:00:00Z",
+		"ready-time": "2024-05-01T12:00:00Z",
+		"tasks": []interface{}{map[string]interface{}{
+			"id":      "1",
+			"kind":    "start",
+			"summary": "Start svc1",
+			"status":  "Done",
+		}},
+	})
+	c.Check(changes[1].(map[string]interface{})["blocked"], DeepEquals, []interface{}{
+		map[string]interface{}{"task-id": "2", "reason": "is in progress (it's started again if the daemon restarts)"},
+		map[string]interface{}{"task-id": "3", "reason": "waits for task 2 (Doing)"},
+		map[string]interface{}{"task-id": "4", "reason": "is scheduled to run at 2999-01-01T00:00:00Z"},
+	})
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestDebugStateNoFile(c *C) {
+	_, err := cli.ParserForTest().ParseArgs([]string{"debug", "state"})
+	c.Assert(err, ErrorMatches, `open .*/\.pebble\.state: no such file or directory`)
+}
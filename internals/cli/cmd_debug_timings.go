@@ -0,0 +1,99 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+const cmdDebugTimingsSummary = "Show timings recorded by the daemon"
+const cmdDebugTimingsDescription = `
+The timings command displays how long each phase of the daemon's startup
+took, such as reading the state, loading the plan, starting the managers,
+and starting the default services, oldest first.
+
+Phases that took less than a few milliseconds are not broken down further.
+`
+
+type cmdDebugTimings struct {
+	client *client.Client
+
+	timeMixin
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "timings",
+		Summary:     cmdDebugTimingsSummary,
+		Description: cmdDebugTimingsDescription,
+		ArgsHelp:    timeArgsHelp,
+		Debug:       true,
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdDebugTimings{client: opts.Client}
+		},
+	})
+}
+
+func (cmd *cmdDebugTimings) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	timings, err := cmd.client.Timings()
+	if err != nil {
+		return err
+	}
+	if len(timings) == 0 {
+		fmt.Fprintln(Stderr, "No timings recorded.")
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, "Tags\tStart\tDuration\tSummary")
+	for _, t := range timings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t-\n", formatTimingTags(t.Tags), cmd.fmtTime(t.StartTime), formatTimingDuration(t.Duration))
+		for _, s := range t.Spans {
+			indent := strings.Repeat(" ", s.Depth)
+			fmt.Fprintf(w, "%s^ %s\t+%s\t%s\t%s\n", indent, s.Label, formatTimingDuration(s.Start), formatTimingDuration(s.Duration), s.Summary)
+		}
+	}
+	return nil
+}
+
+// formatTimingTags formats tags as "key=value" pairs, sorted by key.
+func formatTimingTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func formatTimingDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+)
+
+func (s *PebbleSuite) TestDebugTimings(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v1/debug/timings")
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": [{
+			"tags": {"startup": "load-state"},
+			"base": 1714564800,
+			"a": 500000000,
+			"b": 520000000
+		}, {
+			"tags": {"startup": "managers"},
+			"base": 1714564801,
+			"a": 100000000,
+			"b": 400000000,
+			"spans": [{
+				"label": "ServiceManager",
+				"summary": "start up ServiceManager",
+				"depth": 1,
+				"a": 150000000,
+				"b": 350000000
+			}]
+		}]}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"debug", "timings", "--abs-time"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	// The start times are shown in the local time zone.
+	c.Check(s.Stdout(), Matches, `
+Tags +Start +Duration +Summary
+startup=load-state +2024-05-01T\d\d:00:00\S+ +20ms +-
+startup=managers +2024-05-01T\d\d:00:01\S+ +300ms +-
+ \^ ServiceManager +\+50ms +200ms +start up ServiceManager
+`[1:])
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestDebugTimingsNone(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"debug", "timings"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, "")
+	c.Check(s.Stderr(), Equals, "No timings recorded.\n")
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/client"
+	"github.com/canonical/pebble/cmd"
+)
+
+const cmdDoctorSummary = "Gather diagnostics into a tarball"
+const cmdDoctorDescription = `
+The doctor command gathers diagnostic information from the {{.DisplayName}}
+daemon into a single gzipped tarball, for attaching to support requests.
+
+The tarball includes the client and daemon versions, the plan, the status of
+services, checks, and recent changes, the last logs of each service,
+statistics about the daemon's state, and the health of its managers. The information is fetched using the
+API, so it can also be gathered from a remote daemon.
+
+Sections that can't be fetched are listed in errors.txt in the tarball.
+`
+
+type cmdDoctor struct {
+	client *client.Client
+
+	Output string `long:"output"`
+	N      int    `short:"n" default:"100"`
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "doctor",
+		Summary:     cmdDoctorSummary,
+		Description: cmdDoctorDescription,
+		ArgsHelp: map[string]string{
+			"--output": "Path of the tarball to write (defaults to {{.ProgramName}}-doctor-<time>.tar.gz in the current directory)",
+			"-n":       "Number of logs to include for each service (0 to omit logs)",
+		},
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdDoctor{client: opts.Client}
+		},
+	})
+}
+
+func (c *cmdDoctor) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if c.N < 0 {
+		return fmt.Errorf("expected n to be a non-negative integer, not %d", c.N)
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-doctor-%s", cmd.ProgramName, now.UTC().Format("20060102-150405"))
+	output := c.Output
+	if output == "" {
+		output = name + ".tar.gz"
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	b := &doctorBundle{
+		dir:  name,
+		time: now,
+		gzip: gzip.NewWriter(f),
+		dirs: make(map[string]bool),
+	}
+	b.tar = tar.NewWriter(b.gzip)
+
+	err = c.gather(b)
+	if err == nil {
+		err = b.close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+
+	fmt.Fprintf(Stdout, "Diagnostics written to %s\n", output)
+	return nil
+}
+
+// gather fetches each section from the daemon and adds it to the bundle. A
+// failure to fetch a section is recorded in errors.txt rather than aborting
+// the command, as a partial bundle is still useful.
+func (c *cmdDoctor) gather(b *doctorBundle) error {
+	var errs bytes.Buffer
+	addError := func(section string, err error) {
+		fmt.Fprintf(&errs, "%s: %v\n", section, err)
+	}
+
+	sysInfo, err := c.client.SysInfo()
+	if err != nil {
+		addError("system-info", err)
+	}
+	versions := map[string]string{"client": cmd.Version}
+	if sysInfo != nil {
+		versions["server"] = sysInfo.Version
+	}
+	if err := b.addJSON("version.json", versions); err != nil {
+		return err
+	}
+	if sysInfo != nil {
+		if err := b.addJSON("system-info.json", sysInfo); err != nil {
+			return err
+		}
+	}
+
+	status, err := c.client.SystemStatus()
+	if err != nil {
+		addError("system-status", err)
+	} else if err := b.addJSON("system-status.json", status); err != nil {
+		return err
+	}
+
+	stateInfo, err := c.client.StateInfo()
+	if err != nil {
+		addError("state-info", err)
+	} else if err := b.addJSON("state-info.json", stateInfo); err != nil {
+		return err
+	}
+
+	managers, err := c.client.Managers()
+	if err != nil {
+		addError("managers", err)
+	} else if err := b.addJSON("managers.json", managers); err != nil {
+		return err
+	}
+
+	plan, err := c.client.PlanBytes(&client.PlanOptions{})
+	if err != nil {
+		addError("plan", err)
+	} else if err := b.add("plan.yaml", plan); err != nil {
+		return err
+	}
+
+	services, err := c.client.Services(&client.ServicesOptions{})
+	if err != nil {
+		addError("services", err)
+	} else if err := b.addJSON("services.json", services); err != nil {
+		return err
+	}
+
+	checks, err := c.client.Checks(&client.ChecksOptions{})
+	if err != nil {
+		addError("checks", err)
+	} else if err := b.addJSON("checks.json", checks); err != nil {
+		return err
+	}
+
+	changes, err := c.client.Changes(&client.ChangesOptions{Selector: client.ChangesAll})
+	if err != nil {
+		addError("changes", err)
+	} else if err := b.addJSON("changes.json", changes); err != nil {
+		return err
+	}
+
+	if c.N == 0 {
+		services = nil // no logs requested
+	}
+	for _, svc := range services {
+		var logs bytes.Buffer
+		err := c.client.Logs(&client.LogsOptions{
+			WriteLog: func(entry client.LogEntry) error {
+				_, err := fmt.Fprintf(&logs, "%s [%s] %s\n",
+					entry.Time.Format(logTimeFormat), entry.Service, entry.Message)
+				return err
+			},
+			Services: []string{svc.Name},
+			N:        c.N,
+		})
+		if err != nil {
+			addError("logs for "+svc.Name, err)
+			continue
+		}
+		if err := b.add(path.Join("logs", svc.Name+".log"), logs.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if errs.Len() > 0 {
+		return b.add("errors.txt", errs.Bytes())
+	}
+	return nil
+}
+
+// doctorBundle writes files to a gzipped tarball, under a single directory.
+type doctorBundle struct {
+	dir  string
+	time time.Time
+	gzip *gzip.Writer
+	tar  *tar.Writer
+	dirs map[string]bool
+}
+
+func (b *doctorBundle) add(name string, data []byte) error {
+	if dir := path.Dir(name); dir != "." && !b.dirs[dir] {
+		err := b.tar.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     path.Join(b.dir, dir) + "/",
+			Mode:     0700,
+			ModTime:  b.time,
+		})
+		if err != nil {
+			return err
+		}
+		b.dirs[dir] = true
+	}
+	err := b.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join(b.dir, name),
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  b.time,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = b.tar.Write(data)
+	return err
+}
+
+func (b *doctorBundle) addJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return b.add(name, append(data, '\n'))
+}
+
+func (b *doctorBundle) close() error {
+	err := b.tar.Close()
+	if err != nil {
+		return err
+	}
+	return b.gzip.Close()
+}
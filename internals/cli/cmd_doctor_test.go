@@ -0,0 +1,156 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+)
+
+// readTarball returns the contents of the files in a gzipped tarball, keyed
+// by name. Directories have empty contents.
+func readTarball(c *C, path string) map[string]string {
+	f, err := os.Open(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	c.Assert(err, IsNil)
+	tr := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		data, err := io.ReadAll(tr)
+		c.Assert(err, IsNil)
+		files[hdr.Name] = string(data)
+	}
+	return files
+}
+
+func (s *PebbleSuite) serveDoctor(c *C, failChecks bool) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		switch r.URL.Path {
+		case "/v1/system-info":
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"version": "1.2.3"}}`)
+		case "/v1/system-status":
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"state-size": 42, "managers-ready": true}}`)
+		case "/v1/state-info":
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"size": 42, "changes": 1}}`)
+		case "/v1/managers":
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": [{"name": "servstate.ServiceManager", "ready": true}]}`)
+		case "/v1/plan":
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": "services:\n    svc1:\n        command: foo\n"}`)
+		case "/v1/services":
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": [{"name": "svc1", "startup": "enabled", "current": "active"}]}`)
+		case "/v1/checks":
+			if failChecks {
+				w.WriteHeader(500)
+				fmt.Fprint(w, `{"type": "error", "status-code": 500, "result": {"message": "oops"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": []}`)
+		case "/v1/changes":
+			c.Check(r.URL.Query().Get("select"), Equals, "all")
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": [{"id": "1", "kind": "start", "status": "Done"}]}`)
+		case "/v1/logs":
+			c.Check(r.URL.Query().Get("services"), Equals, "svc1")
+			c.Check(r.URL.Query().Get("n"), Equals, "5")
+			fmt.Fprint(w, `{"time":"2021-05-03T03:55:49.360994155Z","service":"svc1","message":"hello"}`+"\n")
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+}
+
+func (s *PebbleSuite) TestDoctor(c *C) {
+	s.serveDoctor(c, false)
+	restore := fakeVersion("4.56")
+	defer restore()
+
+	output := filepath.Join(c.MkDir(), "bundle.tar.gz")
+	rest, err := cli.ParserForTest().ParseArgs([]string{"doctor", "--output", output, "-n", "5"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, "Diagnostics written to "+output+"\n")
+	c.Check(s.Stderr(), Equals, "")
+
+	files := readTarball(c, output)
+	var dir string
+	for name := range files {
+		if filepath.Base(name) == "version.json" {
+			dir = filepath.Dir(name)
+		}
+	}
+	c.Assert(dir, Matches, `pebble-doctor-\d{8}-\d{6}`)
+
+	c.Check(files, HasLen, 11)
+	c.Check(files[dir+"/version.json"], Equals, "{\n    \"client\": \"4.56\",\n    \"server\": \"1.2.3\"\n}\n")
+	c.Check(files[dir+"/system-status.json"], Matches, `(?s).*"state-size": 42,.*"managers-ready": true.*`)
+	c.Check(files[dir+"/state-info.json"], Matches, `(?s).*"size": 42,.*"changes": 1,.*`)
+	c.Check(files[dir+"/managers.json"], Matches, `(?s).*"name": "servstate.ServiceManager",.*"ready": true,.*`)
+	c.Check(files[dir+"/plan.yaml"], Equals, "services:\n    svc1:\n        command: foo\n")
+	c.Check(files[dir+"/services.json"], Matches, `(?s).*"name": "svc1",.*`)
+	c.Check(files[dir+"/checks.json"], Equals, "[]\n")
+	c.Check(files[dir+"/changes.json"], Matches, `(?s).*"id": "1",.*`)
+	c.Check(files[dir+"/logs/svc1.log"], Equals, "2021-05-03T03:55:49.360Z [svc1] hello\n")
+	c.Check(files[dir+"/system-info.json"], Matches, `(?s).*"version": "1.2.3".*`)
+	_, ok := files[dir+"/logs/"]
+	c.Check(ok, Equals, true)
+}
+
+func (s *PebbleSuite) TestDoctorErrors(c *C) {
+	s.serveDoctor(c, true)
+
+	output := filepath.Join(c.MkDir(), "bundle.tar.gz")
+	_, err := cli.ParserForTest().ParseArgs([]string{"doctor", "--output", output, "-n", "5"})
+	c.Assert(err, IsNil)
+
+	var errorsTxt string
+	var hasChecks bool
+	for name, data := range readTarball(c, output) {
+		switch filepath.Base(name) {
+		case "errors.txt":
+			errorsTxt = data
+		case "checks.json":
+			hasChecks = true
+		}
+	}
+	c.Check(errorsTxt, Equals, "checks: oops\n")
+	c.Check(hasChecks, Equals, false)
+}
+
+func (s *PebbleSuite) TestDoctorOutputExists(c *C) {
+	output := filepath.Join(c.MkDir(), "bundle.tar.gz")
+	c.Assert(os.WriteFile(output, []byte("keep"), 0644), IsNil)
+
+	_, err := cli.ParserForTest().ParseArgs([]string{"doctor", "--output", output})
+	c.Assert(err, ErrorMatches, `.*file exists`)
+	data, err := os.ReadFile(output)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "keep")
+}
@@ -57,6 +57,7 @@ type cmdExec struct {
 	NoTerminal     bool          `short:"T"`
 	Interactive    bool          `short:"i"`
 	NonInteractive bool          `short:"I"`
+	Record         bool          `long:"record"`
 	Positional     struct {
 		Command string `positional-arg-name:"<command>" required:"1"`
 	} `positional-args:"yes"`
@@ -80,6 +81,7 @@ func init() {
 			"-T":        "Disable remote pseudo-terminal allocation",
 			"-i":        "Interactive mode: connect stdin to the pseudo-terminal (default if stdin and stdout are TTYs)",
 			"-I":        "Disable interactive mode and use a pipe for stdin",
+			"--record":  "Record a transcript of the session on the server",
 		},
 		PassAfterNonOption: true,
 		New: func(opts *CmdOptions) flags.Commander {
@@ -170,6 +172,7 @@ func (cmd *cmdExec) Execute(args []string) error {
 		Interactive:    interactive,
 		Width:          width,
 		Height:         height,
+		Record:         cmd.Record,
 		Stdin:          Stdin,
 		Stdout:         Stdout,
 		Stderr:         Stderr,
@@ -35,7 +35,7 @@ type cmdHealth struct {
 
 	Level      string `long:"level" choice:"alive" choice:"ready"`
 	Positional struct {
-		Checks []string `positional-arg-name:"<check>"`
+		Checks []checkName `positional-arg-name:"<check>"`
 	} `positional-args:"yes"`
 }
 
@@ -62,7 +62,7 @@ func (cmd *cmdHealth) Execute(args []string) error {
 
 	opts := client.HealthOptions{
 		Level: client.CheckLevel(cmd.Level),
-		Names: cmd.Positional.Checks,
+		Names: stringSlice(cmd.Positional.Checks),
 	}
 	health, err := cmd.client.Health(&opts)
 	if err != nil {
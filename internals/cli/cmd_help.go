@@ -188,8 +188,8 @@ var HelpCategories = []HelpCategory{{
 	Commands:    []string{"run"},
 }, {
 	Label:       "Info",
-	Description: "help and version information",
-	Commands:    []string{"help", "version"},
+	Description: "help, version, completion, diagnostics, and inventory",
+	Commands:    []string{"help", "version", "completion", "doctor", "inventory"},
 }, {
 	Label:       "Plan",
 	Description: "view and change configuration",
@@ -197,7 +197,7 @@ var HelpCategories = []HelpCategory{{
 }, {
 	Label:       "Services",
 	Description: "manage services",
-	Commands:    []string{"services", "logs", "start", "restart", "signal", "stop", "replan"},
+	Commands:    []string{"services", "logs", "start", "restart", "signal", "send", "stop", "replan", "maintenance"},
 }, {
 	Label:       "Checks",
 	Description: "manage health checks",
@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+const cmdInventorySummary = "Show the hardware facts of the device"
+const cmdInventoryDescription = `
+The inventory command displays the hardware facts collected by the
+{{.DisplayName}} daemon when it started: the device's vendor, model and serial
+number, its processors and memory, and its storage devices and network
+interfaces. Facts that can't be determined are shown as "-".
+
+Some facts are also available in the plan as variables, such as
+${inventory_model} and ${inventory_serial}.
+`
+
+type cmdInventory struct {
+	client *client.Client
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "inventory",
+		Summary:     cmdInventorySummary,
+		Description: cmdInventoryDescription,
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdInventory{client: opts.Client}
+		},
+	})
+}
+
+func (cmd *cmdInventory) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	inventory, err := cmd.client.Inventory()
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	cpu := orDash(inventory.CPU.Model)
+	if inventory.CPU.Count > 0 {
+		cpu = fmt.Sprintf("%s (%d)", cpu, inventory.CPU.Count)
+	}
+	memory := "-"
+	if inventory.Memory > 0 {
+		memory = formatBytes(inventory.Memory)
+	}
+	fmt.Fprintf(w, "Vendor:\t%s\n", orDash(inventory.Vendor))
+	fmt.Fprintf(w, "Model:\t%s\n", orDash(inventory.Model))
+	fmt.Fprintf(w, "Serial:\t%s\n", orDash(inventory.Serial))
+	fmt.Fprintf(w, "CPU:\t%s\n", cpu)
+	fmt.Fprintf(w, "Memory:\t%s\n", memory)
+	for _, disk := range inventory.Storage {
+		removable := ""
+		if disk.Removable {
+			removable = " (removable)"
+		}
+		fmt.Fprintf(w, "Storage:\t%s\t%s%s\n", disk.Name, formatBytes(disk.Size), removable)
+	}
+	for _, iface := range inventory.Network {
+		fmt.Fprintf(w, "Network:\t%s\t%s\n", iface.Name, orDash(iface.MAC))
+	}
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatBytes formats n using binary units, such as "7.7GiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
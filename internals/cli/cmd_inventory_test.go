@@ -0,0 +1,86 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+)
+
+func (s *PebbleSuite) TestInventory(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v1/inventory")
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {
+			"vendor": "ACME",
+			"model": "Gateway 3000",
+			"serial": "SN-1234",
+			"cpu": {"model": "Cortex-A72", "count": 4},
+			"memory": 4294967296,
+			"storage": [
+				{"name": "mmcblk0", "size": 32010928128, "removable": true},
+				{"name": "sda", "size": 512110190592}
+			],
+			"network": [{"name": "eth0", "mac": "00:11:22:33:44:55"}]
+		}}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"inventory"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, `
+Vendor:   ACME
+Model:    Gateway 3000
+Serial:   SN-1234
+CPU:      Cortex-A72 (4)
+Memory:   4.0GiB
+Storage:  mmcblk0  29.8GiB (removable)
+Storage:  sda      476.9GiB
+Network:  eth0     00:11:22:33:44:55
+`[1:])
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestInventoryUnknown(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {
+			"cpu": {"count": 0},
+			"memory": 0,
+			"storage": [],
+			"network": []
+		}}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"inventory"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, `
+Vendor:  -
+Model:   -
+Serial:  -
+CPU:     -
+Memory:  -
+`[1:])
+}
+
+func (s *PebbleSuite) TestInventoryExtraArgs(c *C) {
+	rest, err := cli.ParserForTest().ParseArgs([]string{"inventory", "extra"})
+	c.Assert(err, Equals, cli.ErrExtraArgs)
+	c.Assert(rest, HasLen, 1)
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"time"
 
 	"github.com/canonical/go-flags"
 
@@ -31,6 +32,10 @@ const cmdLogsSummary = "Fetch service logs"
 const cmdLogsDescription = `
 The logs command fetches buffered logs from the given services (or all services
 if none are specified) and displays them in chronological order.
+
+The --since, --until, and --grep options filter the logs on the server, so
+only the matching logs are sent. Times may be given in RFC 3339 format, or as
+a duration before now, for example "10m" or "1h30m".
 `
 
 type cmdLogs struct {
@@ -39,8 +44,11 @@ type cmdLogs struct {
 	Follow     bool   `short:"f" long:"follow"`
 	Format     string `long:"format"`
 	N          string `short:"n"`
+	Since      string `long:"since"`
+	Until      string `long:"until"`
+	Grep       string `long:"grep"`
 	Positional struct {
-		Services []string `positional-arg-name:"<service>"`
+		Services []serviceName `positional-arg-name:"<service>"`
 	} `positional-args:"yes"`
 }
 
@@ -53,6 +61,9 @@ func init() {
 			"--follow": "Follow (tail) logs for given services until Ctrl-C is\npressed. If no services are specified, show logs from\nall services running when the command starts.",
 			"--format": "Output format: \"text\" (default) or \"json\" (JSON lines).",
 			"-n":       "Number of logs to show (before following); defaults to 30.\nIf 'all', show all buffered logs.",
+			"--since":  "Only show logs written at or after this time (RFC 3339\ntime, or duration before now such as \"10m\")",
+			"--until":  "Only show logs written at or before this time (RFC 3339\ntime, or duration before now such as \"10m\")",
+			"--grep":   "Only show logs whose message matches this regular\nexpression",
 		},
 		New: func(opts *CmdOptions) flags.Commander {
 			return &cmdLogs{client: opts.Client}
@@ -99,12 +110,23 @@ func (cmd *cmdLogs) Execute(args []string) error {
 		return fmt.Errorf(`invalid output format (expected "json" or "text", not %q)`, cmd.Format)
 	}
 
+	since, err := parseLogTime("since", cmd.Since)
+	if err != nil {
+		return err
+	}
+	until, err := parseLogTime("until", cmd.Until)
+	if err != nil {
+		return err
+	}
+
 	opts := client.LogsOptions{
 		WriteLog: writeLog,
-		Services: cmd.Positional.Services,
+		Services: stringSlice(cmd.Positional.Services),
 		N:        n,
+		Since:    since,
+		Until:    until,
+		Grep:     cmd.Grep,
 	}
-	var err error
 	if cmd.Follow {
 		// Stop following when Ctrl-C pressed (SIGINT).
 		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
@@ -115,3 +137,20 @@ func (cmd *cmdLogs) Execute(args []string) error {
 	}
 	return err
 }
+
+// parseLogTime parses the value of the --since or --until option, which is
+// either an RFC 3339 time or a duration before now.
+func parseLogTime(option, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid --%s value %q (expected RFC 3339 time or duration, such as \"10m\")", option, value)
+	}
+	return time.Now().Add(-d), nil
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	. "gopkg.in/check.v1"
 
@@ -72,6 +73,47 @@ func (s *PebbleSuite) TestLogsJSON(c *C) {
 	c.Check(s.Stderr(), Equals, "")
 }
 
+func (s *PebbleSuite) TestLogsFilters(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v1/logs")
+		c.Check(r.URL.Query(), DeepEquals, url.Values{
+			"n":     []string{"30"},
+			"since": []string{"2021-05-03T03:00:00Z"},
+			"until": []string{"2021-05-03T04:00:00+02:00"},
+			"grep":  []string{"^log"},
+		})
+		fmt.Fprintf(w, `
+{"time":"2021-05-03T03:55:49.360994155Z","service":"thing","message":"log 1"}
+`[1:])
+	})
+	rest, err := cli.ParserForTest().ParseArgs([]string{"logs",
+		"--since", "2021-05-03T03:00:00Z", "--until", "2021-05-03T04:00:00+02:00", "--grep", "^log"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, `
+2021-05-03T03:55:49.360Z [thing] log 1
+`[1:])
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestLogsSinceDuration(c *C) {
+	before := time.Now()
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+		c.Assert(err, IsNil)
+		c.Check(since.After(before.Add(-11*time.Minute)), Equals, true)
+		c.Check(since.Before(time.Now().Add(-10*time.Minute)), Equals, true)
+	})
+	_, err := cli.ParserForTest().ParseArgs([]string{"logs", "--since", "10m"})
+	c.Assert(err, IsNil)
+}
+
+func (s *PebbleSuite) TestLogsInvalidTime(c *C) {
+	_, err := cli.ParserForTest().ParseArgs([]string{"logs", "--until", "yesterday"})
+	c.Assert(err, ErrorMatches, `invalid --until value "yesterday" \(expected RFC 3339 time or duration, such as "10m"\)`)
+}
+
 func (s *PebbleSuite) TestLogsInvalidFormat(c *C) {
 	rest, err := cli.ParserForTest().ParseArgs([]string{"logs", "--format", "invalid"})
 	c.Assert(err.Error(), Equals, `invalid output format (expected "json" or "text", not "invalid")`)
@@ -0,0 +1,164 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+const cmdMaintenanceSummary = "Show or change maintenance mode"
+const cmdMaintenanceDescription = `
+The maintenance command shows whether {{.DisplayName}} is in maintenance mode,
+and which services were stopped when it was entered.
+
+In maintenance mode, health check failures don't trigger on-check-failure
+actions, so services can be worked on (or hardware serviced) without
+{{.DisplayName}} restarting them. Use '{{.ProgramName}} maintenance enter' and
+'{{.ProgramName}} maintenance exit' to change it.
+`
+
+type cmdMaintenance struct {
+	client *client.Client
+
+	timeMixin
+}
+
+const cmdMaintenanceEnterSummary = "Enter maintenance mode"
+const cmdMaintenanceEnterDescription = `
+The enter command puts {{.DisplayName}} in maintenance mode and stops the
+given services, together with the services that depend on them. If no
+services are given, the running services that aren't started by default
+(those with "startup: disabled") are stopped.
+
+Maintenance mode persists across restarts of {{.DisplayName}} until
+'{{.ProgramName}} maintenance exit' is run.
+`
+
+type cmdMaintenanceEnter struct {
+	client *client.Client
+
+	waitMixin
+	Positional struct {
+		Services []serviceName `positional-arg-name:"<service>"`
+	} `positional-args:"yes"`
+}
+
+const cmdMaintenanceExitSummary = "Exit maintenance mode"
+const cmdMaintenanceExitDescription = `
+The exit command takes {{.DisplayName}} out of maintenance mode and starts the
+services that were stopped when it was entered.
+`
+
+type cmdMaintenanceExit struct {
+	client *client.Client
+
+	waitMixin
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "maintenance",
+		Summary:     cmdMaintenanceSummary,
+		Description: cmdMaintenanceDescription,
+		ArgsHelp:    timeArgsHelp,
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdMaintenance{client: opts.Client}
+		},
+	})
+	AddCommand(&CmdInfo{
+		Name:        "enter",
+		Parent:      "maintenance",
+		Summary:     cmdMaintenanceEnterSummary,
+		Description: cmdMaintenanceEnterDescription,
+		ArgsHelp:    waitArgsHelp,
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdMaintenanceEnter{client: opts.Client}
+		},
+	})
+	AddCommand(&CmdInfo{
+		Name:        "exit",
+		Parent:      "maintenance",
+		Summary:     cmdMaintenanceExitSummary,
+		Description: cmdMaintenanceExitDescription,
+		ArgsHelp:    waitArgsHelp,
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdMaintenanceExit{client: opts.Client}
+		},
+	})
+}
+
+func (cmd *cmdMaintenance) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	info, err := cmd.client.MaintenanceMode()
+	if err != nil {
+		return err
+	}
+	if !info.Active {
+		fmt.Fprintln(Stdout, "Not in maintenance mode.")
+		return nil
+	}
+	fmt.Fprintf(Stdout, "In maintenance mode since %s.\n", cmd.fmtTime(info.Since))
+	if len(info.Services) > 0 {
+		fmt.Fprintf(Stdout, "Stopped services: %s\n", strings.Join(info.Services, ", "))
+	}
+	return nil
+}
+
+func (cmd *cmdMaintenanceEnter) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	opts := client.EnterMaintenanceModeOptions{
+		Services: stringSlice(cmd.Positional.Services),
+	}
+	changeID, err := cmd.client.EnterMaintenanceMode(&opts)
+	if err != nil {
+		return err
+	}
+	if _, err := cmd.wait(cmd.client, changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (cmd *cmdMaintenanceExit) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	changeID, err := cmd.client.ExitMaintenanceMode()
+	if err != nil {
+		return err
+	}
+	if _, err := cmd.wait(cmd.client, changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+)
+
+func (s *PebbleSuite) TestMaintenance(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v1/maintenance-mode")
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {
+			"active": true,
+			"since": "2024-05-01T12:30:00Z",
+			"services": ["svc1", "svc2"]
+		}}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"maintenance", "--abs-time"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, `
+In maintenance mode since 2024-05-01T12:30:00Z.
+Stopped services: svc1, svc2
+`[1:])
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestMaintenanceInactive(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"active": false}}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"maintenance"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, "Not in maintenance mode.\n")
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestMaintenanceEnter(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "POST")
+		c.Check(r.URL.Path, Equals, "/v1/maintenance-mode")
+		body := DecodedRequestBody(c, r)
+		c.Check(body, DeepEquals, map[string]interface{}{
+			"action":   "enter",
+			"services": []interface{}{"svc1"},
+		})
+		fmt.Fprint(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"maintenance", "enter", "--no-wait", "svc1"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, "42\n")
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestMaintenanceExit(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "POST")
+		c.Check(r.URL.Path, Equals, "/v1/maintenance-mode")
+		body := DecodedRequestBody(c, r)
+		c.Check(body, DeepEquals, map[string]interface{}{"action": "exit"})
+		fmt.Fprint(w, `{"type": "async", "status-code": 202, "change": "43"}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"maintenance", "exit", "--no-wait"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, "43\n")
+	c.Check(s.Stderr(), Equals, "")
+}
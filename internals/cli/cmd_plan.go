@@ -15,6 +15,9 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
+
 	"github.com/canonical/go-flags"
 
 	"github.com/canonical/pebble/client"
@@ -23,11 +26,17 @@ import (
 var cmdPlanSummary = "Show the plan with layers combined"
 var cmdPlanDescription = `
 The plan command prints out the effective configuration of {{.DisplayName}} in YAML
-format. Layers are combined according to the override rules defined in them.
+(or JSON) format. Layers are combined according to the override rules defined in them.
+
+If --section is specified, only that section of the plan is printed, for
+example "services" or "checks".
 `
 
 type cmdPlan struct {
 	client *client.Client
+
+	Format  string `long:"format" default:"yaml" choice:"yaml" choice:"json"`
+	Section string `long:"section"`
 }
 
 func init() {
@@ -35,6 +44,10 @@ func init() {
 		Name:        "plan",
 		Summary:     cmdPlanSummary,
 		Description: cmdPlanDescription,
+		ArgsHelp: map[string]string{
+			"--format":  "Output format: yaml (default) or json",
+			"--section": "Only show this section of the plan",
+		},
 		New: func(opts *CmdOptions) flags.Commander {
 			return &cmdPlan{client: opts.Client}
 		},
@@ -45,10 +58,22 @@ func (cmd *cmdPlan) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
 	}
-	planYAML, err := cmd.client.PlanBytes(&client.PlanOptions{})
+	data, err := cmd.client.PlanBytes(&client.PlanOptions{
+		Format:  cmd.Format,
+		Section: cmd.Section,
+	})
 	if err != nil {
 		return err
 	}
-	Stdout.Write(planYAML)
+	if cmd.Format == "json" {
+		var indented bytes.Buffer
+		err = json.Indent(&indented, data, "", "    ")
+		if err != nil {
+			return err
+		}
+		indented.WriteByte('\n')
+		data = indented.Bytes()
+	}
+	Stdout.Write(data)
 	return nil
 }
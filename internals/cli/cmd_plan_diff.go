@@ -0,0 +1,129 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+const cmdPlanDiffSummary = "Show how the plan differs from a previous or candidate plan"
+const cmdPlanDiffDescription = `
+The diff command shows the items (services, checks, log targets, and so on)
+that were added, removed, or changed, and for changed items, the fields that
+differ.
+
+With --from, it compares the plan as it was when the layer with the given
+label was the last layer with the current plan. Otherwise, it compares the
+current plan with the plan that would result from adding the layer at
+<layer-path> with the given label, as '{{.ProgramName}} add' would.
+`
+
+type cmdPlanDiff struct {
+	client *client.Client
+
+	From       string `long:"from"`
+	Combine    bool   `long:"combine"`
+	Positional struct {
+		Label     layerLabel `positional-arg-name:"<label>"`
+		LayerPath string     `positional-arg-name:"<layer-path>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "diff",
+		Parent:      "plan",
+		Summary:     cmdPlanDiffSummary,
+		Description: cmdPlanDiffDescription,
+		ArgsHelp: map[string]string{
+			"--from":    "Compare the plan as of the layer with this label with the current plan",
+			"--combine": "Combine the new layer with an existing layer that has the given label (default is to append)",
+		},
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdPlanDiff{client: opts.Client}
+		},
+	})
+}
+
+func (cmd *cmdPlanDiff) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var opts client.PlanDiffOptions
+	hasLayer := cmd.Positional.Label != "" || cmd.Positional.LayerPath != ""
+	switch {
+	case cmd.From != "" && (hasLayer || cmd.Combine):
+		return errors.New("cannot use --from with a layer")
+	case cmd.From != "":
+		opts.From = cmd.From
+	case cmd.Positional.LayerPath == "":
+		return errors.New("must specify --from, or a label and layer path")
+	default:
+		data, err := os.ReadFile(cmd.Positional.LayerPath)
+		if err != nil {
+			return err
+		}
+		opts.Layer = &client.AddLayerOptions{
+			Combine:   cmd.Combine,
+			Label:     string(cmd.Positional.Label),
+			LayerData: data,
+		}
+	}
+
+	items, err := cmd.client.PlanDiff(&opts)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Fprintln(Stderr, "No differences.")
+		return nil
+	}
+
+	for _, item := range items {
+		var marker string
+		switch item.Action {
+		case "added":
+			marker = "+"
+		case "removed":
+			marker = "-"
+		default:
+			marker = "~"
+		}
+		fmt.Fprintf(Stdout, "%s %s/%s\n", marker, item.Section, item.Name)
+		for _, field := range item.Fields {
+			fmt.Fprintf(Stdout, "    %s: %s -> %s\n", field.Field, formatDiffValue(field.Old), formatDiffValue(field.New))
+		}
+	}
+	return nil
+}
+
+func formatDiffValue(value interface{}) string {
+	if value == nil {
+		return "(unset)"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
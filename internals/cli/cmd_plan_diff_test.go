@@ -0,0 +1,100 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+)
+
+func (s *PebbleSuite) TestPlanDiffFrom(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/plan/diff")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{"from": {"base"}})
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+        {"section": "checks", "name": "chk1", "action": "removed"},
+        {"section": "services", "name": "srv1", "action": "changed", "fields": [
+            {"field": "after", "new": ["srv2"]},
+            {"field": "command", "old": "cmd1", "new": "cmd2"}
+        ]},
+        {"section": "services", "name": "srv2", "action": "added"}
+    ]
+}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"plan", "diff", "--from", "base"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+- checks/chk1
+~ services/srv1
+    after: (unset) -> ["srv2"]
+    command: "cmd1" -> "cmd2"
++ services/srv2
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestPlanDiffLayer(c *check.C) {
+	layerYAML := "services:\n    srv1:\n        override: merge\n        command: cmd2\n"
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/plan/diff")
+		body := DecodedRequestBody(c, r)
+		c.Check(body, check.DeepEquals, map[string]interface{}{
+			"combine": true,
+			"label":   "base",
+			"format":  "yaml",
+			"layer":   layerYAML,
+		})
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": []
+}`)
+	})
+
+	layerPath := filepath.Join(c.MkDir(), "layer.yaml")
+	err := os.WriteFile(layerPath, []byte(layerYAML), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"plan", "diff", "--combine", "base", layerPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No differences.\n")
+}
+
+func (s *PebbleSuite) TestPlanDiffErrors(c *check.C) {
+	_, err := cli.ParserForTest().ParseArgs([]string{"plan", "diff"})
+	c.Assert(err, check.ErrorMatches, "must specify --from, or a label and layer path")
+
+	_, err = cli.ParserForTest().ParseArgs([]string{"plan", "diff", "--from", "base", "foo", "layer.yaml"})
+	c.Assert(err, check.ErrorMatches, "cannot use --from with a layer")
+
+	_, err = cli.ParserForTest().ParseArgs([]string{"plan", "diff", "foo"})
+	c.Assert(err, check.ErrorMatches, "must specify --from, or a label and layer path")
+}
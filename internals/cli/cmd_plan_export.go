@@ -0,0 +1,102 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+const cmdPlanExportSummary = "Export the plan's services in another format"
+const cmdPlanExportDescription = `
+The export command converts the services in the current plan to another
+service manager's configuration. Currently the only format is "systemd",
+which produces a unit file for each service.
+
+By default the units are printed one after another. With --output-dir, each
+unit is written to a file named after the service in the given directory.
+
+The conversion is approximate: settings that have no systemd equivalent,
+such as backoff-factor and on-check-failure, are noted in comments.
+`
+
+type cmdPlanExport struct {
+	client *client.Client
+
+	Format    string `long:"format" default:"systemd" choice:"systemd"`
+	OutputDir string `long:"output-dir"`
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "export",
+		Parent:      "plan",
+		Summary:     cmdPlanExportSummary,
+		Description: cmdPlanExportDescription,
+		ArgsHelp: map[string]string{
+			"--format":     "Export format (only systemd is supported)",
+			"--output-dir": "Write each unit to a file in this directory instead of printing it",
+		},
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdPlanExport{client: opts.Client}
+		},
+	})
+}
+
+func (cmd *cmdPlanExport) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	units, err := cmd.client.PlanSystemdUnits()
+	if err != nil {
+		return err
+	}
+	if len(units) == 0 {
+		fmt.Fprintln(Stderr, "Plan has no services.")
+		return nil
+	}
+
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if cmd.OutputDir != "" {
+		for _, name := range names {
+			path := filepath.Join(cmd.OutputDir, name)
+			err := os.WriteFile(path, []byte(units[name]), 0644)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(Stdout, "Wrote %s\n", path)
+		}
+		return nil
+	}
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintln(Stdout)
+		}
+		fmt.Fprintf(Stdout, "# %s\n", name)
+		fmt.Fprint(Stdout, units[name])
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+)
+
+func (s *PebbleSuite) redirectPlanExport(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/plan")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{"format": []string{"systemd"}})
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": {
+        "foo.service": "[Service]\nExecStart=foo\n",
+        "bar.service": "[Service]\nExecStart=bar\n"
+    }
+}`)
+	})
+}
+
+func (s *PebbleSuite) TestPlanExport(c *check.C) {
+	s.redirectPlanExport(c)
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"plan", "export", "--format", "systemd"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+# bar.service
+[Service]
+ExecStart=bar
+
+# foo.service
+[Service]
+ExecStart=foo
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestPlanExportOutputDir(c *check.C) {
+	s.redirectPlanExport(c)
+	dir := c.MkDir()
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"plan", "export", "--output-dir", dir})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf("Wrote %s\nWrote %s\n",
+		filepath.Join(dir, "bar.service"), filepath.Join(dir, "foo.service")))
+
+	data, err := os.ReadFile(filepath.Join(dir, "foo.service"))
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "[Service]\nExecStart=foo\n")
+}
+
+func (s *PebbleSuite) TestPlanExportInvalidFormat(c *check.C) {
+	_, err := cli.ParserForTest().ParseArgs([]string{"plan", "export", "--format", "upstart"})
+	c.Assert(err, check.ErrorMatches, `.*Invalid value .upstart. for option .--format.*`)
+}
@@ -48,6 +48,60 @@ services:
 	c.Assert(s.Stderr(), check.Equals, ``)
 }
 
+func (s *PebbleSuite) TestGetPlanJSON(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/plan")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{"format": []string{"json"}})
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": {"services": {"foo": {"override": "replace", "command": "cmd"}}}
+}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"plan", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Assert(s.Stdout(), check.Equals, `
+{
+    "services": {
+        "foo": {
+            "override": "replace",
+            "command": "cmd"
+        }
+    }
+}
+`[1:])
+	c.Assert(s.Stderr(), check.Equals, ``)
+}
+
+func (s *PebbleSuite) TestGetPlanSection(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/plan")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"format":  []string{"yaml"},
+			"section": []string{"checks"},
+		})
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": "checks:\n    chk1:\n        override: replace\n"
+}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"plan", "--section", "checks"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Assert(s.Stdout(), check.Equals, `
+checks:
+    chk1:
+        override: replace
+`[1:])
+	c.Assert(s.Stderr(), check.Equals, ``)
+}
+
 func (s *PebbleSuite) TestGetPlanFails(c *check.C) {
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
 		c.Check(r.Method, check.Equals, "GET")
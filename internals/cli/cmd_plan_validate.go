@@ -0,0 +1,82 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/internals/overlord/inventorystate"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+const cmdPlanValidateSummary = "Validate a layers directory"
+const cmdPlanValidateDescription = `
+The validate command reads the layers in the given directory (by default,
+the "layers" directory in $PEBBLE), combines them, and checks that the
+resulting plan is valid. It doesn't need a running {{.DisplayName}} daemon,
+so it can be used to check layers before deploying them. "when" expressions
+and inventory variables such as ${inventory_model} use the facts of the
+current device.
+
+To check a layer against the plan of a running daemon instead, use
+'{{.ProgramName}} add --dry-run'.
+`
+
+type cmdPlanValidate struct {
+	pebbleDir string
+
+	Positional struct {
+		LayersDir string `positional-arg-name:"<layers-dir>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "validate",
+		Parent:      "plan",
+		Summary:     cmdPlanValidateSummary,
+		Description: cmdPlanValidateDescription,
+		ArgsHelp: map[string]string{
+			"<layers-dir>": "Directory containing the layer files (default is $PEBBLE/layers)",
+		},
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdPlanValidate{pebbleDir: opts.PebbleDir}
+		},
+	})
+}
+
+func (cmd *cmdPlanValidate) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	layersDir := cmd.Positional.LayersDir
+	if layersDir == "" {
+		layersDir = filepath.Join(cmd.pebbleDir, "layers")
+	}
+	layers, err := plan.ReadLayersDir(layersDir)
+	if err != nil {
+		return err
+	}
+	plan.SetFacts(inventorystate.NewManager().Facts())
+	_, err = plan.NewPlan(layers)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "Layers in %q are valid\n", layersDir)
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+)
+
+func writeLayers(c *check.C, dir string, layers ...string) {
+	err := os.MkdirAll(dir, 0755)
+	c.Assert(err, check.IsNil)
+	for i, layer := range layers {
+		path := filepath.Join(dir, fmt.Sprintf("%03d-layer%d.yaml", i+1, i+1))
+		err := os.WriteFile(path, []byte(layer), 0644)
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func (s *PebbleSuite) TestPlanValidate(c *check.C) {
+	layersDir := filepath.Join(c.MkDir(), "layers")
+	writeLayers(c, layersDir, `
+services:
+    foo:
+        override: replace
+        command: cmd
+`, `
+services:
+    bar:
+        override: replace
+        command: cmd
+        requires: [foo]
+`)
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"plan", "validate", layersDir})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf("Layers in %q are valid\n", layersDir))
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestPlanValidateDefaultDir(c *check.C) {
+	layersDir := filepath.Join(s.pebbleDir, "layers")
+	writeLayers(c, layersDir, `
+services:
+    foo:
+        override: replace
+        command: cmd
+`)
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"plan", "validate"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf("Layers in %q are valid\n", layersDir))
+}
+
+func (s *PebbleSuite) TestPlanValidateInvalid(c *check.C) {
+	layersDir := filepath.Join(c.MkDir(), "layers")
+
+	// Each layer is valid by itself, but the combined plan isn't.
+	writeLayers(c, layersDir, `
+services:
+    foo:
+        override: replace
+        command: cmd
+`, `
+services:
+    bar:
+        override: replace
+        command: cmd
+        requires: [baz]
+`)
+	_, err := cli.ParserForTest().ParseArgs([]string{"plan", "validate", layersDir})
+	c.Assert(err, check.ErrorMatches, `service "baz" does not exist`)
+	c.Check(s.Stdout(), check.Equals, "")
+
+	_, err = cli.ParserForTest().ParseArgs([]string{"plan", "validate", filepath.Join(layersDir, "missing")})
+	c.Assert(err, check.ErrorMatches, `cannot read layers directory: .*`)
+}
@@ -30,7 +30,7 @@ type cmdRestart struct {
 
 	waitMixin
 	Positional struct {
-		Services []string `positional-arg-name:"<service>" required:"1"`
+		Services []serviceName `positional-arg-name:"<service>" required:"1"`
 	} `positional-args:"yes"`
 }
 
@@ -52,7 +52,7 @@ func (cmd cmdRestart) Execute(args []string) error {
 	}
 
 	servopts := client.ServiceOptions{
-		Names: cmd.Positional.Services,
+		Names: stringSlice(cmd.Positional.Services),
 	}
 	changeID, err := cmd.client.Restart(&servopts)
 	if err != nil {
@@ -20,6 +20,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -29,6 +30,7 @@ import (
 	"github.com/canonical/pebble/cmd"
 	"github.com/canonical/pebble/internals/daemon"
 	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
 	"github.com/canonical/pebble/internals/reaper"
 	"github.com/canonical/pebble/internals/systemd"
 )
@@ -46,19 +48,45 @@ in the service plan. For example:
 `
 
 type sharedRunEnterOpts struct {
-	CreateDirs bool       `long:"create-dirs"`
-	Hold       bool       `long:"hold"`
-	HTTP       string     `long:"http"`
-	Verbose    bool       `short:"v" long:"verbose"`
-	Args       [][]string `long:"args" terminator:";"`
+	CreateDirs           bool          `long:"create-dirs"`
+	Hold                 bool          `long:"hold"`
+	HTTP                 string        `long:"http"`
+	Verbose              bool          `short:"v" long:"verbose"`
+	Args                 [][]string    `long:"args" terminator:";"`
+	WatchLayers          bool          `long:"watch-layers"`
+	CachePlan            bool          `long:"cache-plan"`
+	PersistLogs          bool          `long:"persist-logs"`
+	ProfileInterval      time.Duration `long:"profile-interval"`
+	ProfileKeep          int           `long:"profile-keep" default:"24"`
+	CheckpointDelay      time.Duration `long:"checkpoint-delay"`
+	MemoryOnlyNotices    string        `long:"memory-only-notices"`
+	ConfigSource         string        `long:"config-source"`
+	ConfigSourceInterval time.Duration `long:"config-source-interval"`
+	RequireSignedLayers  bool          `long:"require-signed-layers"`
+	MaxRunningTasks      int           `long:"max-running-tasks"`
+	TaskPriorities       string        `long:"task-priorities"`
+	DebugStateData       string        `long:"debug-state-data"`
 }
 
 var sharedRunEnterArgsHelp = map[string]string{
-	"--create-dirs": "Create {{.DisplayName}} directory on startup if it doesn't exist",
-	"--hold":        "Do not start default services automatically",
-	"--http":        `Start HTTP API listening on this address (e.g., ":4000")`,
-	"--verbose":     "Log all output from services to stdout",
-	"--args":        `Provide additional arguments to a service`,
+	"--create-dirs":            "Create {{.DisplayName}} directory on startup if it doesn't exist",
+	"--hold":                   "Do not start default services automatically",
+	"--http":                   `Start HTTP API listening on this address (e.g., ":4000")`,
+	"--verbose":                "Log all output from services to stdout",
+	"--args":                   `Provide additional arguments to a service`,
+	"--watch-layers":           "Reload the plan when files in the layers directory change",
+	"--cache-plan":             "Cache the combined plan to speed up startup when layers are unchanged",
+	"--persist-logs":           "Keep service logs in files in $PEBBLE/logs so they survive restarts",
+	"--profile-interval":       "Write CPU and heap profiles of the daemon to $PEBBLE/profiles at this interval (for example \"10m\")",
+	"--profile-keep":           "Number of profiles of each kind to keep with --profile-interval",
+	"--checkpoint-delay":       "Defer writing state to disk for this long after a change, so that changes in quick succession are written once (for example \"100ms\")",
+	"--memory-only-notices":    "Comma-separated notice types to keep in memory only, rather than writing them to disk (for example \"custom\")",
+	"--config-source":          "Periodically fetch a layer bundle signed by a key in $PEBBLE/trusted-keys from this HTTPS URL and apply it to the plan",
+	"--config-source-interval": "How often to check the config source for a new bundle (default is \"5m\")",
+	"--require-signed-layers":  "Only allow adding layers via the API if they're signed by a key in $PEBBLE/trusted-keys",
+	"--max-running-tasks":      "Maximum number of tasks to run at once (default is no limit)",
+	"--task-priorities":        "Comma-separated task kinds and priorities; ready tasks with a higher priority are started first (for example \"start=10,exec=-5\")",
+	"--debug-state-data":       "Comma-separated keys of managers' state data that admins may read via the debug API (for example \"timings\")",
 }
 
 type cmdRun struct {
@@ -188,6 +216,32 @@ func runDaemon(rcmd *cmdRun, ch chan os.Signal, ready chan<- func()) error {
 		dopts.ServiceOutput = os.Stdout
 	}
 	dopts.HTTPAddress = rcmd.HTTP
+	dopts.WatchLayers = rcmd.WatchLayers
+	dopts.CachePlan = rcmd.CachePlan
+	dopts.PersistLogs = rcmd.PersistLogs
+	dopts.ProfileInterval = rcmd.ProfileInterval
+	dopts.ProfileKeep = rcmd.ProfileKeep
+	dopts.CheckpointDelay = rcmd.CheckpointDelay
+	if rcmd.MemoryOnlyNotices != "" {
+		for _, t := range strings.Split(rcmd.MemoryOnlyNotices, ",") {
+			dopts.MemoryOnlyNoticeTypes = append(dopts.MemoryOnlyNoticeTypes, state.NoticeType(strings.TrimSpace(t)))
+		}
+	}
+	dopts.ConfigSource = rcmd.ConfigSource
+	dopts.ConfigSourceInterval = rcmd.ConfigSourceInterval
+	dopts.RequireSignedLayers = rcmd.RequireSignedLayers
+	dopts.MaxRunningTasks = rcmd.MaxRunningTasks
+	if rcmd.TaskPriorities != "" {
+		dopts.TaskPriorities, err = parseTaskPriorities(rcmd.TaskPriorities)
+		if err != nil {
+			return err
+		}
+	}
+	if rcmd.DebugStateData != "" {
+		for _, key := range strings.Split(rcmd.DebugStateData, ",") {
+			dopts.DebugStateDataKeys = append(dopts.DebugStateDataKeys, strings.TrimSpace(key))
+		}
+	}
 
 	d, err := daemon.New(&dopts)
 	if err != nil {
@@ -318,6 +372,24 @@ func convertArgs(args [][]string) (map[string][]string, error) {
 	return mappedArgs, nil
 }
 
+// parseTaskPriorities parses the --task-priorities value, a comma-separated
+// list of kind=priority pairs.
+func parseTaskPriorities(value string) (map[string]int, error) {
+	priorities := make(map[string]int)
+	for _, item := range strings.Split(value, ",") {
+		kind, priorityStr, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || kind == "" {
+			return nil, fmt.Errorf("invalid --task-priorities item %q: must be kind=priority", item)
+		}
+		priority, err := strconv.Atoi(priorityStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --task-priorities priority %q for %q", priorityStr, kind)
+		}
+		priorities[kind] = priority
+	}
+	return priorities, nil
+}
+
 func maybeCopyPebbleDir(destDir, srcDir string) error {
 	if srcDir == "" {
 		return nil
@@ -125,3 +125,16 @@ func (s *PebbleSuite) TestMaybeCopyPebbleDirSourceNotADirectory(c *C) {
 	err = cli.MaybeCopyPebbleDir(dst, src)
 	c.Assert(err, ErrorMatches, ".*not a directory.*")
 }
+
+func (s *PebbleSuite) TestParseTaskPriorities(c *C) {
+	priorities, err := cli.ParseTaskPriorities("start=10, exec=-5,stop=0")
+	c.Assert(err, IsNil)
+	c.Check(priorities, DeepEquals, map[string]int{"start": 10, "exec": -5, "stop": 0})
+
+	_, err = cli.ParseTaskPriorities("start")
+	c.Check(err, ErrorMatches, `invalid --task-priorities item "start": must be kind=priority`)
+	_, err = cli.ParseTaskPriorities("=1")
+	c.Check(err, ErrorMatches, `invalid --task-priorities item "=1": must be kind=priority`)
+	_, err = cli.ParseTaskPriorities("start=high")
+	c.Check(err, ErrorMatches, `invalid --task-priorities priority "high" for "start"`)
+}
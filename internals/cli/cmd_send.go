@@ -0,0 +1,70 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io"
+	"strings"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+const cmdSendSummary = "Send input to a running service"
+const cmdSendDescription = `
+The send command sends data to the standard input of a running service, which
+must have "stdin: pipe" in its configuration. If text arguments are given,
+they're sent separated by spaces and followed by a newline; otherwise, the
+command's own standard input is sent. For example:
+
+{{.ProgramName}} send console status
+echo reload | {{.ProgramName}} send console
+`
+
+type cmdSend struct {
+	client *client.Client
+
+	Positional struct {
+		Service serviceName `positional-arg-name:"<service>" required:"1"`
+		Text    []string    `positional-arg-name:"<text>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	AddCommand(&CmdInfo{
+		Name:        "send",
+		Summary:     cmdSendSummary,
+		Description: cmdSendDescription,
+		New: func(opts *CmdOptions) flags.Commander {
+			return &cmdSend{client: opts.Client}
+		},
+	})
+}
+
+func (cmd *cmdSend) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var data io.Reader = Stdin
+	if len(cmd.Positional.Text) > 0 {
+		data = strings.NewReader(strings.Join(cmd.Positional.Text, " ") + "\n")
+	}
+	return cmd.client.SendStdin(&client.SendStdinOptions{
+		Service: string(cmd.Positional.Service),
+		Data:    data,
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/cli"
+)
+
+func (s *PebbleSuite) TestSendText(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/services/console/stdin")
+		body, err := io.ReadAll(r.Body)
+		c.Check(err, check.IsNil)
+		c.Check(string(body), check.Equals, "set level debug\n")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": true
+}`)
+	})
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"send", "console", "set", "level", "debug"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+}
+
+func (s *PebbleSuite) TestSendStdin(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/services/console/stdin")
+		body, err := io.ReadAll(r.Body)
+		c.Check(err, check.IsNil)
+		c.Check(string(body), check.Equals, "line 1\nline 2\n")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": true
+}`)
+	})
+	s.stdin.WriteString("line 1\nline 2\n")
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"send", "console"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+}
+
+func (s *PebbleSuite) TestSendFails(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+		fmt.Fprint(w, `{
+    "type": "error",
+    "status-code": 400,
+    "result": {"message": "service \"console\" stdin is not a pipe"}
+}`)
+	})
+
+	_, err := cli.ParserForTest().ParseArgs([]string{"send", "console", "hello"})
+	c.Assert(err, check.ErrorMatches, `service "console" stdin is not a pipe`)
+}
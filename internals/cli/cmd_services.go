@@ -16,6 +16,7 @@ package cli
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/canonical/go-flags"
 
@@ -32,8 +33,9 @@ type cmdServices struct {
 	client *client.Client
 
 	timeMixin
+	formatMixin
 	Positional struct {
-		Services []string `positional-arg-name:"<service>"`
+		Services []serviceName `positional-arg-name:"<service>"`
 	} `positional-args:"yes"`
 }
 
@@ -42,7 +44,7 @@ func init() {
 		Name:        "services",
 		Summary:     cmdServicesSummary,
 		Description: cmdServicesDescription,
-		ArgsHelp:    timeArgsHelp,
+		ArgsHelp:    merge(timeArgsHelp, formatArgsHelp),
 		New: func(opts *CmdOptions) flags.Commander {
 			return &cmdServices{client: opts.Client}
 		},
@@ -55,12 +57,15 @@ func (cmd *cmdServices) Execute(args []string) error {
 	}
 
 	opts := client.ServicesOptions{
-		Names: cmd.Positional.Services,
+		Names: stringSlice(cmd.Positional.Services),
 	}
 	services, err := cmd.client.Services(&opts)
 	if err != nil {
 		return err
 	}
+	if cmd.structured() {
+		return cmd.writeStructured(servicesOutput(services))
+	}
 	if len(services) == 0 {
 		if len(cmd.Positional.Services) == 0 {
 			fmt.Fprintln(Stderr, "Plan has no services.")
@@ -84,3 +89,27 @@ func (cmd *cmdServices) Execute(args []string) error {
 	}
 	return nil
 }
+
+// serviceOutput is the JSON and YAML output format for a service.
+type serviceOutput struct {
+	Name         string     `json:"name"`
+	Startup      string     `json:"startup"`
+	Current      string     `json:"current"`
+	CurrentSince *time.Time `json:"current-since,omitempty"`
+}
+
+func servicesOutput(services []*client.ServiceInfo) []serviceOutput {
+	output := make([]serviceOutput, len(services))
+	for i, svc := range services {
+		output[i] = serviceOutput{
+			Name:    svc.Name,
+			Startup: string(svc.Startup),
+			Current: string(svc.Current),
+		}
+		if !svc.CurrentSince.IsZero() {
+			since := svc.CurrentSince
+			output[i].CurrentSince = &since
+		}
+	}
+	return output
+}
@@ -51,6 +51,50 @@ svc3     enabled  backoff   -
 	c.Check(s.Stderr(), check.Equals, "")
 }
 
+func (s *PebbleSuite) TestServicesJSON(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, check.Equals, "/v1/services")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"name": "svc1", "current": "active", "startup": "enabled", "current-since": "2022-04-28T17:05:23+12:00"},
+		{"name": "svc2", "current": "inactive", "startup": "disabled"}
+	]
+}`)
+	})
+	rest, err := cli.ParserForTest().ParseArgs([]string{"services", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+[
+    {
+        "name": "svc1",
+        "startup": "enabled",
+        "current": "active",
+        "current-since": "2022-04-28T17:05:23+12:00"
+    },
+    {
+        "name": "svc2",
+        "startup": "disabled",
+        "current": "inactive"
+    }
+]
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestServicesJSONEmpty(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+	rest, err := cli.ParserForTest().ParseArgs([]string{"services", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "[]\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
 func (s *PebbleSuite) TestPlanNoServices(c *check.C) {
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
 		c.Assert(r.Method, check.Equals, "GET")
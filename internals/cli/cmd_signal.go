@@ -35,8 +35,8 @@ type cmdSignal struct {
 	client *client.Client
 
 	Positional struct {
-		Signal   string   `positional-arg-name:"<SIGNAL>"`
-		Services []string `positional-arg-name:"<service>"`
+		Signal   string        `positional-arg-name:"<SIGNAL>"`
+		Services []serviceName `positional-arg-name:"<service>"`
 	} `positional-args:"yes" required:"yes"`
 }
 
@@ -60,7 +60,7 @@ func (cmd *cmdSignal) Execute(args []string) error {
 	}
 	opts := client.SendSignalOptions{
 		Signal:   cmd.Positional.Signal,
-		Services: cmd.Positional.Services,
+		Services: stringSlice(cmd.Positional.Services),
 	}
 	err := cmd.client.SendSignal(&opts)
 	if err != nil {
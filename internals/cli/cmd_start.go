@@ -31,7 +31,7 @@ type cmdStart struct {
 
 	waitMixin
 	Positional struct {
-		Services []string `positional-arg-name:"<service>" required:"1"`
+		Services []serviceName `positional-arg-name:"<service>" required:"1"`
 	} `positional-args:"yes"`
 }
 
@@ -53,7 +53,7 @@ func (cmd cmdStart) Execute(args []string) error {
 	}
 
 	servopts := client.ServiceOptions{
-		Names: cmd.Positional.Services,
+		Names: stringSlice(cmd.Positional.Services),
 	}
 	changeID, err := cmd.client.Start(&servopts)
 	if err != nil {
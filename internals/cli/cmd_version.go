@@ -18,6 +18,7 @@ import (
 	"fmt"
 
 	"github.com/canonical/go-flags"
+	"github.com/canonical/x-go/strutil/quantity"
 
 	"github.com/canonical/pebble/client"
 	version "github.com/canonical/pebble/cmd"
@@ -26,12 +27,16 @@ import (
 const cmdVersionSummary = "Show version details"
 const cmdVersionDescription = `
 The version command displays the versions of the running client and server.
+With --verbose, it also displays details about the server and the system it's
+running on, such as when they started.
 `
 
 type cmdVersion struct {
 	client *client.Client
 
+	timeMixin
 	ClientOnly bool `long:"client"`
+	Verbose    bool `long:"verbose"`
 }
 
 func init() {
@@ -39,9 +44,10 @@ func init() {
 		Name:        "version",
 		Summary:     cmdVersionSummary,
 		Description: cmdVersionDescription,
-		ArgsHelp: map[string]string{
-			"--client": "Only display the client version",
-		},
+		ArgsHelp: merge(timeArgsHelp, map[string]string{
+			"--client":  "Only display the client version",
+			"--verbose": "Also display server and system details",
+		}),
 		New: func(opts *CmdOptions) flags.Commander {
 			return &cmdVersion{client: opts.Client}
 		},
@@ -58,9 +64,41 @@ func (cmd cmdVersion) Execute(args []string) error {
 		return nil
 	}
 
+	if cmd.Verbose {
+		return cmd.printVerbose()
+	}
 	return printVersions(cmd.client)
 }
 
+func (cmd cmdVersion) printVerbose() error {
+	sysInfo, err := cmd.client.SysInfo()
+	if err != nil {
+		sysInfo = &client.SysInfo{Version: "-"}
+	}
+	w := tabWriter()
+	fmt.Fprintf(w, "client\t%s\n", version.Version)
+	fmt.Fprintf(w, "server\t%s\n", sysInfo.Version)
+	if sysInfo.BootID != "" {
+		fmt.Fprintf(w, "boot-id\t%s\n", sysInfo.BootID)
+	}
+	if sysInfo.PlanHash != "" {
+		fmt.Fprintf(w, "plan-hash\t%s\n", sysInfo.PlanHash)
+	}
+	if !sysInfo.StartTime.IsZero() {
+		fmt.Fprintf(w, "server-started\t%s\n", cmd.fmtTime(sysInfo.StartTime))
+	}
+	if !sysInfo.BootTime.IsZero() {
+		fmt.Fprintf(w, "system-booted\t%s\n", cmd.fmtTime(sysInfo.BootTime))
+	}
+	// The system status is only available to users, so it's left out if
+	// it can't be fetched.
+	if status, err := cmd.client.SystemStatus(); err == nil && status.StateSize > 0 {
+		fmt.Fprintf(w, "state-size\t%sB\n", quantity.FormatAmount(uint64(status.StateSize), -1))
+	}
+	w.Flush()
+	return nil
+}
+
 func printVersions(cli *client.Client) error {
 	serverVersion := "-"
 	sysInfo, err := cli.SysInfo()
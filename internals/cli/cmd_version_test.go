@@ -47,6 +47,57 @@ func (s *PebbleSuite) TestVersionClientOnly(c *C) {
 	c.Check(s.Stderr(), Equals, "")
 }
 
+func (s *PebbleSuite) TestVersionVerbose(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/system-info":
+			fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":{
+				"version": "7.89",
+				"boot-id": "ffffffff-ffff-ffff-ffff-ffffffffffff",
+				"plan-hash": "abcd",
+				"start-time": "2024-05-01T12:30:00Z",
+				"boot-time": "2024-05-01T12:00:00Z"
+			}}`)
+		case "/v1/system-status":
+			fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":{
+				"state-size": 12345
+			}}`)
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+
+	restore := fakeVersion("4.56")
+	defer restore()
+
+	_, err := cli.ParserForTest().ParseArgs([]string{"version", "--verbose", "--abs-time"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, `
+client          4.56
+server          7.89
+boot-id         ffffffff-ffff-ffff-ffff-ffffffffffff
+plan-hash       abcd
+server-started  2024-05-01T12:30:00Z
+system-booted   2024-05-01T12:00:00Z
+state-size      12.3kB
+`[1:])
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestVersionVerboseNoServer(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		fmt.Fprintln(w, `{"type":"error","status-code":500,"result":{"message":"oops"}}`)
+	})
+
+	restore := fakeVersion("4.56")
+	defer restore()
+
+	_, err := cli.ParserForTest().ParseArgs([]string{"version", "--verbose"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "client  4.56\nserver  -\n")
+}
+
 func (s *PebbleSuite) TestVersionExtraArgs(c *C) {
 	rest, err := cli.ParserForTest().ParseArgs([]string{"version", "extra", "args"})
 	c.Assert(err, Equals, cli.ErrExtraArgs)
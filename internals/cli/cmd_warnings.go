@@ -20,6 +20,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 	"unicode"
@@ -48,6 +49,7 @@ type cmdWarnings struct {
 
 	timeMixin
 	unicodeMixin
+	formatMixin
 	All     bool `long:"all"`
 	Verbose bool `long:"verbose"`
 }
@@ -57,7 +59,7 @@ func init() {
 		Name:        "warnings",
 		Summary:     cmdWarningsSummary,
 		Description: cmdWarningsDescription,
-		ArgsHelp: merge(timeArgsHelp, unicodeArgsHelp, map[string]string{
+		ArgsHelp: merge(timeArgsHelp, unicodeArgsHelp, formatArgsHelp, map[string]string{
 			"--all":     "Show all warnings",
 			"--verbose": "Show more information",
 		}),
@@ -77,6 +79,14 @@ func (cmd *cmdWarnings) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
+	if cmd.structured() {
+		if len(warnings) > 0 {
+			if err := writeWarningTimestamp(now); err != nil {
+				return err
+			}
+		}
+		return cmd.writeStructured(warningsOutput(warnings))
+	}
 	if len(warnings) == 0 {
 		if t, _ := lastWarningTimestamp(); t.IsZero() {
 			fmt.Fprintln(Stdout, "No warnings.")
@@ -103,6 +113,9 @@ func (cmd *cmdWarnings) Execute(args []string) error {
 			fmt.Fprintln(w, "---")
 		}
 		if cmd.Verbose {
+			if warning.Key != "" {
+				fmt.Fprintf(w, "key:\t%s\n", warning.Key)
+			}
 			fmt.Fprintf(w, "first-occurrence:\t%s\n", cmd.fmtTime(warning.FirstAdded))
 		}
 		fmt.Fprintf(w, "last-occurrence:\t%s\n", cmd.fmtTime(warning.LastAdded))
@@ -118,12 +131,55 @@ func (cmd *cmdWarnings) Execute(args []string) error {
 		}
 		fmt.Fprintln(w, "warning: |")
 		writeWarning(w, warning.Message, termWidth)
+		if len(warning.Data) > 0 {
+			fmt.Fprintln(w, "data:")
+			keys := make([]string, 0, len(warning.Data))
+			for k := range warning.Data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Fprintf(w, "  %s:\t%s\n", k, warning.Data[k])
+			}
+		}
 		w.Flush()
 	}
 
 	return nil
 }
 
+// warningOutput is the JSON and YAML output format for a warning.
+type warningOutput struct {
+	Key         string            `json:"key,omitempty"`
+	Message     string            `json:"message"`
+	Data        map[string]string `json:"data,omitempty"`
+	FirstAdded  time.Time         `json:"first-added"`
+	LastAdded   time.Time         `json:"last-added"`
+	LastShown   *time.Time        `json:"last-shown,omitempty"`
+	ExpireAfter string            `json:"expire-after"`
+	RepeatAfter string            `json:"repeat-after"`
+}
+
+func warningsOutput(warnings []*client.Warning) []warningOutput {
+	output := make([]warningOutput, len(warnings))
+	for i, warning := range warnings {
+		output[i] = warningOutput{
+			Key:         warning.Key,
+			Message:     warning.Message,
+			Data:        warning.Data,
+			FirstAdded:  warning.FirstAdded,
+			LastAdded:   warning.LastAdded,
+			ExpireAfter: warning.ExpireAfter.String(),
+			RepeatAfter: warning.RepeatAfter.String(),
+		}
+		if !warning.LastShown.IsZero() {
+			lastShown := warning.LastShown
+			output[i].LastShown = &lastShown
+		}
+	}
+	return output
+}
+
 // writeWarning formats and writes descr to w.
 //
 // The behavior is:
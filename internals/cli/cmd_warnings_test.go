@@ -126,6 +126,41 @@ warning: |
 `[1:])
 }
 
+func (s *warningSuite) TestWarningsJSON(c *check.C) {
+	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, twoWarnings))
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"warnings", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `
+[
+    {
+        "message": "hello world number one",
+        "first-added": "2018-09-19T12:41:18.505007495Z",
+        "last-added": "2018-09-19T12:41:18.505007495Z",
+        "expire-after": "672h0m0s",
+        "repeat-after": "24h0m0s"
+    },
+    {
+        "message": "hello world number two",
+        "first-added": "2018-09-19T12:44:19.680362867Z",
+        "last-added": "2018-09-19T12:44:19.680362867Z",
+        "expire-after": "672h0m0s",
+        "repeat-after": "24h0m0s"
+    },
+    {
+        "message": "hello world number three",
+        "first-added": "2018-09-19T12:44:30.680362867Z",
+        "last-added": "2018-09-19T12:44:30.680362867Z",
+        "last-shown": "2018-09-19T12:44:50.680362867Z",
+        "expire-after": "672h0m0s",
+        "repeat-after": "24h0m0s"
+    }
+]
+`[1:])
+}
+
 func (s *warningSuite) TestVerboseWarnings(c *check.C) {
 	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, twoWarnings))
 
@@ -160,6 +195,70 @@ warning: |
 `[1:])
 }
 
+const keyedWarning = `{
+			"result": [
+			    {
+				"key": "log-target-failing/tgt1",
+				"expire-after": "24h0m0s",
+				"first-added": "2018-09-19T12:41:18.505007495Z",
+				"last-added": "2018-09-19T12:44:19.680362867Z",
+				"message": "Cannot forward logs to log target \"tgt1\": timeout",
+				"data": {"target": "tgt1", "consecutive-failures": "12"},
+				"repeat-after": "1h0m0s"
+			    }
+			],
+			"status": "OK",
+			"status-code": 200,
+			"type": "sync"
+		}`
+
+func (s *warningSuite) TestWarningsData(c *check.C) {
+	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, keyedWarning))
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"warnings", "--abs-time", "--verbose", "--unicode=never"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `
+key:               log-target-failing/tgt1
+first-occurrence:  2018-09-19T12:41:18Z
+last-occurrence:   2018-09-19T12:44:19Z
+acknowledged:      --
+repeats-after:     60.0m
+expires-after:     1d00h
+warning: |
+  Cannot forward logs to log target "tgt1": timeout
+data:
+  consecutive-failures:  12
+  target:                tgt1
+`[1:])
+}
+
+func (s *warningSuite) TestWarningsDataJSON(c *check.C) {
+	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, keyedWarning))
+
+	rest, err := cli.ParserForTest().ParseArgs([]string{"warnings", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `
+[
+    {
+        "key": "log-target-failing/tgt1",
+        "message": "Cannot forward logs to log target \"tgt1\": timeout",
+        "data": {
+            "consecutive-failures": "12",
+            "target": "tgt1"
+        },
+        "first-added": "2018-09-19T12:41:18.505007495Z",
+        "last-added": "2018-09-19T12:44:19.680362867Z",
+        "expire-after": "24h0m0s",
+        "repeat-after": "1h0m0s"
+    }
+]
+`[1:])
+}
+
 func (s *warningSuite) TestOkay(c *check.C) {
 	t0 := time.Now()
 	cli.WriteWarningTimestamp(t0)
@@ -0,0 +1,123 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"strings"
+
+	"github.com/canonical/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+// completionClient is used to query the daemon when completing positional
+// arguments. It's set by Parser.
+var completionClient *client.Client
+
+// serviceName is a positional argument that completes to the names of the
+// services in the plan.
+type serviceName string
+
+func (s serviceName) Complete(match string) []flags.Completion {
+	if completionClient == nil {
+		return nil
+	}
+	services, err := completionClient.Services(&client.ServicesOptions{})
+	if err != nil {
+		return nil
+	}
+	var completions []flags.Completion
+	for _, svc := range services {
+		if strings.HasPrefix(svc.Name, match) {
+			completions = append(completions, flags.Completion{Item: svc.Name, Description: string(svc.Current)})
+		}
+	}
+	return completions
+}
+
+// checkName is a positional argument that completes to the names of the
+// health checks in the plan.
+type checkName string
+
+func (c checkName) Complete(match string) []flags.Completion {
+	if completionClient == nil {
+		return nil
+	}
+	checks, err := completionClient.Checks(&client.ChecksOptions{})
+	if err != nil {
+		return nil
+	}
+	var completions []flags.Completion
+	for _, check := range checks {
+		if strings.HasPrefix(check.Name, match) {
+			completions = append(completions, flags.Completion{Item: check.Name, Description: string(check.Status)})
+		}
+	}
+	return completions
+}
+
+// changeID is a positional argument that completes to the IDs of recent
+// changes.
+type changeID string
+
+func (c changeID) Complete(match string) []flags.Completion {
+	if completionClient == nil {
+		return nil
+	}
+	changes, err := completionClient.Changes(&client.ChangesOptions{Selector: client.ChangesAll})
+	if err != nil {
+		return nil
+	}
+	var completions []flags.Completion
+	for _, chg := range changes {
+		if strings.HasPrefix(chg.ID, match) {
+			completions = append(completions, flags.Completion{Item: chg.ID, Description: chg.Summary})
+		}
+	}
+	return completions
+}
+
+// layerLabel is a positional argument that completes to the labels of the
+// plan's layers.
+type layerLabel string
+
+func (l layerLabel) Complete(match string) []flags.Completion {
+	if completionClient == nil {
+		return nil
+	}
+	layers, err := completionClient.Layers()
+	if err != nil {
+		return nil
+	}
+	var completions []flags.Completion
+	for _, layer := range layers {
+		if strings.HasPrefix(layer.Label, match) {
+			completions = append(completions, flags.Completion{Item: layer.Label})
+		}
+	}
+	return completions
+}
+
+// stringSlice converts a slice of positional arguments to strings.
+func stringSlice[T ~string](values []T) []string {
+	if values == nil {
+		return nil
+	}
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = string(v)
+	}
+	return strs
+}
@@ -69,7 +69,8 @@ var (
 
 	GetEnvPaths = getEnvPaths
 
-	MaybeCopyPebbleDir = maybeCopyPebbleDir
+	MaybeCopyPebbleDir  = maybeCopyPebbleDir
+	ParseTaskPriorities = parseTaskPriorities
 )
 
 func FakeIsStdoutTTY(t bool) (restore func()) {
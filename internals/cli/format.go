@@ -16,6 +16,7 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"go/doc"
 	"io"
@@ -27,8 +28,47 @@ import (
 	"unicode/utf8"
 
 	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 )
 
+type formatMixin struct {
+	Format string `long:"format" default:"text" choice:"text" choice:"json" choice:"yaml"`
+}
+
+var formatArgsHelp = map[string]string{
+	"--format": "Output format: text (default), json, or yaml",
+}
+
+// structured reports whether the output format is JSON or YAML, rather than
+// human-readable text.
+func (fmx formatMixin) structured() bool {
+	return fmx.Format == "json" || fmx.Format == "yaml"
+}
+
+// writeStructured writes v to Stdout in JSON or YAML format. The YAML is
+// converted from the JSON encoding, so both use the same field names.
+func (fmx formatMixin) writeStructured(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	if fmx.Format == "yaml" {
+		var value interface{}
+		err = yaml.Unmarshal(data, &value)
+		if err != nil {
+			return err
+		}
+		data, err = yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+	} else {
+		data = append(data, '\n')
+	}
+	_, err = Stdout.Write(data)
+	return err
+}
+
 type unicodeMixin struct {
 	Unicode string `long:"unicode" default:"auto" choice:"auto" choice:"never" choice:"always"`
 }
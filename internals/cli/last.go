@@ -24,7 +24,7 @@ import (
 type changeIDMixin struct {
 	LastChangeType string `long:"last"`
 	Positional     struct {
-		ChangeID string `positional-arg-name:"<change-id>"`
+		ChangeID changeID `positional-arg-name:"<change-id>"`
 	} `positional-args:"yes"`
 }
 
@@ -25,10 +25,7 @@ import (
 	"github.com/canonical/pebble/internals/progress"
 )
 
-var (
-	maxGoneTime = 5 * time.Second
-	pollTime    = 100 * time.Millisecond
-)
+var pollTime = 100 * time.Millisecond
 
 type waitMixin struct {
 	NoWait bool `long:"no-wait"`
@@ -83,41 +80,19 @@ func Wait(cli *client.Client, changeID string) (*client.Change, error) {
 		close(sigs)
 	}()
 
-	tMax := time.Time{}
-
 	var lastID string
 	lastLog := map[string]string{}
 	for {
 		var rebootingErr error
+		// The client retries while the server is restarting, and returns
+		// the maintenance error if the system is restarting.
 		chg, err := cli.Change(changeID)
 		if err != nil {
-			// A client.Error means we were able to communicate with
-			// the server (got an answer).
-			if e, ok := err.(*client.Error); ok {
-				return nil, e
-			}
-
-			// A non-client error here means the server most
-			// likely went away
-			// XXX: it actually can be a bunch of other things; fix client to expose it better
-			now := time.Now()
-			if tMax.IsZero() {
-				tMax = now.Add(maxGoneTime)
-			}
-			if now.After(tMax) {
-				return nil, err
-			}
-			pb.Spin("Waiting for server to restart")
-			time.Sleep(pollTime)
-			continue
+			return nil, err
 		}
 		if maintErr, ok := cli.Maintenance().(*client.Error); ok && maintErr.Kind == client.ErrorKindSystemRestart {
 			rebootingErr = maintErr
 		}
-		if !tMax.IsZero() {
-			pb.Finished()
-			tMax = time.Time{}
-		}
 
 		for _, t := range chg.Tasks {
 			switch {
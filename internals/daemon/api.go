@@ -16,22 +16,39 @@ package daemon
 
 import (
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 
+	"github.com/canonical/pebble/internals/osutil"
 	"github.com/canonical/pebble/internals/overlord"
 	"github.com/canonical/pebble/internals/overlord/restart"
+	"github.com/canonical/pebble/internals/overlord/servstate"
 	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
 )
 
 var API = []*Command{{
 	Path:       "/v1/system-info",
 	ReadAccess: OpenAccess{},
 	GET:        v1SystemInfo,
+}, {
+	Path:       "/v1/system-status",
+	ReadAccess: UserAccess{},
+	GET:        v1SystemStatus,
 }, {
 	Path:       "/v1/health",
 	ReadAccess: OpenAccess{},
 	GET:        v1Health,
+}, {
+	Path:       "/v1/time-sync",
+	ReadAccess: OpenAccess{},
+	GET:        v1GetTimeSync,
+}, {
+	Path:       "/v1/state-info",
+	ReadAccess: UserAccess{},
+	GET:        v1GetStateInfo,
 }, {
 	Path:        "/v1/warnings",
 	ReadAccess:  UserAccess{},
@@ -58,19 +75,43 @@ var API = []*Command{{
 	WriteAccess: AdminAccess{},
 	GET:         v1GetServices,
 	POST:        v1PostServices,
+}, {
+	Path:        "/v1/maintenance-mode",
+	ReadAccess:  UserAccess{},
+	WriteAccess: AdminAccess{},
+	GET:         v1GetMaintenance,
+	POST:        v1PostMaintenance,
 }, {
 	Path:        "/v1/services/{name}",
 	ReadAccess:  UserAccess{},
 	WriteAccess: AdminAccess{},
 	GET:         v1GetService,
 	POST:        v1PostService,
+}, {
+	Path:        "/v1/services/{name}/stdin",
+	WriteAccess: AdminAccess{},
+	POST:        v1PostServiceStdin,
 }, {
 	Path:       "/v1/plan",
 	ReadAccess: UserAccess{},
 	GET:        v1GetPlan,
+}, {
+	Path:        "/v1/plan/diff",
+	ReadAccess:  UserAccess{},
+	WriteAccess: AdminAccess{},
+	GET:         v1GetPlanDiff,
+	POST:        v1PostPlanDiff,
+}, {
+	Path:        "/v1/plan/sections/{name}",
+	ReadAccess:  UserAccess{},
+	WriteAccess: AdminAccess{},
+	GET:         v1GetPlanSection,
+	POST:        v1PostPlanSection,
 }, {
 	Path:        "/v1/layers",
+	ReadAccess:  UserAccess{},
 	WriteAccess: AdminAccess{},
+	GET:         v1GetLayers,
 	POST:        v1PostLayers,
 }, {
 	Path:        "/v1/files",
@@ -90,14 +131,48 @@ var API = []*Command{{
 	Path:       "/v1/tasks/{task-id}/websocket/{websocket-id}",
 	ReadAccess: AdminAccess{}, // used by exec, so require admin
 	GET:        v1GetTaskWebsocket,
+}, {
+	Path:       "/v1/tasks/{task-id}/transcript",
+	ReadAccess: AdminAccess{}, // exec transcripts include all I/O
+	GET:        v1GetTaskTranscript,
 }, {
 	Path:        "/v1/signals",
 	WriteAccess: AdminAccess{},
 	POST:        v1PostSignals,
+}, {
+	Path:       "/v1/debug/pprof/{profile}",
+	ReadAccess: AdminAccess{},
+	GET:        v1GetPprof,
+}, {
+	Path:       "/v1/debug/timings",
+	ReadAccess: UserAccess{},
+	GET:        v1GetTimings,
+}, {
+	Path:       "/v1/debug/state-data/{key}",
+	ReadAccess: AdminAccess{}, // managers' data may be sensitive
+	GET:        v1GetStateData,
+}, {
+	Path:        "/v1/debug/log-level",
+	ReadAccess:  UserAccess{},
+	WriteAccess: AdminAccess{},
+	GET:         v1GetLogLevel,
+	POST:        v1PostLogLevel,
+}, {
+	Path:       "/v1/managers",
+	ReadAccess: UserAccess{},
+	GET:        v1GetManagers,
+}, {
+	Path:       "/v1/inventory",
+	ReadAccess: UserAccess{},
+	GET:        v1GetInventory,
 }, {
 	Path:       "/v1/checks",
 	ReadAccess: UserAccess{},
 	GET:        v1GetChecks,
+}, {
+	Path:       "/v1/log-targets",
+	ReadAccess: UserAccess{},
+	GET:        v1GetLogTargets,
 }, {
 	Path:        "/v1/notices",
 	ReadAccess:  UserAccess{},
@@ -120,6 +195,8 @@ var (
 	overlordPlanManager    = (*overlord.Overlord).PlanManager
 
 	muxVars = mux.Vars
+
+	osutilBootTime = osutil.BootTime
 )
 
 func v1SystemInfo(c *Command, r *http.Request, _ *UserState) Response {
@@ -127,8 +204,60 @@ func v1SystemInfo(c *Command, r *http.Request, _ *UserState) Response {
 	state.Lock()
 	defer state.Unlock()
 	result := map[string]interface{}{
-		"version": c.d.Version,
-		"boot-id": restart.BootID(state),
+		"version":      c.d.Version,
+		"boot-id":      restart.BootID(state),
+		"architecture": plan.HostArch(),
+		"plan-hash":    overlordPlanManager(c.d.overlord).PlanHash(),
+	}
+	if !c.d.StartTime.IsZero() {
+		result["start-time"] = c.d.StartTime
+	}
+	if bootTime, err := osutilBootTime(); err == nil {
+		result["boot-time"] = bootTime
 	}
 	return SyncResponse(result)
 }
+
+// v1SystemStatus returns the operational status of the daemon. Unlike
+// /v1/system-info, it's only available to users, as it includes details
+// such as the config source's URL and errors.
+func v1SystemStatus(c *Command, r *http.Request, _ *UserState) Response {
+	result := map[string]interface{}{
+		"managers-ready": managersReady(c),
+	}
+	if statePath := c.d.overlord.StatePath(); statePath != "" {
+		if fi, err := os.Stat(statePath); err == nil {
+			result["state-size"] = fi.Size()
+		}
+	}
+	if configSrcMgr := c.d.overlord.ConfigSourceManager(); configSrcMgr != nil {
+		status := configSrcMgr.Status()
+		info := configSourceInfo{
+			URL:     status.URL,
+			Version: status.Version,
+			Error:   status.Error,
+		}
+		if !status.LastCheck.IsZero() {
+			info.LastCheck = &status.LastCheck
+		}
+		result["config-source"] = info
+	}
+	st := c.d.overlord.State()
+	st.Lock()
+	maintenance, err := servstate.GetMaintenance(st)
+	st.Unlock()
+	if err != nil {
+		return InternalError("cannot get maintenance mode: %v", err)
+	}
+	if maintenance != nil {
+		result["maintenance-mode"] = newMaintenanceInfo(maintenance)
+	}
+	return SyncResponse(result)
+}
+
+type configSourceInfo struct {
+	URL       string     `json:"url"`
+	Version   string     `json:"version,omitempty"`
+	LastCheck *time.Time `json:"last-check,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
@@ -45,6 +45,7 @@ type taskInfo struct {
 	Status   string           `json:"status"`
 	Log      []string         `json:"log,omitempty"`
 	Progress taskInfoProgress `json:"progress"`
+	Lanes    []int            `json:"lanes,omitempty"`
 
 	SpawnTime time.Time  `json:"spawn-time,omitempty"`
 	ReadyTime *time.Time `json:"ready-time,omitempty"`
@@ -58,6 +59,11 @@ type taskInfoProgress struct {
 	Total int    `json:"total"`
 }
 
+// internalErrorStatus is the status reported instead of "Error" for changes
+// and tasks that failed because a task handler panicked, so that bugs can be
+// told apart from operational failures.
+const internalErrorStatus = "InternalError"
+
 func change2changeInfo(chg *state.Change) *changeInfo {
 	status := chg.Status()
 	chgInfo := &changeInfo{
@@ -76,6 +82,9 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 	if err := chg.Err(); err != nil {
 		chgInfo.Err = err.Error()
 	}
+	if chg.InternalError() {
+		chgInfo.Status = internalErrorStatus
+	}
 
 	tasks := chg.Tasks()
 	taskInfos := make([]*taskInfo, len(tasks))
@@ -99,6 +108,14 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 		if !readyTime.IsZero() {
 			taskInfo.ReadyTime = &readyTime
 		}
+		if t.InternalError() {
+			taskInfo.Status = internalErrorStatus
+		}
+		// Tasks that haven't joined a lane are in the default lane 0,
+		// which is left out.
+		if lanes := t.Lanes(); len(lanes) != 1 || lanes[0] != 0 {
+			taskInfo.Lanes = lanes
+		}
 		var data map[string]*json.RawMessage
 		if t.Get("api-data", &data) == nil {
 			taskInfo.Data = data
@@ -235,6 +252,7 @@ func v1PostChange(c *Command, r *http.Request, _ *UserState) Response {
 
 	var reqData struct {
 		Action string `json:"action"`
+		Lanes  []int  `json:"lanes"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -242,7 +260,16 @@ func v1PostChange(c *Command, r *http.Request, _ *UserState) Response {
 		return BadRequest("cannot decode data from request body: %v", err)
 	}
 
-	if reqData.Action != "abort" {
+	switch reqData.Action {
+	case "abort":
+		if len(reqData.Lanes) > 0 {
+			return BadRequest(`lanes are only valid with action "abort-lanes"`)
+		}
+	case "abort-lanes":
+		if len(reqData.Lanes) == 0 {
+			return BadRequest("no lanes to abort provided")
+		}
+	default:
 		return BadRequest("change action %q is unsupported", reqData.Action)
 	}
 
@@ -250,8 +277,19 @@ func v1PostChange(c *Command, r *http.Request, _ *UserState) Response {
 		return BadRequest("cannot abort change %s with nothing pending", chID)
 	}
 
-	// flag the change
-	chg.Abort()
+	if reqData.Action == "abort-lanes" {
+		for _, lane := range reqData.Lanes {
+			if len(chg.LaneTasks(lane)) == 0 {
+				return BadRequest("cannot find lane %d in change %s", lane, chID)
+			}
+		}
+		// Only the tasks in the given lanes (and those waiting on them)
+		// are aborted and undone; tasks in other lanes proceed.
+		chg.AbortLanes(reqData.Lanes)
+	} else {
+		// flag the change
+		chg.Abort()
+	}
 
 	// actually ask to proceed with the abort
 	stateEnsureBefore(state, 0)
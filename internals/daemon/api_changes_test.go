@@ -371,6 +371,108 @@ func (s *apiSuite) TestStateChangeAbortIsReady(c *check.C) {
 	})
 }
 
+func (s *apiSuite) TestStateChangeAbortLanes(c *check.C) {
+	restore := FakeStateEnsureBefore(func(st *state.State, d time.Duration) {})
+	defer restore()
+
+	d := s.daemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.NewChange("update", "update...")
+	t1 := st.NewTask("download", "1...")
+	t1.JoinLane(1)
+	t2 := st.NewTask("download", "2...")
+	t2.JoinLane(2)
+	t3 := st.NewTask("activate", "3...")
+	t3.WaitFor(t2)
+	t3.JoinLane(2)
+	chg.AddAll(state.NewTaskSet(t1, t2, t3))
+	st.Unlock()
+	s.vars = map[string]string{"id": chg.ID()}
+
+	req, err := http.NewRequest("POST", "/v1/changes/"+chg.ID(), bytes.NewBufferString(`{"action": "abort-lanes", "lanes": [2]}`))
+	c.Assert(err, check.IsNil)
+	rsp := v1PostChange(apiCmd("/v1/changes/{id}"), req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+
+	info := rsp.Result.(*changeInfo)
+	c.Assert(info.Ready, check.Equals, false)
+	c.Assert(info.Tasks, check.HasLen, 3)
+	c.Check(info.Tasks[0].Status, check.Equals, "Do")
+	c.Check(info.Tasks[0].Lanes, check.DeepEquals, []int{1})
+	c.Check(info.Tasks[1].Status, check.Equals, "Hold")
+	c.Check(info.Tasks[1].Lanes, check.DeepEquals, []int{2})
+	c.Check(info.Tasks[2].Status, check.Equals, "Hold")
+	c.Check(info.Tasks[2].Lanes, check.DeepEquals, []int{2})
+}
+
+func (s *apiSuite) TestStateChangeAbortLanesErrors(c *check.C) {
+	d := s.daemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	ids := setupChanges(st)
+	st.Unlock()
+	s.vars = map[string]string{"id": ids[0]}
+
+	tests := []struct {
+		payload string
+		message string
+	}{
+		{`{"action": "abort-lanes"}`, `no lanes to abort provided`},
+		{`{"action": "abort-lanes", "lanes": [0, 3]}`, `cannot find lane 3 in change ` + ids[0]},
+		{`{"action": "abort", "lanes": [0]}`, `lanes are only valid with action "abort-lanes"`},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/v1/changes/"+ids[0], bytes.NewBufferString(test.payload))
+		c.Assert(err, check.IsNil)
+		rsp := v1PostChange(apiCmd("/v1/changes/{id}"), req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, 400)
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, test.message)
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	c.Assert(st.Change(ids[0]).Status(), check.Equals, state.DoStatus)
+}
+
+func (s *apiSuite) TestStateChangeInternalError(c *check.C) {
+	d := s.daemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	ids := setupChanges(st)
+	chg := st.NewChange("install", "install...")
+	t1 := st.NewTask("download", "1...")
+	t2 := st.NewTask("activate", "2...")
+	chg.AddAll(state.NewTaskSet(t1, t2))
+	t1.SetStatus(state.HoldStatus)
+	t2.SetStatus(state.ErrorStatus)
+	t2.Errorf("internal error: task handler panicked: boom")
+	// As set by the task runner when the handler panics.
+	t2.Set("internal-error", true)
+	st.Unlock()
+
+	get := func(id string) *changeInfo {
+		s.vars = map[string]string{"id": id}
+		req, err := http.NewRequest("GET", "/v1/changes/"+id, nil)
+		c.Assert(err, check.IsNil)
+		rsp := v1GetChange(apiCmd("/v1/changes/{id}"), req, nil).(*resp)
+		c.Assert(rsp.Status, check.Equals, 200)
+		return rsp.Result.(*changeInfo)
+	}
+
+	info := get(chg.ID())
+	c.Check(info.Status, check.Equals, "InternalError")
+	c.Check(info.Ready, check.Equals, true)
+	c.Check(info.Err, check.Matches, `(?s).*internal error: task handler panicked: boom.*`)
+	c.Check(info.Tasks[0].Status, check.Equals, "Hold")
+	c.Check(info.Tasks[1].Status, check.Equals, "InternalError")
+
+	// Other failed changes are still in the plain error status.
+	info = get(ids[1])
+	c.Check(info.Status, check.Equals, "Error")
+	c.Check(info.Tasks[0].Status, check.Equals, "Error")
+}
+
 func (s *apiSuite) TestWaitChangeNotFound(c *check.C) {
 	s.daemon(c)
 	req, err := http.NewRequest("GET", "/v1/changes/x/wait", nil)
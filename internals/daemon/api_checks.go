@@ -23,12 +23,14 @@ import (
 )
 
 type checkInfo struct {
-	Name      string `json:"name"`
-	Level     string `json:"level,omitempty"`
-	Status    string `json:"status"`
-	Failures  int    `json:"failures,omitempty"`
-	Threshold int    `json:"threshold"`
-	ChangeID  string `json:"change-id,omitempty"`
+	Name        string `json:"name"`
+	Level       string `json:"level,omitempty"`
+	Status      string `json:"status"`
+	Failures    int    `json:"failures,omitempty"`
+	Threshold   int    `json:"threshold"`
+	ChangeID    string `json:"change-id,omitempty"`
+	Skipped     int    `json:"skipped,omitempty"`
+	Overlapping int    `json:"overlapping,omitempty"`
 }
 
 func v1GetChecks(c *Command, r *http.Request, _ *UserState) Response {
@@ -54,12 +56,14 @@ func v1GetChecks(c *Command, r *http.Request, _ *UserState) Response {
 		namesMatch := len(names) == 0 || strutil.ListContains(names, check.Name)
 		if levelMatch && namesMatch {
 			info := checkInfo{
-				Name:      check.Name,
-				Level:     string(check.Level),
-				Status:    string(check.Status),
-				Failures:  check.Failures,
-				Threshold: check.Threshold,
-				ChangeID:  check.ChangeID,
+				Name:        check.Name,
+				Level:       string(check.Level),
+				Status:      string(check.Status),
+				Failures:    check.Failures,
+				Threshold:   check.Threshold,
+				ChangeID:    check.ChangeID,
+				Skipped:     check.Skipped,
+				Overlapping: check.Overlapping,
 			}
 			infos = append(infos, info)
 		}
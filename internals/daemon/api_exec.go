@@ -41,6 +41,7 @@ type execPayload struct {
 	SplitStderr    bool              `json:"split-stderr"`
 	Width          int               `json:"width"`
 	Height         int               `json:"height"`
+	Record         bool              `json:"record"`
 }
 
 func v1PostExec(c *Command, req *http.Request, _ *UserState) Response {
@@ -100,6 +101,7 @@ func v1PostExec(c *Command, req *http.Request, _ *UserState) Response {
 		SplitStderr: payload.SplitStderr,
 		Width:       payload.Width,
 		Height:      payload.Height,
+		Record:      payload.Record,
 	}
 	task, metadata, err := cmdstate.Exec(st, args)
 	if err != nil {
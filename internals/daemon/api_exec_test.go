@@ -110,6 +110,53 @@ func (s *execSuite) TestCombinedStderr(c *C) {
 	c.Check(outBuf.String(), Equals, "OUT\nERR!\n")
 }
 
+func (s *execSuite) TestRecord(c *C) {
+	outBuf := &bytes.Buffer{}
+	errBuf := &bytes.Buffer{}
+	process, err := s.client.Exec(&client.ExecOptions{
+		Command: []string{"/bin/sh", "-c", "cat; echo ERR! >&2; exit 3"},
+		Stdin:   strings.NewReader("foo bar"),
+		Stdout:  outBuf,
+		Stderr:  errBuf,
+		Record:  true,
+	})
+	c.Assert(err, IsNil)
+	waitErr := process.Wait()
+	c.Assert(waitErr, ErrorMatches, "exit status 3")
+
+	events, err := s.client.ExecTranscript(process.TaskID())
+	c.Assert(err, IsNil)
+	c.Assert(len(events) >= 2, Equals, true)
+	c.Check(events[0].Type, Equals, "start")
+	c.Check(events[0].Command, DeepEquals, []string{"/bin/sh", "-c", "cat; echo ERR! >&2; exit 3"})
+	last := events[len(events)-1]
+	c.Check(last.Type, Equals, "exit")
+	c.Assert(last.ExitCode, NotNil)
+	c.Check(*last.ExitCode, Equals, 3)
+
+	data := make(map[string]string)
+	for _, event := range events {
+		data[event.Type] += string(event.Data)
+	}
+	c.Check(data["stdin"], Equals, "foo bar")
+	c.Check(data["stdout"], Equals, "foo bar")
+	c.Check(data["stderr"], Equals, "ERR!\n")
+}
+
+func (s *execSuite) TestTranscriptNotRecorded(c *C) {
+	process, err := s.client.Exec(&client.ExecOptions{
+		Command: []string{"true"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(process.Wait(), IsNil)
+
+	_, err = s.client.ExecTranscript(process.TaskID())
+	c.Assert(err, ErrorMatches, `exec task ".*" was not recorded`)
+
+	_, err = s.client.ExecTranscript("42")
+	c.Assert(err, ErrorMatches, `cannot find task with id "42"`)
+}
+
 func (s *execSuite) TestEnvironment(c *C) {
 	stdout, stderr, waitErr := s.exec(c, "", &client.ExecOptions{
 		Command:     []string{"/bin/sh", "-c", "echo FOO=$FOO"},
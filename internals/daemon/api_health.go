@@ -26,7 +26,18 @@ import (
 )
 
 type healthInfo struct {
-	Healthy bool `json:"healthy"`
+	Healthy bool              `json:"healthy"`
+	Checks  []healthCheckInfo `json:"checks,omitempty"`
+}
+
+// healthCheckInfo is the status of one of the checks that the health
+// result was computed from.
+type healthCheckInfo struct {
+	Name      string `json:"name"`
+	Level     string `json:"level,omitempty"`
+	Status    string `json:"status"`
+	Failures  int    `json:"failures,omitempty"`
+	Threshold int    `json:"threshold"`
 }
 
 func v1Health(c *Command, r *http.Request, _ *UserState) Response {
@@ -46,23 +57,33 @@ func v1Health(c *Command, r *http.Request, _ *UserState) Response {
 		return healthError(http.StatusInternalServerError, "internal server error")
 	}
 
-	healthy := true
+	info := healthInfo{Healthy: true}
 	status := http.StatusOK
 	for _, check := range checks {
 		levelMatch := level == plan.UnsetLevel || level == check.Level ||
 			level == plan.ReadyLevel && check.Level == plan.AliveLevel // ready implies alive
 		namesMatch := len(names) == 0 || strutil.ListContains(names, check.Name)
-		if levelMatch && namesMatch && check.Status != checkstate.CheckStatusUp {
-			healthy = false
+		if !levelMatch || !namesMatch {
+			continue
+		}
+		if check.Status != checkstate.CheckStatusUp {
+			info.Healthy = false
 			status = http.StatusBadGateway
 		}
+		info.Checks = append(info.Checks, healthCheckInfo{
+			Name:      check.Name,
+			Level:     string(check.Level),
+			Status:    string(check.Status),
+			Failures:  check.Failures,
+			Threshold: check.Threshold,
+		})
 	}
 
 	return SyncResponse(&healthResp{
 		Type:       ResponseTypeSync,
 		Status:     status,
 		StatusText: http.StatusText(status),
-		Result:     healthInfo{Healthy: healthy},
+		Result:     info,
 	})
 }
 
@@ -63,6 +63,10 @@ func (s *healthSuite) TestHealthy(c *C) {
 	c.Assert(status, Equals, 200)
 	c.Assert(response, DeepEquals, map[string]interface{}{
 		"healthy": true,
+		"checks": []interface{}{
+			map[string]interface{}{"name": "chk1", "status": "up", "threshold": 0.0},
+			map[string]interface{}{"name": "chk2", "status": "up", "threshold": 0.0},
+		},
 	})
 }
 
@@ -70,7 +74,7 @@ func (s *healthSuite) TestUnhealthy(c *C) {
 	restore := FakeGetChecks(func(o *overlord.Overlord) ([]*checkstate.CheckInfo, error) {
 		return []*checkstate.CheckInfo{
 			{Name: "chk1", Status: checkstate.CheckStatusUp},
-			{Name: "chk2", Status: checkstate.CheckStatusDown},
+			{Name: "chk2", Level: plan.ReadyLevel, Status: checkstate.CheckStatusDown, Failures: 3, Threshold: 3},
 			{Name: "chk3", Status: checkstate.CheckStatusUp},
 		}, nil
 	})
@@ -81,6 +85,11 @@ func (s *healthSuite) TestUnhealthy(c *C) {
 	c.Assert(status, Equals, 502)
 	c.Assert(response, DeepEquals, map[string]interface{}{
 		"healthy": false,
+		"checks": []interface{}{
+			map[string]interface{}{"name": "chk1", "status": "up", "threshold": 0.0},
+			map[string]interface{}{"name": "chk2", "level": "ready", "status": "down", "failures": 3.0, "threshold": 3.0},
+			map[string]interface{}{"name": "chk3", "status": "up", "threshold": 0.0},
+		},
 	})
 }
 
@@ -126,21 +135,26 @@ func (s *healthSuite) TestLevel(c *C) {
 			defer restore()
 
 			status, response := serveHealth(c, "GET", "/v1/health?level=alive", nil)
+			if test.aliveCheck != "" {
+				c.Check(healthCheckNames(response), DeepEquals, []string{"a"})
+			} else {
+				c.Check(healthCheckNames(response), IsNil)
+			}
 			if test.aliveHealthy {
 				c.Check(status, Equals, 200)
-				c.Check(response, DeepEquals, map[string]interface{}{"healthy": true})
+				c.Check(response["healthy"], Equals, true)
 			} else {
 				c.Check(status, Equals, 502)
-				c.Check(response, DeepEquals, map[string]interface{}{"healthy": false})
+				c.Check(response["healthy"], Equals, false)
 			}
 
 			status, response = serveHealth(c, "GET", "/v1/health?level=ready", nil)
 			if test.readyHealthy {
 				c.Check(status, Equals, 200)
-				c.Check(response, DeepEquals, map[string]interface{}{"healthy": true})
+				c.Check(response["healthy"], Equals, true)
 			} else {
 				c.Check(status, Equals, 502)
-				c.Check(response, DeepEquals, map[string]interface{}{"healthy": false})
+				c.Check(response["healthy"], Equals, false)
 			}
 		}()
 	}
@@ -158,27 +172,33 @@ func (s *healthSuite) TestNames(c *C) {
 
 	status, response := serveHealth(c, "GET", "/v1/health?names=chk1&names=chk3", nil)
 	c.Assert(status, Equals, 502)
-	c.Assert(response, DeepEquals, map[string]interface{}{
-		"healthy": false,
-	})
+	c.Assert(response["healthy"], Equals, false)
+	c.Assert(healthCheckNames(response), DeepEquals, []string{"chk1", "chk3"})
 
 	status, response = serveHealth(c, "GET", "/v1/health?names=chk1,chk3", nil)
 	c.Assert(status, Equals, 502)
-	c.Assert(response, DeepEquals, map[string]interface{}{
-		"healthy": false,
-	})
+	c.Assert(response["healthy"], Equals, false)
+	c.Assert(healthCheckNames(response), DeepEquals, []string{"chk1", "chk3"})
 
 	status, response = serveHealth(c, "GET", "/v1/health?names=chk2", nil)
 	c.Assert(status, Equals, 200)
-	c.Assert(response, DeepEquals, map[string]interface{}{
-		"healthy": true,
-	})
+	c.Assert(response["healthy"], Equals, true)
+	c.Assert(healthCheckNames(response), DeepEquals, []string{"chk2"})
 
 	status, response = serveHealth(c, "GET", "/v1/health?names=chk3", nil)
 	c.Assert(status, Equals, 200)
-	c.Assert(response, DeepEquals, map[string]interface{}{
-		"healthy": true,
-	})
+	c.Assert(response["healthy"], Equals, true)
+	c.Assert(healthCheckNames(response), DeepEquals, []string{"chk3"})
+}
+
+// healthCheckNames returns the names of the checks in a health response.
+func healthCheckNames(response map[string]interface{}) []string {
+	var names []string
+	checks, _ := response["checks"].([]interface{})
+	for _, check := range checks {
+		names = append(names, check.(map[string]interface{})["name"].(string))
+	}
+	return names
 }
 
 func (s *healthSuite) TestBadLevel(c *C) {
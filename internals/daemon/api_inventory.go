@@ -0,0 +1,31 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/canonical/pebble/internals/overlord"
+	"github.com/canonical/pebble/internals/overlord/inventorystate"
+)
+
+var getInventory = func(o *overlord.Overlord) *inventorystate.Inventory {
+	return o.InventoryManager().Inventory()
+}
+
+// v1GetInventory returns the hardware facts collected at startup.
+func v1GetInventory(c *Command, r *http.Request, _ *UserState) Response {
+	return SyncResponse(getInventory(c.d.overlord))
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord"
+	"github.com/canonical/pebble/internals/overlord/inventorystate"
+)
+
+var _ = Suite(&inventorySuite{})
+
+type inventorySuite struct{}
+
+func (s *inventorySuite) TestInventory(c *C) {
+	restore := FakeGetInventory(func(o *overlord.Overlord) *inventorystate.Inventory {
+		return &inventorystate.Inventory{
+			Vendor: "ACME",
+			Model:  "Gateway 3000",
+			Serial: "SN-1234",
+			CPU:    inventorystate.CPU{Model: "Cortex-A72", Count: 4},
+			Memory: 4 * 1024 * 1024 * 1024,
+			Storage: []inventorystate.Disk{
+				{Name: "mmcblk0", Size: 32000000000, Removable: true},
+			},
+			Network: []inventorystate.NetworkInterface{
+				{Name: "eth0", MAC: "00:11:22:33:44:55"},
+			},
+		}
+	})
+	defer restore()
+
+	request, err := http.NewRequest("GET", "/v1/inventory", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	rsp := v1GetInventory(&Command{d: &Daemon{}}, request, nil)
+	rsp.ServeHTTP(recorder, request)
+
+	c.Assert(recorder.Code, Equals, 200)
+	var body map[string]interface{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &body)
+	c.Assert(err, IsNil)
+	c.Assert(body["result"], DeepEquals, map[string]interface{}{
+		"vendor": "ACME",
+		"model":  "Gateway 3000",
+		"serial": "SN-1234",
+		"cpu": map[string]interface{}{
+			"model": "Cortex-A72",
+			"count": 4.0,
+		},
+		"memory": 4294967296.0,
+		"storage": []interface{}{
+			map[string]interface{}{"name": "mmcblk0", "size": 32000000000.0, "removable": true},
+		},
+		"network": []interface{}{
+			map[string]interface{}{"name": "eth0", "mac": "00:11:22:33:44:55"},
+		},
+	})
+}
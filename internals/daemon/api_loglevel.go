@@ -0,0 +1,49 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/canonical/pebble/internals/logger"
+)
+
+type logLevelInfo struct {
+	Level string `json:"level"`
+}
+
+// v1GetLogLevel returns the minimum level of messages in the daemon's log.
+func v1GetLogLevel(c *Command, r *http.Request, _ *UserState) Response {
+	return SyncResponse(logLevelInfo{Level: logger.GetLevel().String()})
+}
+
+// v1PostLogLevel changes the minimum level of messages in the daemon's log,
+// for example to enable debug logging on a live system. The setting isn't
+// persisted, so the default applies again after a restart.
+func v1PostLogLevel(c *Command, r *http.Request, _ *UserState) Response {
+	var payload logLevelInfo
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		return BadRequest("cannot decode request body: %v", err)
+	}
+	level, err := logger.ParseLevel(payload.Level)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+	logger.SetLevel(level)
+	logger.Noticef("Log level set to %q", level)
+	return SyncResponse(logLevelInfo{Level: level.String()})
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/logger"
+)
+
+func (s *apiSuite) TestLogLevel(c *check.C) {
+	restore := logger.MockLevel(logger.NoticeLevel)
+	defer restore()
+
+	serve := func(method, body string) (int, map[string]any) {
+		cmd := apiCmd("/v1/debug/log-level")
+		req, err := http.NewRequest(method, "/v1/debug/log-level", bytes.NewBufferString(body))
+		c.Assert(err, check.IsNil)
+		rec := httptest.NewRecorder()
+		if method == "GET" {
+			v1GetLogLevel(cmd, req, nil).ServeHTTP(rec, req)
+		} else {
+			v1PostLogLevel(cmd, req, nil).ServeHTTP(rec, req)
+		}
+		var rsp map[string]any
+		c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
+		return rec.Code, rsp
+	}
+
+	code, rsp := serve("GET", "")
+	c.Assert(code, check.Equals, 200)
+	c.Check(rsp["result"], check.DeepEquals, map[string]any{"level": "notice"})
+
+	code, rsp = serve("POST", `{"level": "debug"}`)
+	c.Assert(code, check.Equals, 200)
+	c.Check(rsp["result"], check.DeepEquals, map[string]any{"level": "debug"})
+	c.Check(logger.GetLevel(), check.Equals, logger.DebugLevel)
+
+	code, rsp = serve("POST", `{"level": "verbose"}`)
+	c.Assert(code, check.Equals, 400)
+	c.Check(rsp["result"].(map[string]any)["message"], check.Matches, `invalid log level "verbose".*`)
+	c.Check(logger.GetLevel(), check.Equals, logger.DebugLevel)
+}
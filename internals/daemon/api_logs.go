@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -83,6 +84,36 @@ func (r logsResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		numLogs = defaultNumLogs
 	}
 
+	var filter servicelog.Filter
+	for _, param := range []struct {
+		name string
+		time *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			response := BadRequest("%s must be a time in RFC 3339 format", param.name)
+			response.ServeHTTP(w, req)
+			return
+		}
+		*param.time = t
+	}
+	if grep := query.Get("grep"); grep != "" {
+		pattern, err := regexp.Compile(grep)
+		if err != nil {
+			response := BadRequest("invalid grep pattern: %v", err)
+			response.ServeHTTP(w, req)
+			return
+		}
+		filter.Pattern = pattern
+	}
+
 	// If "services" parameter not specified, fetch logs for all services.
 	if len(services) == 0 {
 		infos, err := r.svcMgr.Services(nil)
@@ -97,7 +128,13 @@ func (r logsResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	itsByName, err := r.svcMgr.ServiceLogs(services, numLogs)
+	// When filtering, the most recent "n" logs that match may be anywhere
+	// in the buffer, so read all of it and let the FIFO keep the last "n".
+	last := numLogs
+	if !filter.IsZero() && numLogs > 0 {
+		last = -1
+	}
+	itsByName, err := r.svcMgr.ServiceLogs(services, last)
 	if err != nil {
 		response := InternalError("cannot fetch log iterators: %v", err)
 		response.ServeHTTP(w, req)
@@ -141,7 +178,7 @@ func (r logsResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	ctx, cancel := context.WithCancel(req.Context())
 	defer cancel()
 	go func() {
-		errorChan <- streamLogs(itsByName, logs, ctx.Done())
+		errorChan <- streamLogs(itsByName, &filter, logs, ctx.Done())
 	}()
 
 	// Main loop: output earliest log per iteration. Stop when request
@@ -194,7 +231,10 @@ func (r logsResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			}
 
 		case err := <-errorChan:
-			logger.Noticef("%s", err)
+			// A nil error means that no more logs can match the filter.
+			if err != nil {
+				logger.Noticef("%s", err)
+			}
 			return
 
 		case <-req.Context().Done():
@@ -204,9 +244,10 @@ func (r logsResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 // streamLogs reads and parses logs from the given services, merging the
-// log streams and ordering by timestamp. It sends the parsed logs to the
-// logs channel, and returns when the done channel is closed.
-func streamLogs(itsByName map[string]servicelog.Iterator, logs chan<- servicelog.Entry, done <-chan struct{}) error {
+// log streams and ordering by timestamp. It sends the parsed logs that match
+// the filter to the logs channel, and returns when the done channel is
+// closed, or when no more logs can match the filter.
+func streamLogs(itsByName map[string]servicelog.Iterator, filter *servicelog.Filter, logs chan<- servicelog.Entry, done <-chan struct{}) error {
 	// Need to close iterators in same goroutine we're reading them from.
 	defer func() {
 		for _, it := range itsByName {
@@ -237,24 +278,32 @@ func streamLogs(itsByName map[string]servicelog.Iterator, logs chan<- servicelog
 		parsers[i] = servicelog.NewParser(iterators[i], logReaderSize)
 	}
 
-	// Slice of next entries for each service
+	// Slice of next entries for each service, and whether each service has
+	// gone past the end of the filter's time range.
 	nexts := make([]servicelog.Entry, len(services))
+	finished := make([]bool, len(services))
 
 	// Main loop: output earliest log per iteration. Stop when done is closed.
 	for {
 		// Try to fetch next log from each service (parser/iterator combo).
+		// Skip logs that don't match the filter.
 		for i, parser := range parsers {
-			if !nexts[i].Time.IsZero() {
-				continue
-			}
-			if parser.Next() {
-				nexts[i] = parser.Entry()
-			} else if parser.Err() != nil {
-				return fmt.Errorf("error parsing logs: %w", parser.Err())
-			} else if iterators[i].Next(nil) {
-				// Parsed all in parser buffer, but iterator now has more.
+			for !finished[i] && nexts[i].Time.IsZero() {
+				var entry servicelog.Entry
 				if parser.Next() {
-					nexts[i] = parser.Entry()
+					entry = parser.Entry()
+				} else if parser.Err() != nil {
+					return fmt.Errorf("error parsing logs: %w", parser.Err())
+				} else if iterators[i].Next(nil) && parser.Next() {
+					// Parsed all in parser buffer, but iterator now has more.
+					entry = parser.Entry()
+				} else {
+					break
+				}
+				if filter.After(entry) {
+					finished[i] = true
+				} else if filter.Match(entry) {
+					nexts[i] = entry
 				}
 			}
 		}
@@ -278,6 +327,9 @@ func streamLogs(itsByName map[string]servicelog.Iterator, logs chan<- servicelog
 			case <-done:
 				return nil
 			}
+			if allFinished(finished) {
+				return nil
+			}
 			select {
 			case <-notification:
 			case <-done:
@@ -296,6 +348,15 @@ func streamLogs(itsByName map[string]servicelog.Iterator, logs chan<- servicelog
 	}
 }
 
+func allFinished(finished []bool) bool {
+	for _, f := range finished {
+		if !f {
+			return false
+		}
+	}
+	return true
+}
+
 // Each log is written as a JSON object followed by a newline (JSON Lines):
 //
 // {"time":"2021-04-23T01:28:52.660Z","service":"redis","message":"redis started up"}
@@ -102,6 +102,20 @@ func (s *logsSuite) TestInvalidN(c *C) {
 	checkError(c, rec.Body.Bytes(), http.StatusBadRequest, `n must be -1, 0, or a positive integer`)
 }
 
+func (s *logsSuite) TestInvalidFilters(c *C) {
+	rec := s.recordResponse(c, "/v1/logs?since=yesterday", nil)
+	c.Assert(rec.Code, Equals, http.StatusBadRequest)
+	checkError(c, rec.Body.Bytes(), http.StatusBadRequest, `since must be a time in RFC 3339 format`)
+
+	rec = s.recordResponse(c, "/v1/logs?until=2024-05-01", nil)
+	c.Assert(rec.Code, Equals, http.StatusBadRequest)
+	checkError(c, rec.Body.Bytes(), http.StatusBadRequest, `until must be a time in RFC 3339 format`)
+
+	rec = s.recordResponse(c, "/v1/logs?grep=(", nil)
+	c.Assert(rec.Code, Equals, http.StatusBadRequest)
+	checkError(c, rec.Body.Bytes(), http.StatusBadRequest, `invalid grep pattern: .*`)
+}
+
 func (s *logsSuite) TestServicesError(c *C) {
 	svcMgr := testServiceManager{
 		servicesErr: fmt.Errorf("Services error!"),
@@ -312,6 +326,78 @@ func (s *logsSuite) TestMultipleServicesNFewLogs(c *C) {
 	checkLog(c, logs[1], "two", "message2 1")
 }
 
+// writeTimedLogs writes a log for each minute from 12:00 to 12:09 on
+// 2024-05-01 to a new buffer for the service, with odd minutes logging an
+// error.
+func writeTimedLogs(c *C, service string) *servicelog.RingBuffer {
+	rb := servicelog.NewRingBuffer(4096)
+	for i := 0; i < 10; i++ {
+		message := "ok"
+		if i%2 == 1 {
+			message = "error"
+		}
+		_, err := fmt.Fprintf(rb, "2024-05-01T12:%02d:00.000Z [%s] %s %d\n", i, service, message, i)
+		c.Assert(err, IsNil)
+	}
+	return rb
+}
+
+func (s *logsSuite) TestSinceUntil(c *C) {
+	svcMgr := testServiceManager{
+		buffers: map[string]*servicelog.RingBuffer{
+			"nginx": writeTimedLogs(c, "nginx"),
+			"redis": writeTimedLogs(c, "redis"),
+		},
+	}
+	rec := s.recordResponse(c, "/v1/logs?services=nginx&since=2024-05-01T12:03:00Z&until=2024-05-01T12:05:00Z", svcMgr)
+	c.Assert(rec.Code, Equals, http.StatusOK)
+
+	logs := decodeLogs(c, rec.Body)
+	c.Assert(logs, HasLen, 3)
+	checkLog(c, logs[0], "nginx", "error 3")
+	checkLog(c, logs[1], "nginx", "ok 4")
+	checkLog(c, logs[2], "nginx", "error 5")
+}
+
+func (s *logsSuite) TestGrep(c *C) {
+	svcMgr := testServiceManager{
+		buffers: map[string]*servicelog.RingBuffer{
+			"nginx": writeTimedLogs(c, "nginx"),
+			"redis": writeTimedLogs(c, "redis"),
+		},
+	}
+
+	// The last "n" matching logs are returned, even though they're not
+	// within the last "n" logs of the buffer.
+	rec := s.recordResponse(c, "/v1/logs?grep=^error+[13]$&n=3", svcMgr)
+	c.Assert(rec.Code, Equals, http.StatusOK)
+
+	logs := decodeLogs(c, rec.Body)
+	c.Assert(logs, HasLen, 3)
+	checkLog(c, logs[0], "redis", "error 1")
+	checkLog(c, logs[1], "nginx", "error 3")
+	checkLog(c, logs[2], "redis", "error 3")
+	c.Check(logs[0].Time.Equal(logs[1].Time.Add(-2*time.Minute)), Equals, true)
+}
+
+func (s *logsSuite) TestUntilFollow(c *C) {
+	svcMgr := testServiceManager{
+		buffers: map[string]*servicelog.RingBuffer{
+			"nginx": writeTimedLogs(c, "nginx"),
+		},
+	}
+
+	// With an end time in the past, following stops once the buffered logs
+	// have been sent, as no new logs can match.
+	rec := s.recordResponse(c, "/v1/logs?follow=true&n=-1&until=2024-05-01T12:01:00Z", svcMgr)
+	c.Assert(rec.Code, Equals, http.StatusOK)
+
+	logs := decodeLogs(c, rec.Body)
+	c.Assert(logs, HasLen, 2)
+	checkLog(c, logs[0], "nginx", "ok 0")
+	checkLog(c, logs[1], "nginx", "error 1")
+}
+
 func (s *logsSuite) TestLoggingTooFast(c *C) {
 	rb := servicelog.NewRingBuffer(1024)
 	lw := servicelog.NewFormatWriter(rb, "svc")
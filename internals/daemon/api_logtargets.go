@@ -0,0 +1,80 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/canonical/x-go/strutil"
+
+	"github.com/canonical/pebble/internals/overlord"
+	"github.com/canonical/pebble/internals/overlord/logstate"
+)
+
+type logTargetInfo struct {
+	Name                string     `json:"name"`
+	Status              string     `json:"status"`
+	LastSuccess         *time.Time `json:"last-success,omitempty"`
+	LastError           string     `json:"last-error,omitempty"`
+	FailingSince        *time.Time `json:"failing-since,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive-failures,omitempty"`
+	Buffered            int        `json:"buffered"`
+	Dropped             int        `json:"dropped"`
+}
+
+var getLogTargetStatus = func(o *overlord.Overlord) map[string]logstate.TargetStatus {
+	return o.LogManager().TargetStatus()
+}
+
+// v1GetLogTargets returns the delivery status of the log targets that logs
+// are being forwarded to, optionally filtered by name.
+func v1GetLogTargets(c *Command, r *http.Request, _ *UserState) Response {
+	names := strutil.MultiCommaSeparatedList(r.URL.Query()["names"])
+
+	statuses := getLogTargetStatus(c.d.overlord)
+	targetNames := make([]string, 0, len(statuses))
+	for name := range statuses {
+		if len(names) == 0 || strutil.ListContains(names, name) {
+			targetNames = append(targetNames, name)
+		}
+	}
+	sort.Strings(targetNames)
+
+	infos := []logTargetInfo{} // if no targets, return [] instead of null
+	for _, name := range targetNames {
+		status := statuses[name]
+		info := logTargetInfo{
+			Name:                name,
+			Status:              "active",
+			LastError:           status.LastError,
+			ConsecutiveFailures: status.ConsecutiveFailures,
+			Buffered:            status.Buffered,
+			Dropped:             status.Dropped,
+		}
+		if status.ConsecutiveFailures > 0 {
+			info.Status = "failing"
+			failingSince := status.FailingSince
+			info.FailingSince = &failingSince
+		}
+		if !status.LastSuccess.IsZero() {
+			lastSuccess := status.LastSuccess
+			info.LastSuccess = &lastSuccess
+		}
+		infos = append(infos, info)
+	}
+	return SyncResponse(infos)
+}
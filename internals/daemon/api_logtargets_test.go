@@ -0,0 +1,111 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord"
+	"github.com/canonical/pebble/internals/overlord/logstate"
+)
+
+var _ = Suite(&logTargetsSuite{})
+
+type logTargetsSuite struct {
+	restore func()
+}
+
+func (s *logTargetsSuite) SetUpTest(c *C) {
+	lastSuccess := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.restore = FakeGetLogTargetStatus(func(o *overlord.Overlord) map[string]logstate.TargetStatus {
+		return map[string]logstate.TargetStatus{
+			"staging": {
+				LastSuccess: lastSuccess,
+				Buffered:    3,
+			},
+			"production": {
+				LastSuccess:         lastSuccess,
+				LastError:           "server returned HTTP 503 Service Unavailable",
+				FailingSince:        lastSuccess.Add(time.Minute),
+				ConsecutiveFailures: 4,
+				Buffered:            100,
+				Dropped:             20,
+			},
+			"new": {},
+		}
+	})
+}
+
+func (s *logTargetsSuite) TearDownTest(c *C) {
+	s.restore()
+}
+
+func (s *logTargetsSuite) TestAll(c *C) {
+	result := serveLogTargets(c, "/v1/log-targets")
+	c.Check(result, DeepEquals, []interface{}{
+		map[string]interface{}{
+			"name":     "new",
+			"status":   "active",
+			"buffered": 0.0,
+			"dropped":  0.0,
+		},
+		map[string]interface{}{
+			"name":                 "production",
+			"status":               "failing",
+			"last-success":         "2024-05-01T12:00:00Z",
+			"last-error":           "server returned HTTP 503 Service Unavailable",
+			"failing-since":        "2024-05-01T12:01:00Z",
+			"consecutive-failures": 4.0,
+			"buffered":             100.0,
+			"dropped":              20.0,
+		},
+		map[string]interface{}{
+			"name":         "staging",
+			"status":       "active",
+			"last-success": "2024-05-01T12:00:00Z",
+			"buffered":     3.0,
+			"dropped":      0.0,
+		},
+	})
+}
+
+func (s *logTargetsSuite) TestNames(c *C) {
+	result := serveLogTargets(c, "/v1/log-targets?names=staging,nothere")
+	c.Check(result, HasLen, 1)
+	c.Check(result[0].(map[string]interface{})["name"], Equals, "staging")
+
+	result = serveLogTargets(c, "/v1/log-targets?names=nothere")
+	c.Check(result, HasLen, 0)
+}
+
+func serveLogTargets(c *C, url string) []interface{} {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, IsNil)
+
+	rsp := v1GetLogTargets(&Command{d: &Daemon{}}, request, nil)
+	rsp.ServeHTTP(recorder, request)
+
+	c.Assert(recorder.Code, Equals, 200)
+	var response map[string]interface{}
+	err = json.NewDecoder(recorder.Result().Body).Decode(&response)
+	c.Assert(err, IsNil)
+	return response["result"].([]interface{})
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/canonical/pebble/internals/overlord/servstate"
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+type maintenanceInfo struct {
+	Active   bool       `json:"active"`
+	Since    *time.Time `json:"since,omitempty"`
+	Services []string   `json:"services,omitempty"`
+}
+
+func newMaintenanceInfo(maintenance *servstate.Maintenance) *maintenanceInfo {
+	info := &maintenanceInfo{Active: maintenance != nil}
+	if maintenance != nil {
+		info.Since = &maintenance.Since
+		info.Services = maintenance.Services
+	}
+	return info
+}
+
+func v1GetMaintenance(c *Command, r *http.Request, _ *UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	maintenance, err := servstate.GetMaintenance(st)
+	if err != nil {
+		return InternalError("cannot get maintenance mode: %v", err)
+	}
+	return SyncResponse(newMaintenanceInfo(maintenance))
+}
+
+// v1PostMaintenance enters or exits maintenance mode. Entering it stops the
+// given services, or the running services not started by default, and
+// exiting it starts them again.
+func v1PostMaintenance(c *Command, r *http.Request, _ *UserState) Response {
+	var payload struct {
+		Action   string   `json:"action"`
+		Services []string `json:"services"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		return BadRequest("cannot decode data from request body: %v", err)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	servmgr := overlordServiceManager(c.d.overlord)
+	var taskSet *state.TaskSet
+	var services []string
+	var err error
+	switch payload.Action {
+	case "enter":
+		taskSet, services, err = servmgr.EnterMaintenance(payload.Services)
+	case "exit":
+		if len(payload.Services) != 0 {
+			return BadRequest("%s accepts no service names", payload.Action)
+		}
+		taskSet, services, err = servmgr.ExitMaintenance()
+	default:
+		return BadRequest("invalid maintenance action %q", payload.Action)
+	}
+	if err != nil {
+		return BadRequest("cannot %s maintenance mode: %v", payload.Action, err)
+	}
+
+	summary := fmt.Sprintf("%s maintenance mode", strings.Title(payload.Action))
+	change := st.NewChange("maintenance-"+payload.Action, summary)
+	if len(taskSet.Tasks()) == 0 {
+		// A change with no tasks needs to be marked Done manually (normally
+		// a change is marked Done when its last task is finished).
+		change.SetStatus(state.DoneStatus)
+		return AsyncResponse(nil, change.ID())
+	}
+	change.AddAll(taskSet)
+	change.Set("service-names", services)
+	stateEnsureBefore(st, 0)
+	return AsyncResponse(nil, change.ID())
+}
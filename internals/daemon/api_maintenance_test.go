@@ -0,0 +1,118 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+func (s *apiSuite) postMaintenance(c *C, body string) *resp {
+	cmd := apiCmd("/v1/maintenance-mode")
+	req, err := http.NewRequest("POST", "/v1/maintenance-mode", bytes.NewBufferString(body))
+	c.Assert(err, IsNil)
+	return cmd.POST(cmd, req, nil).(*resp)
+}
+
+func (s *apiSuite) getMaintenance(c *C) map[string]interface{} {
+	cmd := apiCmd("/v1/maintenance-mode")
+	req, err := http.NewRequest("GET", "/v1/maintenance-mode", nil)
+	c.Assert(err, IsNil)
+	rec := httptest.NewRecorder()
+	cmd.GET(cmd, req, nil).ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+	return rsp.Result.(map[string]interface{})
+}
+
+func (s *apiSuite) TestMaintenance(c *C) {
+	writeTestLayer(s.pebbleDir, servicesLayer)
+	d := s.daemon(c)
+	st := d.overlord.State()
+
+	restore := FakeStateEnsureBefore(func(st *state.State, d time.Duration) {})
+	defer restore()
+
+	c.Check(s.getMaintenance(c), DeepEquals, map[string]interface{}{"active": false})
+
+	// No services are running, so none are stopped.
+	rsp := s.postMaintenance(c, `{"action": "enter"}`)
+	c.Assert(rsp.Status, Equals, 202)
+	c.Check(rsp.Type, Equals, ResponseTypeAsync)
+	st.Lock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, NotNil)
+	c.Check(chg.Kind(), Equals, "maintenance-enter")
+	c.Check(chg.Summary(), Equals, "Enter maintenance mode")
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	st.Unlock()
+
+	info := s.getMaintenance(c)
+	c.Check(info["active"], Equals, true)
+	c.Check(info["since"], NotNil)
+
+	statusCmd := apiCmd("/v1/system-status")
+	rec := httptest.NewRecorder()
+	statusCmd.GET(statusCmd, nil, nil).ServeHTTP(rec, nil)
+	var status resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &status), IsNil)
+	c.Check(status.Result.(map[string]interface{})["maintenance-mode"], DeepEquals, info)
+
+	rsp = s.postMaintenance(c, `{"action": "enter"}`)
+	c.Check(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot enter maintenance mode: already in maintenance mode")
+
+	rsp = s.postMaintenance(c, `{"action": "exit"}`)
+	c.Assert(rsp.Status, Equals, 202)
+	st.Lock()
+	chg = st.Change(rsp.Change)
+	c.Assert(chg, NotNil)
+	c.Check(chg.Kind(), Equals, "maintenance-exit")
+	st.Unlock()
+	c.Check(s.getMaintenance(c), DeepEquals, map[string]interface{}{"active": false})
+
+	rsp = s.postMaintenance(c, `{"action": "exit"}`)
+	c.Check(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot exit maintenance mode: not in maintenance mode")
+}
+
+func (s *apiSuite) TestMaintenanceEnterUnknownService(c *C) {
+	writeTestLayer(s.pebbleDir, servicesLayer)
+	s.daemon(c)
+
+	rsp := s.postMaintenance(c, `{"action": "enter", "services": ["nope"]}`)
+	c.Check(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, `cannot enter maintenance mode: service "nope" does not exist`)
+}
+
+func (s *apiSuite) TestMaintenanceBadRequest(c *C) {
+	s.daemon(c)
+
+	rsp := s.postMaintenance(c, `{"action": "foo"}`)
+	c.Check(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, `invalid maintenance action "foo"`)
+
+	rsp = s.postMaintenance(c, `{"action": "exit", "services": ["foo"]}`)
+	c.Check(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "exit accepts no service names")
+}
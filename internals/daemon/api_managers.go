@@ -0,0 +1,68 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"time"
+)
+
+type managerHealthInfo struct {
+	Name          string     `json:"name"`
+	Ready         bool       `json:"ready"`
+	StartUpError  string     `json:"startup-error,omitempty"`
+	LastEnsure    *time.Time `json:"last-ensure,omitempty"`
+	EnsureError   string     `json:"ensure-error,omitempty"`
+	EnsuringSince *time.Time `json:"ensuring-since,omitempty"`
+}
+
+// v1GetManagers returns the health of the overlord's managers, so that a
+// manager that keeps failing or is stuck is visible.
+func v1GetManagers(c *Command, r *http.Request, _ *UserState) Response {
+	health := c.d.overlord.StateEngine().Health()
+	infos := make([]managerHealthInfo, len(health))
+	for i, h := range health {
+		info := managerHealthInfo{
+			Name:  h.Name,
+			Ready: h.Ready,
+		}
+		if h.StartUpErr != nil {
+			info.StartUpError = h.StartUpErr.Error()
+		}
+		if !h.LastEnsure.IsZero() {
+			lastEnsure := h.LastEnsure
+			info.LastEnsure = &lastEnsure
+		}
+		if h.EnsureErr != nil {
+			info.EnsureError = h.EnsureErr.Error()
+		}
+		if !h.EnsuringSince.IsZero() {
+			ensuringSince := h.EnsuringSince
+			info.EnsuringSince = &ensuringSince
+		}
+		infos[i] = info
+	}
+	return SyncResponse(infos)
+}
+
+// managersReady reports whether all the overlord's managers are ready.
+func managersReady(c *Command) bool {
+	for _, h := range c.d.overlord.StateEngine().Health() {
+		if !h.Ready {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"errors"
+	"net/http"
+
+	"gopkg.in/check.v1"
+)
+
+type failingManager struct{}
+
+func (failingManager) Ensure() error {
+	return errors.New("cannot ensure")
+}
+
+func (s *apiSuite) TestManagers(c *check.C) {
+	d := s.daemon(c)
+	// The overlord is already initialized, so add the manager to its state
+	// engine directly.
+	d.overlord.StateEngine().AddManager(failingManager{})
+	err := d.overlord.StateEngine().Ensure()
+	c.Assert(err, check.ErrorMatches, ".*cannot ensure.*")
+
+	cmd := apiCmd("/v1/managers")
+	req, err := http.NewRequest("GET", "/v1/managers", nil)
+	c.Assert(err, check.IsNil)
+	rsp, ok := v1GetManagers(cmd, req, nil).(*resp)
+	c.Assert(ok, check.Equals, true)
+	c.Check(rsp.Status, check.Equals, 200)
+
+	infos, ok := rsp.Result.([]managerHealthInfo)
+	c.Assert(ok, check.Equals, true)
+	names := make(map[string]managerHealthInfo)
+	for _, info := range infos {
+		c.Check(info.LastEnsure, check.NotNil)
+		c.Check(info.EnsuringSince, check.IsNil)
+		names[info.Name] = info
+	}
+	c.Check(names["servstate.ServiceManager"].Ready, check.Equals, true)
+	failing := names["daemon.failingManager"]
+	c.Check(failing.Ready, check.Equals, false)
+	c.Check(failing.EnsureError, check.Equals, "cannot ensure")
+
+	c.Check(managersReady(cmd), check.Equals, false)
+}
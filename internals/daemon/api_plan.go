@@ -15,33 +15,282 @@
 package daemon
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"reflect"
+	"strings"
 
+	"github.com/canonical/x-go/strutil"
 	"gopkg.in/yaml.v3"
 
+	"github.com/canonical/pebble/internals/bundle"
 	"github.com/canonical/pebble/internals/overlord/planstate"
 	"github.com/canonical/pebble/internals/plan"
 )
 
 func v1GetPlan(c *Command, r *http.Request, _ *UserState) Response {
 	format := r.URL.Query().Get("format")
-	if format != "yaml" {
+	if format != "yaml" && format != "json" && format != "systemd" {
 		return BadRequest("invalid format %q", format)
 	}
 
+	section := r.URL.Query().Get("section")
+	if section != "" {
+		if format == "systemd" {
+			return BadRequest("cannot select a plan section with format %q", format)
+		}
+		if !strutil.ListContains(plan.SectionNames(), section) {
+			return BadRequest("invalid section %q", section)
+		}
+	}
+
 	planMgr := overlordPlanManager(c.d.overlord)
-	plan := planMgr.Plan()
-	planYAML, err := yaml.Marshal(plan)
+	p := planMgr.Plan()
+	var planYAML []byte
+	var err error
+	if section != "" {
+		// Only include the requested section, like the full plan would,
+		// so that the ETag only changes when that section does.
+		content := p.Section(section)
+		if reflect.ValueOf(content).Len() > 0 {
+			planYAML, err = yaml.Marshal(map[string]interface{}{section: content})
+		} else {
+			planYAML, err = yaml.Marshal(map[string]interface{}{})
+		}
+	} else {
+		planYAML, err = yaml.Marshal(p)
+	}
 	if err != nil {
 		return InternalError("cannot serialize plan: %v", err)
 	}
-	return SyncResponse(string(planYAML))
+	etag := `"` + planHash(planYAML) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		return notModifiedResponse{etag: etag}
+	}
+
+	var result interface{}
+	switch format {
+	case "json":
+		// Convert via YAML so that field names and values are the same as
+		// in the YAML format.
+		var planJSON interface{}
+		err = yaml.Unmarshal(planYAML, &planJSON)
+		if err != nil {
+			return InternalError("cannot serialize plan: %v", err)
+		}
+		result = planJSON
+	case "systemd":
+		units, err := p.SystemdUnits()
+		if err != nil {
+			return InternalError("cannot convert plan to systemd units: %v", err)
+		}
+		result = units
+	default:
+		result = string(planYAML)
+	}
+	return &planResponse{
+		Response: SyncResponse(result),
+		etag:     etag,
+	}
+}
+
+// planHash returns a stable hash of the combined plan's YAML, suitable for
+// checking whether the plan has changed.
+func planHash(planYAML []byte) string {
+	sum := sha256.Sum256(planYAML)
+	return hex.EncodeToString(sum[:])
+}
+
+// planResponse is a response that also sets the ETag header to the plan's
+// hash, so that clients can make conditional requests.
+type planResponse struct {
+	Response
+	etag string
+}
+
+func (r *planResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("ETag", r.etag)
+	r.Response.ServeHTTP(w, req)
+}
+
+// notModifiedResponse tells the client that the plan it already has (as
+// given by the If-None-Match header) is still current.
+type notModifiedResponse struct {
+	etag string
+}
+
+func (r notModifiedResponse) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("ETag", r.etag)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+type layerInfo struct {
+	Order int    `json:"order"`
+	Label string `json:"label"`
+}
+
+func v1GetLayers(c *Command, r *http.Request, _ *UserState) Response {
+	planMgr := overlordPlanManager(c.d.overlord)
+	layers := planMgr.Plan().Layers
+	result := make([]layerInfo, len(layers))
+	for i, layer := range layers {
+		result[i] = layerInfo{Order: layer.Order, Label: layer.Label}
+	}
+	return SyncResponse(result)
 }
 
 func v1PostLayers(c *Command, r *http.Request, _ *UserState) Response {
 	var payload struct {
-		Action  string `json:"action"`
+		Action       string `json:"action"`
+		Combine      bool   `json:"combine"`
+		Label        string `json:"label"`
+		Format       string `json:"format"`
+		Layer        string `json:"layer"`
+		Signature    []byte `json:"signature"`
+		Order        *int   `json:"order"`
+		InsertBefore string `json:"insert-before"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		return BadRequest("cannot decode request body: %v", err)
+	}
+
+	switch payload.Action {
+	case "add", "validate", "remove", "move":
+	default:
+		return BadRequest("invalid action %q", payload.Action)
+	}
+	if payload.Label == "" {
+		return BadRequest("label must be set")
+	}
+	if payload.Order != nil && *payload.Order < 0 {
+		return BadRequest("order must not be negative")
+	}
+	if payload.Order != nil && *payload.Order >= planstate.BundleLayerOrder {
+		return BadRequest("order must be less than %d", planstate.BundleLayerOrder)
+	}
+	if payload.InsertBefore != "" && payload.Action != "add" && payload.Action != "validate" {
+		return BadRequest("insert-before is only valid when adding a layer")
+	}
+	if payload.Order != nil && payload.InsertBefore != "" {
+		return BadRequest("cannot specify both order and insert-before")
+	}
+
+	if c.d.requireSignedLayers && (payload.Action == "remove" || payload.Action == "move") {
+		return Forbidden("cannot %s layer: only signed layers may be added", payload.Action)
+	}
+
+	planMgr := overlordPlanManager(c.d.overlord)
+	var err error
+	switch payload.Action {
+	case "remove":
+		err = planMgr.RemoveLayer(payload.Label)
+	case "move":
+		if payload.Order == nil {
+			return BadRequest("order must be set")
+		}
+		err = planMgr.MoveLayer(payload.Label, *payload.Order)
+	default:
+		if payload.Format != "yaml" && payload.Format != "json" {
+			return BadRequest("invalid format %q", payload.Format)
+		}
+		if len(payload.Signature) > 0 || c.d.requireSignedLayers {
+			if rsp := checkLayerSignature(c.d.pebbleDir, &bundle.SignedLayerHeader{
+				Label:        payload.Label,
+				Combine:      payload.Combine,
+				Order:        payload.Order,
+				InsertBefore: payload.InsertBefore,
+			}, []byte(payload.Layer), payload.Signature); rsp != nil {
+				return rsp
+			}
+		}
+		// JSON is a subset of YAML, so both formats are parsed the same way.
+		layer, parseErr := plan.ParseLayer(0, payload.Label, []byte(payload.Layer))
+		if parseErr != nil {
+			return BadRequest("cannot parse layer %s: %v", strings.ToUpper(payload.Format), parseErr)
+		}
+		pos := planstate.LayerPosition{
+			Order:  payload.Order,
+			Before: payload.InsertBefore,
+		}
+		if payload.Action == "validate" {
+			// Check the layer as if it were being added, but leave the plan as is.
+			err = planMgr.ValidateLayer(layer, pos, payload.Combine)
+		} else {
+			err = planMgr.InsertLayer(layer, pos, payload.Combine)
+		}
+	}
+	if err != nil {
+		switch err.(type) {
+		case *planstate.LabelNotFound:
+			return NotFound("%v", err)
+		case *planstate.LabelExists, *planstate.OrderExists, *plan.FormatError:
+			return BadRequest("%v", err)
+		}
+		return InternalError("%v", err)
+	}
+	return SyncResponse(true)
+}
+
+// checkLayerSignature checks that signature is a signature of the layer
+// content, along with the header saying where it's being added, made by one
+// of the trusted keys, returning an error response if not.
+func checkLayerSignature(pebbleDir string, header *bundle.SignedLayerHeader, content, signature []byte) Response {
+	if len(signature) == 0 {
+		return Forbidden("cannot add layer: layer must be signed")
+	}
+	keys, err := bundle.ReadKeysDir(bundle.TrustedKeysDir(pebbleDir))
+	if err != nil {
+		return InternalError("%v", err)
+	}
+	data := bundle.SignedLayerData(header, content)
+	if !bundle.Verify(keys, data, signature) {
+		return Forbidden("cannot add layer: signature not made by a trusted key")
+	}
+	return nil
+}
+
+type planDiffItem struct {
+	Section string           `json:"section"`
+	Name    string           `json:"name"`
+	Action  string           `json:"action"`
+	Fields  []*planDiffField `json:"fields,omitempty"`
+}
+
+type planDiffField struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// v1GetPlanDiff returns the differences between the plan as it was when the
+// layer labelled "from" was the last layer, and the current plan.
+func v1GetPlanDiff(c *Command, r *http.Request, _ *UserState) Response {
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		return BadRequest(`"from" must be set`)
+	}
+
+	planMgr := overlordPlanManager(c.d.overlord)
+	fromPlan, err := planMgr.PlanAtLayer(from)
+	if err != nil {
+		if _, ok := err.(*planstate.LabelNotFound); ok {
+			return NotFound("%v", err)
+		}
+		if _, ok := err.(*plan.FormatError); ok {
+			return BadRequest("%v", err)
+		}
+		return InternalError("%v", err)
+	}
+	return planDiffResponse(fromPlan, planMgr.Plan())
+}
+
+// v1PostPlanDiff returns the differences between the current plan and the
+// plan that would result from adding the given layer.
+func v1PostPlanDiff(c *Command, r *http.Request, _ *UserState) Response {
+	var payload struct {
 		Combine bool   `json:"combine"`
 		Label   string `json:"label"`
 		Format  string `json:"format"`
@@ -52,26 +301,19 @@ func v1PostLayers(c *Command, r *http.Request, _ *UserState) Response {
 		return BadRequest("cannot decode request body: %v", err)
 	}
 
-	if payload.Action != "add" {
-		return BadRequest("invalid action %q", payload.Action)
-	}
 	if payload.Label == "" {
 		return BadRequest("label must be set")
 	}
-	if payload.Format != "yaml" {
+	if payload.Format != "yaml" && payload.Format != "json" {
 		return BadRequest("invalid format %q", payload.Format)
 	}
 	layer, err := plan.ParseLayer(0, payload.Label, []byte(payload.Layer))
 	if err != nil {
-		return BadRequest("cannot parse layer YAML: %v", err)
+		return BadRequest("cannot parse layer %s: %v", strings.ToUpper(payload.Format), err)
 	}
 
 	planMgr := overlordPlanManager(c.d.overlord)
-	if payload.Combine {
-		err = planMgr.CombineLayer(layer)
-	} else {
-		err = planMgr.AppendLayer(layer)
-	}
+	toPlan, err := planMgr.PlanWithLayer(layer, payload.Combine)
 	if err != nil {
 		if _, ok := err.(*planstate.LabelExists); ok {
 			return BadRequest("%v", err)
@@ -81,5 +323,29 @@ func v1PostLayers(c *Command, r *http.Request, _ *UserState) Response {
 		}
 		return InternalError("%v", err)
 	}
-	return SyncResponse(true)
+	return planDiffResponse(planMgr.Plan(), toPlan)
+}
+
+func planDiffResponse(from, to *plan.Plan) Response {
+	diffs, err := plan.Diff(from, to)
+	if err != nil {
+		return InternalError("cannot diff plans: %v", err)
+	}
+	items := make([]*planDiffItem, 0, len(diffs))
+	for _, diff := range diffs {
+		item := &planDiffItem{
+			Section: diff.Section,
+			Name:    diff.Name,
+			Action:  string(diff.Action),
+		}
+		for _, field := range diff.Fields {
+			item.Fields = append(item.Fields, &planDiffField{
+				Field: field.Field,
+				Old:   field.Old,
+				New:   field.New,
+			})
+		}
+		items = append(items, item)
+	}
+	return SyncResponse(items)
 }
@@ -0,0 +1,136 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/canonical/x-go/strutil"
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/internals/bundle"
+	"github.com/canonical/pebble/internals/overlord/planstate"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// v1GetPlanSection returns the content of a single section of the combined
+// plan, that is, its items without the enclosing section key.
+func v1GetPlanSection(c *Command, r *http.Request, _ *UserState) Response {
+	format := r.URL.Query().Get("format")
+	if format != "yaml" && format != "json" {
+		return BadRequest("invalid format %q", format)
+	}
+	name := muxVars(r)["name"]
+	if !strutil.ListContains(plan.SectionNames(), name) {
+		return NotFound("plan section %q not found", name)
+	}
+
+	planMgr := overlordPlanManager(c.d.overlord)
+	content := planMgr.Plan().Section(name)
+	if reflect.ValueOf(content).Len() == 0 {
+		content = map[string]interface{}{}
+	}
+	sectionYAML, err := yaml.Marshal(content)
+	if err != nil {
+		return InternalError("cannot serialize plan section: %v", err)
+	}
+	if format == "yaml" {
+		return SyncResponse(string(sectionYAML))
+	}
+	// Convert via YAML so that field names and values are the same as in
+	// the YAML format.
+	var sectionJSON interface{}
+	err = yaml.Unmarshal(sectionYAML, &sectionJSON)
+	if err != nil {
+		return InternalError("cannot serialize plan section: %v", err)
+	}
+	return SyncResponse(sectionJSON)
+}
+
+// v1PostPlanSection adds a layer containing only the given section content,
+// so that sections can be updated without building a whole layer.
+func v1PostPlanSection(c *Command, r *http.Request, _ *UserState) Response {
+	var payload struct {
+		Action    string `json:"action"`
+		Combine   bool   `json:"combine"`
+		Label     string `json:"label"`
+		Format    string `json:"format"`
+		Section   string `json:"section"`
+		Signature []byte `json:"signature"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		return BadRequest("cannot decode request body: %v", err)
+	}
+
+	name := muxVars(r)["name"]
+	if !strutil.ListContains(plan.SectionNames(), name) {
+		return NotFound("plan section %q not found", name)
+	}
+	if payload.Action != "add" && payload.Action != "validate" {
+		return BadRequest("invalid action %q", payload.Action)
+	}
+	if payload.Label == "" {
+		return BadRequest("label must be set")
+	}
+	if payload.Format != "yaml" && payload.Format != "json" {
+		return BadRequest("invalid format %q", payload.Format)
+	}
+	if len(payload.Signature) > 0 || c.d.requireSignedLayers {
+		if rsp := checkLayerSignature(c.d.pebbleDir, &bundle.SignedLayerHeader{
+			Section: name,
+			Label:   payload.Label,
+			Combine: payload.Combine,
+		}, []byte(payload.Section), payload.Signature); rsp != nil {
+			return rsp
+		}
+	}
+
+	// JSON is a subset of YAML, so both formats are parsed the same way.
+	var content yaml.Node
+	err := yaml.Unmarshal([]byte(payload.Section), &content)
+	if err != nil {
+		return BadRequest("cannot parse section %s: %v", strings.ToUpper(payload.Format), err)
+	}
+	if len(content.Content) == 0 {
+		return BadRequest("section must be set")
+	}
+	layerYAML, err := yaml.Marshal(map[string]*yaml.Node{name: content.Content[0]})
+	if err != nil {
+		return InternalError("cannot build layer: %v", err)
+	}
+	layer, err := plan.ParseLayer(0, payload.Label, layerYAML)
+	if err != nil {
+		return BadRequest("cannot parse section %s: %v", strings.ToUpper(payload.Format), err)
+	}
+
+	planMgr := overlordPlanManager(c.d.overlord)
+	if payload.Action == "validate" {
+		err = planMgr.ValidateLayer(layer, planstate.LayerPosition{}, payload.Combine)
+	} else {
+		err = planMgr.InsertLayer(layer, planstate.LayerPosition{}, payload.Combine)
+	}
+	if err != nil {
+		switch err.(type) {
+		case *planstate.LabelExists, *plan.FormatError:
+			return BadRequest("%v", err)
+		}
+		return InternalError("%v", err)
+	}
+	return SyncResponse(true)
+}
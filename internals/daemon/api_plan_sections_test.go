@@ -0,0 +1,223 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/bundle"
+)
+
+func (s *apiSuite) getPlanSection(c *C, name, format string) *resp {
+	s.vars = map[string]string{"name": name}
+	req, err := http.NewRequest("GET", "/v1/plan/sections/"+name+"?format="+format, nil)
+	c.Assert(err, IsNil)
+	rsp := v1GetPlanSection(apiCmd("/v1/plan/sections/{name}"), req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	return rsp
+}
+
+func (s *apiSuite) postPlanSection(c *C, name, payload string) *resp {
+	s.vars = map[string]string{"name": name}
+	req, err := http.NewRequest("POST", "/v1/plan/sections/"+name, bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostPlanSection(apiCmd("/v1/plan/sections/{name}"), req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	return rsp
+}
+
+func (s *apiSuite) TestGetPlanSectionContent(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+
+	rsp := s.getPlanSection(c, "services", "yaml")
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result.(string), Equals, `
+static:
+    override: replace
+    command: echo static
+`[1:])
+
+	rsp = s.getPlanSection(c, "services", "json")
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result, DeepEquals, map[string]interface{}{
+		"static": map[string]interface{}{
+			"override": "replace",
+			"command":  "echo static",
+		},
+	})
+
+	// An empty section gives an empty map.
+	rsp = s.getPlanSection(c, "checks", "yaml")
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result.(string), Equals, "{}\n")
+	rsp = s.getPlanSection(c, "checks", "json")
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result, DeepEquals, map[string]interface{}{})
+}
+
+func (s *apiSuite) TestGetPlanSectionErrors(c *C) {
+	_ = s.daemon(c)
+
+	rsp := s.getPlanSection(c, "services", "")
+	c.Assert(rsp.Status, Equals, 400)
+	c.Assert(rsp.Result.(*errorResult).Message, Equals, `invalid format ""`)
+
+	rsp = s.getPlanSection(c, "foo", "yaml")
+	c.Assert(rsp.Status, Equals, 404)
+	c.Assert(rsp.Result.(*errorResult).Message, Equals, `plan section "foo" not found`)
+}
+
+func (s *apiSuite) TestPostPlanSection(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+
+	rsp := s.postPlanSection(c, "services", `{"action": "add", "label": "foo", "format": "yaml", "section": "dynamic:\n override: replace\n command: echo dynamic\n"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result.(bool), Equals, true)
+
+	rsp = s.postPlanSection(c, "checks", `{"action": "add", "label": "bar", "format": "json", "section": "{\"chk1\": {\"override\": \"replace\", \"exec\": {\"command\": \"echo check\"}}}"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result.(bool), Equals, true)
+
+	c.Assert(s.planYAML(c), Equals, `
+services:
+    dynamic:
+        override: replace
+        command: echo dynamic
+    static:
+        override: replace
+        command: echo static
+checks:
+    chk1:
+        override: replace
+        threshold: 3
+        exec:
+            command: echo check
+`[1:])
+	s.planLayersHasLen(c, 3)
+
+	// Combining updates the existing layer.
+	rsp = s.postPlanSection(c, "services", `{"action": "add", "combine": true, "label": "foo", "format": "yaml", "section": "dynamic:\n override: merge\n command: echo updated\n"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	s.planLayersHasLen(c, 3)
+	c.Assert(s.getPlanSection(c, "services", "json").Result, DeepEquals, map[string]interface{}{
+		"dynamic": map[string]interface{}{
+			"override": "replace",
+			"command":  "echo updated",
+		},
+		"static": map[string]interface{}{
+			"override": "replace",
+			"command":  "echo static",
+		},
+	})
+}
+
+func (s *apiSuite) TestPostPlanSectionValidate(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+
+	rsp := s.postPlanSection(c, "services", `{"action": "validate", "label": "foo", "format": "yaml", "section": "dynamic:\n override: replace\n command: echo dynamic\n"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result.(bool), Equals, true)
+	s.planLayersHasLen(c, 1)
+
+	rsp = s.postPlanSection(c, "services", `{"action": "validate", "label": "foo", "format": "yaml", "section": "dynamic:\n override: replace\n"}`)
+	c.Assert(rsp.Status, Equals, 400)
+	c.Assert(rsp.Result.(*errorResult).Message, Matches, `.*plan must define "command" for service "dynamic"`)
+	s.planLayersHasLen(c, 1)
+}
+
+func (s *apiSuite) TestPostPlanSectionErrors(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+
+	var tests = []struct {
+		name    string
+		payload string
+		status  int
+		message string
+	}{
+		{"services", `@`, 400, `cannot decode request body: invalid character '@' looking for beginning of value`},
+		{"foo", `{"action": "add", "label": "x", "format": "yaml", "section": "a: b"}`, 404, `plan section "foo" not found`},
+		{"services", `{"action": "sub", "label": "x", "format": "yaml", "section": "a: b"}`, 400, `invalid action "sub"`},
+		{"services", `{"action": "add", "label": "", "format": "yaml", "section": "a: b"}`, 400, `label must be set`},
+		{"services", `{"action": "add", "label": "x", "format": "xml", "section": "a: b"}`, 400, `invalid format "xml"`},
+		{"services", `{"action": "add", "label": "x", "format": "yaml", "section": ""}`, 400, `section must be set`},
+		{"services", `{"action": "add", "label": "x", "format": "yaml", "section": ":"}`, 400, `cannot parse section YAML: .*`},
+		{"services", `{"action": "add", "label": "x", "format": "yaml", "section": "- a"}`, 400, `(?s)cannot parse section YAML: .*cannot unmarshal !!seq.*`},
+		{"services", `{"action": "add", "label": "base", "format": "yaml", "section": "a: {override: replace, command: foo}"}`, 400, `layer "base" already exists`},
+	}
+	for _, test := range tests {
+		c.Logf("%s %s", test.name, test.payload)
+		rsp := s.postPlanSection(c, test.name, test.payload)
+		c.Check(rsp.Status, Equals, test.status)
+		c.Check(rsp.Result.(*errorResult).Message, Matches, test.message)
+	}
+	s.planLayersHasLen(c, 1)
+}
+
+func (s *apiSuite) TestPostPlanSectionSigned(c *C) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	c.Assert(err, IsNil)
+	keysDir := filepath.Join(s.pebbleDir, "trusted-keys")
+	c.Assert(os.MkdirAll(keysDir, 0755), IsNil)
+	err = os.WriteFile(filepath.Join(keysDir, "test.pub"), []byte(base64.StdEncoding.EncodeToString(pub)), 0644)
+	c.Assert(err, IsNil)
+
+	d := s.daemon(c)
+	d.requireSignedLayers = true
+	section := "dynamic:\n override: replace\n command: echo dynamic\n"
+	post := func(name, label, signedName, signedLabel string) *resp {
+		signature := ed25519.Sign(priv, bundle.SignedLayerData(&bundle.SignedLayerHeader{Section: signedName, Label: signedLabel}, []byte(section)))
+		payload, err := json.Marshal(map[string]interface{}{
+			"action":    "add",
+			"label":     label,
+			"format":    "yaml",
+			"section":   section,
+			"signature": signature,
+		})
+		c.Assert(err, IsNil)
+		return s.postPlanSection(c, name, string(payload))
+	}
+
+	// The signature covers the section name and label, so it can't be
+	// replayed to add the same content elsewhere.
+	rsp := post("services", "foo", "", "foo")
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	rsp = post("services", "foo", "services", "bar")
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	rsp = post("checks", "foo", "services", "foo")
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	s.planLayersHasLen(c, 0)
+
+	rsp = post("services", "foo", "services", "foo")
+	c.Check(rsp.Status, Equals, 200)
+	s.planLayersHasLen(c, 1)
+}
@@ -16,11 +16,22 @@ package daemon
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 
 	. "gopkg.in/check.v1"
 	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/internals/bundle"
+	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/testutil"
 )
 
 var planLayer = `
@@ -40,6 +51,8 @@ func (s *apiSuite) TestGetPlanErrors(c *C) {
 	}{
 		{"/v1/layers", 400, `invalid format ""`},
 		{"/v1/layers?format=foo", 400, `invalid format "foo"`},
+		{"/v1/layers?format=yaml&section=foo", 400, `invalid section "foo"`},
+		{"/v1/layers?format=systemd&section=services", 400, `cannot select a plan section with format "systemd"`},
 	}
 
 	_ = s.daemon(c)
@@ -65,10 +78,11 @@ func (s *apiSuite) TestGetPlan(c *C) {
 
 	req, err := http.NewRequest("GET", "/v1/plan?format=yaml", nil)
 	c.Assert(err, IsNil)
-	rsp := v1GetPlan(planCmd, req, nil).(*resp)
+	planRsp := v1GetPlan(planCmd, req, nil).(*planResponse)
 	rec := httptest.NewRecorder()
-	rsp.ServeHTTP(rec, req)
+	planRsp.ServeHTTP(rec, req)
 	c.Assert(rec.Code, Equals, 200)
+	rsp := planRsp.Response.(*resp)
 	c.Assert(rsp.Status, Equals, 200)
 	c.Assert(rsp.Type, Equals, ResponseTypeSync)
 
@@ -80,6 +94,149 @@ services:
 `[1:]
 	c.Assert(rsp.Result.(string), Equals, expectedYAML)
 	c.Assert(s.planYAML(c), Equals, expectedYAML)
+	sum := sha256.Sum256([]byte(expectedYAML))
+	c.Assert(rec.Header().Get("ETag"), Equals, `"`+hex.EncodeToString(sum[:])+`"`)
+}
+
+func (s *apiSuite) TestGetPlanJSON(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	planCmd := apiCmd("/v1/plan")
+
+	req, err := http.NewRequest("GET", "/v1/plan?format=json", nil)
+	c.Assert(err, IsNil)
+	planRsp := v1GetPlan(planCmd, req, nil).(*planResponse)
+	rec := httptest.NewRecorder()
+	planRsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	rsp := planRsp.Response.(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Type, Equals, ResponseTypeSync)
+	c.Assert(rsp.Result, DeepEquals, map[string]interface{}{
+		"services": map[string]interface{}{
+			"static": map[string]interface{}{
+				"override": "replace",
+				"command":  "echo static",
+			},
+		},
+	})
+
+	// The hash is of the plan, so it's the same regardless of format.
+	sum := sha256.Sum256([]byte(s.planYAML(c)))
+	c.Assert(rec.Header().Get("ETag"), Equals, `"`+hex.EncodeToString(sum[:])+`"`)
+
+	var body struct {
+		Result json.RawMessage `json:"result"`
+	}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), IsNil)
+	c.Assert(string(body.Result), Equals, `{"services":{"static":{"command":"echo static","override":"replace"}}}`)
+}
+
+func (s *apiSuite) TestGetPlanSection(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer+`
+checks:
+    chk1:
+        override: replace
+        exec:
+            command: echo check
+`)
+	_ = s.daemon(c)
+	planCmd := apiCmd("/v1/plan")
+	get := func(query string) (*resp, string) {
+		req, err := http.NewRequest("GET", "/v1/plan?"+query, nil)
+		c.Assert(err, IsNil)
+		planRsp := v1GetPlan(planCmd, req, nil).(*planResponse)
+		rec := httptest.NewRecorder()
+		planRsp.ServeHTTP(rec, req)
+		c.Assert(rec.Code, Equals, 200)
+		return planRsp.Response.(*resp), rec.Header().Get("ETag")
+	}
+
+	rsp, etag := get("format=yaml&section=services")
+	expectedYAML := `
+services:
+    static:
+        override: replace
+        command: echo static
+`[1:]
+	c.Assert(rsp.Result.(string), Equals, expectedYAML)
+	sum := sha256.Sum256([]byte(expectedYAML))
+	c.Assert(etag, Equals, `"`+hex.EncodeToString(sum[:])+`"`)
+
+	rsp, _ = get("format=json&section=checks")
+	c.Assert(rsp.Result, DeepEquals, map[string]interface{}{
+		"checks": map[string]interface{}{
+			"chk1": map[string]interface{}{
+				"override":  "replace",
+				"threshold": 3,
+				"exec": map[string]interface{}{
+					"command": "echo check",
+				},
+			},
+		},
+	})
+
+	// An empty section gives an empty document.
+	rsp, _ = get("format=yaml&section=log-targets")
+	c.Assert(rsp.Result.(string), Equals, "{}\n")
+
+	// The ETag of a section doesn't change when other sections do.
+	layer, err := plan.ParseLayer(0, "foo", []byte("checks:\n chk2:\n  override: replace\n  exec:\n   command: echo two\n"))
+	c.Assert(err, IsNil)
+	err = s.d.overlord.PlanManager().AppendLayer(layer)
+	c.Assert(err, IsNil)
+	_, newETag := get("format=yaml&section=services")
+	c.Assert(newETag, Equals, etag)
+}
+
+func (s *apiSuite) TestGetPlanSystemd(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	planCmd := apiCmd("/v1/plan")
+
+	req, err := http.NewRequest("GET", "/v1/plan?format=systemd", nil)
+	c.Assert(err, IsNil)
+	planRsp := v1GetPlan(planCmd, req, nil).(*planResponse)
+	rec := httptest.NewRecorder()
+	planRsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	rsp := planRsp.Response.(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	units := rsp.Result.(map[string]string)
+	c.Assert(units, HasLen, 1)
+	c.Assert(units["static.service"], Matches, `(?s).*\nExecStart=echo static\n.*`)
+}
+
+func (s *apiSuite) TestGetPlanNotModified(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	planCmd := apiCmd("/v1/plan")
+
+	req, err := http.NewRequest("GET", "/v1/plan?format=yaml", nil)
+	c.Assert(err, IsNil)
+	rec := httptest.NewRecorder()
+	v1GetPlan(planCmd, req, nil).ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	etag := rec.Header().Get("ETag")
+	c.Assert(etag, Not(Equals), "")
+
+	// The plan hasn't changed, so it's not sent again.
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	v1GetPlan(planCmd, req, nil).ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, http.StatusNotModified)
+	c.Assert(rec.Header().Get("ETag"), Equals, etag)
+	c.Assert(rec.Body.Len(), Equals, 0)
+
+	// Once the plan changes, it's sent with a new ETag.
+	layer, err := plan.ParseLayer(0, "foo", []byte("services:\n dynamic:\n  override: replace\n  command: echo dynamic\n"))
+	c.Assert(err, IsNil)
+	err = s.d.overlord.PlanManager().AppendLayer(layer)
+	c.Assert(err, IsNil)
+	rec = httptest.NewRecorder()
+	v1GetPlan(planCmd, req, nil).ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	c.Assert(rec.Header().Get("ETag"), Not(Equals), etag)
 }
 
 func (s *apiSuite) planYAML(c *C) string {
@@ -107,6 +264,7 @@ func (s *apiSuite) TestLayersErrors(c *C) {
 		{`{"action": "add", "label": "", "format": "yaml"}`, 400, `label must be set`},
 		{`{"action": "add", "label": "x", "format": "xml"}`, 400, `invalid format "xml"`},
 		{`{"action": "add", "label": "x", "format": "yaml", "layer": "@"}`, 400, `cannot parse layer YAML: .*`},
+		{`{"action": "add", "label": "x", "format": "json", "layer": "{\"services\": 1}"}`, 400, `(?s)cannot parse layer JSON: .*`},
 	}
 
 	_ = s.daemon(c)
@@ -152,6 +310,31 @@ services:
 	s.planLayersHasLen(c, 2)
 }
 
+func (s *apiSuite) TestLayersAddJSON(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+
+	payload := `{"action": "add", "label": "foo", "format": "json", "layer": "{\"services\": {\"dynamic\": {\"override\": \"replace\", \"command\": \"echo dynamic\"}}}"}`
+	req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	c.Assert(rsp.Result.(bool), Equals, true)
+	c.Assert(s.planYAML(c), Equals, `
+services:
+    dynamic:
+        override: replace
+        command: echo dynamic
+    static:
+        override: replace
+        command: echo static
+`[1:])
+	s.planLayersHasLen(c, 2)
+}
+
 func (s *apiSuite) TestLayersAddCombine(c *C) {
 	writeTestLayer(s.pebbleDir, planLayer)
 	_ = s.daemon(c)
@@ -196,3 +379,440 @@ func (s *apiSuite) TestLayersCombineFormatError(c *C) {
 	result := rsp.Result.(*errorResult)
 	c.Assert(result.Message, Matches, `layer "base" must define "override" for service "dynamic"`)
 }
+
+func (s *apiSuite) TestLayersValidate(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+	planYAML := s.planYAML(c)
+
+	payload := `{"action": "validate", "label": "foo", "format": "yaml", "layer": "services:\n dynamic:\n  override: replace\n  command: echo dynamic\n"}`
+	req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Type, Equals, ResponseTypeSync)
+	c.Assert(rsp.Result.(bool), Equals, true)
+	c.Assert(s.planYAML(c), Equals, planYAML)
+	s.planLayersHasLen(c, 1)
+}
+
+func (s *apiSuite) TestLayersValidateErrors(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+	planYAML := s.planYAML(c)
+
+	var tests = []struct {
+		payload string
+		message string
+	}{
+		{`{"action": "validate", "label": "base", "format": "yaml", "layer": "summary: x\n"}`, `layer "base" already exists`},
+		{`{"action": "validate", "combine": true, "label": "base", "format": "yaml", "layer": "services:\n dynamic:\n  command: echo dynamic\n"}`, `layer "base" must define "override" for service "dynamic"`},
+		{`{"action": "validate", "label": "foo", "format": "yaml", "layer": "services:\n dynamic:\n  override: replace\n  command: echo dynamic\n  requires: [missing]\n"}`, `service "missing" does not exist`},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(test.payload))
+		c.Assert(err, IsNil)
+		rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+		rec := httptest.NewRecorder()
+		rsp.ServeHTTP(rec, req)
+		c.Assert(rec.Code, Equals, http.StatusBadRequest)
+		c.Assert(rsp.Type, Equals, ResponseTypeError)
+		c.Assert(rsp.Result.(*errorResult).Message, Matches, test.message)
+	}
+	c.Assert(s.planYAML(c), Equals, planYAML)
+	s.planLayersHasLen(c, 1)
+}
+
+func (s *apiSuite) TestLayersRemove(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+
+	payload := `{"action": "add", "label": "foo", "format": "yaml", "layer": "services:\n dynamic:\n  override: replace\n  command: echo dynamic\n"}`
+	req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	s.planLayersHasLen(c, 2)
+
+	payload = `{"action": "remove", "label": "foo"}`
+	req, err = http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp = v1PostLayers(layersCmd, req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Type, Equals, ResponseTypeSync)
+	c.Assert(rsp.Result.(bool), Equals, true)
+	c.Assert(s.planYAML(c), Equals, `
+services:
+    static:
+        override: replace
+        command: echo static
+`[1:])
+	s.planLayersHasLen(c, 1)
+}
+
+func (s *apiSuite) TestGetLayers(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+
+	payload := `{"action": "add", "label": "foo", "format": "yaml", "layer": "services:\n dynamic:\n  override: replace\n  command: echo dynamic\n"}`
+	req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+
+	req, err = http.NewRequest("GET", "/v1/layers", nil)
+	c.Assert(err, IsNil)
+	rsp = v1GetLayers(layersCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Type, Equals, ResponseTypeSync)
+	c.Assert(rsp.Result, DeepEquals, []layerInfo{
+		{Order: 1, Label: "base"},
+		{Order: 2, Label: "foo"},
+	})
+}
+
+func (s *apiSuite) TestLayersMove(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+
+	payload := `{"action": "add", "label": "foo", "format": "yaml", "layer": "services:\n static:\n  override: replace\n  command: echo foo\n"}`
+	req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(s.planYAML(c), Equals, `
+services:
+    static:
+        override: replace
+        command: echo foo
+`[1:])
+
+	// Moving "foo" before "base" gives "base" precedence again.
+	payload = `{"action": "move", "label": "foo", "order": 0}`
+	req, err = http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp = v1PostLayers(layersCmd, req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Type, Equals, ResponseTypeSync)
+	c.Assert(rsp.Result.(bool), Equals, true)
+	c.Assert(s.planYAML(c), Equals, `
+services:
+    static:
+        override: replace
+        command: echo static
+`[1:])
+	layers := s.d.overlord.PlanManager().Plan().Layers
+	c.Assert(layers, HasLen, 2)
+	c.Assert(layers[0].Label, Equals, "foo")
+	c.Assert(layers[1].Label, Equals, "base")
+}
+
+func (s *apiSuite) TestLayersInsert(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+	post := func(payload string) *resp {
+		req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+		c.Assert(err, IsNil)
+		return v1PostLayers(layersCmd, req, nil).(*resp)
+	}
+
+	// There's room before "base", so it keeps its order.
+	rsp := post(`{"action": "add", "label": "foo", "format": "yaml", "insert-before": "base", "layer": "services:\n static:\n  override: replace\n  command: echo foo\n"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(s.planYAML(c), Equals, `
+services:
+    static:
+        override: replace
+        command: echo static
+`[1:])
+
+	// There's no room before "base", so it's renumbered, along with its
+	// layer file.
+	rsp = post(`{"action": "add", "label": "bar", "format": "yaml", "insert-before": "base", "layer": "summary: bar\n"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	req, err := http.NewRequest("GET", "/v1/layers", nil)
+	c.Assert(err, IsNil)
+	rsp = v1GetLayers(layersCmd, req, nil).(*resp)
+	c.Assert(rsp.Result, DeepEquals, []layerInfo{
+		{Order: 0, Label: "foo"},
+		{Order: 1, Label: "bar"},
+		{Order: 2, Label: "base"},
+	})
+	c.Assert(filepath.Join(s.pebbleDir, "layers", "002-base.yaml"), testutil.FilePresent)
+	c.Assert(filepath.Join(s.pebbleDir, "layers", "001-base.yaml"), testutil.FileAbsent)
+
+	// An explicit order puts the layer in that position.
+	rsp = post(`{"action": "add", "label": "baz", "format": "yaml", "order": 5, "layer": "summary: baz\n"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	layers := s.d.overlord.PlanManager().Plan().Layers
+	c.Assert(layers, HasLen, 4)
+	c.Assert(layers[3].Label, Equals, "baz")
+	c.Assert(layers[3].Order, Equals, 5)
+
+	var tests = []struct {
+		payload string
+		status  int
+		message string
+	}{
+		{`{"action": "add", "label": "x", "format": "yaml", "insert-before": "missing", "layer": "summary: x\n"}`, 404, `layer "missing" not found`},
+		{`{"action": "add", "label": "x", "format": "yaml", "order": 2, "layer": "summary: x\n"}`, 400, `layer "base" already has order 2`},
+		{`{"action": "add", "label": "x", "format": "yaml", "order": 1, "insert-before": "base", "layer": "summary: x\n"}`, 400, `cannot specify both order and insert-before`},
+		{`{"action": "add", "label": "x", "format": "yaml", "order": -1, "layer": "summary: x\n"}`, 400, `order must not be negative`},
+		{`{"action": "add", "label": "x", "format": "yaml", "order": 1000000, "layer": "summary: x\n"}`, 400, `order must be less than 1000000`},
+		{`{"action": "move", "label": "foo", "insert-before": "base"}`, 400, `insert-before is only valid when adding a layer`},
+	}
+	for _, test := range tests {
+		rsp := post(test.payload)
+		c.Assert(rsp.Status, Equals, test.status, Commentf("payload %s", test.payload))
+		c.Assert(rsp.Result.(*errorResult).Message, Matches, test.message)
+	}
+	s.planLayersHasLen(c, 4)
+}
+
+func (s *apiSuite) TestLayersRemoveMoveErrors(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+	planYAML := s.planYAML(c)
+
+	var tests = []struct {
+		payload string
+		status  int
+		message string
+	}{
+		{`{"action": "remove", "label": ""}`, 400, `label must be set`},
+		{`{"action": "remove", "label": "foo"}`, 404, `layer "foo" not found`},
+		{`{"action": "move", "label": "base"}`, 400, `order must be set`},
+		{`{"action": "move", "label": "base", "order": -1}`, 400, `order must not be negative`},
+		{`{"action": "move", "label": "base", "order": 1000000}`, 400, `order must be less than 1000000`},
+		{`{"action": "move", "label": "foo", "order": 2}`, 404, `layer "foo" not found`},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(test.payload))
+		c.Assert(err, IsNil)
+		rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+		rec := httptest.NewRecorder()
+		rsp.ServeHTTP(rec, req)
+		c.Assert(rec.Code, Equals, test.status, Commentf("payload %s", test.payload))
+		c.Assert(rsp.Type, Equals, ResponseTypeError)
+		c.Assert(rsp.Result.(*errorResult).Message, Matches, test.message)
+	}
+	c.Assert(s.planYAML(c), Equals, planYAML)
+	s.planLayersHasLen(c, 1)
+}
+
+func (s *apiSuite) TestGetPlanDiff(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+	diffCmd := apiCmd("/v1/plan/diff")
+
+	payload := `{"action": "add", "label": "foo", "format": "yaml", "layer": "services:\n static:\n  override: merge\n  command: echo changed\n dynamic:\n  override: replace\n  command: echo dynamic\n"}`
+	req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+
+	req, err = http.NewRequest("GET", "/v1/plan/diff?from=base", nil)
+	c.Assert(err, IsNil)
+	rsp = v1GetPlanDiff(diffCmd, req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	c.Assert(rsp.Type, Equals, ResponseTypeSync)
+	var body map[string]interface{}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), IsNil)
+	c.Assert(body["result"], DeepEquals, []interface{}{
+		map[string]interface{}{
+			"section": "services",
+			"name":    "dynamic",
+			"action":  "added",
+		},
+		map[string]interface{}{
+			"section": "services",
+			"name":    "static",
+			"action":  "changed",
+			"fields": []interface{}{
+				map[string]interface{}{
+					"field": "command",
+					"old":   "echo static",
+					"new":   "echo changed",
+				},
+			},
+		},
+	})
+
+	// Diffing from the last layer gives no differences.
+	req, err = http.NewRequest("GET", "/v1/plan/diff?from=foo", nil)
+	c.Assert(err, IsNil)
+	rsp = v1GetPlanDiff(diffCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result, HasLen, 0)
+}
+
+func (s *apiSuite) TestGetPlanDiffErrors(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	diffCmd := apiCmd("/v1/plan/diff")
+
+	for _, test := range []struct {
+		query   string
+		status  int
+		message string
+	}{
+		{"", 400, `"from" must be set`},
+		{"?from=missing", 404, `layer "missing" not found`},
+	} {
+		req, err := http.NewRequest("GET", "/v1/plan/diff"+test.query, nil)
+		c.Assert(err, IsNil)
+		rsp := v1GetPlanDiff(diffCmd, req, nil).(*resp)
+		c.Assert(rsp.Status, Equals, test.status)
+		c.Assert(rsp.Type, Equals, ResponseTypeError)
+		c.Assert(rsp.Result.(*errorResult).Message, Matches, test.message)
+	}
+}
+
+func (s *apiSuite) TestPostPlanDiff(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	diffCmd := apiCmd("/v1/plan/diff")
+	planYAML := s.planYAML(c)
+
+	payload := `{"combine": true, "label": "base", "format": "yaml", "layer": "services:\n static:\n  override: merge\n  startup: enabled\n"}`
+	req, err := http.NewRequest("POST", "/v1/plan/diff", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostPlanDiff(diffCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result, DeepEquals, []*planDiffItem{{
+		Section: "services",
+		Name:    "static",
+		Action:  "changed",
+		Fields: []*planDiffField{
+			{Field: "startup", New: "enabled"},
+		},
+	}})
+	c.Assert(s.planYAML(c), Equals, planYAML)
+
+	// Errors are reported as when adding the layer.
+	payload = `{"label": "base", "format": "yaml", "layer": "summary: x\n"}`
+	req, err = http.NewRequest("POST", "/v1/plan/diff", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp = v1PostPlanDiff(diffCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 400)
+	c.Assert(rsp.Result.(*errorResult).Message, Equals, `layer "base" already exists`)
+}
+
+func (s *apiSuite) TestLayersSigned(c *C) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	c.Assert(err, IsNil)
+	keysDir := filepath.Join(s.pebbleDir, "trusted-keys")
+	c.Assert(os.MkdirAll(keysDir, 0755), IsNil)
+	err = os.WriteFile(filepath.Join(keysDir, "test.pub"), []byte(base64.StdEncoding.EncodeToString(pub)), 0644)
+	c.Assert(err, IsNil)
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	c.Assert(err, IsNil)
+
+	d := s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+	post := func(payload map[string]interface{}) *resp {
+		data, err := json.Marshal(payload)
+		c.Assert(err, IsNil)
+		req, err := http.NewRequest("POST", "/v1/layers", bytes.NewReader(data))
+		c.Assert(err, IsNil)
+		return v1PostLayers(layersCmd, req, nil).(*resp)
+	}
+	layer := "services:\n dynamic:\n  override: replace\n  command: echo dynamic\n"
+	add := func(label string, signature []byte) *resp {
+		return post(map[string]interface{}{
+			"action":    "add",
+			"label":     label,
+			"format":    "yaml",
+			"layer":     layer,
+			"signature": signature,
+		})
+	}
+
+	sign := func(key ed25519.PrivateKey, label string, combine bool, content string) []byte {
+		header := &bundle.SignedLayerHeader{Label: label, Combine: combine}
+		return ed25519.Sign(key, bundle.SignedLayerData(header, []byte(content)))
+	}
+
+	// A signature is checked even if signed layers aren't required.
+	rsp := add("foo", sign(otherPriv, "foo", false, layer))
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	rsp = add("foo", nil)
+	c.Check(rsp.Status, Equals, 200)
+
+	d.requireSignedLayers = true
+	rsp = add("bar", nil)
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: layer must be signed")
+	rsp = add("bar", sign(priv, "bar", false, layer+"\n"))
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	// The signature covers the label and combine flag, so it can't be
+	// replayed to add the same content elsewhere.
+	rsp = add("bar", sign(priv, "baz", false, layer))
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	rsp = add("bar", sign(priv, "bar", true, layer))
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	rsp = add("bar", ed25519.Sign(priv, []byte(layer)))
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	rsp = add("bar", sign(priv, "bar", false, layer))
+	c.Check(rsp.Status, Equals, 200)
+	s.planLayersHasLen(c, 2)
+
+	// The position is signed too, so a signed layer can't be given another
+	// precedence.
+	order := 5
+	positioned := ed25519.Sign(priv, bundle.SignedLayerData(&bundle.SignedLayerHeader{Label: "baz", Order: &order}, []byte(layer)))
+	addAt := func(position map[string]interface{}) *resp {
+		payload := map[string]interface{}{
+			"action":    "add",
+			"label":     "baz",
+			"format":    "yaml",
+			"layer":     layer,
+			"signature": positioned,
+		}
+		for key, value := range position {
+			payload[key] = value
+		}
+		return post(payload)
+	}
+	rsp = addAt(map[string]interface{}{"order": 0})
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	rsp = addAt(map[string]interface{}{"insert-before": "foo"})
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add layer: signature not made by a trusted key")
+	rsp = addAt(map[string]interface{}{"order": 5})
+	c.Check(rsp.Status, Equals, 200)
+	s.planLayersHasLen(c, 3)
+
+	rsp = post(map[string]interface{}{"action": "remove", "label": "foo"})
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot remove layer: only signed layers may be added")
+	rsp = post(map[string]interface{}{"action": "move", "label": "foo", "order": 0})
+	c.Check(rsp.Status, Equals, 403)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot move layer: only signed layers may be added")
+	s.planLayersHasLen(c, 3)
+}
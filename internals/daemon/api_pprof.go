@@ -0,0 +1,106 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Sampling rates used while a mutex or block profile is being collected.
+// Sampling is off by default, as it has a runtime cost.
+const (
+	pprofMutexFraction = 5
+	pprofBlockRate     = 10000 // nanoseconds
+)
+
+// pprofSampling counts the mutex and block profiles being collected, so
+// that sampling is only turned off when the last one finishes.
+var pprofSampling struct {
+	mu    sync.Mutex
+	mutex int
+	block int
+}
+
+// v1GetPprof serves the Go runtime profiles of the running daemon, in the
+// format expected by "go tool pprof". The "profile" (CPU) and "trace"
+// profiles are collected for the number of seconds given by the "seconds"
+// query parameter, as are delta profiles of the named runtime profiles
+// such as "heap", "goroutine", "mutex", and "block".
+func v1GetPprof(c *Command, r *http.Request, _ *UserState) Response {
+	name := muxVars(r)["profile"]
+	switch name {
+	case "profile":
+		return http.HandlerFunc(pprof.Profile)
+	case "trace":
+		return http.HandlerFunc(pprof.Trace)
+	}
+	if runtimepprof.Lookup(name) == nil {
+		var names []string
+		for _, p := range runtimepprof.Profiles() {
+			names = append(names, p.Name())
+		}
+		names = append(names, "profile", "trace")
+		sort.Strings(names)
+		return NotFound("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	handler := pprof.Handler(name)
+	if (name == "mutex" || name == "block") && r.URL.Query().Get("seconds") != "" {
+		// Only sample while the profile is being collected.
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			restore := enablePprofSampling(name)
+			defer restore()
+			handler.ServeHTTP(w, r)
+		})
+	}
+	return handler
+}
+
+func enablePprofSampling(name string) (restore func()) {
+	pprofSampling.mu.Lock()
+	defer pprofSampling.mu.Unlock()
+	if name == "mutex" {
+		if pprofSampling.mutex == 0 {
+			runtime.SetMutexProfileFraction(pprofMutexFraction)
+		}
+		pprofSampling.mutex++
+	} else {
+		if pprofSampling.block == 0 {
+			runtime.SetBlockProfileRate(pprofBlockRate)
+		}
+		pprofSampling.block++
+	}
+
+	return func() {
+		pprofSampling.mu.Lock()
+		defer pprofSampling.mu.Unlock()
+		if name == "mutex" {
+			pprofSampling.mutex--
+			if pprofSampling.mutex == 0 {
+				runtime.SetMutexProfileFraction(0)
+			}
+		} else {
+			pprofSampling.block--
+			if pprofSampling.block == 0 {
+				runtime.SetBlockProfileRate(0)
+			}
+		}
+	}
+}
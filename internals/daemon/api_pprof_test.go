@@ -0,0 +1,68 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *apiSuite) getPprof(c *check.C, profile, query string) *httptest.ResponseRecorder {
+	s.vars = map[string]string{"profile": profile}
+	cmd := apiCmd("/v1/debug/pprof/{profile}")
+	req, err := http.NewRequest("GET", "/v1/debug/pprof/"+profile+query, nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	cmd.GET(cmd, req, nil).ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *apiSuite) TestPprofHeap(c *check.C) {
+	rec := s.getPprof(c, "heap", "")
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.Header().Get("Content-Type"), check.Equals, "application/octet-stream")
+	// The profile is gzipped protobuf.
+	c.Check(rec.Body.Bytes()[:2], check.DeepEquals, []byte{0x1f, 0x8b})
+}
+
+func (s *apiSuite) TestPprofGoroutineText(c *check.C) {
+	rec := s.getPprof(c, "goroutine", "?debug=1")
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.Body.String(), check.Matches, `(?s)goroutine profile: total \d+\n.*`)
+}
+
+func (s *apiSuite) TestPprofCPU(c *check.C) {
+	rec := s.getPprof(c, "profile", "?seconds=1")
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.Body.Bytes()[:2], check.DeepEquals, []byte{0x1f, 0x8b})
+}
+
+func (s *apiSuite) TestPprofMutexSampling(c *check.C) {
+	rec := s.getPprof(c, "mutex", "?seconds=1")
+	c.Check(rec.Code, check.Equals, 200)
+
+	// Sampling is turned off again once the profile has been collected.
+	c.Check(runtime.SetMutexProfileFraction(-1), check.Equals, 0)
+	c.Check(pprofSampling.mutex, check.Equals, 0)
+}
+
+func (s *apiSuite) TestPprofUnknown(c *check.C) {
+	rec := s.getPprof(c, "foo", "")
+	c.Check(rec.Code, check.Equals, 404)
+	c.Check(rec.Body.String(), check.Matches, `.*unknown profile \\"foo\\" \(available: .*heap.*profile.*trace.*\).*`)
+}
@@ -24,8 +24,10 @@ import (
 
 	"github.com/canonical/x-go/strutil"
 
+	"github.com/canonical/pebble/internals/logger"
 	"github.com/canonical/pebble/internals/overlord/servstate"
 	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/timing"
 )
 
 type serviceInfo struct {
@@ -61,8 +63,14 @@ func v1GetServices(c *Command, r *http.Request, _ *UserState) Response {
 
 func v1PostServices(c *Command, r *http.Request, _ *UserState) Response {
 	var payload struct {
-		Action   string   `json:"action"`
-		Services []string `json:"services"`
+		Action     string             `json:"action"`
+		Services   []string           `json:"services"`
+		Operations []serviceOperation `json:"operations"`
+
+		// RejectConflicts makes the request fail with "409 Conflict" if a
+		// change in progress is operating on any of the services, instead
+		// of the new change waiting for it.
+		RejectConflicts bool `json:"reject-conflicts"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -77,6 +85,13 @@ func v1PostServices(c *Command, r *http.Request, _ *UserState) Response {
 		if len(payload.Services) != 0 {
 			return BadRequest("%s accepts no service names", payload.Action)
 		}
+	case "batch":
+		if len(payload.Services) != 0 {
+			return BadRequest("%s accepts no service names", payload.Action)
+		}
+		if len(payload.Operations) == 0 {
+			return BadRequest("no operations to %s provided", payload.Action)
+		}
 	case "autostart":
 		if len(payload.Services) != 0 {
 			return BadRequest("%s accepts no service names", payload.Action)
@@ -103,6 +118,13 @@ func v1PostServices(c *Command, r *http.Request, _ *UserState) Response {
 	st.Lock()
 	defer st.Unlock()
 
+	checkConflict := func(names []string) error {
+		if !payload.RejectConflicts {
+			return nil
+		}
+		return servstate.CheckConflict(st, names)
+	}
+
 	var taskSet *state.TaskSet
 	var services []string
 	switch payload.Action {
@@ -111,25 +133,37 @@ func v1PostServices(c *Command, r *http.Request, _ *UserState) Response {
 		if err != nil {
 			break
 		}
+		if err = checkConflict(services); err != nil {
+			break
+		}
 		taskSet, err = servstate.Start(st, services)
 	case "stop":
 		services, err = servmgr.StopOrder(payload.Services)
 		if err != nil {
 			break
 		}
+		if err = checkConflict(services); err != nil {
+			break
+		}
 		taskSet, err = servstate.Stop(st, services)
 	case "restart":
-		services, err = servmgr.StopOrder(payload.Services)
+		// Also restart running services that declare restart-with on
+		// any of the requested ones.
+		restartNames := append(payload.Services, servmgr.RestartWith(payload.Services)...)
+		services, err = servmgr.StopOrder(restartNames)
 		if err != nil {
 			break
 		}
-		services = intersectOrdered(payload.Services, services)
-		var stopTasks *state.TaskSet
-		stopTasks, err = servstate.Stop(st, services)
+		stopNames := intersectOrdered(restartNames, services)
+		services, err = servmgr.StartOrder(restartNames)
 		if err != nil {
 			break
 		}
-		services, err = servmgr.StartOrder(payload.Services)
+		if err = checkConflict(append(stopNames, services...)); err != nil {
+			break
+		}
+		var stopTasks *state.TaskSet
+		stopTasks, err = servstate.Stop(st, stopNames)
 		if err != nil {
 			break
 		}
@@ -142,12 +176,18 @@ func v1PostServices(c *Command, r *http.Request, _ *UserState) Response {
 		taskSet = state.NewTaskSet()
 		taskSet.AddAll(stopTasks)
 		taskSet.AddAll(startTasks)
+	case "batch":
+		taskSet, services, err = batchServices(st, servmgr, payload.Operations, checkConflict)
+		payload.Services = services
 	case "replan":
 		var stopNames, startNames []string
 		stopNames, startNames, err = servmgr.Replan()
 		if err != nil {
 			break
 		}
+		if err = checkConflict(append(stopNames, startNames...)); err != nil {
+			break
+		}
 		var stopTasks *state.TaskSet
 		stopTasks, err = servstate.Stop(st, stopNames)
 		if err != nil {
@@ -179,6 +219,9 @@ func v1PostServices(c *Command, r *http.Request, _ *UserState) Response {
 	default:
 		return BadRequest("action %q is unsupported", payload.Action)
 	}
+	if conflict, ok := err.(*state.ChangeConflictError); ok {
+		return changeConflictResponse(conflict, "cannot %s services: %v", payload.Action, conflict)
+	}
 	if err != nil {
 		return BadRequest("cannot %s services: %v", payload.Action, err)
 	}
@@ -206,12 +249,39 @@ func v1PostServices(c *Command, r *http.Request, _ *UserState) Response {
 	if len(payload.Services) > 0 {
 		change.Set("service-names", payload.Services)
 	}
+	if payload.Action == "autostart" {
+		go c.d.saveAutostartTimings(change)
+	}
 
 	stateEnsureBefore(st, 0)
 
 	return AsyncResponse(nil, change.ID())
 }
 
+// saveAutostartTimings records how long the autostart change takes to
+// finish, alongside the other startup timings.
+func (d *Daemon) saveAutostartTimings(change *state.Change) {
+	st := change.State()
+	st.Lock()
+	timings := timing.Start("", "", map[string]string{"startup": "autostart", "change-id": change.ID()})
+	ready := change.Ready()
+	st.Unlock()
+
+	select {
+	case <-ready:
+	case <-d.tomb.Dying():
+		return
+	}
+	timings.Stop()
+
+	st.Lock()
+	defer st.Unlock()
+	err := timings.Save(st)
+	if err != nil {
+		logger.Noticef("Cannot save autostart timings: %v", err)
+	}
+}
+
 func v1GetService(c *Command, r *http.Request, _ *UserState) Response {
 	return BadRequest("not implemented")
 }
@@ -220,6 +290,92 @@ func v1PostService(c *Command, r *http.Request, _ *UserState) Response {
 	return BadRequest("not implemented")
 }
 
+// v1PostServiceStdin sends the request body to the service's stdin.
+func v1PostServiceStdin(c *Command, r *http.Request, _ *UserState) Response {
+	name := muxVars(r)["name"]
+	servmgr := overlordServiceManager(c.d.overlord)
+	err := servmgr.WriteStdin(name, r.Body)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+	return SyncResponse(true)
+}
+
+type serviceOperation struct {
+	Action   string   `json:"action"`
+	Services []string `json:"services"`
+}
+
+// batchServices creates the tasks for a list of start, stop, and restart
+// operations. All the stops happen first, in stop order across every
+// operation, followed by all the starts in start order. It returns the
+// task set and the requested service names (for the change summary).
+// checkConflict is called with the services to be stopped and started.
+func batchServices(st *state.State, servmgr *servstate.ServiceManager, ops []serviceOperation, checkConflict func([]string) error) (*state.TaskSet, []string, error) {
+	var starts, stops, restarts, requested []string
+	for _, op := range ops {
+		if len(op.Services) == 0 {
+			return nil, nil, fmt.Errorf("no services to %s provided", op.Action)
+		}
+		switch op.Action {
+		case "start":
+			starts = append(starts, op.Services...)
+		case "stop":
+			stops = append(stops, op.Services...)
+		case "restart":
+			restarts = append(restarts, op.Services...)
+			restarts = append(restarts, servmgr.RestartWith(op.Services)...)
+		default:
+			return nil, nil, fmt.Errorf("batch operation %q is unsupported", op.Action)
+		}
+		for _, name := range op.Services {
+			if !strutil.ListContains(requested, name) {
+				requested = append(requested, name)
+			}
+		}
+	}
+
+	// Stopping a service also stops its dependants, whereas restarting
+	// only stops the services named.
+	stopped, err := servmgr.StopOrder(stops)
+	if err != nil {
+		return nil, nil, err
+	}
+	toStop := append(append([]string(nil), stopped...), restarts...)
+	allStops, err := servmgr.StopOrder(toStop)
+	if err != nil {
+		return nil, nil, err
+	}
+	stopNames := intersectOrdered(toStop, allStops)
+	startNames, err := servmgr.StartOrder(append(starts, restarts...))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range startNames {
+		if strutil.ListContains(stopped, name) && !strutil.ListContains(restarts, name) {
+			return nil, nil, fmt.Errorf("service %q would be both stopped and started", name)
+		}
+	}
+
+	err = checkConflict(append(append([]string(nil), stopNames...), startNames...))
+	if err != nil {
+		return nil, nil, err
+	}
+	stopTasks, err := servstate.Stop(st, stopNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	startTasks, err := servstate.Start(st, startNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	startTasks.WaitAll(stopTasks)
+	taskSet := state.NewTaskSet()
+	taskSet.AddAll(stopTasks)
+	taskSet.AddAll(startTasks)
+	return taskSet, requested, nil
+}
+
 // intersectOrdered returns the intersection of left and right where
 // the right's ordering is persisted in the resulting set.
 func intersectOrdered(left []string, orderedRight []string) []string {
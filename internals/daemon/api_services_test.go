@@ -282,6 +282,87 @@ func (s *apiSuite) TestServicesRestart(c *C) {
 	c.Assert(tasks[4].Summary(), Equals, `Start service "test3"`)
 }
 
+func (s *apiSuite) TestServicesBatch(c *C) {
+	writeTestLayer(s.pebbleDir, servicesLayer)
+	d := s.daemon(c)
+	st := d.overlord.State()
+
+	restore := FakeStateEnsureBefore(func(st *state.State, d time.Duration) {})
+	defer restore()
+
+	servicesCmd := apiCmd("/v1/services")
+
+	payload := bytes.NewBufferString(`{"action": "batch", "operations": [
+		{"action": "stop", "services": ["test3"]},
+		{"action": "restart", "services": ["test1"]}
+	]}`)
+	req, err := http.NewRequest("POST", "/v1/services", payload)
+	c.Assert(err, IsNil)
+	rsp := v1PostServices(servicesCmd, req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 202)
+	c.Check(rsp.Type, Equals, ResponseTypeAsync)
+
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, NotNil)
+	c.Check(chg.Kind(), Equals, "batch")
+	c.Check(chg.Summary(), Equals, `Batch service "test3" and 1 more`)
+
+	// All stops come first, in stop order, then the starts.
+	tasks := chg.Tasks()
+	c.Assert(tasks, HasLen, 4)
+	c.Check(tasks[0].Summary(), Equals, `Stop service "test1"`)
+	c.Check(tasks[1].Summary(), Equals, `Stop service "test3"`)
+	c.Check(tasks[2].Summary(), Equals, `Start service "test1"`)
+	c.Check(tasks[3].Summary(), Equals, `Start service "test2"`)
+}
+
+func (s *apiSuite) TestServicesBatchErrors(c *C) {
+	writeTestLayer(s.pebbleDir, servicesLayer)
+	s.daemon(c)
+	servicesCmd := apiCmd("/v1/services")
+
+	for _, test := range []struct {
+		payload string
+		message string
+	}{{
+		payload: `{"action": "batch"}`,
+		message: `no operations to batch provided`,
+	}, {
+		payload: `{"action": "batch", "services": ["test1"], "operations": [{"action": "start", "services": ["test1"]}]}`,
+		message: `batch accepts no service names`,
+	}, {
+		payload: `{"action": "batch", "operations": [{"action": "replan", "services": ["test1"]}]}`,
+		message: `cannot batch services: batch operation "replan" is unsupported`,
+	}, {
+		payload: `{"action": "batch", "operations": [{"action": "stop", "services": ["test2"]}, {"action": "start", "services": ["test1"]}]}`,
+		message: `cannot batch services: service "test1" would be both stopped and started`,
+	}} {
+		req, err := http.NewRequest("POST", "/v1/services", bytes.NewBufferString(test.payload))
+		c.Assert(err, IsNil)
+		rsp := v1PostServices(servicesCmd, req, nil).(*resp)
+		c.Check(rsp.Status, Equals, 400, Commentf("%s", test.payload))
+		c.Check(rsp.Result.(*errorResult).Message, Equals, test.message, Commentf("%s", test.payload))
+	}
+}
+
+func (s *apiSuite) TestServiceStdinNotRunning(c *C) {
+	writeTestLayer(s.pebbleDir, servicesLayer)
+	s.daemon(c)
+	stdinCmd := apiCmd("/v1/services/{name}/stdin")
+	s.vars = map[string]string{"name": "test1"}
+
+	req, err := http.NewRequest("POST", "/v1/services/test1/stdin", strings.NewReader("hello\n"))
+	c.Assert(err, IsNil)
+	rsp := v1PostServiceStdin(stdinCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, `service "test1" is not running`)
+}
+
 func (s *apiSuite) TestServicesReplan(c *C) {
 	// Setup
 	writeTestLayer(s.pebbleDir, servicesLayer)
@@ -467,3 +548,64 @@ services:
 	err = daemon.Stop(nil)
 	c.Assert(err, IsNil)
 }
+
+func (s *apiSuite) TestServicesConflict(c *C) {
+	writeTestLayer(s.pebbleDir, servicesLayer)
+	d := s.daemon(c)
+	st := d.overlord.State()
+
+	restore := FakeStateEnsureBefore(func(st *state.State, d time.Duration) {})
+	defer restore()
+
+	servicesCmd := apiCmd("/v1/services")
+	post := func(payload string) *resp {
+		req, err := http.NewRequest("POST", "/v1/services", bytes.NewBufferString(payload))
+		c.Assert(err, IsNil)
+		rsp := v1PostServices(servicesCmd, req, nil).(*resp)
+		rec := httptest.NewRecorder()
+		rsp.ServeHTTP(rec, req)
+		return rsp
+	}
+
+	// The overlord isn't running, so the change stays in progress.
+	rsp := post(`{"action": "start", "services": ["test1"]}`)
+	c.Assert(rsp.Status, Equals, 202)
+	startID := rsp.Change
+
+	// With reject-conflicts, changes that affect the same services are
+	// rejected.
+	for _, payload := range []string{
+		`{"action": "stop", "services": ["test2"], "reject-conflicts": true}`,
+		`{"action": "start", "services": ["test2"], "reject-conflicts": true}`,
+		`{"action": "restart", "services": ["test1"], "reject-conflicts": true}`,
+		`{"action": "batch", "operations": [{"action": "start", "services": ["test4", "test1"]}], "reject-conflicts": true}`,
+	} {
+		c.Logf("payload: %s", payload)
+		rsp = post(payload)
+		c.Check(rsp.Status, Equals, 409)
+		result := rsp.Result.(*errorResult)
+		c.Check(result.Kind, Equals, errorKindChangeConflict)
+		c.Check(result.Message, Matches, `cannot .* services: service "test[12]" has "start" change in progress`)
+		c.Check(result.Value.(map[string]string)["change-id"], Equals, startID)
+		c.Check(result.Value.(map[string]string)["change-kind"], Equals, "start")
+	}
+
+	// Changes that affect other services aren't.
+	rsp = post(`{"action": "start", "services": ["test3"], "reject-conflicts": true}`)
+	c.Check(rsp.Status, Equals, 202)
+
+	// By default, they're accepted.
+	rsp = post(`{"action": "start", "services": ["test1"]}`)
+	c.Check(rsp.Status, Equals, 202)
+
+	// And once the changes are finished, they no longer conflict.
+	st.Lock()
+	for _, change := range st.Changes() {
+		for _, task := range change.Tasks() {
+			task.SetStatus(state.DoneStatus)
+		}
+	}
+	st.Unlock()
+	rsp = post(`{"action": "stop", "services": ["test1"], "reject-conflicts": true}`)
+	c.Check(rsp.Status, Equals, 202)
+}
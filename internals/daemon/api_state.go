@@ -0,0 +1,68 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+type stateInfo struct {
+	Path     string     `json:"path,omitempty"`
+	Size     int64      `json:"size"`
+	Modified *time.Time `json:"modified,omitempty"`
+	Changes  int        `json:"changes"`
+	Tasks    int        `json:"tasks"`
+	Warnings int        `json:"warnings"`
+	Notices  int        `json:"notices"`
+
+	Lock     state.LockStats     `json:"lock"`
+	TaskWait state.TaskWaitStats `json:"task-wait"`
+}
+
+// v1GetStateInfo returns statistics about the state and the file it's
+// persisted to, for diagnostics.
+func v1GetStateInfo(c *Command, r *http.Request, _ *UserState) Response {
+	info := stateInfo{Path: c.d.overlord.StatePath()}
+	if info.Path != "" {
+		fi, err := os.Stat(info.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return InternalError("cannot stat state file: %v", err)
+		}
+		if err == nil {
+			modified := fi.ModTime()
+			info.Size = fi.Size()
+			info.Modified = &modified
+		}
+	}
+
+	// The task runner takes its own lock before the state lock, so get its
+	// stats without holding the state lock.
+	info.TaskWait = c.d.overlord.TaskRunner().WaitStats()
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	info.Changes = len(st.Changes())
+	info.Tasks = len(st.Tasks())
+	info.Warnings = len(st.AllWarnings())
+	info.Notices = len(st.Notices(nil))
+	info.Lock = st.LockStats()
+
+	return SyncResponse(info)
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/canonical/x-go/strutil"
+
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+// v1GetStateData returns the data a manager stored in the state under the
+// given key, so that it can be inspected without copying the state file off
+// the system. Only the keys the daemon was started with may be read.
+func v1GetStateData(c *Command, r *http.Request, _ *UserState) Response {
+	key := muxVars(r)["key"]
+	if !strutil.ListContains(c.d.debugStateDataKeys, key) {
+		return Forbidden("state data key %q is not allowed", key)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var value json.RawMessage
+	err := st.Get(key, &value)
+	if errors.Is(err, state.ErrNoState) {
+		return NotFound("state data key %q not found", key)
+	}
+	if err != nil {
+		return InternalError("cannot get state data: %v", err)
+	}
+	return SyncResponse(value)
+}
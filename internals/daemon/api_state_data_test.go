@@ -0,0 +1,72 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *apiSuite) getStateData(c *check.C, key string) (int, map[string]interface{}) {
+	s.vars = map[string]string{"key": key}
+	cmd := apiCmd("/v1/debug/state-data/{key}")
+	req, err := http.NewRequest("GET", "/v1/debug/state-data/"+key, nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	v1GetStateData(cmd, req, nil).ServeHTTP(rec, req)
+	var body map[string]interface{}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), check.IsNil)
+	return rec.Code, body
+}
+
+func (s *apiSuite) TestStateData(c *check.C) {
+	d := s.daemon(c)
+	d.debugStateDataKeys = []string{"firmwares", "missing"}
+
+	st := d.overlord.State()
+	st.Lock()
+	st.Set("firmwares", map[string]interface{}{"fw1": map[string]string{"version": "1.2"}})
+	st.Set("secrets", "shh")
+	st.Unlock()
+
+	code, body := s.getStateData(c, "firmwares")
+	c.Assert(code, check.Equals, 200)
+	c.Check(body["result"], check.DeepEquals, map[string]interface{}{
+		"fw1": map[string]interface{}{"version": "1.2"},
+	})
+
+	code, body = s.getStateData(c, "missing")
+	c.Assert(code, check.Equals, 404)
+	c.Check(body["result"], check.DeepEquals, map[string]interface{}{
+		"message": `state data key "missing" not found`,
+	})
+
+	// Keys that exist but aren't allowed can't be read.
+	code, body = s.getStateData(c, "secrets")
+	c.Assert(code, check.Equals, 403)
+	c.Check(body["result"], check.DeepEquals, map[string]interface{}{
+		"message": `state data key "secrets" is not allowed`,
+	})
+}
+
+func (s *apiSuite) TestStateDataNoneAllowed(c *check.C) {
+	s.daemon(c)
+
+	code, _ := s.getStateData(c, "timings")
+	c.Check(code, check.Equals, 403)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+func (s *apiSuite) TestStateInfo(c *check.C) {
+	d := s.daemon(c)
+
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.NewChange("foo", "Foo")
+	chg.AddTask(st.NewTask("bar", "Bar"))
+	chg.AddTask(st.NewTask("baz", "Baz"))
+	st.Warnf("danger")
+	_, err := st.AddNotice(nil, state.CustomNotice, "example.com/x", nil)
+	c.Assert(err, check.IsNil)
+	st.Unlock() // checkpoints the state to disk
+
+	statePath := filepath.Join(s.pebbleDir, ".pebble.state")
+	fi, err := os.Stat(statePath)
+	c.Assert(err, check.IsNil)
+
+	cmd := apiCmd("/v1/state-info")
+	req, err := http.NewRequest("GET", "/v1/state-info", nil)
+	c.Assert(err, check.IsNil)
+	rsp, ok := v1GetStateInfo(cmd, req, nil).(*resp)
+	c.Assert(ok, check.Equals, true)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Type, check.Equals, ResponseTypeSync)
+
+	info, ok := rsp.Result.(stateInfo)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(info.Modified, check.NotNil)
+	c.Check(info.Modified.Equal(fi.ModTime()), check.Equals, true)
+	info.Modified = nil
+	// The lock was taken when making the change, and again by the request.
+	c.Check(info.Lock.Bounds, check.DeepEquals, state.LockBuckets)
+	c.Check(info.Lock.Wait.Count >= 2, check.Equals, true)
+	c.Check(info.Lock.Hold.Count >= 1, check.Equals, true)
+	info.Lock = state.LockStats{}
+	// No tasks have been run.
+	c.Check(info.TaskWait, check.DeepEquals, state.TaskWaitStats{
+		Bounds: state.TaskWaitBuckets,
+		Kinds:  map[string]state.Histogram{},
+	})
+	info.TaskWait = state.TaskWaitStats{}
+	c.Check(info, check.DeepEquals, stateInfo{
+		Path:     statePath,
+		Size:     fi.Size(),
+		Changes:  1,
+		Tasks:    2,
+		Warnings: 1,
+		Notices:  2, // the warning also records a notice
+	})
+}
@@ -58,6 +58,35 @@ func v1GetTaskWebsocket(c *Command, req *http.Request, _ *UserState) Response {
 	}
 }
 
+func v1GetTaskTranscript(c *Command, req *http.Request, _ *UserState) Response {
+	taskID := muxVars(req)["task-id"]
+
+	st := c.d.overlord.State()
+	st.Lock()
+	task := st.Task(taskID)
+	var kind string
+	if task != nil {
+		kind = task.Kind()
+	}
+	st.Unlock()
+
+	if task == nil {
+		return NotFound("cannot find task with id %q", taskID)
+	}
+	if kind != "exec" {
+		return BadRequest("%q tasks do not have transcripts", kind)
+	}
+
+	events, err := c.d.overlord.CommandManager().ReadTranscript(taskID)
+	if errors.Is(err, os.ErrNotExist) {
+		return NotFound("exec task %q was not recorded", taskID)
+	}
+	if err != nil {
+		return InternalError("cannot read transcript: %v", err)
+	}
+	return SyncResponse(events)
+}
+
 type websocketConnectFunc func(r *http.Request, w http.ResponseWriter, task *state.Task, websocketID string) error
 
 type websocketResponse struct {
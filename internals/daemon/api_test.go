@@ -15,10 +15,15 @@
 package daemon
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -106,18 +111,31 @@ func (s *apiSuite) TestSysInfo(c *check.C) {
 
 	d := s.daemon(c)
 	d.Version = "42b1"
+	d.StartTime = time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
 	state := d.overlord.State()
 	state.Lock()
 	restart.Init(state, "ffffffff-ffff-ffff-ffff-ffffffffffff", nil)
-	state.Unlock()
+	state.Unlock() // checkpoints the state to disk
+
+	oldBootTime := osutilBootTime
+	osutilBootTime = func() (time.Time, error) {
+		return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), nil
+	}
+	defer func() { osutilBootTime = oldBootTime }()
 
 	sysInfoCmd.GET(sysInfoCmd, nil, nil).ServeHTTP(rec, nil)
 	c.Check(rec.Code, check.Equals, 200)
 	c.Check(rec.Result().Header.Get("Content-Type"), check.Equals, "application/json")
 
+	// The plan is empty, so its YAML is "{}\n".
+	planHash := sha256.Sum256([]byte("{}\n"))
 	expected := map[string]interface{}{
-		"version": "42b1",
-		"boot-id": "ffffffff-ffff-ffff-ffff-ffffffffffff",
+		"version":      "42b1",
+		"boot-id":      "ffffffff-ffff-ffff-ffff-ffffffffffff",
+		"architecture": runtime.GOARCH,
+		"plan-hash":    hex.EncodeToString(planHash[:]),
+		"start-time":   "2024-05-01T12:30:00Z",
+		"boot-time":    "2024-05-01T12:00:00Z",
 	}
 	var rsp resp
 	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
@@ -126,6 +144,49 @@ func (s *apiSuite) TestSysInfo(c *check.C) {
 	c.Check(rsp.Result, check.DeepEquals, expected)
 }
 
+func (s *apiSuite) TestSystemStatus(c *check.C) {
+	statusCmd := apiCmd("/v1/system-status")
+	c.Check(statusCmd.ReadAccess, check.Equals, UserAccess{})
+
+	s.daemon(c)
+	fi, err := os.Stat(filepath.Join(s.pebbleDir, ".pebble.state"))
+	c.Assert(err, check.IsNil)
+
+	rec := httptest.NewRecorder()
+	statusCmd.GET(statusCmd, nil, nil).ServeHTTP(rec, nil)
+	c.Check(rec.Code, check.Equals, 200)
+
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
+	c.Check(rsp.Result, check.DeepEquals, map[string]interface{}{
+		"state-size": float64(fi.Size()),
+		// The overlord hasn't been started, so its managers aren't ready.
+		"managers-ready": false,
+	})
+}
+
+func (s *apiSuite) TestSystemStatusConfigSource(c *check.C) {
+	statusCmd := apiCmd("/v1/system-status")
+	d, err := New(&Options{
+		Dir:          s.pebbleDir,
+		ConfigSource: "https://localhost:0/bundle",
+	})
+	c.Assert(err, check.IsNil)
+	d.addRoutes()
+	s.d = d
+
+	rec := httptest.NewRecorder()
+	statusCmd.GET(statusCmd, nil, nil).ServeHTTP(rec, nil)
+	c.Check(rec.Code, check.Equals, 200)
+
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
+	result := rsp.Result.(map[string]interface{})
+	c.Check(result["config-source"], check.DeepEquals, map[string]interface{}{
+		"url": "https://localhost:0/bundle",
+	})
+}
+
 func fakeEnv(key, value string) (restore func()) {
 	oldEnv, envWasSet := os.LookupEnv(key)
 	err := os.Setenv(key, value)
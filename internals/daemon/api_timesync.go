@@ -0,0 +1,64 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/canonical/pebble/internals/overlord"
+	"github.com/canonical/pebble/internals/overlord/timesyncstate"
+)
+
+type timeSyncInfo struct {
+	Synchronized bool       `json:"synchronized"`
+	Server       string     `json:"server,omitempty"`
+	Offset       string     `json:"offset,omitempty"`
+	LastSync     *time.Time `json:"last-sync,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+var getTimeSyncStatus = func(o *overlord.Overlord) timesyncstate.Status {
+	return o.TimeSyncManager().Status()
+}
+
+// v1GetTimeSync returns the time synchronisation status. Like the health
+// endpoint, it responds with "502 Bad Gateway" if the clock isn't
+// synchronised, so that it can be used as the target of an HTTP check.
+func v1GetTimeSync(c *Command, r *http.Request, _ *UserState) Response {
+	status := getTimeSyncStatus(c.d.overlord)
+
+	info := timeSyncInfo{
+		Synchronized: status.Synchronized,
+		Server:       status.Server,
+		Error:        status.Error,
+	}
+	if !status.LastSync.IsZero() {
+		info.Offset = status.Offset.String()
+		info.LastSync = &status.LastSync
+	}
+
+	code := http.StatusOK
+	if !status.Synchronized {
+		code = http.StatusBadGateway
+	}
+	// Use healthResp, as the status doesn't require the state lock.
+	return &healthResp{
+		Type:       ResponseTypeSync,
+		Status:     code,
+		StatusText: http.StatusText(code),
+		Result:     info,
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord"
+	"github.com/canonical/pebble/internals/overlord/timesyncstate"
+)
+
+var _ = Suite(&timeSyncSuite{})
+
+type timeSyncSuite struct{}
+
+func (s *timeSyncSuite) TestSynchronized(c *C) {
+	lastSync := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	restore := FakeGetTimeSyncStatus(func(o *overlord.Overlord) timesyncstate.Status {
+		return timesyncstate.Status{
+			Synchronized: true,
+			Server:       "pool",
+			Offset:       -3 * time.Millisecond,
+			LastSync:     lastSync,
+		}
+	})
+	defer restore()
+
+	status, response := serveTimeSync(c)
+
+	c.Assert(status, Equals, 200)
+	c.Assert(response, DeepEquals, map[string]interface{}{
+		"synchronized": true,
+		"server":       "pool",
+		"offset":       "-3ms",
+		"last-sync":    "2024-05-01T12:00:00Z",
+	})
+}
+
+func (s *timeSyncSuite) TestNotSynchronized(c *C) {
+	restore := FakeGetTimeSyncStatus(func(o *overlord.Overlord) timesyncstate.Status {
+		return timesyncstate.Status{
+			Error: `cannot query time server "pool": i/o timeout`,
+		}
+	})
+	defer restore()
+
+	status, response := serveTimeSync(c)
+
+	c.Assert(status, Equals, 502)
+	c.Assert(response, DeepEquals, map[string]interface{}{
+		"synchronized": false,
+		"error":        `cannot query time server "pool": i/o timeout`,
+	})
+}
+
+func serveTimeSync(c *C) (int, map[string]interface{}) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/v1/time-sync", nil)
+	c.Assert(err, IsNil)
+
+	server := v1GetTimeSync(&Command{d: &Daemon{}}, request, nil)
+	server.ServeHTTP(recorder, request)
+
+	c.Assert(recorder.Result().Header.Get("Content-Type"), Equals, "application/json")
+	var response map[string]interface{}
+	err = json.NewDecoder(recorder.Result().Body).Decode(&response)
+	c.Assert(err, IsNil)
+	return recorder.Result().StatusCode, response["result"].(map[string]interface{})
+}
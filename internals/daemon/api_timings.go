@@ -0,0 +1,38 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/canonical/pebble/internals/timing"
+)
+
+// v1GetTimings returns the timings recorded by the daemon, such as those of
+// each startup phase, oldest first.
+func v1GetTimings(c *Command, r *http.Request, _ *UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	timings, err := timing.Get(st)
+	if err != nil {
+		return InternalError("cannot get timings: %v", err)
+	}
+	if timings == nil {
+		timings = []*timing.Span{}
+	}
+	return SyncResponse(timings)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/timing"
+)
+
+func (s *apiSuite) TestTimings(c *check.C) {
+	d := s.daemon(c)
+
+	st := d.overlord.State()
+	st.Lock()
+	// Drop the timings recorded while starting the overlord.
+	st.SaveTimings(nil)
+	span := timing.Start("", "", map[string]string{"startup": "test"})
+	nested := span.StartNested("foo", "do foo")
+	nested.Stop()
+	span.Stop()
+	err := span.Save(st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	cmd := apiCmd("/v1/debug/timings")
+	req, err := http.NewRequest("GET", "/v1/debug/timings", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	v1GetTimings(cmd, req, nil).ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, 200)
+
+	var body struct {
+		Result []struct {
+			Tags  map[string]string `json:"tags"`
+			Spans []struct {
+				Label string `json:"label"`
+				Depth int    `json:"depth"`
+			} `json:"spans"`
+		} `json:"result"`
+	}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), check.IsNil)
+	c.Assert(body.Result, check.HasLen, 1)
+	c.Check(body.Result[0].Tags, check.DeepEquals, map[string]string{"startup": "test"})
+	// The nested span is shorter than timing.MinNestedSpan, so it's elided.
+	c.Check(body.Result[0].Spans, check.HasLen, 0)
+}
+
+func (s *apiSuite) TestTimingsNone(c *check.C) {
+	d := s.daemon(c)
+
+	st := d.overlord.State()
+	st.Lock()
+	st.SaveTimings(nil)
+	st.Unlock()
+
+	cmd := apiCmd("/v1/debug/timings")
+	req, err := http.NewRequest("GET", "/v1/debug/timings", nil)
+	c.Assert(err, check.IsNil)
+	rsp, ok := v1GetTimings(cmd, req, nil).(*resp)
+	c.Assert(ok, check.Equals, true)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []*timing.Span{})
+}
@@ -25,6 +25,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
@@ -43,6 +44,7 @@ import (
 	"github.com/canonical/pebble/internals/overlord/servstate"
 	"github.com/canonical/pebble/internals/overlord/standby"
 	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/profiler"
 	"github.com/canonical/pebble/internals/reaper"
 	"github.com/canonical/pebble/internals/systemd"
 )
@@ -78,6 +80,55 @@ type Options struct {
 	// OverlordExtension is an optional interface used to extend the capabilities
 	// of the Overlord.
 	OverlordExtension overlord.Extension
+
+	// WatchLayers enables reloading the plan when files in the layers
+	// directory are added, changed, or removed.
+	WatchLayers bool
+
+	// CachePlan enables caching the combined plan across restarts, to speed
+	// up startup when the layers haven't changed.
+	CachePlan bool
+
+	// PersistLogs enables keeping service logs in files in the "logs"
+	// directory, so that they survive restarts of the daemon.
+	PersistLogs bool
+
+	// ProfileInterval, if set, enables writing CPU and heap profiles of the
+	// daemon to the "profiles" directory at this interval.
+	ProfileInterval time.Duration
+
+	// ProfileKeep is how many profiles of each kind to keep when
+	// ProfileInterval is set. Older profiles are removed.
+	ProfileKeep int
+
+	// CheckpointDelay, if set, defers writing the state to disk for this
+	// long after it's modified, reducing writes on flash storage.
+	CheckpointDelay time.Duration
+
+	// MemoryOnlyNoticeTypes are the notice types that aren't written to
+	// the state file, so they're lost when the daemon restarts.
+	MemoryOnlyNoticeTypes []state.NoticeType
+
+	// ConfigSource, if set, is the HTTPS URL of a signed layer bundle that
+	// is fetched every ConfigSourceInterval and applied to the plan.
+	ConfigSource         string
+	ConfigSourceInterval time.Duration
+
+	// RequireSignedLayers, if set, rejects layers added via the API unless
+	// they're signed by a key in the "trusted-keys" directory, as well as
+	// removing and moving layers via the API.
+	RequireSignedLayers bool
+
+	// MaxRunningTasks, if set, limits how many tasks run at once.
+	MaxRunningTasks int
+
+	// TaskPriorities maps task kinds to their priority, so that tasks of
+	// kinds with a higher priority are started first.
+	TaskPriorities map[string]int
+
+	// DebugStateDataKeys are the keys of the managers' data in the state
+	// that admins may read via /v1/debug/state-data/{key}.
+	DebugStateDataKeys []string
 }
 
 // A Daemon listens for requests and routes them to the right command
@@ -87,6 +138,8 @@ type Daemon struct {
 	pebbleDir        string
 	normalSocketPath string
 	httpAddress      string
+	profileOptions   profiler.Options
+	profiler         *profiler.Profiler
 	overlord         *overlord.Overlord
 	state            *state.State
 	generalListener  net.Listener
@@ -105,6 +158,10 @@ type Daemon struct {
 
 	rebootIsMissing bool
 
+	requireSignedLayers bool
+
+	debugStateDataKeys []string
+
 	mu sync.Mutex
 }
 
@@ -404,6 +461,14 @@ func (d *Daemon) Start() error {
 
 	d.StartTime = time.Now()
 
+	if d.profileOptions.Interval > 0 {
+		p, err := profiler.Start(d.profileOptions)
+		if err != nil {
+			return fmt.Errorf("cannot start profiler: %w", err)
+		}
+		d.profiler = p
+	}
+
 	d.connTracker = &connTracker{conns: make(map[net.Conn]struct{})}
 	d.serve = &http.Server{
 		Handler:   logit(d.router),
@@ -503,6 +568,10 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 
 	d.standbyOpinions.Stop()
 
+	if d.profiler != nil {
+		d.profiler.Stop()
+	}
+
 	if requestedRestart == restart.RestartSystem {
 		// give time to polling clients to notice restart
 		time.Sleep(rebootNoticeWait)
@@ -774,13 +843,29 @@ func New(opts *Options) (*Daemon, error) {
 		pebbleDir:        opts.Dir,
 		normalSocketPath: opts.SocketPath,
 		httpAddress:      opts.HTTPAddress,
+		profileOptions: profiler.Options{
+			Dir:      filepath.Join(opts.Dir, "profiles"),
+			Interval: opts.ProfileInterval,
+			Keep:     opts.ProfileKeep,
+		},
+		requireSignedLayers: opts.RequireSignedLayers,
+		debugStateDataKeys:  opts.DebugStateDataKeys,
 	}
 
 	ovldOptions := overlord.Options{
-		PebbleDir:      opts.Dir,
-		RestartHandler: d,
-		ServiceOutput:  opts.ServiceOutput,
-		Extension:      opts.OverlordExtension,
+		PebbleDir:             opts.Dir,
+		RestartHandler:        d,
+		ServiceOutput:         opts.ServiceOutput,
+		Extension:             opts.OverlordExtension,
+		WatchLayers:           opts.WatchLayers,
+		CachePlan:             opts.CachePlan,
+		PersistLogs:           opts.PersistLogs,
+		CheckpointDelay:       opts.CheckpointDelay,
+		MemoryOnlyNoticeTypes: opts.MemoryOnlyNoticeTypes,
+		ConfigSource:          opts.ConfigSource,
+		ConfigSourceInterval:  opts.ConfigSourceInterval,
+		MaxRunningTasks:       opts.MaxRunningTasks,
+		TaskPriorities:        opts.TaskPriorities,
 	}
 
 	ovld, err := overlord.New(&ovldOptions)
@@ -592,6 +592,35 @@ func (s *daemonSuite) TestStartStop(c *C) {
 	c.Check(err, IsNil)
 }
 
+func (s *daemonSuite) TestProfiler(c *C) {
+	d, err := New(&Options{
+		Dir:             s.pebbleDir,
+		SocketPath:      s.socketPath,
+		ProfileInterval: 20 * time.Millisecond,
+		ProfileKeep:     1,
+	})
+	c.Assert(err, IsNil)
+	d.addRoutes()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	d.generalListener = l
+
+	c.Assert(d.Start(), IsNil)
+
+	profilesDir := filepath.Join(s.pebbleDir, "profiles")
+	var heap []string
+	for i := 0; i < 200 && len(heap) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		heap, err = filepath.Glob(filepath.Join(profilesDir, "heap-*.pprof"))
+		c.Assert(err, IsNil)
+	}
+	c.Check(heap, HasLen, 1)
+
+	err = d.Stop(nil)
+	c.Check(err, IsNil)
+}
+
 func (s *daemonSuite) TestRestartWiring(c *C) {
 	d := s.newDaemon(c)
 
@@ -1275,6 +1304,22 @@ func (s *daemonSuite) TestWritesRequireAdminAccess(c *C) {
 	case OpenAccess, UserAccess:
 		c.Errorf("%s ReadAccess should be AdminAccess, not %T", cmd.Path, cmd.WriteAccess)
 	}
+
+	// Exec transcripts include the session's input and output, so require
+	// admin access too.
+	cmd = apiCmd("/v1/tasks/{task-id}/transcript")
+	switch cmd.ReadAccess.(type) {
+	case OpenAccess, UserAccess:
+		c.Errorf("%s ReadAccess should be AdminAccess, not %T", cmd.Path, cmd.WriteAccess)
+	}
+
+	// Profiles expose the daemon's internals and cost CPU to collect, so
+	// require admin access too.
+	cmd = apiCmd("/v1/debug/pprof/{profile}")
+	switch cmd.ReadAccess.(type) {
+	case OpenAccess, UserAccess:
+		c.Errorf("%s ReadAccess should be AdminAccess, not %T", cmd.Path, cmd.WriteAccess)
+	}
 }
 
 func (s *daemonSuite) TestAPIAccessLevels(c *C) {
@@ -1291,6 +1336,17 @@ func (s *daemonSuite) TestAPIAccessLevels(c *C) {
 
 		{"GET", "/v1/health", ``, -1, http.StatusOK},
 
+		// Not synchronised, as the plan has no time servers.
+		{"GET", "/v1/time-sync", ``, -1, http.StatusBadGateway},
+
+		{"GET", "/v1/state-info", ``, -1, http.StatusUnauthorized},
+		{"GET", "/v1/state-info", ``, 42, http.StatusOK},
+		{"GET", "/v1/state-info", ``, 0, http.StatusOK},
+
+		{"GET", "/v1/managers", ``, -1, http.StatusUnauthorized},
+		{"GET", "/v1/managers", ``, 42, http.StatusOK},
+		{"GET", "/v1/managers", ``, 0, http.StatusOK},
+
 		{"GET", "/v1/warnings", ``, -1, http.StatusUnauthorized},
 		{"GET", "/v1/warnings", ``, 42, http.StatusOK},
 		{"GET", "/v1/warnings", ``, 0, http.StatusOK},
@@ -1309,6 +1365,15 @@ func (s *daemonSuite) TestAPIAccessLevels(c *C) {
 		{"POST", "/v1/services", ``, 42, http.StatusUnauthorized},
 		{"POST", "/v1/services", ``, 0, http.StatusBadRequest},
 
+		{"GET", "/v1/plan/diff", ``, -1, http.StatusUnauthorized},
+		{"GET", "/v1/plan/diff", ``, 42, http.StatusBadRequest},
+		{"POST", "/v1/plan/diff", ``, -1, http.StatusUnauthorized},
+		{"POST", "/v1/plan/diff", ``, 42, http.StatusUnauthorized},
+		{"POST", "/v1/plan/diff", ``, 0, http.StatusBadRequest},
+
+		{"GET", "/v1/layers", ``, -1, http.StatusUnauthorized},
+		{"GET", "/v1/layers", ``, 42, http.StatusOK},
+		{"GET", "/v1/layers", ``, 0, http.StatusOK},
 		{"POST", "/v1/layers", ``, -1, http.StatusUnauthorized},
 		{"POST", "/v1/layers", ``, 42, http.StatusUnauthorized},
 		{"POST", "/v1/layers", ``, 0, http.StatusBadRequest},
@@ -1332,6 +1397,18 @@ func (s *daemonSuite) TestAPIAccessLevels(c *C) {
 		{"POST", "/v1/signals", `{}`, 42, http.StatusUnauthorized},
 		{"POST", "/v1/signals", `{}`, 0, http.StatusBadRequest},
 
+		{"GET", "/v1/debug/pprof/{profile}", ``, -1, http.StatusUnauthorized},
+		{"GET", "/v1/debug/pprof/{profile}", ``, 42, http.StatusUnauthorized},
+		{"GET", "/v1/debug/pprof/{profile}", ``, 0, http.StatusNotFound}, // no profile name
+
+		{"GET", "/v1/debug/timings", ``, -1, http.StatusUnauthorized},
+		{"GET", "/v1/debug/timings", ``, 42, http.StatusOK},
+		{"GET", "/v1/debug/timings", ``, 0, http.StatusOK},
+
+		{"GET", "/v1/inventory", ``, -1, http.StatusUnauthorized},
+		{"GET", "/v1/inventory", ``, 42, http.StatusOK},
+		{"GET", "/v1/inventory", ``, 0, http.StatusOK},
+
 		{"GET", "/v1/checks", ``, -1, http.StatusUnauthorized},
 		{"GET", "/v1/checks", ``, 42, http.StatusOK},
 		{"GET", "/v1/checks", ``, 0, http.StatusOK},
@@ -20,7 +20,10 @@ import (
 
 	"github.com/canonical/pebble/internals/overlord"
 	"github.com/canonical/pebble/internals/overlord/checkstate"
+	"github.com/canonical/pebble/internals/overlord/inventorystate"
+	"github.com/canonical/pebble/internals/overlord/logstate"
 	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/overlord/timesyncstate"
 )
 
 func FakeMuxVars(f func(*http.Request) map[string]string) (restore func()) {
@@ -47,6 +50,22 @@ func FakeGetChecks(f func(o *overlord.Overlord) ([]*checkstate.CheckInfo, error)
 	}
 }
 
+func FakeGetTimeSyncStatus(f func(o *overlord.Overlord) timesyncstate.Status) (restore func()) {
+	old := getTimeSyncStatus
+	getTimeSyncStatus = f
+	return func() {
+		getTimeSyncStatus = old
+	}
+}
+
+func FakeGetLogTargetStatus(f func(o *overlord.Overlord) map[string]logstate.TargetStatus) (restore func()) {
+	old := getLogTargetStatus
+	getLogTargetStatus = f
+	return func() {
+		getLogTargetStatus = old
+	}
+}
+
 func FakeSyscallSync(f func()) (restore func()) {
 	old := syscallSync
 	syscallSync = f
@@ -62,3 +81,11 @@ func FakeSyscallReboot(f func(cmd int) error) (restore func()) {
 		syscallReboot = old
 	}
 }
+
+func FakeGetInventory(f func(o *overlord.Overlord) *inventorystate.Inventory) (restore func()) {
+	old := getInventory
+	getInventory = f
+	return func() {
+		getInventory = old
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
 )
 
 type ResponseType string
@@ -125,6 +126,7 @@ const (
 	errorKindGenericFileError  = errorKind("generic-file-error")
 	errorKindSystemRestart     = errorKind("system-restart")
 	errorKindDaemonRestart     = errorKind("daemon-restart")
+	errorKindChangeConflict    = errorKind("change-conflict")
 )
 
 type errorResult struct {
@@ -189,6 +191,21 @@ func ErrorResponse(status int, format string, v ...interface{}) Response {
 	}
 }
 
+// changeConflictResponse builds a "409 Conflict" error Response for a change
+// that conflicts with the given change in progress, which is described in the
+// error value.
+func changeConflictResponse(conflict *state.ChangeConflictError, format string, v ...interface{}) Response {
+	rsp := ErrorResponse(http.StatusConflict, format, v...).(*resp)
+	result := rsp.Result.(*errorResult)
+	result.Kind = errorKindChangeConflict
+	result.Value = map[string]string{
+		"object":      conflict.Object,
+		"change-kind": conflict.ChangeKind,
+		"change-id":   conflict.ChangeID,
+	}
+	return rsp
+}
+
 func makeErrorResponder(status int) errorResponder {
 	return func(format string, v ...interface{}) Response {
 		return ErrorResponse(status, format, v...)
@@ -0,0 +1,56 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package isolation runs commands in new Linux namespaces, with a private
+// /tmp, read-only paths, or no network access, and with resource limits.
+//
+// Mounts must be made in the new mount namespace after the command's
+// process is created but before the command is executed, which Go can't do
+// between fork and exec. Instead, the current executable is run as a helper
+// in the new namespaces. The helper sets up the mounts and network, sets
+// the resource limits, drops privileges, and then executes the command in
+// its place.
+package isolation
+
+// Options holds the isolation options for a command.
+type Options struct {
+	// PrivateTmp mounts a new, empty tmpfs on /tmp.
+	PrivateTmp bool `json:"private-tmp,omitempty"`
+
+	// ReadOnlyPaths are absolute paths that are made read-only.
+	ReadOnlyPaths []string `json:"read-only-paths,omitempty"`
+
+	// PrivateNetwork runs the command in a new network namespace, with
+	// only a loopback interface.
+	PrivateNetwork bool `json:"private-network,omitempty"`
+
+	// Rlimits are resource limits set for the command.
+	Rlimits []Rlimit `json:"rlimits,omitempty"`
+}
+
+// Rlimit is a resource limit, with the resource named as in setrlimit(2)
+// without the RLIMIT_ prefix (for example, "nofile").
+type Rlimit struct {
+	Resource string `json:"resource"`
+	Soft     uint64 `json:"soft"`
+	Hard     uint64 `json:"hard"`
+}
+
+// helperArg0 is the program name the helper is run with, which is how it
+// recognises that it is the helper.
+const helperArg0 = "pebble-isolation-helper"
+
+func (opts *Options) newMountNamespace() bool {
+	return opts.PrivateTmp || len(opts.ReadOnlyPaths) > 0
+}
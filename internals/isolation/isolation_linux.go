@@ -0,0 +1,212 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package isolation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// rlimitResources maps resource limit names to their setrlimit resources.
+var rlimitResources = map[string]int{
+	"as":         unix.RLIMIT_AS,
+	"core":       unix.RLIMIT_CORE,
+	"cpu":        unix.RLIMIT_CPU,
+	"data":       unix.RLIMIT_DATA,
+	"fsize":      unix.RLIMIT_FSIZE,
+	"locks":      unix.RLIMIT_LOCKS,
+	"memlock":    unix.RLIMIT_MEMLOCK,
+	"msgqueue":   unix.RLIMIT_MSGQUEUE,
+	"nice":       unix.RLIMIT_NICE,
+	"nofile":     unix.RLIMIT_NOFILE,
+	"nproc":      unix.RLIMIT_NPROC,
+	"rss":        unix.RLIMIT_RSS,
+	"rtprio":     unix.RLIMIT_RTPRIO,
+	"rttime":     unix.RLIMIT_RTTIME,
+	"sigpending": unix.RLIMIT_SIGPENDING,
+	"stack":      unix.RLIMIT_STACK,
+}
+
+// selfExe is the path the helper is executed from.
+var selfExe = "/proc/self/exe"
+
+// helperConfig is passed to the helper as its first argument.
+type helperConfig struct {
+	Options
+	Path       string              `json:"path"`
+	Credential *syscall.Credential `json:"credential,omitempty"`
+}
+
+// Command configures cmd, which must not have been started, to run with
+// the given isolation options. Setting up the namespaces requires root, so
+// any credential already set in cmd.SysProcAttr is applied by the helper
+// after the namespaces are set up.
+func Command(cmd *exec.Cmd, opts *Options) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	for _, path := range opts.ReadOnlyPaths {
+		if len(path) == 0 || path[0] != '/' {
+			return fmt.Errorf("read-only path %q must be absolute", path)
+		}
+	}
+	for _, limit := range opts.Rlimits {
+		if _, ok := rlimitResources[limit.Resource]; !ok {
+			return fmt.Errorf("unknown resource limit %q", limit.Resource)
+		}
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	config := helperConfig{
+		Options:    *opts,
+		Path:       cmd.Path,
+		Credential: cmd.SysProcAttr.Credential,
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	if opts.newMountNamespace() {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNS
+	}
+	if opts.PrivateNetwork {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr.Credential = nil
+	cmd.Path = selfExe
+	cmd.Args = append([]string{helperArg0, string(data)}, cmd.Args...)
+	return nil
+}
+
+func init() {
+	if len(os.Args) < 3 || os.Args[0] != helperArg0 {
+		return
+	}
+	err := runHelper(os.Args[1], os.Args[2:])
+	// The helper only returns if it fails: on success, it's replaced by
+	// the command.
+	fmt.Fprintf(os.Stderr, "cannot run isolated command: %v\n", err)
+	os.Exit(1)
+}
+
+func runHelper(configJSON string, args []string) error {
+	var config helperConfig
+	err := json.Unmarshal([]byte(configJSON), &config)
+	if err != nil {
+		return fmt.Errorf("invalid helper configuration: %w", err)
+	}
+
+	if config.newMountNamespace() {
+		// Keep the mounts below from propagating back to the host.
+		err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+		if err != nil {
+			return fmt.Errorf("cannot make mounts private: %w", err)
+		}
+	}
+	if config.PrivateTmp {
+		err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777")
+		if err != nil {
+			return fmt.Errorf("cannot mount private /tmp: %w", err)
+		}
+	}
+	for _, path := range config.ReadOnlyPaths {
+		err := syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REC, "")
+		if err != nil {
+			return fmt.Errorf("cannot bind mount %q: %w", path, err)
+		}
+		err = syscall.Mount("", path, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, "")
+		if err != nil {
+			return fmt.Errorf("cannot make %q read-only: %w", path, err)
+		}
+	}
+	if config.PrivateNetwork {
+		err := loopbackUp()
+		if err != nil {
+			return fmt.Errorf("cannot bring up loopback interface: %w", err)
+		}
+	}
+
+	// Set limits before dropping privileges, which may be needed to raise
+	// hard limits.
+	for _, limit := range config.Rlimits {
+		rlim := unix.Rlimit{Cur: limit.Soft, Max: limit.Hard}
+		err := unix.Setrlimit(rlimitResources[limit.Resource], &rlim)
+		if err != nil {
+			return fmt.Errorf("cannot set %s limit: %w", limit.Resource, err)
+		}
+	}
+
+	if cred := config.Credential; cred != nil {
+		if !cred.NoSetGroups {
+			groups := make([]int, len(cred.Groups))
+			for i, g := range cred.Groups {
+				groups[i] = int(g)
+			}
+			err := syscall.Setgroups(groups)
+			if err != nil {
+				return fmt.Errorf("cannot set supplementary groups: %w", err)
+			}
+		}
+		err := syscall.Setgid(int(cred.Gid))
+		if err != nil {
+			return fmt.Errorf("cannot set group ID: %w", err)
+		}
+		err = syscall.Setuid(int(cred.Uid))
+		if err != nil {
+			return fmt.Errorf("cannot set user ID: %w", err)
+		}
+	}
+
+	return syscall.Exec(config.Path, args, os.Environ())
+}
+
+// ifreqFlags is the layout of struct ifreq used by the SIOCGIFFLAGS and
+// SIOCSIFFLAGS ioctls.
+type ifreqFlags struct {
+	Name  [syscall.IFNAMSIZ]byte
+	Flags uint16
+	_     [22]byte
+}
+
+// loopbackUp brings up the loopback interface, which is down in a new
+// network namespace.
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	var ifr ifreqFlags
+	copy(ifr.Name[:], "lo")
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&ifr)))
+	if errno != 0 {
+		return errno
+	}
+	ifr.Flags |= syscall.IFF_UP
+	_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
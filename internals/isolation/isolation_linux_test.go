@@ -0,0 +1,155 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package isolation_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/isolation"
+	"github.com/canonical/pebble/internals/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type isolationSuite struct{}
+
+var _ = Suite(&isolationSuite{})
+
+func (s *isolationSuite) TestCommand(c *C) {
+	cmd := exec.Command("/bin/echo", "hello")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Credential: &syscall.Credential{Uid: 1000, Gid: 1000},
+	}
+	err := isolation.Command(cmd, &isolation.Options{
+		PrivateTmp:     true,
+		PrivateNetwork: true,
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(cmd.Path, Equals, "/proc/self/exe")
+	c.Assert(cmd.Args, HasLen, 4)
+	c.Check(cmd.Args[0], Equals, "pebble-isolation-helper")
+	c.Check(cmd.Args[1], Equals, `{"private-tmp":true,"private-network":true,"path":"/bin/echo","credential":{"Uid":1000,"Gid":1000,"Groups":null,"NoSetGroups":false}}`)
+	c.Check(cmd.Args[2:], DeepEquals, []string{"/bin/echo", "hello"})
+	c.Check(cmd.SysProcAttr.Setpgid, Equals, true)
+	c.Check(cmd.SysProcAttr.Credential, IsNil)
+	c.Check(cmd.SysProcAttr.Cloneflags, Equals, uintptr(syscall.CLONE_NEWNS|syscall.CLONE_NEWNET))
+}
+
+func (s *isolationSuite) TestCommandNetworkOnly(c *C) {
+	cmd := exec.Command("/bin/echo")
+	err := isolation.Command(cmd, &isolation.Options{PrivateNetwork: true})
+	c.Assert(err, IsNil)
+	c.Check(cmd.SysProcAttr.Cloneflags, Equals, uintptr(syscall.CLONE_NEWNET))
+}
+
+func (s *isolationSuite) TestCommandRelativePath(c *C) {
+	cmd := exec.Command("/bin/echo")
+	err := isolation.Command(cmd, &isolation.Options{ReadOnlyPaths: []string{"etc"}})
+	c.Assert(err, ErrorMatches, `read-only path "etc" must be absolute`)
+}
+
+func (s *isolationSuite) TestCommandRlimits(c *C) {
+	cmd := exec.Command("/bin/echo")
+	err := isolation.Command(cmd, &isolation.Options{
+		Rlimits: []isolation.Rlimit{{Resource: "nofile", Soft: 1024, Hard: 4096}},
+	})
+	c.Assert(err, IsNil)
+	c.Check(cmd.Args[1], Equals, `{"rlimits":[{"resource":"nofile","soft":1024,"hard":4096}],"path":"/bin/echo"}`)
+	c.Check(cmd.SysProcAttr.Cloneflags, Equals, uintptr(0))
+}
+
+func (s *isolationSuite) TestCommandUnknownRlimit(c *C) {
+	cmd := exec.Command("/bin/echo")
+	err := isolation.Command(cmd, &isolation.Options{
+		Rlimits: []isolation.Rlimit{{Resource: "files", Soft: 1, Hard: 1}},
+	})
+	c.Assert(err, ErrorMatches, `unknown resource limit "files"`)
+}
+
+func (s *isolationSuite) TestCommandNotFound(c *C) {
+	cmd := exec.Command("no-such-command-for-isolation")
+	err := isolation.Command(cmd, &isolation.Options{PrivateTmp: true})
+	c.Assert(err, ErrorMatches, `.*executable file not found.*`)
+}
+
+// runIsolated runs a shell script with the given options, skipping the
+// test if namespaces can't be created.
+func runIsolated(c *C, opts *isolation.Options, script string) (string, error) {
+	if os.Geteuid() != 0 {
+		c.Skip("isolation requires root")
+	}
+	cmd := exec.Command("/bin/sh", "-c", script)
+	err := isolation.Command(cmd, opts)
+	c.Assert(err, IsNil)
+	output, err := cmd.CombinedOutput()
+	if err != nil && strings.Contains(string(output), "operation not permitted") {
+		c.Skip("cannot create namespaces: " + string(output))
+	}
+	return string(output), err
+}
+
+func (s *isolationSuite) TestPrivateTmp(c *C) {
+	output, err := runIsolated(c, &isolation.Options{PrivateTmp: true},
+		"touch /tmp/pebble-isolation-test && ls -A /tmp")
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Check(output, Equals, "pebble-isolation-test\n")
+	c.Check(filepath.Join("/tmp", "pebble-isolation-test"), testutil.FileAbsent)
+}
+
+func (s *isolationSuite) TestReadOnlyPaths(c *C) {
+	dir := c.MkDir()
+	output, err := runIsolated(c, &isolation.Options{ReadOnlyPaths: []string{dir}},
+		"touch "+dir+"/foo")
+	c.Check(err, NotNil)
+	c.Check(output, Matches, `(?s).*Read-only file system.*`)
+	c.Check(filepath.Join(dir, "foo"), testutil.FileAbsent)
+
+	// The path is still writable outside the command.
+	err = os.WriteFile(filepath.Join(dir, "bar"), nil, 0644)
+	c.Check(err, IsNil)
+}
+
+func (s *isolationSuite) TestPrivateNetwork(c *C) {
+	output, err := runIsolated(c, &isolation.Options{PrivateNetwork: true},
+		"tail -n +3 /proc/net/dev")
+	c.Assert(err, IsNil, Commentf("%s", output))
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	c.Assert(lines, HasLen, 1)
+	c.Check(strings.TrimSpace(lines[0]), Matches, `lo:.*`)
+}
+
+func (s *isolationSuite) TestCredential(c *C) {
+	if os.Geteuid() != 0 {
+		c.Skip("isolation requires root")
+	}
+	cmd := exec.Command("/bin/sh", "-c", "id -u; id -g; ls -A /tmp")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: 65534, Gid: 65534},
+	}
+	err := isolation.Command(cmd, &isolation.Options{PrivateTmp: true})
+	c.Assert(err, IsNil)
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Check(string(output), Equals, "65534\n65534\n")
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !linux
+
+package isolation
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Command configures cmd to run with the given isolation options. It's
+// only supported on Linux.
+func Command(cmd *exec.Cmd, opts *Options) error {
+	return errors.New("namespace isolation is only supported on Linux")
+}
@@ -16,9 +16,11 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -35,6 +37,64 @@ type Logger interface {
 	Debug(msg string)
 }
 
+// A StructuredLogger is a Logger that also records the level and fields of
+// each message. Loggers that don't implement it are sent warnings and errors
+// as notices with a "WARNING " or "ERROR " prefix.
+type StructuredLogger interface {
+	Logger
+	Log(level Level, msg string, fields Fields)
+}
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	DebugLevel Level = iota
+	NoticeLevel
+	WarningLevel
+	ErrorLevel
+	// PanicLevel is only used by Panicf, and is always logged.
+	PanicLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel:   "debug",
+	NoticeLevel:  "notice",
+	WarningLevel: "warning",
+	ErrorLevel:   "error",
+	PanicLevel:   "panic",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// ParseLevel returns the level with the given name: "debug", "notice",
+// "warning" or "error".
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if level != PanicLevel && levelName == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf(`invalid log level %q, must be "debug", "notice", "warning" or "error"`, name)
+}
+
+// Fields holds optional context for a log message, included in structured
+// (JSON) output.
+type Fields struct {
+	// Component is the part of Pebble logging the message, for example
+	// "servstate".
+	Component string `json:"component,omitempty"`
+	// Change is the ID of the change the message relates to.
+	Change string `json:"change,omitempty"`
+	// Service is the name of the service the message relates to.
+	Service string `json:"service,omitempty"`
+}
+
 type nullLogger struct{}
 
 func (nullLogger) Notice(string) {}
@@ -46,6 +106,12 @@ var NullLogger = nullLogger{}
 var (
 	logger     Logger = NullLogger
 	loggerLock sync.Mutex
+
+	// level is the minimum level logged, if levelSet is true. Otherwise
+	// notices and above are logged, and debug messages only if PEBBLE_DEBUG
+	// is set to 1.
+	level    Level
+	levelSet bool
 )
 
 // Panicf notifies the user and then panics
@@ -53,24 +119,133 @@ func Panicf(format string, v ...interface{}) {
 	loggerLock.Lock()
 	defer loggerLock.Unlock()
 	msg := fmt.Sprintf(format, v...)
-	logger.Notice("PANIC " + msg)
+	output(PanicLevel, msg, Fields{})
 	panic(msg)
 }
 
 // Noticef notifies the user of something
 func Noticef(format string, v ...interface{}) {
-	loggerLock.Lock()
-	defer loggerLock.Unlock()
-	msg := fmt.Sprintf(format, v...)
-	logger.Notice(msg)
+	logf(NoticeLevel, Fields{}, format, v...)
 }
 
 // Debugf records something in the debug log
 func Debugf(format string, v ...interface{}) {
+	logf(DebugLevel, Fields{}, format, v...)
+}
+
+// Warningf notifies the user of a problem that Pebble has worked around or
+// will retry.
+func Warningf(format string, v ...interface{}) {
+	logf(WarningLevel, Fields{}, format, v...)
+}
+
+// Errorf notifies the user of a problem that Pebble cannot recover from
+// without intervention.
+func Errorf(format string, v ...interface{}) {
+	logf(ErrorLevel, Fields{}, format, v...)
+}
+
+// FieldLogger logs messages with a set of fields.
+type FieldLogger struct {
+	fields Fields
+}
+
+// WithFields returns a FieldLogger that logs messages with the given fields.
+func WithFields(fields Fields) FieldLogger {
+	return FieldLogger{fields: fields}
+}
+
+// Noticef notifies the user of something.
+func (l FieldLogger) Noticef(format string, v ...interface{}) {
+	logf(NoticeLevel, l.fields, format, v...)
+}
+
+// Debugf records something in the debug log.
+func (l FieldLogger) Debugf(format string, v ...interface{}) {
+	logf(DebugLevel, l.fields, format, v...)
+}
+
+// Warningf notifies the user of a problem that Pebble has worked around or
+// will retry.
+func (l FieldLogger) Warningf(format string, v ...interface{}) {
+	logf(WarningLevel, l.fields, format, v...)
+}
+
+// Errorf notifies the user of a problem that Pebble cannot recover from
+// without intervention.
+func (l FieldLogger) Errorf(format string, v ...interface{}) {
+	logf(ErrorLevel, l.fields, format, v...)
+}
+
+func logf(msgLevel Level, fields Fields, format string, v ...interface{}) {
 	loggerLock.Lock()
 	defer loggerLock.Unlock()
-	msg := fmt.Sprintf(format, v...)
-	logger.Debug(msg)
+	if !enabled(msgLevel) {
+		return
+	}
+	output(msgLevel, fmt.Sprintf(format, v...), fields)
+}
+
+// enabled reports whether messages at the given level are logged. The
+// caller must hold loggerLock.
+func enabled(msgLevel Level) bool {
+	if levelSet {
+		return msgLevel >= level
+	}
+	if msgLevel == DebugLevel {
+		return os.Getenv("PEBBLE_DEBUG") == "1"
+	}
+	return true
+}
+
+// output writes the message to the logger. The caller must hold loggerLock.
+func output(msgLevel Level, msg string, fields Fields) {
+	if l, ok := logger.(StructuredLogger); ok {
+		l.Log(msgLevel, msg, fields)
+		return
+	}
+	if msgLevel == DebugLevel {
+		logger.Debug(msg)
+		return
+	}
+	logger.Notice(textPrefixes[msgLevel] + msg)
+}
+
+// SetLevel sets the minimum level of messages that are logged. It can be
+// called at any time, for example to enable debug logging on a running
+// system.
+func SetLevel(l Level) {
+	loggerLock.Lock()
+	defer loggerLock.Unlock()
+	level = l
+	levelSet = true
+}
+
+// GetLevel returns the minimum level of messages that are logged.
+func GetLevel() Level {
+	loggerLock.Lock()
+	defer loggerLock.Unlock()
+	if levelSet {
+		return level
+	}
+	if os.Getenv("PEBBLE_DEBUG") == "1" {
+		return DebugLevel
+	}
+	return NoticeLevel
+}
+
+// MockLevel sets the log level for the duration of a test, and returns a
+// function to restore the previous setting.
+func MockLevel(l Level) (restore func()) {
+	loggerLock.Lock()
+	oldLevel, oldLevelSet := level, levelSet
+	level, levelSet = l, true
+	loggerLock.Unlock()
+	return func() {
+		loggerLock.Lock()
+		defer loggerLock.Unlock()
+		level, levelSet = oldLevel, oldLevelSet
+	}
 }
 
 // MockLogger replaces the existing logger with a buffer and returns
@@ -93,27 +268,44 @@ func SetLogger(l Logger) (old Logger) {
 	return old
 }
 
+var textPrefixes = map[Level]string{
+	DebugLevel:   "DEBUG ",
+	WarningLevel: "WARNING ",
+	ErrorLevel:   "ERROR ",
+	PanicLevel:   "PANIC ",
+}
+
 type defaultLogger struct {
 	w      io.Writer
 	prefix string
+	json   bool
 
 	buf []byte
 }
 
-// Debug only prints if PEBBLE_DEBUG is set.
+// Debug logs a message at debug level.
 func (l *defaultLogger) Debug(msg string) {
-	if os.Getenv("PEBBLE_DEBUG") == "1" {
-		l.Notice("DEBUG " + msg)
-	}
+	l.Log(DebugLevel, msg, Fields{})
 }
 
 // Notice alerts the user about something, as well as putting it syslog
 func (l *defaultLogger) Notice(msg string) {
-	l.buf = l.buf[:0]
+	l.Log(NoticeLevel, msg, Fields{})
+}
+
+// Log writes a message with the given level and fields, either as text
+// (fields are omitted) or as a JSON object.
+func (l *defaultLogger) Log(msgLevel Level, msg string, fields Fields) {
 	now := time.Now().UTC()
+	if l.json {
+		l.writeJSON(now, msgLevel, msg, fields)
+		return
+	}
+	l.buf = l.buf[:0]
 	l.buf = now.AppendFormat(l.buf, timestampFormat)
 	l.buf = append(l.buf, ' ')
 	l.buf = append(l.buf, l.prefix...)
+	l.buf = append(l.buf, textPrefixes[msgLevel]...)
 	l.buf = append(l.buf, msg...)
 	if len(msg) == 0 || msg[len(msg)-1] != '\n' {
 		l.buf = append(l.buf, '\n')
@@ -121,8 +313,36 @@ func (l *defaultLogger) Notice(msg string) {
 	l.w.Write(l.buf)
 }
 
+type jsonEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Fields
+}
+
+func (l *defaultLogger) writeJSON(now time.Time, msgLevel Level, msg string, fields Fields) {
+	entry := jsonEntry{
+		Time:    now.Format(timestampFormat),
+		Level:   msgLevel.String(),
+		Message: strings.TrimSuffix(msg, "\n"),
+		Fields:  fields,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		// Can't happen, as the entry only contains strings.
+		return
+	}
+	l.w.Write(append(data, '\n'))
+}
+
 // New creates a log.Logger using the given io.Writer and prefix (which is
 // printed between the timestamp and the message).
 func New(w io.Writer, prefix string) Logger {
 	return &defaultLogger{w: w, prefix: prefix}
 }
+
+// NewJSON creates a logger that writes each message to w as a JSON object
+// on its own line, including the level and any fields.
+func NewJSON(w io.Writer) Logger {
+	return &defaultLogger{w: w, json: true}
+}
@@ -16,6 +16,7 @@ package logger_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"testing"
 
@@ -75,3 +76,84 @@ func (s *LogSuite) TestPanicf(c *C) {
 	c.Check(func() { logger.Panicf("xyzzy") }, Panics, "xyzzy")
 	c.Check(s.logbuf.String(), Matches, `20\d\d-\d\d-\d\dT\d\d:\d\d:\d\d.\d\d\dZ PREFIX: PANIC xyzzy\n`)
 }
+
+func (s *LogSuite) TestWarningfErrorf(c *C) {
+	logger.Warningf("careful")
+	logger.Errorf("broken")
+	c.Check(s.logbuf.String(), Matches, `(?s).* PREFIX: WARNING careful\n.* PREFIX: ERROR broken\n`)
+}
+
+func (s *LogSuite) TestSetLevel(c *C) {
+	restore := logger.MockLevel(logger.WarningLevel)
+	defer restore()
+	c.Check(logger.GetLevel(), Equals, logger.WarningLevel)
+
+	logger.Debugf("debug")
+	logger.Noticef("notice")
+	logger.Warningf("warning")
+	c.Check(s.logbuf.String(), Matches, `.* PREFIX: WARNING warning\n`)
+
+	s.logbuf.Reset()
+	logger.SetLevel(logger.DebugLevel)
+	logger.Debugf("debug")
+	c.Check(s.logbuf.String(), Matches, `.* PREFIX: DEBUG debug\n`)
+
+	// Panics are always logged.
+	s.logbuf.Reset()
+	logger.SetLevel(logger.ErrorLevel)
+	c.Check(func() { logger.Panicf("xyzzy") }, Panics, "xyzzy")
+	c.Check(s.logbuf.String(), Matches, `.* PREFIX: PANIC xyzzy\n`)
+}
+
+func (s *LogSuite) TestGetLevelDefault(c *C) {
+	c.Check(logger.GetLevel(), Equals, logger.NoticeLevel)
+
+	os.Setenv("PEBBLE_DEBUG", "1")
+	defer os.Unsetenv("PEBBLE_DEBUG")
+	c.Check(logger.GetLevel(), Equals, logger.DebugLevel)
+}
+
+func (s *LogSuite) TestParseLevel(c *C) {
+	for _, level := range []logger.Level{logger.DebugLevel, logger.NoticeLevel, logger.WarningLevel, logger.ErrorLevel} {
+		parsed, err := logger.ParseLevel(level.String())
+		c.Assert(err, IsNil)
+		c.Check(parsed, Equals, level)
+	}
+	_, err := logger.ParseLevel("panic")
+	c.Check(err, ErrorMatches, `invalid log level "panic", must be "debug", "notice", "warning" or "error"`)
+}
+
+func (s *LogSuite) TestJSON(c *C) {
+	var buf bytes.Buffer
+	old := logger.SetLogger(logger.NewJSON(&buf))
+	defer logger.SetLogger(old)
+
+	logger.WithFields(logger.Fields{Component: "servstate", Change: "3", Service: "svc1"}).Warningf("service %q exited\n", "svc1")
+	logger.Noticef("plain")
+
+	decoder := json.NewDecoder(&buf)
+	var entry map[string]any
+	c.Assert(decoder.Decode(&entry), IsNil)
+	c.Check(entry["time"], Matches, `20\d\d-\d\d-\d\dT\d\d:\d\d:\d\d.\d\d\dZ`)
+	delete(entry, "time")
+	c.Check(entry, DeepEquals, map[string]any{
+		"level":     "warning",
+		"message":   `service "svc1" exited`,
+		"component": "servstate",
+		"change":    "3",
+		"service":   "svc1",
+	})
+	entry = nil
+	c.Assert(decoder.Decode(&entry), IsNil)
+	delete(entry, "time")
+	c.Check(entry, DeepEquals, map[string]any{
+		"level":   "notice",
+		"message": "plain",
+	})
+}
+
+func (s *LogSuite) TestFieldsText(c *C) {
+	// Fields are only included in structured output.
+	logger.WithFields(logger.Fields{Service: "svc1"}).Noticef("xyzzy")
+	c.Check(s.logbuf.String(), Matches, `20\d\d-\d\d-\d\dT\d\d:\d\d:\d\d.\d\d\dZ PREFIX: xyzzy\n`)
+}
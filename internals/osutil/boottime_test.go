@@ -0,0 +1,58 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package osutil_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/osutil"
+)
+
+type bootTimeSuite struct{}
+
+var _ = Suite(&bootTimeSuite{})
+
+func (s *bootTimeSuite) TestBootTime(c *C) {
+	restore := osutil.FakeProcStat("cpu  1 2 3 4\nintr 5\nctxt 6\nbtime 1714564800\nprocesses 7\n")
+	defer restore()
+
+	bootTime, err := osutil.BootTime()
+	c.Assert(err, IsNil)
+	c.Check(bootTime.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)), Equals, true)
+}
+
+func (s *bootTimeSuite) TestBootTimeMissing(c *C) {
+	restore := osutil.FakeProcStat("cpu  1 2 3 4\n")
+	defer restore()
+
+	_, err := osutil.BootTime()
+	c.Assert(err, ErrorMatches, `cannot find boot time in .*`)
+}
+
+func (s *bootTimeSuite) TestBootTimeInvalid(c *C) {
+	restore := osutil.FakeProcStat("btime soon\n")
+	defer restore()
+
+	_, err := osutil.BootTime()
+	c.Assert(err, ErrorMatches, `cannot parse boot time "soon": .*`)
+}
+
+func (s *bootTimeSuite) TestSmoke(c *C) {
+	bootTime, err := osutil.BootTime()
+	c.Assert(err, IsNil)
+	c.Check(bootTime.Before(time.Now()), Equals, true)
+}
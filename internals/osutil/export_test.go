@@ -118,3 +118,20 @@ func FakeEnviron(f func() []string) (restore func()) {
 		osEnviron = oldEnviron
 	}
 }
+
+// FakeProcStat fakes the content of /proc/stat.
+func FakeProcStat(text string) (restore func()) {
+	old := procStat
+	f, err := os.CreateTemp("", "stat")
+	if err != nil {
+		panic(fmt.Errorf("cannot open temporary file: %s", err))
+	}
+	if err := os.WriteFile(f.Name(), []byte(text), 0644); err != nil {
+		panic(fmt.Errorf("cannot write mock stat file: %s", err))
+	}
+	procStat = f.Name()
+	return func() {
+		os.Remove(f.Name())
+		procStat = old
+	}
+}
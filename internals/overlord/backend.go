@@ -15,8 +15,10 @@
 package overlord
 
 import (
+	"sync"
 	"time"
 
+	"github.com/canonical/pebble/internals/logger"
 	"github.com/canonical/pebble/internals/osutil"
 	"github.com/canonical/pebble/internals/overlord/restart"
 )
@@ -25,10 +27,62 @@ type overlordStateBackend struct {
 	path           string
 	ensureBefore   func(d time.Duration)
 	requestRestart func(t restart.RestartType)
+
+	// checkpointDelay, if non-zero, is how long checkpoints are deferred
+	// for, so that those made in quick succession result in a single
+	// write.
+	checkpointDelay time.Duration
+
+	mu      sync.Mutex
+	pending []byte
+	timer   *time.Timer
 }
 
 func (osb *overlordStateBackend) Checkpoint(data []byte) error {
-	return osutil.AtomicWriteFile(osb.path, data, 0600, 0)
+	if osb.checkpointDelay == 0 {
+		return osutil.AtomicWriteFile(osb.path, data, 0600, 0)
+	}
+	osb.mu.Lock()
+	defer osb.mu.Unlock()
+	osb.pending = data
+	if osb.timer == nil {
+		osb.timer = time.AfterFunc(osb.checkpointDelay, osb.flushDeferred)
+	}
+	return nil
+}
+
+// Flush writes the most recent deferred checkpoint, if any. Each write
+// replaces the state file atomically, so a crash loses at most the
+// checkpoints made in the last checkpointDelay.
+func (osb *overlordStateBackend) Flush() error {
+	osb.mu.Lock()
+	defer osb.mu.Unlock()
+	if osb.timer != nil {
+		osb.timer.Stop()
+		osb.timer = nil
+	}
+	if osb.pending == nil {
+		return nil
+	}
+	err := osutil.AtomicWriteFile(osb.path, osb.pending, 0600, 0)
+	if err != nil {
+		return err
+	}
+	osb.pending = nil
+	return nil
+}
+
+func (osb *overlordStateBackend) flushDeferred() {
+	err := osb.Flush()
+	if err == nil {
+		return
+	}
+	logger.Noticef("Cannot write state, will retry: %v", err)
+	osb.mu.Lock()
+	defer osb.mu.Unlock()
+	if osb.timer == nil && osb.pending != nil {
+		osb.timer = time.AfterFunc(osb.checkpointDelay, osb.flushDeferred)
+	}
 }
 
 func (osb *overlordStateBackend) EnsureBefore(d time.Duration) {
@@ -111,6 +111,21 @@ func (c *tcpChecker) check(ctx context.Context) error {
 	return nil
 }
 
+// deviceChecker is a checker that ensures a device in the plan is ready.
+type deviceChecker struct {
+	name    string
+	device  string
+	devices DeviceManager
+}
+
+func (c *deviceChecker) check(ctx context.Context) error {
+	logger.Debugf("Check %q (device): checking device %q", c.name, c.device)
+	if c.devices == nil || !c.devices.DeviceReady(c.device) {
+		return fmt.Errorf("device %q is not ready", c.device)
+	}
+	return nil
+}
+
 // execChecker is a checker that ensures a command executes successfully.
 type execChecker struct {
 	name        string
@@ -143,6 +158,14 @@ func (c *execChecker) check(ctx context.Context) error {
 	}
 	cmd.Dir = c.workingDir
 
+	// Run the command in its own process group, and kill the whole group
+	// on timeout or cancellation, so that any processes it started don't
+	// outlive the check. The reaper reaps them once they're orphaned.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
 	// Start as another user if specified in the check config.
 	uid, gid, err := osutil.NormalizeUidGid(c.userID, c.groupID, c.user, c.group)
 	if err != nil {
@@ -154,7 +177,6 @@ func (c *execChecker) check(ctx context.Context) error {
 			logger.Debugf("Cannot determine if uid %d gid %d is current user", *uid, *gid)
 		}
 		if !isCurrent {
-			cmd.SysProcAttr = &syscall.SysProcAttr{}
 			cmd.SysProcAttr.Credential = &syscall.Credential{
 				Uid: uint32(*uid),
 				Gid: uint32(*gid),
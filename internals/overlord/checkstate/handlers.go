@@ -42,14 +42,17 @@ func (m *CheckManager) doPerformCheck(task *state.Task, tomb *tombpkg.Tomb) erro
 	ticker := time.NewTicker(config.Period.Value)
 	defer ticker.Stop()
 
-	chk := newChecker(config)
+	chk := m.newChecker(config)
 	for {
 		select {
 		case <-ticker.C:
-			err := runCheck(tomb.Context(nil), chk, config.Timeout.Value)
+			err := m.runCheck(tomb.Context(nil), config, chk)
 			if !tomb.Alive() {
 				return checkStopped(config.Name, task.Kind(), tomb.Err())
 			}
+			if err == errCheckSkipped {
+				break
+			}
 			if err != nil {
 				// Record check failure and perform any action if the threshold
 				// is reached (for example, restarting a service).
@@ -65,6 +68,7 @@ func (m *CheckManager) doPerformCheck(task *state.Task, tomb *tombpkg.Tomb) erro
 				m.state.Lock()
 				if atThreshold {
 					details.Proceed = true
+					details.LastError = err.Error()
 				} else {
 					// Add error to task log, but only if we haven't reached the
 					// threshold. When we hit the threshold, the "return err"
@@ -77,7 +81,7 @@ func (m *CheckManager) doPerformCheck(task *state.Task, tomb *tombpkg.Tomb) erro
 				logger.Noticef("Check %q failure %d/%d: %v", config.Name, details.Failures, config.Threshold, err)
 				if atThreshold {
 					logger.Noticef("Check %q threshold %d hit, triggering action and recovering", config.Name, config.Threshold)
-					m.callFailureHandlers(config.Name)
+					m.callFailureHandlers(config.Name, err)
 					// Returning the error means perform-check goes to Error status
 					// and logs the error to the task log.
 					return err
@@ -98,6 +102,39 @@ func (m *CheckManager) doPerformCheck(task *state.Task, tomb *tombpkg.Tomb) erro
 	}
 }
 
+// errCheckSkipped is returned by runCheck if the check didn't run, which is
+// neither a success nor a failure.
+var errCheckSkipped = errors.New("check skipped")
+
+// runCheck runs the check once, recording whether it was skipped or took
+// longer than its period.
+func (m *CheckManager) runCheck(ctx context.Context, config *plan.Check, chk checker) error {
+	if config.Exec != nil {
+		// Wait up to the check's timeout for a free slot, and skip this run
+		// if there isn't one, rather than counting it as a failure.
+		waitCtx, cancel := context.WithTimeout(ctx, config.Timeout.Value)
+		select {
+		case m.execSlots <- struct{}{}:
+			cancel()
+			defer func() { <-m.execSlots }()
+		case <-waitCtx.Done():
+			cancel()
+			if ctx.Err() == nil {
+				logger.Noticef("Check %q skipped: %d exec checks already running", config.Name, cap(m.execSlots))
+				m.addCheckRuns(config.Name, 1, 0)
+			}
+			return errCheckSkipped
+		}
+	}
+
+	start := time.Now()
+	err := runCheck(ctx, chk, config.Timeout.Value)
+	if elapsed := time.Since(start); elapsed > config.Period.Value && ctx.Err() == nil {
+		m.addCheckRuns(config.Name, 0, int(elapsed/config.Period.Value))
+	}
+	return err
+}
+
 func runCheck(ctx context.Context, chk checker, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -124,14 +161,17 @@ func (m *CheckManager) doRecoverCheck(task *state.Task, tomb *tombpkg.Tomb) erro
 	ticker := time.NewTicker(config.Period.Value)
 	defer ticker.Stop()
 
-	chk := newChecker(config)
+	chk := m.newChecker(config)
 	for {
 		select {
 		case <-ticker.C:
-			err := runCheck(tomb.Context(nil), chk, config.Timeout.Value)
+			err := m.runCheck(tomb.Context(nil), config, chk)
 			if !tomb.Alive() {
 				return checkStopped(config.Name, task.Kind(), tomb.Err())
 			}
+			if err == errCheckSkipped {
+				break
+			}
 			if err != nil {
 				details.Failures++
 				m.updateCheckInfo(config, changeID, details.Failures)
@@ -147,11 +187,13 @@ func (m *CheckManager) doRecoverCheck(task *state.Task, tomb *tombpkg.Tomb) erro
 
 			// Check succeeded, switch to performing a succeeding check.
 			// Check info will be updated with new change ID by changeStatusChanged.
+			failures := details.Failures
 			details.Failures = 0 // not strictly needed, but just to be safe
 			details.Proceed = true
 			m.state.Lock()
 			task.Set(checkDetailsAttr, &details)
 			m.state.Unlock()
+			m.checkRecovered(config, failures)
 			return nil
 
 		case <-tomb.Dying():
@@ -19,11 +19,13 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 
 	"gopkg.in/tomb.v2"
 
+	"github.com/canonical/pebble/internals/logger"
 	"github.com/canonical/pebble/internals/overlord/state"
 	"github.com/canonical/pebble/internals/plan"
 )
@@ -36,25 +38,59 @@ const (
 	checkDetailsAttr = "check-details"
 )
 
+// maxExecChecks is the maximum number of exec checks that run at once.
+var maxExecChecks = 16
+
+// CheckRecoveredNotice is recorded when a check with "notice: true" in its
+// on-recovery configuration recovers. The key is the check's name.
+const CheckRecoveredNotice state.NoticeType = "check-recovered"
+
+func init() {
+	err := state.RegisterNoticeType(CheckRecoveredNotice)
+	if err != nil {
+		panic(err)
+	}
+}
+
 // CheckManager starts and manages the health checks.
 type CheckManager struct {
 	state      *state.State
 	ensureDone atomic.Bool
 
-	failureHandlers []FailureFunc
+	failureHandlers  []FailureFunc
+	recoveryHandlers []RecoveryFunc
 
 	checksLock sync.Mutex
 	checks     map[string]CheckInfo
+
+	// execSlots limits how many exec checks run at once, so that slow or
+	// stuck commands with short periods can't pile up processes.
+	execSlots chan struct{}
+
+	// devices is set if the daemon tracks devices; see SetDeviceManager.
+	devices DeviceManager
+}
+
+// DeviceManager is the interface the check manager uses to find out whether
+// the devices of device checks are ready.
+type DeviceManager interface {
+	DeviceReady(name string) bool
 }
 
-// FailureFunc is the type of function called when a failure action is triggered.
-type FailureFunc func(name string)
+// FailureFunc is the type of function called when a failure action is
+// triggered. The error is the check's most recent failure.
+type FailureFunc func(name string, err error)
+
+// RecoveryFunc is the type of function called when a check recovers and its
+// on-recovery configuration lists services to restart.
+type RecoveryFunc func(name string, restart []string)
 
 // NewManager creates a new check manager.
 func NewManager(s *state.State, runner *state.TaskRunner) *CheckManager {
 	manager := &CheckManager{
-		state:  s,
-		checks: make(map[string]CheckInfo),
+		state:     s,
+		checks:    make(map[string]CheckInfo),
+		execSlots: make(chan struct{}, maxExecChecks),
 	}
 
 	// Health check changes can be long-running; ensure they don't get pruned.
@@ -91,12 +127,25 @@ func (m *CheckManager) Ensure() error {
 	return nil
 }
 
+// SetDeviceManager sets the manager used by device checks to find out
+// whether their device is ready. It must be called before the manager is
+// started.
+func (m *CheckManager) SetDeviceManager(devices DeviceManager) {
+	m.devices = devices
+}
+
 // NotifyCheckFailed adds f to the list of functions that are called whenever
 // a check hits its failure threshold.
 func (m *CheckManager) NotifyCheckFailed(f FailureFunc) {
 	m.failureHandlers = append(m.failureHandlers, f)
 }
 
+// NotifyCheckRecovered adds f to the list of functions that are called
+// whenever a check recovers and has services to restart.
+func (m *CheckManager) NotifyCheckRecovered(f RecoveryFunc) {
+	m.recoveryHandlers = append(m.recoveryHandlers, f)
+}
+
 // PlanChanged handles updates to the plan (server configuration),
 // stopping the previous checks and starting the new ones as required.
 func (m *CheckManager) PlanChanged(newPlan *plan.Plan) {
@@ -176,7 +225,7 @@ func (m *CheckManager) changeStatusChanged(change *state.Change, old, new state.
 			break
 		}
 		config := m.state.Cached(performConfigKey{change.ID()}).(*plan.Check) // panic if key not present (always should be)
-		changeID := recoverCheckChange(m.state, config, details.Failures)
+		changeID := recoverCheckChange(m.state, config, details.Failures, details.LastError)
 		m.updateCheckInfo(config, changeID, details.Failures)
 		shouldEnsure = true
 
@@ -196,9 +245,44 @@ func (m *CheckManager) changeStatusChanged(change *state.Change, old, new state.
 	}
 }
 
-func (m *CheckManager) callFailureHandlers(name string) {
+func (m *CheckManager) callFailureHandlers(name string, err error) {
 	for _, f := range m.failureHandlers {
-		f(name)
+		f(name, err)
+	}
+}
+
+// checkRecovered performs the on-recovery actions of a check that has
+// started succeeding again after the given number of failures.
+func (m *CheckManager) checkRecovered(config *plan.Check, failures int) {
+	logger.Noticef("Check %q recovered after %s", config.Name, pluralise(failures, "failure", "failures"))
+	recovery := config.OnRecovery
+	if recovery == nil {
+		return
+	}
+	if recovery.Notice {
+		m.state.Lock()
+		_, err := m.state.AddNotice(nil, CheckRecoveredNotice, config.Name, &state.AddNoticeOptions{
+			Data: map[string]string{"failures": strconv.Itoa(failures)},
+		})
+		m.state.Unlock()
+		if err != nil {
+			logger.Noticef("Cannot record check %q recovery notice: %v", config.Name, err)
+		}
+	}
+	if recovery.Exec != "" {
+		// Don't hold up the check while the command runs.
+		go func() {
+			chk := &execChecker{name: config.Name, command: recovery.Exec}
+			err := runCheck(context.Background(), chk, config.Timeout.Value)
+			if err != nil {
+				logger.Noticef("Check %q on-recovery command failed: %v", config.Name, err)
+			}
+		}()
+	}
+	if len(recovery.Restart) > 0 {
+		for _, f := range m.recoveryHandlers {
+			f(config.Name, recovery.Restart)
+		}
 	}
 }
 
@@ -224,11 +308,26 @@ func checkType(config *plan.Check) string {
 		return "TCP"
 	case config.Exec != nil:
 		return "exec"
+	case config.Device != nil:
+		return "device"
 	default:
 		return "<unknown>"
 	}
 }
 
+// newChecker creates a new checker of the configured type, including device
+// checkers, which use the manager's device manager.
+func (m *CheckManager) newChecker(config *plan.Check) checker {
+	if config.Device != nil {
+		return &deviceChecker{
+			name:    config.Name,
+			device:  config.Device.Name,
+			devices: m.devices,
+		}
+	}
+	return newChecker(config)
+}
+
 // newChecker creates a new checker of the configured type. Assumes
 // mergeServiceContext has already been called.
 func newChecker(config *plan.Check) checker {
@@ -320,16 +419,33 @@ func (m *CheckManager) updateCheckInfo(config *plan.Check, changeID string, fail
 	if failures >= config.Threshold {
 		status = CheckStatusDown
 	}
+	old := m.checks[config.Name]
 	m.checks[config.Name] = CheckInfo{
-		Name:      config.Name,
-		Level:     config.Level,
-		Status:    status,
-		Failures:  failures,
-		Threshold: config.Threshold,
-		ChangeID:  changeID,
+		Name:        config.Name,
+		Level:       config.Level,
+		Status:      status,
+		Failures:    failures,
+		Threshold:   config.Threshold,
+		ChangeID:    changeID,
+		Skipped:     old.Skipped,
+		Overlapping: old.Overlapping,
 	}
 }
 
+// addCheckRuns adds to the counts of skipped and overlapping runs of a check.
+func (m *CheckManager) addCheckRuns(name string, skipped, overlapping int) {
+	m.checksLock.Lock()
+	defer m.checksLock.Unlock()
+
+	info, ok := m.checks[name]
+	if !ok {
+		return
+	}
+	info.Skipped += skipped
+	info.Overlapping += overlapping
+	m.checks[name] = info
+}
+
 func (m *CheckManager) deleteCheckInfo(name string) {
 	m.checksLock.Lock()
 	defer m.checksLock.Unlock()
@@ -345,6 +461,14 @@ type CheckInfo struct {
 	Failures  int
 	Threshold int
 	ChangeID  string
+
+	// Skipped is the number of runs skipped because too many exec checks
+	// were already running.
+	Skipped int
+
+	// Overlapping is the number of runs that were due while the previous
+	// run was still going, and so didn't happen.
+	Overlapping int
 }
 
 type CheckStatus string
@@ -15,6 +15,7 @@
 package checkstate_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -161,7 +162,7 @@ func (s *ManagerSuite) TestTimeout(c *C) {
 
 func (s *ManagerSuite) TestCheckCanceled(c *C) {
 	failureName := ""
-	s.manager.NotifyCheckFailed(func(name string) {
+	s.manager.NotifyCheckFailed(func(name string, err error) {
 		failureName = name
 	})
 	tempDir := c.MkDir()
@@ -209,7 +210,7 @@ func (s *ManagerSuite) TestCheckCanceled(c *C) {
 
 func (s *ManagerSuite) TestFailures(c *C) {
 	var notifies atomic.Int32
-	s.manager.NotifyCheckFailed(func(name string) {
+	s.manager.NotifyCheckFailed(func(name string, err error) {
 		notifies.Add(1)
 	})
 	testPath := c.MkDir() + "/test"
@@ -257,6 +258,11 @@ func (s *ManagerSuite) TestFailures(c *C) {
 	c.Assert(check.Status, Equals, checkstate.CheckStatusDown)
 	c.Assert(notifies.Load(), Equals, int32(1))
 	recoverChangeID := check.ChangeID
+	st := s.overlord.State()
+	st.Lock()
+	summary := st.Change(recoverChangeID).Summary()
+	st.Unlock()
+	c.Assert(summary, Equals, `Recover exec check "chk1" after failure: exit status 1`)
 
 	// Should log failures in recover-check mode
 	check = waitCheck(c, s.manager, "chk1", func(check *checkstate.CheckInfo) bool {
@@ -280,6 +286,64 @@ func (s *ManagerSuite) TestFailures(c *C) {
 	c.Assert(lastTaskLog(s.overlord.State(), check.ChangeID), Equals, "")
 }
 
+// fakeDevices is a DeviceManager whose devices are ready when set.
+type fakeDevices struct {
+	mu    sync.Mutex
+	ready map[string]bool
+}
+
+func (d *fakeDevices) DeviceReady(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ready[name]
+}
+
+func (d *fakeDevices) setReady(name string, ready bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ready[name] = ready
+}
+
+func (s *ManagerSuite) TestDeviceCheck(c *C) {
+	devices := &fakeDevices{ready: map[string]bool{"modem": true}}
+	s.manager.SetDeviceManager(devices)
+	s.manager.PlanChanged(&plan.Plan{
+		Checks: map[string]*plan.Check{
+			"chk1": {
+				Name:      "chk1",
+				Period:    plan.OptionalDuration{Value: 20 * time.Millisecond},
+				Timeout:   plan.OptionalDuration{Value: 100 * time.Millisecond},
+				Threshold: 1,
+				Device:    &plan.DeviceCheck{Name: "modem"},
+			},
+		},
+	})
+	// The check stays up while the device is ready.
+	time.Sleep(100 * time.Millisecond)
+	check := waitCheck(c, s.manager, "chk1", func(check *checkstate.CheckInfo) bool {
+		return check.ChangeID != ""
+	})
+	c.Check(check.Status, Equals, checkstate.CheckStatusUp)
+	c.Check(check.Failures, Equals, 0)
+
+	// The device is removed.
+	devices.setReady("modem", false)
+	check = waitCheck(c, s.manager, "chk1", func(check *checkstate.CheckInfo) bool {
+		return check.Status == checkstate.CheckStatusDown
+	})
+	st := s.overlord.State()
+	st.Lock()
+	summary := st.Change(check.ChangeID).Summary()
+	st.Unlock()
+	c.Check(summary, Equals, `Recover device check "chk1" after failure: device "modem" is not ready`)
+
+	// The device comes back.
+	devices.setReady("modem", true)
+	waitCheck(c, s.manager, "chk1", func(check *checkstate.CheckInfo) bool {
+		return check.Status == checkstate.CheckStatusUp
+	})
+}
+
 func (s *ManagerSuite) TestFailuresBelowThreshold(c *C) {
 	testPath := c.MkDir() + "/test"
 	err := os.WriteFile(testPath, nil, 0o644)
@@ -509,6 +573,133 @@ func (s *ManagerSuite) TestSuccessNoLog(c *C) {
 // so it makes sense to pick a conservative number here as failing a test
 // due to a busy test resource is more extensive than waiting a few more
 // seconds.
+func (s *ManagerSuite) TestExecLimit(c *C) {
+	checkstate.FakeMaxExecChecks(s.manager, 1)
+	s.manager.PlanChanged(&plan.Plan{
+		Checks: map[string]*plan.Check{
+			"slow": {
+				Name:      "slow",
+				Period:    plan.OptionalDuration{Value: 10 * time.Millisecond},
+				Timeout:   plan.OptionalDuration{Value: time.Second},
+				Threshold: 3,
+				Exec:      &plan.ExecCheck{Command: "sleep 0.1"},
+			},
+			"fast": {
+				Name:      "fast",
+				Period:    plan.OptionalDuration{Value: 10 * time.Millisecond},
+				Timeout:   plan.OptionalDuration{Value: 5 * time.Millisecond},
+				Threshold: 3,
+				Exec:      &plan.ExecCheck{Command: "echo fast"},
+			},
+		},
+	})
+
+	// While the slow check holds the only slot, runs of the fast check are
+	// skipped rather than failed.
+	check := waitCheck(c, s.manager, "fast", func(check *checkstate.CheckInfo) bool {
+		return check.Skipped > 0
+	})
+	c.Check(check.Status, Equals, checkstate.CheckStatusUp)
+	c.Check(check.Failures, Equals, 0)
+
+	// Runs of the slow check that were due while it was running are counted.
+	waitCheck(c, s.manager, "slow", func(check *checkstate.CheckInfo) bool {
+		return check.Overlapping > 0
+	})
+}
+
+func (s *ManagerSuite) TestTimeoutKillsProcessGroup(c *C) {
+	tempFile := filepath.Join(c.MkDir(), "file.txt")
+	// The background subshell keeps writing after its parent is killed
+	// unless the whole process group is killed.
+	command := fmt.Sprintf(`/bin/sh -c "(while true; do echo x >>%s; sleep 0.005; done) & wait"`, tempFile)
+	s.manager.PlanChanged(&plan.Plan{
+		Checks: map[string]*plan.Check{
+			"chk1": {
+				Name:      "chk1",
+				Period:    plan.OptionalDuration{Value: time.Millisecond},
+				Timeout:   plan.OptionalDuration{Value: 50 * time.Millisecond},
+				Threshold: 1,
+				Exec:      &plan.ExecCheck{Command: command},
+			},
+		},
+	})
+	waitCheck(c, s.manager, "chk1", func(check *checkstate.CheckInfo) bool {
+		return check.Status == checkstate.CheckStatusDown
+	})
+	s.manager.PlanChanged(&plan.Plan{})
+	waitChecks(c, s.manager, nil)
+
+	// Ensure the background process was killed (output file didn't grow).
+	time.Sleep(20 * time.Millisecond)
+	b1, err := os.ReadFile(tempFile)
+	c.Assert(err, IsNil)
+	time.Sleep(50 * time.Millisecond)
+	b2, err := os.ReadFile(tempFile)
+	c.Assert(err, IsNil)
+	c.Assert(len(b2), Equals, len(b1))
+}
+
+func (s *ManagerSuite) TestOnRecovery(c *C) {
+	var recovered []string
+	var restart []string
+	s.manager.NotifyCheckRecovered(func(name string, services []string) {
+		recovered = append(recovered, name)
+		restart = services
+	})
+	tempDir := c.MkDir()
+	healthyFile := filepath.Join(tempDir, "healthy")
+	execFile := filepath.Join(tempDir, "recovered")
+	s.manager.PlanChanged(&plan.Plan{
+		Checks: map[string]*plan.Check{
+			"chk1": {
+				Name:      "chk1",
+				Period:    plan.OptionalDuration{Value: 10 * time.Millisecond},
+				Timeout:   plan.OptionalDuration{Value: time.Second},
+				Threshold: 2,
+				Exec:      &plan.ExecCheck{Command: "test -f " + healthyFile},
+				OnRecovery: &plan.CheckRecovery{
+					Notice:  true,
+					Exec:    "touch " + execFile,
+					Restart: []string{"svc1"},
+				},
+			},
+		},
+	})
+	waitCheck(c, s.manager, "chk1", func(check *checkstate.CheckInfo) bool {
+		return check.Status == checkstate.CheckStatusDown
+	})
+	c.Check(recovered, HasLen, 0)
+
+	err := os.WriteFile(healthyFile, nil, 0644)
+	c.Assert(err, IsNil)
+	waitCheck(c, s.manager, "chk1", func(check *checkstate.CheckInfo) bool {
+		return check.Status == checkstate.CheckStatusUp
+	})
+	c.Check(recovered, DeepEquals, []string{"chk1"})
+	c.Check(restart, DeepEquals, []string{"svc1"})
+
+	st := s.overlord.State()
+	st.Lock()
+	notices := st.Notices(&state.NoticeFilter{Types: []state.NoticeType{checkstate.CheckRecoveredNotice}})
+	st.Unlock()
+	c.Assert(notices, HasLen, 1)
+	c.Check(notices[0].Key(), Equals, "chk1")
+	data, err := json.Marshal(notices[0])
+	c.Assert(err, IsNil)
+	c.Check(string(data), Matches, `.*"last-data":\{"failures":"[0-9]+"\}.*`)
+
+	for i := 0; ; i++ {
+		if _, err := os.Stat(execFile); err == nil {
+			break
+		}
+		if i >= 1000 {
+			c.Fatalf("on-recovery command didn't run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func waitCheck(c *C, mgr *checkstate.CheckManager, name string, f func(check *checkstate.CheckInfo) bool) *checkstate.CheckInfo {
 	// Worst case waiting time for checker run(s) to complete. This
 	// period should be much longer than the longest
@@ -542,7 +733,10 @@ func waitChecks(c *C, mgr *checkstate.CheckManager, expected []*checkstate.Check
 		checks, err = mgr.Checks()
 		c.Assert(err, IsNil)
 		for _, check := range checks {
-			check.ChangeID = "" // clear change ID to avoid comparing it
+			// Clear change ID and run counts to avoid comparing them.
+			check.ChangeID = ""
+			check.Skipped = 0
+			check.Overlapping = 0
 		}
 		if len(checks) == 0 && len(expected) == 0 || reflect.DeepEqual(checks, expected) {
 			return
@@ -24,6 +24,8 @@ import (
 type checkDetails struct {
 	Name     string `json:"name"`
 	Failures int    `json:"failures"`
+	// Most recent failure that triggered the check's failure actions
+	LastError string `json:"last-error,omitempty"`
 	// Whether to proceed to next check type when change is ready
 	Proceed bool `json:"proceed,omitempty"`
 }
@@ -50,10 +52,13 @@ type recoverConfigKey struct {
 	changeID string
 }
 
-func recoverCheckChange(st *state.State, config *plan.Check, failures int) (changeID string) {
+func recoverCheckChange(st *state.State, config *plan.Check, failures int, lastError string) (changeID string) {
 	summary := fmt.Sprintf("Recover %s check %q", checkType(config), config.Name)
+	if lastError != "" {
+		summary += fmt.Sprintf(" after failure: %s", lastError)
+	}
 	task := st.NewTask(recoverCheckKind, summary)
-	task.Set(checkDetailsAttr, &checkDetails{Name: config.Name, Failures: failures})
+	task.Set(checkDetailsAttr, &checkDetails{Name: config.Name, Failures: failures, LastError: lastError})
 
 	change := st.NewChange(recoverCheckKind, task.Summary())
 	change.Set(noPruneAttr, true)
@@ -62,6 +62,7 @@ type execution struct {
 	userID      *int
 	groupID     *int
 	workingDir  string
+	transcript  *transcript
 
 	websockets       map[string]*websocket.Conn
 	websocketsLock   sync.Mutex
@@ -97,6 +98,24 @@ func (m *CommandManager) doExec(task *state.Task, tomb *tomb.Tomb) error {
 		controlConnected: make(chan struct{}),
 	}
 
+	if setup.Record {
+		e.transcript, err = createTranscript(m.TranscriptPath(task.ID()))
+		if err != nil {
+			return fmt.Errorf("cannot create exec transcript: %w", err)
+		}
+		defer e.transcript.close()
+		e.record(&TranscriptEvent{
+			Type:     "start",
+			Time:     time.Now(),
+			Command:  e.command,
+			Terminal: e.terminal,
+			UserID:   e.userID,
+			GroupID:  e.groupID,
+			Width:    e.width,
+			Height:   e.height,
+		})
+	}
+
 	// Populate the websockets map (with nil connections until connected).
 	e.websockets[wsControl] = nil
 	e.websockets[wsStdio] = nil
@@ -244,14 +263,14 @@ func (e *execution) do(ctx context.Context, task *state.Task) error {
 			logger.Debugf("Exec %s: started mirroring websocket", task.ID())
 			defer logger.Debugf("Exec %s: finished mirroring websocket", task.ID())
 
-			wsutil.MirrorToWebsocket(ioConn, master, childDead, int(master.Fd()))
+			wsutil.MirrorToWebsocket(e.recordMessageWriter("stdout", ioConn), master, childDead, int(master.Fd()))
 		}()
 
 		if e.interactive {
 			// Interactive: start goroutine to receive stdin from "stdio"
 			// websocket and write to the PTY.
 			go func() {
-				<-wsutil.WebsocketRecvStream(master, ioConn)
+				<-wsutil.WebsocketRecvStream(e.recordWriter("stdin", master), ioConn)
 				master.Close()
 			}()
 		} else {
@@ -264,7 +283,7 @@ func (e *execution) do(ctx context.Context, task *state.Task) error {
 			stdin = stdinReader
 			afterClosers = append(afterClosers, stdinReader)
 			go func() {
-				<-wsutil.WebsocketRecvStream(stdinWriter, ioConn)
+				<-wsutil.WebsocketRecvStream(e.recordWriter("stdin", stdinWriter), ioConn)
 				stdinWriter.Close()
 			}()
 		}
@@ -283,7 +302,7 @@ func (e *execution) do(ctx context.Context, task *state.Task) error {
 		stdin = stdinReader
 		afterClosers = append(afterClosers, stdinReader)
 		go func() {
-			<-wsutil.WebsocketRecvStream(stdinWriter, ioConn)
+			<-wsutil.WebsocketRecvStream(e.recordWriter("stdin", stdinWriter), ioConn)
 			stdinWriter.Close()
 		}()
 
@@ -299,7 +318,7 @@ func (e *execution) do(ctx context.Context, task *state.Task) error {
 		wgOutputSent.Add(1)
 		go func() {
 			defer wgOutputSent.Done()
-			<-wsutil.WebsocketSendStream(ioConn, stdoutReader, -1)
+			<-wsutil.WebsocketSendStream(e.recordMessageWriter("stdout", ioConn), stdoutReader, -1)
 			stdoutReader.Close()
 		}()
 	}
@@ -317,7 +336,7 @@ func (e *execution) do(ctx context.Context, task *state.Task) error {
 		wgOutputSent.Add(1)
 		go func() {
 			defer wgOutputSent.Done()
-			<-wsutil.WebsocketSendStream(stderrConn, stderrReader, -1)
+			<-wsutil.WebsocketSendStream(e.recordMessageWriter("stderr", stderrConn), stderrReader, -1)
 			stderrReader.Close()
 		}()
 	}
@@ -405,18 +424,20 @@ func (e *execution) do(ctx context.Context, task *state.Task) error {
 	}
 
 	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-		setExitCode(task, -1)
+		e.setExitCode(task, -1)
 		return fmt.Errorf("timed out after %v: %w", e.timeout, ctx.Err())
 	}
 	if err != nil {
-		setExitCode(task, -1)
+		e.setExitCode(task, -1)
 		return err
 	}
-	setExitCode(task, exitCode)
+	e.setExitCode(task, exitCode)
 	return nil
 }
 
-func setExitCode(task *state.Task, exitCode int) {
+func (e *execution) setExitCode(task *state.Task, exitCode int) {
+	e.record(&TranscriptEvent{Type: "exit", ExitCode: &exitCode})
+
 	st := task.State()
 	st.Lock()
 	defer st.Unlock()
@@ -509,6 +530,7 @@ func (e *execution) controlLoop(execID string, pidCh <-chan int, stop <-chan str
 				continue
 			}
 			logger.Debugf(`Exec %s: PID %d terminal resized to %dx%d`, execID, pid, w, h)
+			e.record(&TranscriptEvent{Type: "resize", Width: w, Height: h})
 		case command.Command == "signal":
 			if command.Signal == nil {
 				logger.Noticef(`Exec %s: control command "signal" requires signal name`, execID)
@@ -527,6 +549,7 @@ func (e *execution) controlLoop(execID string, pidCh <-chan int, stop <-chan str
 				continue
 			}
 			logger.Noticef("Exec %s: forwarded signal %s to PID %d", execID, name, pid)
+			e.record(&TranscriptEvent{Type: "signal", Signal: name})
 		default:
 			logger.Noticef("Exec %s: invalid control websocket command %q", execID, command.Command)
 		}
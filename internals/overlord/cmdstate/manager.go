@@ -17,21 +17,29 @@ package cmdstate
 import (
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/canonical/pebble/internals/overlord/state"
 )
 
 type CommandManager struct {
+	state           *state.State
 	executions      map[string]*execution
 	executionsCond  *sync.Cond
 	executionsMutex sync.Mutex
+
+	transcriptsDir string
+	lastPrune      time.Time
 }
 
-// NewManager creates a new CommandManager.
-func NewManager(runner *state.TaskRunner) *CommandManager {
+// NewManager creates a new CommandManager. Transcripts of recorded exec
+// sessions are stored in transcriptsDir.
+func NewManager(s *state.State, runner *state.TaskRunner, transcriptsDir string) *CommandManager {
 	manager := &CommandManager{
+		state:          s,
 		executions:     make(map[string]*execution),
 		executionsCond: sync.NewCond(&sync.Mutex{}),
+		transcriptsDir: transcriptsDir,
 	}
 	runner.AddHandler("exec", manager.doExec, nil)
 	return manager
@@ -39,6 +47,7 @@ func NewManager(runner *state.TaskRunner) *CommandManager {
 
 // Ensure is part of the overlord.StateManager interface.
 func (m *CommandManager) Ensure() error {
+	m.pruneTranscripts()
 	return nil
 }
 
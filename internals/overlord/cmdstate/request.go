@@ -41,6 +41,10 @@ type ExecArgs struct {
 	SplitStderr bool
 	Width       int
 	Height      int
+
+	// Record enables recording a transcript of the session's input, output,
+	// and control events, retrievable with CommandManager.ReadTranscript.
+	Record bool
 }
 
 // ExecMetadata is the metadata returned from an Exec call.
@@ -63,6 +67,7 @@ type execSetup struct {
 	UserID      *int
 	GroupID     *int
 	WorkingDir  string
+	Record      bool
 }
 
 // Exec creates a task that will execute the command with the given arguments.
@@ -137,6 +142,7 @@ func Exec(st *state.State, args *ExecArgs) (*state.Task, ExecMetadata, error) {
 		UserID:      args.UserID,
 		GroupID:     args.GroupID,
 		WorkingDir:  workingDir,
+		Record:      args.Record,
 	}
 	task.Set("exec-setup", &setup)
 
@@ -0,0 +1,241 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmdstate
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/wsutil"
+)
+
+// transcriptPruneInterval is how often transcripts of tasks that no longer
+// exist in the state are removed.
+var transcriptPruneInterval = time.Hour
+
+// TranscriptEvent is a single event in the transcript of an exec session.
+// Transcripts are stored as JSON Lines, one event per line.
+type TranscriptEvent struct {
+	// Type is "start", "stdin", "stdout", "stderr", "resize", "signal", or
+	// "exit".
+	Type string `json:"type"`
+
+	// Elapsed is the time since the session started, in seconds.
+	Elapsed float64 `json:"elapsed"`
+
+	// Time, Command, and Terminal are set for the "start" event.
+	Time     time.Time `json:"time,omitempty"`
+	Command  []string  `json:"command,omitempty"`
+	Terminal bool      `json:"terminal,omitempty"`
+	UserID   *int      `json:"user-id,omitempty"`
+	GroupID  *int      `json:"group-id,omitempty"`
+
+	// Data is the input or output, for "stdin", "stdout", and "stderr"
+	// events. It's encoded as base64 in JSON, as it may not be text.
+	Data []byte `json:"data,omitempty"`
+
+	// Width and Height are set for "start" and "resize" events.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+
+	// Signal is the name of the signal, for "signal" events.
+	Signal string `json:"signal,omitempty"`
+
+	// ExitCode is the command's exit code, for the "exit" event.
+	ExitCode *int `json:"exit-code,omitempty"`
+}
+
+// transcript records the events of an exec session to a file.
+type transcript struct {
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	start   time.Time
+}
+
+func createTranscript(path string) (*transcript, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &transcript{
+		file:    f,
+		writer:  w,
+		encoder: json.NewEncoder(w),
+		start:   time.Now(),
+	}, nil
+}
+
+// record writes an event to the transcript, setting its elapsed time.
+func (t *transcript) record(event *TranscriptEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return
+	}
+	event.Elapsed = time.Since(t.start).Seconds()
+	err := t.encoder.Encode(event)
+	if err == nil {
+		err = t.writer.Flush()
+	}
+	if err != nil {
+		logger.Noticef("Cannot write exec transcript %q: %v", t.file.Name(), err)
+	}
+}
+
+func (t *transcript) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return
+	}
+	err := t.file.Close()
+	if err != nil {
+		logger.Noticef("Cannot close exec transcript %q: %v", t.file.Name(), err)
+	}
+	t.file = nil
+}
+
+// transcriptWriter records data written to it as events of the given type
+// before writing it to w.
+type transcriptWriter struct {
+	t         *transcript
+	eventType string
+	w         io.Writer
+}
+
+func (w *transcriptWriter) Write(p []byte) (int, error) {
+	w.t.record(&TranscriptEvent{Type: w.eventType, Data: append([]byte(nil), p...)})
+	return w.w.Write(p)
+}
+
+// transcriptMessageWriter records binary websocket messages as events of the
+// given type before sending them.
+type transcriptMessageWriter struct {
+	t         *transcript
+	eventType string
+	conn      wsutil.MessageWriter
+}
+
+func (w *transcriptMessageWriter) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.BinaryMessage {
+		w.t.record(&TranscriptEvent{Type: w.eventType, Data: append([]byte(nil), data...)})
+	}
+	return w.conn.WriteMessage(messageType, data)
+}
+
+// TranscriptPath returns the path of the transcript file for the exec task
+// with the given ID. The file only exists if the exec was recorded.
+func (m *CommandManager) TranscriptPath(taskID string) string {
+	return filepath.Join(m.transcriptsDir, taskID+".jsonl")
+}
+
+// ReadTranscript returns the events recorded for the exec task with the
+// given ID. If the task wasn't recorded, the error satisfies
+// errors.Is(err, fs.ErrNotExist).
+func (m *CommandManager) ReadTranscript(taskID string) ([]*TranscriptEvent, error) {
+	f, err := os.Open(m.TranscriptPath(taskID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := []*TranscriptEvent{}
+	decoder := json.NewDecoder(f)
+	for {
+		var event TranscriptEvent
+		err := decoder.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+// pruneTranscripts removes the transcripts of exec tasks that have been
+// pruned from the state.
+func (m *CommandManager) pruneTranscripts() {
+	if m.transcriptsDir == "" || time.Since(m.lastPrune) < transcriptPruneInterval {
+		return
+	}
+	m.lastPrune = time.Now()
+
+	entries, err := os.ReadDir(m.transcriptsDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Noticef("Cannot read exec transcripts directory: %v", err)
+		}
+		return
+	}
+	m.state.Lock()
+	defer m.state.Unlock()
+	for _, entry := range entries {
+		taskID, ok := strings.CutSuffix(entry.Name(), ".jsonl")
+		if !ok || m.state.Task(taskID) != nil {
+			continue
+		}
+		err := os.Remove(filepath.Join(m.transcriptsDir, entry.Name()))
+		if err != nil {
+			logger.Noticef("Cannot remove exec transcript: %v", err)
+		}
+	}
+}
+
+// recordWriter returns a writer that records data written to w as events of
+// the given type, or w itself if the execution isn't being recorded.
+func (e *execution) recordWriter(eventType string, w io.Writer) io.Writer {
+	if e.transcript == nil {
+		return w
+	}
+	return &transcriptWriter{t: e.transcript, eventType: eventType, w: w}
+}
+
+// recordMessageWriter returns a websocket writer that records binary
+// messages sent to conn as events of the given type, or conn itself if the
+// execution isn't being recorded.
+func (e *execution) recordMessageWriter(eventType string, conn wsutil.MessageWriter) wsutil.MessageWriter {
+	if e.transcript == nil {
+		return conn
+	}
+	return &transcriptMessageWriter{t: e.transcript, eventType: eventType, conn: conn}
+}
+
+// record records an event in the transcript, if the execution is being
+// recorded.
+func (e *execution) record(event *TranscriptEvent) {
+	if e.transcript != nil {
+		e.transcript.record(event)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package configsourcestate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/bundle"
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/osutil"
+	"github.com/canonical/pebble/internals/overlord/planstate"
+)
+
+// DefaultInterval is how often the config source is checked for a new
+// bundle if no interval is given.
+const DefaultInterval = 5 * time.Minute
+
+// fetchTimeout limits how long a single fetch of the bundle may take.
+var fetchTimeout = time.Minute
+
+// Status is the state of the config source.
+type Status struct {
+	// URL is the config source's URL.
+	URL string
+	// Version is the version of the bundle currently applied, if any.
+	Version string
+	// LastCheck is when the config source was last checked successfully.
+	LastCheck time.Time
+	// Error is the error from the last check or apply, if it failed.
+	Error string
+}
+
+// ConfigSourceManager periodically fetches a signed layer bundle from an
+// HTTPS config source and, if it's newer than the bundle applied, applies
+// its layers to the plan, replacing the layers from the previous bundle.
+//
+// Bundles must be signed by one of the keys in the "trusted-keys" directory.
+// The last bundle applied is kept in the "config-source" directory, so that
+// it's applied again when the daemon starts, before the source is reached.
+type ConfigSourceManager struct {
+	planMgr  *planstate.PlanManager
+	url      string
+	interval time.Duration
+	keysDir  string
+	cacheDir string
+	client   *http.Client
+
+	mu     sync.Mutex
+	status Status
+	etag   string
+
+	tomb      tomb.Tomb
+	startedUp bool
+}
+
+// NewManager creates a new config source manager that fetches bundles from
+// sourceURL, which must use HTTPS, every interval (DefaultInterval if zero).
+func NewManager(planMgr *planstate.PlanManager, pebbleDir, sourceURL string, interval time.Duration) (*ConfigSourceManager, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config source URL: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid config source URL %q: must be an https:// URL", sourceURL)
+	}
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	if interval < 0 {
+		return nil, fmt.Errorf("invalid config source interval %s: must be positive", interval)
+	}
+	return &ConfigSourceManager{
+		planMgr:  planMgr,
+		url:      sourceURL,
+		interval: interval,
+		keysDir:  bundle.TrustedKeysDir(pebbleDir),
+		cacheDir: filepath.Join(pebbleDir, "config-source"),
+		client:   &http.Client{Timeout: fetchTimeout},
+		status:   Status{URL: sourceURL},
+	}, nil
+}
+
+// StartUp implements StateStarterUp.StartUp. It applies the last bundle
+// fetched, if any, and starts checking the config source.
+func (m *ConfigSourceManager) StartUp() error {
+	err := m.applyCached()
+	if err != nil {
+		logger.Noticef("Cannot apply cached config source bundle: %v", err)
+	}
+	m.startedUp = true
+	m.tomb.Go(m.loop)
+	return nil
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *ConfigSourceManager) Ensure() error {
+	return nil
+}
+
+// Stop implements StateStopper.Stop.
+func (m *ConfigSourceManager) Stop() {
+	if !m.startedUp {
+		return
+	}
+	m.tomb.Kill(nil)
+	m.tomb.Wait()
+}
+
+// Status returns the current state of the config source.
+func (m *ConfigSourceManager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+func (m *ConfigSourceManager) loop() error {
+	ctx := m.tomb.Context(context.Background())
+	for {
+		err := m.check(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		m.mu.Lock()
+		if err != nil {
+			logger.Noticef("Cannot update from config source: %v", err)
+			m.status.Error = err.Error()
+		} else {
+			m.status.Error = ""
+			m.status.LastCheck = timeNow()
+		}
+		m.mu.Unlock()
+
+		timer := time.NewTimer(m.interval)
+		select {
+		case <-timer.C:
+		case <-m.tomb.Dying():
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+var timeNow = time.Now
+
+// check fetches the bundle from the config source and applies it if it has
+// changed since the last check.
+func (m *ConfigSourceManager) check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", m.url, nil)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	etag := m.etag
+	m.mu.Unlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil
+	default:
+		return fmt.Errorf("cannot fetch bundle: unexpected status %q", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, bundle.MaxSize+1))
+	if err != nil {
+		return fmt.Errorf("cannot fetch bundle: %w", err)
+	}
+	if len(data) > bundle.MaxSize {
+		return fmt.Errorf("cannot fetch bundle: larger than %d bytes", bundle.MaxSize)
+	}
+
+	version, applied, err := m.apply(data)
+	if err != nil {
+		return err
+	}
+	etag = resp.Header.Get("ETag")
+	m.mu.Lock()
+	m.etag = etag
+	m.mu.Unlock()
+	if !applied {
+		return nil
+	}
+
+	err = m.writeCache(data, etag)
+	if err != nil {
+		logger.Noticef("Cannot cache config source bundle: %v", err)
+	}
+	logger.Noticef("Applied config source bundle version %q.", version)
+	return nil
+}
+
+// apply verifies the bundle and applies its layers if it's newer than the
+// bundle currently applied, returning its version and whether it was
+// applied. A bundle with the same version is ignored, and an older one is
+// rejected, so that an old bundle can't be replayed.
+func (m *ConfigSourceManager) apply(data []byte) (version string, applied bool, err error) {
+	keys, err := bundle.ReadKeysDir(m.keysDir)
+	if err != nil {
+		return "", false, err
+	}
+	if len(keys) == 0 {
+		return "", false, fmt.Errorf("no trusted keys in %q", m.keysDir)
+	}
+	b, err := bundle.Read(bytes.NewReader(data), keys)
+	if err != nil {
+		return "", false, err
+	}
+	m.mu.Lock()
+	current := m.status.Version
+	m.mu.Unlock()
+	if current != "" {
+		cmp := bundle.CompareVersions(b.Version, current)
+		if cmp == 0 {
+			return b.Version, false, nil
+		}
+		if cmp < 0 {
+			return "", false, fmt.Errorf("cannot apply bundle version %q: older than applied version %q", b.Version, current)
+		}
+	}
+	err = m.planMgr.SetBundleLayers(b.Layers)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot apply bundle version %q: %w", b.Version, err)
+	}
+	m.mu.Lock()
+	m.status.Version = b.Version
+	m.mu.Unlock()
+	return b.Version, true, nil
+}
+
+const (
+	cacheBundleName = "bundle.tar"
+	cacheETagName   = "etag"
+)
+
+// applyCached applies the last bundle fetched, if there is one.
+func (m *ConfigSourceManager) applyCached() error {
+	data, err := os.ReadFile(filepath.Join(m.cacheDir, cacheBundleName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	version, _, err := m.apply(data)
+	if err != nil {
+		return err
+	}
+	etag, err := os.ReadFile(filepath.Join(m.cacheDir, cacheETagName))
+	if err == nil {
+		m.mu.Lock()
+		m.etag = strings.TrimSpace(string(etag))
+		m.mu.Unlock()
+	}
+	logger.Noticef("Applied cached config source bundle version %q.", version)
+	return nil
+}
+
+func (m *ConfigSourceManager) writeCache(data []byte, etag string) error {
+	err := os.MkdirAll(m.cacheDir, 0700)
+	if err != nil {
+		return err
+	}
+	// Write the bundle first, so that a failure can't leave the ETag of a
+	// newer bundle with an older one, which would prevent fetching it.
+	err = osutil.AtomicWriteFile(filepath.Join(m.cacheDir, cacheBundleName), data, 0600, 0)
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(filepath.Join(m.cacheDir, cacheETagName), []byte(etag), 0600, 0)
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package configsourcestate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/bundle"
+	"github.com/canonical/pebble/internals/overlord/planstate"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type managerSuite struct {
+	pebbleDir string
+	pub       ed25519.PublicKey
+	priv      ed25519.PrivateKey
+	planMgr   *planstate.PlanManager
+
+	server   *httptest.Server
+	bundle   []byte
+	etag     string
+	requests []*http.Request
+}
+
+var _ = Suite(&managerSuite{})
+
+func (s *managerSuite) SetUpTest(c *C) {
+	s.pebbleDir = c.MkDir()
+	var err error
+	s.pub, s.priv, err = ed25519.GenerateKey(nil)
+	c.Assert(err, IsNil)
+	s.trustKey(c, "test.pub", s.pub)
+
+	s.planMgr, err = planstate.NewManager(nil, nil, s.pebbleDir)
+	c.Assert(err, IsNil)
+	err = s.planMgr.Load()
+	c.Assert(err, IsNil)
+
+	s.bundle, s.etag, s.requests = nil, "", nil
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests = append(s.requests, r)
+		if s.bundle == nil {
+			http.Error(w, "no bundle", http.StatusInternalServerError)
+			return
+		}
+		if s.etag != "" {
+			if r.Header.Get("If-None-Match") == s.etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", s.etag)
+		}
+		w.Write(s.bundle)
+	}))
+}
+
+func (s *managerSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *managerSuite) trustKey(c *C, name string, key ed25519.PublicKey) {
+	dir := filepath.Join(s.pebbleDir, "trusted-keys")
+	err := os.MkdirAll(dir, 0755)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(dir, name), []byte(base64.StdEncoding.EncodeToString(key)), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) makeBundle(c *C, version, command string, key ed25519.PrivateKey) []byte {
+	var buf bytes.Buffer
+	err := bundle.Write(&buf, version, map[string][]byte{
+		"001-remote.yaml": []byte(`
+services:
+    svc1:
+        override: replace
+        command: ` + command + `
+`),
+	}, key)
+	c.Assert(err, IsNil)
+	return buf.Bytes()
+}
+
+func (s *managerSuite) newManager(c *C) *ConfigSourceManager {
+	m, err := NewManager(s.planMgr, s.pebbleDir, s.server.URL+"/bundle", time.Hour)
+	c.Assert(err, IsNil)
+	m.client = s.server.Client()
+	return m
+}
+
+func (s *managerSuite) TestNewManagerErrors(c *C) {
+	_, err := NewManager(s.planMgr, s.pebbleDir, "http://example.com/bundle", 0)
+	c.Assert(err, ErrorMatches, `invalid config source URL "http://example.com/bundle": must be an https:// URL`)
+	_, err = NewManager(s.planMgr, s.pebbleDir, "https:///bundle", 0)
+	c.Assert(err, ErrorMatches, `invalid config source URL "https:///bundle": must be an https:// URL`)
+	_, err = NewManager(s.planMgr, s.pebbleDir, "https://example.com/bundle", -time.Second)
+	c.Assert(err, ErrorMatches, `invalid config source interval -1s: must be positive`)
+
+	m, err := NewManager(s.planMgr, s.pebbleDir, "https://example.com/bundle", 0)
+	c.Assert(err, IsNil)
+	c.Check(m.interval, Equals, DefaultInterval)
+}
+
+func (s *managerSuite) TestCheck(c *C) {
+	s.bundle = s.makeBundle(c, "v1", "echo v1", s.priv)
+	s.etag = `"v1"`
+	m := s.newManager(c)
+
+	err := m.check(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(m.Status().Version, Equals, "v1")
+	p := s.planMgr.Plan()
+	c.Assert(p.Layers, HasLen, 1)
+	c.Check(p.Layers[0].Label, Equals, "remote")
+	c.Check(p.Services["svc1"].Command, Equals, "echo v1")
+	c.Assert(s.requests, HasLen, 1)
+	c.Check(s.requests[0].URL.Path, Equals, "/bundle")
+	c.Check(s.requests[0].Header.Get("If-None-Match"), Equals, "")
+
+	// The bundle is cached with its ETag.
+	cached, err := os.ReadFile(filepath.Join(s.pebbleDir, "config-source", "bundle.tar"))
+	c.Assert(err, IsNil)
+	c.Check(cached, DeepEquals, s.bundle)
+	etag, err := os.ReadFile(filepath.Join(s.pebbleDir, "config-source", "etag"))
+	c.Assert(err, IsNil)
+	c.Check(string(etag), Equals, `"v1"`)
+
+	// An unchanged bundle isn't applied again.
+	var changed []*plan.Plan
+	s.planMgr.AddChangeListener(func(p *plan.Plan) {
+		changed = append(changed, p)
+	})
+	err = m.check(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(s.requests, HasLen, 2)
+	c.Check(s.requests[1].Header.Get("If-None-Match"), Equals, `"v1"`)
+	c.Check(changed, HasLen, 0)
+
+	// A new bundle replaces the previous one.
+	s.bundle = s.makeBundle(c, "v2", "echo v2", s.priv)
+	s.etag = `"v2"`
+	err = m.check(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(changed, HasLen, 1)
+	c.Check(m.Status().Version, Equals, "v2")
+	p = s.planMgr.Plan()
+	c.Assert(p.Layers, HasLen, 1)
+	c.Check(p.Services["svc1"].Command, Equals, "echo v2")
+}
+
+func (s *managerSuite) TestCheckVersions(c *C) {
+	s.bundle = s.makeBundle(c, "v2", "echo v2", s.priv)
+	m := s.newManager(c)
+	err := m.check(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(m.Status().Version, Equals, "v2")
+
+	var changed []*plan.Plan
+	s.planMgr.AddChangeListener(func(p *plan.Plan) {
+		changed = append(changed, p)
+	})
+
+	// A bundle with the same version is ignored, even without an ETag.
+	s.bundle = s.makeBundle(c, "v2", "echo other", s.priv)
+	err = m.check(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(changed, HasLen, 0)
+
+	// An older bundle is rejected, so it can't be replayed.
+	s.bundle = s.makeBundle(c, "v1", "echo v1", s.priv)
+	err = m.check(context.Background())
+	c.Assert(err, ErrorMatches, `cannot apply bundle version "v1": older than applied version "v2"`)
+	c.Check(changed, HasLen, 0)
+	c.Check(m.Status().Version, Equals, "v2")
+	c.Check(s.planMgr.Plan().Services["svc1"].Command, Equals, "echo v2")
+
+	// The cached bundle is still the newest one.
+	cached, err := os.ReadFile(filepath.Join(s.pebbleDir, "config-source", "bundle.tar"))
+	c.Assert(err, IsNil)
+	b, err := bundle.Read(bytes.NewReader(cached), []ed25519.PublicKey{s.pub})
+	c.Assert(err, IsNil)
+	c.Check(b.Version, Equals, "v2")
+
+	s.bundle = s.makeBundle(c, "v10", "echo v10", s.priv)
+	err = m.check(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(m.Status().Version, Equals, "v10")
+	c.Check(s.planMgr.Plan().Services["svc1"].Command, Equals, "echo v10")
+}
+
+func (s *managerSuite) TestCheckErrors(c *C) {
+	m := s.newManager(c)
+	err := m.check(context.Background())
+	c.Assert(err, ErrorMatches, `cannot fetch bundle: unexpected status "500 Internal Server Error"`)
+
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	c.Assert(err, IsNil)
+	s.bundle = s.makeBundle(c, "v1", "echo v1", otherKey)
+	err = m.check(context.Background())
+	c.Assert(err, ErrorMatches, `invalid bundle: signature not made by a trusted key`)
+
+	s.bundle = s.makeBundle(c, "v1", "echo ${PEBBLE_TEST_UNDEFINED_VAR}", s.priv)
+	err = m.check(context.Background())
+	c.Assert(err, ErrorMatches, `cannot apply bundle version "v1": .* not defined`)
+
+	err = os.RemoveAll(filepath.Join(s.pebbleDir, "trusted-keys"))
+	c.Assert(err, IsNil)
+	s.bundle = s.makeBundle(c, "v1", "echo v1", s.priv)
+	err = m.check(context.Background())
+	c.Assert(err, ErrorMatches, `no trusted keys in ".*/trusted-keys"`)
+
+	// Nothing was applied or cached.
+	c.Check(s.planMgr.Plan().Layers, HasLen, 0)
+	c.Check(m.Status().Version, Equals, "")
+	_, err = os.Stat(filepath.Join(s.pebbleDir, "config-source"))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *managerSuite) TestStartUpAppliesCached(c *C) {
+	s.bundle = s.makeBundle(c, "v1", "echo v1", s.priv)
+	s.etag = `"v1"`
+	m := s.newManager(c)
+	err := m.check(context.Background())
+	c.Assert(err, IsNil)
+
+	// A new daemon applies the cached bundle even if the source fails.
+	s.bundle = nil
+	planMgr, err := planstate.NewManager(nil, nil, s.pebbleDir)
+	c.Assert(err, IsNil)
+	err = planMgr.Load()
+	c.Assert(err, IsNil)
+	s.planMgr = planMgr
+	m = s.newManager(c)
+	err = m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+
+	c.Check(m.Status().Version, Equals, "v1")
+	c.Check(planMgr.Plan().Services["svc1"].Command, Equals, "echo v1")
+
+	// The check started by StartUp reports the failure.
+	for i := 0; m.Status().Error == "" && i < 500; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(m.Status().Error, Matches, `cannot fetch bundle: unexpected status .*`)
+	c.Check(m.Status().Version, Equals, "v1")
+}
+
+func (s *managerSuite) TestStartUpSendsCachedETag(c *C) {
+	s.bundle = s.makeBundle(c, "v1", "echo v1", s.priv)
+	s.etag = `"v1"`
+	m := s.newManager(c)
+	err := m.check(context.Background())
+	c.Assert(err, IsNil)
+	s.requests = nil
+
+	m = s.newManager(c)
+	err = m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+	for i := 0; m.Status().LastCheck.IsZero() && i < 500; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(m.Status().LastCheck.IsZero(), Equals, false)
+	c.Assert(s.requests, HasLen, 1)
+	c.Check(s.requests[0].Header.Get("If-None-Match"), Equals, `"v1"`)
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package devstate
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// DeviceNotice is recorded when a device in the plan becomes ready or stops
+// being ready. The key is the device's name, and the "ready" data field is
+// "true" or "false".
+const DeviceNotice state.NoticeType = "device"
+
+func init() {
+	err := state.RegisterNoticeType(DeviceNotice)
+	if err != nil {
+		panic(err)
+	}
+}
+
+var (
+	// sysfsDir is where the kernel's devices are listed by subsystem.
+	sysfsDir = "/sys"
+
+	// pollInterval is how often the devices are checked between uevents.
+	// Polling covers nodes that udev creates some time after the kernel's
+	// uevent (such as the links in /dev/serial/by-id), and systems where
+	// the uevent socket can't be opened (such as some containers).
+	pollInterval = time.Second
+)
+
+// DeviceManager tracks the readiness of the devices configured in the
+// "devices" section of the plan, such as USB modems that only appear once
+// they've been enumerated. It watches the kernel's uevents to notice
+// devices being added and removed, and records a "device" notice each time
+// a device becomes ready or stops being ready. Services wait for the
+// devices they require before starting, and device checks are up while
+// their device is ready.
+type DeviceManager struct {
+	state *state.State
+
+	mu        sync.Mutex
+	configs   map[string]*plan.Device
+	ready     map[string]bool
+	startedUp bool
+
+	tomb tomb.Tomb
+}
+
+// NewManager creates a new device manager.
+func NewManager(s *state.State) *DeviceManager {
+	return &DeviceManager{
+		state: s,
+		ready: make(map[string]bool),
+	}
+}
+
+// PlanChanged handles updates to the plan (server configuration).
+func (m *DeviceManager) PlanChanged(p *plan.Plan) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.configs = p.Devices
+	if m.startedUp {
+		m.update()
+	}
+}
+
+// StartUp implements StateStarterUp.StartUp. It checks the devices in the
+// plan, and starts watching for devices being added and removed.
+func (m *DeviceManager) StartUp() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.startedUp = true
+	m.update()
+
+	events := make(chan struct{}, 1)
+	fd, err := openUeventSocket()
+	if err != nil {
+		logger.Noticef("Cannot watch device events (polling instead): %v", err)
+	} else {
+		m.tomb.Go(func() error {
+			m.readUevents(fd, events)
+			return nil
+		})
+	}
+	m.tomb.Go(func() error {
+		m.watch(events)
+		return nil
+	})
+	return nil
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *DeviceManager) Ensure() error {
+	return nil
+}
+
+// Stop implements StateStopper.Stop. It stops watching devices.
+func (m *DeviceManager) Stop() {
+	m.mu.Lock()
+	startedUp := m.startedUp
+	m.mu.Unlock()
+	if !startedUp {
+		return
+	}
+	m.tomb.Kill(nil)
+	m.tomb.Wait()
+}
+
+// DeviceReady reports whether the named device in the plan is ready.
+func (m *DeviceManager) DeviceReady(name string) bool {
+	m.mu.Lock()
+	config, ok := m.configs[name]
+	m.mu.Unlock()
+	return ok && deviceReady(config)
+}
+
+// watch checks the devices after each uevent, and every pollInterval.
+func (m *DeviceManager) watch(events <-chan struct{}) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-events:
+		case <-ticker.C:
+		case <-m.tomb.Dying():
+			return
+		}
+		m.mu.Lock()
+		m.update()
+		m.mu.Unlock()
+	}
+}
+
+// update checks whether each device is ready, recording a notice for those
+// whose readiness has changed. It must be called with m.mu held.
+func (m *DeviceManager) update() {
+	for name := range m.ready {
+		if _, ok := m.configs[name]; !ok {
+			delete(m.ready, name)
+		}
+	}
+
+	names := make([]string, 0, len(m.configs))
+	for name := range m.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ready := deviceReady(m.configs[name])
+		if old, ok := m.ready[name]; ok && old == ready {
+			continue
+		}
+		m.ready[name] = ready
+		if ready {
+			logger.Noticef("Device %q is ready", name)
+		} else {
+			logger.Noticef("Device %q is not ready", name)
+		}
+		m.state.Lock()
+		_, err := m.state.AddNotice(nil, DeviceNotice, name, &state.AddNoticeOptions{
+			Data: map[string]string{"ready": strconv.FormatBool(ready)},
+		})
+		m.state.Unlock()
+		if err != nil {
+			logger.Noticef("Cannot record notice for device %q: %v", name, err)
+		}
+	}
+}
+
+// deviceReady reports whether the device's node exists and, if it names a
+// subsystem, whether a device of that subsystem is present.
+func deviceReady(config *plan.Device) bool {
+	if config.Path != "" {
+		if _, err := os.Stat(config.Path); err != nil {
+			return false
+		}
+	}
+	if config.Subsystem != "" && !subsystemPresent(config.Subsystem) {
+		return false
+	}
+	return true
+}
+
+// subsystemPresent reports whether any device of the subsystem is present,
+// whether the subsystem is a device class (like "tty") or a bus (like
+// "usb").
+func subsystemPresent(subsystem string) bool {
+	for _, dir := range []string{
+		filepath.Join(sysfsDir, "class", subsystem),
+		filepath.Join(sysfsDir, "bus", subsystem, "devices"),
+	} {
+		entries, err := os.ReadDir(dir)
+		if err == nil && len(entries) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// openUeventSocket opens a netlink socket that receives the kernel's
+// uevents. Reads time out after a second, so that the reader can stop.
+func openUeventSocket() (int, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return -1, err
+	}
+	err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1})
+	if err == nil {
+		err = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 1})
+	}
+	if err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// readUevents reads uevents from the socket until the manager is stopped,
+// signalling events for each one.
+func (m *DeviceManager) readUevents(fd int, events chan<- struct{}) {
+	defer unix.Close(fd)
+	buf := make([]byte, 64*1024)
+	for m.tomb.Alive() {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			logger.Noticef("Cannot read device events (polling instead): %v", err)
+			return
+		}
+		event := parseUevent(buf[:n])
+		if event == nil {
+			continue
+		}
+		logger.Debugf("Device event: %s %s (subsystem %q)", event["ACTION"], event["DEVPATH"], event["SUBSYSTEM"])
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// parseUevent parses a kernel uevent message, which is a header like
+// "add@/devices/..." followed by KEY=value fields, all NUL-terminated. It
+// returns nil if the message isn't a kernel uevent.
+func parseUevent(msg []byte) map[string]string {
+	parts := bytes.Split(msg, []byte{0})
+	if len(parts) == 0 || !bytes.Contains(parts[0], []byte("@")) {
+		return nil
+	}
+	event := make(map[string]string)
+	for _, part := range parts[1:] {
+		key, value, ok := bytes.Cut(part, []byte("="))
+		if ok {
+			event[string(key)] = string(value)
+		}
+	}
+	if event["ACTION"] == "" || event["DEVPATH"] == "" {
+		return nil
+	}
+	return event
+}
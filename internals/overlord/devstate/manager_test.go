@@ -0,0 +1,156 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package devstate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type managerSuite struct {
+	dir      string
+	oldSysfs string
+	oldPoll  time.Duration
+}
+
+var _ = Suite(&managerSuite{})
+
+func (s *managerSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.oldSysfs, s.oldPoll = sysfsDir, pollInterval
+	sysfsDir = filepath.Join(s.dir, "sys")
+	pollInterval = 10 * time.Millisecond
+}
+
+func (s *managerSuite) TearDownTest(c *C) {
+	sysfsDir, pollInterval = s.oldSysfs, s.oldPoll
+}
+
+// waitNotice waits for the device's notice to have the given "ready" data.
+func waitNotice(c *C, st *state.State, name string, ready string) {
+	for i := 0; i < 500; i++ {
+		st.Lock()
+		notices := st.Notices(&state.NoticeFilter{Types: []state.NoticeType{DeviceNotice}, Keys: []string{name}})
+		var data []byte
+		var err error
+		if len(notices) == 1 {
+			data, err = json.Marshal(notices[0])
+		}
+		st.Unlock()
+		if len(notices) == 1 {
+			c.Assert(err, IsNil)
+			var notice struct {
+				LastData map[string]string `json:"last-data"`
+			}
+			err = json.Unmarshal(data, &notice)
+			c.Assert(err, IsNil)
+			if notice.LastData["ready"] == ready {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("timed out waiting for device %q notice with ready=%s", name, ready)
+}
+
+func (s *managerSuite) TestReadiness(c *C) {
+	modemPath := filepath.Join(s.dir, "ttyUSB0")
+	st := state.New(nil)
+	m := NewManager(st)
+	m.PlanChanged(&plan.Plan{Devices: map[string]*plan.Device{
+		"modem": {Name: "modem", Path: modemPath},
+		"usb":   {Name: "usb", Subsystem: "usb"},
+		"tty":   {Name: "tty", Path: modemPath, Subsystem: "tty"},
+	}})
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+
+	waitNotice(c, st, "modem", "false")
+	c.Check(m.DeviceReady("modem"), Equals, false)
+	c.Check(m.DeviceReady("usb"), Equals, false)
+	c.Check(m.DeviceReady("unknown"), Equals, false)
+
+	// The device node appears.
+	err = os.WriteFile(modemPath, nil, 0644)
+	c.Assert(err, IsNil)
+	waitNotice(c, st, "modem", "true")
+	c.Check(m.DeviceReady("modem"), Equals, true)
+
+	// A bus device appears.
+	err = os.MkdirAll(filepath.Join(sysfsDir, "bus", "usb", "devices", "1-1"), 0755)
+	c.Assert(err, IsNil)
+	waitNotice(c, st, "usb", "true")
+	c.Check(m.DeviceReady("usb"), Equals, true)
+
+	// Both the node and a device of the class are needed.
+	c.Check(m.DeviceReady("tty"), Equals, false)
+	err = os.MkdirAll(filepath.Join(sysfsDir, "class", "tty", "ttyUSB0"), 0755)
+	c.Assert(err, IsNil)
+	waitNotice(c, st, "tty", "true")
+
+	// The device node is removed.
+	err = os.Remove(modemPath)
+	c.Assert(err, IsNil)
+	waitNotice(c, st, "modem", "false")
+	waitNotice(c, st, "tty", "false")
+	c.Check(m.DeviceReady("modem"), Equals, false)
+}
+
+func (s *managerSuite) TestPlanChanged(c *C) {
+	modemPath := filepath.Join(s.dir, "ttyUSB0")
+	err := os.WriteFile(modemPath, nil, 0644)
+	c.Assert(err, IsNil)
+
+	st := state.New(nil)
+	m := NewManager(st)
+	err = m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+	c.Check(m.DeviceReady("modem"), Equals, false)
+
+	m.PlanChanged(&plan.Plan{Devices: map[string]*plan.Device{
+		"modem": {Name: "modem", Path: modemPath},
+	}})
+	c.Check(m.DeviceReady("modem"), Equals, true)
+	waitNotice(c, st, "modem", "true")
+
+	m.PlanChanged(&plan.Plan{})
+	c.Check(m.DeviceReady("modem"), Equals, false)
+}
+
+func (s *managerSuite) TestParseUevent(c *C) {
+	event := parseUevent([]byte("add@/devices/pci0000:00/usb1/1-1\x00ACTION=add\x00DEVPATH=/devices/pci0000:00/usb1/1-1\x00SUBSYSTEM=usb\x00SEQNUM=1234\x00"))
+	c.Check(event, DeepEquals, map[string]string{
+		"ACTION":    "add",
+		"DEVPATH":   "/devices/pci0000:00/usb1/1-1",
+		"SUBSYSTEM": "usb",
+		"SEQNUM":    "1234",
+	})
+
+	c.Check(parseUevent([]byte("libudev\x00\xfe\xed\xca\xfe")), IsNil)
+	c.Check(parseUevent([]byte("remove@/devices/x\x00SUBSYSTEM=usb\x00")), IsNil)
+	c.Check(parseUevent(nil), IsNil)
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package inventorystate
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	sysDir  = "/sys"
+	procDir = "/proc"
+)
+
+// Inventory holds the hardware facts collected when the daemon starts.
+// Facts that can't be determined are left empty.
+type Inventory struct {
+	Vendor  string             `json:"vendor,omitempty"`
+	Model   string             `json:"model,omitempty"`
+	Serial  string             `json:"serial,omitempty"`
+	CPU     CPU                `json:"cpu"`
+	Memory  uint64             `json:"memory"`
+	Storage []Disk             `json:"storage"`
+	Network []NetworkInterface `json:"network"`
+}
+
+// CPU describes the system's processors.
+type CPU struct {
+	Model string `json:"model,omitempty"`
+	Count int    `json:"count"`
+}
+
+// Disk is a block device backed by hardware (not a loop or RAM device).
+type Disk struct {
+	Name      string `json:"name"`
+	Size      uint64 `json:"size"`
+	Removable bool   `json:"removable,omitempty"`
+}
+
+// NetworkInterface is a network interface backed by hardware.
+type NetworkInterface struct {
+	Name string `json:"name"`
+	MAC  string `json:"mac,omitempty"`
+}
+
+func (inv *Inventory) copy() *Inventory {
+	copied := *inv
+	copied.Storage = make([]Disk, len(inv.Storage))
+	copy(copied.Storage, inv.Storage)
+	copied.Network = make([]NetworkInterface, len(inv.Network))
+	copy(copied.Network, inv.Network)
+	return &copied
+}
+
+// collect reads the hardware facts from sysfs and procfs. It doesn't fail:
+// facts that can't be read are left empty.
+func collect() *Inventory {
+	inv := &Inventory{
+		Vendor:  readDMI("sys_vendor"),
+		Model:   readDMI("product_name"),
+		Serial:  readDMI("product_serial"),
+		CPU:     readCPU(),
+		Memory:  readMemory(),
+		Storage: readStorage(),
+		Network: readNetwork(),
+	}
+	// Devices without DMI (such as most ARM boards) describe themselves in
+	// the device tree instead.
+	if inv.Model == "" {
+		inv.Model = readValue(filepath.Join(procDir, "device-tree", "model"))
+	}
+	if inv.Serial == "" {
+		inv.Serial = readValue(filepath.Join(procDir, "device-tree", "serial-number"))
+	}
+	return inv
+}
+
+// readValue returns the trimmed contents of a sysfs or procfs file, or ""
+// if it can't be read.
+func readValue(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+}
+
+func readDMI(name string) string {
+	return readValue(filepath.Join(sysDir, "class", "dmi", "id", name))
+}
+
+func readCPU() CPU {
+	var cpu CPU
+	f, err := os.Open(filepath.Join(procDir, "cpuinfo"))
+	if err != nil {
+		return cpu
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		switch key {
+		case "processor":
+			cpu.Count++
+		case "model name", "Model", "Hardware":
+			// "model name" is used on x86, and "Model" or "Hardware" on
+			// ARM, where the per-processor fields don't name the model.
+			if cpu.Model == "" || key == "model name" {
+				cpu.Model = value
+			}
+		}
+	}
+	return cpu
+}
+
+// readMemory returns the total memory in bytes.
+func readMemory() uint64 {
+	f, err := os.Open(filepath.Join(procDir, "meminfo"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
+
+// hasDevice reports whether the sysfs entry at path is backed by a hardware
+// device, as opposed to a virtual one.
+func hasDevice(path string) bool {
+	_, err := os.Stat(filepath.Join(path, "device"))
+	return err == nil
+}
+
+func readStorage() []Disk {
+	disks := []Disk{}
+	for _, name := range readDirNames(filepath.Join(sysDir, "block")) {
+		path := filepath.Join(sysDir, "block", name)
+		if !hasDevice(path) {
+			continue
+		}
+		// The size is always given in 512-byte sectors.
+		sectors, _ := strconv.ParseUint(readValue(filepath.Join(path, "size")), 10, 64)
+		disks = append(disks, Disk{
+			Name:      name,
+			Size:      sectors * 512,
+			Removable: readValue(filepath.Join(path, "removable")) == "1",
+		})
+	}
+	return disks
+}
+
+func readNetwork() []NetworkInterface {
+	ifaces := []NetworkInterface{}
+	for _, name := range readDirNames(filepath.Join(sysDir, "class", "net")) {
+		path := filepath.Join(sysDir, "class", "net", name)
+		if !hasDevice(path) {
+			continue
+		}
+		ifaces = append(ifaces, NetworkInterface{
+			Name: name,
+			MAC:  readValue(filepath.Join(path, "address")),
+		})
+	}
+	return ifaces
+}
+
+// readDirNames returns the sorted names of the entries in dir, or nil if it
+// can't be read.
+func readDirNames(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package inventorystate
+
+import (
+	"strconv"
+)
+
+// InventoryManager holds the hardware facts of the device Pebble is running
+// on. The facts are collected once, when the manager is created, so that
+// they're available to the plan before it's first loaded.
+type InventoryManager struct {
+	inventory *Inventory
+}
+
+// NewManager creates a new inventory manager, collecting the hardware facts.
+func NewManager() *InventoryManager {
+	return &InventoryManager{inventory: collect()}
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *InventoryManager) Ensure() error {
+	return nil
+}
+
+// Inventory returns a copy of the hardware facts.
+func (m *InventoryManager) Inventory() *Inventory {
+	return m.inventory.copy()
+}
+
+// Facts returns the facts used by plan "when" expressions and variables,
+// such as "model" and "cpu_count". Facts that couldn't be determined are
+// empty.
+func (m *InventoryManager) Facts() map[string]string {
+	inv := m.inventory
+	facts := map[string]string{
+		"vendor":    inv.Vendor,
+		"model":     inv.Model,
+		"serial":    inv.Serial,
+		"cpu_model": inv.CPU.Model,
+		"cpu_count": "",
+		"memory":    "",
+	}
+	if inv.CPU.Count > 0 {
+		facts["cpu_count"] = strconv.Itoa(inv.CPU.Count)
+	}
+	if inv.Memory > 0 {
+		facts["memory"] = strconv.FormatUint(inv.Memory, 10)
+	}
+	return facts
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package inventorystate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type managerSuite struct {
+	oldSysDir  string
+	oldProcDir string
+}
+
+var _ = Suite(&managerSuite{})
+
+func (s *managerSuite) SetUpTest(c *C) {
+	s.oldSysDir, s.oldProcDir = sysDir, procDir
+	sysDir = c.MkDir()
+	procDir = c.MkDir()
+}
+
+func (s *managerSuite) TearDownTest(c *C) {
+	sysDir, procDir = s.oldSysDir, s.oldProcDir
+}
+
+func writeFile(c *C, path, content string) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(path, []byte(content), 0644)
+	c.Assert(err, IsNil)
+}
+
+// addDevice creates a sysfs entry in dir with the given attributes. If
+// hardware is true, the entry has a "device" link like a real device.
+func addDevice(c *C, dir string, hardware bool, attrs map[string]string) {
+	err := os.MkdirAll(dir, 0755)
+	c.Assert(err, IsNil)
+	if hardware {
+		err = os.Mkdir(filepath.Join(dir, "device"), 0755)
+		c.Assert(err, IsNil)
+	}
+	for name, value := range attrs {
+		writeFile(c, filepath.Join(dir, name), value)
+	}
+}
+
+const cpuinfoX86 = `processor	: 0
+vendor_id	: GenuineIntel
+model name	: Intel(R) Core(TM) i5-8250U CPU @ 1.60GHz
+
+processor	: 1
+vendor_id	: GenuineIntel
+model name	: Intel(R) Core(TM) i5-8250U CPU @ 1.60GHz
+`
+
+const meminfo = `MemTotal:        8048136 kB
+MemFree:          123456 kB
+`
+
+func (s *managerSuite) TestCollect(c *C) {
+	dmi := filepath.Join(sysDir, "class", "dmi", "id")
+	writeFile(c, filepath.Join(dmi, "sys_vendor"), "ACME\n")
+	writeFile(c, filepath.Join(dmi, "product_name"), "Gateway 3000\n")
+	writeFile(c, filepath.Join(dmi, "product_serial"), "SN-1234\n")
+	writeFile(c, filepath.Join(procDir, "cpuinfo"), cpuinfoX86)
+	writeFile(c, filepath.Join(procDir, "meminfo"), meminfo)
+
+	addDevice(c, filepath.Join(sysDir, "block", "sda"), true, map[string]string{
+		"size":      "1000215216\n",
+		"removable": "0\n",
+	})
+	addDevice(c, filepath.Join(sysDir, "block", "mmcblk0"), true, map[string]string{
+		"size":      "62333952\n",
+		"removable": "1\n",
+	})
+	addDevice(c, filepath.Join(sysDir, "block", "loop0"), false, map[string]string{
+		"size": "8\n",
+	})
+	addDevice(c, filepath.Join(sysDir, "class", "net", "eth0"), true, map[string]string{
+		"address": "00:11:22:33:44:55\n",
+	})
+	addDevice(c, filepath.Join(sysDir, "class", "net", "lo"), false, map[string]string{
+		"address": "00:00:00:00:00:00\n",
+	})
+
+	m := NewManager()
+	c.Check(m.Inventory(), DeepEquals, &Inventory{
+		Vendor: "ACME",
+		Model:  "Gateway 3000",
+		Serial: "SN-1234",
+		CPU: CPU{
+			Model: "Intel(R) Core(TM) i5-8250U CPU @ 1.60GHz",
+			Count: 2,
+		},
+		Memory: 8048136 * 1024,
+		Storage: []Disk{
+			{Name: "mmcblk0", Size: 62333952 * 512, Removable: true},
+			{Name: "sda", Size: 1000215216 * 512},
+		},
+		Network: []NetworkInterface{
+			{Name: "eth0", MAC: "00:11:22:33:44:55"},
+		},
+	})
+	c.Check(m.Facts(), DeepEquals, map[string]string{
+		"vendor":    "ACME",
+		"model":     "Gateway 3000",
+		"serial":    "SN-1234",
+		"cpu_model": "Intel(R) Core(TM) i5-8250U CPU @ 1.60GHz",
+		"cpu_count": "2",
+		"memory":    "8241291264",
+	})
+}
+
+func (s *managerSuite) TestCollectDeviceTree(c *C) {
+	writeFile(c, filepath.Join(procDir, "device-tree", "model"), "Raspberry Pi 4 Model B Rev 1.4\x00")
+	writeFile(c, filepath.Join(procDir, "device-tree", "serial-number"), "10000000abcdef01\x00")
+	writeFile(c, filepath.Join(procDir, "cpuinfo"), `processor	: 0
+BogoMIPS	: 108.00
+
+processor	: 1
+BogoMIPS	: 108.00
+
+Hardware	: BCM2835
+Model		: Raspberry Pi 4 Model B Rev 1.4
+`)
+
+	m := NewManager()
+	inv := m.Inventory()
+	c.Check(inv.Vendor, Equals, "")
+	c.Check(inv.Model, Equals, "Raspberry Pi 4 Model B Rev 1.4")
+	c.Check(inv.Serial, Equals, "10000000abcdef01")
+	c.Check(inv.CPU, Equals, CPU{Model: "BCM2835", Count: 2})
+}
+
+func (s *managerSuite) TestCollectNothing(c *C) {
+	m := NewManager()
+	c.Check(m.Inventory(), DeepEquals, &Inventory{
+		Storage: []Disk{},
+		Network: []NetworkInterface{},
+	})
+	c.Check(m.Facts(), DeepEquals, map[string]string{
+		"vendor":    "",
+		"model":     "",
+		"serial":    "",
+		"cpu_model": "",
+		"cpu_count": "",
+		"memory":    "",
+	})
+}
+
+func (s *managerSuite) TestInventoryCopy(c *C) {
+	addDevice(c, filepath.Join(sysDir, "class", "net", "eth0"), true, map[string]string{
+		"address": "00:11:22:33:44:55\n",
+	})
+
+	m := NewManager()
+	inv := m.Inventory()
+	inv.Network[0].MAC = "changed"
+	c.Check(m.Inventory().Network[0].MAC, Equals, "00:11:22:33:44:55")
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package kmodstate
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/reaper"
+)
+
+// KernelModuleManager loads the kernel modules listed in the
+// "kernel-modules" section of the plan.
+//
+// Modules are loaded at start-up and when they're added to the plan. Modules
+// removed from the plan are left loaded, as unloading a module may break
+// whatever is using it; similarly, changed parameters only take effect the
+// next time the module is loaded.
+type KernelModuleManager struct {
+	mu        sync.Mutex
+	modules   map[string]*plan.KernelModule // modules required by the plan
+	loaded    map[string]*plan.KernelModule // modules loaded by this manager
+	startedUp bool
+}
+
+// NewManager creates a new kernel module manager.
+func NewManager() *KernelModuleManager {
+	return &KernelModuleManager{
+		modules: make(map[string]*plan.KernelModule),
+		loaded:  make(map[string]*plan.KernelModule),
+	}
+}
+
+// PlanChanged handles updates to the plan (server configuration), loading
+// any newly-added modules once the manager has started up.
+func (m *KernelModuleManager) PlanChanged(p *plan.Plan) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modules := make(map[string]*plan.KernelModule, len(p.KernelModules))
+	for name, module := range p.KernelModules {
+		modules[name] = module
+	}
+	m.modules = modules
+
+	if m.startedUp {
+		m.load()
+	}
+}
+
+// StartUp implements StateStarterUp.StartUp, loading the modules in the
+// current plan. Failure to load a module is logged, but doesn't prevent the
+// daemon from starting.
+func (m *KernelModuleManager) StartUp() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.startedUp = true
+	m.load()
+	return nil
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *KernelModuleManager) Ensure() error {
+	return nil
+}
+
+// load loads the modules in the plan that haven't been loaded yet, in name
+// order. The caller must hold m.mu.
+func (m *KernelModuleManager) load() {
+	names := make([]string, 0, len(m.modules))
+	for name := range m.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		module := m.modules[name]
+		if loaded, ok := m.loaded[name]; ok {
+			if !parametersEqual(loaded.Parameters, module.Parameters) {
+				logger.Noticef("Kernel module %q parameters changed; they will take effect when it is next loaded", name)
+			}
+			continue
+		}
+		err := modprobe(name, moduleArgs(module))
+		if err != nil {
+			logger.Noticef("Cannot load kernel module %q: %v", name, err)
+			continue
+		}
+		logger.Noticef("Loaded kernel module %q", name)
+		m.loaded[name] = module.Copy()
+	}
+}
+
+// moduleArgs returns the module's parameters as "name=value" arguments,
+// sorted by parameter name.
+func moduleArgs(module *plan.KernelModule) []string {
+	args := make([]string, 0, len(module.Parameters))
+	for name, value := range module.Parameters {
+		args = append(args, name+"="+value)
+	}
+	sort.Strings(args)
+	return args
+}
+
+func parametersEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+var modprobe = runModprobe
+
+// runModprobe runs modprobe to load the named module (and any modules it
+// depends on) with the given parameters.
+func runModprobe(name string, params []string) error {
+	args := append([]string{"--", name}, params...)
+	cmd := exec.Command("modprobe", args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := reaper.StartCommand(cmd)
+	if err != nil {
+		return err
+	}
+	exitCode, err := reaper.WaitCommand(cmd)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		out := strings.TrimSpace(output.String())
+		if out == "" {
+			return fmt.Errorf("modprobe exited with status %d", exitCode)
+		}
+		return fmt.Errorf("modprobe exited with status %d: %s", exitCode, out)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package kmodstate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type managerSuite struct {
+	calls       []string
+	failModules map[string]bool
+	oldModprobe func(string, []string) error
+}
+
+var _ = Suite(&managerSuite{})
+
+func (s *managerSuite) SetUpTest(c *C) {
+	s.calls = nil
+	s.failModules = make(map[string]bool)
+	s.oldModprobe = modprobe
+	modprobe = func(name string, params []string) error {
+		s.calls = append(s.calls, strings.TrimSpace(name+" "+strings.Join(params, " ")))
+		if s.failModules[name] {
+			return errors.New("module not found")
+		}
+		return nil
+	}
+}
+
+func (s *managerSuite) TearDownTest(c *C) {
+	modprobe = s.oldModprobe
+}
+
+func (s *managerSuite) TestStartUpLoadsModules(c *C) {
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{KernelModules: map[string]*plan.KernelModule{
+		"wireguard": {Name: "wireguard"},
+		"i2c_dev":   {Name: "i2c_dev", Parameters: map[string]string{"debug": "1", "bus": "2"}},
+	}})
+	c.Assert(s.calls, HasLen, 0)
+
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	c.Check(s.calls, DeepEquals, []string{
+		"i2c_dev bus=2 debug=1",
+		"wireguard",
+	})
+}
+
+func (s *managerSuite) TestPlanChangedLoadsNewModules(c *C) {
+	m := NewManager()
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+
+	m.PlanChanged(&plan.Plan{KernelModules: map[string]*plan.KernelModule{
+		"a": {Name: "a"},
+	}})
+	c.Check(s.calls, DeepEquals, []string{"a"})
+
+	// Already-loaded modules aren't reloaded, even if their parameters
+	// change, and removed modules aren't unloaded.
+	s.calls = nil
+	m.PlanChanged(&plan.Plan{KernelModules: map[string]*plan.KernelModule{
+		"a": {Name: "a", Parameters: map[string]string{"x": "y"}},
+		"b": {Name: "b"},
+	}})
+	c.Check(s.calls, DeepEquals, []string{"b"})
+
+	s.calls = nil
+	m.PlanChanged(&plan.Plan{})
+	c.Check(s.calls, HasLen, 0)
+}
+
+func (s *managerSuite) TestLoadFailureRetried(c *C) {
+	s.failModules["a"] = true
+
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{KernelModules: map[string]*plan.KernelModule{
+		"a": {Name: "a"},
+		"b": {Name: "b"},
+	}})
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	c.Check(s.calls, DeepEquals, []string{"a", "b"})
+
+	// Failed module is retried on the next plan change.
+	s.calls = nil
+	delete(s.failModules, "a")
+	m.PlanChanged(&plan.Plan{KernelModules: map[string]*plan.KernelModule{
+		"a": {Name: "a"},
+		"b": {Name: "b"},
+	}})
+	c.Check(s.calls, DeepEquals, []string{"a"})
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"gopkg.in/tomb.v2"
@@ -40,6 +41,10 @@ const (
 	// timeoutFinalFlush is measured from when the gatherer's main loop finishes,
 	// NOT from when Stop() is called like the other constants.
 	timeoutFinalFlush = 2 * time.Second
+
+	// failingWarnAfter is how long a target must fail to deliver logs
+	// before the log manager is told about it.
+	failingWarnAfter = 5 * time.Minute
 )
 
 // logGatherer is responsible for collecting service logs from a bunch of
@@ -50,7 +55,10 @@ const (
 // logs from. Each logPuller will run in a separate goroutine, and send logs to
 // the logGatherer via a shared channel.
 // The logGatherer will "flush" the client:
-//   - after a timeout (1s) has passed since the first log was written;
+//   - after a timeout (1s, or the target's flush-interval) has passed since
+//     the first log was written;
+//   - when the number of logs written reaches the batch size (100, or the
+//     target's batch-size);
 //   - when it is told to shut down.
 //
 // The client may also flush itself when its internal buffer reaches a certain
@@ -61,6 +69,9 @@ type logGatherer struct {
 	*logGathererOptions
 
 	targetName string
+	// buffering and batching settings from the target, so the log manager can
+	// tell when they change
+	tuning targetTuning
 	// tomb for the main loop
 	tomb tomb.Tomb
 
@@ -77,6 +88,53 @@ type logGatherer struct {
 	pullers *pullerGroup
 	// All pullers send logs on this channel, received by main loop
 	entryCh chan servicelog.Entry
+
+	statusLock sync.Mutex
+	status     TargetStatus
+	// warned is true if onFailing has been called for the current run of
+	// failures.
+	warned    bool
+	onFailing func(targetName string, status TargetStatus)
+}
+
+// TargetStatus holds the delivery status of a log target.
+type TargetStatus struct {
+	// LastSuccess is when logs were last sent successfully.
+	LastSuccess time.Time
+	// LastError is the error from the last attempt, if it failed.
+	LastError string
+	// FailingSince is when the current run of failed attempts started.
+	FailingSince time.Time
+	// ConsecutiveFailures is the number of attempts that failed in a row.
+	ConsecutiveFailures int
+	// Buffered is the number of log entries waiting to be sent.
+	Buffered int
+	// Dropped is the total number of log entries dropped, because the
+	// buffer was full or the target rejected them.
+	Dropped int
+}
+
+// targetTuning holds a log target's buffering and batching settings, as set
+// in the plan (zero if unset).
+type targetTuning struct {
+	bufferSize    int
+	batchSize     int
+	flushInterval time.Duration
+}
+
+func tuningFor(target *plan.LogTarget) targetTuning {
+	return targetTuning{
+		bufferSize:    target.BufferSize,
+		batchSize:     target.BatchSize,
+		flushInterval: target.FlushInterval.Value,
+	}
+}
+
+// clientStats is implemented by log clients that can report how many log
+// entries they're holding and how many they've dropped.
+type clientStats interface {
+	Buffered() int
+	Dropped() int
 }
 
 // logGathererOptions allows overriding the newLogClient method and time values
@@ -86,12 +144,22 @@ type logGathererOptions struct {
 	maxBufferedEntries  int
 	timeoutCurrentFlush time.Duration
 	timeoutFinalFlush   time.Duration
+	// how long a target must fail before onFailing is called
+	failingWarnAfter time.Duration
 	// method to get a new client
 	newClient func(*plan.LogTarget) (logClient, error)
 }
 
 func newLogGatherer(target *plan.LogTarget) (*logGatherer, error) {
-	return newLogGathererInternal(target, &logGathererOptions{})
+	batchSize := target.BatchSize
+	if batchSize == 0 && target.BufferSize > 0 && target.BufferSize < maxBufferedEntries {
+		// Don't wait for more logs than the client can hold.
+		batchSize = target.BufferSize
+	}
+	return newLogGathererInternal(target, &logGathererOptions{
+		bufferTimeout:      target.FlushInterval.Value,
+		maxBufferedEntries: batchSize,
+	})
 }
 
 // newLogGathererInternal contains the actual creation code for a logGatherer.
@@ -108,6 +176,7 @@ func newLogGathererInternal(target *plan.LogTarget, options *logGathererOptions)
 		logGathererOptions: options,
 
 		targetName: target.Name,
+		tuning:     tuningFor(target),
 		client:     client,
 		setLabels:  make(chan svcWithLabels),
 		entryCh:    make(chan servicelog.Entry),
@@ -133,6 +202,9 @@ func fillDefaultOptions(options *logGathererOptions) *logGathererOptions {
 	if options.timeoutFinalFlush == 0 {
 		options.timeoutFinalFlush = timeoutFinalFlush
 	}
+	if options.failingWarnAfter == 0 {
+		options.failingWarnAfter = failingWarnAfter
+	}
 	if options.newClient == nil {
 		options.newClient = newLogClient
 	}
@@ -206,6 +278,66 @@ func evaluateLabels(rawLabels, env map[string]string) map[string]string {
 	return labels
 }
 
+// Status returns the delivery status of the gatherer's target.
+func (g *logGatherer) Status() TargetStatus {
+	g.statusLock.Lock()
+	defer g.statusLock.Unlock()
+	return g.status
+}
+
+// NotifyFailing sets f to be called (in the gatherer's goroutine) when the
+// target has been failing to deliver logs for longer than the warning
+// threshold. It's called once for each run of failures.
+func (g *logGatherer) NotifyFailing(f func(targetName string, status TargetStatus)) {
+	g.statusLock.Lock()
+	defer g.statusLock.Unlock()
+	g.onFailing = f
+}
+
+// recordFlush updates the status with the result of a flush.
+func (g *logGatherer) recordFlush(err error) {
+	g.statusLock.Lock()
+	now := time.Now()
+	if err == nil {
+		g.status.LastSuccess = now
+		g.status.LastError = ""
+		g.status.FailingSince = time.Time{}
+		g.status.ConsecutiveFailures = 0
+		g.warned = false
+		g.statusLock.Unlock()
+		return
+	}
+	g.status.LastError = err.Error()
+	if g.status.ConsecutiveFailures == 0 {
+		g.status.FailingSince = now
+	}
+	g.status.ConsecutiveFailures++
+	var onFailing func(string, TargetStatus)
+	if !g.warned && now.Sub(g.status.FailingSince) >= g.failingWarnAfter {
+		g.warned = true
+		onFailing = g.onFailing
+	}
+	status := g.status
+	g.statusLock.Unlock()
+
+	if onFailing != nil {
+		onFailing(g.targetName, status)
+	}
+}
+
+// recordStats updates the buffered and dropped counts from the client, if
+// it reports them.
+func (g *logGatherer) recordStats() {
+	stats, ok := g.client.(clientStats)
+	if !ok {
+		return
+	}
+	g.statusLock.Lock()
+	defer g.statusLock.Unlock()
+	g.status.Buffered = stats.Buffered()
+	g.status.Dropped = stats.Dropped()
+}
+
 // The main control loop for the logGatherer. loop receives logs from the
 // pullers on entryCh, and writes them to the client. It also flushes the
 // client periodically, and exits when the gatherer's tomb is killed.
@@ -222,6 +354,12 @@ func (g *logGatherer) loop() error {
 		if err != nil {
 			logger.Noticef("Cannot flush logs to target %q: %v", g.targetName, err)
 		}
+		// Only record the result if there was something to send, either
+		// new logs or ones kept from a failed attempt.
+		if numWritten > 0 || err != nil || g.Status().ConsecutiveFailures > 0 {
+			g.recordFlush(err)
+		}
+		g.recordStats()
 		numWritten = 0
 	}
 
@@ -247,6 +385,7 @@ mainLoop:
 				continue
 			}
 			numWritten++
+			g.recordStats()
 			// Check if buffer is full
 			if numWritten >= g.maxBufferedEntries {
 				flushClient(g.clientCtx)
@@ -367,7 +506,9 @@ type logClient interface {
 func newLogClient(target *plan.LogTarget) (logClient, error) {
 	switch target.Type {
 	case plan.LokiTarget:
-		return loki.NewClient(target), nil
+		return loki.NewClientWithOptions(target, &loki.ClientOptions{
+			MaxRequestEntries: target.BufferSize,
+		}), nil
 	//case plan.SyslogTarget: TODO
 	default:
 		return nil, fmt.Errorf("unknown type %q for log target %q", target.Type, target.Name)
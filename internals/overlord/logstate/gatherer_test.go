@@ -330,6 +330,78 @@ func (s *gathererSuite) TestConcurrency(c *C) {
 	g.Stop()
 }
 
+func (s *gathererSuite) TestGathererStatus(c *C) {
+	client := &failingClient{}
+	client.setErr(fmt.Errorf("server unavailable"))
+	g, err := newLogGathererInternal(&plan.LogTarget{Name: "tgt1"}, &logGathererOptions{
+		bufferTimeout:    1 * time.Millisecond,
+		failingWarnAfter: 1 * time.Millisecond,
+		newClient: func(target *plan.LogTarget) (logClient, error) {
+			return client, nil
+		},
+	})
+	c.Assert(err, IsNil)
+	defer g.Stop()
+
+	failing := make(chan TargetStatus, 10)
+	g.NotifyFailing(func(targetName string, status TargetStatus) {
+		c.Check(targetName, Equals, "tgt1")
+		failing <- status
+	})
+
+	testSvc := newTestService("svc1")
+	g.ServiceStarted(testSvc.config, testSvc.ringBuffer)
+
+	// First failure is recorded, but is within the warning threshold.
+	testSvc.writeLog("log line #1")
+	waitStatus(c, g, func(status TargetStatus) bool {
+		return status.ConsecutiveFailures == 1
+	})
+	status := g.Status()
+	c.Check(status.LastError, Equals, "server unavailable")
+	c.Check(status.FailingSince.IsZero(), Equals, false)
+	c.Check(status.LastSuccess.IsZero(), Equals, true)
+	c.Check(failing, HasLen, 0)
+
+	// Failing past the threshold notifies.
+	time.Sleep(2 * time.Millisecond)
+	testSvc.writeLog("log line #2")
+	select {
+	case <-time.After(1 * time.Second):
+		c.Fatalf("timeout waiting for failing notification")
+	case status := <-failing:
+		c.Check(status.LastError, Equals, "server unavailable")
+		c.Check(status.ConsecutiveFailures, Equals, 2)
+	}
+
+	// Further failures don't notify again.
+	testSvc.writeLog("log line #3")
+	waitStatus(c, g, func(status TargetStatus) bool {
+		return status.ConsecutiveFailures == 3
+	})
+	c.Check(failing, HasLen, 0)
+
+	client.setErr(nil)
+	testSvc.writeLog("log line #4")
+	waitStatus(c, g, func(status TargetStatus) bool {
+		return !status.LastSuccess.IsZero()
+	})
+	status = g.Status()
+	c.Check(status.LastError, Equals, "")
+	c.Check(status.ConsecutiveFailures, Equals, 0)
+	c.Check(status.FailingSince.IsZero(), Equals, true)
+}
+
+func waitStatus(c *C, g *logGatherer, f func(TargetStatus) bool) {
+	for start := time.Now(); time.Since(start) < time.Second; {
+		if f(g.Status()) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Fatalf("timeout waiting for status, last status: %#v", g.Status())
+}
+
 func checkLogs(c *C, received []servicelog.Entry, expected []string) {
 	c.Assert(received, HasLen, len(expected))
 	for i, entry := range received {
@@ -395,3 +467,29 @@ func (s *testService) writeLog(log string) {
 func (s *testService) stop() error {
 	return s.ringBuffer.Close()
 }
+
+// test implementation of a client whose flushes fail with a configurable error
+type failingClient struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (c *failingClient) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *failingClient) SetLabels(serviceName string, labels map[string]string) {
+	// no-op
+}
+
+func (c *failingClient) Add(entry servicelog.Entry) error {
+	return nil
+}
+
+func (c *failingClient) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -49,6 +50,10 @@ type Client struct {
 
 	// store the custom labels for each service
 	labels map[string]json.RawMessage
+
+	// number of entries dropped because the buffer was full or the server
+	// rejected them
+	dropped int
 }
 
 func NewClient(target *plan.LogTarget) *Client {
@@ -115,6 +120,7 @@ func (c *Client) Add(entry servicelog.Entry) error {
 		// Zero the removed element to allow garbage collection
 		c.entries[0] = lokiEntryWithService{}
 		c.entries = c.entries[1:]
+		c.dropped++
 	}
 
 	if len(c.entries) >= cap(c.entries) {
@@ -137,6 +143,17 @@ func (c *Client) Add(entry servicelog.Entry) error {
 	return nil
 }
 
+// Buffered returns the number of log entries waiting to be sent.
+func (c *Client) Buffered() int {
+	return len(c.entries)
+}
+
+// Dropped returns the total number of log entries dropped, because the
+// buffer was full or the server rejected them.
+func (c *Client) Dropped() int {
+	return c.dropped
+}
+
 func encodeEntry(entry servicelog.Entry) lokiEntry {
 	return lokiEntry{
 		strconv.FormatInt(entry.Time.UnixNano(), 10),
@@ -161,6 +178,13 @@ func (c *Client) Flush(ctx context.Context) error {
 	}
 	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
 	httpReq.Header.Set("User-Agent", fmt.Sprintf("pebble/%s", cmd.Version))
+	if c.target.TenantID != "" {
+		httpReq.Header.Set("X-Scope-OrgID", c.target.TenantID)
+	}
+	err = c.setAuth(httpReq)
+	if err != nil {
+		return err
+	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -170,6 +194,39 @@ func (c *Client) Flush(ctx context.Context) error {
 	return c.handleServerResponse(resp)
 }
 
+// setAuth adds the target's credentials (if any) to the request. They're
+// read from their files for each request, so that they can be rotated
+// without changing the plan.
+func (c *Client) setAuth(req *http.Request) error {
+	auth := c.target.Auth
+	switch {
+	case auth == nil:
+	case auth.Basic != nil:
+		password, err := readCredential(auth.Basic.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("cannot read password file: %w", err)
+		}
+		req.SetBasicAuth(auth.Basic.User, password)
+	case auth.Bearer != nil:
+		token, err := readCredential(auth.Bearer.TokenFile)
+		if err != nil {
+			return fmt.Errorf("cannot read token file: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// readCredential returns the contents of the file, without surrounding
+// whitespace (such as a trailing newline).
+func readCredential(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 // resetBuffer drops all buffered logs (in the case of a successful send, or an
 // unrecoverable error).
 func (c *Client) resetBuffer() {
@@ -248,6 +305,7 @@ func (c *Client) handleServerResponse(resp *http.Response) error {
 		// Other 4xx codes indicate a client problem, so drop the logs (retrying won't help)
 		logger.Noticef("Target %q: request failed with status %d, dropping %d logs",
 			c.target.Name, code, len(c.entries))
+		c.dropped += len(c.entries)
 		c.resetBuffer()
 		return errFromResponse(resp)
 
@@ -22,6 +22,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -131,6 +133,76 @@ func (*suite) TestRequest(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (*suite) TestTenantAndBasicAuth(c *C) {
+	passwordFile := filepath.Join(c.MkDir(), "password")
+	err := os.WriteFile(passwordFile, []byte("s3cret\n"), 0o600)
+	c.Assert(err, IsNil)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		c.Check(r.Header.Get("X-Scope-OrgID"), Equals, "tenant1")
+		user, password, ok := r.BasicAuth()
+		c.Check(ok, Equals, true)
+		c.Check(user, Equals, "user1")
+		c.Check(password, Equals, "s3cret")
+	}))
+	defer server.Close()
+
+	client := loki.NewClient(&plan.LogTarget{
+		Location: server.URL,
+		TenantID: "tenant1",
+		Auth: &plan.LogTargetAuth{
+			Basic: &plan.LogTargetBasicAuth{User: "user1", PasswordFile: passwordFile},
+		},
+	})
+	err = client.Add(servicelog.Entry{Time: time.Now(), Service: "svc1", Message: "log line\n"})
+	c.Assert(err, IsNil)
+	err = client.Flush(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(requests, Equals, 1)
+}
+
+func (*suite) TestBearerAuth(c *C) {
+	tokenFile := filepath.Join(c.MkDir(), "token")
+	err := os.WriteFile(tokenFile, []byte("token1\n"), 0o600)
+	c.Assert(err, IsNil)
+
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		c.Check(r.Header.Get("X-Scope-OrgID"), Equals, "")
+	}))
+	defer server.Close()
+
+	client := loki.NewClient(&plan.LogTarget{
+		Location: server.URL,
+		Auth: &plan.LogTargetAuth{
+			Bearer: &plan.LogTargetBearerAuth{TokenFile: tokenFile},
+		},
+	})
+	err = client.Add(servicelog.Entry{Time: time.Now(), Service: "svc1", Message: "log line\n"})
+	c.Assert(err, IsNil)
+	err = client.Flush(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(authorization, Equals, "Bearer token1")
+
+	// The token is read again for each request, and a missing file keeps
+	// the logs for the next attempt.
+	err = os.Remove(tokenFile)
+	c.Assert(err, IsNil)
+	err = client.Add(servicelog.Entry{Time: time.Now(), Service: "svc1", Message: "log line\n"})
+	c.Assert(err, IsNil)
+	err = client.Flush(context.Background())
+	c.Assert(err, ErrorMatches, "cannot read token file: .* no such file or directory")
+
+	err = os.WriteFile(tokenFile, []byte("token2"), 0o600)
+	c.Assert(err, IsNil)
+	err = client.Flush(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(authorization, Equals, "Bearer token2")
+}
+
 func (*suite) TestFlushCancelContext(c *C) {
 	serverCtx, killServer := context.WithCancel(context.Background())
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -247,6 +319,37 @@ func (*suite) TestBufferFull(c *C) {
 	checkBuffer([]any{nil, nil, nil, "4", "5", "6"})
 	addEntry("7")
 	checkBuffer([]any{"5", "6", "7", nil, nil, nil})
+	c.Check(client.Buffered(), Equals, 3)
+	c.Check(client.Dropped(), Equals, 4)
+}
+
+func (*suite) TestDroppedOnClientError(c *C) {
+	code := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+
+	client := loki.NewClient(&plan.LogTarget{Name: "tgt1", Location: server.URL})
+	for i := 0; i < 2; i++ {
+		err := client.Add(servicelog.Entry{Time: time.Now(), Service: "svc1", Message: "log line\n"})
+		c.Assert(err, IsNil)
+	}
+	c.Check(client.Buffered(), Equals, 2)
+
+	// 5xx errors keep the logs for the next attempt.
+	code = http.StatusServiceUnavailable
+	err := client.Flush(context.Background())
+	c.Assert(err, NotNil)
+	c.Check(client.Buffered(), Equals, 2)
+	c.Check(client.Dropped(), Equals, 0)
+
+	// Other 4xx errors drop them.
+	code = http.StatusBadRequest
+	err = client.Flush(context.Background())
+	c.Assert(err, NotNil)
+	c.Check(client.Buffered(), Equals, 0)
+	c.Check(client.Dropped(), Equals, 2)
 }
 
 func (*suite) TestLabels(c *C) {
@@ -15,14 +15,19 @@
 package logstate
 
 import (
+	"fmt"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
 	"github.com/canonical/pebble/internals/plan"
 	"github.com/canonical/pebble/internals/servicelog"
 )
 
 type LogManager struct {
+	state     *state.State
 	mu        sync.Mutex
 	gatherers map[string]*logGatherer
 	buffers   map[string]*servicelog.RingBuffer
@@ -31,8 +36,9 @@ type LogManager struct {
 	newGatherer func(*plan.LogTarget) (*logGatherer, error)
 }
 
-func NewLogManager() *LogManager {
+func NewLogManager(st *state.State) *LogManager {
 	return &LogManager{
+		state:       st,
 		gatherers:   map[string]*logGatherer{},
 		buffers:     map[string]*servicelog.RingBuffer{},
 		newGatherer: newLogGatherer,
@@ -51,6 +57,11 @@ func (m *LogManager) PlanChanged(pl *plan.Plan) {
 
 	for _, target := range pl.LogTargets {
 		gatherer := m.gatherers[target.Name]
+		if gatherer != nil && gatherer.tuning != tuningFor(target) {
+			// Buffering settings have changed, so replace the gatherer (the
+			// old one is stopped below, flushing its logs).
+			gatherer = nil
+		}
 		if gatherer == nil {
 			// Create new gatherer
 			var err error
@@ -60,6 +71,7 @@ func (m *LogManager) PlanChanged(pl *plan.Plan) {
 					target.Name, err)
 				continue
 			}
+			gatherer.NotifyFailing(m.targetFailing)
 			newGatherers[target.Name] = gatherer
 		} else {
 			// Copy over existing gatherer
@@ -71,7 +83,7 @@ func (m *LogManager) PlanChanged(pl *plan.Plan) {
 		gatherer.PlanChanged(pl, m.buffers)
 	}
 
-	// Old gatherers for now-removed targets need to be shut down.
+	// Old gatherers for now-removed (or replaced) targets need to be shut down.
 	for _, gatherer := range m.gatherers {
 		go gatherer.Stop()
 	}
@@ -88,6 +100,60 @@ func (m *LogManager) PlanChanged(pl *plan.Plan) {
 	m.plan = pl
 }
 
+// TargetStatus returns the delivery status of each log target in the plan,
+// keyed by target name.
+func (m *LogManager) TargetStatus() map[string]TargetStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make(map[string]TargetStatus, len(m.gatherers))
+	for name, gatherer := range m.gatherers {
+		statuses[name] = gatherer.Status()
+	}
+	return statuses
+}
+
+const (
+	// failingWarningRepeatAfter is how long after a failing target's warning
+	// is acknowledged it's shown again, if the target is still failing.
+	failingWarningRepeatAfter = 24 * time.Hour
+	// failingWarningExpireAfter is how long after the target last started
+	// failing its warning is dropped.
+	failingWarningExpireAfter = 7 * 24 * time.Hour
+)
+
+// targetFailing records a warning notice and a warning for a log target that
+// has been failing to deliver logs for a while. The keys are the same for
+// each run of failures, so repeats are counted as occurrences of the same
+// notice and update the same warning.
+func (m *LogManager) targetFailing(targetName string, status TargetStatus) {
+	logger.Noticef("Log target %q has been failing since %s: %s",
+		targetName, status.FailingSince.Format(time.RFC3339), status.LastError)
+
+	m.state.Lock()
+	defer m.state.Unlock()
+	key := fmt.Sprintf("Cannot forward logs to log target %q", targetName)
+	data := map[string]string{
+		"target":               targetName,
+		"error":                status.LastError,
+		"failing-since":        status.FailingSince.Format(time.RFC3339),
+		"consecutive-failures": strconv.Itoa(status.ConsecutiveFailures),
+	}
+	_, err := m.state.AddNotice(nil, state.WarningNotice, key, &state.AddNoticeOptions{
+		Data: data,
+	})
+	if err != nil {
+		logger.Noticef("Cannot record warning for log target %q: %v", targetName, err)
+	}
+	// Also show it in "pebble warnings". The message includes the latest
+	// error, so use a stable key to avoid a new warning for each error.
+	m.state.Warn("log-target-failing/"+targetName, key+": "+status.LastError, &state.WarnOptions{
+		RepeatAfter: failingWarningRepeatAfter,
+		ExpireAfter: failingWarningExpireAfter,
+		Data:        data,
+	})
+}
+
 // ServiceStarted notifies the log manager that the named service has started,
 // and provides a reference to the service's log buffer.
 func (m *LogManager) ServiceStarted(service *plan.Service, buffer *servicelog.RingBuffer) {
@@ -16,6 +16,7 @@ package logstate
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
@@ -24,6 +25,7 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
 	"github.com/canonical/pebble/internals/plan"
 	"github.com/canonical/pebble/internals/servicelog"
 )
@@ -44,7 +46,7 @@ func (*managerSuite) TestPlanChange(c *C) {
 			return &testClient{}, nil
 		},
 	}
-	m := NewLogManager()
+	m := NewLogManager(state.New(nil))
 	m.newGatherer = func(t *plan.LogTarget) (*logGatherer, error) {
 		return newLogGathererInternal(t, &gathererOptions)
 	}
@@ -103,6 +105,49 @@ func (*managerSuite) TestPlanChange(c *C) {
 	checkBuffers(c, m.buffers, []string{"svc1", "svc2", "svc4"})
 }
 
+func (*managerSuite) TestPlanChangeTuning(c *C) {
+	m := NewLogManager(state.New(nil))
+	defer m.Stop()
+
+	target := &plan.LogTarget{
+		Name:          "tgt1",
+		Type:          plan.LokiTarget,
+		Location:      "http://localhost:3100/loki/api/v1/push",
+		Services:      []string{"all"},
+		BatchSize:     10,
+		FlushInterval: plan.OptionalDuration{Value: 2 * time.Second, IsSet: true},
+	}
+	m.PlanChanged(&plan.Plan{
+		LogTargets: map[string]*plan.LogTarget{"tgt1": target},
+	})
+	gatherer := m.gatherers["tgt1"]
+	c.Assert(gatherer, NotNil)
+	c.Check(gatherer.maxBufferedEntries, Equals, 10)
+	c.Check(gatherer.bufferTimeout, Equals, 2*time.Second)
+
+	// Unchanged settings keep the same gatherer.
+	m.PlanChanged(&plan.Plan{
+		LogTargets: map[string]*plan.LogTarget{"tgt1": target.Copy()},
+	})
+	c.Check(m.gatherers["tgt1"], Equals, gatherer)
+
+	// Changed settings replace it. The batch size defaults to no more than
+	// the buffer size.
+	target = &plan.LogTarget{
+		Name:       "tgt1",
+		Type:       plan.LokiTarget,
+		Location:   "http://localhost:3100/loki/api/v1/push",
+		Services:   []string{"all"},
+		BufferSize: 5,
+	}
+	m.PlanChanged(&plan.Plan{
+		LogTargets: map[string]*plan.LogTarget{"tgt1": target},
+	})
+	c.Assert(m.gatherers["tgt1"], Not(Equals), gatherer)
+	c.Check(m.gatherers["tgt1"].maxBufferedEntries, Equals, 5)
+	c.Check(m.gatherers["tgt1"].bufferTimeout, Equals, bufferTimeout)
+}
+
 func checkGatherers(c *C, gatherers map[string]*logGatherer, expected map[string][]string) {
 	c.Assert(gatherers, HasLen, len(expected))
 	for tgtName, svcs := range expected {
@@ -137,7 +182,7 @@ func (s *managerSuite) TestTimelyShutdown(c *C) {
 		},
 	}
 
-	m := NewLogManager()
+	m := NewLogManager(state.New(nil))
 	m.newGatherer = func(t *plan.LogTarget) (*logGatherer, error) {
 		return newLogGathererInternal(t, &gathererOptions)
 	}
@@ -219,7 +264,7 @@ func (s *managerSuite) TestLabels(c *C) {
 		notifySetLabels: make(chan struct{}, 2),
 	}
 
-	m := NewLogManager()
+	m := NewLogManager(state.New(nil))
 	m.newGatherer = func(t *plan.LogTarget) (*logGatherer, error) {
 		return newLogGathererInternal(t, &logGathererOptions{
 			newClient: func(_ *plan.LogTarget) (logClient, error) { return fakeClient, nil },
@@ -332,3 +377,55 @@ func (l *labelStore) waitLabels(c *C) {
 		c.Fatal("timed out waiting for labels to be set")
 	}
 }
+
+func (s *managerSuite) TestTargetFailingWarning(c *C) {
+	st := state.New(nil)
+	m := NewLogManager(st)
+
+	failingSince := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.targetFailing("tgt1", TargetStatus{
+		LastError:           "server unavailable",
+		FailingSince:        failingSince,
+		ConsecutiveFailures: 3,
+	})
+
+	st.Lock()
+	defer st.Unlock()
+	notices := st.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.WarningNotice}})
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["key"], Equals, `Cannot forward logs to log target "tgt1"`)
+	c.Check(n["last-data"], DeepEquals, map[string]any{
+		"target":               "tgt1",
+		"error":                "server unavailable",
+		"failing-since":        "2024-05-01T12:00:00Z",
+		"consecutive-failures": "3",
+	})
+
+	warnings := st.AllWarnings()
+	c.Assert(warnings, HasLen, 1)
+	w := warningToMap(c, warnings[0])
+	c.Check(w["key"], Equals, "log-target-failing/tgt1")
+	c.Check(w["message"], Equals, `Cannot forward logs to log target "tgt1": server unavailable`)
+	c.Check(w["data"], DeepEquals, n["last-data"])
+	c.Check(w["repeat-after"], Equals, "24h0m0s")
+	c.Check(w["expire-after"], Equals, "168h0m0s")
+}
+
+func warningToMap(c *C, warning *state.Warning) map[string]any {
+	buf, err := json.Marshal(warning)
+	c.Assert(err, IsNil)
+	var w map[string]any
+	err = json.Unmarshal(buf, &w)
+	c.Assert(err, IsNil)
+	return w
+}
+
+func noticeToMap(c *C, notice *state.Notice) map[string]any {
+	buf, err := json.Marshal(notice)
+	c.Assert(err, IsNil)
+	var n map[string]any
+	err = json.Unmarshal(buf, &n)
+	c.Assert(err, IsNil)
+	return n
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mountstate
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// MountManager mounts the filesystems defined in the "mounts" section of
+// the plan, keeping them in sync with the plan as it changes, and unmounts
+// them again when the manager is stopped.
+type MountManager struct {
+	mu        sync.Mutex
+	mounts    map[string]*plan.Mount // mounts required by the plan
+	mounted   map[string]*plan.Mount // mounts made by this manager
+	startedUp bool
+}
+
+// NewManager creates a new mount manager.
+func NewManager() *MountManager {
+	return &MountManager{
+		mounts:  make(map[string]*plan.Mount),
+		mounted: make(map[string]*plan.Mount),
+	}
+}
+
+// PlanChanged handles updates to the plan (server configuration). Once the
+// manager has started up, mounts that were removed or changed are unmounted,
+// and new or changed mounts are mounted.
+func (m *MountManager) PlanChanged(p *plan.Plan) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mounts := make(map[string]*plan.Mount, len(p.Mounts))
+	for name, mount := range p.Mounts {
+		mounts[name] = mount
+	}
+	m.mounts = mounts
+
+	if m.startedUp {
+		m.apply()
+	}
+}
+
+// StartUp implements StateStarterUp.StartUp, mounting the filesystems in the
+// current plan. Failure to mount a filesystem is logged, but doesn't prevent
+// the daemon from starting.
+func (m *MountManager) StartUp() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.startedUp = true
+	m.apply()
+	return nil
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *MountManager) Ensure() error {
+	return nil
+}
+
+// Stop implements StateStopper.Stop, unmounting everything this manager
+// mounted, children before parents.
+func (m *MountManager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, mount := range sortedByTarget(m.mounted, true) {
+		m.unmount(mount)
+	}
+}
+
+// apply brings the mounted filesystems in line with the plan. The caller must
+// hold m.mu.
+func (m *MountManager) apply() {
+	// Unmount filesystems that are no longer in the plan, or have changed.
+	var stale []*plan.Mount
+	for name, mounted := range m.mounted {
+		mount, ok := m.mounts[name]
+		if !ok || !mount.Equal(mounted) {
+			stale = append(stale, mounted)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return targetLess(stale[j], stale[i])
+	})
+	for _, mount := range stale {
+		m.unmount(mount)
+	}
+
+	// Mount new or changed filesystems, parents before children.
+	for _, mount := range sortedByTarget(m.mounts, false) {
+		if _, ok := m.mounted[mount.Name]; ok {
+			continue
+		}
+		err := m.mount(mount)
+		if err != nil {
+			logger.Noticef("Cannot mount %q on %q: %v", mount.Name, mount.Target, err)
+		}
+	}
+}
+
+func (m *MountManager) mount(mount *plan.Mount) error {
+	target := filepath.Clean(mount.Target)
+	isMounted, err := isMountPoint(target)
+	if err != nil {
+		return err
+	}
+	if isMounted {
+		// Something else mounted it (for example, before the daemon was
+		// started), so leave it alone.
+		logger.Noticef("Mount %q target %q is already a mount point, skipping", mount.Name, target)
+		return nil
+	}
+	err = os.MkdirAll(target, 0755)
+	if err != nil {
+		return err
+	}
+	flags, data := parseOptions(mount.Options)
+	err = sysMount(mount.Source, target, mount.Type, flags, data)
+	if err != nil {
+		return err
+	}
+	logger.Noticef("Mounted %q on %q", mount.Name, target)
+	m.mounted[mount.Name] = mount.Copy()
+	return nil
+}
+
+func (m *MountManager) unmount(mount *plan.Mount) {
+	target := filepath.Clean(mount.Target)
+	err := sysUnmount(target, 0)
+	if err != nil {
+		// Keep tracking the mount so that it's retried next time.
+		logger.Noticef("Cannot unmount %q from %q: %v", mount.Name, target, err)
+		return
+	}
+	logger.Noticef("Unmounted %q from %q", mount.Name, target)
+	delete(m.mounted, mount.Name)
+}
+
+// sortedByTarget returns the mounts sorted by target path (and then name),
+// which puts a parent directory's mount before those of its children.
+func sortedByTarget(mounts map[string]*plan.Mount, reverse bool) []*plan.Mount {
+	sorted := make([]*plan.Mount, 0, len(mounts))
+	for _, mount := range mounts {
+		sorted = append(sorted, mount)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if reverse {
+			return targetLess(sorted[j], sorted[i])
+		}
+		return targetLess(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+func targetLess(a, b *plan.Mount) bool {
+	targetA, targetB := filepath.Clean(a.Target), filepath.Clean(b.Target)
+	if targetA != targetB {
+		return targetA < targetB
+	}
+	return a.Name < b.Name
+}
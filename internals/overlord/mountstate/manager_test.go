@@ -0,0 +1,207 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mountstate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/osutil"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type managerSuite struct {
+	root      string
+	calls     []string
+	mountErr  error
+	oldMount  func(string, string, string, uintptr, string) error
+	oldUmount func(string, int) error
+	oldInfo   string
+}
+
+var _ = Suite(&managerSuite{})
+
+func (s *managerSuite) SetUpTest(c *C) {
+	s.root = c.MkDir()
+	s.calls = nil
+	s.mountErr = nil
+
+	s.oldMount = sysMount
+	s.oldUmount = sysUnmount
+	s.oldInfo = mountInfoPath
+
+	sysMount = func(source, target, fstype string, flags uintptr, data string) error {
+		if s.mountErr != nil {
+			return s.mountErr
+		}
+		s.calls = append(s.calls, fmt.Sprintf("mount %s %s %s %#x %q", source, target, fstype, flags, data))
+		return nil
+	}
+	sysUnmount = func(target string, flags int) error {
+		s.calls = append(s.calls, "unmount "+target)
+		return nil
+	}
+	mountInfoPath = filepath.Join(s.root, "mountinfo")
+	s.writeMountInfo(c, "/")
+}
+
+func (s *managerSuite) TearDownTest(c *C) {
+	sysMount = s.oldMount
+	sysUnmount = s.oldUmount
+	mountInfoPath = s.oldInfo
+}
+
+func (s *managerSuite) writeMountInfo(c *C, mountPoints ...string) {
+	var data []byte
+	for i, mountPoint := range mountPoints {
+		data = append(data, fmt.Sprintf("%d 1 8:1 / %s rw,relatime shared:1 - ext4 /dev/sda1 rw\n", 20+i, mountPoint)...)
+	}
+	err := os.WriteFile(mountInfoPath, data, 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) path(p string) string {
+	return filepath.Join(s.root, p)
+}
+
+func (s *managerSuite) TestStartUpMountsInOrder(c *C) {
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{Mounts: map[string]*plan.Mount{
+		"child": {
+			Name:    "child",
+			Source:  "tmpfs",
+			Target:  s.path("data/cache"),
+			Type:    "tmpfs",
+			Options: []string{"nosuid", "size=10M"},
+		},
+		"parent": {
+			Name:    "parent",
+			Source:  "/dev/sdb1",
+			Target:  s.path("data"),
+			Type:    "ext4",
+			Options: []string{"ro", "noatime"},
+		},
+	}})
+	c.Assert(s.calls, HasLen, 0)
+
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	c.Check(s.calls, DeepEquals, []string{
+		fmt.Sprintf("mount /dev/sdb1 %s ext4 %#x %q", s.path("data"), unix.MS_RDONLY|unix.MS_NOATIME, ""),
+		fmt.Sprintf("mount tmpfs %s tmpfs %#x %q", s.path("data/cache"), unix.MS_NOSUID, "size=10M"),
+	})
+	c.Check(osutil.IsDir(s.path("data/cache")), Equals, true)
+
+	s.calls = nil
+	m.Stop()
+	c.Check(s.calls, DeepEquals, []string{
+		"unmount " + s.path("data/cache"),
+		"unmount " + s.path("data"),
+	})
+}
+
+func (s *managerSuite) TestPlanChanged(c *C) {
+	m := NewManager()
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+
+	m.PlanChanged(&plan.Plan{Mounts: map[string]*plan.Mount{
+		"a": {Name: "a", Source: "/src/a", Target: s.path("a"), Options: []string{"bind"}},
+		"b": {Name: "b", Source: "/src/b", Target: s.path("b"), Options: []string{"rbind"}},
+	}})
+	c.Check(s.calls, DeepEquals, []string{
+		fmt.Sprintf("mount /src/a %s  %#x %q", s.path("a"), unix.MS_BIND, ""),
+		fmt.Sprintf("mount /src/b %s  %#x %q", s.path("b"), unix.MS_BIND|unix.MS_REC, ""),
+	})
+
+	// Unchanged mounts are left alone, removed ones are unmounted, and
+	// changed ones are remounted.
+	s.calls = nil
+	m.PlanChanged(&plan.Plan{Mounts: map[string]*plan.Mount{
+		"b": {Name: "b", Source: "/src/b2", Target: s.path("b"), Options: []string{"rbind"}},
+	}})
+	c.Check(s.calls, DeepEquals, []string{
+		"unmount " + s.path("b"),
+		"unmount " + s.path("a"),
+		fmt.Sprintf("mount /src/b2 %s  %#x %q", s.path("b"), unix.MS_BIND|unix.MS_REC, ""),
+	})
+
+	s.calls = nil
+	m.PlanChanged(&plan.Plan{Mounts: map[string]*plan.Mount{
+		"b": {Name: "b", Source: "/src/b2", Target: s.path("b"), Options: []string{"rbind"}},
+	}})
+	c.Check(s.calls, HasLen, 0)
+}
+
+func (s *managerSuite) TestAlreadyMounted(c *C) {
+	s.writeMountInfo(c, "/", s.path("a"))
+
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{Mounts: map[string]*plan.Mount{
+		"a": {Name: "a", Source: "tmpfs", Target: s.path("a"), Type: "tmpfs"},
+	}})
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	c.Check(s.calls, HasLen, 0)
+
+	// Mounts not made by the manager aren't unmounted either.
+	m.Stop()
+	c.Check(s.calls, HasLen, 0)
+}
+
+func (s *managerSuite) TestMountError(c *C) {
+	s.mountErr = errors.New("no such device")
+
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{Mounts: map[string]*plan.Mount{
+		"a": {Name: "a", Source: "/dev/nope", Target: s.path("a"), Type: "ext4"},
+	}})
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+
+	// The failed mount is retried on the next plan change.
+	s.mountErr = nil
+	m.PlanChanged(&plan.Plan{Mounts: map[string]*plan.Mount{
+		"a": {Name: "a", Source: "/dev/nope", Target: s.path("a"), Type: "ext4"},
+	}})
+	c.Check(s.calls, DeepEquals, []string{
+		fmt.Sprintf("mount /dev/nope %s ext4 0x0 %q", s.path("a"), ""),
+	})
+}
+
+func (s *managerSuite) TestParseOptions(c *C) {
+	flags, data := parseOptions(nil)
+	c.Check(flags, Equals, uintptr(0))
+	c.Check(data, Equals, "")
+
+	flags, data = parseOptions([]string{"defaults", "ro", "nodev", "rw", "mode=0755", "uid=1000"})
+	c.Check(flags, Equals, uintptr(unix.MS_NODEV))
+	c.Check(data, Equals, "mode=0755,uid=1000")
+}
+
+func (s *managerSuite) TestUnescapeMountInfo(c *C) {
+	c.Check(unescapeMountInfo(`/mnt/plain`), Equals, `/mnt/plain`)
+	c.Check(unescapeMountInfo(`/mnt/with\040space`), Equals, `/mnt/with space`)
+	c.Check(unescapeMountInfo(`/mnt/back\134slash`), Equals, `/mnt/back\slash`)
+	c.Check(unescapeMountInfo(`/mnt/short\04`), Equals, `/mnt/short\04`)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mountstate
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	sysMount   = unix.Mount
+	sysUnmount = unix.Unmount
+
+	mountInfoPath = "/proc/self/mountinfo"
+)
+
+// mountFlags maps the generic mount options to their mount(2) flags. The
+// value is the flag to set, and whether the option clears it instead.
+var mountFlags = map[string]struct {
+	flag  uintptr
+	clear bool
+}{
+	"defaults":    {0, false},
+	"ro":          {unix.MS_RDONLY, false},
+	"rw":          {unix.MS_RDONLY, true},
+	"nosuid":      {unix.MS_NOSUID, false},
+	"suid":        {unix.MS_NOSUID, true},
+	"nodev":       {unix.MS_NODEV, false},
+	"dev":         {unix.MS_NODEV, true},
+	"noexec":      {unix.MS_NOEXEC, false},
+	"exec":        {unix.MS_NOEXEC, true},
+	"sync":        {unix.MS_SYNCHRONOUS, false},
+	"async":       {unix.MS_SYNCHRONOUS, true},
+	"dirsync":     {unix.MS_DIRSYNC, false},
+	"noatime":     {unix.MS_NOATIME, false},
+	"atime":       {unix.MS_NOATIME, true},
+	"nodiratime":  {unix.MS_NODIRATIME, false},
+	"diratime":    {unix.MS_NODIRATIME, true},
+	"relatime":    {unix.MS_RELATIME, false},
+	"norelatime":  {unix.MS_RELATIME, true},
+	"strictatime": {unix.MS_STRICTATIME, false},
+	"bind":        {unix.MS_BIND, false},
+	"rbind":       {unix.MS_BIND | unix.MS_REC, false},
+}
+
+// parseOptions converts the mount options into mount(2) flags, and returns
+// the remaining (filesystem-specific) options as the comma-separated data
+// string.
+func parseOptions(options []string) (flags uintptr, data string) {
+	var extra []string
+	for _, option := range options {
+		f, ok := mountFlags[option]
+		if !ok {
+			extra = append(extra, option)
+			continue
+		}
+		if f.clear {
+			flags &^= f.flag
+		} else {
+			flags |= f.flag
+		}
+	}
+	return flags, strings.Join(extra, ",")
+}
+
+// isMountPoint reports whether path is currently a mount point, according to
+// the mount table of the current process.
+func isMountPoint(path string) (bool, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// See proc(5): the fifth field is the mount point, relative to the
+		// process's root directory, with special characters octal-escaped.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		if unescapeMountInfo(fields[4]) == path {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// unescapeMountInfo undoes the octal escaping (for example "\040" for space)
+// used in /proc/self/mountinfo fields.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			n, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+			if err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package netstate
+
+// FakeNetlink changes how network interfaces are configured.
+func FakeNetlink(n Netlinker) (restore func()) {
+	old := netlink
+	netlink = n
+	return func() {
+		netlink = old
+	}
+}
+
+// FakeResolvConfPath changes the file nameservers are written to.
+func FakeResolvConfPath(path string) (restore func()) {
+	old := resolvConfPath
+	resolvConfPath = path
+	return func() {
+		resolvConfPath = old
+	}
+}
+
+// FakeSupplicant changes how wpa_supplicant is told to reload its
+// configuration.
+func FakeSupplicant(s Supplicant) (restore func()) {
+	old := supplicant
+	supplicant = s
+	return func() {
+		supplicant = old
+	}
+}
+
+// FakeSupplicantDirs changes the directories of the wpa_supplicant
+// configuration files and control sockets.
+func FakeSupplicantDirs(confDir, ctrlDir string) (restore func()) {
+	oldConf, oldCtrl := supplicantConfDir, supplicantCtrlDir
+	supplicantConfDir, supplicantCtrlDir = confDir, ctrlDir
+	return func() {
+		supplicantConfDir, supplicantCtrlDir = oldConf, oldCtrl
+	}
+}
+
+// WPASupplicant returns the Supplicant that talks to wpa_supplicant.
+func WPASupplicant() Supplicant {
+	return wpaSupplicant{}
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package netstate
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+const applyNetworkKind = "apply-network"
+
+var resolvConfPath = "/etc/resolv.conf"
+
+// Netlinker configures network interfaces in the kernel.
+type Netlinker interface {
+	// InterfaceIndex returns the index of the named interface.
+	InterfaceIndex(name string) (int, error)
+
+	// SetLinkUp brings the interface up.
+	SetLinkUp(index int) error
+
+	// AddAddress adds an address to the interface, or replaces it if it
+	// already has that address.
+	AddAddress(index int, prefix netip.Prefix) error
+
+	// AddRoute adds a route through the interface, or replaces an existing
+	// route to the same destination. The gateway, via, may be the zero
+	// Addr for a directly reachable destination.
+	AddRoute(index int, dest netip.Prefix, via netip.Addr, metric int) error
+}
+
+var netlink Netlinker = kernelNetlink{}
+
+// Supplicant controls the wpa_supplicant instances that associate Wi-Fi
+// interfaces with access points.
+type Supplicant interface {
+	// Reconfigure tells the wpa_supplicant running for the interface to
+	// read its configuration file again. It returns an error wrapping
+	// os.ErrNotExist if wpa_supplicant isn't running for the interface.
+	Reconfigure(iface string) error
+}
+
+var supplicant Supplicant = wpaSupplicant{}
+
+// NetworkManager applies the static configuration of the network interfaces
+// in the "network" section of the plan. Each time the section changes, an
+// "apply-network" change is created that brings the interfaces up, adds
+// their addresses and routes, and writes their nameservers to
+// /etc/resolv.conf. The access points of Wi-Fi interfaces are written to a
+// wpa_supplicant configuration file for each interface, and any
+// wpa_supplicant running for the interface is told to reload it.
+//
+// Removing an interface, address, or route from the plan doesn't remove it
+// from the system, and interfaces aren't configured using DHCP; run a DHCP
+// client as a service for that, and wpa_supplicant to associate Wi-Fi
+// interfaces.
+type NetworkManager struct {
+	state      *state.State
+	ensureDone atomic.Bool
+
+	// network is the configuration applied (or being applied) by the last
+	// apply-network change, and failed is set if applying it failed, so
+	// that it's applied again when the plan next changes. It's kept here
+	// rather than in the task so that Wi-Fi passwords aren't written to
+	// the state file. Only accessed with the state lock held.
+	network *plan.Network
+	failed  bool
+}
+
+// NewManager creates a new network manager.
+func NewManager(s *state.State, runner *state.TaskRunner) *NetworkManager {
+	manager := &NetworkManager{
+		state: s,
+	}
+	runner.AddHandler(applyNetworkKind, manager.doApplyNetwork, nil)
+	return manager
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *NetworkManager) Ensure() error {
+	m.ensureDone.Store(true)
+	return nil
+}
+
+// PlanChanged handles updates to the plan (server configuration), creating
+// an apply-network change if the network configuration has changed, or if
+// applying it last time failed.
+func (m *NetworkManager) PlanChanged(p *plan.Plan) {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	if p.Network == nil || len(p.Network.Ethernets)+len(p.Network.Wifis) == 0 {
+		return
+	}
+	network := p.Network.Copy()
+	for _, iface := range interfaces(network) {
+		// The override doesn't affect how the interface is configured.
+		iface.Override = plan.UnknownOverride
+	}
+	if !m.failed && reflect.DeepEqual(network, m.network) {
+		return
+	}
+	m.network = network
+	m.failed = false
+
+	task := m.state.NewTask(applyNetworkKind, "Apply network configuration")
+	change := m.state.NewChange(applyNetworkKind, task.Summary())
+	change.AddTask(task)
+
+	if !m.ensureDone.Load() {
+		// Can't call EnsureBefore before Overlord.Loop is running (which will
+		// call m.Ensure for the first time).
+		return
+	}
+	m.state.EnsureBefore(0) // start new tasks right away
+}
+
+// interfaces returns the ethernet interfaces followed by the Wi-Fi
+// interfaces, each in name order.
+func interfaces(network *plan.Network) []*plan.NetworkInterface {
+	var ifaces []*plan.NetworkInterface
+	for _, group := range []map[string]*plan.NetworkInterface{network.Ethernets, network.Wifis} {
+		names := make([]string, 0, len(group))
+		for name := range group {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ifaces = append(ifaces, group[name])
+		}
+	}
+	return ifaces
+}
+
+func (m *NetworkManager) doApplyNetwork(task *state.Task, tomb *tomb.Tomb) error {
+	m.state.Lock()
+	network := m.network
+	m.state.Unlock()
+	if network == nil {
+		// The change was created before the daemon restarted, and the
+		// plan's configuration has been applied by a new one since.
+		return nil
+	}
+
+	var errs []error
+	for _, iface := range interfaces(network) {
+		_, isWifi := network.Wifis[iface.Name]
+		err := m.applyInterface(task, iface, isWifi)
+		if err != nil {
+			logger.Noticef("Cannot configure network interface %q: %v", iface.Name, err)
+			errs = append(errs, fmt.Errorf("network interface %q: %w", iface.Name, err))
+			continue
+		}
+		m.state.Lock()
+		task.Logf("Configured network interface %s", iface.Name)
+		m.state.Unlock()
+	}
+
+	written, err := writeResolvConf(interfaces(network))
+	if err != nil {
+		logger.Noticef("Cannot write nameservers: %v", err)
+		errs = append(errs, fmt.Errorf("cannot write nameservers: %w", err))
+	} else if written {
+		m.state.Lock()
+		task.Logf("Wrote nameservers to %s", resolvConfPath)
+		m.state.Unlock()
+	}
+
+	err = errors.Join(errs...)
+	if err != nil {
+		m.state.Lock()
+		if m.network == network {
+			m.failed = true
+		}
+		m.state.Unlock()
+	}
+	return err
+}
+
+// applyInterface configures the access points of a Wi-Fi interface, brings
+// the interface up, and adds its addresses and routes. The configuration
+// has already been validated as part of the plan.
+func (m *NetworkManager) applyInterface(task *state.Task, iface *plan.NetworkInterface, isWifi bool) error {
+	index, err := netlink.InterfaceIndex(iface.Name)
+	if err != nil {
+		return err
+	}
+	if isWifi {
+		err := m.applyAccessPoints(task, iface)
+		if err != nil {
+			return err
+		}
+	}
+	err = netlink.SetLinkUp(index)
+	if err != nil {
+		return fmt.Errorf("cannot bring interface up: %w", err)
+	}
+	for _, address := range iface.Addresses {
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			return err
+		}
+		err = netlink.AddAddress(index, prefix)
+		if err != nil {
+			return fmt.Errorf("cannot add address %s: %w", address, err)
+		}
+	}
+	for _, route := range iface.Routes {
+		dest, err := route.Destination()
+		if err != nil {
+			return err
+		}
+		var via netip.Addr
+		if route.Via != "" {
+			via, err = netip.ParseAddr(route.Via)
+			if err != nil {
+				return err
+			}
+		}
+		err = netlink.AddRoute(index, dest.Masked(), via, route.Metric)
+		if err != nil {
+			return fmt.Errorf("cannot add route to %s: %w", route.To, err)
+		}
+	}
+	return nil
+}
+
+// applyAccessPoints writes the access points of a Wi-Fi interface to its
+// wpa_supplicant configuration file, and tells wpa_supplicant to reload it
+// if it's running for the interface.
+func (m *NetworkManager) applyAccessPoints(task *state.Task, iface *plan.NetworkInterface) error {
+	path := supplicantConfPath(iface.Name)
+	err := writeSupplicantConf(path, iface.AccessPoints)
+	if err != nil {
+		return fmt.Errorf("cannot write wpa_supplicant configuration: %w", err)
+	}
+	err = supplicant.Reconfigure(iface.Name)
+	if errors.Is(err, os.ErrNotExist) {
+		m.state.Lock()
+		task.Logf("Wrote Wi-Fi configuration to %s, but wpa_supplicant isn't running for %s", path, iface.Name)
+		m.state.Unlock()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot reconfigure wpa_supplicant: %w", err)
+	}
+	return nil
+}
+
+// writeResolvConf writes the nameservers and search domains of the
+// interfaces, in the given order and without duplicates, to resolv.conf. It
+// leaves the file alone if no interface has nameservers, and reports
+// whether it was written.
+func writeResolvConf(ifaces []*plan.NetworkInterface) (bool, error) {
+	var nameservers, search []string
+	seen := make(map[string]bool)
+	for _, iface := range ifaces {
+		for _, address := range iface.Nameservers.Addresses {
+			if !seen[address] {
+				seen[address] = true
+				nameservers = append(nameservers, address)
+			}
+		}
+		for _, domain := range iface.Nameservers.Search {
+			if !seen[domain] {
+				seen[domain] = true
+				search = append(search, domain)
+			}
+		}
+	}
+	if len(nameservers) == 0 && len(search) == 0 {
+		return false, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("# Written by Pebble from the \"network\" section of the plan.\n")
+	for _, address := range nameservers {
+		fmt.Fprintf(&b, "nameserver %s\n", address)
+	}
+	if len(search) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(search, " "))
+	}
+	// Write the file in place rather than atomically, as it's often a bind
+	// mount in containers.
+	err := os.WriteFile(resolvConfPath, []byte(b.String()), 0644)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,358 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package netstate_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord"
+	"github.com/canonical/pebble/internals/overlord/netstate"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/testutil"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+// fakeNetlink records the operations as strings, for interfaces named
+// "eth0" and "wlan0".
+type fakeNetlink struct {
+	mu  sync.Mutex
+	ops []string
+}
+
+func (n *fakeNetlink) record(format string, args ...interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.ops = append(n.ops, fmt.Sprintf(format, args...))
+}
+
+func (n *fakeNetlink) InterfaceIndex(name string) (int, error) {
+	switch name {
+	case "eth0":
+		return 2, nil
+	case "wlan0":
+		return 3, nil
+	}
+	return 0, errors.New("no such network interface")
+}
+
+func (n *fakeNetlink) SetLinkUp(index int) error {
+	n.record("up %d", index)
+	return nil
+}
+
+func (n *fakeNetlink) AddAddress(index int, prefix netip.Prefix) error {
+	n.record("address %d %s", index, prefix)
+	return nil
+}
+
+func (n *fakeNetlink) AddRoute(index int, dest netip.Prefix, via netip.Addr, metric int) error {
+	n.record("route %d %s via %s metric %d", index, dest, via, metric)
+	return nil
+}
+
+// fakeSupplicant records the interfaces it's asked to reconfigure, and
+// returns err.
+type fakeSupplicant struct {
+	mu         sync.Mutex
+	interfaces []string
+	err        error
+}
+
+func (s *fakeSupplicant) Reconfigure(iface string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interfaces = append(s.interfaces, iface)
+	return s.err
+}
+
+type ManagerSuite struct {
+	overlord      *overlord.Overlord
+	manager       *netstate.NetworkManager
+	netlink       *fakeNetlink
+	supplicant    *fakeSupplicant
+	resolvConf    string
+	supplicantDir string
+	restore       []func()
+}
+
+var _ = Suite(&ManagerSuite{})
+
+func (s *ManagerSuite) SetUpTest(c *C) {
+	s.netlink = &fakeNetlink{}
+	s.supplicant = &fakeSupplicant{}
+	s.resolvConf = filepath.Join(c.MkDir(), "resolv.conf")
+	s.supplicantDir = filepath.Join(c.MkDir(), "wpa_supplicant")
+	s.restore = []func(){
+		netstate.FakeNetlink(s.netlink),
+		netstate.FakeSupplicant(s.supplicant),
+		netstate.FakeResolvConfPath(s.resolvConf),
+		netstate.FakeSupplicantDirs(s.supplicantDir, "/run/wpa_supplicant"),
+	}
+
+	s.overlord = overlord.Fake()
+	s.manager = netstate.NewManager(s.overlord.State(), s.overlord.TaskRunner())
+	s.overlord.AddManager(s.manager)
+	s.overlord.AddManager(s.overlord.TaskRunner())
+	err := s.overlord.StartUp()
+	c.Assert(err, IsNil)
+	s.overlord.Loop()
+}
+
+func (s *ManagerSuite) TearDownTest(c *C) {
+	s.overlord.Stop()
+	for _, restore := range s.restore {
+		restore()
+	}
+}
+
+func (s *ManagerSuite) waitChange(c *C, n int) *state.Change {
+	st := s.overlord.State()
+	for i := 0; i < 500; i++ {
+		st.Lock()
+		changes := st.Changes()
+		st.Unlock()
+		if len(changes) >= n {
+			change := changes[n-1]
+			for _, other := range changes {
+				if other.ID() > change.ID() {
+					change = other
+				}
+			}
+			select {
+			case <-change.Ready():
+				return change
+			case <-time.After(5 * time.Second):
+				c.Fatalf("timed out waiting for change to be ready")
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("timed out waiting for change")
+	return nil
+}
+
+func (s *ManagerSuite) TestApplyNetwork(c *C) {
+	s.manager.PlanChanged(&plan.Plan{Network: &plan.Network{
+		Ethernets: map[string]*plan.NetworkInterface{
+			"eth0": {
+				Name:      "eth0",
+				Addresses: []string{"192.168.1.10/24", "fd00::10/64"},
+				Routes: []plan.NetworkRoute{
+					{To: "default", Via: "192.168.1.1"},
+					{To: "10.1.2.3/8", Metric: 100},
+				},
+				Nameservers: plan.Nameservers{
+					Addresses: []string{"192.168.1.1", "1.1.1.1"},
+					Search:    []string{"example.com"},
+				},
+			},
+		},
+		Wifis: map[string]*plan.NetworkInterface{
+			"wlan0": {
+				Name:      "wlan0",
+				Addresses: []string{"10.0.0.2/8"},
+				Nameservers: plan.Nameservers{
+					Addresses: []string{"1.1.1.1", "fd00::1"},
+				},
+				AccessPoints: map[string]*plan.AccessPoint{
+					"home":      {Password: `correct "horse"`},
+					"cafe wifi": {Hidden: true},
+				},
+			},
+		},
+	}})
+	change := s.waitChange(c, 1)
+
+	st := s.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(change.Kind(), Equals, "apply-network")
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	tasks := change.Tasks()
+	c.Assert(tasks, HasLen, 1)
+	log := tasks[0].Log()
+	c.Assert(log, HasLen, 3)
+	c.Check(log[0], Matches, `.* INFO Configured network interface eth0`)
+	c.Check(log[1], Matches, `.* INFO Configured network interface wlan0`)
+	c.Check(log[2], Matches, `.* INFO Wrote nameservers to .*/resolv.conf`)
+
+	c.Check(s.netlink.ops, DeepEquals, []string{
+		"up 2",
+		"address 2 192.168.1.10/24",
+		"address 2 fd00::10/64",
+		"route 2 0.0.0.0/0 via 192.168.1.1 metric 0",
+		"route 2 10.0.0.0/8 via invalid IP metric 100",
+		"up 3",
+		"address 3 10.0.0.2/8",
+	})
+	c.Check(s.resolvConf, testutil.FileEquals, `
+# Written by Pebble from the "network" section of the plan.
+nameserver 192.168.1.1
+nameserver 1.1.1.1
+nameserver fd00::1
+search example.com
+`[1:])
+
+	// The access points are written for wpa_supplicant, which is told to
+	// reload them. The password isn't stored in the state.
+	c.Check(s.supplicant.interfaces, DeepEquals, []string{"wlan0"})
+	confPath := filepath.Join(s.supplicantDir, "wpa_supplicant-wlan0.conf")
+	c.Check(confPath, testutil.FileEquals, `
+# Written by Pebble from the "network" section of the plan.
+ctrl_interface=/run/wpa_supplicant
+
+network={
+	ssid=636166652077696669
+	key_mgmt=NONE
+	scan_ssid=1
+}
+
+network={
+	ssid=686f6d65
+	psk="correct "horse""
+}
+`[1:])
+	info, err := os.Stat(confPath)
+	c.Assert(err, IsNil)
+	c.Check(info.Mode().Perm(), Equals, os.FileMode(0600))
+	data, err := json.Marshal(st)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Not(Matches), `.*horse.*`)
+}
+
+func (s *ManagerSuite) TestSupplicantNotRunning(c *C) {
+	s.supplicant.err = fmt.Errorf("cannot find socket: %w", os.ErrNotExist)
+	s.manager.PlanChanged(&plan.Plan{Network: &plan.Network{
+		Wifis: map[string]*plan.NetworkInterface{
+			"wlan0": {
+				Name:         "wlan0",
+				AccessPoints: map[string]*plan.AccessPoint{"home": {}},
+			},
+		},
+	}})
+	change := s.waitChange(c, 1)
+
+	st := s.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	log := change.Tasks()[0].Log()
+	c.Assert(log, HasLen, 2)
+	c.Check(log[0], Matches, `.* INFO Wrote Wi-Fi configuration to .*/wpa_supplicant-wlan0.conf, but wpa_supplicant isn't running for wlan0`)
+	c.Check(log[1], Matches, `.* INFO Configured network interface wlan0`)
+	c.Check(s.netlink.ops, DeepEquals, []string{"up 3"})
+}
+
+func (s *ManagerSuite) TestUnchangedPlan(c *C) {
+	p := &plan.Plan{Network: &plan.Network{Ethernets: map[string]*plan.NetworkInterface{
+		"eth0": {Name: "eth0", Addresses: []string{"192.168.1.10/24"}},
+	}}}
+	s.manager.PlanChanged(p)
+	s.waitChange(c, 1)
+
+	// Plan changes that don't change the network configuration don't
+	// create a new change.
+	s.manager.PlanChanged(p)
+	s.manager.PlanChanged(&plan.Plan{Network: &plan.Network{Ethernets: map[string]*plan.NetworkInterface{
+		"eth0": {Name: "eth0", Addresses: []string{"192.168.1.10/24"}, Override: plan.MergeOverride},
+	}}})
+	st := s.overlord.State()
+	st.Lock()
+	c.Check(st.Changes(), HasLen, 1)
+	st.Unlock()
+
+	// Without nameservers, resolv.conf is left alone.
+	_, err := os.Stat(s.resolvConf)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ManagerSuite) TestApplyError(c *C) {
+	p := &plan.Plan{Network: &plan.Network{Ethernets: map[string]*plan.NetworkInterface{
+		"eth0": {Name: "eth0", Addresses: []string{"192.168.1.10/24"}},
+		"eth9": {Name: "eth9", Addresses: []string{"192.168.2.10/24"}},
+	}}}
+	s.manager.PlanChanged(p)
+	change := s.waitChange(c, 1)
+
+	st := s.overlord.State()
+	st.Lock()
+	c.Check(change.Status(), Equals, state.ErrorStatus)
+	c.Check(change.Err(), ErrorMatches, `(?s).*network interface "eth9": no such network interface.*`)
+	st.Unlock()
+
+	// Other interfaces are still configured.
+	c.Check(s.netlink.ops, DeepEquals, []string{"up 2", "address 2 192.168.1.10/24"})
+
+	// As applying the configuration failed, it's applied again when the
+	// plan next changes, even if the configuration hasn't.
+	s.manager.PlanChanged(p)
+	change = s.waitChange(c, 2)
+	st.Lock()
+	c.Check(change.Status(), Equals, state.ErrorStatus)
+	c.Check(st.Changes(), HasLen, 2)
+	st.Unlock()
+	c.Check(s.netlink.ops, HasLen, 4)
+}
+
+func (s *ManagerSuite) TestWPASupplicantReconfigure(c *C) {
+	ctrlDir := c.MkDir()
+	restore := netstate.FakeSupplicantDirs(s.supplicantDir, ctrlDir)
+	defer restore()
+	supplicant := netstate.WPASupplicant()
+
+	err := supplicant.Reconfigure("wlan0")
+	c.Check(errors.Is(err, os.ErrNotExist), Equals, true)
+
+	// Pretend to be wpa_supplicant's control socket.
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(ctrlDir, "wlan0"), Net: "unixgram"})
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	replies := []string{"OK\n", "FAIL\n"}
+	done := make(chan string, len(replies))
+	go func() {
+		buf := make([]byte, 256)
+		for _, reply := range replies {
+			n, addr, err := conn.ReadFromUnix(buf)
+			if err != nil {
+				done <- err.Error()
+				return
+			}
+			conn.WriteToUnix([]byte(reply), addr)
+			done <- string(buf[:n])
+		}
+	}()
+
+	err = supplicant.Reconfigure("wlan0")
+	c.Assert(err, IsNil)
+	c.Check(<-done, Equals, "RECONFIGURE")
+	err = supplicant.Reconfigure("wlan0")
+	c.Assert(err, ErrorMatches, "wpa_supplicant replied FAIL")
+	c.Check(<-done, Equals, "RECONFIGURE")
+}
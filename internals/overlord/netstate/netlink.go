@@ -0,0 +1,177 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package netstate
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// kernelNetlink configures network interfaces by sending route netlink
+// messages to the kernel.
+type kernelNetlink struct{}
+
+func (kernelNetlink) InterfaceIndex(name string) (int, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return 0, err
+	}
+	return iface.Index, nil
+}
+
+func (kernelNetlink) SetLinkUp(index int) error {
+	msg := unix.IfInfomsg{
+		Family: unix.AF_UNSPEC,
+		Index:  int32(index),
+		Flags:  unix.IFF_UP,
+		Change: unix.IFF_UP,
+	}
+	return netlinkRequest(unix.RTM_NEWLINK, 0, structBytes(&msg))
+}
+
+func (kernelNetlink) AddAddress(index int, prefix netip.Prefix) error {
+	family, addr := addrFamily(prefix.Addr())
+	msg := unix.IfAddrmsg{
+		Family:    family,
+		Prefixlen: uint8(prefix.Bits()),
+		Index:     uint32(index),
+	}
+	if prefix.Addr().IsLoopback() {
+		// As with ip(8), loopback addresses are only valid on the host.
+		msg.Scope = unix.RT_SCOPE_HOST
+	}
+	body := structBytes(&msg)
+	body = appendAttr(body, unix.IFA_LOCAL, addr)
+	body = appendAttr(body, unix.IFA_ADDRESS, addr)
+	return netlinkRequest(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_REPLACE, body)
+}
+
+func (kernelNetlink) AddRoute(index int, dest netip.Prefix, via netip.Addr, metric int) error {
+	family, destAddr := addrFamily(dest.Addr())
+	msg := unix.RtMsg{
+		Family:   family,
+		Dst_len:  uint8(dest.Bits()),
+		Table:    unix.RT_TABLE_MAIN,
+		Protocol: unix.RTPROT_STATIC,
+		Scope:    unix.RT_SCOPE_UNIVERSE,
+		Type:     unix.RTN_UNICAST,
+	}
+	if !via.IsValid() {
+		msg.Scope = unix.RT_SCOPE_LINK
+	}
+	body := structBytes(&msg)
+	if dest.Bits() > 0 {
+		body = appendAttr(body, unix.RTA_DST, destAddr)
+	}
+	if via.IsValid() {
+		_, viaAddr := addrFamily(via)
+		body = appendAttr(body, unix.RTA_GATEWAY, viaAddr)
+	}
+	oif := uint32(index)
+	body = appendAttr(body, unix.RTA_OIF, structBytes(&oif))
+	if metric > 0 {
+		priority := uint32(metric)
+		body = appendAttr(body, unix.RTA_PRIORITY, structBytes(&priority))
+	}
+	return netlinkRequest(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_REPLACE, body)
+}
+
+// netlinkRequest sends a route netlink request with the given message type,
+// flags, and body, and waits for the kernel to acknowledge it.
+func netlinkRequest(msgType uint16, flags uint16, body []byte) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+	if err != nil {
+		return err
+	}
+
+	const seq = 1
+	header := unix.NlMsghdr{
+		Len:   uint32(unix.SizeofNlMsghdr + len(body)),
+		Type:  msgType,
+		Flags: unix.NLM_F_REQUEST | unix.NLM_F_ACK | flags,
+		Seq:   seq,
+	}
+	msg := append(structBytes(&header), body...)
+	err = unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, unix.Getpagesize())
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return err
+		}
+		replies, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, reply := range replies {
+			if reply.Header.Seq != seq || reply.Header.Type != unix.NLMSG_ERROR {
+				continue
+			}
+			if len(reply.Data) < unix.SizeofNlMsgerr {
+				return errors.New("short netlink acknowledgement")
+			}
+			nlErr := (*unix.NlMsgerr)(unsafe.Pointer(&reply.Data[0]))
+			if nlErr.Error != 0 {
+				return syscall.Errno(-nlErr.Error)
+			}
+			return nil
+		}
+	}
+}
+
+// structBytes returns a copy of the memory of the value v points to, which
+// is how netlink messages and attributes are laid out.
+func structBytes[T any](v *T) []byte {
+	return append([]byte(nil), unsafe.Slice((*byte)(unsafe.Pointer(v)), unsafe.Sizeof(*v))...)
+}
+
+// appendAttr appends a netlink attribute to b, padded to the netlink
+// alignment.
+func appendAttr(b []byte, attrType uint16, data []byte) []byte {
+	attr := unix.RtAttr{
+		Len:  uint16(unix.SizeofRtAttr + len(data)),
+		Type: attrType,
+	}
+	b = append(b, structBytes(&attr)...)
+	b = append(b, data...)
+	for len(b)%unix.NLMSG_ALIGNTO != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// addrFamily returns the address family of addr and its bytes.
+func addrFamily(addr netip.Addr) (uint8, []byte) {
+	if addr.Is4() {
+		b := addr.As4()
+		return unix.AF_INET, b[:]
+	}
+	b := addr.As16()
+	return unix.AF_INET6, b[:]
+}
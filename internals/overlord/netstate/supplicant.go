@@ -0,0 +1,127 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package netstate
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/canonical/pebble/internals/osutil"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+var (
+	// supplicantConfDir is where the wpa_supplicant configuration file of
+	// each Wi-Fi interface is written, named as the wpa_supplicant@ systemd
+	// units expect.
+	supplicantConfDir = "/etc/wpa_supplicant"
+
+	// supplicantCtrlDir is where wpa_supplicant creates its control
+	// sockets, one per interface.
+	supplicantCtrlDir = "/run/wpa_supplicant"
+)
+
+// supplicantTimeout limits how long wpa_supplicant may take to reply.
+const supplicantTimeout = 5 * time.Second
+
+func supplicantConfPath(iface string) string {
+	return filepath.Join(supplicantConfDir, "wpa_supplicant-"+iface+".conf")
+}
+
+// writeSupplicantConf writes a wpa_supplicant configuration file for the
+// given access points, in SSID order. As it contains their passwords, only
+// root can read it.
+func writeSupplicantConf(path string, accessPoints map[string]*plan.AccessPoint) error {
+	ssids := make([]string, 0, len(accessPoints))
+	for ssid := range accessPoints {
+		ssids = append(ssids, ssid)
+	}
+	sort.Strings(ssids)
+
+	var b strings.Builder
+	b.WriteString("# Written by Pebble from the \"network\" section of the plan.\n")
+	fmt.Fprintf(&b, "ctrl_interface=%s\n", supplicantCtrlDir)
+	for _, ssid := range ssids {
+		ap := accessPoints[ssid]
+		b.WriteString("\nnetwork={\n")
+		// Writing the SSID in hex means it needn't be escaped. The
+		// password has been checked to be printable ASCII, which can be
+		// quoted as is.
+		fmt.Fprintf(&b, "\tssid=%s\n", hex.EncodeToString([]byte(ssid)))
+		if ap.Password != "" {
+			fmt.Fprintf(&b, "\tpsk=\"%s\"\n", ap.Password)
+		} else {
+			b.WriteString("\tkey_mgmt=NONE\n")
+		}
+		if ap.Hidden {
+			b.WriteString("\tscan_ssid=1\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(path, []byte(b.String()), 0600, 0)
+}
+
+// wpaSupplicant talks to wpa_supplicant over its control sockets.
+type wpaSupplicant struct{}
+
+func (wpaSupplicant) Reconfigure(iface string) error {
+	remote := filepath.Join(supplicantCtrlDir, iface)
+	if _, err := os.Stat(remote); err != nil {
+		return err
+	}
+	// The control socket replies to the client's address, so the client
+	// must bind its own socket.
+	local := filepath.Join(os.TempDir(), fmt.Sprintf("pebble-wpa-%d-%s", os.Getpid(), iface))
+	os.Remove(local)
+	conn, err := net.DialUnix("unixgram",
+		&net.UnixAddr{Name: local, Net: "unixgram"},
+		&net.UnixAddr{Name: remote, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(local)
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(supplicantTimeout))
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte("RECONFIGURE"))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	reply := strings.TrimSpace(string(buf[:n]))
+	if reply != "OK" {
+		return errors.New("wpa_supplicant replied " + reply)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package noticestate
+
+import (
+	"context"
+	"time"
+
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+// FakeWaitNotices replaces the function used to wait for notices to deliver.
+func FakeWaitNotices(f func(st *state.State, ctx context.Context, filter *state.NoticeFilter) ([]*state.Notice, error)) (restore func()) {
+	old := waitNotices
+	waitNotices = f
+	return func() {
+		waitNotices = old
+	}
+}
+
+// FakeRetryDelay changes how long the loop waits after an error.
+func FakeRetryDelay(delay time.Duration) (restore func()) {
+	oldDelay, oldMax := retryDelay, maxRetryDelay
+	retryDelay, maxRetryDelay = delay, delay
+	return func() {
+		retryDelay, maxRetryDelay = oldDelay, oldMax
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package noticestate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/canonical/x-go/strutil/shlex"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/osutil"
+	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/reaper"
+	"github.com/canonical/pebble/internals/servicelog"
+)
+
+const (
+	maxOutputBytes = 512
+	maxOutputLines = 5
+	hookWaitDelay  = time.Second
+)
+
+// hookTimeout is how long a hook command may run before it's killed.
+var hookTimeout = 30 * time.Second
+
+// runHook runs the hook's command, writing the notice data to its stdin.
+func runHook(ctx context.Context, hook *plan.NoticeHook, data []byte) error {
+	args, err := shlex.Split(hook.Command)
+	if err != nil {
+		return fmt.Errorf("cannot parse command: %v", err)
+	}
+	if len(args) == 0 {
+		return errors.New("empty command")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	// Similar to services and exec checks, inherit the daemon's environment.
+	environment := osutil.Environ()
+	for k, v := range hook.Environment {
+		// Requested environment takes precedence.
+		environment[k] = v
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = make([]string, 0, len(environment)) // avoid additional allocations
+	for k, v := range environment {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Dir = hook.WorkingDir
+
+	// Run as another user if specified in the hook config.
+	uid, gid, err := osutil.NormalizeUidGid(hook.UserID, hook.GroupID, hook.User, hook.Group)
+	if err != nil {
+		return err
+	}
+	if uid != nil && gid != nil {
+		isCurrent, err := osutil.IsCurrent(*uid, *gid)
+		if err != nil {
+			logger.Debugf("Cannot determine if uid %d gid %d is current user", *uid, *gid)
+		}
+		if !isCurrent {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+			cmd.SysProcAttr.Credential = &syscall.Credential{
+				Uid: uint32(*uid),
+				Gid: uint32(*gid),
+			}
+		}
+	}
+
+	// Send output to a ring buffer so we can log the last few lines of
+	// output on error.
+	ringBuffer := servicelog.NewRingBuffer(maxOutputBytes)
+	defer ringBuffer.Close()
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = ringBuffer
+	cmd.Stderr = ringBuffer
+	cmd.WaitDelay = hookWaitDelay
+	err = reaper.StartCommand(cmd)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("Notice hook %q: running %q (PID %d)", hook.Name, hook.Command, cmd.Process.Pid)
+
+	exitCode, err := reaper.WaitCommand(cmd)
+	if errors.Is(ctx.Err(), context.Canceled) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ctx.Err()
+	}
+	if err == nil && exitCode > 0 {
+		err = fmt.Errorf("exit status %d", exitCode)
+	}
+	if err != nil {
+		output, linesErr := servicelog.LastLines(ringBuffer, maxOutputLines, "    ", false)
+		if linesErr != nil || output == "" {
+			return err
+		}
+		return fmt.Errorf("%w; output:\n%s", err, output)
+	}
+	return nil
+}
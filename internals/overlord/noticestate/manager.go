@@ -0,0 +1,194 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package noticestate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// NoticeManager delivers notices to the commands configured in the
+// "notice-hooks" section of the plan, so that the system can react to
+// notices without polling the API.
+type NoticeManager struct {
+	state *state.State
+
+	hooksLock sync.Mutex
+	hooks     map[string]*plan.NoticeHook
+
+	tomb      tomb.Tomb
+	startedUp bool
+}
+
+// NewManager creates a new notice manager.
+func NewManager(s *state.State) *NoticeManager {
+	return &NoticeManager{
+		state: s,
+		hooks: make(map[string]*plan.NoticeHook),
+	}
+}
+
+// PlanChanged handles updates to the plan (server configuration), replacing
+// the set of configured notice hooks.
+func (m *NoticeManager) PlanChanged(p *plan.Plan) {
+	m.hooksLock.Lock()
+	defer m.hooksLock.Unlock()
+
+	hooks := make(map[string]*plan.NoticeHook, len(p.NoticeHooks))
+	for name, hook := range p.NoticeHooks {
+		hooks[name] = hook
+	}
+	m.hooks = hooks
+}
+
+// StartUp implements StateStarterUp.StartUp, starting the dispatch loop.
+// Only notices that occur (or repeat) after start-up are delivered.
+func (m *NoticeManager) StartUp() error {
+	m.startedUp = true
+	after := time.Now()
+	m.tomb.Go(func() error {
+		return m.loop(after)
+	})
+	return nil
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *NoticeManager) Ensure() error {
+	return nil
+}
+
+// Stop implements StateStopper.Stop. It stops the dispatch loop, waiting
+// for any hook commands currently running to finish.
+func (m *NoticeManager) Stop() {
+	if !m.startedUp {
+		return
+	}
+	m.tomb.Kill(nil)
+	m.tomb.Wait()
+}
+
+// delivery holds the details of a single notice to be delivered to hooks.
+type delivery struct {
+	id           string
+	noticeType   string
+	key          string
+	lastRepeated time.Time
+	data         []byte
+}
+
+var (
+	// retryDelay is how long the loop waits before waiting for notices
+	// again after an error, doubling each time up to maxRetryDelay.
+	retryDelay    = time.Second
+	maxRetryDelay = time.Minute
+
+	waitNotices = (*state.State).WaitNotices
+)
+
+func (m *NoticeManager) loop(after time.Time) error {
+	ctx := m.tomb.Context(context.Background())
+	delay := retryDelay
+	for {
+		deliveries, err := m.waitNotices(ctx, after)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// Keep delivering notices rather than stopping on an error
+			// that may be transient.
+			logger.Noticef("Cannot wait for notices to deliver to hooks (retrying in %s): %v", delay, err)
+			select {
+			case <-time.After(delay):
+			case <-m.tomb.Dying():
+				return nil
+			}
+			delay *= 2
+			if delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+			continue
+		}
+		delay = retryDelay
+		for _, d := range deliveries {
+			m.deliver(ctx, d)
+		}
+		if len(deliveries) > 0 {
+			after = deliveries[len(deliveries)-1].lastRepeated
+		}
+	}
+}
+
+func (m *NoticeManager) waitNotices(ctx context.Context, after time.Time) ([]*delivery, error) {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	// WaitNotices releases the state lock while waiting.
+	notices, err := waitNotices(m.state, ctx, &state.NoticeFilter{After: after})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]*delivery, 0, len(notices))
+	for _, notice := range notices {
+		data, err := json.Marshal(notice)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery{
+			id:           notice.ID(),
+			noticeType:   string(notice.Type()),
+			key:          notice.Key(),
+			lastRepeated: notice.LastRepeated(),
+			data:         data,
+		})
+	}
+	return deliveries, nil
+}
+
+// deliver runs all hooks that match the notice, one after the other, in
+// hook name order.
+func (m *NoticeManager) deliver(ctx context.Context, d *delivery) {
+	m.hooksLock.Lock()
+	var hooks []*plan.NoticeHook
+	for _, hook := range m.hooks {
+		if hook.Matches(d.noticeType, d.key) {
+			hooks = append(hooks, hook)
+		}
+	}
+	m.hooksLock.Unlock()
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].Name < hooks[j].Name
+	})
+	for _, hook := range hooks {
+		err := runHook(ctx, hook, d.data)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return
+		}
+		if err != nil {
+			logger.Noticef("Notice hook %q failed for notice %s (%s:%s): %v",
+				hook.Name, d.id, d.noticeType, d.key, err)
+		}
+	}
+}
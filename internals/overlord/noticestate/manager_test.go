@@ -0,0 +1,223 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package noticestate_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord/noticestate"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/reaper"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type ManagerSuite struct {
+	state   *state.State
+	manager *noticestate.NoticeManager
+}
+
+var _ = Suite(&ManagerSuite{})
+
+func (s *ManagerSuite) SetUpSuite(c *C) {
+	err := reaper.Start()
+	c.Assert(err, IsNil)
+}
+
+func (s *ManagerSuite) TearDownSuite(c *C) {
+	err := reaper.Stop()
+	c.Assert(err, IsNil)
+}
+
+func (s *ManagerSuite) SetUpTest(c *C) {
+	s.state = state.New(nil)
+	s.manager = noticestate.NewManager(s.state)
+}
+
+func (s *ManagerSuite) TearDownTest(c *C) {
+	s.manager.Stop()
+}
+
+func (s *ManagerSuite) addNotice(c *C, noticeType state.NoticeType, key string) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	_, err := s.state.AddNotice(nil, noticeType, key, nil)
+	c.Assert(err, IsNil)
+}
+
+// waitLines waits for the given file to contain n lines, and returns them.
+func waitLines(c *C, path string, n int) []string {
+	for i := 0; i < 500; i++ {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if len(lines) >= n {
+				return lines
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("timed out waiting for %d lines in %s", n, path)
+	return nil
+}
+
+func (s *ManagerSuite) TestHookReceivesNotice(c *C) {
+	output := filepath.Join(c.MkDir(), "output")
+	s.manager.PlanChanged(&plan.Plan{
+		NoticeHooks: map[string]*plan.NoticeHook{
+			"hook1": {
+				Name:    "hook1",
+				Types:   []string{"custom"},
+				Command: fmt.Sprintf(`/bin/sh -c "cat >>%s; echo >>%s"`, output, output),
+			},
+		},
+	})
+	err := s.manager.StartUp()
+	c.Assert(err, IsNil)
+
+	s.addNotice(c, state.CustomNotice, "example.com/foo")
+
+	lines := waitLines(c, output, 1)
+	c.Assert(lines, HasLen, 1)
+	var notice map[string]interface{}
+	err = json.Unmarshal([]byte(lines[0]), &notice)
+	c.Assert(err, IsNil)
+	c.Check(notice["type"], Equals, "custom")
+	c.Check(notice["key"], Equals, "example.com/foo")
+	c.Check(notice["occurrences"], Equals, 1.0)
+}
+
+func (s *ManagerSuite) TestHookFilters(c *C) {
+	output := filepath.Join(c.MkDir(), "output")
+	s.manager.PlanChanged(&plan.Plan{
+		NoticeHooks: map[string]*plan.NoticeHook{
+			"hook1": {
+				Name:        "hook1",
+				Types:       []string{"custom"},
+				Keys:        []string{"example.com/b"},
+				Command:     fmt.Sprintf(`/bin/sh -c "echo $NAME >>%s"`, output),
+				Environment: map[string]string{"NAME": "hook1"},
+			},
+			"hook2": {
+				Name:        "hook2",
+				Types:       []string{"change-update"},
+				Command:     fmt.Sprintf(`/bin/sh -c "echo $NAME >>%s"`, output),
+				Environment: map[string]string{"NAME": "hook2"},
+			},
+		},
+	})
+	err := s.manager.StartUp()
+	c.Assert(err, IsNil)
+
+	s.addNotice(c, state.CustomNotice, "example.com/a")
+	s.addNotice(c, state.CustomNotice, "example.com/b")
+	s.addNotice(c, state.ChangeUpdateNotice, "123")
+
+	lines := waitLines(c, output, 2)
+	c.Assert(lines, DeepEquals, []string{"hook1", "hook2"})
+}
+
+func (s *ManagerSuite) TestHookFailureDoesNotStopDelivery(c *C) {
+	output := filepath.Join(c.MkDir(), "output")
+	s.manager.PlanChanged(&plan.Plan{
+		NoticeHooks: map[string]*plan.NoticeHook{
+			"bad": {
+				Name:    "bad",
+				Command: "/bin/sh -c 'echo oops; exit 1'",
+			},
+			"good": {
+				Name:    "good",
+				Command: fmt.Sprintf(`/bin/sh -c "cat >/dev/null; echo ok >>%s"`, output),
+			},
+		},
+	})
+	err := s.manager.StartUp()
+	c.Assert(err, IsNil)
+
+	s.addNotice(c, state.CustomNotice, "example.com/a")
+	s.addNotice(c, state.CustomNotice, "example.com/b")
+
+	lines := waitLines(c, output, 2)
+	c.Assert(lines, DeepEquals, []string{"ok", "ok"})
+}
+
+func (s *ManagerSuite) TestNoticesBeforeStartUpNotDelivered(c *C) {
+	output := filepath.Join(c.MkDir(), "output")
+	s.manager.PlanChanged(&plan.Plan{
+		NoticeHooks: map[string]*plan.NoticeHook{
+			"hook1": {
+				Name:    "hook1",
+				Command: fmt.Sprintf(`/bin/sh -c "cat >>%s; echo >>%s"`, output, output),
+			},
+		},
+	})
+	s.addNotice(c, state.CustomNotice, "example.com/before")
+	time.Sleep(time.Millisecond)
+
+	err := s.manager.StartUp()
+	c.Assert(err, IsNil)
+
+	s.addNotice(c, state.CustomNotice, "example.com/after")
+
+	lines := waitLines(c, output, 1)
+	c.Assert(lines, HasLen, 1)
+	c.Check(lines[0], Matches, `.*"key":"example.com/after".*`)
+}
+
+func (s *ManagerSuite) TestWaitErrorDoesNotStopDelivery(c *C) {
+	restore := noticestate.FakeRetryDelay(time.Millisecond)
+	defer restore()
+	failures := 0
+	restore = noticestate.FakeWaitNotices(func(st *state.State, ctx context.Context, filter *state.NoticeFilter) ([]*state.Notice, error) {
+		if failures < 3 {
+			failures++
+			return nil, errors.New("boom")
+		}
+		return st.WaitNotices(ctx, filter)
+	})
+	defer restore()
+
+	output := filepath.Join(c.MkDir(), "output")
+	s.manager.PlanChanged(&plan.Plan{
+		NoticeHooks: map[string]*plan.NoticeHook{
+			"hook1": {
+				Name:    "hook1",
+				Command: fmt.Sprintf(`/bin/sh -c "cat >/dev/null; echo ok >>%s"`, output),
+			},
+		},
+	})
+	err := s.manager.StartUp()
+	c.Assert(err, IsNil)
+	// Stop the loop before restoring the fakes.
+	defer s.manager.Stop()
+
+	s.addNotice(c, state.CustomNotice, "example.com/a")
+
+	lines := waitLines(c, output, 1)
+	c.Assert(lines, DeepEquals, []string{"ok"})
+}
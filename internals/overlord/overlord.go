@@ -28,15 +28,28 @@ import (
 	"github.com/canonical/x-go/randutil"
 	"gopkg.in/tomb.v2"
 
+	"github.com/canonical/pebble/internals/logger"
 	"github.com/canonical/pebble/internals/osutil"
 	"github.com/canonical/pebble/internals/overlord/checkstate"
 	"github.com/canonical/pebble/internals/overlord/cmdstate"
+	"github.com/canonical/pebble/internals/overlord/configsourcestate"
+	"github.com/canonical/pebble/internals/overlord/devstate"
+	"github.com/canonical/pebble/internals/overlord/inventorystate"
+	"github.com/canonical/pebble/internals/overlord/kmodstate"
 	"github.com/canonical/pebble/internals/overlord/logstate"
+	"github.com/canonical/pebble/internals/overlord/mountstate"
+	"github.com/canonical/pebble/internals/overlord/netstate"
+	"github.com/canonical/pebble/internals/overlord/noticestate"
 	"github.com/canonical/pebble/internals/overlord/patch"
 	"github.com/canonical/pebble/internals/overlord/planstate"
+	"github.com/canonical/pebble/internals/overlord/pluginstate"
 	"github.com/canonical/pebble/internals/overlord/restart"
 	"github.com/canonical/pebble/internals/overlord/servstate"
 	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/overlord/sysctlstate"
+	"github.com/canonical/pebble/internals/overlord/timesyncstate"
+	"github.com/canonical/pebble/internals/overlord/watchdogstate"
+	"github.com/canonical/pebble/internals/plan"
 	"github.com/canonical/pebble/internals/timing"
 )
 
@@ -73,13 +86,43 @@ type Options struct {
 	ServiceOutput io.Writer
 	// Extension allows extending the overlord with externally defined features.
 	Extension Extension
+	// WatchLayers enables reloading the plan when files in the layers
+	// directory change.
+	WatchLayers bool
+	// CachePlan enables caching the combined plan across restarts, so that
+	// the layers don't need to be read and combined again if they haven't
+	// changed.
+	CachePlan bool
+	// PersistLogs enables keeping service logs in files in the "logs"
+	// directory, so that they survive restarts.
+	PersistLogs bool
+	// CheckpointDelay, if non-zero, defers writing the state to disk for
+	// this long after it's modified, so that modifications in quick
+	// succession result in a single write. Zero writes the state on every
+	// modification.
+	CheckpointDelay time.Duration
+	// MemoryOnlyNoticeTypes are the notice types that are kept in memory
+	// only, rather than written to the state file.
+	MemoryOnlyNoticeTypes []state.NoticeType
+	// ConfigSource, if set, is the HTTPS URL of a signed layer bundle that
+	// is fetched every ConfigSourceInterval (five minutes if zero) and
+	// applied to the plan.
+	ConfigSource         string
+	ConfigSourceInterval time.Duration
+	// MaxRunningTasks, if non-zero, limits how many tasks run at once.
+	MaxRunningTasks int
+	// TaskPriorities maps task kinds to their priority. Ready tasks with a
+	// higher priority are started first; the default priority is zero.
+	TaskPriorities map[string]int
 }
 
 // Overlord is the central manager of the system, keeping track
 // of all available state managers and related helpers.
 type Overlord struct {
 	pebbleDir string
+	statePath string
 	stateEng  *StateEngine
+	backend   *overlordStateBackend
 
 	// ensure loop
 	loopTomb    *tomb.Tomb
@@ -92,14 +135,25 @@ type Overlord struct {
 	startOfOperationTime time.Time
 
 	// managers
-	inited     bool
-	startedUp  bool
-	runner     *state.TaskRunner
-	planMgr    *planstate.PlanManager
-	serviceMgr *servstate.ServiceManager
-	commandMgr *cmdstate.CommandManager
-	checkMgr   *checkstate.CheckManager
-	logMgr     *logstate.LogManager
+	inited       bool
+	startedUp    bool
+	runner       *state.TaskRunner
+	planMgr      *planstate.PlanManager
+	serviceMgr   *servstate.ServiceManager
+	commandMgr   *cmdstate.CommandManager
+	checkMgr     *checkstate.CheckManager
+	inventoryMgr *inventorystate.InventoryManager
+	configSrcMgr *configsourcestate.ConfigSourceManager
+	logMgr       *logstate.LogManager
+	noticeMgr    *noticestate.NoticeManager
+	kmodMgr      *kmodstate.KernelModuleManager
+	mountMgr     *mountstate.MountManager
+	sysctlMgr    *sysctlstate.SysctlManager
+	netMgr       *netstate.NetworkManager
+	timeMgr      *timesyncstate.TimeSyncManager
+	watchdogMgr  *watchdogstate.WatchdogManager
+	deviceMgr    *devstate.DeviceManager
+	pluginMgr    *pluginstate.PluginManager
 
 	extension Extension
 }
@@ -120,13 +174,20 @@ func New(opts *Options) (*Overlord, error) {
 	if !osutil.IsDir(o.pebbleDir) {
 		return nil, fmt.Errorf("directory %q does not exist", o.pebbleDir)
 	}
-	statePath := filepath.Join(o.pebbleDir, ".pebble.state")
+	o.statePath = filepath.Join(o.pebbleDir, ".pebble.state")
 
-	backend := &overlordStateBackend{
-		path:         statePath,
-		ensureBefore: o.ensureBefore,
+	o.backend = &overlordStateBackend{
+		path:            o.statePath,
+		ensureBefore:    o.ensureBefore,
+		checkpointDelay: opts.CheckpointDelay,
 	}
-	s, err := loadState(statePath, opts.RestartHandler, backend)
+	s, err := loadState(o.statePath, opts.RestartHandler, o.backend)
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	err = s.SetMemoryOnlyNoticeTypes(opts.MemoryOnlyNoticeTypes)
+	s.Unlock()
 	if err != nil {
 		return nil, err
 	}
@@ -140,13 +201,40 @@ func New(opts *Options) (*Overlord, error) {
 	}
 	o.runner.AddOptionalHandler(matchAnyUnknownTask, handleUnknownTask, nil)
 
+	o.runner.SetMaxRunning(opts.MaxRunningTasks)
+	for kind, priority := range opts.TaskPriorities {
+		o.runner.SetPriority(kind, priority)
+	}
+
+	// Tasks of different changes that operate on the same objects (such as
+	// starting and stopping the same service) are run one after the other.
+	o.runner.AddBlocked(state.ConflictBlocked)
+
+	// The hardware facts are collected first, so that they're available to
+	// "when" expressions and as variables when the plan is loaded.
+	o.inventoryMgr = inventorystate.NewManager()
+	o.stateEng.AddManager(o.inventoryMgr)
+	plan.SetFacts(o.inventoryMgr.Facts())
+
 	o.planMgr, err = planstate.NewManager(s, o.runner, o.pebbleDir)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create plan manager: %w", err)
 	}
 	o.stateEng.AddManager(o.planMgr)
+	if opts.WatchLayers {
+		o.planMgr.WatchLayers()
+	}
+	if opts.CachePlan {
+		o.planMgr.CachePlan()
+	}
+
+	// The device manager is told about plan updates before the service and
+	// check managers, so that it knows the devices they depend on.
+	o.deviceMgr = devstate.NewManager(s)
+	o.stateEng.AddManager(o.deviceMgr)
+	o.planMgr.AddChangeListener(o.deviceMgr.PlanChanged)
 
-	o.logMgr = logstate.NewLogManager()
+	o.logMgr = logstate.NewLogManager(s)
 
 	o.serviceMgr, err = servstate.NewManager(
 		s,
@@ -157,9 +245,16 @@ func New(opts *Options) (*Overlord, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot create service manager: %w", err)
 	}
+	if opts.PersistLogs {
+		err = o.serviceMgr.PersistLogs(filepath.Join(o.pebbleDir, "logs"))
+		if err != nil {
+			return nil, fmt.Errorf("cannot persist service logs: %w", err)
+		}
+	}
 
 	// Tell service manager about plan updates.
 	o.planMgr.AddChangeListener(o.serviceMgr.PlanChanged)
+	o.serviceMgr.SetDeviceManager(o.deviceMgr)
 
 	o.stateEng.AddManager(o.serviceMgr)
 	// The log manager should be stopped after the service manager, because
@@ -167,10 +262,11 @@ func New(opts *Options) (*Overlord, error) {
 	// log manager that it's okay to stop log forwarding.
 	o.stateEng.AddManager(o.logMgr)
 
-	o.commandMgr = cmdstate.NewManager(o.runner)
+	o.commandMgr = cmdstate.NewManager(s, o.runner, filepath.Join(o.pebbleDir, "exec-transcripts"))
 	o.stateEng.AddManager(o.commandMgr)
 
 	o.checkMgr = checkstate.NewManager(s, o.runner)
+	o.checkMgr.SetDeviceManager(o.deviceMgr)
 	o.stateEng.AddManager(o.checkMgr)
 
 	// Tell check manager about plan updates.
@@ -181,6 +277,73 @@ func New(opts *Options) (*Overlord, error) {
 
 	// Tell service manager about check failures.
 	o.checkMgr.NotifyCheckFailed(o.serviceMgr.CheckFailed)
+	o.checkMgr.NotifyCheckRecovered(o.serviceMgr.CheckRecovered)
+
+	o.noticeMgr = noticestate.NewManager(s)
+	o.stateEng.AddManager(o.noticeMgr)
+
+	// Tell notice manager about plan updates.
+	o.planMgr.AddChangeListener(o.noticeMgr.PlanChanged)
+
+	// Kernel modules are loaded before mounts are made, as filesystems may
+	// depend on them.
+	o.kmodMgr = kmodstate.NewManager()
+	o.stateEng.AddManager(o.kmodMgr)
+
+	// Tell kernel module manager about plan updates.
+	o.planMgr.AddChangeListener(o.kmodMgr.PlanChanged)
+
+	o.sysctlMgr = sysctlstate.NewManager(s, o.runner)
+	o.stateEng.AddManager(o.sysctlMgr)
+
+	// Tell sysctl manager about plan updates.
+	o.planMgr.AddChangeListener(o.sysctlMgr.PlanChanged)
+
+	o.netMgr = netstate.NewManager(s, o.runner)
+	o.stateEng.AddManager(o.netMgr)
+
+	// Tell network manager about plan updates.
+	o.planMgr.AddChangeListener(o.netMgr.PlanChanged)
+
+	o.timeMgr = timesyncstate.NewManager()
+	o.stateEng.AddManager(o.timeMgr)
+
+	// Tell time sync manager about plan updates.
+	o.planMgr.AddSectionsChangeListener(o.timeMgr.PlanChanged)
+
+	o.watchdogMgr = watchdogstate.NewManager(o.checkMgr, o.serviceMgr)
+	o.stateEng.AddManager(o.watchdogMgr)
+
+	// Tell watchdog manager about plan updates.
+	o.planMgr.AddChangeListener(o.watchdogMgr.PlanChanged)
+
+	// The mount manager is added after the service manager so that it's
+	// stopped after it, and services are stopped before the filesystems
+	// they use are unmounted.
+	o.mountMgr = mountstate.NewManager()
+	o.stateEng.AddManager(o.mountMgr)
+
+	// Tell mount manager about plan updates.
+	o.planMgr.AddChangeListener(o.mountMgr.PlanChanged)
+
+	// The plugin manager is added after the other managers, so that the
+	// plugins can't take over the built-in task kinds.
+	o.pluginMgr, err = pluginstate.NewManager(s, o.runner, o.pebbleDir)
+	if err != nil {
+		return nil, err
+	}
+	o.stateEng.AddManager(o.pluginMgr)
+
+	// Tell plugin manager about plan updates.
+	o.planMgr.AddChangeListener(o.pluginMgr.PlanChanged)
+
+	if opts.ConfigSource != "" {
+		o.configSrcMgr, err = configsourcestate.NewManager(o.planMgr, o.pebbleDir, opts.ConfigSource, opts.ConfigSourceInterval)
+		if err != nil {
+			return nil, err
+		}
+		o.stateEng.AddManager(o.configSrcMgr)
+	}
 
 	if o.extension != nil {
 		extraManagers, err := o.extension.ExtraManagers(o)
@@ -200,10 +363,13 @@ func New(opts *Options) (*Overlord, error) {
 	// Load the plan from the Pebble layers directory (which may be missing
 	// or have no layers, resulting in an empty plan), and propagate PlanChanged
 	// notifications to all notification subscribers.
+	timings := timing.Start("", "", map[string]string{"startup": "load-plan"})
 	err = o.planMgr.Load()
+	timings.Stop()
 	if err != nil {
 		return nil, fmt.Errorf("cannot load plan: %w", err)
 	}
+	saveTimings(s, timings)
 
 	return o, nil
 }
@@ -258,10 +424,7 @@ func loadState(statePath string, restartHandler restart.Handler, backend state.B
 	}
 
 	timings.Stop()
-	// TODO Implement function to save timings.
-	//s.Lock()
-	//perfTimings.Save(s)
-	//s.Unlock()
+	saveTimings(s, timings)
 
 	err = initRestart(s, curBootID, restartHandler)
 	if err != nil {
@@ -276,6 +439,17 @@ func loadState(statePath string, restartHandler restart.Handler, backend state.B
 	return s, nil
 }
 
+// saveTimings saves a startup timing span to the state, so that it can be
+// retrieved via the debug API.
+func saveTimings(s *state.State, timings *timing.Span) {
+	s.Lock()
+	defer s.Unlock()
+	err := timings.Save(s)
+	if err != nil {
+		logger.Noticef("Cannot save startup timings: %v", err)
+	}
+}
+
 func initRestart(s *state.State, curBootID string, restartHandler restart.Handler) error {
 	s.Lock()
 	defer s.Unlock()
@@ -381,6 +555,12 @@ func (o *Overlord) Stop() error {
 	o.loopTomb.Kill(nil)
 	err := o.loopTomb.Wait()
 	o.stateEng.Stop()
+	if o.backend != nil {
+		// Write any deferred checkpoint before exiting.
+		if flushErr := o.backend.Flush(); flushErr != nil && err == nil {
+			err = fmt.Errorf("cannot write state: %w", flushErr)
+		}
+	}
 	return err
 }
 
@@ -480,6 +660,12 @@ func (o *Overlord) State() *state.State {
 	return o.stateEng.State()
 }
 
+// StatePath returns the path of the file the state is persisted to, or ""
+// if the state isn't persisted to disk (for a fake overlord).
+func (o *Overlord) StatePath() string {
+	return o.statePath
+}
+
 // StateEngine returns the state engine used by overlord.
 func (o *Overlord) StateEngine() *StateEngine {
 	return o.stateEng
@@ -509,6 +695,78 @@ func (o *Overlord) CheckManager() *checkstate.CheckManager {
 	return o.checkMgr
 }
 
+// NoticeManager returns the notice manager responsible for delivering
+// notices to notice hooks.
+func (o *Overlord) NoticeManager() *noticestate.NoticeManager {
+	return o.noticeMgr
+}
+
+// InventoryManager returns the manager holding the hardware facts of the
+// device.
+func (o *Overlord) InventoryManager() *inventorystate.InventoryManager {
+	return o.inventoryMgr
+}
+
+// ConfigSourceManager returns the manager that applies the layer bundles
+// fetched from the config source, or nil if no config source is set.
+func (o *Overlord) ConfigSourceManager() *configsourcestate.ConfigSourceManager {
+	return o.configSrcMgr
+}
+
+// KernelModuleManager returns the manager responsible for loading the
+// kernel modules defined in the plan.
+func (o *Overlord) KernelModuleManager() *kmodstate.KernelModuleManager {
+	return o.kmodMgr
+}
+
+// LogManager returns the log manager responsible for forwarding service
+// logs to the log targets defined in the plan.
+func (o *Overlord) LogManager() *logstate.LogManager {
+	return o.logMgr
+}
+
+// MountManager returns the mount manager responsible for mounting the
+// filesystems defined in the plan.
+func (o *Overlord) MountManager() *mountstate.MountManager {
+	return o.mountMgr
+}
+
+// SysctlManager returns the manager responsible for applying the sysctl
+// values defined in the plan.
+func (o *Overlord) SysctlManager() *sysctlstate.SysctlManager {
+	return o.sysctlMgr
+}
+
+// NetworkManager returns the manager responsible for applying the network
+// configuration defined in the plan.
+func (o *Overlord) NetworkManager() *netstate.NetworkManager {
+	return o.netMgr
+}
+
+// TimeSyncManager returns the manager responsible for synchronising the
+// system clock with the time servers defined in the plan.
+func (o *Overlord) TimeSyncManager() *timesyncstate.TimeSyncManager {
+	return o.timeMgr
+}
+
+// WatchdogManager returns the manager responsible for petting the hardware
+// watchdogs defined in the plan.
+func (o *Overlord) WatchdogManager() *watchdogstate.WatchdogManager {
+	return o.watchdogMgr
+}
+
+// DeviceManager returns the manager that tracks the readiness of the
+// devices defined in the plan.
+func (o *Overlord) DeviceManager() *devstate.DeviceManager {
+	return o.deviceMgr
+}
+
+// PluginManager returns the manager that connects plugins to the daemon.
+// Extensions may use it to add in-process plugins from ExtraManagers.
+func (o *Overlord) PluginManager() *pluginstate.PluginManager {
+	return o.pluginMgr
+}
+
 // PlanManager returns the plan manager responsible for managing the global
 // system configuration
 func (o *Overlord) PlanManager() *planstate.PlanManager {
@@ -130,6 +130,13 @@ func (ovs *overlordSuite) TestNewWithGoodState(c *C) {
 	data, _ := got["data"].(map[string]interface{})
 	c.Assert(data, NotNil)
 
+	// Startup timings are saved to the state.
+	timings, _ := data["timings"].([]interface{})
+	c.Assert(timings, HasLen, 2)
+	c.Check(timings[0].(map[string]interface{})["tags"], DeepEquals, map[string]interface{}{"startup": "load-state"})
+	c.Check(timings[1].(map[string]interface{})["tags"], DeepEquals, map[string]interface{}{"startup": "load-plan"})
+	delete(data, "timings")
+
 	c.Check(got, DeepEquals, expected)
 }
 
@@ -686,6 +693,87 @@ func (ovs *overlordSuite) TestCheckpoint(c *C) {
 	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
 }
 
+func (ovs *overlordSuite) TestCheckpointDelay(c *C) {
+	o, err := overlord.New(&overlord.Options{
+		PebbleDir:       ovs.dir,
+		CheckpointDelay: time.Hour,
+	})
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+	s.Lock()
+	s.Set("mark", 2)
+	s.Unlock()
+
+	// The checkpoints are deferred, and then written once on Stop.
+	c.Check(osutil.CanStat(ovs.statePath), Equals, false)
+	err = o.StartUp()
+	c.Assert(err, IsNil)
+	o.Loop()
+	err = o.Stop()
+	c.Assert(err, IsNil)
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":2`)
+}
+
+func (ovs *overlordSuite) TestCheckpointDelayElapsed(c *C) {
+	o, err := overlord.New(&overlord.Options{
+		PebbleDir:       ovs.dir,
+		CheckpointDelay: 10 * time.Millisecond,
+	})
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+
+	for i := 0; i < 100 && !osutil.CanStat(ovs.statePath); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
+}
+
+func (ovs *overlordSuite) TestCheckpointDelayForced(c *C) {
+	o, err := overlord.New(&overlord.Options{
+		PebbleDir:       ovs.dir,
+		CheckpointDelay: time.Hour,
+	})
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	s.ForceCheckpoint()
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
+	s.Unlock()
+}
+
+func (ovs *overlordSuite) TestCheckpointDelayRestart(c *C) {
+	rb := &testRestartHandler{}
+	o, err := overlord.New(&overlord.Options{
+		PebbleDir:       ovs.dir,
+		RestartHandler:  rb,
+		CheckpointDelay: time.Hour,
+	})
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	restart.Request(s, restart.RestartSystem)
+
+	// The state is written before the restart is handed off, so the boot
+	// ID it was requested from is known after it, even if the process
+	// exits before the state is unlocked.
+	c.Check(rb.restartRequested, Equals, restart.RestartSystem)
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
+	c.Check(ovs.statePath, testutil.FileContains, `"system-restart-from-boot-id"`)
+	s.Unlock()
+}
+
 type sampleManager struct {
 	ensureCallback func()
 }
@@ -1094,3 +1182,29 @@ func (s *overlordSuite) TestStartOfOperationSetTime(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(operationTime.Equal(prev), Equals, true)
 }
+
+func (ovs *overlordSuite) TestMemoryOnlyNoticeTypes(c *C) {
+	o, err := overlord.New(&overlord.Options{
+		PebbleDir:             ovs.dir,
+		MemoryOnlyNoticeTypes: []state.NoticeType{state.CustomNotice},
+	})
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	s.Lock()
+	_, err = s.AddNotice(nil, state.CustomNotice, "example.com/foo", nil)
+	c.Assert(err, IsNil)
+	s.Set("mark", 1)
+	s.Unlock()
+
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
+	c.Check(ovs.statePath, Not(testutil.FileContains), `example.com/foo`)
+}
+
+func (ovs *overlordSuite) TestMemoryOnlyNoticeTypesInvalid(c *C) {
+	_, err := overlord.New(&overlord.Options{
+		PebbleDir:             ovs.dir,
+		MemoryOnlyNoticeTypes: []state.NoticeType{"Bad"},
+	})
+	c.Check(err, ErrorMatches, `invalid notice type "Bad"`)
+}
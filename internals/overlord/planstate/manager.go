@@ -15,9 +15,19 @@
 package planstate
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 
+	"gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/cmd"
+	"github.com/canonical/pebble/internals/logger"
 	"github.com/canonical/pebble/internals/overlord/state"
 	"github.com/canonical/pebble/internals/plan"
 )
@@ -32,14 +42,63 @@ func (e *LabelExists) Error() string {
 	return fmt.Sprintf("layer %q already exists", e.Label)
 }
 
+// LabelNotFound is the error returned when there's no layer with the
+// requested label.
+type LabelNotFound struct {
+	Label string
+}
+
+func (e *LabelNotFound) Error() string {
+	return fmt.Sprintf("layer %q not found", e.Label)
+}
+
+// OrderExists is the error returned by MoveLayer when another layer already
+// has the requested order.
+type OrderExists struct {
+	Order int
+	Label string
+}
+
+func (e *OrderExists) Error() string {
+	return fmt.Sprintf("layer %q already has order %d", e.Label, e.Order)
+}
+
+// planCacheName is the name of the file in the pebble directory that holds
+// the cached plan, when caching is enabled.
+const planCacheName = ".pebble.plan-cache"
+
+// maxLayerFileOrder is the largest order a layer file's name can hold.
+const maxLayerFileOrder = 999
+
+// BundleLayerOrder is the order of the first layer from a layer bundle
+// applied with SetBundleLayers. Bundle layers always use the orders from
+// here up, so that they're combined after the other layers however often
+// bundles are applied, and other layers must have lower orders.
+const BundleLayerOrder = 1000000
+
 type PlanManager struct {
 	state     *state.State
 	runner    *state.TaskRunner
 	pebbleDir string
 
-	planLock     sync.Mutex
-	plan         *plan.Plan
-	planHandlers []PlanChangedFunc
+	planLock        sync.Mutex
+	plan            *plan.Plan
+	planHash        string
+	planHandlers    []PlanChangedFunc
+	sectionHandlers []SectionsChangedFunc
+
+	// dirLabels holds the labels of the layers read from the layers
+	// directory, so they can be replaced when the directory is reloaded.
+	dirLabels map[string]bool
+	// bundleLabels holds the labels of the layers from the last bundle
+	// applied with SetBundleLayers.
+	bundleLabels map[string]bool
+
+	cachePlan bool
+
+	watchLayers bool
+	watching    bool
+	watchTomb   tomb.Tomb
 }
 
 func NewManager(s *state.State, runner *state.TaskRunner, pebbleDir string) (*PlanManager, error) {
@@ -49,6 +108,7 @@ func NewManager(s *state.State, runner *state.TaskRunner, pebbleDir string) (*Pl
 		pebbleDir: pebbleDir,
 		plan:      &plan.Plan{},
 	}
+	manager.planHash = hashPlan(manager.plan)
 
 	return manager, nil
 }
@@ -56,23 +116,73 @@ func NewManager(s *state.State, runner *state.TaskRunner, pebbleDir string) (*Pl
 // Load reads plan layers from the pebble directory, combines and validates the
 // final plan, and finally notifies registered managers of the plan update. In
 // the case of a non-existent layers directory, or no layers in the layers
-// directory, an empty plan is announced to change subscribers.
+// directory, an empty plan is announced to change subscribers. A set of
+// layer file changes interrupted by a crash or power loss is completed or
+// discarded first.
 func (m *PlanManager) Load() error {
 	m.planLock.Lock()
 	defer m.planLock.Unlock()
-	plan, err := plan.ReadDir(m.pebbleDir)
+	err := plan.RecoverLayersDir(m.layersDir())
+	if err != nil {
+		return err
+	}
+	plan, err := m.readDir()
 	if err != nil {
 		return err
 	}
+	m.dirLabels = make(map[string]bool, len(plan.Layers))
+	for _, layer := range plan.Layers {
+		m.dirLabels[layer.Label] = true
+	}
 	m.planChanged(plan)
 	return nil
 }
 
+// CachePlan enables caching the combined plan read from the layers
+// directory, so that Load can skip reading, combining and validating the
+// layers if nothing the plan depends on has changed since it was cached.
+//
+// It must be called before Load.
+func (m *PlanManager) CachePlan() {
+	m.cachePlan = true
+}
+
+// readDir reads the plan from the layers directory, or from the plan cache
+// if it's enabled and up to date.
+func (m *PlanManager) readDir() (*plan.Plan, error) {
+	if !m.cachePlan {
+		return plan.ReadDir(m.pebbleDir)
+	}
+	cachePath := filepath.Join(m.pebbleDir, planCacheName)
+	key, err := plan.CacheKey(m.pebbleDir, cmd.Version)
+	if err != nil {
+		logger.Noticef("Cannot use plan cache: %v", err)
+		return plan.ReadDir(m.pebbleDir)
+	}
+	cached, err := plan.ReadCache(cachePath, key)
+	if err != nil {
+		logger.Noticef("Cannot use plan cache: %v", err)
+	} else if cached != nil {
+		logger.Debugf("Loaded plan from cache.")
+		return cached, nil
+	}
+	p, err := plan.ReadDir(m.pebbleDir)
+	if err != nil {
+		return nil, err
+	}
+	err = plan.WriteCache(cachePath, key, p)
+	if err != nil {
+		logger.Noticef("Cannot update plan cache: %v", err)
+	}
+	return p, nil
+}
+
 // PlanChangedFunc is the function type used by AddChangeListener.
 type PlanChangedFunc func(p *plan.Plan)
 
 // AddChangeListener adds f to the list of functions that are called whenever
-// a plan change event took place (Load, AppendLayer, CombineLayer). A plan
+// a plan change event took place (Load, AppendLayer, CombineLayer, or a
+// reload of the layers directory when watching is enabled). A plan
 // change event does not guarantee that combined plan content has changed.
 // Notification registration must be completed before the plan is loaded.
 func (m *PlanManager) AddChangeListener(f PlanChangedFunc) {
@@ -81,10 +191,43 @@ func (m *PlanManager) AddChangeListener(f PlanChangedFunc) {
 	m.planHandlers = append(m.planHandlers, f)
 }
 
-func (m *PlanManager) planChanged(plan *plan.Plan) {
-	m.plan = plan
+// SectionsChangedFunc is the function type used by AddSectionsChangeListener.
+// The changed map holds the YAML names of the plan sections (for example
+// "services") that differ from the previous plan.
+type SectionsChangedFunc func(p *plan.Plan, changed map[string]bool)
+
+// AddSectionsChangeListener adds f to the list of functions that are called
+// whenever the content of one or more plan sections has changed, along with
+// the set of changed sections. Unlike AddChangeListener, f isn't called for
+// plan change events that leave the combined plan content unchanged.
+// Notification registration must be completed before the plan is loaded.
+func (m *PlanManager) AddSectionsChangeListener(f SectionsChangedFunc) {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+	m.sectionHandlers = append(m.sectionHandlers, f)
+}
+
+func (m *PlanManager) planChanged(newPlan *plan.Plan) {
+	oldPlan := m.plan
+	m.plan = newPlan
+	m.planHash = hashPlan(newPlan)
 	for _, f := range m.planHandlers {
-		f(plan)
+		f(newPlan)
+	}
+
+	if len(m.sectionHandlers) == 0 {
+		return
+	}
+	changed, err := plan.ChangedSections(oldPlan, newPlan)
+	if err != nil {
+		logger.Noticef("Cannot compare plan sections: %v", err)
+		return
+	}
+	if len(changed) == 0 {
+		return
+	}
+	for _, f := range m.sectionHandlers {
+		f(newPlan, changed)
 	}
 }
 
@@ -98,6 +241,25 @@ func (m *PlanManager) Plan() *plan.Plan {
 	return m.plan
 }
 
+// PlanHash returns a hash of the combined plan's YAML, which changes whenever
+// the plan does. It's computed when the plan changes, so it's cheap to call.
+func (m *PlanManager) PlanHash() string {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+	return m.planHash
+}
+
+// hashPlan returns the SHA-256 hash of the plan's YAML, in hex.
+func hashPlan(p *plan.Plan) string {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		logger.Noticef("Cannot marshal plan to hash it: %v", err)
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 // AppendLayer takes a Layer, appends it to the plan's layers and updates the
 // layer.Order field to the new order. If a layer with layer.Label already
 // exists, return an error of type *LabelExists.
@@ -146,34 +308,404 @@ func (m *PlanManager) CombineLayer(layer *plan.Layer) error {
 	return nil
 }
 
-func (m *PlanManager) appendLayer(layer *plan.Layer) error {
-	newOrder := 1
-	if len(m.plan.Layers) > 0 {
-		last := m.plan.Layers[len(m.plan.Layers)-1]
-		newOrder = last.Order + 1
+// RemoveLayer removes the layer with the given label from the plan, and
+// deletes its file if it was read from the layers directory. If there's no
+// layer with that label, return an error of type *LabelNotFound.
+func (m *PlanManager) RemoveLayer(label string) error {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+
+	index, found := findLayer(m.plan.Layers, label)
+	if index < 0 {
+		return &LabelNotFound{Label: label}
+	}
+	newLayers := make([]*plan.Layer, 0, len(m.plan.Layers)-1)
+	newLayers = append(newLayers, m.plan.Layers[:index]...)
+	newLayers = append(newLayers, m.plan.Layers[index+1:]...)
+	p, err := plan.NewPlan(newLayers)
+	if err != nil {
+		return err
+	}
+	if m.dirLabels[label] {
+		// Otherwise the layer would come back when the directory is next
+		// read.
+		name := fmt.Sprintf("%03d-%s.yaml", found.Order, label)
+		err = plan.WriteLayerFiles(m.layersDir(), map[string][]byte{name: nil})
+		if err != nil {
+			return fmt.Errorf("cannot remove layer %q: %w", label, err)
+		}
+		delete(m.dirLabels, label)
+	}
+	m.planChanged(p)
+	return nil
+}
+
+// MoveLayer changes the order of the layer with the given label, which
+// determines where it's combined relative to the other layers, and renames
+// its file if it was read from the layers directory. If there's no layer
+// with that label, return an error of type *LabelNotFound, and if another
+// layer already has that order, return an error of type *OrderExists.
+func (m *PlanManager) MoveLayer(label string, order int) error {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+
+	index, found := findLayer(m.plan.Layers, label)
+	if index < 0 {
+		return &LabelNotFound{Label: label}
+	}
+	for _, layer := range m.plan.Layers {
+		if layer.Order == order && layer.Label != label {
+			return &OrderExists{Order: order, Label: layer.Label}
+		}
+	}
+
+	// Copy the layer rather than modifying it, as it may be referenced by
+	// a previous plan.
+	moved := *found
+	moved.Order = order
+	newLayers := make([]*plan.Layer, len(m.plan.Layers))
+	copy(newLayers, m.plan.Layers)
+	newLayers[index] = &moved
+	sort.SliceStable(newLayers, func(i, j int) bool {
+		return newLayers[i].Order < newLayers[j].Order
+	})
+	p, err := plan.NewPlan(newLayers)
+	if err != nil {
+		return err
+	}
+	err = m.renameLayerFiles([]renumberedLayer{{
+		label:    label,
+		oldOrder: found.Order,
+		newOrder: order,
+	}})
+	if err != nil {
+		return err
+	}
+	m.planChanged(p)
+	return nil
+}
+
+// LayerPosition specifies where a new layer is added among the plan's
+// layers. If neither field is set, the layer is appended after the others.
+type LayerPosition struct {
+	// Order, if set, is the order to give the new layer. If another layer
+	// already has that order, an error of type *OrderExists is returned.
+	Order *int
+
+	// Before, if set, is the label of the layer to insert the new layer
+	// before. If there's no room between that layer's order and the previous
+	// one, that layer and the ones after it are renumbered, and the files of
+	// any renumbered layers from the layers directory are renamed to match.
+	Before string
+}
+
+// InsertLayer adds the layer to the plan at the given position, and updates
+// the layer.Order field to its new order. If a layer with layer.Label
+// already exists, it's combined into that layer (which keeps its position)
+// if combine is true, and an error of type *LabelExists is returned
+// otherwise.
+func (m *PlanManager) InsertLayer(layer *plan.Layer, pos LayerPosition, combine bool) error {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+
+	change, err := m.layersWithLayer(layer, pos, combine)
+	if err != nil {
+		return err
+	}
+	p, err := plan.NewPlan(change.layers)
+	if err != nil {
+		return err
+	}
+	err = m.renameLayerFiles(change.renumbered)
+	if err != nil {
+		return err
+	}
+	m.planChanged(p)
+	layer.Order = change.order
+	return nil
+}
+
+// ValidateLayer checks whether the layer could be added to the plan, as
+// InsertLayer would do, and that the resulting plan would be valid. The
+// plan itself isn't changed.
+func (m *PlanManager) ValidateLayer(layer *plan.Layer, pos LayerPosition, combine bool) error {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+
+	change, err := m.layersWithLayer(layer, pos, combine)
+	if err != nil {
+		return err
+	}
+	_, err = plan.NewPlan(change.layers)
+	return err
+}
+
+// PlanWithLayer returns the plan that would result from adding the layer, as
+// AppendLayer (or CombineLayer if combine is true) would do, without changing
+// the current plan.
+func (m *PlanManager) PlanWithLayer(layer *plan.Layer, combine bool) (*plan.Plan, error) {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+
+	change, err := m.layersWithLayer(layer, LayerPosition{}, combine)
+	if err != nil {
+		return nil, err
+	}
+	return plan.NewPlan(change.layers)
+}
+
+// layerChange holds the result of adding a layer to the plan's layers.
+type layerChange struct {
+	// layers are the new layers, in order.
+	layers []*plan.Layer
+	// order is the order of the added (or combined) layer.
+	order int
+	// renumbered are the existing layers whose order was changed to make
+	// room for the added layer.
+	renumbered []renumberedLayer
+}
+
+type renumberedLayer struct {
+	label    string
+	oldOrder int
+	newOrder int
+}
+
+// layersWithLayer returns the plan's layers with the given layer added at
+// the given position, or combined into the existing layer with the same
+// label if combine is true. Neither the plan nor the given layer are
+// changed.
+func (m *PlanManager) layersWithLayer(layer *plan.Layer, pos LayerPosition, combine bool) (*layerChange, error) {
+	index, found := findLayer(m.plan.Layers, layer.Label)
+	if index >= 0 {
+		if !combine {
+			return nil, &LabelExists{Label: layer.Label}
+		}
+		combined, err := plan.CombineLayers(found, layer)
+		if err != nil {
+			return nil, err
+		}
+		combined.Order = found.Order
+		combined.Label = found.Label
+		newLayers := make([]*plan.Layer, len(m.plan.Layers))
+		copy(newLayers, m.plan.Layers)
+		newLayers[index] = combined
+		return &layerChange{layers: newLayers, order: found.Order}, nil
+	}
+
+	change := &layerChange{}
+	newLayers := make([]*plan.Layer, 0, len(m.plan.Layers)+1)
+	switch {
+	case pos.Order != nil && pos.Before != "":
+		return nil, fmt.Errorf("cannot specify both order and layer to insert before")
+	case pos.Order != nil:
+		for _, existing := range m.plan.Layers {
+			if existing.Order == *pos.Order {
+				return nil, &OrderExists{Order: *pos.Order, Label: existing.Label}
+			}
+		}
+		change.order = *pos.Order
+		newLayers = append(newLayers, m.plan.Layers...)
+	case pos.Before != "":
+		index, found := findLayer(m.plan.Layers, pos.Before)
+		if index < 0 {
+			return nil, &LabelNotFound{Label: pos.Before}
+		}
+		prevOrder := -1
+		if index > 0 {
+			prevOrder = m.plan.Layers[index-1].Order
+		}
+		newLayers = append(newLayers, m.plan.Layers[:index]...)
+		if found.Order-prevOrder > 1 {
+			change.order = found.Order - 1
+			newLayers = append(newLayers, m.plan.Layers[index:]...)
+			break
+		}
+		// No room, so move the following layers up until there's a gap.
+		// Copy the layers rather than modifying them, as they may be
+		// referenced by a previous plan.
+		change.order = found.Order
+		nextOrder := found.Order + 1
+		for _, existing := range m.plan.Layers[index:] {
+			if existing.Order < nextOrder {
+				moved := *existing
+				moved.Order = nextOrder
+				change.renumbered = append(change.renumbered, renumberedLayer{
+					label:    existing.Label,
+					oldOrder: existing.Order,
+					newOrder: nextOrder,
+				})
+				existing = &moved
+			}
+			newLayers = append(newLayers, existing)
+			nextOrder = existing.Order + 1
+		}
+	default:
+		change.order = m.nextLayerOrder()
+		newLayers = append(newLayers, m.plan.Layers...)
+	}
+
+	added := *layer
+	added.Order = change.order
+	newLayers = append(newLayers, &added)
+	sort.SliceStable(newLayers, func(i, j int) bool {
+		return newLayers[i].Order < newLayers[j].Order
+	})
+	change.layers = newLayers
+	return change, nil
+}
+
+// renameLayerFiles renames the files of the renumbered layers that were read
+// from the layers directory to match their new order, as a single
+// transaction.
+func (m *PlanManager) renameLayerFiles(renumbered []renumberedLayer) error {
+	layersDir := m.layersDir()
+	files := make(map[string][]byte)
+	for _, r := range renumbered {
+		if !m.dirLabels[r.label] {
+			continue
+		}
+		if r.newOrder > maxLayerFileOrder {
+			return fmt.Errorf("cannot renumber layer %q to %d: layer files only support orders up to %d", r.label, r.newOrder, maxLayerFileOrder)
+		}
+		oldName := fmt.Sprintf("%03d-%s.yaml", r.oldOrder, r.label)
+		data, err := os.ReadFile(filepath.Join(layersDir, oldName))
+		if err != nil {
+			return fmt.Errorf("cannot renumber layer %q: %w", r.label, err)
+		}
+		files[oldName] = nil
+		files[fmt.Sprintf("%03d-%s.yaml", r.newOrder, r.label)] = data
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return plan.WriteLayerFiles(layersDir, files)
+}
+
+// PlanAtLayer returns the plan combined from the layers up to and including
+// the layer with the given label, that is, the plan as it was before any
+// later layers were added. If there's no layer with that label, it returns
+// an error of type *LabelNotFound.
+func (m *PlanManager) PlanAtLayer(label string) (*plan.Plan, error) {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+
+	index, _ := findLayer(m.plan.Layers, label)
+	if index < 0 {
+		return nil, &LabelNotFound{Label: label}
+	}
+	return plan.NewPlan(m.plan.Layers[:index+1])
+}
+
+// SetBundleLayers replaces the layers from the previously applied layer
+// bundle, if any, with the given layers, which are given the orders from
+// BundleLayerOrder up, in the given order, so that they come after the
+// other layers. If one of the layers has the same label as a layer that's
+// not from a bundle, return an error of type *LabelExists. If the resulting
+// plan is invalid, the current plan is left unchanged.
+func (m *PlanManager) SetBundleLayers(layers []*plan.Layer) error {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+
+	bundleLabels := make(map[string]bool, len(layers))
+	for _, layer := range layers {
+		bundleLabels[layer.Label] = true
+	}
+	newLayers := make([]*plan.Layer, 0, len(m.plan.Layers)+len(layers))
+	for _, layer := range m.plan.Layers {
+		if m.bundleLabels[layer.Label] {
+			continue
+		}
+		if bundleLabels[layer.Label] {
+			return &LabelExists{Label: layer.Label}
+		}
+		if layer.Order >= BundleLayerOrder {
+			return fmt.Errorf("cannot apply bundle layers: layer %q has order %d, which is reserved for bundle layers", layer.Label, layer.Order)
+		}
+		newLayers = append(newLayers, layer)
+	}
+	for i, layer := range layers {
+		layer.Order = BundleLayerOrder + i
+		newLayers = append(newLayers, layer)
 	}
 
-	newLayers := append(m.plan.Layers, layer)
 	err := m.updatePlanLayers(newLayers)
 	if err != nil {
 		return err
 	}
-	layer.Order = newOrder
+	m.bundleLabels = bundleLabels
 	return nil
 }
 
-func (m *PlanManager) updatePlanLayers(layers []*plan.Layer) error {
-	combined, err := plan.CombineLayers(layers...)
+// ApplyLayerFiles writes a set of layer files to the layers directory as a
+// single transaction, and updates the plan with the new layers from the
+// directory. The files map is keyed by layer filename (for example
+// "001-base.yaml"), and a nil value removes that file. If the resulting
+// plan is invalid, neither the layers directory nor the plan is changed.
+func (m *PlanManager) ApplyLayerFiles(files map[string][]byte) error {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+
+	layersDir := m.layersDir()
+	dirLayers, err := plan.ReadLayersDirWithFiles(layersDir, files)
+	if err != nil {
+		return err
+	}
+	newLayers, dirLabels, err := m.withDirLayers(dirLayers)
 	if err != nil {
 		return err
 	}
-	p := &plan.Plan{
-		Layers:     layers,
-		Services:   combined.Services,
-		Checks:     combined.Checks,
-		LogTargets: combined.LogTargets,
+	p, err := plan.NewPlan(newLayers)
+	if err != nil {
+		return err
 	}
-	err = p.Validate()
+
+	err = plan.WriteLayerFiles(layersDir, files)
+	if err != nil {
+		return err
+	}
+	m.planChanged(p)
+	m.dirLabels = dirLabels
+	return nil
+}
+
+func (m *PlanManager) layersDir() string {
+	return filepath.Join(m.pebbleDir, "layers")
+}
+
+func (m *PlanManager) appendLayer(layer *plan.Layer) error {
+	newOrder := m.nextLayerOrder()
+
+	// Insert the layer before any bundle layers, which come last.
+	index := sort.Search(len(m.plan.Layers), func(i int) bool {
+		return m.plan.Layers[i].Order >= newOrder
+	})
+	newLayers := make([]*plan.Layer, 0, len(m.plan.Layers)+1)
+	newLayers = append(newLayers, m.plan.Layers[:index]...)
+	newLayers = append(newLayers, layer)
+	newLayers = append(newLayers, m.plan.Layers[index:]...)
+	err := m.updatePlanLayers(newLayers)
+	if err != nil {
+		return err
+	}
+	layer.Order = newOrder
+	return nil
+}
+
+// nextLayerOrder returns the order of a layer appended to the plan: one more
+// than the order of the last layer that's not from a bundle.
+func (m *PlanManager) nextLayerOrder() int {
+	for i := len(m.plan.Layers) - 1; i >= 0; i-- {
+		layer := m.plan.Layers[i]
+		if !m.bundleLabels[layer.Label] {
+			return layer.Order + 1
+		}
+	}
+	return 1
+}
+
+func (m *PlanManager) updatePlanLayers(layers []*plan.Layer) error {
+	p, err := plan.NewPlan(layers)
 	if err != nil {
 		return err
 	}
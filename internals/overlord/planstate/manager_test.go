@@ -15,11 +15,19 @@
 package planstate_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
 	. "gopkg.in/check.v1"
 	"gopkg.in/yaml.v3"
 
+	"github.com/canonical/pebble/cmd"
 	"github.com/canonical/pebble/internals/overlord/planstate"
 	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/testutil"
 )
 
 func (ps *planSuite) TestLoadInvalidPebbleDir(c *C) {
@@ -81,6 +89,24 @@ services:
 `[1:])
 }
 
+func (ps *planSuite) TestPlanHash(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	emptyHash := sha256.Sum256([]byte("{}\n"))
+	c.Check(ps.planMgr.PlanHash(), Equals, hex.EncodeToString(emptyHash[:]))
+
+	for _, l := range loadLayers {
+		ps.writeLayer(c, string(reindent(l)))
+	}
+	err = ps.planMgr.Load()
+	c.Assert(err, IsNil)
+	out, err := yaml.Marshal(ps.planMgr.Plan())
+	c.Assert(err, IsNil)
+	hash := sha256.Sum256(out)
+	c.Check(ps.planMgr.PlanHash(), Equals, hex.EncodeToString(hash[:]))
+}
+
 func (ps *planSuite) TestAppendLayers(c *C) {
 	var err error
 	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
@@ -283,6 +309,325 @@ checks:
 	c.Check(err, ErrorMatches, `(?s).*plan check.*must be "alive" or "ready".*`)
 }
 
+func (ps *planSuite) TestValidateLayer(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+
+	layer := ps.parseLayer(c, 0, "label1", `
+services:
+    svc1:
+        override: replace
+        command: /bin/sh
+`)
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+	planYAML := ps.planYAML(c)
+
+	// Layer with an existing label can only be combined.
+	layer = ps.parseLayer(c, 0, "label1", `
+services:
+    svc1:
+        override: merge
+        command: /bin/bash
+`)
+	err = ps.planMgr.ValidateLayer(layer, planstate.LayerPosition{}, false)
+	c.Assert(err.(*planstate.LabelExists).Label, Equals, "label1")
+	err = ps.planMgr.ValidateLayer(layer, planstate.LayerPosition{}, true)
+	c.Assert(err, IsNil)
+
+	// Layer that's valid by itself, but not when combined with the plan.
+	layer = ps.parseLayer(c, 0, "label2", `
+services:
+    svc2:
+        override: replace
+        command: /bin/foo
+        requires:
+            - svc3
+`)
+	err = ps.planMgr.ValidateLayer(layer, planstate.LayerPosition{}, false)
+	c.Assert(err, ErrorMatches, `service "svc3" does not exist`)
+	c.Assert(err, FitsTypeOf, &plan.FormatError{})
+
+	// The plan isn't changed by validation.
+	c.Assert(ps.planYAML(c), Equals, planYAML)
+	ps.planLayersHasLen(c, 1)
+}
+
+func (ps *planSuite) TestPlanAtLayer(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+
+	for i, layerYAML := range loadLayers {
+		layer := ps.parseLayer(c, 0, fmt.Sprintf("label%d", i+1), string(reindent(layerYAML)))
+		err = ps.planMgr.AppendLayer(layer)
+		c.Assert(err, IsNil)
+	}
+
+	p, err := ps.planMgr.PlanAtLayer("label1")
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 1)
+	c.Assert(p.Services, HasLen, 1)
+	c.Assert(p.Services["svc1"], NotNil)
+
+	p, err = ps.planMgr.PlanAtLayer("label2")
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 2)
+	c.Assert(p.Services, HasLen, 2)
+
+	_, err = ps.planMgr.PlanAtLayer("label3")
+	c.Assert(err, ErrorMatches, `layer "label3" not found`)
+	c.Assert(err.(*planstate.LabelNotFound).Label, Equals, "label3")
+}
+
+func (ps *planSuite) TestPlanWithLayer(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	layer := ps.parseLayer(c, 0, "label1", string(reindent(loadLayers[0])))
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	// Appending a new layer.
+	layer = ps.parseLayer(c, 0, "label2", string(reindent(loadLayers[1])))
+	p, err := ps.planMgr.PlanWithLayer(layer, false)
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 2)
+	c.Assert(p.Services, HasLen, 2)
+
+	// Combining into an existing layer.
+	layer = ps.parseLayer(c, 0, "label1", `
+services:
+    svc1:
+        override: merge
+        command: echo changed
+`)
+	p, err = ps.planMgr.PlanWithLayer(layer, true)
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 1)
+	c.Assert(p.Services["svc1"].Command, Equals, "echo changed")
+
+	// The current plan is unchanged.
+	ps.planLayersHasLen(c, 1)
+	c.Assert(ps.planMgr.Plan().Services["svc1"].Command, Equals, "echo svc1")
+}
+
+func (ps *planSuite) TestSectionsChangeListener(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	var changes []map[string]bool
+	ps.planMgr.AddSectionsChangeListener(func(p *plan.Plan, changed map[string]bool) {
+		changes = append(changes, changed)
+	})
+
+	// Loading an empty plan doesn't change any sections.
+	err = ps.planMgr.Load()
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 0)
+
+	layer := ps.parseLayer(c, 0, "label1", `
+services:
+    svc1:
+        override: replace
+        command: echo svc1
+checks:
+    chk1:
+        override: replace
+        exec:
+            command: echo chk1
+`)
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+	c.Assert(changes, DeepEquals, []map[string]bool{{"services": true, "checks": true}})
+
+	// A layer that doesn't change the combined plan isn't announced.
+	layer = ps.parseLayer(c, 0, "label2", `
+services:
+    svc1:
+        override: merge
+        command: echo svc1
+`)
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+
+	layer = ps.parseLayer(c, 0, "label3", `
+checks:
+    chk1:
+        override: merge
+        period: 1m
+`)
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 2)
+	c.Assert(changes[1], DeepEquals, map[string]bool{"checks": true})
+}
+
+func (ps *planSuite) TestRemoveLayer(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	var changed []*plan.Plan
+	ps.planMgr.AddChangeListener(func(p *plan.Plan) {
+		changed = append(changed, p)
+	})
+
+	for _, label := range []string{"label1", "label2", "label3"} {
+		layer := ps.parseLayer(c, 0, label, fmt.Sprintf(`
+services:
+    svc1:
+        override: replace
+        command: echo %s
+`, label))
+		err = ps.planMgr.AppendLayer(layer)
+		c.Assert(err, IsNil)
+	}
+	changed = nil
+
+	err = ps.planMgr.RemoveLayer("label3")
+	c.Assert(err, IsNil)
+	ps.planLayersHasLen(c, 2)
+	c.Assert(ps.planMgr.Plan().Services["svc1"].Command, Equals, "echo label2")
+	c.Assert(changed, HasLen, 1)
+
+	err = ps.planMgr.RemoveLayer("label1")
+	c.Assert(err, IsNil)
+	c.Assert(ps.planMgr.Plan().Layers[0].Label, Equals, "label2")
+	c.Assert(changed, HasLen, 2)
+
+	err = ps.planMgr.RemoveLayer("label1")
+	c.Assert(err, ErrorMatches, `layer "label1" not found`)
+	c.Assert(changed, HasLen, 2)
+
+	// New layers are still appended after the remaining ones.
+	layer := ps.parseLayer(c, 0, "label4", `
+services:
+    svc2:
+        override: replace
+        command: echo svc2
+`)
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+	c.Assert(layer.Order, Equals, 3)
+}
+
+func (ps *planSuite) TestRemoveLayerInvalidPlan(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+
+	layer := ps.parseLayer(c, 0, "label1", `
+services:
+    svc1:
+        override: replace
+        command: echo svc1
+`)
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+	layer = ps.parseLayer(c, 0, "label2", `
+services:
+    svc2:
+        override: replace
+        command: echo svc2
+        requires: [svc1]
+`)
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	// Removing the layer would leave svc2 requiring a non-existent service.
+	err = ps.planMgr.RemoveLayer("label1")
+	c.Assert(err, ErrorMatches, `service "svc1" does not exist`)
+	ps.planLayersHasLen(c, 2)
+}
+
+func (ps *planSuite) TestMoveLayer(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	var changed []*plan.Plan
+	ps.planMgr.AddChangeListener(func(p *plan.Plan) {
+		changed = append(changed, p)
+	})
+
+	var layers []*plan.Layer
+	for _, label := range []string{"label1", "label2"} {
+		layer := ps.parseLayer(c, 0, label, fmt.Sprintf(`
+services:
+    svc1:
+        override: replace
+        command: echo %s
+`, label))
+		err = ps.planMgr.AppendLayer(layer)
+		c.Assert(err, IsNil)
+		layers = append(layers, layer)
+	}
+	changed = nil
+	c.Assert(ps.planMgr.Plan().Services["svc1"].Command, Equals, "echo label2")
+
+	// Moving label2 before label1 means label1 now takes precedence.
+	err = ps.planMgr.MoveLayer("label2", 0)
+	c.Assert(err, IsNil)
+	p := ps.planMgr.Plan()
+	c.Assert(p.Layers, HasLen, 2)
+	c.Assert(p.Layers[0].Label, Equals, "label2")
+	c.Assert(p.Layers[0].Order, Equals, 0)
+	c.Assert(p.Layers[1].Label, Equals, "label1")
+	c.Assert(p.Services["svc1"].Command, Equals, "echo label1")
+	c.Assert(changed, HasLen, 1)
+
+	// The original layer isn't modified.
+	c.Assert(layers[1].Order, Equals, 2)
+
+	err = ps.planMgr.MoveLayer("label2", 1)
+	c.Assert(err, ErrorMatches, `layer "label1" already has order 1`)
+	c.Assert(err.(*planstate.OrderExists).Label, Equals, "label1")
+
+	err = ps.planMgr.MoveLayer("label3", 5)
+	c.Assert(err, ErrorMatches, `layer "label3" not found`)
+	c.Assert(changed, HasLen, 1)
+}
+
+func (ps *planSuite) TestRemoveMoveLayerFiles(c *C) {
+	for _, command := range []string{"one", "two"} {
+		ps.writeLayer(c, fmt.Sprintf(`
+services:
+    svc%[1]s:
+        override: replace
+        command: echo %[1]s
+`, command))
+	}
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.Load()
+	c.Assert(err, IsNil)
+
+	// Moving a layer from the layers directory renames its file.
+	err = ps.planMgr.MoveLayer("layer-file-1", 5)
+	c.Assert(err, IsNil)
+	c.Check(ps.layerLabels(ps.planMgr.Plan()), DeepEquals, []string{"layer-file-2", "layer-file-1"})
+	c.Check(ps.layerFiles(c), DeepEquals, []string{"002-layer-file-2.yaml", "005-layer-file-1.yaml"})
+
+	err = ps.planMgr.MoveLayer("layer-file-1", 1000)
+	c.Assert(err, ErrorMatches, `cannot renumber layer "layer-file-1" to 1000: layer files only support orders up to 999`)
+	c.Check(ps.layerLabels(ps.planMgr.Plan()), DeepEquals, []string{"layer-file-2", "layer-file-1"})
+
+	// Removing one deletes its file.
+	err = ps.planMgr.RemoveLayer("layer-file-2")
+	c.Assert(err, IsNil)
+	c.Check(ps.layerLabels(ps.planMgr.Plan()), DeepEquals, []string{"layer-file-1"})
+	c.Check(ps.layerFiles(c), DeepEquals, []string{"005-layer-file-1.yaml"})
+
+	// So reading the directory again gives the same plan.
+	err = ps.planMgr.ReloadLayers()
+	c.Assert(err, IsNil)
+	p := ps.planMgr.Plan()
+	c.Check(ps.layerLabels(p), DeepEquals, []string{"layer-file-1"})
+	c.Check(p.Layers[0].Order, Equals, 5)
+}
+
 func (ps *planSuite) TestSetServiceArgs(c *C) {
 	var err error
 	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
@@ -324,3 +669,330 @@ services:
         command: foo
 `[1:])
 }
+
+func (ps *planSuite) TestSetBundleLayers(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	layerYAML := func(command string) string {
+		return fmt.Sprintf(`
+services:
+    svc1:
+        override: replace
+        command: %s
+`, command)
+	}
+
+	err = ps.planMgr.AppendLayer(ps.parseLayer(c, 0, "api", layerYAML("echo api")))
+	c.Assert(err, IsNil)
+
+	// Bundle layers are given fixed orders after the existing layers.
+	err = ps.planMgr.SetBundleLayers([]*plan.Layer{
+		ps.parseLayer(c, 10, "bundle1", layerYAML("echo bundle1")),
+		ps.parseLayer(c, 20, "bundle2", layerYAML("echo bundle2")),
+	})
+	c.Assert(err, IsNil)
+	p := ps.planMgr.Plan()
+	c.Check(ps.layerLabels(p), DeepEquals, []string{"api", "bundle1", "bundle2"})
+	c.Check(p.Layers[1].Order, Equals, planstate.BundleLayerOrder)
+	c.Check(p.Layers[2].Order, Equals, planstate.BundleLayerOrder+1)
+	c.Check(p.Services["svc1"].Command, Equals, "echo bundle2")
+
+	// A later layer added through the API still comes before the bundle.
+	later := ps.parseLayer(c, 0, "later", layerYAML("echo later"))
+	err = ps.planMgr.AppendLayer(later)
+	c.Assert(err, IsNil)
+	c.Check(later.Order, Equals, 2)
+	p = ps.planMgr.Plan()
+	c.Check(ps.layerLabels(p), DeepEquals, []string{"api", "later", "bundle1", "bundle2"})
+	c.Check(p.Services["svc1"].Command, Equals, "echo bundle2")
+
+	// A new bundle replaces the layers of the previous one, at the same
+	// orders.
+	err = ps.planMgr.SetBundleLayers([]*plan.Layer{
+		ps.parseLayer(c, 1, "bundle3", layerYAML("echo bundle3")),
+	})
+	c.Assert(err, IsNil)
+	p = ps.planMgr.Plan()
+	c.Check(ps.layerLabels(p), DeepEquals, []string{"api", "later", "bundle3"})
+	c.Check(p.Layers[2].Order, Equals, planstate.BundleLayerOrder)
+	c.Check(p.Services["svc1"].Command, Equals, "echo bundle3")
+
+	// Labels must not clash with layers from elsewhere.
+	err = ps.planMgr.SetBundleLayers([]*plan.Layer{
+		ps.parseLayer(c, 1, "api", layerYAML("echo bundle")),
+	})
+	c.Assert(err, DeepEquals, &planstate.LabelExists{Label: "api"})
+
+	// An invalid plan leaves the current plan unchanged.
+	err = ps.planMgr.SetBundleLayers([]*plan.Layer{
+		ps.parseLayer(c, 1, "bundle4", `
+services:
+    svc2:
+        override: replace
+        command: echo ${PEBBLE_TEST_UNDEFINED_VAR}
+`),
+	})
+	c.Assert(err, ErrorMatches, `.*variable "PEBBLE_TEST_UNDEFINED_VAR" not defined`)
+	c.Check(ps.layerLabels(ps.planMgr.Plan()), DeepEquals, []string{"api", "later", "bundle3"})
+
+	// An empty bundle removes the bundle layers.
+	err = ps.planMgr.SetBundleLayers(nil)
+	c.Assert(err, IsNil)
+	c.Check(ps.layerLabels(ps.planMgr.Plan()), DeepEquals, []string{"api", "later"})
+
+	// Other layers can't use the orders reserved for bundle layers.
+	order := planstate.BundleLayerOrder + 5
+	err = ps.planMgr.InsertLayer(ps.parseLayer(c, 0, "high", layerYAML("echo high")), planstate.LayerPosition{Order: &order}, false)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.SetBundleLayers([]*plan.Layer{
+		ps.parseLayer(c, 1, "bundle5", layerYAML("echo bundle5")),
+	})
+	c.Assert(err, ErrorMatches, `cannot apply bundle layers: layer "high" has order 1000005, which is reserved for bundle layers`)
+}
+
+func (ps *planSuite) TestApplyLayerFiles(c *C) {
+	ps.writeLayer(c, `
+services:
+    svc1:
+        override: replace
+        command: echo one
+`)
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.Load()
+	c.Assert(err, IsNil)
+	err = ps.planMgr.AppendLayer(ps.parseLayer(c, 0, "api", `
+services:
+    svc3:
+        override: replace
+        command: echo api
+`))
+	c.Assert(err, IsNil)
+
+	// Files are added and removed together, and the layers are kept in
+	// order with the API layer.
+	err = ps.planMgr.ApplyLayerFiles(map[string][]byte{
+		"001-layer-file-1.yaml": nil,
+		"001-two.yaml": []byte(`
+services:
+    svc2:
+        override: replace
+        command: echo two
+`),
+	})
+	c.Assert(err, IsNil)
+	p := ps.planMgr.Plan()
+	c.Check(ps.layerLabels(p), DeepEquals, []string{"two", "api"})
+	c.Check(p.Services["svc1"], IsNil)
+	c.Check(p.Services["svc2"].Command, Equals, "echo two")
+	entries, err := os.ReadDir(filepath.Join(ps.pebbleDir, "layers"))
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Check(entries[0].Name(), Equals, "001-two.yaml")
+
+	// An invalid plan leaves both the directory and the plan unchanged.
+	err = ps.planMgr.ApplyLayerFiles(map[string][]byte{
+		"001-two.yaml": nil,
+		"003-three.yaml": []byte(`
+services:
+    svc2:
+        override: replace
+        command: echo ${PEBBLE_TEST_UNDEFINED_VAR}
+`),
+	})
+	c.Assert(err, ErrorMatches, `.*variable "PEBBLE_TEST_UNDEFINED_VAR" not defined`)
+	c.Check(ps.layerLabels(ps.planMgr.Plan()), DeepEquals, []string{"two", "api"})
+	entries, err = os.ReadDir(filepath.Join(ps.pebbleDir, "layers"))
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+
+	// Labels must not clash with layers added through the API.
+	err = ps.planMgr.ApplyLayerFiles(map[string][]byte{
+		"003-api.yaml": []byte("summary: api\n"),
+	})
+	c.Assert(err, DeepEquals, &planstate.LabelExists{Label: "api"})
+}
+
+func (ps *planSuite) TestLoadRecoversLayerFiles(c *C) {
+	ps.writeLayer(c, `
+services:
+    svc1:
+        override: replace
+        command: echo one
+`)
+	layersDir := filepath.Join(ps.pebbleDir, "layers")
+
+	// Simulate a crash after the changes were committed but before they
+	// were all made.
+	err := os.Mkdir(filepath.Join(layersDir, ".pending"), 0700)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(layersDir, ".pending", "002-two.yaml"), []byte(`
+services:
+    svc2:
+        override: replace
+        command: echo two
+`), 0644)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(layersDir, ".journal"),
+		[]byte(`{"write":["002-two.yaml"],"remove":["001-layer-file-1.yaml"]}`), 0600)
+	c.Assert(err, IsNil)
+
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.Load()
+	c.Assert(err, IsNil)
+	p := ps.planMgr.Plan()
+	c.Check(ps.layerLabels(p), DeepEquals, []string{"two"})
+	c.Check(p.Services["svc2"].Command, Equals, "echo two")
+	entries, err := os.ReadDir(layersDir)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Check(entries[0].Name(), Equals, "002-two.yaml")
+}
+
+func (ps *planSuite) TestInsertLayer(c *C) {
+	ps.writeLayer(c, `
+services:
+    svc1:
+        override: replace
+        command: echo file1
+`)
+	ps.writeLayer(c, `
+services:
+    svc1:
+        override: replace
+        command: echo file2
+`)
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.Load()
+	c.Assert(err, IsNil)
+	layerYAML := func(command string) string {
+		return fmt.Sprintf(`
+services:
+    svc1:
+        override: replace
+        command: %s
+`, command)
+	}
+	orders := func() []int {
+		var orders []int
+		for _, layer := range ps.planMgr.Plan().Layers {
+			orders = append(orders, layer.Order)
+		}
+		return orders
+	}
+
+	// There's room before the first layer, so nothing is renumbered.
+	layer := ps.parseLayer(c, 0, "first", layerYAML("echo first"))
+	err = ps.planMgr.InsertLayer(layer, planstate.LayerPosition{Before: "layer-file-1"}, false)
+	c.Assert(err, IsNil)
+	c.Check(layer.Order, Equals, 0)
+	c.Check(ps.layerLabels(ps.planMgr.Plan()), DeepEquals, []string{"first", "layer-file-1", "layer-file-2"})
+	c.Check(orders(), DeepEquals, []int{0, 1, 2})
+
+	// Inserting below a later layer means it takes precedence.
+	layer = ps.parseLayer(c, 0, "api", layerYAML("echo api"))
+	err = ps.planMgr.InsertLayer(layer, planstate.LayerPosition{Before: "layer-file-2"}, false)
+	c.Assert(err, IsNil)
+	c.Check(layer.Order, Equals, 2)
+	p := ps.planMgr.Plan()
+	c.Check(ps.layerLabels(p), DeepEquals, []string{"first", "layer-file-1", "api", "layer-file-2"})
+	c.Check(orders(), DeepEquals, []int{0, 1, 2, 3})
+	c.Check(p.Services["svc1"].Command, Equals, "echo file2")
+
+	// The file of the renumbered layer is renamed to match.
+	entries, err := os.ReadDir(filepath.Join(ps.pebbleDir, "layers"))
+	c.Assert(err, IsNil)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	c.Check(names, DeepEquals, []string{"001-layer-file-1.yaml", "003-layer-file-2.yaml"})
+
+	// An explicit order is used as is.
+	layer = ps.parseLayer(c, 0, "ten", layerYAML("echo ten"))
+	order := 10
+	err = ps.planMgr.InsertLayer(layer, planstate.LayerPosition{Order: &order}, false)
+	c.Assert(err, IsNil)
+	c.Check(ps.planMgr.Plan().Services["svc1"].Command, Equals, "echo ten")
+	c.Check(orders(), DeepEquals, []int{0, 1, 2, 3, 10})
+
+	// Combining with an existing layer keeps its position.
+	layer = ps.parseLayer(c, 0, "first", layerYAML("echo combined"))
+	err = ps.planMgr.InsertLayer(layer, planstate.LayerPosition{Before: "ten"}, true)
+	c.Assert(err, IsNil)
+	c.Check(layer.Order, Equals, 0)
+	c.Check(ps.layerLabels(ps.planMgr.Plan())[0], Equals, "first")
+
+	// Errors leave the plan unchanged.
+	layer = ps.parseLayer(c, 0, "other", layerYAML("echo other"))
+	order = 2
+	err = ps.planMgr.InsertLayer(layer, planstate.LayerPosition{Order: &order}, false)
+	c.Check(err, DeepEquals, &planstate.OrderExists{Order: 2, Label: "api"})
+	err = ps.planMgr.InsertLayer(layer, planstate.LayerPosition{Before: "missing"}, false)
+	c.Check(err, DeepEquals, &planstate.LabelNotFound{Label: "missing"})
+	err = ps.planMgr.InsertLayer(layer, planstate.LayerPosition{Before: "first"}, false)
+	c.Check(err, IsNil)
+	err = ps.planMgr.InsertLayer(layer, planstate.LayerPosition{}, false)
+	c.Check(err, DeepEquals, &planstate.LabelExists{Label: "other"})
+	c.Check(ps.layerLabels(ps.planMgr.Plan()), DeepEquals, []string{"other", "first", "layer-file-1", "api", "layer-file-2", "ten"})
+	c.Check(orders(), DeepEquals, []int{0, 1, 2, 3, 4, 10})
+}
+
+func (ps *planSuite) TestLoadCachedPlan(c *C) {
+	ps.writeLayer(c, `
+services:
+    svc1:
+        override: replace
+        command: echo one
+`)
+	load := func() *plan.Plan {
+		planMgr, err := planstate.NewManager(nil, nil, ps.pebbleDir)
+		c.Assert(err, IsNil)
+		planMgr.CachePlan()
+		err = planMgr.Load()
+		c.Assert(err, IsNil)
+		return planMgr.Plan()
+	}
+
+	// The first load writes the cache.
+	p := load()
+	c.Check(p.Services["svc1"].Command, Equals, "echo one")
+	cachePath := filepath.Join(ps.pebbleDir, ".pebble.plan-cache")
+	c.Assert(cachePath, testutil.FilePresent)
+
+	// Change the cached plan to check that it's used when the layers are
+	// unchanged.
+	key, err := plan.CacheKey(ps.pebbleDir, cmd.Version)
+	c.Assert(err, IsNil)
+	cached, err := plan.ReadCache(cachePath, key)
+	c.Assert(err, IsNil)
+	c.Assert(cached, NotNil)
+	cached.Services["svc1"].Command = "echo cached"
+	err = plan.WriteCache(cachePath, key, cached)
+	c.Assert(err, IsNil)
+	p = load()
+	c.Check(p.Services["svc1"].Command, Equals, "echo cached")
+	c.Check(ps.layerLabels(p), DeepEquals, []string{"layer-file-1"})
+
+	// Changing the layers invalidates the cache.
+	ps.writeLayer(c, `
+services:
+    svc1:
+        override: merge
+        command: echo two
+`)
+	p = load()
+	c.Check(p.Services["svc1"].Command, Equals, "echo two")
+	c.Check(ps.layerLabels(p), DeepEquals, []string{"layer-file-1", "layer-file-2"})
+
+	// An unreadable cache is ignored.
+	err = os.WriteFile(cachePath, []byte("garbage"), 0600)
+	c.Assert(err, IsNil)
+	p = load()
+	c.Check(p.Services["svc1"].Command, Equals, "echo two")
+}
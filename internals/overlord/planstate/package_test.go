@@ -59,6 +59,17 @@ func (ps *planSuite) writeLayer(c *C, layer string) {
 	ps.writeLayerCounter++
 }
 
+// layerFiles returns the names of the layer files in the layers directory.
+func (ps *planSuite) layerFiles(c *C) []string {
+	paths, err := filepath.Glob(filepath.Join(ps.pebbleDir, "layers", "*.yaml"))
+	c.Assert(err, IsNil)
+	var names []string
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+	return names
+}
+
 func (ps *planSuite) parseLayer(c *C, order int, label, layerYAML string) *plan.Layer {
 	layer, err := plan.ParseLayer(order, label, []byte(layerYAML))
 	c.Assert(err, IsNil)
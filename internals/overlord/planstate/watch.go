@@ -0,0 +1,281 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package planstate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// reloadDelay is how long to wait after the last change in the layers
+// directory before reloading, so that a burst of changes (for example, an
+// editor writing a file in several steps) results in a single reload.
+var reloadDelay = 200 * time.Millisecond
+
+const (
+	layersDirEvents = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM |
+		unix.IN_DELETE | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+	pebbleDirEvents = unix.IN_CREATE | unix.IN_MOVED_TO
+)
+
+// WatchLayers enables watching the layers directory for changes once the
+// manager has started up. When layer files are added, changed, or removed,
+// the layers are read again and recombined with any layers added through
+// the API, and the new plan is announced to change listeners.
+//
+// It must be called before StartUp.
+func (m *PlanManager) WatchLayers() {
+	m.watchLayers = true
+}
+
+// StartUp implements StateStarterUp.StartUp.
+func (m *PlanManager) StartUp() error {
+	if !m.watchLayers {
+		return nil
+	}
+	w, err := newLayersWatcher(m.pebbleDir)
+	if err != nil {
+		return fmt.Errorf("cannot watch layers directory: %w", err)
+	}
+	m.watchTomb.Go(func() error {
+		return m.watch(w)
+	})
+	m.watching = true
+	return nil
+}
+
+// Stop implements StateStopper.Stop.
+func (m *PlanManager) Stop() {
+	if !m.watching {
+		return
+	}
+	m.watchTomb.Kill(nil)
+	m.watchTomb.Wait()
+}
+
+func (m *PlanManager) watch(w *layersWatcher) error {
+	m.watchTomb.Go(w.run)
+	defer w.close()
+
+	var timer *time.Timer
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-w.changed:
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(reloadDelay)
+			reload = timer.C
+		case <-reload:
+			timer, reload = nil, nil
+			err := m.reloadLayers()
+			if err != nil {
+				logger.Noticef("Cannot reload layers: %v", err)
+			}
+		case <-m.watchTomb.Dying():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil
+		}
+	}
+}
+
+// reloadLayers reads the layers directory again and replaces the layers
+// that were previously read from it, keeping any layers added through the
+// API after them. If the resulting plan is invalid, the current plan is
+// left unchanged.
+func (m *PlanManager) reloadLayers() error {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+
+	var newLayers []*plan.Layer
+	layersDir := m.layersDir()
+	if _, err := os.Stat(layersDir); err == nil {
+		newLayers, err = plan.ReadLayersDir(layersDir)
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	newLayers, dirLabels, err := m.withDirLayers(newLayers)
+	if err != nil {
+		return err
+	}
+
+	err = m.updatePlanLayers(newLayers)
+	if err != nil {
+		return err
+	}
+	m.dirLabels = dirLabels
+	logger.Noticef("Reloaded layers from %q.", layersDir)
+	return nil
+}
+
+// withDirLayers returns the given layers read from the layers directory,
+// merged with the current layers that weren't read from it and sorted by
+// order, along with the labels of the former.
+func (m *PlanManager) withDirLayers(dirLayers []*plan.Layer) ([]*plan.Layer, map[string]bool, error) {
+	dirLabels := make(map[string]bool, len(dirLayers))
+	orders := make(map[int]bool, len(dirLayers))
+	for _, layer := range dirLayers {
+		dirLabels[layer.Label] = true
+		orders[layer.Order] = true
+	}
+	newLayers := append([]*plan.Layer(nil), dirLayers...)
+	for _, layer := range m.plan.Layers {
+		if m.dirLabels[layer.Label] {
+			continue
+		}
+		if dirLabels[layer.Label] {
+			return nil, nil, &LabelExists{Label: layer.Label}
+		}
+		if orders[layer.Order] {
+			return nil, nil, &OrderExists{Order: layer.Order, Label: layer.Label}
+		}
+		newLayers = append(newLayers, layer)
+	}
+	sort.SliceStable(newLayers, func(i, j int) bool {
+		return newLayers[i].Order < newLayers[j].Order
+	})
+	return newLayers, dirLabels, nil
+}
+
+// layersWatcher uses inotify to watch the layers directory, or the pebble
+// directory while the layers directory doesn't exist.
+type layersWatcher struct {
+	pebbleDir string
+	fd        int
+	file      *os.File
+	dirWatch  int
+	changed   chan struct{}
+}
+
+func newLayersWatcher(pebbleDir string) (*layersWatcher, error) {
+	// A non-blocking inotify descriptor is handled by the runtime poller,
+	// so closing the file interrupts a pending read. Note that calling Fd
+	// on the file would put it back into blocking mode.
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &layersWatcher{
+		pebbleDir: pebbleDir,
+		fd:        fd,
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		dirWatch:  -1,
+		changed:   make(chan struct{}, 1),
+	}
+	_, err = unix.InotifyAddWatch(fd, pebbleDir, pebbleDirEvents)
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	err = w.watchLayersDir()
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// watchLayersDir starts watching the layers directory, if it exists.
+func (w *layersWatcher) watchLayersDir() error {
+	wd, err := unix.InotifyAddWatch(w.fd, filepath.Join(w.pebbleDir, "layers"), layersDirEvents)
+	if errors.Is(err, unix.ENOENT) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.dirWatch = wd
+	return nil
+}
+
+func (w *layersWatcher) close() {
+	w.file.Close()
+}
+
+// run reads inotify events until the watcher is closed, signalling on the
+// changed channel when a layer file (or the layers directory itself) may
+// have changed.
+func (w *layersWatcher) run() error {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if w.handleEvents(buf[:n]) {
+			select {
+			case w.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// handleEvents processes the raw events read from the inotify descriptor,
+// and reports whether any of them affects the layers.
+func (w *layersWatcher) handleEvents(buf []byte) bool {
+	changed := false
+	for len(buf) >= unix.SizeofInotifyEvent {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := unix.SizeofInotifyEvent + int(event.Len)
+		if end > len(buf) {
+			break
+		}
+		name := string(bytes.TrimRight(buf[unix.SizeofInotifyEvent:end], "\x00"))
+		buf = buf[end:]
+
+		switch {
+		case int(event.Wd) == w.dirWatch:
+			if event.Mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0 {
+				changed = true
+			} else if strings.HasSuffix(name, ".yaml") {
+				changed = true
+			}
+			if event.Mask&unix.IN_IGNORED != 0 {
+				w.dirWatch = -1
+			}
+		case name == "layers":
+			// The layers directory was created (or moved into place).
+			err := w.watchLayersDir()
+			if err != nil {
+				logger.Noticef("Cannot watch layers directory: %v", err)
+			}
+			changed = true
+		}
+	}
+	return changed
+}
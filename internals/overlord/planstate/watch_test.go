@@ -0,0 +1,219 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package planstate_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord/planstate"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func (ps *planSuite) layerLabels(p *plan.Plan) []string {
+	var labels []string
+	for _, layer := range p.Layers {
+		labels = append(labels, layer.Label)
+	}
+	return labels
+}
+
+func (ps *planSuite) TestReloadLayers(c *C) {
+	var err error
+	ps.writeLayer(c, string(reindent(`
+	services:
+		svc1:
+			override: replace
+			command: echo file1`)))
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.Load()
+	c.Assert(err, IsNil)
+	var changed []*plan.Plan
+	ps.planMgr.AddChangeListener(func(p *plan.Plan) {
+		changed = append(changed, p)
+	})
+
+	layer := ps.parseLayer(c, 0, "api", `
+services:
+    svc2:
+        override: replace
+        command: echo api
+`)
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+	changed = nil
+
+	// Change the existing file and add a new one.
+	err = os.WriteFile(filepath.Join(ps.pebbleDir, "layers", "001-layer-file-1.yaml"), reindent(`
+	services:
+		svc1:
+			override: replace
+			command: echo changed`), 0644)
+	c.Assert(err, IsNil)
+	// The API layer was given order 2, so the new file comes after it.
+	err = os.WriteFile(filepath.Join(ps.pebbleDir, "layers", "003-layer-file-2.yaml"), reindent(`
+	services:
+		svc3:
+			override: replace
+			command: echo file2`), 0644)
+	c.Assert(err, IsNil)
+
+	err = ps.planMgr.ReloadLayers()
+	c.Assert(err, IsNil)
+	c.Assert(changed, HasLen, 1)
+	p := ps.planMgr.Plan()
+	c.Assert(ps.layerLabels(p), DeepEquals, []string{"layer-file-1", "api", "layer-file-2"})
+	c.Assert(p.Services["svc1"].Command, Equals, "echo changed")
+	c.Assert(p.Services["svc2"].Command, Equals, "echo api")
+	c.Assert(p.Services["svc3"].Command, Equals, "echo file2")
+
+	// Remove a file.
+	err = os.Remove(filepath.Join(ps.pebbleDir, "layers", "003-layer-file-2.yaml"))
+	c.Assert(err, IsNil)
+	err = ps.planMgr.ReloadLayers()
+	c.Assert(err, IsNil)
+	c.Assert(changed, HasLen, 2)
+	p = ps.planMgr.Plan()
+	c.Assert(ps.layerLabels(p), DeepEquals, []string{"layer-file-1", "api"})
+	c.Assert(p.Services["svc3"], IsNil)
+}
+
+func (ps *planSuite) TestReloadLayersErrors(c *C) {
+	var err error
+	ps.writeLayer(c, string(reindent(`
+	services:
+		svc1:
+			override: replace
+			command: echo file1`)))
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.Load()
+	c.Assert(err, IsNil)
+	layer := ps.parseLayer(c, 0, "api", `
+services:
+    svc2:
+        override: replace
+        command: echo api
+        requires: [svc1]
+`)
+	err = ps.planMgr.AppendLayer(layer)
+	c.Assert(err, IsNil)
+	planYAML := ps.planYAML(c)
+
+	// The plan is left unchanged if the new layers are invalid.
+	layerPath := filepath.Join(ps.pebbleDir, "layers", "001-layer-file-1.yaml")
+	err = os.WriteFile(layerPath, []byte("services:\n    svc1:\n        command: foo\n"), 0644)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.ReloadLayers()
+	c.Assert(err, ErrorMatches, `layer "layer-file-1" must define "override" for service "svc1"`)
+	c.Assert(ps.planYAML(c), Equals, planYAML)
+
+	err = os.Remove(layerPath)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.ReloadLayers()
+	c.Assert(err, ErrorMatches, `service "svc1" does not exist`)
+	c.Assert(ps.planYAML(c), Equals, planYAML)
+
+	// A layer file can't use the label of a layer added through the API.
+	err = os.WriteFile(filepath.Join(ps.pebbleDir, "layers", "002-api.yaml"), []byte("summary: x\n"), 0644)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.ReloadLayers()
+	c.Assert(err, ErrorMatches, `layer "api" already exists`)
+	c.Assert(ps.planYAML(c), Equals, planYAML)
+
+	// Nor can it use the order of one.
+	err = os.Rename(filepath.Join(ps.pebbleDir, "layers", "002-api.yaml"), filepath.Join(ps.pebbleDir, "layers", "002-other.yaml"))
+	c.Assert(err, IsNil)
+	err = ps.planMgr.ReloadLayers()
+	c.Assert(err, ErrorMatches, `layer "api" already has order 2`)
+	c.Assert(ps.planYAML(c), Equals, planYAML)
+}
+
+func (ps *planSuite) TestWatchLayers(c *C) {
+	restore := planstate.FakeReloadDelay(10 * time.Millisecond)
+	defer restore()
+
+	// Start without a layers directory, to check it's picked up when it's
+	// created.
+	err := os.Remove(filepath.Join(ps.pebbleDir, "layers"))
+	c.Assert(err, IsNil)
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	changed := make(chan *plan.Plan, 10)
+	ps.planMgr.AddChangeListener(func(p *plan.Plan) {
+		changed <- p
+	})
+	err = ps.planMgr.Load()
+	c.Assert(err, IsNil)
+	<-changed
+
+	ps.planMgr.WatchLayers()
+	err = ps.planMgr.StartUp()
+	c.Assert(err, IsNil)
+	defer ps.planMgr.Stop()
+
+	waitChanged := func() *plan.Plan {
+		select {
+		case p := <-changed:
+			return p
+		case <-time.After(5 * time.Second):
+			c.Fatalf("timed out waiting for plan change")
+		}
+		return nil
+	}
+
+	err = os.Mkdir(filepath.Join(ps.pebbleDir, "layers"), 0755)
+	c.Assert(err, IsNil)
+	p := waitChanged()
+	c.Assert(p.Layers, HasLen, 0)
+
+	ps.writeLayer(c, string(reindent(`
+	services:
+		svc1:
+			override: replace
+			command: echo file1`)))
+	p = waitChanged()
+	c.Assert(ps.layerLabels(p), DeepEquals, []string{"layer-file-1"})
+	c.Assert(p.Services["svc1"].Command, Equals, "echo file1")
+
+	// Files that aren't layers are ignored.
+	err = os.WriteFile(filepath.Join(ps.pebbleDir, "layers", "README"), []byte("x"), 0644)
+	c.Assert(err, IsNil)
+	ps.writeLayer(c, string(reindent(`
+	services:
+		svc2:
+			override: replace
+			command: echo file2`)))
+	p = waitChanged()
+	c.Assert(ps.layerLabels(p), DeepEquals, []string{"layer-file-1", "layer-file-2"})
+	select {
+	case <-changed:
+		c.Fatalf("unexpected plan change")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (ps *planSuite) TestStopWithoutWatching(c *C) {
+	var err error
+	ps.planMgr, err = planstate.NewManager(nil, nil, ps.pebbleDir)
+	c.Assert(err, IsNil)
+	err = ps.planMgr.StartUp()
+	c.Assert(err, IsNil)
+	ps.planMgr.Stop()
+}
@@ -0,0 +1,393 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pluginstate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/canonical/x-go/strutil"
+	"gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+const (
+	runPluginTasksKind = "run-plugin-tasks"
+
+	pluginDataAttr = "plugin-data"
+)
+
+// retryDelay is how long to wait before retrying to send the plan to a
+// plugin, or to run a task, when the plugin can't be connected to.
+var retryDelay = 10 * time.Second
+
+var pluginNameExp = regexp.MustCompile("^[a-z](?:-?[a-z0-9])*$")
+
+// manifest is the content of a plugin's manifest file, which declares an
+// out-of-process plugin.
+type manifest struct {
+	// Socket is the path of the unix socket the plugin serves on.
+	Socket string `yaml:"socket"`
+
+	// Sections are the names of the plan sections the plugin defines.
+	Sections []string `yaml:"sections,omitempty"`
+
+	// TaskKinds are the kinds of the tasks the plugin runs.
+	TaskKinds []string `yaml:"task-kinds,omitempty"`
+}
+
+type pluginInfo struct {
+	name      string
+	plugin    Plugin
+	sections  []string
+	taskKinds []string
+}
+
+// PluginManager connects plugins to the daemon. Plugins define extension
+// sections of the plan, which they validate, are told when the plan
+// changes, and run the tasks of the kinds they declare.
+//
+// Out-of-process plugins are declared by manifests in the "plugins"
+// subdirectory of the pebble directory, named <plugin-name>.yaml. They're
+// called over their unix socket, and may be started after the daemon (for
+// example, as a service): until a plugin can be connected to, plans that
+// use its sections are rejected, and the plan and its tasks are retried
+// periodically.
+type PluginManager struct {
+	state      *state.State
+	runner     *state.TaskRunner
+	ensureDone atomic.Bool
+
+	mu        sync.Mutex
+	plugins   map[string]*pluginInfo
+	taskKinds map[string]string // task kind to plugin name
+	planYAML  []byte
+	// Plugins that haven't been sent the current plan, and whether a
+	// failure to send it has been logged.
+	pending map[string]bool
+	// Plugins that the plan is being sent to.
+	sending map[string]bool
+
+	sends sync.WaitGroup
+}
+
+// NewManager creates a new plugin manager, adding the plugins declared in
+// the pebble directory. It must be called before the plan is loaded, so
+// that the plugins' sections are registered.
+func NewManager(s *state.State, runner *state.TaskRunner, pebbleDir string) (*PluginManager, error) {
+	m := &PluginManager{
+		state:     s,
+		runner:    runner,
+		plugins:   make(map[string]*pluginInfo),
+		taskKinds: make(map[string]string),
+		pending:   make(map[string]bool),
+		sending:   make(map[string]bool),
+	}
+	manifestsDir := filepath.Join(pebbleDir, "plugins")
+	paths, err := filepath.Glob(filepath.Join(manifestsDir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".yaml")
+		manifest, err := readManifest(path)
+		if err != nil {
+			m.Stop()
+			return nil, fmt.Errorf("cannot read plugin %q manifest: %w", name, err)
+		}
+		err = m.AddPlugin(name, &socketPlugin{socket: manifest.Socket}, manifest.Sections, manifest.TaskKinds)
+		if err != nil {
+			m.Stop()
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(&manifest)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Socket == "" {
+		return nil, errors.New(`must define "socket"`)
+	}
+	if !filepath.IsAbs(manifest.Socket) {
+		return nil, fmt.Errorf("socket path %q must be absolute", manifest.Socket)
+	}
+	return &manifest, nil
+}
+
+// AddPlugin adds a plugin that defines the given plan sections and runs
+// tasks of the given kinds. In-process extensions may use it to add a
+// Plugin implemented in Go; it must be called before the plan is loaded.
+func (m *PluginManager) AddPlugin(name string, plugin Plugin, sections, taskKinds []string) error {
+	if !pluginNameExp.MatchString(name) {
+		return fmt.Errorf("invalid plugin name %q", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.plugins[name]; ok {
+		return fmt.Errorf("cannot add plugin %q: it's already added", name)
+	}
+	for _, kind := range taskKinds {
+		if other, ok := m.taskKinds[kind]; ok {
+			return fmt.Errorf("cannot add plugin %q: task kind %q is already run by plugin %q", name, kind, other)
+		}
+		if strutil.ListContains(m.runner.KnownTaskKinds(), kind) {
+			return fmt.Errorf("cannot add plugin %q: task kind %q is a built-in task kind", name, kind)
+		}
+	}
+	for i, section := range sections {
+		err := plan.RegisterSection(section, m.sectionValidator(name, plugin, section))
+		if err != nil {
+			for _, registered := range sections[:i] {
+				plan.UnregisterSection(registered)
+			}
+			return fmt.Errorf("cannot add plugin %q: %w", name, err)
+		}
+	}
+
+	m.plugins[name] = &pluginInfo{
+		name:      name,
+		plugin:    plugin,
+		sections:  sections,
+		taskKinds: taskKinds,
+	}
+	for _, kind := range taskKinds {
+		m.taskKinds[kind] = name
+		m.runner.AddHandler(kind, m.doTask, nil)
+	}
+	if m.planYAML != nil {
+		m.pending[name] = false
+	}
+	return nil
+}
+
+// sectionValidator returns a validator that calls the plugin to validate
+// the section. If the plugin can't be connected to, the section is rejected
+// rather than accepted unvalidated.
+func (m *PluginManager) sectionValidator(name string, plugin Plugin, section string) plan.SectionValidator {
+	return func(items map[string]interface{}) error {
+		err := plugin.ValidateSection(section, items)
+		var unreachable *unreachableError
+		if errors.As(err, &unreachable) {
+			return fmt.Errorf("cannot validate with plugin %q: %w", name, err)
+		}
+		return err
+	}
+}
+
+// PlanChanged handles updates to the plan (server configuration), sending
+// the new plan to the plugins on the next ensure pass.
+func (m *PluginManager) PlanChanged(p *plan.Plan) {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		logger.Noticef("Cannot marshal plan for plugins: %v", err)
+		return
+	}
+
+	m.mu.Lock()
+	m.planYAML = data
+	for name := range m.plugins {
+		m.pending[name] = false
+	}
+	m.mu.Unlock()
+
+	if !m.ensureDone.Load() {
+		// Can't call EnsureBefore before Overlord.Loop is running (which will
+		// call m.Ensure for the first time).
+		return
+	}
+	m.state.EnsureBefore(0)
+}
+
+// Ensure implements StateManager.Ensure. It sends the current plan to the
+// plugins that haven't been sent it, in the background so that a slow
+// plugin doesn't hold up the other managers.
+func (m *PluginManager) Ensure() error {
+	m.ensureDone.Store(true)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name := range m.pending {
+		if m.sending[name] {
+			continue
+		}
+		m.sending[name] = true
+		m.sends.Add(1)
+		go m.sendPlan(m.plugins[name], m.planYAML)
+	}
+	return nil
+}
+
+// sendPlan sends the plan to the plugin and adds the tasks it requests,
+// retrying later if the plugin can't be connected to.
+func (m *PluginManager) sendPlan(info *pluginInfo, data []byte) {
+	defer m.sends.Done()
+
+	tasks, err := info.plugin.PlanChanged(data)
+
+	m.mu.Lock()
+	delete(m.sending, info.name)
+	if !bytes.Equal(m.planYAML, data) {
+		// The plan changed again while it was being sent, so send the
+		// plugin the new one.
+		m.mu.Unlock()
+		m.state.EnsureBefore(0)
+		return
+	}
+	if err != nil {
+		if !m.pending[info.name] {
+			logger.Noticef("Cannot send plan to plugin %q (will retry): %v", info.name, err)
+			m.pending[info.name] = true
+		}
+		m.mu.Unlock()
+		m.state.EnsureBefore(retryDelay)
+		return
+	}
+	delete(m.pending, info.name)
+	m.mu.Unlock()
+
+	err = m.addTasks(info, tasks)
+	if err != nil {
+		logger.Noticef("Cannot run tasks requested by plugin %q: %v", info.name, err)
+	}
+}
+
+// addTasks adds a change with the tasks requested by the plugin, which run
+// one after the other.
+func (m *PluginManager) addTasks(info *pluginInfo, requests []*TaskRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+	for _, req := range requests {
+		if req == nil {
+			return errors.New("plugin requested a null task")
+		}
+		if !strutil.ListContains(info.taskKinds, req.Kind) {
+			return fmt.Errorf("plugin doesn't declare task kind %q", req.Kind)
+		}
+	}
+
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	change := m.state.NewChange(runPluginTasksKind, fmt.Sprintf("Run tasks requested by plugin %q", info.name))
+	var prev *state.Task
+	for _, req := range requests {
+		summary := req.Summary
+		if summary == "" {
+			summary = fmt.Sprintf("Run %s task", req.Kind)
+		}
+		task := m.state.NewTask(req.Kind, summary)
+		if req.Data != nil {
+			task.Set(pluginDataAttr, req.Data)
+		}
+		if prev != nil {
+			task.WaitFor(prev)
+		}
+		change.AddTask(task)
+		prev = task
+	}
+	m.state.EnsureBefore(0) // start new tasks right away
+	return nil
+}
+
+func (m *PluginManager) doTask(task *state.Task, tomb *tomb.Tomb) error {
+	m.state.Lock()
+	req := &TaskRequest{
+		ID:      task.ID(),
+		Kind:    task.Kind(),
+		Summary: task.Summary(),
+	}
+	err := task.Get(pluginDataAttr, &req.Data)
+	m.state.Unlock()
+	if err != nil && !errors.Is(err, state.ErrNoState) {
+		return fmt.Errorf("cannot get data for %s task %q: %v", req.Kind, req.ID, err)
+	}
+
+	m.mu.Lock()
+	info := m.plugins[m.taskKinds[req.Kind]]
+	m.mu.Unlock()
+
+	type result struct {
+		log []string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		log, err := info.plugin.DoTask(req)
+		done <- result{log: log, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		var unreachable *unreachableError
+		if errors.As(r.err, &unreachable) {
+			return &state.Retry{After: retryDelay, Reason: r.err.Error()}
+		}
+		m.state.Lock()
+		for _, msg := range r.log {
+			task.Logf("%s", msg)
+		}
+		m.state.Unlock()
+		if r.err != nil {
+			return fmt.Errorf("plugin %q: %w", info.name, r.err)
+		}
+		return nil
+	case <-tomb.Dying():
+		// The plugin isn't told that the task was aborted, and may still
+		// finish it.
+		return fmt.Errorf("task aborted while plugin %q was running it", info.name)
+	}
+}
+
+// Stop implements StateStopper.Stop. It waits for the plan to be sent to
+// the plugins it's being sent to, and unregisters the plugins' sections.
+func (m *PluginManager) Stop() {
+	m.sends.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, info := range m.plugins {
+		for _, section := range info.sections {
+			plan.UnregisterSection(section)
+		}
+	}
+}
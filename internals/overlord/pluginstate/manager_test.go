@@ -0,0 +1,361 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pluginstate_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord"
+	"github.com/canonical/pebble/internals/overlord/pluginstate"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type ManagerSuite struct {
+	overlord *overlord.Overlord
+	manager  *pluginstate.PluginManager
+	dir      string
+	socket   string
+	listener net.Listener
+	plugin   *fakePlugin
+	restore  func()
+}
+
+var _ = Suite(&ManagerSuite{})
+
+func (s *ManagerSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.socket = filepath.Join(s.dir, "plugin.socket")
+	s.plugin = &fakePlugin{}
+	s.restore = pluginstate.FakeRetryDelay(10 * time.Millisecond)
+}
+
+func (s *ManagerSuite) TearDownTest(c *C) {
+	if s.overlord != nil {
+		s.overlord.Stop()
+		s.overlord = nil
+	}
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	s.restore()
+}
+
+func (s *ManagerSuite) writeManifest(c *C, name, content string) {
+	path := filepath.Join(s.dir, "plugins", name+".yaml")
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(path, []byte(content), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *ManagerSuite) serve(c *C) {
+	l, err := net.Listen("unix", s.socket)
+	c.Assert(err, IsNil)
+	s.listener = l
+	go pluginstate.Serve(l, s.plugin)
+}
+
+func (s *ManagerSuite) startManager(c *C) {
+	s.overlord = overlord.Fake()
+	var err error
+	s.manager, err = pluginstate.NewManager(s.overlord.State(), s.overlord.TaskRunner(), s.dir)
+	c.Assert(err, IsNil)
+	s.overlord.AddManager(s.manager)
+	s.overlord.AddManager(s.overlord.TaskRunner())
+	err = s.overlord.StartUp()
+	c.Assert(err, IsNil)
+	s.overlord.Loop()
+}
+
+func (s *ManagerSuite) waitChange(c *C) *state.Change {
+	st := s.overlord.State()
+	for i := 0; i < 500; i++ {
+		st.Lock()
+		changes := st.Changes()
+		st.Unlock()
+		if len(changes) > 0 {
+			select {
+			case <-changes[len(changes)-1].Ready():
+				return changes[len(changes)-1]
+			case <-time.After(5 * time.Second):
+				c.Fatalf("timed out waiting for change to be ready")
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("timed out waiting for change")
+	return nil
+}
+
+func parsePlan(c *C, layerYAML string) (*plan.Plan, error) {
+	layer, err := plan.ParseLayer(1, "layer", []byte(layerYAML))
+	c.Assert(err, IsNil)
+	return plan.NewPlan([]*plan.Layer{layer})
+}
+
+func (s *ManagerSuite) TestPlugin(c *C) {
+	s.writeManifest(c, "devices", fmt.Sprintf(`
+socket: %s
+sections: [test-devices]
+task-kinds: [flash-device]
+`, s.socket))
+	s.serve(c)
+	s.plugin.tasks = []*pluginstate.TaskRequest{
+		{Kind: "flash-device", Summary: "Flash dev1", Data: map[string]interface{}{"device": "dev1"}},
+		{Kind: "flash-device", Data: map[string]interface{}{"device": "dev2"}},
+	}
+	s.startManager(c)
+
+	// The plugin validates its section.
+	_, err := parsePlan(c, `
+test-devices:
+    dev1: {}
+`)
+	c.Check(err, ErrorMatches, `invalid section "test-devices": device "dev1" must define a path`)
+	p, err := parsePlan(c, `
+test-devices:
+    dev1:
+        path: /dev/a
+`)
+	c.Assert(err, IsNil)
+
+	// The plugin is sent the plan, and runs the tasks it requests.
+	s.manager.PlanChanged(p)
+	change := s.waitChange(c)
+
+	st := s.overlord.State()
+	st.Lock()
+	c.Check(change.Kind(), Equals, "run-plugin-tasks")
+	c.Check(change.Summary(), Equals, `Run tasks requested by plugin "devices"`)
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	tasks := change.Tasks()
+	c.Assert(tasks, HasLen, 2)
+	c.Check(tasks[0].Summary(), Equals, "Flash dev1")
+	c.Check(tasks[1].Summary(), Equals, "Run flash-device task")
+	c.Check(tasks[1].WaitTasks(), DeepEquals, []*state.Task{tasks[0]})
+	log := tasks[0].Log()
+	c.Assert(log, HasLen, 1)
+	c.Check(log[0], Matches, `.* INFO Flashed dev1`)
+	st.Unlock()
+
+	s.plugin.mu.Lock()
+	defer s.plugin.mu.Unlock()
+	c.Assert(s.plugin.plans, HasLen, 1)
+	c.Check(s.plugin.plans[0], Equals, `
+test-devices:
+    dev1:
+        path: /dev/a
+`[1:])
+	c.Check(s.plugin.done, DeepEquals, []string{"dev1", "dev2"})
+}
+
+func (s *ManagerSuite) TestTaskError(c *C) {
+	s.writeManifest(c, "devices", fmt.Sprintf("socket: %s\ntask-kinds: [flash-device]\n", s.socket))
+	s.serve(c)
+	s.plugin.tasks = []*pluginstate.TaskRequest{
+		{Kind: "flash-device", Data: map[string]interface{}{"device": "bad"}},
+	}
+	s.startManager(c)
+
+	s.manager.PlanChanged(&plan.Plan{})
+	change := s.waitChange(c)
+
+	st := s.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(change.Status(), Equals, state.ErrorStatus)
+	c.Check(change.Err(), ErrorMatches, `(?s).*plugin "devices": cannot flash bad.*`)
+}
+
+func (s *ManagerSuite) TestUnreachable(c *C) {
+	s.writeManifest(c, "devices", fmt.Sprintf(`
+socket: %s
+sections: [test-devices]
+task-kinds: [flash-device]
+`, s.socket))
+	s.plugin.tasks = []*pluginstate.TaskRequest{
+		{Kind: "flash-device", Data: map[string]interface{}{"device": "dev1"}},
+	}
+	s.startManager(c)
+
+	// The plugin isn't running, so its section can't be validated.
+	_, err := parsePlan(c, `
+test-devices:
+    dev1: {}
+`)
+	c.Check(err, ErrorMatches, `invalid section "test-devices": cannot validate with plugin "devices": cannot connect to plugin: .*`)
+
+	// The plan is sent when the plugin starts.
+	s.manager.PlanChanged(&plan.Plan{})
+	time.Sleep(50 * time.Millisecond)
+	s.serve(c)
+	change := s.waitChange(c)
+
+	st := s.overlord.State()
+	st.Lock()
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	st.Unlock()
+
+	s.plugin.mu.Lock()
+	defer s.plugin.mu.Unlock()
+	c.Check(s.plugin.plans, HasLen, 1)
+}
+
+func (s *ManagerSuite) TestSlowPlugin(c *C) {
+	s.plugin.sending = make(chan bool, 1)
+	s.plugin.release = make(chan bool)
+	s.startManager(c)
+	err := s.manager.AddPlugin("slow", s.plugin, nil, nil)
+	c.Assert(err, IsNil)
+
+	s.manager.PlanChanged(&plan.Plan{})
+	select {
+	case <-s.plugin.sending:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timed out waiting for plan to be sent")
+	}
+
+	// Ensure doesn't wait for the plugin, or send it the plan again.
+	done := make(chan error)
+	go func() {
+		done <- s.manager.Ensure()
+	}()
+	select {
+	case err := <-done:
+		c.Check(err, IsNil)
+	case <-time.After(time.Second):
+		c.Fatalf("Ensure waited for the plugin")
+	}
+	c.Check(s.plugin.sending, HasLen, 0)
+	close(s.plugin.release)
+}
+
+func (s *ManagerSuite) TestInProcessPlugin(c *C) {
+	s.startManager(c)
+	err := s.manager.AddPlugin("in-process", s.plugin, []string{"test-devices"}, []string{"flash-device"})
+	c.Assert(err, IsNil)
+
+	_, err = parsePlan(c, `
+test-devices:
+    dev1: {}
+`)
+	c.Check(err, ErrorMatches, `invalid section "test-devices": device "dev1" must define a path`)
+
+	err = s.manager.AddPlugin("in-process", s.plugin, nil, nil)
+	c.Check(err, ErrorMatches, `cannot add plugin "in-process": it's already added`)
+	err = s.manager.AddPlugin("other", s.plugin, nil, []string{"flash-device"})
+	c.Check(err, ErrorMatches, `cannot add plugin "other": task kind "flash-device" is already run by plugin "in-process"`)
+	err = s.manager.AddPlugin("other", s.plugin, []string{"test-devices"}, nil)
+	c.Check(err, ErrorMatches, `cannot add plugin "other": cannot register section "test-devices": it's already registered`)
+	err = s.manager.AddPlugin("other", s.plugin, []string{"services"}, nil)
+	c.Check(err, ErrorMatches, `cannot add plugin "other": cannot register section "services": it's a built-in section`)
+	err = s.manager.AddPlugin("Other", s.plugin, nil, nil)
+	c.Check(err, ErrorMatches, `invalid plugin name "Other"`)
+
+	// Stopping the manager unregisters the plugin's sections.
+	s.overlord.Stop()
+	s.overlord = nil
+	_, err = plan.ParseLayer(1, "layer", []byte("test-devices: {}\n"))
+	c.Check(err, ErrorMatches, `unknown section "test-devices"`)
+}
+
+func (s *ManagerSuite) TestBadManifest(c *C) {
+	tests := []struct {
+		manifest string
+		error    string
+	}{{
+		manifest: "sections: [foo]\n",
+		error:    `cannot read plugin "bad" manifest: must define "socket"`,
+	}, {
+		manifest: "socket: plugin.socket\n",
+		error:    `cannot read plugin "bad" manifest: socket path "plugin.socket" must be absolute`,
+	}, {
+		manifest: "socket: /plugin.socket\nsockets: []\n",
+		error:    `(?s)cannot read plugin "bad" manifest: .*field sockets not found.*`,
+	}, {
+		manifest: "socket: /plugin.socket\nsections: [checks]\n",
+		error:    `cannot add plugin "bad": cannot register section "checks": it's a built-in section`,
+	}}
+	for _, test := range tests {
+		s.writeManifest(c, "bad", test.manifest)
+		o := overlord.Fake()
+		_, err := pluginstate.NewManager(o.State(), o.TaskRunner(), s.dir)
+		c.Check(err, ErrorMatches, test.error)
+	}
+}
+
+// fakePlugin is a plugin that validates "test-devices" sections, requests
+// the given tasks when the plan changes, and "flashes" devices. If release
+// is set, it signals sending and waits for release when sent the plan.
+type fakePlugin struct {
+	mu    sync.Mutex
+	tasks []*pluginstate.TaskRequest
+	plans []string
+	done  []string
+
+	sending chan bool
+	release chan bool
+}
+
+func (p *fakePlugin) ValidateSection(section string, items map[string]interface{}) error {
+	if section != "test-devices" {
+		return fmt.Errorf("unexpected section %q", section)
+	}
+	for name, item := range items {
+		fields, _ := item.(map[string]interface{})
+		if fields["path"] == nil {
+			return fmt.Errorf("device %q must define a path", name)
+		}
+	}
+	return nil
+}
+
+func (p *fakePlugin) PlanChanged(planYAML []byte) ([]*pluginstate.TaskRequest, error) {
+	if p.release != nil {
+		p.sending <- true
+		<-p.release
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.plans = append(p.plans, string(planYAML))
+	return p.tasks, nil
+}
+
+func (p *fakePlugin) DoTask(task *pluginstate.TaskRequest) ([]string, error) {
+	device, _ := task.Data["device"].(string)
+	if strings.HasPrefix(device, "bad") {
+		return nil, errors.New("cannot flash " + device)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = append(p.done, device)
+	return []string{"Flashed " + device}, nil
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pluginstate
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"time"
+)
+
+// Plugin is implemented by plugins, which extend the daemon with plan
+// sections and task kinds. A plugin may run in the daemon's process, added
+// with PluginManager.AddPlugin, or in another process that serves it on a
+// unix socket with Serve.
+type Plugin interface {
+	// ValidateSection checks the combined items of one of the plugin's plan
+	// sections, returning an error if they're invalid.
+	ValidateSection(section string, items map[string]interface{}) error
+
+	// PlanChanged is called with the plan, in YAML format, each time it
+	// changes. It may return tasks of the plugin's task kinds, which are
+	// run one after the other in a new change.
+	PlanChanged(planYAML []byte) ([]*TaskRequest, error)
+
+	// DoTask runs a task of one of the plugin's task kinds, returning
+	// messages to add to the task's log.
+	DoTask(task *TaskRequest) (log []string, err error)
+}
+
+// TaskRequest describes a task requested by a plugin, or one being run by
+// a plugin, in which case ID is set.
+type TaskRequest struct {
+	ID      string                 `json:"id,omitempty"`
+	Kind    string                 `json:"kind"`
+	Summary string                 `json:"summary,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// The protocol between the daemon and a plugin process is JSON-RPC 1.0 (as
+// implemented by net/rpc/jsonrpc) over a unix socket, with one connection
+// per call. The methods are Plugin.ValidateSection, Plugin.PlanChanged,
+// and Plugin.DoTask, with the following arguments and replies.
+
+type ValidateSectionArgs struct {
+	Section string                 `json:"section"`
+	Items   map[string]interface{} `json:"items"`
+}
+
+type ValidateSectionReply struct {
+	// Error is the reason the items are invalid, or "" if they're valid.
+	Error string `json:"error,omitempty"`
+}
+
+type PlanChangedArgs struct {
+	Plan string `json:"plan"`
+}
+
+type PlanChangedReply struct {
+	Tasks []*TaskRequest `json:"tasks,omitempty"`
+}
+
+type DoTaskArgs struct {
+	Task *TaskRequest `json:"task"`
+}
+
+type DoTaskReply struct {
+	Log []string `json:"log,omitempty"`
+
+	// Error is the reason the task failed, or "" if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	dialTimeout = time.Second
+	callTimeout = 10 * time.Second
+
+	// validateTimeout is shorter, as sections are validated while the
+	// plan is being updated.
+	validateTimeout = 2 * time.Second
+)
+
+// unreachableError is returned when a plugin's socket can't be connected
+// to, usually because the plugin process isn't running (yet).
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string {
+	return "cannot connect to plugin: " + e.err.Error()
+}
+
+func (e *unreachableError) Unwrap() error {
+	return e.err
+}
+
+// socketPlugin is a Plugin running in another process, which is called
+// over its unix socket.
+type socketPlugin struct {
+	socket string
+}
+
+// call calls the plugin's method, timing out after the given timeout if
+// it's set (DoTask calls may take as long as the task needs).
+func (p *socketPlugin) call(method string, args, reply interface{}, timeout time.Duration) error {
+	conn, err := net.DialTimeout("unix", p.socket, dialTimeout)
+	if err != nil {
+		return &unreachableError{err: err}
+	}
+	client := jsonrpc.NewClient(conn)
+	defer client.Close()
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	return client.Call("Plugin."+method, args, reply)
+}
+
+func (p *socketPlugin) ValidateSection(section string, items map[string]interface{}) error {
+	var reply ValidateSectionReply
+	err := p.call("ValidateSection", &ValidateSectionArgs{Section: section, Items: items}, &reply, validateTimeout)
+	if err != nil {
+		return err
+	}
+	if reply.Error != "" {
+		return errors.New(reply.Error)
+	}
+	return nil
+}
+
+func (p *socketPlugin) PlanChanged(planYAML []byte) ([]*TaskRequest, error) {
+	var reply PlanChangedReply
+	err := p.call("PlanChanged", &PlanChangedArgs{Plan: string(planYAML)}, &reply, callTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Tasks, nil
+}
+
+func (p *socketPlugin) DoTask(task *TaskRequest) ([]string, error) {
+	var reply DoTaskReply
+	err := p.call("DoTask", &DoTaskArgs{Task: task}, &reply, 0)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Error != "" {
+		return reply.Log, errors.New(reply.Error)
+	}
+	return reply.Log, nil
+}
+
+// Serve serves the plugin on the listener, which should be listening on
+// the unix socket named in the plugin's manifest, until Accept fails. It's
+// used by plugin processes written in Go.
+func Serve(l net.Listener, plugin Plugin) error {
+	server := rpc.NewServer()
+	err := server.RegisterName("Plugin", &rpcPlugin{plugin: plugin})
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// rpcPlugin implements the protocol's methods by calling the plugin.
+type rpcPlugin struct {
+	plugin Plugin
+}
+
+func (r *rpcPlugin) ValidateSection(args *ValidateSectionArgs, reply *ValidateSectionReply) error {
+	err := r.plugin.ValidateSection(args.Section, args.Items)
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	return nil
+}
+
+func (r *rpcPlugin) PlanChanged(args *PlanChangedArgs, reply *PlanChangedReply) error {
+	tasks, err := r.plugin.PlanChanged([]byte(args.Plan))
+	if err != nil {
+		return err
+	}
+	reply.Tasks = tasks
+	return nil
+}
+
+func (r *rpcPlugin) DoTask(args *DoTaskArgs, reply *DoTaskReply) error {
+	if args.Task == nil {
+		return errors.New("task must be specified")
+	}
+	log, err := r.plugin.DoTask(args.Task)
+	reply.Log = log
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	return nil
+}
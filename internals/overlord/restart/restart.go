@@ -126,6 +126,8 @@ func Request(st *state.State, t RestartType) {
 		st.Set("system-restart-from-boot-id", rs.bootID)
 	}
 	rs.restarting = t
+	// Make sure the state is on disk before the restart happens.
+	st.ForceCheckpoint()
 	rs.handleRestart(t)
 }
 
@@ -89,3 +89,8 @@ func FakeSetCmdCredential(f func(cmd *exec.Cmd, credential *syscall.Credential))
 		setCmdCredential = old
 	}
 }
+
+var (
+	UnpackImage  = unpackImage
+	SetOCIImages = setOCIImages
+)
@@ -4,22 +4,29 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"os/user"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"golang.org/x/sys/unix"
 	"gopkg.in/tomb.v2"
 
+	"github.com/canonical/pebble/internals/isolation"
 	"github.com/canonical/pebble/internals/logger"
 	"github.com/canonical/pebble/internals/osutil"
+	"github.com/canonical/pebble/internals/osutil/sys"
 	"github.com/canonical/pebble/internals/overlord/restart"
 	"github.com/canonical/pebble/internals/overlord/state"
 	"github.com/canonical/pebble/internals/plan"
 	"github.com/canonical/pebble/internals/reaper"
+	"github.com/canonical/pebble/internals/secrets"
 	"github.com/canonical/pebble/internals/servicelog"
 )
 
@@ -66,6 +73,14 @@ var (
 	// failDelay is the duration given to services for shutting down when Pebble
 	// sends a SIGKILL signal.
 	failDelay = 5 * time.Second
+
+	// requiresTimeoutDefault is how long to wait for a service's
+	// requires-path and requires-port preconditions if the service hasn't
+	// specified its own duration.
+	requiresTimeoutDefault = 30 * time.Second
+
+	// requiresPollInterval is how often the preconditions are checked.
+	requiresPollInterval = 100 * time.Millisecond
 )
 
 const (
@@ -104,6 +119,15 @@ type serviceData struct {
 	resetTimer   *time.Timer
 	restarting   bool
 	currentSince time.Time
+
+	// stopWaiting is closed when the service is stopped before it has
+	// started, to cancel waiting for its preconditions.
+	stopWaiting chan struct{}
+
+	// stdin is the write end of the service's standard input, if its
+	// stdin is a pipe. stdinLock serialises writes to it.
+	stdin     io.WriteCloser
+	stdinLock sync.Mutex
 }
 
 func (m *ServiceManager) doStart(task *state.Task, tomb *tomb.Tomb) error {
@@ -129,6 +153,13 @@ func (m *ServiceManager) doStart(task *state.Task, tomb *tomb.Tomb) error {
 		return nil
 	}
 
+	// Wait for the paths, ports, and devices the service requires, if any.
+	err = m.waitPreconditions(task, config, service.stopWaiting, tomb)
+	if err != nil {
+		m.removeService(config.Name)
+		return err
+	}
+
 	// Start the service and transition to stateStarting.
 	err = service.start()
 	if err != nil {
@@ -161,6 +192,74 @@ func (m *ServiceManager) doStart(task *state.Task, tomb *tomb.Tomb) error {
 	}
 }
 
+// waitPreconditions waits until the service's requires-path entries exist,
+// its requires-port entries accept TCP connections, and its requires-device
+// entries are ready, returning an error if they aren't all met within the
+// service's requires-timeout, or if stopWaiting is closed because the
+// service is stopped. They're only checked when the service is started by a
+// task, not when it's restarted automatically.
+func (m *ServiceManager) waitPreconditions(task *state.Task, config *plan.Service, stopWaiting <-chan struct{}, tomb *tomb.Tomb) error {
+	if len(config.RequiresPath) == 0 && len(config.RequiresPort) == 0 && len(config.RequiresDevice) == 0 {
+		return nil
+	}
+	timeout := requiresTimeoutDefault
+	if config.RequiresTimeout.IsSet {
+		timeout = config.RequiresTimeout.Value
+	}
+	deadline := time.Now().Add(timeout)
+	logged := false
+	for {
+		unmet := m.unmetPreconditions(config)
+		if len(unmet) == 0 {
+			return nil
+		}
+		if !logged {
+			addTaskLog(task, fmt.Sprintf("Waiting for %s", strings.Join(unmet, ", ")))
+			logged = true
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s", timeout, strings.Join(unmet, ", "))
+		}
+		select {
+		case <-time.After(requiresPollInterval):
+		case <-stopWaiting:
+			return fmt.Errorf("service stopped while waiting for %s", strings.Join(unmet, ", "))
+		case <-tomb.Dying():
+			return fmt.Errorf("start aborted while waiting for %s", strings.Join(unmet, ", "))
+		}
+	}
+}
+
+// unmetPreconditions returns descriptions of the service's requires-path,
+// requires-port, and requires-device entries that aren't met yet.
+func (m *ServiceManager) unmetPreconditions(config *plan.Service) []string {
+	var unmet []string
+	for _, path := range config.RequiresPath {
+		if _, err := os.Stat(path); err != nil {
+			unmet = append(unmet, fmt.Sprintf("path %q", path))
+		}
+	}
+	for _, port := range config.RequiresPort {
+		addr, err := plan.PortAddress(port)
+		if err == nil {
+			var conn net.Conn
+			conn, err = net.DialTimeout("tcp", addr, requiresPollInterval)
+			if err == nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			unmet = append(unmet, fmt.Sprintf("port %q", port))
+		}
+	}
+	for _, device := range config.RequiresDevice {
+		if m.devices == nil || !m.devices.DeviceReady(device) {
+			unmet = append(unmet, fmt.Sprintf("device %q", device))
+		}
+	}
+	return unmet
+}
+
 // serviceForStart looks up the service by name in the services map; it
 // creates a new service object if one doesn't exist, returns the existing one
 // if it already exists but is stopped, or returns nil if it already exists
@@ -178,9 +277,11 @@ func (m *ServiceManager) serviceForStart(config *plan.Service) (service *service
 			manager: m,
 			state:   stateInitial,
 			config:  config.Copy(),
-			logs:    servicelog.NewRingBuffer(maxLogBytes),
+			logs:    m.serviceLogBuffer(config.Name),
 			started: make(chan error, 1),
 			stopped: make(chan error, 2), // enough for killTimeElapsed to send, and exit if it happens after
+
+			stopWaiting: make(chan struct{}),
 		}
 		m.services[config.Name] = service
 		return service, ""
@@ -196,6 +297,7 @@ func (m *ServiceManager) serviceForStart(config *plan.Service) (service *service
 		// Start allowed when service is backing off, was stopped, or has exited.
 		service.backoffNum = 0
 		service.backoffTime = 0
+		service.stopWaiting = make(chan struct{})
 		service.transition(stateInitial)
 		return service, ""
 	default:
@@ -267,6 +369,15 @@ func (m *ServiceManager) serviceForStop(name string) (service *serviceData, task
 	}
 
 	switch service.state {
+	case stateInitial:
+		// The start hasn't finished waiting for the service's
+		// preconditions, so cancel it.
+		select {
+		case <-service.stopWaiting:
+		default:
+			close(service.stopWaiting)
+		}
+		return nil, fmt.Sprintf("Service %q stopped before it started.", name)
 	case stateTerminating, stateKilling:
 		return nil, fmt.Sprintf("Service %q already stopping.", name)
 	case stateStopped:
@@ -327,6 +438,11 @@ func (s *serviceData) start() error {
 
 	switch s.state {
 	case stateInitial:
+		select {
+		case <-s.stopWaiting:
+			return errors.New("service stopped before it started")
+		default:
+		}
 		err := s.startInternal()
 		if err != nil {
 			return err
@@ -340,6 +456,103 @@ func (s *serviceData) start() error {
 	return nil
 }
 
+// createDirectories creates the service's directories that don't exist,
+// owned by the directory's user and group if set, otherwise the service's.
+// The mode and owner of existing directories are only updated if they're
+// set explicitly.
+func createDirectories(config *plan.Service, serviceUID, serviceGID *int) error {
+	paths := make([]string, 0, len(config.Directories))
+	for path := range config.Directories {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		dir := config.Directories[path]
+		if dir == nil {
+			dir = &plan.ServiceDirectory{}
+		}
+		mode, err := dir.ParseMode()
+		if err != nil {
+			return fmt.Errorf("cannot create directory %q: %w", path, err)
+		}
+		uid, gid, err := osutil.NormalizeUidGid(dir.UserID, dir.GroupID, dir.User, dir.Group)
+		if err != nil {
+			return fmt.Errorf("cannot create directory %q: %w", path, err)
+		}
+		explicitOwner := uid != nil
+		if !explicitOwner {
+			uid, gid = serviceUID, serviceGID
+		}
+
+		st, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			sysUID, sysGID := sys.UserID(osutil.NoChown), sys.GroupID(osutil.NoChown)
+			if uid != nil && gid != nil {
+				sysUID, sysGID = sys.UserID(*uid), sys.GroupID(*gid)
+			}
+			err = osutil.MkdirAllChown(path, mode, sysUID, sysGID)
+			if err != nil {
+				return fmt.Errorf("cannot create directory %q: %w", path, err)
+			}
+			// Apply the mode exactly, regardless of umask.
+			err = os.Chmod(path, mode)
+		case err != nil:
+			return fmt.Errorf("cannot create directory %q: %w", path, err)
+		case !st.IsDir():
+			return fmt.Errorf("cannot create directory %q: file exists", path)
+		default:
+			if dir.Mode != "" {
+				err = os.Chmod(path, mode)
+			}
+			if err == nil && explicitOwner {
+				err = os.Chown(path, *uid, *gid)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("cannot set up directory %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// injectSecrets reads the secrets the service uses from their backends,
+// adding them to the environment and writing them to files readable only by
+// the service's user. A single trailing newline is removed from a secret's
+// value when it's added to the environment.
+func injectSecrets(secretConfigs map[string]*plan.Secret, config *plan.Service, environment map[string]string, uid, gid *int) error {
+	names := make([]string, 0, len(config.Secrets))
+	for name := range config.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		secretConfig, ok := secretConfigs[name]
+		if !ok {
+			return fmt.Errorf("cannot find secret %q in plan", name)
+		}
+		value, err := secrets.Resolve(secretConfig)
+		if err != nil {
+			return err
+		}
+		secret := config.Secrets[name]
+		if secret.Environment != "" {
+			environment[secret.Environment] = strings.TrimSuffix(string(value), "\n")
+		}
+		if secret.File != "" {
+			sysUID, sysGID := sys.UserID(osutil.NoChown), sys.GroupID(osutil.NoChown)
+			if uid != nil && gid != nil {
+				sysUID, sysGID = sys.UserID(*uid), sys.GroupID(*gid)
+			}
+			err = osutil.AtomicWriteFileChown(secret.File, value, 0o400, 0, sysUID, sysGID)
+			if err != nil {
+				return fmt.Errorf("cannot write secret %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
 func logError(err error) {
 	if err != nil {
 		logger.Noticef("%s", err)
@@ -350,18 +563,25 @@ func logError(err error) {
 // command. It assumes the caller has ensures the service is in a valid state,
 // and it sets s.cmd and other relevant fields.
 func (s *serviceData) startInternal() error {
-	base, extra, err := s.config.ParseCommand()
-	if err != nil {
-		return err
+	var args []string
+	if s.config.Kind == plan.KindOCI {
+		deleteOCIContainer(s.config)
+		args = ociCommand(s.config)
+	} else {
+		base, extra, err := s.config.ParseCommand()
+		if err != nil {
+			return err
+		}
+		args = append(base, extra...)
 	}
-	args := append(base, extra...)
 	s.cmd = exec.Command(args[0], args[1:]...)
 	s.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
-	// Copy environment to avoid updating original.
-	environment := make(map[string]string)
-	for k, v := range s.config.Environment {
-		environment[k] = v
+	// Expand references in the environment, which also copies it to avoid
+	// updating the original.
+	environment, err := plan.ExpandEnvironment(s.config.Environment)
+	if err != nil {
+		return fmt.Errorf("cannot expand service environment: %w", err)
 	}
 
 	s.cmd.Dir = s.config.WorkingDir
@@ -399,12 +619,53 @@ func (s *serviceData) startInternal() error {
 		}
 	}
 
+	err = createDirectories(s.config, uid, gid)
+	if err != nil {
+		return err
+	}
+
+	// Resolve secrets after the environment is expanded, so that "$" in a
+	// secret's value is passed through as is.
+	err = injectSecrets(s.manager.getPlan().Secrets, s.config, environment, uid, gid)
+	if err != nil {
+		return err
+	}
+
 	// Pass service description's environment variables to child process.
 	s.cmd.Env = os.Environ()
 	for k, v := range environment {
 		s.cmd.Env = append(s.cmd.Env, k+"="+v)
 	}
 
+	// Run in new namespaces or with resource limits if requested. This
+	// must be done after the credential is set, as the isolation helper
+	// applies it.
+	if s.config.Isolation != nil || len(s.config.Ulimits) > 0 {
+		var opts isolation.Options
+		if iso := s.config.Isolation; iso != nil {
+			opts.PrivateTmp = iso.PrivateTmp
+			opts.ReadOnlyPaths = iso.ReadOnlyPaths
+			opts.PrivateNetwork = iso.PrivateNetwork
+		}
+		resources := make([]string, 0, len(s.config.Ulimits))
+		for resource := range s.config.Ulimits {
+			resources = append(resources, resource)
+		}
+		sort.Strings(resources)
+		for _, resource := range resources {
+			limit := s.config.Ulimits[resource]
+			opts.Rlimits = append(opts.Rlimits, isolation.Rlimit{
+				Resource: resource,
+				Soft:     limit.Soft,
+				Hard:     limit.Hard,
+			})
+		}
+		err := isolation.Command(s.cmd, &opts)
+		if err != nil {
+			return fmt.Errorf("cannot isolate service: %w", err)
+		}
+	}
+
 	// Set up stdout and stderr to write to log ring buffer.
 	var outputIterator servicelog.Iterator
 	if s.manager.serviceOutput != nil {
@@ -416,6 +677,14 @@ func (s *serviceData) startInternal() error {
 	logWriter := servicelog.NewFormatWriter(s.logs, serviceName)
 	s.cmd.Stdout = logWriter
 	s.cmd.Stderr = logWriter
+	s.stdin = nil
+	if s.config.Stdin == plan.StdinPipe {
+		// The pipe is closed when the service exits (by cmd.Wait).
+		s.stdin, err = s.cmd.StdinPipe()
+		if err != nil {
+			return fmt.Errorf("cannot create service stdin pipe: %w", err)
+		}
+	}
 
 	// Add WaitDelay to ensure cmd.Wait() returns in a reasonable timeframe if
 	// the goroutines that cmd.Start() uses to copy Stdin/Stdout/Stderr are
@@ -433,7 +702,7 @@ func (s *serviceData) startInternal() error {
 	s.cmd.WaitDelay = s.killDelay() * 9 / 10 // will only overflow if kill-delay is 32 years!
 
 	// Start the process!
-	logger.Noticef("Service %q starting: %s", serviceName, s.config.Command)
+	s.log().Noticef("Service %q starting: %s", serviceName, s.config.Command)
 	err = reaper.StartCommand(s.cmd)
 	if err != nil {
 		if outputIterator != nil {
@@ -442,7 +711,7 @@ func (s *serviceData) startInternal() error {
 		_ = s.logs.Close()
 		return fmt.Errorf("cannot start service: %w", err)
 	}
-	logger.Debugf("Service %q started with PID %d", serviceName, s.cmd.Process.Pid)
+	s.log().Debugf("Service %q started with PID %d", serviceName, s.cmd.Process.Pid)
 	s.resetTimer = time.AfterFunc(s.config.BackoffLimit.Value, func() { logError(s.backoffResetElapsed()) })
 
 	// Start a goroutine to wait for the process to finish.
@@ -451,9 +720,9 @@ func (s *serviceData) startInternal() error {
 	go func() {
 		exitCode, waitErr := reaper.WaitCommand(cmd)
 		if waitErr != nil {
-			logger.Noticef("Cannot wait for service %q: %v", serviceName, waitErr)
+			s.log().Noticef("Cannot wait for service %q: %v", serviceName, waitErr)
 		} else {
-			logger.Debugf("Service %q exited with code %d.", serviceName, exitCode)
+			s.log().Debugf("Service %q exited with code %d.", serviceName, exitCode)
 		}
 		close(done)
 		err := s.exited(exitCode)
@@ -514,7 +783,7 @@ func (s *serviceData) exited(exitCode int) error {
 		s.transition(stateExited) // not strictly necessary as doStart will return, but doesn't hurt
 
 	case stateRunning:
-		logger.Noticef("Service %q stopped unexpectedly with code %d", s.config.Name, exitCode)
+		s.log().Noticef("Service %q stopped unexpectedly with code %d", s.config.Name, exitCode)
 		action, onType := getAction(s.config, exitCode == 0)
 		switch action {
 		case plan.ActionIgnore:
@@ -557,10 +826,10 @@ func (s *serviceData) exited(exitCode int) error {
 
 	case stateTerminating, stateKilling:
 		if s.restarting {
-			logger.Noticef("Service %q exited after check failure, restarting", s.config.Name)
+			s.log().Noticef("Service %q exited after check failure, restarting", s.config.Name)
 			s.doBackoff(plan.ActionRestart, "on-check-failure")
 		} else {
-			logger.Noticef("Service %q stopped", s.config.Name)
+			s.log().Noticef("Service %q stopped", s.config.Name)
 			s.stopped <- nil
 			s.transition(stateStopped)
 		}
@@ -587,10 +856,15 @@ func addLastLogs(task *state.Task, logBuffer *servicelog.RingBuffer) {
 	}
 }
 
+// log returns a logger that includes the service name in structured output.
+func (s *serviceData) log() logger.FieldLogger {
+	return logger.WithFields(logger.Fields{Component: "servstate", Service: s.config.Name})
+}
+
 func (s *serviceData) doBackoff(action plan.ServiceAction, onType string) {
 	s.backoffNum++
 	s.backoffTime = calculateNextBackoff(s.config, s.backoffTime)
-	logger.Noticef("Service %q %s action is %q, waiting ~%s before restart (backoff %d)",
+	s.log().Noticef("Service %q %s action is %q, waiting ~%s before restart (backoff %d)",
 		s.config.Name, onType, action, s.backoffTime, s.backoffNum)
 	s.transition(stateBackoff)
 	duration := s.backoffTime + s.manager.getJitter(s.backoffTime)
@@ -716,6 +990,9 @@ func (s *serviceData) backoffTimeElapsed() error {
 			return err
 		}
 		s.transition(stateRunning)
+		// Restart dependents outside the services lock, as that creates a
+		// change (which takes the state lock) and checks their states.
+		go s.manager.serviceRestarted(s.config.Name)
 
 	default:
 		// Ignore if timer elapsed in any other state.
@@ -794,14 +1071,16 @@ func (s *serviceData) backoffResetElapsed() error {
 	return nil
 }
 
-// checkFailed handles a health check failure (from the check manager).
-func (s *serviceData) checkFailed(action plan.ServiceAction) {
+// checkFailed handles a health check failure (from the check manager). It
+// reports whether the action was taken.
+func (s *serviceData) checkFailed(action plan.ServiceAction) bool {
 	switch s.state {
 	case stateRunning, stateBackoff, stateExited:
 		onType := "on-check-failure"
 		switch action {
 		case plan.ActionIgnore:
 			logger.Debugf("Service %q %s action is %q, remaining in current state", s.config.Name, onType, action)
+			return false
 
 		case plan.ActionShutdown:
 			logger.Noticef("Service %q %s action is %q, triggering failure shutdown", s.config.Name, onType, action)
@@ -825,7 +1104,7 @@ func (s *serviceData) checkFailed(action plan.ServiceAction) {
 			case stateBackoff:
 				logger.Noticef("Service %q %s action is %q, waiting for current backoff",
 					s.config.Name, onType, action)
-				return
+				return false
 			case stateExited:
 				s.doBackoff(action, onType)
 			}
@@ -833,11 +1112,14 @@ func (s *serviceData) checkFailed(action plan.ServiceAction) {
 		default:
 			logger.Noticef("Internal error: unexpected action %q handling check failure for service %q",
 				action, s.config.Name)
+			return false
 		}
+		return true
 
 	default:
 		logger.Debugf("Service %q: ignoring on-check-failure action %q in state %s",
 			s.config.Name, action, s.state)
+		return false
 	}
 }
 
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package servstate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/servicelog"
+)
+
+const persistedLogSuffix = ".log"
+
+// PersistLogs keeps each service's log buffer in a file in dir, so that
+// the logs survive a restart of the daemon. Buffers left by a previous run
+// are opened straight away, so their logs are available before the
+// services are started again.
+//
+// It must be called before any services are started.
+func (m *ServiceManager) PersistLogs(dir string) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	m.servicesLock.Lock()
+	defer m.servicesLock.Unlock()
+	m.logsDir = dir
+	m.persistedLogs = make(map[string]*servicelog.RingBuffer)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), persistedLogSuffix)
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		m.openPersistedLogs(name)
+	}
+	return nil
+}
+
+// serviceLogBuffer returns the log buffer for a service being started for
+// the first time. The caller must hold servicesLock.
+func (m *ServiceManager) serviceLogBuffer(name string) *servicelog.RingBuffer {
+	if m.logsDir == "" {
+		return servicelog.NewRingBuffer(maxLogBytes)
+	}
+	buffer := m.persistedLogs[name]
+	if buffer == nil || buffer.Closed() {
+		buffer = m.openPersistedLogs(name)
+	}
+	if buffer == nil {
+		// The error has been logged; keep the logs in memory instead.
+		return servicelog.NewRingBuffer(maxLogBytes)
+	}
+	return buffer
+}
+
+// openPersistedLogs opens the file-backed log buffer for the named service
+// and records it in persistedLogs, or returns nil if it can't be opened.
+// The caller must hold servicesLock.
+func (m *ServiceManager) openPersistedLogs(name string) *servicelog.RingBuffer {
+	path := filepath.Join(m.logsDir, name+persistedLogSuffix)
+	buffer, err := servicelog.OpenFileRingBuffer(path, maxLogBytes)
+	if err != nil {
+		logger.Noticef("Cannot open log buffer for service %q: %v", name, err)
+		return nil
+	}
+	m.persistedLogs[name] = buffer
+	return buffer
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package servstate
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// MaintenanceNotice is recorded when the daemon enters or leaves maintenance
+// mode. The key is "enter" or "exit".
+const MaintenanceNotice state.NoticeType = "maintenance"
+
+func init() {
+	err := state.RegisterNoticeType(MaintenanceNotice)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// maintenanceStateKey is the key under which maintenance mode details are
+// stored in the state, so that maintenance mode survives restarts.
+const maintenanceStateKey = "maintenance"
+
+var (
+	ErrInMaintenance    = errors.New("already in maintenance mode")
+	ErrNotInMaintenance = errors.New("not in maintenance mode")
+)
+
+// Maintenance holds the details of maintenance mode.
+type Maintenance struct {
+	// Since is the time maintenance mode was entered.
+	Since time.Time `json:"since"`
+
+	// Services are the services that were stopped when entering maintenance
+	// mode, in stop order. They're started again when it's exited.
+	Services []string `json:"services,omitempty"`
+}
+
+// GetMaintenance returns the details of maintenance mode, or nil if the
+// daemon isn't in maintenance mode. The state lock must be held.
+func GetMaintenance(st *state.State) (*Maintenance, error) {
+	var maintenance Maintenance
+	err := st.Get(maintenanceStateKey, &maintenance)
+	if errors.Is(err, state.ErrNoState) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &maintenance, nil
+}
+
+// InMaintenance reports whether the daemon is in maintenance mode.
+func (m *ServiceManager) InMaintenance() bool {
+	return m.maintenance.Load()
+}
+
+// loadMaintenance restores the maintenance mode flag from the state.
+func (m *ServiceManager) loadMaintenance() error {
+	m.state.Lock()
+	defer m.state.Unlock()
+	maintenance, err := GetMaintenance(m.state)
+	if err != nil {
+		return err
+	}
+	m.maintenance.Store(maintenance != nil)
+	return nil
+}
+
+// EnterMaintenance puts the daemon in maintenance mode, in which
+// on-check-failure actions are ignored, and returns a task set to stop the
+// given services (together with their dependents) that are running. If no
+// services are given, the running services that aren't started by default
+// ("startup: disabled") are stopped. The state lock must be held.
+func (m *ServiceManager) EnterMaintenance(services []string) (*state.TaskSet, []string, error) {
+	maintenance, err := GetMaintenance(m.state)
+	if err != nil {
+		return nil, nil, err
+	}
+	if maintenance != nil {
+		return nil, nil, ErrInMaintenance
+	}
+
+	if len(services) == 0 {
+		for name, service := range m.getPlan().Services {
+			if service.Startup != plan.StartupEnabled {
+				services = append(services, name)
+			}
+		}
+	}
+	stop, err := m.StopOrder(services)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Only stop (and later start) the services that are running.
+	stop = m.runningServices(stop)
+
+	taskSet, err := Stop(m.state, stop)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.state.Set(maintenanceStateKey, &Maintenance{
+		Since:    time.Now(),
+		Services: stop,
+	})
+	m.maintenance.Store(true)
+	m.addMaintenanceNotice("enter", stop)
+	logger.Noticef("Entered maintenance mode, stopping %d services", len(stop))
+	return taskSet, stop, nil
+}
+
+// ExitMaintenance takes the daemon out of maintenance mode and returns a
+// task set to start the services that were stopped when entering it, and
+// which are still in the plan. The state lock must be held.
+func (m *ServiceManager) ExitMaintenance() (*state.TaskSet, []string, error) {
+	maintenance, err := GetMaintenance(m.state)
+	if err != nil {
+		return nil, nil, err
+	}
+	if maintenance == nil {
+		return nil, nil, ErrNotInMaintenance
+	}
+
+	currentPlan := m.getPlan()
+	var services []string
+	for _, name := range maintenance.Services {
+		if _, ok := currentPlan.Services[name]; ok {
+			services = append(services, name)
+		}
+	}
+	start, err := m.StartOrder(services)
+	if err != nil {
+		return nil, nil, err
+	}
+	taskSet, err := Start(m.state, start)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.state.Set(maintenanceStateKey, nil)
+	m.maintenance.Store(false)
+	m.addMaintenanceNotice("exit", start)
+	logger.Noticef("Exited maintenance mode, starting %d services", len(start))
+	return taskSet, start, nil
+}
+
+func (m *ServiceManager) addMaintenanceNotice(key string, services []string) {
+	options := &state.AddNoticeOptions{}
+	if len(services) > 0 {
+		options.Data = map[string]string{"services": strings.Join(services, ",")}
+	}
+	_, err := m.state.AddNotice(nil, MaintenanceNotice, key, options)
+	if err != nil {
+		logger.Noticef("Cannot record maintenance notice: %v", err)
+	}
+}
@@ -7,14 +7,29 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/canonical/x-go/strutil"
+
+	"github.com/canonical/pebble/internals/logger"
 	"github.com/canonical/pebble/internals/overlord/restart"
 	"github.com/canonical/pebble/internals/overlord/state"
 	"github.com/canonical/pebble/internals/plan"
 	"github.com/canonical/pebble/internals/servicelog"
 )
 
+// CheckFailureNotice is recorded when a health check failure triggers an
+// on-check-failure action for a service. The key is the service's name.
+const CheckFailureNotice state.NoticeType = "service-check-failure"
+
+func init() {
+	err := state.RegisterNoticeType(CheckFailureNotice)
+	if err != nil {
+		panic(err)
+	}
+}
+
 type ServiceManager struct {
 	state *state.State
 
@@ -24,6 +39,12 @@ type ServiceManager struct {
 	servicesLock sync.Mutex
 	services     map[string]*serviceData
 
+	// logsDir is set if service logs are persisted; see PersistLogs.
+	// persistedLogs holds the log buffers opened from it, including those
+	// of services that haven't been started since the daemon started.
+	logsDir       string
+	persistedLogs map[string]*servicelog.RingBuffer
+
 	serviceOutput io.Writer
 	restarter     Restarter
 
@@ -31,12 +52,25 @@ type ServiceManager struct {
 	rand     *rand.Rand
 
 	logMgr LogManager
+
+	// devices is set if the daemon tracks devices; see SetDeviceManager.
+	devices DeviceManager
+
+	// maintenance is set while the daemon is in maintenance mode; see
+	// EnterMaintenance.
+	maintenance atomic.Bool
 }
 
 type LogManager interface {
 	ServiceStarted(service *plan.Service, logs *servicelog.RingBuffer)
 }
 
+// DeviceManager is the interface the service manager uses to find out
+// whether the devices that services require are ready.
+type DeviceManager interface {
+	DeviceReady(name string) bool
+}
+
 type Restarter interface {
 	HandleRestart(t restart.RestartType)
 }
@@ -51,14 +85,31 @@ func NewManager(s *state.State, runner *state.TaskRunner, serviceOutput io.Write
 		logMgr:        logMgr,
 	}
 
+	err := manager.loadMaintenance()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load maintenance mode: %w", err)
+	}
+
 	runner.AddHandler("start", manager.doStart, nil)
 	runner.AddHandler("stop", manager.doStop, nil)
+	runner.AddHandler(unpackImageKind, manager.doUnpackImage, nil)
 
 	return manager, nil
 }
 
+// SetDeviceManager sets the manager used to find out whether the devices
+// in services' requires-device lists are ready. It must be called before
+// the manager is started.
+func (m *ServiceManager) SetDeviceManager(devices DeviceManager) {
+	m.devices = devices
+}
+
 // PlanChanged informs the service manager that the plan has been updated.
 func (m *ServiceManager) PlanChanged(plan *plan.Plan) {
+	m.state.Lock()
+	setOCIImages(m.state, plan)
+	m.state.Unlock()
+
 	m.planLock.Lock()
 	defer m.planLock.Unlock()
 	m.plan = plan
@@ -233,18 +284,25 @@ func (m *ServiceManager) ServiceLogs(services []string, last int) (map[string]se
 	m.servicesLock.Lock()
 	defer m.servicesLock.Unlock()
 
-	iterators := make(map[string]servicelog.Iterator)
+	buffers := make(map[string]*servicelog.RingBuffer)
+	for name, buffer := range m.persistedLogs {
+		buffers[name] = buffer
+	}
 	for name, service := range m.services {
-		if !requested[name] {
-			continue
+		if service != nil && service.logs != nil {
+			buffers[name] = service.logs
 		}
-		if service == nil || service.logs == nil {
+	}
+
+	iterators := make(map[string]servicelog.Iterator)
+	for name, buffer := range buffers {
+		if !requested[name] {
 			continue
 		}
 		if last >= 0 {
-			iterators[name] = service.logs.HeadIterator(last)
+			iterators[name] = buffer.HeadIterator(last)
 		} else {
-			iterators[name] = service.logs.TailIterator()
+			iterators[name] = buffer.TailIterator()
 		}
 	}
 
@@ -319,20 +377,166 @@ func (m *ServiceManager) SendSignal(services []string, signal string) error {
 	return nil
 }
 
+// WriteStdin copies data to the standard input of the named service, which
+// must be running with "stdin: pipe".
+func (m *ServiceManager) WriteStdin(name string, data io.Reader) error {
+	m.servicesLock.Lock()
+	s := m.services[name]
+	if s == nil || (s.state != stateStarting && s.state != stateRunning) {
+		m.servicesLock.Unlock()
+		return fmt.Errorf("service %q is not running", name)
+	}
+	stdin := s.stdin
+	m.servicesLock.Unlock()
+	if stdin == nil {
+		return fmt.Errorf("service %q stdin is not a pipe", name)
+	}
+
+	// Don't hold the services lock while writing, as the write blocks if
+	// the service isn't reading its input.
+	s.stdinLock.Lock()
+	defer s.stdinLock.Unlock()
+	_, err := io.Copy(stdin, data)
+	if err != nil {
+		return fmt.Errorf("cannot write to service %q stdin: %w", name, err)
+	}
+	return nil
+}
+
 // CheckFailed response to a health check failure. If the given check name is
 // in the on-check-failure map for a service, tell the service to perform the
-// configured action (for example, "restart").
-func (m *ServiceManager) CheckFailed(name string) {
-	m.servicesLock.Lock()
-	defer m.servicesLock.Unlock()
+// configured action (for example, "restart"), and record a notice naming the
+// check and its failure so the action can be traced later. Check failures are
+// ignored in maintenance mode.
+func (m *ServiceManager) CheckFailed(name string, failure error) {
+	type actioned struct {
+		service string
+		action  plan.ServiceAction
+	}
+	var actions []actioned
 
+	if m.InMaintenance() {
+		logger.Noticef("Check %q failed in maintenance mode, ignoring on-check-failure actions", name)
+		return
+	}
+
+	m.servicesLock.Lock()
 	for _, service := range m.services {
 		for checkName, action := range service.config.OnCheckFailure {
-			if checkName == name {
-				service.checkFailed(action)
+			if checkName == name && service.checkFailed(action) {
+				actions = append(actions, actioned{service.config.Name, action})
 			}
 		}
 	}
+	m.servicesLock.Unlock()
+	if len(actions) == 0 {
+		return
+	}
+
+	m.state.Lock()
+	defer m.state.Unlock()
+	for _, a := range actions {
+		data := map[string]string{
+			"check":  name,
+			"action": string(a.action),
+		}
+		if failure != nil {
+			data["error"] = failure.Error()
+		}
+		_, err := m.state.AddNotice(nil, CheckFailureNotice, a.service, &state.AddNoticeOptions{Data: data})
+		if err != nil {
+			logger.Noticef("Cannot record service %q check failure notice: %v", a.service, err)
+		}
+	}
+}
+
+// CheckRecovered responds to a health check recovering by restarting the
+// given services (from the check's on-recovery configuration) in a new
+// change. Services that aren't running are left alone.
+func (m *ServiceManager) CheckRecovered(name string, services []string) {
+	running := m.runningServices(services)
+	if len(running) == 0 {
+		return
+	}
+	logger.Noticef("Check %q recovered, restarting %s", name, strutil.Quoted(running))
+	summary := fmt.Sprintf("Restart %s after check %q recovered", strutil.Quoted(running), name)
+	err := m.restartServices(running, summary)
+	if err != nil {
+		logger.Noticef("Cannot restart services after check %q recovered: %v", name, err)
+	}
+}
+
+// RestartWith returns the running services that must be restarted along
+// with the given services, because they list them in restart-with.
+func (m *ServiceManager) RestartWith(services []string) []string {
+	return m.runningServices(m.getPlan().RestartWith(services))
+}
+
+// serviceRestarted is called after a service has been automatically
+// restarted, to restart the services that list it in restart-with.
+func (m *ServiceManager) serviceRestarted(name string) {
+	dependents := m.RestartWith([]string{name})
+	if len(dependents) == 0 {
+		return
+	}
+	logger.Noticef("Service %q restarted, restarting %s", name, strutil.Quoted(dependents))
+	summary := fmt.Sprintf("Restart %s after service %q restarted", strutil.Quoted(dependents), name)
+	err := m.restartServices(dependents, summary)
+	if err != nil {
+		logger.Noticef("Cannot restart services after service %q restarted: %v", name, err)
+	}
+}
+
+// runningServices returns the given services that are currently running,
+// without duplicates.
+func (m *ServiceManager) runningServices(services []string) []string {
+	m.servicesLock.Lock()
+	defer m.servicesLock.Unlock()
+	var running []string
+	for _, service := range services {
+		s := m.services[service]
+		if s != nil && s.state == stateRunning && !strutil.ListContains(running, service) {
+			running = append(running, service)
+		}
+	}
+	return running
+}
+
+// restartServices stops and then starts the given services, in dependency
+// order, in a new change with the given summary.
+func (m *ServiceManager) restartServices(services []string, summary string) error {
+	stop, err := m.StopOrder(services)
+	if err != nil {
+		return err
+	}
+	var stopNames []string
+	for _, service := range stop {
+		if strutil.ListContains(services, service) {
+			stopNames = append(stopNames, service)
+		}
+	}
+	startNames, err := m.StartOrder(services)
+	if err != nil {
+		return err
+	}
+
+	m.state.Lock()
+	defer m.state.Unlock()
+	stopTasks, err := Stop(m.state, stopNames)
+	if err != nil {
+		return err
+	}
+	startTasks, err := Start(m.state, startNames)
+	if err != nil {
+		return err
+	}
+	startTasks.WaitAll(stopTasks)
+	change := m.state.NewChange("restart", summary)
+	change.AddAll(stopTasks)
+	change.AddAll(startTasks)
+	change.Set("service-names", services)
+	m.state.EnsureBefore(0)
+	return nil
 }
 
 // servicesToStop is used during service manager shutdown to cleanly terminate
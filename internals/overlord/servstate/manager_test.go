@@ -16,8 +16,11 @@ package servstate_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"os/user"
@@ -436,6 +439,44 @@ func (s *S) TestServiceLogs(c *C) {
 	s.testServiceLogs(c, outputs)
 }
 
+func (s *S) TestPersistedServiceLogs(c *C) {
+	logsDir := filepath.Join(s.dir, "logs")
+	s.newServiceManager(c)
+	err := s.manager.PersistLogs(logsDir)
+	c.Assert(err, IsNil)
+	s.planAddLayer(c, testPlanLayer)
+	s.planChanged(c)
+
+	outputs := map[string]string{
+		"test1": `2.* \[test1\] test1\n`,
+		"test2": `2.* \[test2\] test2\n`,
+	}
+	s.testServiceLogs(c, outputs)
+	c.Assert(filepath.Join(logsDir, "test1.log"), testutil.FilePresent)
+
+	// Simulate a daemon restart: the logs are available from a new manager
+	// before the services are started again.
+	s.newServiceManager(c)
+	err = s.manager.PersistLogs(logsDir)
+	c.Assert(err, IsNil)
+	s.planChanged(c)
+	iterators, err := s.manager.ServiceLogs([]string{"test1"}, -1)
+	c.Assert(err, IsNil)
+	c.Assert(iterators, HasLen, 1)
+	buf := &bytes.Buffer{}
+	for iterators["test1"].Next(nil) {
+		_, err = io.Copy(buf, iterators["test1"])
+		c.Assert(err, IsNil)
+	}
+	c.Assert(iterators["test1"].Close(), IsNil)
+	c.Assert(buf.String(), Matches, outputs["test1"])
+
+	// Once started, the services append to the same buffers.
+	outputs["test1"] += outputs["test1"]
+	outputs["test2"] += outputs["test2"]
+	s.testServiceLogs(c, outputs)
+}
+
 func (s *S) TestStartBadCommand(c *C) {
 	s.newServiceManager(c)
 	s.planAddLayer(c, testPlanLayer)
@@ -599,6 +640,179 @@ func (s *S) TestStartFastExitCommand(c *C) {
 	c.Assert(svc.Current, Equals, servstate.StatusInactive)
 }
 
+func (s *S) TestRequiresPath(c *C) {
+	s.newServiceManager(c)
+	path := filepath.Join(c.MkDir(), "db.sock")
+	s.planAddLayer(c, fmt.Sprintf(`
+services:
+    api:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+        requires-path: [%s]
+`, path))
+	s.planChanged(c)
+
+	time.AfterFunc(300*time.Millisecond, func() {
+		os.WriteFile(path, nil, 0644)
+	})
+	chg := s.startServices(c, []string{"api"})
+
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	log := chg.Tasks()[0].Log()
+	c.Assert(log, HasLen, 1)
+	c.Check(log[0], Matches, fmt.Sprintf(`.* INFO Waiting for path %q`, path))
+	s.st.Unlock()
+
+	svc := s.serviceByName(c, "api")
+	c.Check(svc.Current, Equals, servstate.StatusActive)
+}
+
+func (s *S) TestRequiresTimeout(c *C) {
+	s.newServiceManager(c)
+	path := filepath.Join(c.MkDir(), "missing")
+	s.planAddLayer(c, fmt.Sprintf(`
+services:
+    api:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+        requires-path: [%s]
+        requires-port: ["127.0.0.1:1"]
+        requires-timeout: 300ms
+`, path))
+	s.planChanged(c)
+
+	chg := s.startServices(c, []string{"api"})
+
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, fmt.Sprintf(`(?s).*\(timed out after 300ms waiting for path %q, port "127.0.0.1:1"\)`, path))
+	s.st.Unlock()
+
+	svc := s.serviceByName(c, "api")
+	c.Check(svc.Current, Equals, servstate.StatusInactive)
+}
+
+func (s *S) TestRequiresStopWhileWaiting(c *C) {
+	s.newServiceManager(c)
+	path := filepath.Join(c.MkDir(), "missing")
+	s.planAddLayer(c, fmt.Sprintf(`
+services:
+    api:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+        requires-path: [%s]
+`, path))
+	s.planChanged(c)
+
+	s.st.Lock()
+	ts, err := servstate.Start(s.st, []string{"api"})
+	c.Assert(err, IsNil)
+	startChg := s.st.NewChange("test", "Start test")
+	startChg.AddAll(ts)
+	s.st.Unlock()
+	s.runner.Ensure()
+	for i := 0; ; i++ {
+		s.st.Lock()
+		log := startChg.Tasks()[0].Log()
+		s.st.Unlock()
+		if len(log) > 0 {
+			break
+		}
+		if i >= 500 {
+			c.Fatalf("timed out waiting for start to wait for path")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Stopping the service cancels the start.
+	stopChg := s.stopServices(c, []string{"api"})
+	waitChangeReady(c, s.runner, startChg, "start to be cancelled")
+
+	s.st.Lock()
+	c.Check(stopChg.Status(), Equals, state.DoneStatus)
+	log := stopChg.Tasks()[0].Log()
+	c.Assert(log, HasLen, 1)
+	c.Check(log[0], Matches, `.* INFO Service "api" stopped before it started.`)
+	c.Check(startChg.Status(), Equals, state.ErrorStatus)
+	c.Check(startChg.Err(), ErrorMatches, fmt.Sprintf(`(?s).*\(service stopped while waiting for path %q\)`, path))
+	s.st.Unlock()
+
+	svc := s.serviceByName(c, "api")
+	c.Check(svc.Current, Equals, servstate.StatusInactive)
+}
+
+func (s *S) TestRequiresPort(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	s.newServiceManager(c)
+	s.planAddLayer(c, fmt.Sprintf(`
+services:
+    api:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+        requires-port: ["%s"]
+`, l.Addr()))
+	s.planChanged(c)
+
+	chg := s.startServices(c, []string{"api"})
+
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	c.Check(chg.Tasks()[0].Log(), HasLen, 0)
+	s.st.Unlock()
+}
+
+// fakeDevices is a DeviceManager whose devices are ready once they're set.
+type fakeDevices struct {
+	mu    sync.Mutex
+	ready map[string]bool
+}
+
+func (d *fakeDevices) DeviceReady(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ready[name]
+}
+
+func (d *fakeDevices) setReady(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ready[name] = true
+}
+
+func (s *S) TestRequiresDevice(c *C) {
+	s.newServiceManager(c)
+	devices := &fakeDevices{ready: make(map[string]bool)}
+	s.manager.SetDeviceManager(devices)
+	s.planAddLayer(c, `
+services:
+    api:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+        requires-device: [modem]
+devices:
+    modem:
+        override: replace
+        path: /dev/ttyUSB0
+`)
+	s.planChanged(c)
+
+	time.AfterFunc(300*time.Millisecond, func() {
+		devices.setReady("modem")
+	})
+	chg := s.startServices(c, []string{"api"})
+
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	log := chg.Tasks()[0].Log()
+	c.Assert(log, HasLen, 1)
+	c.Check(log[0], Matches, `.* INFO Waiting for device "modem"`)
+	s.st.Unlock()
+}
+
 func (s *S) TestServices(c *C) {
 	s.newServiceManager(c)
 	s.planAddLayer(c, testPlanLayer)
@@ -653,6 +867,7 @@ services:
         environment:
             PEBBLE_ENV_TEST_1: foo
             PEBBLE_ENV_TEST_2: bar bazz
+            PEBBLE_ENV_TEST_3: $PEBBLE_ENV_TEST_1-$PEBBLE_ENV_TEST_PARENT-$$
 `
 	s.planAddLayer(c, fmt.Sprintf(
 		layer,
@@ -685,6 +900,7 @@ services:
 	c.Assert(string(data), Equals, `
 PEBBLE_ENV_TEST_1=foo
 PEBBLE_ENV_TEST_2=bar bazz
+PEBBLE_ENV_TEST_3=foo-from-parent-$
 PEBBLE_ENV_TEST_PARENT=from-parent
 `[1:])
 }
@@ -831,14 +1047,14 @@ func (s *S) TestOnCheckFailureRestartWhileRunning(c *C) {
 
 	// Tell service manager about check failures
 	checkFailed := make(chan struct{})
-	checkMgr.NotifyCheckFailed(func(name string) {
+	checkMgr.NotifyCheckFailed(func(name string, err error) {
 		// Control when the action should be applied
 		select {
 		case checkFailed <- struct{}{}:
 		case <-time.After(10 * time.Second):
 			panic("timed out waiting to send on check-failed channel")
 		}
-		s.manager.CheckFailed(name)
+		s.manager.CheckFailed(name, err)
 	})
 
 	tempDir := c.MkDir()
@@ -909,6 +1125,16 @@ checks:
 	svc := s.serviceByName(c, "test2")
 	c.Assert(svc.Current, Equals, servstate.StatusActive)
 	c.Assert(s.manager.BackoffNum("test2"), Equals, 1)
+
+	// Restart should have been recorded with the check that triggered it
+	s.st.Lock()
+	notices := s.st.Notices(&state.NoticeFilter{Types: []state.NoticeType{servstate.CheckFailureNotice}})
+	s.st.Unlock()
+	c.Assert(notices, HasLen, 1)
+	c.Check(notices[0].Key(), Equals, "test2")
+	data, err := json.Marshal(notices[0])
+	c.Assert(err, IsNil)
+	c.Check(string(data), Matches, `.*"last-data":\{"action":"restart","check":"chk1","error":"exec: .*will-fail.*"\}.*`)
 }
 
 // The aim of this test is to make sure that the actioned check
@@ -926,14 +1152,14 @@ func (s *S) TestOnCheckFailureRestartDuringBackoff(c *C) {
 
 	// Tell service manager about check failures
 	checkFailed := make(chan struct{})
-	checkMgr.NotifyCheckFailed(func(name string) {
+	checkMgr.NotifyCheckFailed(func(name string, err error) {
 		// Control when the action should be applied
 		select {
 		case checkFailed <- struct{}{}:
 		case <-time.After(10 * time.Second):
 			panic("timed out waiting to send on check-failed channel")
 		}
-		s.manager.CheckFailed(name)
+		s.manager.CheckFailed(name, err)
 	})
 
 	tempDir := c.MkDir()
@@ -1018,14 +1244,14 @@ func (s *S) TestOnCheckFailureIgnore(c *C) {
 
 	// Tell service manager about check failures
 	checkFailed := make(chan struct{})
-	checkMgr.NotifyCheckFailed(func(name string) {
+	checkMgr.NotifyCheckFailed(func(name string, err error) {
 		// Control when the action should be applied
 		select {
 		case checkFailed <- struct{}{}:
 		case <-time.After(10 * time.Second):
 			panic("timed out waiting to send on check-failed channel")
 		}
-		s.manager.CheckFailed(name)
+		s.manager.CheckFailed(name, err)
 	})
 
 	tempDir := c.MkDir()
@@ -1085,6 +1311,102 @@ checks:
 	c.Assert(svc.Current, Equals, servstate.StatusActive)
 }
 
+func (s *S) TestCheckRecovered(c *C) {
+	s.newServiceManager(c)
+	s.planAddLayer(c, testPlanLayer)
+	tempFile := filepath.Join(c.MkDir(), "out")
+	s.planAddLayer(c, fmt.Sprintf(`
+services:
+    test2:
+        override: replace
+        command: /bin/sh -c 'echo x >>%s; {{.NotifyDoneCheck}}; sleep 10'
+`, tempFile))
+	s.planChanged(c)
+
+	s.startServices(c, []string{"test2"})
+	s.waitForDoneCheck(c, "test2")
+
+	// Only running services are restarted.
+	s.manager.CheckRecovered("chk1", []string{"test2", "test4"})
+
+	s.st.Lock()
+	var change *state.Change
+	for _, chg := range s.st.Changes() {
+		if chg.Kind() == "restart" {
+			change = chg
+		}
+	}
+	s.st.Unlock()
+	c.Assert(change, NotNil)
+	waitChangeReady(c, s.runner, change, "services to restart")
+
+	s.st.Lock()
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	c.Check(change.Summary(), Equals, `Restart "test2" after check "chk1" recovered`)
+	s.st.Unlock()
+	s.waitForDoneCheck(c, "test2")
+	b, err := os.ReadFile(tempFile)
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, "x\nx\n")
+	c.Check(s.serviceByName(c, "test4").Current, Equals, servstate.StatusInactive)
+
+	s.stopServices(c, []string{"test2"})
+}
+
+func (s *S) TestRestartWith(c *C) {
+	s.newServiceManager(c)
+	s.planAddLayer(c, testPlanLayer)
+	tempFile := filepath.Join(c.MkDir(), "out")
+	s.planAddLayer(c, fmt.Sprintf(`
+services:
+    test2:
+        override: merge
+        backoff-delay: 1ms
+    test6:
+        override: replace
+        command: /bin/sh -c 'echo x >>%s; {{.NotifyDoneCheck}}; sleep 10'
+        restart-with: [test2]
+`, tempFile))
+	s.planChanged(c)
+
+	s.startServices(c, []string{"test2", "test6"})
+	s.waitForDoneCheck(c, "test2")
+	s.waitForDoneCheck(c, "test6")
+	c.Check(s.manager.RestartWith([]string{"test2"}), DeepEquals, []string{"test6"})
+
+	// Terminate test2 so that it's automatically restarted.
+	err := s.manager.SendSignal([]string{"test2"}, "SIGTERM")
+	c.Assert(err, IsNil)
+	s.waitForDoneCheck(c, "test2")
+
+	var change *state.Change
+	for i := 0; change == nil; i++ {
+		if i >= 1000 {
+			c.Fatalf("timed out waiting for restart change")
+		}
+		time.Sleep(5 * time.Millisecond)
+		s.st.Lock()
+		for _, chg := range s.st.Changes() {
+			if chg.Kind() == "restart" {
+				change = chg
+			}
+		}
+		s.st.Unlock()
+	}
+	waitChangeReady(c, s.runner, change, "services to restart")
+
+	s.st.Lock()
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	c.Check(change.Summary(), Equals, `Restart "test6" after service "test2" restarted`)
+	s.st.Unlock()
+	s.waitForDoneCheck(c, "test6")
+	b, err := os.ReadFile(tempFile)
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, "x\nx\n")
+
+	s.stopServices(c, []string{"test2", "test6"})
+}
+
 func (s *S) TestOnCheckFailureShutdown(c *C) {
 	s.testOnCheckFailureShutdown(c, "shutdown", restart.RestartCheckFailure)
 }
@@ -1103,14 +1425,14 @@ func (s *S) testOnCheckFailureShutdown(c *C, action string, restartType restart.
 
 	// Tell service manager about check failures
 	checkFailed := make(chan struct{})
-	checkMgr.NotifyCheckFailed(func(name string) {
+	checkMgr.NotifyCheckFailed(func(name string, err error) {
 		// Control when the action should be applied
 		select {
 		case checkFailed <- struct{}{}:
 		case <-time.After(10 * time.Second):
 			panic("timed out waiting to send on check-failed channel")
 		}
-		s.manager.CheckFailed(name)
+		s.manager.CheckFailed(name, err)
 	})
 
 	tempDir := c.MkDir()
@@ -1652,6 +1974,257 @@ services:
 	c.Check(string(output), Equals, dir+"\n")
 }
 
+func (s *S) TestIsolation(c *C) {
+	if os.Geteuid() != 0 {
+		c.Skip("requires root")
+	}
+	s.newServiceManager(c)
+	s.planAddLayer(c, testPlanLayer)
+
+	outputPath := filepath.Join(c.MkDir(), "output")
+	readOnlyDir := c.MkDir()
+	layer := `
+services:
+    isolated:
+        override: replace
+        command: /bin/sh -c "wc -l </proc/net/dev >%s; touch %s/foo 2>>%s; {{.NotifyDoneCheck}}; sleep %g"
+        isolation:
+            read-only-paths: [%s]
+            private-network: true
+`
+	s.planAddLayer(c, fmt.Sprintf(
+		layer,
+		outputPath,
+		readOnlyDir,
+		outputPath,
+		shortOkayDelay.Seconds()+0.01,
+		readOnlyDir,
+	))
+	s.planChanged(c)
+
+	chg := s.startServices(c, []string{"isolated"})
+	s.st.Lock()
+	c.Assert(chg.Err(), IsNil)
+	s.st.Unlock()
+
+	s.waitForDoneCheck(c, "isolated")
+
+	// Only the loopback interface is present (after two header lines), and
+	// the path is read-only.
+	output, err := os.ReadFile(outputPath)
+	c.Assert(err, IsNil)
+	c.Check(string(output), Matches, ` *3\n.*Read-only file system\n`)
+	c.Check(filepath.Join(readOnlyDir, "foo"), testutil.FileAbsent)
+}
+
+func (s *S) TestWriteStdin(c *C) {
+	s.newServiceManager(c)
+	s.planAddLayer(c, testPlanLayer)
+
+	outputPath := filepath.Join(c.MkDir(), "output")
+	layer := `
+services:
+    reader:
+        override: replace
+        command: /bin/sh -c "{{.NotifyDoneCheck}}; read line; echo got $line >%s; sleep 10"
+        stdin: pipe
+`
+	s.planAddLayer(c, fmt.Sprintf(layer, outputPath))
+	s.planChanged(c)
+
+	s.startServices(c, []string{"reader", "test2"})
+	s.waitForDoneCheck(c, "reader")
+
+	err := s.manager.WriteStdin("reader", strings.NewReader("hello\n"))
+	c.Assert(err, IsNil)
+	for i := 0; ; i++ {
+		if i >= 1000 {
+			c.Fatalf("timed out waiting for service to read stdin")
+		}
+		output, _ := os.ReadFile(outputPath)
+		if string(output) == "got hello\n" {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	err = s.manager.WriteStdin("test2", strings.NewReader("hello\n"))
+	c.Assert(err, ErrorMatches, `service "test2" stdin is not a pipe`)
+	err = s.manager.WriteStdin("test1", strings.NewReader("hello\n"))
+	c.Assert(err, ErrorMatches, `service "test1" is not running`)
+
+	s.stopServices(c, []string{"reader", "test2"})
+}
+
+func (s *S) TestDirectories(c *C) {
+	s.newServiceManager(c)
+	s.planAddLayer(c, testPlanLayer)
+
+	baseDir := c.MkDir()
+	existingDir := filepath.Join(baseDir, "existing")
+	err := os.Mkdir(existingDir, 0o755)
+	c.Assert(err, IsNil)
+	layer := `
+services:
+    withdirs:
+        override: replace
+        command: /bin/sh -c "{{.NotifyDoneCheck}}; sleep %g"
+        working-dir: %s/data
+        directories:
+            %s/data:
+                mode: "0700"
+            %s/run/nested:
+            %s:
+                mode: "0750"
+`
+	s.planAddLayer(c, fmt.Sprintf(
+		layer,
+		shortOkayDelay.Seconds()+0.01,
+		baseDir,
+		baseDir,
+		baseDir,
+		existingDir,
+	))
+	s.planChanged(c)
+
+	chg := s.startServices(c, []string{"withdirs"})
+	s.st.Lock()
+	c.Assert(chg.Err(), IsNil)
+	s.st.Unlock()
+
+	s.waitForDoneCheck(c, "withdirs")
+
+	st, err := os.Stat(filepath.Join(baseDir, "data"))
+	c.Assert(err, IsNil)
+	c.Check(st.Mode(), Equals, os.ModeDir|0o700)
+	st, err = os.Stat(filepath.Join(baseDir, "run", "nested"))
+	c.Assert(err, IsNil)
+	c.Check(st.Mode(), Equals, os.ModeDir|0o755)
+	st, err = os.Stat(existingDir)
+	c.Assert(err, IsNil)
+	c.Check(st.Mode(), Equals, os.ModeDir|0o750)
+}
+
+func (s *S) TestUlimits(c *C) {
+	s.newServiceManager(c)
+	s.planAddLayer(c, testPlanLayer)
+
+	outputPath := filepath.Join(c.MkDir(), "output")
+	layer := `
+services:
+    limited:
+        override: replace
+        command: /bin/sh -c "ulimit -Sn >%s; ulimit -Hn >>%s; {{.NotifyDoneCheck}}; sleep %g"
+        ulimits:
+            nofile: 100:200
+`
+	s.planAddLayer(c, fmt.Sprintf(
+		layer,
+		outputPath,
+		outputPath,
+		shortOkayDelay.Seconds()+0.01,
+	))
+	s.planChanged(c)
+
+	chg := s.startServices(c, []string{"limited"})
+	s.st.Lock()
+	c.Assert(chg.Err(), IsNil)
+	s.st.Unlock()
+
+	s.waitForDoneCheck(c, "limited")
+
+	output, err := os.ReadFile(outputPath)
+	c.Assert(err, IsNil)
+	c.Check(string(output), Equals, "100\n200\n")
+}
+
+func (s *S) TestSecrets(c *C) {
+	s.newServiceManager(c)
+	s.planAddLayer(c, testPlanLayer)
+
+	dir := c.MkDir()
+	sourcePath := filepath.Join(dir, "source")
+	err := os.WriteFile(sourcePath, []byte("pa$$word\n"), 0o600)
+	c.Assert(err, IsNil)
+	os.Setenv("PEBBLE_SECRET_TEST", "token")
+	defer os.Unsetenv("PEBBLE_SECRET_TEST")
+
+	outputPath := filepath.Join(dir, "output")
+	layer := `
+secrets:
+    password:
+        override: replace
+        backend: file
+        path: %s
+    token:
+        override: replace
+        backend: env
+        variable: PEBBLE_SECRET_TEST
+services:
+    withsecrets:
+        override: replace
+        command: /bin/sh -c "echo $PASSWORD $TOKEN >%s; {{.NotifyDoneCheck}}; sleep 10"
+        secrets:
+            password:
+                environment: PASSWORD
+                file: %s/password
+            token:
+                environment: TOKEN
+`
+	s.planAddLayer(c, fmt.Sprintf(
+		layer,
+		sourcePath,
+		outputPath,
+		dir,
+	))
+	s.planChanged(c)
+
+	chg := s.startServices(c, []string{"withsecrets"})
+	s.st.Lock()
+	c.Assert(chg.Err(), IsNil)
+	s.st.Unlock()
+
+	s.waitForDoneCheck(c, "withsecrets")
+
+	output, err := os.ReadFile(outputPath)
+	c.Assert(err, IsNil)
+	c.Check(string(output), Equals, "pa$$word token\n")
+
+	data, err := os.ReadFile(filepath.Join(dir, "password"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "pa$$word\n")
+	st, err := os.Stat(filepath.Join(dir, "password"))
+	c.Assert(err, IsNil)
+	c.Check(st.Mode(), Equals, os.FileMode(0o400))
+}
+
+func (s *S) TestSecretError(c *C) {
+	s.newServiceManager(c)
+	s.planAddLayer(c, testPlanLayer)
+
+	layer := `
+secrets:
+    missing:
+        override: replace
+        backend: file
+        path: %s/missing
+services:
+    withsecrets:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+        secrets:
+            missing:
+                environment: MISSING
+`
+	s.planAddLayer(c, fmt.Sprintf(layer, c.MkDir()))
+	s.planChanged(c)
+
+	chg := s.startServices(c, []string{"withsecrets"})
+	s.st.Lock()
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot read secret "missing": open .*/missing: no such file or directory.*`)
+	s.st.Unlock()
+}
+
 func (s *S) TestWaitDelay(c *C) {
 	s.newServiceManager(c)
 	s.planAddLayer(c, testPlanLayer)
@@ -1694,6 +2267,109 @@ services:
 	})
 }
 
+func (s *S) TestMaintenance(c *C) {
+	s.newServiceManager(c)
+	s.planAddLayer(c, testPlanLayer)
+	s.planChanged(c)
+	s.startTestServices(c, true)
+	if c.Failed() {
+		return
+	}
+
+	// With no services given, the running services that aren't started by
+	// default are stopped, together with their dependents.
+	s.st.Lock()
+	ts, stopped, err := s.manager.EnterMaintenance(nil)
+	c.Assert(err, IsNil)
+	c.Check(stopped, DeepEquals, []string{"test2", "test1"})
+	c.Check(s.manager.InMaintenance(), Equals, true)
+	maintenance, err := servstate.GetMaintenance(s.st)
+	c.Assert(err, IsNil)
+	c.Assert(maintenance, NotNil)
+	c.Check(maintenance.Services, DeepEquals, []string{"test2", "test1"})
+	_, _, err = s.manager.EnterMaintenance(nil)
+	c.Check(err, Equals, servstate.ErrInMaintenance)
+	chg := s.st.NewChange("maintenance-enter", "Enter maintenance mode")
+	chg.AddAll(ts)
+	s.st.Unlock()
+	waitChangeReady(c, s.runner, chg, "services to stop")
+	c.Check(s.serviceByName(c, "test1").Current, Equals, servstate.StatusInactive)
+	c.Check(s.serviceByName(c, "test2").Current, Equals, servstate.StatusInactive)
+
+	// Maintenance mode is restored from the state by a new manager.
+	manager, err := servstate.NewManager(s.st, state.NewTaskRunner(s.st), s.logOutput, testRestarter{s.stopDaemon}, fakeLogManager{})
+	c.Assert(err, IsNil)
+	c.Check(manager.InMaintenance(), Equals, true)
+
+	// Exiting starts the stopped services again.
+	s.st.Lock()
+	ts, started, err := s.manager.ExitMaintenance()
+	c.Assert(err, IsNil)
+	c.Check(started, DeepEquals, []string{"test1", "test2"})
+	c.Check(s.manager.InMaintenance(), Equals, false)
+	maintenance, err = servstate.GetMaintenance(s.st)
+	c.Assert(err, IsNil)
+	c.Check(maintenance, IsNil)
+	_, _, err = s.manager.ExitMaintenance()
+	c.Check(err, Equals, servstate.ErrNotInMaintenance)
+	chg = s.st.NewChange("maintenance-exit", "Exit maintenance mode")
+	chg.AddAll(ts)
+	s.st.Unlock()
+	waitChangeReady(c, s.runner, chg, "services to start")
+	c.Check(s.serviceByName(c, "test1").Current, Equals, servstate.StatusActive)
+	c.Check(s.serviceByName(c, "test2").Current, Equals, servstate.StatusActive)
+
+	s.st.Lock()
+	notices := s.st.Notices(&state.NoticeFilter{Types: []state.NoticeType{servstate.MaintenanceNotice}})
+	s.st.Unlock()
+	c.Assert(notices, HasLen, 2)
+	c.Check(notices[0].Key(), Equals, "enter")
+	c.Check(notices[1].Key(), Equals, "exit")
+	data, err := json.Marshal(notices[1])
+	c.Assert(err, IsNil)
+	c.Check(string(data), Matches, `.*"last-data":\{"services":"test1,test2"\}.*`)
+}
+
+func (s *S) TestMaintenanceIgnoresCheckFailure(c *C) {
+	s.newServiceManager(c)
+	s.planAddLayer(c, `
+services:
+    test2:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+        on-check-failure:
+            chk1: shutdown
+
+    test3:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+`)
+	s.planChanged(c)
+	s.startServices(c, []string{"test2"})
+	s.waitUntilService(c, "test2", func(svc *servstate.ServiceInfo) bool {
+		return svc.Current == servstate.StatusActive
+	})
+
+	// Enter maintenance mode without stopping any services.
+	s.st.Lock()
+	_, stopped, err := s.manager.EnterMaintenance([]string{"test3"})
+	s.st.Unlock()
+	c.Assert(err, IsNil)
+	c.Check(stopped, HasLen, 0)
+
+	s.manager.CheckFailed("chk1", errors.New("oops"))
+	select {
+	case restartType := <-s.stopDaemon:
+		c.Fatalf("unexpected restart %v in maintenance mode", restartType)
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Check(s.serviceByName(c, "test2").Current, Equals, servstate.StatusActive)
+	s.st.Lock()
+	notices := s.st.Notices(&state.NoticeFilter{Types: []state.NoticeType{servstate.CheckFailureNotice}})
+	s.st.Unlock()
+	c.Check(notices, HasLen, 0)
+}
+
 func (s *S) newServiceManager(c *C) {
 	var err error
 	s.manager, err = servstate.NewManager(s.st, s.runner, s.logOutput, testRestarter{s.stopDaemon}, fakeLogManager{})
@@ -1720,6 +2396,7 @@ func (s *S) planAddLayer(c *C, layerYAML string) {
 		Services:   combined.Services,
 		Checks:     combined.Checks,
 		LogTargets: combined.LogTargets,
+		Secrets:    combined.Secrets,
 	}
 }
 
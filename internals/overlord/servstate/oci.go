@@ -0,0 +1,645 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package servstate
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/reaper"
+)
+
+const unpackImageKind = "unpack-image"
+
+// ociImagesKey is the state cache key of the images of the plan's OCI
+// services, keyed by service name, which Start uses to add unpack-image
+// tasks.
+type ociImagesKey struct{}
+
+// defaultOCIRuntime is the OCI runtime used to run OCI services, unless
+// PEBBLE_OCI_RUNTIME is set. It must support runc's "run" and "delete"
+// commands.
+const defaultOCIRuntime = "runc"
+
+func ociRuntime() string {
+	if name := os.Getenv("PEBBLE_OCI_RUNTIME"); name != "" {
+		return name
+	}
+	return defaultOCIRuntime
+}
+
+// ociContainerID returns the ID of the OCI service's container.
+func ociContainerID(config *plan.Service) string {
+	return "pebble-" + config.Name
+}
+
+// ociBundleDir returns the OCI service's bundle directory, which the plan
+// has checked is the only argument of its command.
+func ociBundleDir(config *plan.Service) string {
+	base, _, _ := config.ParseCommand()
+	if len(base) == 0 {
+		return ""
+	}
+	return base[0]
+}
+
+// ociCommand returns the command that runs the OCI service's container in
+// the foreground. The runtime forwards signals to the container's process,
+// so the service is stopped like any other.
+func ociCommand(config *plan.Service) []string {
+	return []string{ociRuntime(), "run", "--bundle", ociBundleDir(config), ociContainerID(config)}
+}
+
+// deleteOCIContainer deletes the OCI service's container, if it was left
+// behind by a previous run (for example, if the runtime was killed), so
+// that a new one can be created with the same ID.
+func deleteOCIContainer(config *plan.Service) {
+	cmd := exec.Command(ociRuntime(), "delete", "--force", ociContainerID(config))
+	_, err := reaper.CommandCombinedOutput(cmd)
+	if err != nil {
+		logger.Debugf("Cannot delete container for service %q (it may not exist): %v", config.Name, err)
+	}
+}
+
+// setOCIImages caches the images of the plan's OCI services for Start. The
+// state lock must be held.
+func setOCIImages(s *state.State, p *plan.Plan) {
+	images := make(map[string]string)
+	for name, service := range p.Services {
+		if service.Kind == plan.KindOCI && service.Image != "" {
+			images[name] = service.Image
+		}
+	}
+	s.Cache(ociImagesKey{}, images)
+}
+
+// ociImage returns the image of the OCI service, or "" if it doesn't have
+// one. The state lock must be held.
+func ociImage(s *state.State, name string) string {
+	images, _ := s.Cached(ociImagesKey{}).(map[string]string)
+	return images[name]
+}
+
+func (m *ServiceManager) doUnpackImage(task *state.Task, tomb *tomb.Tomb) error {
+	m.state.Lock()
+	request, err := TaskServiceRequest(task)
+	m.state.Unlock()
+	if err != nil {
+		return err
+	}
+
+	config, ok := m.getPlan().Services[request.Name]
+	if !ok {
+		return fmt.Errorf("cannot find service %q in plan", request.Name)
+	}
+	if config.Kind != plan.KindOCI || config.Image == "" {
+		// The plan changed since the task was created.
+		return nil
+	}
+
+	bundleDir := ociBundleDir(config)
+	digest, unpacked, err := unpackImage(config.Image, bundleDir, tomb.Dying())
+	if err != nil {
+		return fmt.Errorf("cannot unpack image %q for service %q: %w", config.Image, config.Name, err)
+	}
+	m.state.Lock()
+	if unpacked {
+		task.Logf("Unpacked image %s (%s) to %s", config.Image, digest, bundleDir)
+	} else {
+		task.Logf("Image %s (%s) is already unpacked", config.Image, digest)
+	}
+	m.state.Unlock()
+	return nil
+}
+
+// imageMarkerFile is the file in the bundle directory that holds the digest
+// of the image manifest the bundle was unpacked from.
+const imageMarkerFile = ".pebble-image"
+
+// descriptor is an OCI content descriptor.
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform,omitempty"`
+}
+
+type imageIndex struct {
+	Manifests []descriptor `json:"manifests"`
+}
+
+type imageManifest struct {
+	Config descriptor   `json:"config"`
+	Layers []descriptor `json:"layers"`
+}
+
+type imageConfig struct {
+	Config struct {
+		User       string   `json:"User"`
+		Env        []string `json:"Env"`
+		Entrypoint []string `json:"Entrypoint"`
+		Cmd        []string `json:"Cmd"`
+		WorkingDir string   `json:"WorkingDir"`
+	} `json:"config"`
+}
+
+const (
+	indexMediaType       = "application/vnd.oci.image.index.v1+json"
+	dockerListMediaType  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	maxIndexNestingDepth = 4
+)
+
+// unpackImage unpacks the image in the OCI image layout directory to the
+// bundle directory's "rootfs" directory, replacing its previous content,
+// and writes a runtime config.json from the image's config if the bundle
+// doesn't have one. It does nothing if the bundle was already unpacked from
+// the same image manifest. It returns the manifest's digest, and whether
+// the image was unpacked.
+func unpackImage(imageDir, bundleDir string, cancel <-chan struct{}) (digest string, unpacked bool, err error) {
+	var index imageIndex
+	err = readJSONFile(filepath.Join(imageDir, "index.json"), &index)
+	if err != nil {
+		return "", false, err
+	}
+	desc, err := selectManifest(imageDir, &index, 0)
+	if err != nil {
+		return "", false, err
+	}
+
+	markerPath := filepath.Join(bundleDir, imageMarkerFile)
+	marker, err := os.ReadFile(markerPath)
+	if err == nil && strings.TrimSpace(string(marker)) == desc.Digest {
+		return desc.Digest, false, nil
+	}
+
+	var manifest imageManifest
+	err = readBlobJSON(imageDir, desc.Digest, &manifest)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot read manifest: %w", err)
+	}
+	var config imageConfig
+	err = readBlobJSON(imageDir, manifest.Config.Digest, &config)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot read image config: %w", err)
+	}
+
+	// Unpack to a new directory and swap it in at the end, so that a
+	// failure doesn't leave a partially unpacked rootfs.
+	err = os.MkdirAll(bundleDir, 0755)
+	if err != nil {
+		return "", false, err
+	}
+	rootfs := filepath.Join(bundleDir, "rootfs")
+	newRootfs := rootfs + ".new"
+	err = os.RemoveAll(newRootfs)
+	if err != nil {
+		return "", false, err
+	}
+	err = os.Mkdir(newRootfs, 0755)
+	if err != nil {
+		return "", false, err
+	}
+	defer os.RemoveAll(newRootfs)
+	for i, layer := range manifest.Layers {
+		select {
+		case <-cancel:
+			return "", false, errors.New("unpacking aborted")
+		default:
+		}
+		err = applyLayer(imageDir, layer, newRootfs)
+		if err != nil {
+			return "", false, fmt.Errorf("cannot apply layer %d (%s): %w", i, layer.Digest, err)
+		}
+	}
+	err = os.RemoveAll(rootfs)
+	if err != nil {
+		return "", false, err
+	}
+	err = os.Rename(newRootfs, rootfs)
+	if err != nil {
+		return "", false, err
+	}
+
+	configPath := filepath.Join(bundleDir, "config.json")
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		err = writeRuntimeConfig(configPath, &config, filepath.Base(bundleDir))
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	err = os.WriteFile(markerPath, []byte(desc.Digest+"\n"), 0644)
+	if err != nil {
+		return "", false, err
+	}
+	return desc.Digest, true, nil
+}
+
+// selectManifest returns the descriptor of the image manifest for this
+// platform, following nested indexes.
+func selectManifest(imageDir string, index *imageIndex, depth int) (*descriptor, error) {
+	var candidates []descriptor
+	for _, desc := range index.Manifests {
+		if desc.Platform == nil || (desc.Platform.OS == runtime.GOOS && desc.Platform.Architecture == runtime.GOARCH) {
+			candidates = append(candidates, desc)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("image has no manifest for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	if len(candidates) > 1 {
+		return nil, fmt.Errorf("image has %d manifests for %s/%s, must have one", len(candidates), runtime.GOOS, runtime.GOARCH)
+	}
+	desc := candidates[0]
+	if desc.MediaType != indexMediaType && desc.MediaType != dockerListMediaType {
+		return &desc, nil
+	}
+	if depth >= maxIndexNestingDepth {
+		return nil, errors.New("image indexes are nested too deeply")
+	}
+	var nested imageIndex
+	err := readBlobJSON(imageDir, desc.Digest, &nested)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read index: %w", err)
+	}
+	return selectManifest(imageDir, &nested, depth+1)
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("cannot decode %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+var digestExp = regexp.MustCompile("^sha256:([a-f0-9]{64})$")
+
+// blobReader reads a blob of the image, computing its digest.
+type blobReader struct {
+	file   *os.File
+	hash   hash.Hash
+	reader io.Reader
+	digest string
+}
+
+func openBlob(imageDir, digest string) (*blobReader, error) {
+	match := digestExp.FindStringSubmatch(digest)
+	if match == nil {
+		return nil, fmt.Errorf("unsupported digest %q", digest)
+	}
+	f, err := os.Open(filepath.Join(imageDir, "blobs", "sha256", match[1]))
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	return &blobReader{
+		file:   f,
+		hash:   h,
+		reader: io.TeeReader(f, h),
+		digest: digest,
+	}, nil
+}
+
+func (b *blobReader) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+func (b *blobReader) Close() error {
+	return b.file.Close()
+}
+
+// verify reads the rest of the blob and checks that it matches its digest.
+func (b *blobReader) verify() error {
+	_, err := io.Copy(io.Discard, b.reader)
+	if err != nil {
+		return err
+	}
+	sum := "sha256:" + hex.EncodeToString(b.hash.Sum(nil))
+	if sum != b.digest {
+		return fmt.Errorf("blob %s has digest %s", b.digest, sum)
+	}
+	return nil
+}
+
+func readBlobJSON(imageDir, digest string, v interface{}) error {
+	blob, err := openBlob(imageDir, digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return err
+	}
+	err = blob.verify()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// applyLayer extracts the layer's tar archive (optionally gzip-compressed)
+// to the rootfs, applying whiteout files to remove content from the layers
+// below it.
+func applyLayer(imageDir string, layer descriptor, rootfs string) error {
+	if strings.HasSuffix(layer.MediaType, "+zstd") {
+		return fmt.Errorf("unsupported layer media type %q", layer.MediaType)
+	}
+	blob, err := openBlob(imageDir, layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	var r io.Reader
+	buffered := bufio.NewReader(blob)
+	magic, _ := buffered.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+
+	// Paths created by this layer, which an opaque whiteout in the same
+	// layer doesn't remove.
+	created := make(map[string]bool)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = applyEntry(rootfs, hdr, tr, created)
+		if err != nil {
+			return fmt.Errorf("cannot extract %q: %w", hdr.Name, err)
+		}
+	}
+	return blob.verify()
+}
+
+func applyEntry(rootfs string, hdr *tar.Header, r io.Reader, created map[string]bool) error {
+	dir, base := filepath.Split(filepath.Clean("/" + hdr.Name))
+	parent, err := secureJoin(rootfs, dir, true)
+	if err != nil {
+		return err
+	}
+
+	if base == ".wh..wh..opq" {
+		entries, err := os.ReadDir(parent)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(parent, entry.Name())
+			if !created[path] {
+				err := os.RemoveAll(path)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if strings.HasPrefix(base, ".wh.") {
+		return os.RemoveAll(filepath.Join(parent, strings.TrimPrefix(base, ".wh.")))
+	}
+
+	if base == "" {
+		// The entry for the root directory.
+		return nil
+	}
+	path := filepath.Join(parent, base)
+	err = os.MkdirAll(parent, 0755)
+	if err != nil {
+		return err
+	}
+	mode := hdr.FileInfo().Mode()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if fi, err := os.Lstat(path); err == nil && !fi.IsDir() {
+			err = os.Remove(path)
+			if err != nil {
+				return err
+			}
+		}
+		err = os.MkdirAll(path, 0755)
+	case tar.TypeReg, tar.TypeRegA:
+		err = os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+		var f *os.File
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, r)
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	case tar.TypeSymlink:
+		err = os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+		err = os.Symlink(hdr.Linkname, path)
+	case tar.TypeLink:
+		var target string
+		target, err = secureJoin(rootfs, hdr.Linkname, false)
+		if err != nil {
+			return err
+		}
+		err = os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+		err = os.Link(target, path)
+	default:
+		// Device nodes and FIFOs are left to the runtime, which creates
+		// the container's /dev.
+		logger.Debugf("Skipping %q of unsupported type %q in image layer", hdr.Name, hdr.Typeflag)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	created[path] = true
+
+	if os.Geteuid() == 0 {
+		err = os.Lchown(path, hdr.Uid, hdr.Gid)
+		if err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag != tar.TypeSymlink && hdr.Typeflag != tar.TypeLink {
+		// Set the permissions after the owner, which clears the setuid
+		// and setgid bits.
+		err = os.Chmod(path, mode.Perm()|(mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// secureJoin returns the path of name within the root directory, resolving
+// symlinks (as if root were the filesystem root) so that the result can't
+// be outside root. The final component is only resolved if resolveLast is
+// true.
+func secureJoin(root, name string, resolveLast bool) (string, error) {
+	resolved := "/"
+	remaining := name
+	links := 0
+	for remaining != "" {
+		var part string
+		part, remaining, _ = strings.Cut(remaining, "/")
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		if strings.Trim(remaining, "/") == "" && !resolveLast {
+			resolved = next
+			break
+		}
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		links++
+		if links > 40 {
+			return "", errors.New("too many levels of symbolic links")
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		remaining = target + "/" + remaining
+	}
+	return filepath.Join(root, resolved), nil
+}
+
+// writeRuntimeConfig writes a minimal OCI runtime config for the image,
+// similar to the one generated by "runc spec", with the container sharing
+// the host's network.
+func writeRuntimeConfig(path string, config *imageConfig, hostname string) error {
+	args := append(append([]string(nil), config.Config.Entrypoint...), config.Config.Cmd...)
+	if len(args) == 0 {
+		return errors.New("image config doesn't define an entrypoint or command")
+	}
+	env := config.Config.Env
+	if len(env) == 0 {
+		env = []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"}
+	}
+	cwd := config.Config.WorkingDir
+	if cwd == "" {
+		cwd = "/"
+	}
+	// Only numeric users can be used without reading the rootfs's
+	// /etc/passwd, so named users fall back to root.
+	var uid, gid int
+	user, group, _ := strings.Cut(config.Config.User, ":")
+	if n, err := strconv.Atoi(user); err == nil {
+		uid = n
+	} else if user != "" {
+		logger.Noticef("Cannot use image user %q in generated runtime config, using root", user)
+	}
+	if n, err := strconv.Atoi(group); err == nil {
+		gid = n
+	}
+
+	spec := map[string]interface{}{
+		"ociVersion": "1.0.2",
+		"process": map[string]interface{}{
+			"terminal":        false,
+			"user":            map[string]interface{}{"uid": uid, "gid": gid},
+			"args":            args,
+			"env":             env,
+			"cwd":             cwd,
+			"noNewPrivileges": true,
+		},
+		"root":     map[string]interface{}{"path": "rootfs"},
+		"hostname": hostname,
+		"mounts": []interface{}{
+			map[string]interface{}{"destination": "/proc", "type": "proc", "source": "proc"},
+			map[string]interface{}{"destination": "/dev", "type": "tmpfs", "source": "tmpfs",
+				"options": []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+			map[string]interface{}{"destination": "/dev/pts", "type": "devpts", "source": "devpts",
+				"options": []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620"}},
+			map[string]interface{}{"destination": "/dev/shm", "type": "tmpfs", "source": "shm",
+				"options": []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+			map[string]interface{}{"destination": "/dev/mqueue", "type": "mqueue", "source": "mqueue",
+				"options": []string{"nosuid", "noexec", "nodev"}},
+			map[string]interface{}{"destination": "/sys", "type": "sysfs", "source": "sysfs",
+				"options": []string{"nosuid", "noexec", "nodev", "ro"}},
+		},
+		"linux": map[string]interface{}{
+			"namespaces": []interface{}{
+				map[string]interface{}{"type": "pid"},
+				map[string]interface{}{"type": "ipc"},
+				map[string]interface{}{"type": "uts"},
+				map[string]interface{}{"type": "mount"},
+			},
+		},
+	}
+	data, err := json.MarshalIndent(spec, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package servstate_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord/servstate"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/testutil"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+func makeLayer(c *C, entries []tarEntry, compress bool) []byte {
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	var tw *tar.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	for _, entry := range entries {
+		hdr := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Linkname: entry.linkname,
+			Mode:     0644,
+			Size:     int64(len(entry.content)),
+		}
+		if entry.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		err := tw.WriteHeader(hdr)
+		c.Assert(err, IsNil)
+		_, err = tw.Write([]byte(entry.content))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(tw.Close(), IsNil)
+	if gz != nil {
+		c.Assert(gz.Close(), IsNil)
+	}
+	return buf.Bytes()
+}
+
+// writeImage writes an OCI image layout with the given layers, returning
+// the digest of its manifest.
+func writeImage(c *C, dir string, layers [][]byte) string {
+	writeBlob := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		path := filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(sum[:]))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(path, data, 0644)
+		c.Assert(err, IsNil)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	writeJSON := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		c.Assert(err, IsNil)
+		return writeBlob(data)
+	}
+
+	config := writeJSON(map[string]interface{}{
+		"architecture": runtime.GOARCH,
+		"os":           runtime.GOOS,
+		"config": map[string]interface{}{
+			"User":       "1000:1000",
+			"Env":        []string{"PATH=/bin"},
+			"Entrypoint": []string{"/bin/app"},
+			"Cmd":        []string{"--serve"},
+			"WorkingDir": "/srv",
+		},
+	})
+	var layerDescs []interface{}
+	for _, layer := range layers {
+		layerDescs = append(layerDescs, map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			"digest":    writeBlob(layer),
+			"size":      len(layer),
+		})
+	}
+	manifest := writeJSON(map[string]interface{}{
+		"schemaVersion": 2,
+		"config": map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"digest":    config,
+		},
+		"layers": layerDescs,
+	})
+	data, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []interface{}{map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.manifest.v1+json",
+			"digest":    manifest,
+			"platform":  map[string]string{"architecture": runtime.GOARCH, "os": runtime.GOOS},
+		}},
+	})
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(dir, "index.json"), data, 0644)
+	c.Assert(err, IsNil)
+	return manifest
+}
+
+func (s *S) writeTestImage(c *C) (imageDir, digest string) {
+	imageDir = filepath.Join(s.dir, "image")
+	digest = writeImage(c, imageDir, [][]byte{
+		makeLayer(c, []tarEntry{
+			{name: "bin/", typeflag: tar.TypeDir},
+			{name: "bin/app", typeflag: tar.TypeReg, content: "app v1"},
+			{name: "etc/", typeflag: tar.TypeDir},
+			{name: "etc/old.conf", typeflag: tar.TypeReg, content: "old"},
+			{name: "var/cache/", typeflag: tar.TypeDir},
+			{name: "var/cache/a", typeflag: tar.TypeReg, content: "a"},
+		}, true),
+		makeLayer(c, []tarEntry{
+			{name: "bin/app", typeflag: tar.TypeReg, content: "app v2"},
+			{name: "bin/app-link", typeflag: tar.TypeLink, linkname: "bin/app"},
+			{name: "etc/.wh.old.conf", typeflag: tar.TypeReg},
+			{name: "var/cache/b", typeflag: tar.TypeReg, content: "b"},
+			{name: "var/cache/.wh..wh..opq", typeflag: tar.TypeReg},
+			{name: "srv", typeflag: tar.TypeSymlink, linkname: "/var/srv"},
+			{name: "srv/data", typeflag: tar.TypeReg, content: "data"},
+		}, false),
+	})
+	return imageDir, digest
+}
+
+func (s *S) TestUnpackImage(c *C) {
+	imageDir, digest := s.writeTestImage(c)
+	bundleDir := filepath.Join(s.dir, "bundle")
+
+	gotDigest, unpacked, err := servstate.UnpackImage(imageDir, bundleDir, nil)
+	c.Assert(err, IsNil)
+	c.Check(gotDigest, Equals, digest)
+	c.Check(unpacked, Equals, true)
+
+	rootfs := filepath.Join(bundleDir, "rootfs")
+	readFile := func(path string) string {
+		data, err := os.ReadFile(filepath.Join(rootfs, path))
+		c.Assert(err, IsNil)
+		return string(data)
+	}
+	c.Check(readFile("bin/app"), Equals, "app v2")
+	c.Check(readFile("bin/app-link"), Equals, "app v2")
+	c.Check(filepath.Join(rootfs, "etc/old.conf"), testutil.FileAbsent)
+	// The opaque whiteout removes the lower layer's file, but not the file
+	// in the same layer.
+	c.Check(filepath.Join(rootfs, "var/cache/a"), testutil.FileAbsent)
+	c.Check(readFile("var/cache/b"), Equals, "b")
+	// Files written through symlinks stay in the rootfs.
+	c.Check(readFile("var/srv/data"), Equals, "data")
+	c.Check(filepath.Join(bundleDir, "rootfs.new"), testutil.FileAbsent)
+
+	var config struct {
+		Process struct {
+			User struct {
+				UID int `json:"uid"`
+				GID int `json:"gid"`
+			} `json:"user"`
+			Args []string `json:"args"`
+			Env  []string `json:"env"`
+			Cwd  string   `json:"cwd"`
+		} `json:"process"`
+		Root struct {
+			Path string `json:"path"`
+		} `json:"root"`
+	}
+	data, err := os.ReadFile(filepath.Join(bundleDir, "config.json"))
+	c.Assert(err, IsNil)
+	err = json.Unmarshal(data, &config)
+	c.Assert(err, IsNil)
+	c.Check(config.Process.Args, DeepEquals, []string{"/bin/app", "--serve"})
+	c.Check(config.Process.Env, DeepEquals, []string{"PATH=/bin"})
+	c.Check(config.Process.Cwd, Equals, "/srv")
+	c.Check(config.Process.User.UID, Equals, 1000)
+	c.Check(config.Process.User.GID, Equals, 1000)
+	c.Check(config.Root.Path, Equals, "rootfs")
+
+	// The same image isn't unpacked again, and an existing config.json is
+	// left alone.
+	err = os.WriteFile(filepath.Join(bundleDir, "config.json"), []byte("{}"), 0644)
+	c.Assert(err, IsNil)
+	_, unpacked, err = servstate.UnpackImage(imageDir, bundleDir, nil)
+	c.Assert(err, IsNil)
+	c.Check(unpacked, Equals, false)
+	os.Remove(filepath.Join(bundleDir, ".pebble-image"))
+	_, unpacked, err = servstate.UnpackImage(imageDir, bundleDir, nil)
+	c.Assert(err, IsNil)
+	c.Check(unpacked, Equals, true)
+	data, err = os.ReadFile(filepath.Join(bundleDir, "config.json"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "{}")
+}
+
+func (s *S) TestUnpackImageBadDigest(c *C) {
+	imageDir := filepath.Join(s.dir, "image")
+	writeImage(c, imageDir, [][]byte{
+		makeLayer(c, []tarEntry{{name: "foo", typeflag: tar.TypeReg, content: "hello world"}}, false),
+	})
+	// Corrupt the layer.
+	blobs, err := filepath.Glob(filepath.Join(imageDir, "blobs", "sha256", "*"))
+	c.Assert(err, IsNil)
+	for _, blob := range blobs {
+		data, err := os.ReadFile(blob)
+		c.Assert(err, IsNil)
+		if bytes.Contains(data, []byte("hello world")) {
+			data = bytes.Replace(data, []byte("hello world"), []byte("HELLO WORLD"), 1)
+			err = os.WriteFile(blob, data, 0644)
+			c.Assert(err, IsNil)
+		}
+	}
+
+	bundleDir := filepath.Join(s.dir, "bundle")
+	_, _, err = servstate.UnpackImage(imageDir, bundleDir, nil)
+	c.Check(err, ErrorMatches, `cannot apply layer 0 \(sha256:.*\): blob sha256:.* has digest sha256:.*`)
+	c.Check(filepath.Join(bundleDir, "rootfs"), testutil.FileAbsent)
+}
+
+func (s *S) TestStartOCIService(c *C) {
+	imageDir, _ := s.writeTestImage(c)
+	bundleDir := filepath.Join(s.dir, "bundle")
+
+	// Use a fake runtime that logs its arguments, and whose "run" command
+	// keeps running like a container.
+	runtimeLog := filepath.Join(s.dir, "runtime.log")
+	runtimePath := filepath.Join(s.dir, "runtime")
+	err := os.WriteFile(runtimePath, []byte(fmt.Sprintf(`#!/bin/sh
+echo "$@" >>%s
+if [ "$1" = run ]; then exec sleep 10; fi
+`, runtimeLog)), 0755)
+	c.Assert(err, IsNil)
+	os.Setenv("PEBBLE_OCI_RUNTIME", runtimePath)
+	s.AddCleanup(func() { os.Unsetenv("PEBBLE_OCI_RUNTIME") })
+
+	s.newServiceManager(c)
+	s.planAddLayer(c, fmt.Sprintf(`
+services:
+    app:
+        override: replace
+        kind: oci
+        command: %s
+        image: %s
+`, bundleDir, imageDir))
+	s.planChanged(c)
+
+	chg := s.startServices(c, []string{"app"})
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	tasks := chg.Tasks()
+	c.Assert(tasks, HasLen, 2)
+	c.Check(tasks[0].Kind(), Equals, "unpack-image")
+	c.Check(tasks[0].Summary(), Equals, `Unpack image for service "app"`)
+	c.Check(tasks[0].Log(), HasLen, 1)
+	c.Check(tasks[1].Kind(), Equals, "start")
+	c.Check(tasks[1].WaitTasks(), DeepEquals, []*state.Task{tasks[0]})
+	s.st.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(bundleDir, "rootfs", "bin", "app"))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "app v2")
+	data, err = os.ReadFile(runtimeLog)
+	c.Assert(err, IsNil)
+	c.Check(strings.Split(strings.TrimSpace(string(data)), "\n"), DeepEquals, []string{
+		"delete --force pebble-app",
+		"run --bundle " + bundleDir + " pebble-app",
+	})
+
+	s.stopServices(c, []string{"app"})
+}
+
+func (s *S) TestStartNoImage(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	servstate.SetOCIImages(s.st, &plan.Plan{Services: map[string]*plan.Service{
+		"one": {Name: "one", Kind: plan.KindOCI, Command: "/bundles/one"},
+		"two": {Name: "two", Kind: plan.KindOCI, Command: "/bundles/two", Image: "/images/two"},
+	}})
+	tset, err := servstate.Start(s.st, []string{"one", "two"})
+	c.Assert(err, IsNil)
+	tasks := tset.Tasks()
+	c.Assert(tasks, HasLen, 3)
+	c.Check(tasks[0].Kind(), Equals, "start")
+	c.Check(tasks[1].Kind(), Equals, "unpack-image")
+	c.Check(tasks[1].WaitTasks(), DeepEquals, []*state.Task{tasks[0]})
+	c.Check(tasks[1].Affected(), DeepEquals, []string{"service:two"})
+	c.Check(tasks[2].Kind(), Equals, "start")
+	c.Check(tasks[2].WaitTasks(), DeepEquals, []*state.Task{tasks[1]})
+}
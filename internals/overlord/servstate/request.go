@@ -11,15 +11,43 @@ type ServiceRequest struct {
 	Name string
 }
 
+// ServiceObject returns the key identifying the service in the objects
+// affected by tasks, for conflict detection between changes.
+func ServiceObject(name string) string {
+	return state.ObjectKey("service", name)
+}
+
+// CheckConflict returns a *state.ChangeConflictError if any of the given
+// services is being operated on by a change in progress. The state lock must
+// be held.
+func CheckConflict(s *state.State, services []string) error {
+	objects := make([]string, len(services))
+	for i, name := range services {
+		objects[i] = ServiceObject(name)
+	}
+	return state.CheckChangeConflict(s, objects, "")
+}
+
 // Start creates and returns a task set for starting the given services.
+// OCI services with an image have their image unpacked first.
 func Start(s *state.State, services []string) (*state.TaskSet, error) {
 	var tasks []*state.Task
 	for _, name := range services {
-		task := s.NewTask("start", fmt.Sprintf("Start service %q", name))
 		req := ServiceRequest{
 			Name: name,
 		}
+		if ociImage(s, name) != "" {
+			unpack := s.NewTask(unpackImageKind, fmt.Sprintf("Unpack image for service %q", name))
+			unpack.Set("service-request", &req)
+			unpack.SetAffected(ServiceObject(name))
+			if len(tasks) > 0 {
+				unpack.WaitFor(tasks[len(tasks)-1])
+			}
+			tasks = append(tasks, unpack)
+		}
+		task := s.NewTask("start", fmt.Sprintf("Start service %q", name))
 		task.Set("service-request", &req)
+		task.SetAffected(ServiceObject(name))
 		if len(tasks) > 0 {
 			// TODO Allow non-dependent services to start in parallel.
 			task.WaitFor(tasks[len(tasks)-1])
@@ -38,6 +66,7 @@ func Stop(s *state.State, services []string) (*state.TaskSet, error) {
 			Name: name,
 		}
 		task.Set("service-request", &req)
+		task.SetAffected(ServiceObject(name))
 		if len(tasks) > 1 {
 			// TODO Allow non-dependent services to stop in parallel.
 			task.WaitFor(tasks[len(tasks)-1])
@@ -18,6 +18,7 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/pebble/internals/overlord/servstate"
+	"github.com/canonical/pebble/internals/overlord/state"
 )
 
 func (s *S) TestStart(c *C) {
@@ -39,6 +40,7 @@ func (s *S) TestStart(c *C) {
 	req, err = servstate.TaskServiceRequest(tasks[1])
 	c.Assert(err, IsNil)
 	c.Assert(req.Name, Equals, "two")
+	c.Assert(tasks[1].Affected(), DeepEquals, []string{"service:two"})
 }
 
 func (s *S) TestStop(c *C) {
@@ -60,4 +62,20 @@ func (s *S) TestStop(c *C) {
 	req, err = servstate.TaskServiceRequest(tasks[1])
 	c.Assert(err, IsNil)
 	c.Assert(req.Name, Equals, "two")
+	c.Assert(tasks[1].Affected(), DeepEquals, []string{"service:two"})
+}
+
+func (s *S) TestCheckConflict(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	tset, err := servstate.Start(s.st, []string{"one", "two"})
+	c.Assert(err, IsNil)
+	chg := s.st.NewChange("start", "...")
+	chg.AddAll(tset)
+
+	c.Assert(servstate.CheckConflict(s.st, []string{"three"}), IsNil)
+	err = servstate.CheckConflict(s.st, []string{"three", "two"})
+	c.Assert(err, ErrorMatches, `service "two" has "start" change in progress`)
+	c.Assert(err, FitsTypeOf, &state.ChangeConflictError{})
 }
@@ -610,6 +610,21 @@ func (c *Change) Err() error {
 	return &changeError{errors}
 }
 
+// InternalError reports whether the change failed because the handler of
+// one of its tasks panicked (see Task.InternalError).
+func (c *Change) InternalError() bool {
+	c.state.reading()
+	if c.Status() != ErrorStatus {
+		return false
+	}
+	for _, tid := range c.taskIDs {
+		if c.state.tasks[tid].InternalError() {
+			return true
+		}
+	}
+	return false
+}
+
 // State returns the system State
 func (c *Change) State() *State {
 	return c.state
@@ -0,0 +1,124 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"fmt"
+	"strings"
+)
+
+// affectedKey is the task data key holding the objects the task affects.
+const affectedKey = "affected"
+
+// ObjectKey returns the key identifying an object that tasks operate on, for
+// example ObjectKey("service", "srv1") or ObjectKey("layer", "base").
+func ObjectKey(kind, name string) string {
+	return kind + ":" + name
+}
+
+// ChangeConflictError is returned by CheckChangeConflict when an object is
+// already being operated on by a change that isn't ready.
+type ChangeConflictError struct {
+	// Object is the key of the object, as returned by ObjectKey.
+	Object string
+
+	// ChangeKind and ChangeID identify the change in progress.
+	ChangeKind string
+	ChangeID   string
+}
+
+func (e *ChangeConflictError) Error() string {
+	kind, name, ok := strings.Cut(e.Object, ":")
+	if !ok {
+		return fmt.Sprintf("%q has %q change in progress", e.Object, e.ChangeKind)
+	}
+	return fmt.Sprintf("%s %q has %q change in progress", kind, name, e.ChangeKind)
+}
+
+// SetAffected records the objects the task operates on, as keys returned by
+// ObjectKey. Changes with tasks affecting the same objects conflict: see
+// CheckChangeConflict and ConflictBlocked.
+func (t *Task) SetAffected(objects ...string) {
+	t.Set(affectedKey, objects)
+}
+
+// Affected returns the objects the task operates on, as set by SetAffected.
+func (t *Task) Affected() []string {
+	var objects []string
+	t.Get(affectedKey, &objects)
+	return objects
+}
+
+// CheckChangeConflict returns a *ChangeConflictError if any of the given
+// objects is affected by an unfinished task of a change that isn't ready,
+// other than the change with the ID ignoreChangeID (if set). It's used to
+// reject a new change instead of letting it wait for the one in progress.
+func CheckChangeConflict(st *State, objects []string, ignoreChangeID string) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	wanted := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		wanted[object] = true
+	}
+	for _, chg := range st.Changes() {
+		if chg.IsReady() || chg.ID() == ignoreChangeID {
+			continue
+		}
+		for _, task := range chg.Tasks() {
+			if task.Status().Ready() {
+				continue
+			}
+			for _, object := range task.Affected() {
+				if wanted[object] {
+					return &ChangeConflictError{
+						Object:     object,
+						ChangeKind: chg.Kind(),
+						ChangeID:   chg.ID(),
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ConflictBlocked is a TaskRunner blocked predicate that holds back a task
+// while a running task of the same kind in another change affects any of the
+// same objects, so that a change repeating an operation in progress waits for
+// it to finish rather than racing it. Tasks of different kinds (such as a
+// service stop while it's starting) are left to the manager that owns the
+// object to arbitrate, as holding them back would queue each one behind the
+// full duration of the other.
+func ConflictBlocked(t *Task, running []*Task) bool {
+	affected := t.Affected()
+	if len(affected) == 0 {
+		return false
+	}
+	chg := t.Change()
+	for _, other := range running {
+		if other.Change() == chg || other.Kind() != t.Kind() {
+			continue
+		}
+		for _, object := range other.Affected() {
+			for _, wanted := range affected {
+				if object == wanted {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package state_test
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/testutil"
+)
+
+type conflictSuite struct{}
+
+var _ = Suite(&conflictSuite{})
+
+func (cs *conflictSuite) TestAffected(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	t := st.NewTask("foo", "...")
+	c.Assert(t.Affected(), HasLen, 0)
+	t.SetAffected(state.ObjectKey("service", "srv1"), state.ObjectKey("layer", "base"))
+	c.Assert(t.Affected(), DeepEquals, []string{"service:srv1", "layer:base"})
+}
+
+func (cs *conflictSuite) TestCheckChangeConflict(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("stop", "...")
+	t1 := st.NewTask("stop", "...")
+	t1.SetAffected("service:srv1")
+	t2 := st.NewTask("stop", "...")
+	t2.SetAffected("service:srv2")
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+
+	c.Assert(state.CheckChangeConflict(st, nil, ""), IsNil)
+	c.Assert(state.CheckChangeConflict(st, []string{"service:srv3", "layer:srv1"}, ""), IsNil)
+	c.Assert(state.CheckChangeConflict(st, []string{"service:srv1"}, chg.ID()), IsNil)
+
+	err := state.CheckChangeConflict(st, []string{"service:srv3", "service:srv2"}, "")
+	c.Assert(err, DeepEquals, &state.ChangeConflictError{
+		Object:     "service:srv2",
+		ChangeKind: "stop",
+		ChangeID:   chg.ID(),
+	})
+	c.Assert(err, ErrorMatches, `service "srv2" has "stop" change in progress`)
+
+	// Tasks that are finished no longer conflict.
+	t2.SetStatus(state.DoneStatus)
+	c.Assert(state.CheckChangeConflict(st, []string{"service:srv2"}, ""), IsNil)
+	c.Assert(state.CheckChangeConflict(st, []string{"service:srv1"}, ""), NotNil)
+
+	// Nor do changes that are ready.
+	t1.SetStatus(state.ErrorStatus)
+	c.Assert(state.CheckChangeConflict(st, []string{"service:srv1"}, ""), IsNil)
+}
+
+func (cs *conflictSuite) TestChangeConflictErrorNoKind(c *C) {
+	err := &state.ChangeConflictError{Object: "foo", ChangeKind: "bar"}
+	c.Assert(err, ErrorMatches, `"foo" has "bar" change in progress`)
+}
+
+func (cs *conflictSuite) TestConflictBlocked(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+	r.AddBlocked(state.ConflictBlocked)
+
+	started := make(chan string, 4)
+	release := make(chan bool)
+	r.AddHandler("op", func(t *state.Task, tb *tomb.Tomb) error {
+		started <- t.Summary()
+		<-release
+		return nil
+	}, nil)
+	r.AddHandler("other", func(t *state.Task, tb *tomb.Tomb) error {
+		started <- t.Summary()
+		<-release
+		return nil
+	}, nil)
+	addChange := func(name string, affected ...string) *state.Task {
+		st.Lock()
+		defer st.Unlock()
+		chg := st.NewChange("op", "...")
+		t := st.NewTask("op", name)
+		t.SetAffected(affected...)
+		chg.AddTask(t)
+		return t
+	}
+
+	t1 := addChange("t1", "service:srv1")
+	t2 := addChange("t2", "service:srv2")
+	r.Ensure()
+	c.Assert([]string{<-started, <-started}, testutil.DeepUnsortedMatches, []string{"t1", "t2"})
+
+	// A task affecting the same service as a running task of another
+	// change waits for it to finish.
+	t3 := addChange("t3", "service:srv3", "service:srv1")
+	r.Ensure()
+	select {
+	case name := <-started:
+		c.Fatalf("task %s started while blocked", name)
+	default:
+	}
+
+	// Tasks of other kinds aren't held back.
+	st.Lock()
+	chg := st.NewChange("other", "...")
+	t4 := st.NewTask("other", "t4")
+	t4.SetAffected("service:srv1")
+	chg.AddTask(t4)
+	st.Unlock()
+	r.Ensure()
+	c.Assert(<-started, Equals, "t4")
+
+	release <- true
+	release <- true
+	release <- true
+	r.Wait()
+
+	st.Lock()
+	c.Assert(t1.Status(), Equals, state.DoneStatus)
+	c.Assert(t2.Status(), Equals, state.DoneStatus)
+	c.Assert(t3.Status(), Equals, state.DoStatus)
+	c.Assert(t4.Status(), Equals, state.DoneStatus)
+	st.Unlock()
+
+	r.Ensure()
+	c.Assert(<-started, Equals, "t3")
+	release <- true
+	r.Wait()
+
+	st.Lock()
+	defer st.Unlock()
+	c.Assert(t3.Status(), Equals, state.DoneStatus)
+}
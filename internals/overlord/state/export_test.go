@@ -30,6 +30,16 @@ func FakeCheckpointRetryDelay(retryInterval, retryMaxTime time.Duration) (restor
 	}
 }
 
+// FakeHandlerPanicLocked changes what's called when a task handler panics
+// with the state locked.
+func FakeHandlerPanicLocked(f func(v interface{})) (restore func()) {
+	old := panicLocked
+	panicLocked = f
+	return func() {
+		panicLocked = old
+	}
+}
+
 func FakeChangeTimes(chg *Change, spawnTime, readyTime time.Time) {
 	chg.spawnTime = spawnTime
 	chg.readyTime = readyTime
@@ -74,3 +84,19 @@ var (
 func (s *State) NumNotices() int {
 	return len(s.notices)
 }
+
+// UnregisterNoticeType removes a notice type added by RegisterNoticeType.
+func UnregisterNoticeType(t NoticeType) {
+	registeredNoticeTypesLock.Lock()
+	defer registeredNoticeTypesLock.Unlock()
+	delete(registeredNoticeTypes, t)
+}
+
+// FakeLockThreshold changes the threshold for logging slow state lock holders.
+func FakeLockThreshold(threshold time.Duration) (restore func()) {
+	old := lockThreshold
+	lockThreshold = threshold
+	return func() {
+		lockThreshold = old
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/canonical/pebble/internals/logger"
+)
+
+// LockBuckets are the upper bounds of the buckets of the lock histograms.
+// Durations longer than the last bound are counted in a final bucket.
+var LockBuckets = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// lockThreshold is how long the state lock may be waited for or held before
+// a warning naming the caller of Lock is logged. If zero, callers aren't
+// recorded and nothing is logged.
+var lockThreshold = lockThresholdFromEnv()
+
+func lockThresholdFromEnv() time.Duration {
+	value := os.Getenv("PEBBLE_STATE_LOCK_THRESHOLD")
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		logger.Noticef("Invalid PEBBLE_STATE_LOCK_THRESHOLD %q, not logging slow state lock holders", value)
+		return 0
+	}
+	return d
+}
+
+// Histogram summarizes a set of durations, such as how long the state lock
+// was waited for or held.
+type Histogram struct {
+	Count uint64        `json:"count"`
+	Total time.Duration `json:"total"`
+	Max   time.Duration `json:"max"`
+
+	// Buckets holds the number of durations up to each of the bounds the
+	// durations were added with (such as LockBuckets), in the same order,
+	// followed by the number longer than the last bound.
+	Buckets []uint64 `json:"buckets"`
+}
+
+func (h *Histogram) add(d time.Duration, bounds []time.Duration) {
+	if h.Buckets == nil {
+		h.Buckets = make([]uint64, len(bounds)+1)
+	}
+	h.Count++
+	h.Total += d
+	if d > h.Max {
+		h.Max = d
+	}
+	i := 0
+	for i < len(bounds) && d > bounds[i] {
+		i++
+	}
+	h.Buckets[i]++
+}
+
+// LockStats holds statistics about the use of the state lock since the
+// state was created.
+type LockStats struct {
+	// Bounds are the upper bounds of the histogram buckets (LockBuckets).
+	Bounds []time.Duration `json:"bounds"`
+
+	// Wait summarizes how long callers waited to acquire the lock.
+	Wait Histogram `json:"wait"`
+	// Hold summarizes how long the lock was held, including the time taken
+	// to checkpoint the state on Unlock.
+	Hold Histogram `json:"hold"`
+}
+
+// lockTiming records the current holder of the state lock.
+type lockTiming struct {
+	stats  LockStats
+	start  time.Time
+	caller string
+}
+
+// LockStats returns statistics about the use of the state lock. The lock
+// currently held by the caller isn't included.
+func (s *State) LockStats() LockStats {
+	s.reading()
+	stats := s.lockTiming.stats
+	stats.Bounds = append([]time.Duration(nil), LockBuckets...)
+	stats.Wait.Buckets = append([]uint64(nil), stats.Wait.Buckets...)
+	stats.Hold.Buckets = append([]uint64(nil), stats.Hold.Buckets...)
+	return stats
+}
+
+// locked records that the lock was acquired after waiting since waitStart.
+// It must be called with the lock held.
+func (s *State) locked(waitStart time.Time) {
+	now := time.Now()
+	wait := now.Sub(waitStart)
+	s.lockTiming.stats.Wait.add(wait, LockBuckets)
+	s.lockTiming.start = now
+	s.lockTiming.caller = ""
+	if lockThreshold > 0 {
+		s.lockTiming.caller = lockCaller()
+		if wait > lockThreshold {
+			logger.Noticef("State lock waited for %s by %s", wait, s.lockTiming.caller)
+		}
+	}
+}
+
+// unlocking records that the lock is about to be released. It must be
+// called with the lock held.
+func (s *State) unlocking() {
+	hold := time.Since(s.lockTiming.start)
+	s.lockTiming.stats.Hold.add(hold, LockBuckets)
+	if lockThreshold > 0 && hold > lockThreshold {
+		logger.Noticef("State lock held for %s by %s", hold, s.lockTiming.caller)
+	}
+}
+
+// lockCaller returns the function and location that called State.Lock,
+// skipping the locking functions themselves and the sync package (for
+// locks taken by sync.Cond).
+func lockCaller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		switch frame.Function {
+		case "github.com/canonical/pebble/internals/overlord/state.(*State).Lock",
+			"sync.(*Cond).Wait":
+		default:
+			return fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown caller"
+		}
+	}
+}
+
+// goroutineID returns the ID of the calling goroutine, parsed from the
+// first line of its stack trace ("goroutine 123 [running]:").
+func goroutineID() uint64 {
+	var buf [64]byte
+	line := buf[:runtime.Stack(buf[:], false)]
+	line = bytes.TrimPrefix(line, []byte("goroutine "))
+	if i := bytes.IndexByte(line, ' '); i >= 0 {
+		line = line[:i]
+	}
+	id, _ := strconv.ParseUint(string(line), 10, 64)
+	return id
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package state_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+type lockingSuite struct{}
+
+var _ = Suite(&lockingSuite{})
+
+func (ls *lockingSuite) TestLockStats(c *C) {
+	st := state.New(nil)
+
+	st.Lock()
+	stats := st.LockStats()
+	c.Check(stats.Wait.Count, Equals, uint64(1))
+	c.Check(stats.Hold.Count, Equals, uint64(0))
+	time.Sleep(20 * time.Millisecond)
+	st.Unlock()
+
+	st.Lock()
+	defer st.Unlock()
+	stats = st.LockStats()
+	c.Check(stats.Wait.Count, Equals, uint64(2))
+	c.Check(stats.Wait.Buckets, HasLen, len(state.LockBuckets)+1)
+	c.Check(stats.Hold.Count, Equals, uint64(1))
+	c.Check(stats.Hold.Total >= 20*time.Millisecond, Equals, true)
+	c.Check(stats.Hold.Max, Equals, stats.Hold.Total)
+	// The hold of 20ms or more is in the 100ms bucket.
+	c.Check(stats.Hold.Buckets, DeepEquals, []uint64{0, 0, 1, 0, 0, 0})
+}
+
+func (ls *lockingSuite) TestLockStatsCopied(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	stats := st.LockStats()
+	stats.Wait.Buckets[0] = 42
+	c.Check(st.LockStats().Wait.Buckets[0], Not(Equals), uint64(42))
+	st.Unlock()
+}
+
+func (ls *lockingSuite) TestSlowHolderLogged(c *C) {
+	logbuf, restore := logger.MockLogger("PREFIX: ")
+	defer restore()
+	restore = state.FakeLockThreshold(10 * time.Millisecond)
+	defer restore()
+
+	st := state.New(nil)
+	st.Lock()
+	st.Unlock()
+	c.Check(logbuf.String(), Equals, "")
+
+	st.Lock()
+	time.Sleep(20 * time.Millisecond)
+	st.Unlock()
+	c.Check(logbuf.String(), Matches, `(?s).*PREFIX: State lock held for \S+ by .*/state_test\.\(\*lockingSuite\)\.TestSlowHolderLogged \(.*locking_test\.go:\d+\)\n`)
+}
+
+func (ls *lockingSuite) TestSlowWaiterLogged(c *C) {
+	logbuf, restore := logger.MockLogger("PREFIX: ")
+	defer restore()
+	restore = state.FakeLockThreshold(10 * time.Millisecond)
+	defer restore()
+
+	st := state.New(nil)
+	st.Lock()
+	done := make(chan struct{})
+	go func() {
+		st.Lock()
+		st.Unlock()
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	st.Unlock()
+	<-done
+	c.Check(logbuf.String(), Matches, `(?s).*PREFIX: State lock waited for \S+ by .*TestSlowWaiterLogged.func1 .*`)
+}
+
+func (ls *lockingSuite) TestNoThresholdNotLogged(c *C) {
+	logbuf, restore := logger.MockLogger("PREFIX: ")
+	defer restore()
+	restore = state.FakeLockThreshold(0)
+	defer restore()
+
+	st := state.New(nil)
+	st.Lock()
+	time.Sleep(5 * time.Millisecond)
+	st.Unlock()
+	c.Check(logbuf.String(), Equals, "")
+}
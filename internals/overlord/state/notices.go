@@ -18,8 +18,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -100,6 +102,26 @@ func (n *Notice) UserID() (userID uint32, isSet bool) {
 	return flattenUserID(n.userID)
 }
 
+// ID returns the notice's unique ID.
+func (n *Notice) ID() string {
+	return n.id
+}
+
+// Type returns the notice's type.
+func (n *Notice) Type() NoticeType {
+	return n.noticeType
+}
+
+// Key returns the notice's key.
+func (n *Notice) Key() string {
+	return n.key
+}
+
+// LastRepeated returns the time the notice was last repeated.
+func (n *Notice) LastRepeated() time.Time {
+	return n.lastRepeated
+}
+
 func flattenUserID(userID *uint32) (uid uint32, isSet bool) {
 	if userID == nil {
 		return 0, false
@@ -193,19 +215,60 @@ const (
 	CustomNotice NoticeType = "custom"
 
 	// Warnings are a subset of notices where the key is a human-readable
-	// warning message.
-	//
-	// NOTE: This isn't used yet. See comment at the top of
-	// internals/overlord/state/notices.go for more info.
+	// warning message. These are recorded, for example, when a log target
+	// has been failing to deliver logs for a while.
 	WarningNotice NoticeType = "warning"
+
+	// Recorded when a task handler panics, which is a bug in Pebble (or an
+	// extension) rather than an operational failure. The key is the change
+	// ID, and the data includes the change kind, the task ID and kind, and
+	// the panic value.
+	InternalErrorNotice NoticeType = "internal-error"
 )
 
+var (
+	registeredNoticeTypesLock sync.RWMutex
+	registeredNoticeTypes     = make(map[NoticeType]bool)
+
+	noticeTypeRegexp = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
+)
+
+// RegisterNoticeType registers an additional notice type, so that managers
+// and extensions outside this package can record notices of their own type
+// (for example "firmware-update-available"). Once registered, the type is
+// valid for AddNotice, and clients can filter on it when listing or waiting
+// for notices.
+//
+// Notice types must be lowercase words separated by single hyphens, and may
+// not be registered more than once or clash with a built-in type. This is
+// normally called during initialization, before the overlord is started.
+func RegisterNoticeType(t NoticeType) error {
+	if !noticeTypeRegexp.MatchString(string(t)) {
+		return fmt.Errorf("invalid notice type %q: must be lowercase words separated by hyphens", t)
+	}
+	switch t {
+	case ChangeUpdateNotice, CustomNotice, WarningNotice, InternalErrorNotice:
+		return fmt.Errorf("cannot register built-in notice type %q", t)
+	}
+
+	registeredNoticeTypesLock.Lock()
+	defer registeredNoticeTypesLock.Unlock()
+	if registeredNoticeTypes[t] {
+		return fmt.Errorf("notice type %q already registered", t)
+	}
+	registeredNoticeTypes[t] = true
+	return nil
+}
+
+// Valid reports whether the notice type is a built-in or registered type.
 func (t NoticeType) Valid() bool {
 	switch t {
-	case ChangeUpdateNotice, CustomNotice, WarningNotice:
+	case ChangeUpdateNotice, CustomNotice, WarningNotice, InternalErrorNotice:
 		return true
 	}
-	return false
+	registeredNoticeTypesLock.RLock()
+	defer registeredNoticeTypesLock.RUnlock()
+	return registeredNoticeTypes[t]
 }
 
 // AddNoticeOptions holds optional parameters for an AddNotice call.
@@ -232,7 +295,12 @@ func (s *State) AddNotice(userID *uint32, noticeType NoticeType, key string, opt
 		return "", err
 	}
 
-	s.writing()
+	if s.memoryOnlyNoticeTypes[noticeType] {
+		// Not written to disk, so doesn't require a checkpoint.
+		s.reading()
+	} else {
+		s.writing()
+	}
 
 	now := options.Time
 	if now.IsZero() {
@@ -308,6 +376,10 @@ type NoticeFilter struct {
 
 	// After, if set, includes only notices that were last repeated after this time.
 	After time.Time
+
+	// excludeTypes excludes notices of these types, for example when
+	// flattening notices to write to disk.
+	excludeTypes map[NoticeType]bool
 }
 
 // matches reports whether the notice n matches this filter
@@ -322,6 +394,9 @@ func (f *NoticeFilter) matches(n *Notice) bool {
 	if len(f.Types) > 0 && !sliceContains(f.Types, n.noticeType) {
 		return false
 	}
+	if f.excludeTypes[n.noticeType] {
+		return false
+	}
 	if len(f.Keys) > 0 && !sliceContains(f.Keys, n.key) {
 		return false
 	}
@@ -379,6 +454,28 @@ func (s *State) flattenNotices(filter *NoticeFilter) []*Notice {
 	return notices
 }
 
+// SetMemoryOnlyNoticeTypes sets the notice types that are kept in memory
+// only, rather than being written to the state file, for example to avoid
+// writing the state for each of many high-frequency custom notices. Notices
+// of these types are lost when the daemon restarts.
+func (s *State) SetMemoryOnlyNoticeTypes(types []NoticeType) error {
+	s.reading()
+	memoryOnly := make(map[NoticeType]bool, len(types))
+	for _, t := range types {
+		if !t.Valid() {
+			return fmt.Errorf("invalid notice type %q", t)
+		}
+		memoryOnly[t] = true
+	}
+	s.memoryOnlyNoticeTypes = memoryOnly
+	return nil
+}
+
+// persistedNotices returns the notices to write to the state file.
+func (s *State) persistedNotices() []*Notice {
+	return s.flattenNotices(&NoticeFilter{excludeTypes: s.memoryOnlyNoticeTypes})
+}
+
 func (s *State) unflattenNotices(flat []*Notice) {
 	now := time.Now()
 	s.notices = make(map[noticeKey]*Notice)
@@ -604,6 +604,101 @@ func (s *noticesSuite) TestWaitNoticesConcurrent(c *C) {
 	}
 }
 
+func (s *noticesSuite) TestRegisterNoticeType(c *C) {
+	const fooType state.NoticeType = "foo-update-available"
+	c.Check(fooType.Valid(), Equals, false)
+
+	err := state.RegisterNoticeType(fooType)
+	c.Assert(err, IsNil)
+	defer state.UnregisterNoticeType(fooType)
+	c.Check(fooType.Valid(), Equals, true)
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	addNotice(c, st, nil, state.CustomNotice, "foo.com/bar", nil)
+	time.Sleep(time.Microsecond)
+	addNotice(c, st, nil, fooType, "v2", nil)
+
+	notices := st.Notices(&state.NoticeFilter{Types: []state.NoticeType{fooType}})
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["type"], Equals, "foo-update-available")
+	c.Check(n["key"], Equals, "v2")
+
+	err = state.RegisterNoticeType(fooType)
+	c.Check(err, ErrorMatches, `notice type "foo-update-available" already registered`)
+}
+
+func (s *noticesSuite) TestMemoryOnlyNoticeTypes(c *C) {
+	backend := &fakeStateBackend{}
+	st := state.New(backend)
+	st.Lock()
+	err := st.SetMemoryOnlyNoticeTypes([]state.NoticeType{state.CustomNotice})
+	c.Assert(err, IsNil)
+	st.Unlock()
+	c.Assert(backend.checkpoints, HasLen, 1) // initial checkpoint of new state
+
+	// Adding a memory-only notice doesn't checkpoint the state.
+	st.Lock()
+	addNotice(c, st, nil, state.CustomNotice, "foo.com/bar", nil)
+	st.Unlock()
+	c.Assert(backend.checkpoints, HasLen, 1)
+
+	// But the notice is still available in memory.
+	st.Lock()
+	notices := st.Notices(nil)
+	st.Unlock()
+	c.Assert(notices, HasLen, 1)
+	c.Check(notices[0].String(), Equals, "Notice 1 (public:custom:foo.com/bar)")
+
+	// Other notice types are written, but memory-only ones are excluded.
+	st.Lock()
+	addNotice(c, st, nil, state.ChangeUpdateNotice, "123", nil)
+	st.Unlock()
+	c.Assert(backend.checkpoints, HasLen, 2)
+
+	st2, err := state.ReadState(nil, bytes.NewReader(backend.checkpoints[1]))
+	c.Assert(err, IsNil)
+	st2.Lock()
+	defer st2.Unlock()
+	notices = st2.Notices(nil)
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["type"], Equals, "change-update")
+	c.Check(n["key"], Equals, "123")
+}
+
+func (s *noticesSuite) TestSetMemoryOnlyNoticeTypesInvalid(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	err := st.SetMemoryOnlyNoticeTypes([]state.NoticeType{state.CustomNotice, "Foo"})
+	c.Check(err, ErrorMatches, `invalid notice type "Foo"`)
+}
+
+func (s *noticesSuite) TestRegisterNoticeTypeInvalid(c *C) {
+	for _, t := range []state.NoticeType{"", "Foo", "foo_bar", "foo--bar", "-foo", "foo-", "1foo"} {
+		err := state.RegisterNoticeType(t)
+		c.Check(err, ErrorMatches, `invalid notice type .*`, Commentf("%q", t))
+	}
+	for _, t := range []state.NoticeType{state.ChangeUpdateNotice, state.CustomNotice, state.WarningNotice} {
+		err := state.RegisterNoticeType(t)
+		c.Check(err, ErrorMatches, `cannot register built-in notice type .*`)
+	}
+}
+
+func (s *noticesSuite) TestAddNoticeUnregisteredType(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	_, err := st.AddNotice(nil, "not-registered", "key", nil)
+	c.Check(err, ErrorMatches, `internal error: attempted to add notice with invalid type "not-registered"`)
+}
+
 // noticeToMap converts a Notice to a map using a JSON marshal-unmarshal round trip.
 func noticeToMap(c *C, notice *state.Notice) map[string]any {
 	buf, err := json.Marshal(notice)
@@ -0,0 +1,129 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TaskWaitBuckets are the upper bounds of the buckets of the task wait time
+// histograms. Durations longer than the last bound are counted in a final
+// bucket.
+var TaskWaitBuckets = []time.Duration{
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// TaskWaitStats holds statistics about how long tasks waited to be run by
+// the task runner, after they were ready to run (that is, the tasks they
+// wait for were done and any time they were scheduled for had passed).
+type TaskWaitStats struct {
+	// Bounds are the upper bounds of the histogram buckets
+	// (TaskWaitBuckets).
+	Bounds []time.Duration `json:"bounds"`
+
+	// Kinds maps each task kind to a summary of the wait times of the
+	// tasks of that kind that have been run.
+	Kinds map[string]Histogram `json:"kinds"`
+}
+
+// SetPriority sets the priority of tasks of the given kind, which is zero
+// by default. Of the tasks that are ready to run, those with a higher
+// priority are started first, and those with the same priority are started
+// in the order they became ready. This matters when the number of running
+// tasks is limited by SetMaxRunning, or when tasks are held back by blocked
+// predicates, so that critical tasks don't wait behind routine ones.
+func (r *TaskRunner) SetPriority(kind string, priority int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if priority == 0 {
+		delete(r.priorities, kind)
+		return
+	}
+	r.priorities[kind] = priority
+}
+
+// SetMaxRunning limits how many tasks may run at once. Tasks beyond the limit
+// wait, in priority order, for running tasks to finish. Zero (the default)
+// means no limit.
+func (r *TaskRunner) SetMaxRunning(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.maxRunning = n
+}
+
+// WaitStats returns statistics about how long tasks waited to be run after
+// they were ready to run, by task kind.
+func (r *TaskRunner) WaitStats() TaskWaitStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := TaskWaitStats{
+		Bounds: append([]time.Duration(nil), TaskWaitBuckets...),
+		Kinds:  make(map[string]Histogram, len(r.waitStats)),
+	}
+	for kind, h := range r.waitStats {
+		copied := *h
+		copied.Buckets = append([]uint64(nil), h.Buckets...)
+		stats.Kinds[kind] = copied
+	}
+	return stats
+}
+
+// recordWait records how long a task of the given kind waited to be run.
+// It must be called with r.mu held.
+func (r *TaskRunner) recordWait(kind string, wait time.Duration) {
+	h := r.waitStats[kind]
+	if h == nil {
+		h = &Histogram{}
+		r.waitStats[kind] = h
+	}
+	h.add(wait, TaskWaitBuckets)
+}
+
+// sortByPriority sorts the tasks that are ready to run so that those with a
+// higher priority come first, followed by those that have been ready for
+// longest. Task IDs break ties, so that the order is stable. It must be
+// called with r.mu held.
+func (r *TaskRunner) sortByPriority(tasks []*Task, readySince map[string]time.Time) {
+	sort.Slice(tasks, func(i, j int) bool {
+		pi, pj := r.priorities[tasks[i].Kind()], r.priorities[tasks[j].Kind()]
+		if pi != pj {
+			return pi > pj
+		}
+		si, sj := readySince[tasks[i].ID()], readySince[tasks[j].ID()]
+		if !si.Equal(sj) {
+			return si.Before(sj)
+		}
+		return taskIDLess(tasks[i].ID(), tasks[j].ID())
+	})
+}
+
+// taskIDLess orders task IDs numerically where possible.
+func taskIDLess(a, b string) bool {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return na < nb
+	}
+	return a < b
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package state_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/overlord/state"
+)
+
+type schedulingSuite struct{}
+
+var _ = Suite(&schedulingSuite{})
+
+func (ss *schedulingSuite) TestPriorityAndMaxRunning(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+	r.SetMaxRunning(1)
+	r.SetPriority("high", 10)
+	r.SetPriority("low", -10)
+
+	started := make(chan string, 4)
+	handler := func(t *state.Task, tb *tomb.Tomb) error {
+		started <- t.Summary()
+		return nil
+	}
+	for _, kind := range []string{"low", "normal", "high"} {
+		r.AddHandler(kind, handler, nil)
+	}
+
+	st.Lock()
+	for _, name := range []string{"low", "normal1", "high", "normal2"} {
+		chg := st.NewChange("op", "...")
+		kind := name
+		if kind == "normal1" || kind == "normal2" {
+			kind = "normal"
+		}
+		chg.AddTask(st.NewTask(kind, name))
+	}
+	st.Unlock()
+
+	// Only one task runs per pass, highest priority first, then in the
+	// order the tasks became ready.
+	var order []string
+	for i := 0; i < 4; i++ {
+		r.Ensure()
+		r.Wait()
+		order = append(order, <-started)
+		select {
+		case name := <-started:
+			c.Fatalf("task %s started beyond the limit", name)
+		default:
+		}
+	}
+	c.Check(order, DeepEquals, []string{"high", "normal1", "normal2", "low"})
+}
+
+func (ss *schedulingSuite) TestWaitStats(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+	r.SetMaxRunning(1)
+	r.SetPriority("first", 1)
+
+	handler := func(t *state.Task, tb *tomb.Tomb) error { return nil }
+	r.AddHandler("first", handler, nil)
+	r.AddHandler("second", handler, nil)
+
+	st.Lock()
+	chg := st.NewChange("op", "...")
+	chg.AddTask(st.NewTask("first", "..."))
+	chg.AddTask(st.NewTask("second", "..."))
+	st.Unlock()
+
+	stats := r.WaitStats()
+	c.Check(stats.Bounds, DeepEquals, state.TaskWaitBuckets)
+	c.Check(stats.Kinds, HasLen, 0)
+
+	now := time.Now()
+	restore := state.FakeTime(now)
+	defer restore()
+	r.Ensure()
+	r.Wait()
+
+	// The second task has been ready since the first pass.
+	state.FakeTime(now.Add(2 * time.Second))
+	r.Ensure()
+	r.Wait()
+
+	stats = r.WaitStats()
+	c.Check(stats.Kinds, DeepEquals, map[string]state.Histogram{
+		"first": {
+			Count:   1,
+			Buckets: []uint64{1, 0, 0, 0, 0, 0},
+		},
+		"second": {
+			Count:   1,
+			Total:   2 * time.Second,
+			Max:     2 * time.Second,
+			Buckets: []uint64{0, 0, 0, 1, 0, 0},
+		},
+	})
+}
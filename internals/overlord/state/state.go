@@ -36,6 +36,12 @@ type Backend interface {
 	EnsureBefore(d time.Duration)
 }
 
+// A flusher is a Backend that may defer checkpoints, writing them later.
+// Flush writes the most recent deferred checkpoint immediately.
+type flusher interface {
+	Flush() error
+}
+
 type customData map[string]*json.RawMessage
 
 func (data customData) get(key string, value interface{}) error {
@@ -79,6 +85,12 @@ type State struct {
 	mu  sync.Mutex
 	muC int32
 
+	// owner is the ID of the goroutine that acquired the lock, or 0 if
+	// it's not held.
+	owner atomic.Uint64
+
+	lockTiming lockTiming
+
 	lastTaskId   int
 	lastChangeId int
 	lastLaneId   int
@@ -94,6 +106,9 @@ type State struct {
 	warnings map[string]*Warning
 	notices  map[noticeKey]*Notice
 
+	// notice types that aren't written to the state file
+	memoryOnlyNoticeTypes map[NoticeType]bool
+
 	noticeCond *sync.Cond
 
 	modified bool
@@ -110,17 +125,18 @@ type State struct {
 // New returns a new empty state.
 func New(backend Backend) *State {
 	st := &State{
-		backend:             backend,
-		data:                make(customData),
-		changes:             make(map[string]*Change),
-		tasks:               make(map[string]*Task),
-		warnings:            make(map[string]*Warning),
-		notices:             make(map[noticeKey]*Notice),
-		modified:            true,
-		cache:               make(map[interface{}]interface{}),
-		pendingChangeByAttr: make(map[string]func(*Change) bool),
-		taskHandlers:        make(map[int]func(t *Task, old Status, new Status)),
-		changeHandlers:      make(map[int]func(chg *Change, old Status, new Status)),
+		backend:               backend,
+		data:                  make(customData),
+		changes:               make(map[string]*Change),
+		tasks:                 make(map[string]*Task),
+		warnings:              make(map[string]*Warning),
+		notices:               make(map[noticeKey]*Notice),
+		memoryOnlyNoticeTypes: make(map[NoticeType]bool),
+		modified:              true,
+		cache:                 make(map[interface{}]interface{}),
+		pendingChangeByAttr:   make(map[string]func(*Change) bool),
+		taskHandlers:          make(map[int]func(t *Task, old Status, new Status)),
+		changeHandlers:        make(map[int]func(chg *Change, old Status, new Status)),
 	}
 	st.noticeCond = sync.NewCond(st) // use State.Lock and State.Unlock
 	return st
@@ -133,8 +149,17 @@ func (s *State) Modified() bool {
 
 // Lock acquires the state lock.
 func (s *State) Lock() {
+	waitStart := time.Now()
 	s.mu.Lock()
 	atomic.AddInt32(&s.muC, 1)
+	s.owner.Store(goroutineID())
+	s.locked(waitStart)
+}
+
+// lockHeldByCaller reports whether the state lock is held by the calling
+// goroutine, such as by a task handler that panicked without unlocking it.
+func (s *State) lockHeldByCaller() bool {
+	return s.owner.Load() == goroutineID()
 }
 
 func (s *State) reading() {
@@ -151,6 +176,8 @@ func (s *State) writing() {
 }
 
 func (s *State) unlock() {
+	s.unlocking()
+	s.owner.Store(0)
 	atomic.AddInt32(&s.muC, -1)
 	s.mu.Unlock()
 }
@@ -176,7 +203,7 @@ func (s *State) MarshalJSON() ([]byte, error) {
 		Changes:  s.changes,
 		Tasks:    s.tasks,
 		Warnings: s.flattenWarnings(),
-		Notices:  s.flattenNotices(nil),
+		Notices:  s.persistedNotices(),
 
 		LastTaskId:   s.lastTaskId,
 		LastChangeId: s.lastChangeId,
@@ -246,12 +273,24 @@ func (s *State) Unlock() {
 	if !s.modified || s.backend == nil {
 		return
 	}
+	s.checkpoint(false)
+}
 
+// checkpoint checkpoints the state, flushing it to disk if flush is set and
+// the backend defers checkpoints. After too many unsuccessful attempts, it
+// panics.
+func (s *State) checkpoint(flush bool) {
 	data := s.checkpointData()
 	var err error
 	start := time.Now()
 	for time.Since(start) <= unlockCheckpointRetryMaxTime {
-		if err = s.backend.Checkpoint(data); err == nil {
+		err = s.backend.Checkpoint(data)
+		if err == nil && flush {
+			if f, ok := s.backend.(flusher); ok {
+				err = f.Flush()
+			}
+		}
+		if err == nil {
 			s.modified = false
 			return
 		}
@@ -260,6 +299,18 @@ func (s *State) Unlock() {
 	logger.Panicf("cannot checkpoint even after %v of retries every %v: %v", unlockCheckpointRetryMaxTime, unlockCheckpointRetryInterval, err)
 }
 
+// ForceCheckpoint writes the state to disk before returning, even if the
+// backend defers checkpoints. It should be used for changes that must not be
+// lost if the process exits, such as before a restart. The state lock must
+// be held.
+func (s *State) ForceCheckpoint() {
+	s.writing()
+	if s.backend == nil {
+		return
+	}
+	s.checkpoint(true)
+}
+
 // EnsureBefore asks for an ensure pass to happen sooner within duration from now.
 func (s *State) EnsureBefore(d time.Duration) {
 	if s.backend != nil {
@@ -306,6 +357,17 @@ func (s *State) Has(key string) bool {
 	return s.data.has(key)
 }
 
+// DataKeys returns the keys that have an associated value, in sorted order.
+func (s *State) DataKeys() []string {
+	s.reading()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Set associates value with key for future consulting by managers.
 // The provided value must properly marshal and unmarshal with encoding/json.
 func (s *State) Set(key string, value interface{}) {
@@ -593,6 +655,7 @@ func ReadState(backend Backend, r io.Reader) (*State, error) {
 	s.backend = backend
 	s.noticeCond = sync.NewCond(s)
 	s.modified = false
+	s.memoryOnlyNoticeTypes = make(map[NoticeType]bool)
 	s.cache = make(map[interface{}]interface{})
 	s.pendingChangeByAttr = make(map[string]func(*Change) bool)
 	s.changeHandlers = make(map[int]func(chg *Change, old Status, new Status))
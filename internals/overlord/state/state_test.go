@@ -98,6 +98,20 @@ func (ss *stateSuite) TestHas(c *C) {
 	c.Check(st.Has("a"), Equals, false)
 }
 
+func (ss *stateSuite) TestDataKeys(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	c.Check(st.DataKeys(), HasLen, 0)
+
+	st.Set("b", 1)
+	st.Set("a", 2)
+	st.Set("c", 3)
+	st.Set("c", nil)
+	c.Check(st.DataKeys(), DeepEquals, []string{"a", "b"})
+}
+
 func (ss *stateSuite) TestStrayTaskWithNoChange(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -572,6 +586,7 @@ func (ss *stateSuite) TestEmptyStateDataAndCheckpointReadAndSet(c *C) {
 		"tasks",
 		"warnings",
 		"notices",
+		"memoryOnlyNoticeTypes",
 		"cache",
 		"pendingChangeByAttr",
 		"taskHandlers",
@@ -685,6 +700,79 @@ func (ss *stateSuite) TestCheckpointPreserveCleanStatus(c *C) {
 	c.Assert(t2.IsClean(), Equals, true)
 }
 
+type fakeFlushingBackend struct {
+	fakeStateBackend
+	flushes    int
+	flushError func() error
+}
+
+func (b *fakeFlushingBackend) Flush() error {
+	b.flushes++
+	if b.flushError != nil {
+		return b.flushError()
+	}
+	return nil
+}
+
+func (ss *stateSuite) TestForceCheckpoint(c *C) {
+	b := new(fakeFlushingBackend)
+	st := state.New(b)
+
+	st.Lock()
+	st.Set("v", 1)
+	st.Unlock()
+	c.Check(b.checkpoints, HasLen, 1)
+	c.Check(b.flushes, Equals, 0)
+
+	// The state is written before ForceCheckpoint returns, so there's
+	// nothing left to write on unlock.
+	st.Lock()
+	st.Set("v", 2)
+	st.ForceCheckpoint()
+	c.Check(b.checkpoints, HasLen, 2)
+	c.Check(b.flushes, Equals, 1)
+	st.Unlock()
+	c.Check(b.checkpoints, HasLen, 2)
+	c.Check(b.flushes, Equals, 1)
+
+	// Later unlocks aren't forced.
+	st.Lock()
+	st.Set("v", 3)
+	st.Unlock()
+	c.Check(b.checkpoints, HasLen, 3)
+	c.Check(b.flushes, Equals, 1)
+}
+
+func (ss *stateSuite) TestForceCheckpointRetries(c *C) {
+	restore := state.FakeCheckpointRetryDelay(2*time.Millisecond, 1*time.Second)
+	defer restore()
+
+	b := new(fakeFlushingBackend)
+	b.flushError = func() error {
+		if b.flushes < 3 {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	st := state.New(b)
+	st.Lock()
+	st.ForceCheckpoint()
+	st.Unlock()
+
+	// The checkpoint is retried along with the flush.
+	c.Check(b.flushes, Equals, 3)
+	c.Check(b.checkpoints, HasLen, 3)
+}
+
+func (ss *stateSuite) TestForceCheckpointNoFlusher(c *C) {
+	b := new(fakeStateBackend)
+	st := state.New(b)
+	st.Lock()
+	st.ForceCheckpoint()
+	st.Unlock()
+	c.Check(b.checkpoints, HasLen, 1)
+}
+
 func (ss *stateSuite) TestNewTaskAndTasks(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -475,6 +475,15 @@ func (t *Task) Has(key string) bool {
 	return t.data.has(key)
 }
 
+// internalErrorKey is the task data key set when the task's handler panicked.
+const internalErrorKey = "internal-error"
+
+// InternalError reports whether the task failed because its handler
+// panicked, rather than by returning an error.
+func (t *Task) InternalError() bool {
+	return t.Status() == ErrorStatus && t.Has(internalErrorKey)
+}
+
 // Clear disassociates the value from key.
 func (t *Task) Clear(key string) {
 	t.state.writing()
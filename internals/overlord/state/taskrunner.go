@@ -15,6 +15,8 @@
 package state
 
 import (
+	"fmt"
+	"runtime/debug"
 	"sync"
 	"time"
 
@@ -58,6 +60,41 @@ func (r *Wait) Error() string {
 	return "task set to wait, manual action required"
 }
 
+// PanicError is the error a task fails with when its handler panics. Such a
+// failure is a bug rather than an operational failure, so the task and its
+// change are marked as having an internal error (see Task.InternalError and
+// Change.InternalError).
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("internal error: task handler panicked: %v", e.Value)
+}
+
+// panicLocked is called with the value of a handler panic that happened
+// with the state locked by the handler.
+var panicLocked = func(v interface{}) { panic(v) }
+
+// callHandler calls the handler, returning a *PanicError if it panics. If
+// the handler panicked with the state locked, which can't safely be unlocked
+// from here, the panic is propagated instead, as carrying on would deadlock.
+func callHandler(handler HandlerFunc, t *Task, tb *tomb.Tomb) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if t.State().lockHeldByCaller() {
+				panicLocked(v)
+			}
+			err = &PanicError{Value: v, Stack: string(debug.Stack())}
+		}
+	}()
+	return handler(t, tb)
+}
+
 type blockedFunc func(t *Task, running []*Task) bool
 
 // TaskRunner controls the running of goroutines to execute known task kinds.
@@ -74,6 +111,12 @@ type TaskRunner struct {
 	blocked     []blockedFunc
 	someBlocked bool
 
+	// scheduling
+	priorities map[string]int
+	maxRunning int
+	readySince map[string]time.Time
+	waitStats  map[string]*Histogram
+
 	// optional callback executed on task errors
 	taskErrorCallback func(err error)
 
@@ -93,10 +136,13 @@ type optionalHandler struct {
 // NewTaskRunner creates a new TaskRunner
 func NewTaskRunner(s *State) *TaskRunner {
 	return &TaskRunner{
-		state:    s,
-		handlers: make(map[string]handlerPair),
-		cleanups: make(map[string]HandlerFunc),
-		tombs:    make(map[string]*tomb.Tomb),
+		state:      s,
+		handlers:   make(map[string]handlerPair),
+		cleanups:   make(map[string]HandlerFunc),
+		tombs:      make(map[string]*tomb.Tomb),
+		priorities: make(map[string]int),
+		readySince: make(map[string]time.Time),
+		waitStats:  make(map[string]*Histogram),
 	}
 }
 
@@ -217,7 +263,7 @@ func (r *TaskRunner) run(t *Task) {
 		// use tomb.Err uniformly to consider both it or a
 		// overriding previous Kill reason.
 		t0 := time.Now()
-		tomb.Kill(handler(t, tomb))
+		tomb.Kill(callHandler(handler, t, tomb))
 		t1 := time.Now()
 
 		// Locks must be acquired in the same order everywhere.
@@ -239,7 +285,7 @@ func (r *TaskRunner) run(t *Task) {
 		switch err.(type) {
 		case nil:
 			// we are ok
-		case *Retry, *Wait:
+		case *Retry, *Wait, *PanicError:
 			// preserve
 		default:
 			if r.stopped {
@@ -295,8 +341,12 @@ func (r *TaskRunner) run(t *Task) {
 			r.abortLanes(t.Change(), t.Lanes())
 			t.SetStatus(ErrorStatus)
 			t.Errorf("%s", err)
+			if panicErr, ok := err.(*PanicError); ok {
+				r.recordPanic(t, panicErr)
+			}
 			// ensure the error is available in the global log too
-			logger.Noticef("Change %s task (%s) failed: %v", t.Change().ID(), t.Summary(), err)
+			fields := logger.Fields{Component: "taskrunner", Change: t.Change().ID()}
+			logger.WithFields(fields).Noticef("Change %s task (%s) failed: %v", t.Change().ID(), t.Summary(), err)
 			if r.taskErrorCallback != nil {
 				r.taskErrorCallback(err)
 			}
@@ -306,6 +356,25 @@ func (r *TaskRunner) run(t *Task) {
 	})
 }
 
+// recordPanic adds the stack trace of the panic to the task log, marks the
+// task as having an internal error, and records an internal-error notice.
+func (r *TaskRunner) recordPanic(t *Task, err *PanicError) {
+	t.Logf("Stack trace of task handler panic:\n%s", err.Stack)
+	t.Set(internalErrorKey, true)
+	chg := t.Change()
+	_, noticeErr := r.state.AddNotice(nil, InternalErrorNotice, chg.ID(), &AddNoticeOptions{
+		Data: map[string]string{
+			"kind":      chg.Kind(),
+			"task-id":   t.ID(),
+			"task-kind": t.Kind(),
+			"panic":     fmt.Sprint(err.Value),
+		},
+	})
+	if noticeErr != nil {
+		logger.Noticef("Cannot record internal-error notice: %v", noticeErr)
+	}
+}
+
 func (r *TaskRunner) clean(t *Task) {
 	if !t.Change().IsReady() {
 		// Whole Change is not ready so don't run cleanups yet.
@@ -399,7 +468,8 @@ func (r *TaskRunner) Ensure() error {
 
 	ensureTime := timeNow()
 	nextTaskTime := time.Time{}
-ConsiderTasks:
+	readySince := make(map[string]time.Time)
+	var ready []*Task
 	for _, t := range r.state.Tasks() {
 		handlers := r.handlerPair(t)
 		if handlers.do == nil {
@@ -459,6 +529,23 @@ ConsiderTasks:
 			continue
 		}
 
+		since, ok := r.readySince[t.ID()]
+		if !ok {
+			since = ensureTime
+		}
+		readySince[t.ID()] = since
+		ready = append(ready, t)
+	}
+	r.readySince = readySince
+
+	r.sortByPriority(ready, readySince)
+ConsiderTasks:
+	for _, t := range ready {
+		if r.maxRunning > 0 && len(running) >= r.maxRunning {
+			r.someBlocked = true
+			break
+		}
+
 		// check if any of the blocked predicates returns true
 		// and skip the task if so
 		for _, blocked := range r.blocked {
@@ -469,6 +556,8 @@ ConsiderTasks:
 		}
 
 		logger.Debugf("Running task %s on %s: %s", t.ID(), t.Status(), t.Summary())
+		r.recordWait(t.Kind(), ensureTime.Sub(readySince[t.ID()]))
+		delete(r.readySince, t.ID())
 		r.run(t)
 
 		running = append(running, t)
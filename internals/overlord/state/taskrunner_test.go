@@ -774,6 +774,148 @@ func (ts *taskRunnerSuite) TestErrorsOnStopAreRetried(c *C) {
 	c.Check(t.Status(), Equals, state.DoingStatus)
 }
 
+func (ts *taskRunnerSuite) TestHandlerPanic(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	var panicErr *state.PanicError
+	r.OnTaskError(func(err error) {
+		if e, ok := err.(*state.PanicError); ok {
+			panicErr = e
+		}
+	})
+	r.AddHandler("panic", func(t *state.Task, tb *tomb.Tomb) error {
+		panic("boom")
+	}, nil)
+	r.AddHandler("fail", func(t *state.Task, tb *tomb.Tomb) error {
+		return errors.New("failed")
+	}, nil)
+
+	st.Lock()
+	chg1 := st.NewChange("install", "...")
+	t1 := st.NewTask("panic", "Panic")
+	chg1.AddTask(t1)
+	chg2 := st.NewChange("remove", "...")
+	t2 := st.NewTask("fail", "Fail")
+	chg2.AddTask(t2)
+	st.Unlock()
+
+	r.Ensure()
+	r.Wait()
+
+	st.Lock()
+	defer st.Unlock()
+
+	c.Assert(t1.Status(), Equals, state.ErrorStatus)
+	c.Assert(t1.InternalError(), Equals, true)
+	c.Assert(chg1.Status(), Equals, state.ErrorStatus)
+	c.Assert(chg1.InternalError(), Equals, true)
+	c.Assert(chg1.Err(), ErrorMatches, `(?s).*internal error: task handler panicked: boom.*`)
+	c.Assert(panicErr, NotNil)
+	c.Assert(panicErr.Value, Equals, "boom")
+
+	log := t1.Log()
+	c.Assert(log, HasLen, 2)
+	c.Check(log[0], Matches, `\S+ ERROR internal error: task handler panicked: boom`)
+	c.Check(log[1], Matches, `(?s)\S+ INFO Stack trace of task handler panic:\n.*goroutine .*TestHandlerPanic.*`)
+
+	notices := st.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.InternalErrorNotice}})
+	c.Assert(notices, HasLen, 1)
+	n := noticeToMap(c, notices[0])
+	c.Check(n["key"], Equals, chg1.ID())
+	c.Check(n["last-data"], DeepEquals, map[string]any{
+		"kind":      "install",
+		"task-id":   t1.ID(),
+		"task-kind": "panic",
+		"panic":     "boom",
+	})
+
+	// A genuine failure isn't an internal error.
+	c.Assert(t2.Status(), Equals, state.ErrorStatus)
+	c.Assert(t2.InternalError(), Equals, false)
+	c.Assert(chg2.InternalError(), Equals, false)
+}
+
+func (ts *taskRunnerSuite) TestHandlerPanicLocked(c *C) {
+	panicked := make(chan interface{}, 1)
+	restore := state.FakeHandlerPanicLocked(func(v interface{}) {
+		panicked <- v
+	})
+	defer restore()
+
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	r.AddHandler("panic", func(t *state.Task, tb *tomb.Tomb) error {
+		st.Lock()
+		panic("boom")
+	}, nil)
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("panic", "Panic")
+	chg.AddTask(t)
+	st.Unlock()
+
+	r.Ensure()
+
+	// The panic is propagated rather than recovered, as the handler holds
+	// the state lock.
+	select {
+	case v := <-panicked:
+		c.Check(v, Equals, "boom")
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timed out waiting for panic")
+	}
+
+	// Release the handler's lock so the runner can finish.
+	st.Unlock()
+	r.Wait()
+}
+
+func (ts *taskRunnerSuite) TestHandlerPanicLockedElsewhere(c *C) {
+	restore := state.FakeHandlerPanicLocked(func(v interface{}) {
+		c.Errorf("panic propagated: %v", v)
+	})
+	defer restore()
+
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	locked := make(chan struct{})
+	r.AddHandler("panic", func(t *state.Task, tb *tomb.Tomb) error {
+		<-locked
+		panic("boom")
+	}, nil)
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("panic", "Panic")
+	chg.AddTask(t)
+	st.Unlock()
+
+	r.Ensure()
+
+	// The handler panics while another goroutine holds the state lock, so
+	// the panic is recovered.
+	st.Lock()
+	close(locked)
+	time.Sleep(50 * time.Millisecond)
+	st.Unlock()
+	r.Wait()
+
+	st.Lock()
+	defer st.Unlock()
+	c.Assert(t.Status(), Equals, state.ErrorStatus)
+	c.Assert(t.InternalError(), Equals, true)
+}
+
 func (ts *taskRunnerSuite) TestStopAskForRetry(c *C) {
 	sb := &stateBackend{}
 	st := state.New(sb)
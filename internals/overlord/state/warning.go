@@ -18,8 +18,8 @@ package state
 NOTE: Pebble Notices (added in 2023) was designed as a kind of superset of
 warnings, and we were planning to implement warnings in terms of notices.
 This is still the plan, however, we've put it on hold for now as it's not
-trivial, and warnings aren't actually recorded in Pebble at all right now, so
-it would just be busy work. Here are the reasons it's not trivial:
+trivial, and only a few managers record warnings (with State.Warn), so it
+would mostly be busy work. Here are the reasons it's not trivial:
 
 - Warnings have a single lastShown timestamp (on the server) for when they
   were last shown to the (single) client, whereas notices aren't marked as
@@ -56,17 +56,24 @@ var (
 )
 
 type jsonWarning struct {
-	Message     string     `json:"message"`
-	FirstAdded  time.Time  `json:"first-added"`
-	LastAdded   time.Time  `json:"last-added"`
-	LastShown   *time.Time `json:"last-shown,omitempty"`
-	ExpireAfter string     `json:"expire-after,omitempty"`
-	RepeatAfter string     `json:"repeat-after,omitempty"`
+	Key         string            `json:"key,omitempty"`
+	Message     string            `json:"message"`
+	Data        map[string]string `json:"data,omitempty"`
+	FirstAdded  time.Time         `json:"first-added"`
+	LastAdded   time.Time         `json:"last-added"`
+	LastShown   *time.Time        `json:"last-shown,omitempty"`
+	ExpireAfter string            `json:"expire-after,omitempty"`
+	RepeatAfter string            `json:"repeat-after,omitempty"`
 }
 
 type Warning struct {
-	// the warning text itself. Only one of these in the system at a time.
+	// the key that identifies the warning, if different from the message.
+	// Only one warning with a given key (or message) in the system at a time.
+	key string
+	// the warning text itself.
 	message string
+	// structured data about the last occurrence
+	data map[string]string
 	// the first time one of these messages was created
 	firstAdded time.Time
 	// the last time one of these was created
@@ -85,7 +92,9 @@ func (w *Warning) String() string {
 
 func (w *Warning) MarshalJSON() ([]byte, error) {
 	jw := jsonWarning{
+		Key:         w.key,
 		Message:     w.message,
+		Data:        w.data,
 		FirstAdded:  w.firstAdded,
 		LastAdded:   w.lastAdded,
 		ExpireAfter: w.expireAfter.String(),
@@ -104,7 +113,9 @@ func (w *Warning) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
+	w.key = jw.Key
 	w.message = jw.Message
+	w.data = jw.Data
 	w.firstAdded = jw.FirstAdded
 	w.lastAdded = jw.LastAdded
 	if jw.LastShown != nil {
@@ -145,6 +156,14 @@ func (w *Warning) validate() (e error) {
 	return nil
 }
 
+// mapKey returns the key of the warning in the state's warnings map.
+func (w *Warning) mapKey() string {
+	if w.key != "" {
+		return w.key
+	}
+	return w.message
+}
+
 func (w *Warning) ExpiredBefore(now time.Time) bool {
 	return w.lastAdded.Add(w.expireAfter).Before(now)
 }
@@ -183,7 +202,7 @@ func (s *State) unflattenWarnings(flat []*Warning) {
 		if w.ExpiredBefore(now) {
 			continue
 		}
-		s.warnings[w.message] = w
+		s.warnings[w.mapKey()] = w
 	}
 }
 
@@ -205,19 +224,75 @@ func (s *State) Warnf(template string, args ...interface{}) {
 	}, time.Now().UTC())
 }
 
+// WarnOptions holds optional parameters for a Warn call.
+type WarnOptions struct {
+	// RepeatAfter is how long after the warning was last shown to wait
+	// before showing it again, if it recurs. Defaults to DefaultRepeatAfter.
+	RepeatAfter time.Duration
+
+	// ExpireAfter is how long after the warning last occurred to drop it.
+	// Defaults to DefaultExpireAfter.
+	ExpireAfter time.Duration
+
+	// Data is structured information about this occurrence of the warning.
+	Data map[string]string
+}
+
+// Warn records a warning identified by key, rather than by its message: if
+// there's already a warning with this key, its message, data and durations
+// are updated and its lastAdded set to the current time. This means a
+// recurring condition whose message varies (for example, one including the
+// latest error) isn't shown again until the repeat-after duration passes.
+func (s *State) Warn(key, message string, opts *WarnOptions) {
+	if opts == nil {
+		opts = &WarnOptions{}
+	}
+	w := Warning{
+		key:         key,
+		message:     message,
+		expireAfter: opts.ExpireAfter,
+		repeatAfter: opts.RepeatAfter,
+	}
+	if w.expireAfter == 0 {
+		w.expireAfter = DefaultExpireAfter
+	}
+	if w.repeatAfter == 0 {
+		w.repeatAfter = DefaultRepeatAfter
+	}
+	if len(opts.Data) > 0 {
+		w.data = make(map[string]string, len(opts.Data))
+		for k, v := range opts.Data {
+			w.data[k] = v
+		}
+	}
+	s.addWarning(w, time.Now().UTC())
+}
+
 func (s *State) addWarning(w Warning, t time.Time) {
 	s.writing()
 
-	if s.warnings[w.message] == nil {
+	existing := s.warnings[w.mapKey()]
+	if existing == nil {
 		w.firstAdded = t
 		if err := w.validate(); err != nil {
 			// programming error!
 			logger.Panicf("internal error, please report: attempted to add invalid warning: %v", err)
 			return
 		}
-		s.warnings[w.message] = &w
+		s.warnings[w.mapKey()] = &w
+		existing = &w
+	} else if w.key != "" {
+		w.firstAdded = existing.firstAdded
+		if err := w.validate(); err != nil {
+			logger.Panicf("internal error, please report: attempted to add invalid warning: %v", err)
+			return
+		}
+		existing.message = w.message
+		existing.data = w.data
+		existing.expireAfter = w.expireAfter
+		existing.repeatAfter = w.repeatAfter
 	}
-	s.warnings[w.message].lastAdded = t
+	existing.lastAdded = t
 }
 
 type byLastAdded []*Warning
@@ -260,3 +260,78 @@ func (stateSuite) TestShowAndOkayWithRepeats(c *check.C) {
 	c.Check(ws, check.HasLen, 1)
 	c.Check(fmt.Sprintf("%q", ws), check.Equals, `["hello"]`)
 }
+
+func (stateSuite) TestWarnKey(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	st.Warn("target-failing/tgt1", "Cannot forward logs: timeout", &state.WarnOptions{
+		RepeatAfter: time.Hour,
+		ExpireAfter: 24 * time.Hour,
+		Data:        map[string]string{"target": "tgt1", "error": "timeout"},
+	})
+	ws, t := st.PendingWarnings()
+	c.Assert(ws, check.HasLen, 1)
+	st.OkayWarnings(t)
+
+	// A different message with the same key updates the existing warning,
+	// which isn't shown again until repeat-after passes.
+	st.Warn("target-failing/tgt1", "Cannot forward logs: connection refused", &state.WarnOptions{
+		RepeatAfter: time.Hour,
+		ExpireAfter: 24 * time.Hour,
+		Data:        map[string]string{"target": "tgt1", "error": "connection refused"},
+	})
+	ws, _ = st.PendingWarnings()
+	c.Check(ws, check.HasLen, 0)
+
+	ws = st.AllWarnings()
+	c.Assert(ws, check.HasLen, 1)
+	c.Check(ws[0].String(), check.Equals, "Cannot forward logs: connection refused")
+
+	buf, err := json.Marshal(ws[0])
+	c.Assert(err, check.IsNil)
+	var v map[string]any
+	c.Assert(json.Unmarshal(buf, &v), check.IsNil)
+	c.Check(v["key"], check.Equals, "target-failing/tgt1")
+	c.Check(v["data"], check.DeepEquals, map[string]any{"target": "tgt1", "error": "connection refused"})
+	c.Check(v["repeat-after"], check.Equals, "1h0m0s")
+	c.Check(v["expire-after"], check.Equals, "24h0m0s")
+	c.Check(v["first-added"], check.Not(check.Equals), v["last-added"])
+
+	// A warning with another key is separate, even with the same message.
+	st.Warn("target-failing/tgt2", "Cannot forward logs: connection refused", nil)
+	c.Check(st.AllWarnings(), check.HasLen, 2)
+}
+
+func (stateSuite) TestWarnCheckpoint(c *check.C) {
+	b := &fakeStateBackend{}
+	st := state.New(b)
+	st.Lock()
+	st.Warn("key1", "hello", &state.WarnOptions{Data: map[string]string{"foo": "bar"}})
+	st.Unlock()
+	c.Assert(b.checkpoints, check.HasLen, 1)
+
+	st2, err := state.ReadState(nil, bytes.NewReader(b.checkpoints[0]))
+	c.Assert(err, check.IsNil)
+	st2.Lock()
+	defer st2.Unlock()
+
+	// The key is restored, so a new occurrence updates the same warning.
+	st2.Warn("key1", "hello again", nil)
+	ws := st2.AllWarnings()
+	c.Assert(ws, check.HasLen, 1)
+	c.Check(fmt.Sprintf("%q", ws), check.Equals, `["hello again"]`)
+}
+
+func (stateSuite) TestWarnExpireAfter(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	st.Warn("key1", "hello", &state.WarnOptions{ExpireAfter: time.Minute})
+	ws := st.AllWarnings()
+	c.Assert(ws, check.HasLen, 1)
+	c.Check(ws[0].ExpiredBefore(time.Now().Add(30*time.Second)), check.Equals, false)
+	c.Check(ws[0].ExpiredBefore(time.Now().Add(2*time.Minute)), check.Equals, true)
+}
@@ -16,10 +16,13 @@ package overlord
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/canonical/pebble/internals/logger"
 	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/timing"
 )
 
 // StateManager is implemented by types responsible for observing
@@ -66,6 +69,42 @@ type StateEngine struct {
 	// managers in use
 	mgrLock  sync.Mutex
 	managers []StateManager
+
+	// health of the managers, in the same order. It has its own lock so
+	// that it can be read while a manager's Ensure is stuck.
+	healthLock sync.Mutex
+	health     []ManagerHealth
+}
+
+// wedgedEnsureTime is how long a manager's Ensure may run before the
+// manager is reported as not ready.
+var wedgedEnsureTime = time.Minute
+
+// ManagerHealth holds the health of a state manager, as recorded by the
+// state engine when it starts up the manager and calls its Ensure method.
+type ManagerHealth struct {
+	// Name identifies the manager, for example "servstate.ServiceManager".
+	Name string
+
+	// Ready is true if the manager started up and its last Ensure
+	// succeeded, and it isn't stuck in its current Ensure.
+	Ready bool
+
+	// StartUpErr is the error from starting up the manager, if any.
+	StartUpErr error
+
+	// LastEnsure is when the manager's last Ensure finished, and EnsureErr
+	// is the error it returned, if any.
+	LastEnsure time.Time
+	EnsureErr  error
+
+	// EnsuringSince is when the manager's current Ensure started, or zero
+	// if it isn't running.
+	EnsuringSince time.Time
+}
+
+func managerName(m StateManager) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", m), "*")
 }
 
 // NewStateEngine returns a new state engine.
@@ -96,15 +135,24 @@ func (se *StateEngine) StartUp() error {
 		return nil
 	}
 	se.startedUp = true
+	timings := timing.Start("", "", map[string]string{"startup": "managers"})
 	var errs []error
-	for _, m := range se.managers {
+	for i, m := range se.managers {
 		if starterUp, ok := m.(StateStarterUp); ok {
+			label := managerName(m)
+			span := timings.StartNested(label, "start up "+label)
 			err := starterUp.StartUp()
+			span.Stop()
 			if err != nil {
 				errs = append(errs, err)
+				se.healthLock.Lock()
+				se.health[i].StartUpErr = err
+				se.healthLock.Unlock()
 			}
 		}
 	}
+	timings.Stop()
+	saveTimings(se.state, timings)
 	if len(errs) != 0 {
 		return &startupError{errs}
 	}
@@ -137,8 +185,19 @@ func (se *StateEngine) Ensure() error {
 		return fmt.Errorf("state engine already stopped")
 	}
 	var errs []error
-	for _, m := range se.managers {
+	for i, m := range se.managers {
+		se.healthLock.Lock()
+		se.health[i].EnsuringSince = timeNow()
+		se.healthLock.Unlock()
+
 		err := m.Ensure()
+
+		se.healthLock.Lock()
+		se.health[i].EnsuringSince = time.Time{}
+		se.health[i].LastEnsure = timeNow()
+		se.health[i].EnsureErr = err
+		se.healthLock.Unlock()
+
 		if err != nil {
 			logger.Noticef("State ensure error: %v", err)
 			errs = append(errs, err)
@@ -155,6 +214,28 @@ func (se *StateEngine) AddManager(m StateManager) {
 	se.mgrLock.Lock()
 	defer se.mgrLock.Unlock()
 	se.managers = append(se.managers, m)
+
+	se.healthLock.Lock()
+	defer se.healthLock.Unlock()
+	se.health = append(se.health, ManagerHealth{Name: managerName(m)})
+}
+
+// Health returns the health of each manager, in the order they were added.
+// A manager is only ready once it has been started up and its Ensure has
+// succeeded, so that a manager that keeps failing, or that is stuck in
+// Ensure, is visible.
+func (se *StateEngine) Health() []ManagerHealth {
+	se.healthLock.Lock()
+	defer se.healthLock.Unlock()
+
+	now := timeNow()
+	health := make([]ManagerHealth, len(se.health))
+	for i, h := range se.health {
+		h.Ready = h.StartUpErr == nil && h.EnsureErr == nil && !h.LastEnsure.IsZero() &&
+			(h.EnsuringSince.IsZero() || now.Sub(h.EnsuringSince) < wedgedEnsureTime)
+		health[i] = h
+	}
+	return health
 }
 
 // Wait waits for all managers current activities.
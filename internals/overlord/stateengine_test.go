@@ -16,11 +16,13 @@ package overlord_test
 
 import (
 	"errors"
+	"time"
 
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/pebble/internals/overlord"
 	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/timing"
 )
 
 type stateEngineSuite struct{}
@@ -82,6 +84,40 @@ func (ses *stateEngineSuite) TestStartUp(c *C) {
 	c.Check(calls, HasLen, 2)
 }
 
+type slowStartUpManager struct{}
+
+func (m *slowStartUpManager) StartUp() error {
+	time.Sleep(2 * timing.MinNestedSpan)
+	return nil
+}
+
+func (m *slowStartUpManager) Ensure() error {
+	return nil
+}
+
+func (ses *stateEngineSuite) TestStartUpTimings(c *C) {
+	s := state.New(nil)
+	se := overlord.NewStateEngine(s)
+
+	calls := []string{}
+	se.AddManager(&fakeManager{name: "mgr1", calls: &calls})
+	se.AddManager(&slowStartUpManager{})
+
+	err := se.StartUp()
+	c.Assert(err, IsNil)
+
+	s.Lock()
+	defer s.Unlock()
+	timings, err := timing.Get(s)
+	c.Assert(err, IsNil)
+	c.Assert(timings, HasLen, 1)
+	c.Check(timings[0].Tags, DeepEquals, map[string]string{"startup": "managers"})
+	// Fast managers are elided.
+	c.Assert(timings[0].Spans, HasLen, 1)
+	c.Check(timings[0].Spans[0].Label, Equals, "overlord_test.slowStartUpManager")
+	c.Check(timings[0].Spans[0].Summary, Equals, "start up overlord_test.slowStartUpManager")
+}
+
 func (ses *stateEngineSuite) TestStartUpError(c *C) {
 	s := state.New(nil)
 	se := overlord.NewStateEngine(s)
@@ -151,6 +187,83 @@ func (ses *stateEngineSuite) TestEnsureError(c *C) {
 	c.Check(calls, DeepEquals, []string{"ensure:mgr1", "ensure:mgr2"})
 }
 
+type blockingManager struct {
+	ensuring chan bool
+	release  chan bool
+}
+
+func (bm *blockingManager) Ensure() error {
+	bm.ensuring <- true
+	<-bm.release
+	return nil
+}
+
+func (ses *stateEngineSuite) TestHealth(c *C) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	restore := overlord.FakeTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s := state.New(nil)
+	se := overlord.NewStateEngine(s)
+
+	calls := []string{}
+	startupErr := errors.New("cannot start")
+	ensureErr := errors.New("cannot ensure")
+	se.AddManager(&fakeManager{name: "mgr1", calls: &calls, startupError: startupErr})
+	se.AddManager(&fakeManager{name: "mgr2", calls: &calls, ensureError: ensureErr})
+	se.AddManager(&fakeManager{name: "mgr3", calls: &calls})
+	blocking := &blockingManager{ensuring: make(chan bool), release: make(chan bool)}
+	se.AddManager(blocking)
+
+	// Managers aren't ready until their Ensure has run.
+	c.Assert(se.StartUp(), ErrorMatches, ".*cannot start.*")
+	health := se.Health()
+	c.Assert(health, HasLen, 4)
+	c.Check(health[0], DeepEquals, overlord.ManagerHealth{
+		Name:       "overlord_test.fakeManager",
+		StartUpErr: startupErr,
+	})
+	c.Check(health[2].Ready, Equals, false)
+
+	done := make(chan error)
+	go func() { done <- se.Ensure() }()
+	<-blocking.ensuring
+
+	health = se.Health()
+	c.Check(health[0].Ready, Equals, false)
+	c.Check(health[1], DeepEquals, overlord.ManagerHealth{
+		Name:       "overlord_test.fakeManager",
+		LastEnsure: now,
+		EnsureErr:  ensureErr,
+	})
+	c.Check(health[2], DeepEquals, overlord.ManagerHealth{
+		Name:       "overlord_test.fakeManager",
+		Ready:      true,
+		LastEnsure: now,
+	})
+	// The blocking manager isn't ready, as it hasn't finished an Ensure.
+	c.Check(health[3], DeepEquals, overlord.ManagerHealth{
+		Name:          "overlord_test.blockingManager",
+		EnsuringSince: now,
+	})
+
+	// Once an Ensure has finished, the manager is ready unless its next
+	// Ensure takes too long.
+	blocking.release <- true
+	c.Assert(<-done, NotNil)
+	go func() { done <- se.Ensure() }()
+	<-blocking.ensuring
+	c.Check(se.Health()[3].Ready, Equals, true)
+	now = now.Add(2 * time.Minute)
+	c.Check(se.Health()[3], DeepEquals, overlord.ManagerHealth{
+		Name:          "overlord_test.blockingManager",
+		LastEnsure:    now.Add(-2 * time.Minute),
+		EnsuringSince: now.Add(-2 * time.Minute),
+	})
+	blocking.release <- true
+	c.Assert(<-done, NotNil)
+}
+
 func (ses *stateEngineSuite) TestStop(c *C) {
 	s := state.New(nil)
 	se := overlord.NewStateEngine(s)
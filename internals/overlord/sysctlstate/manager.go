@@ -0,0 +1,151 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sysctlstate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+const (
+	applySysctlsKind = "apply-sysctls"
+
+	sysctlsAttr = "sysctls"
+)
+
+var procSysDir = "/proc/sys"
+
+// SysctlManager applies the kernel parameters defined in the "sysctls"
+// section of the plan. Each time the sysctls in the plan change, an
+// "apply-sysctls" change is created that writes the values and then reads
+// them back to verify that the kernel accepted them.
+//
+// Removing a sysctl from the plan doesn't restore its previous value.
+type SysctlManager struct {
+	state      *state.State
+	ensureDone atomic.Bool
+
+	// Values applied (or being applied) by the last apply-sysctls change.
+	// Only accessed with the state lock held.
+	applied map[string]string
+}
+
+// NewManager creates a new sysctl manager.
+func NewManager(s *state.State, runner *state.TaskRunner) *SysctlManager {
+	manager := &SysctlManager{
+		state: s,
+	}
+	runner.AddHandler(applySysctlsKind, manager.doApplySysctls, nil)
+	return manager
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *SysctlManager) Ensure() error {
+	m.ensureDone.Store(true)
+	return nil
+}
+
+// PlanChanged handles updates to the plan (server configuration), creating
+// an apply-sysctls change if the sysctl values have changed.
+func (m *SysctlManager) PlanChanged(p *plan.Plan) {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	values := make(map[string]string, len(p.Sysctls))
+	for name, sysctl := range p.Sysctls {
+		values[name] = sysctl.Value
+	}
+	if len(values) == 0 || reflect.DeepEqual(values, m.applied) {
+		return
+	}
+	m.applied = values
+
+	task := m.state.NewTask(applySysctlsKind, "Apply sysctl values")
+	task.Set(sysctlsAttr, values)
+	change := m.state.NewChange(applySysctlsKind, task.Summary())
+	change.AddTask(task)
+
+	if !m.ensureDone.Load() {
+		// Can't call EnsureBefore before Overlord.Loop is running (which will
+		// call m.Ensure for the first time).
+		return
+	}
+	m.state.EnsureBefore(0) // start new tasks right away
+}
+
+func (m *SysctlManager) doApplySysctls(task *state.Task, tomb *tomb.Tomb) error {
+	m.state.Lock()
+	var values map[string]string
+	err := task.Get(sysctlsAttr, &values)
+	m.state.Unlock()
+	if err != nil {
+		return fmt.Errorf("cannot get sysctls for apply-sysctls task %q: %v", task.ID(), err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		value := values[name]
+		err := applySysctl(name, value)
+		if err != nil {
+			logger.Noticef("Cannot set sysctl %q: %v", name, err)
+			errs = append(errs, fmt.Errorf("sysctl %q: %w", name, err))
+			continue
+		}
+		m.state.Lock()
+		task.Logf("Set sysctl %s = %s", name, value)
+		m.state.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// applySysctl writes the value to the named sysctl, and reads it back to
+// check it was applied.
+func applySysctl(name, value string) error {
+	path := filepath.Join(procSysDir, (&plan.Sysctl{Name: name}).Path())
+	err := os.WriteFile(path, []byte(value), 0644)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot verify value: %w", err)
+	}
+	// The kernel separates multiple values with tabs, so compare the
+	// whitespace-separated fields rather than the exact string.
+	got := strings.Join(strings.Fields(string(data)), " ")
+	want := strings.Join(strings.Fields(value), " ")
+	if got != want {
+		return fmt.Errorf("value is %q after setting it to %q", got, want)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sysctlstate_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord"
+	"github.com/canonical/pebble/internals/overlord/state"
+	"github.com/canonical/pebble/internals/overlord/sysctlstate"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type ManagerSuite struct {
+	overlord *overlord.Overlord
+	manager  *sysctlstate.SysctlManager
+	dir      string
+	restore  func()
+}
+
+var _ = Suite(&ManagerSuite{})
+
+func (s *ManagerSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.restore = sysctlstate.FakeProcSysDir(s.dir)
+
+	s.overlord = overlord.Fake()
+	s.manager = sysctlstate.NewManager(s.overlord.State(), s.overlord.TaskRunner())
+	s.overlord.AddManager(s.manager)
+	s.overlord.AddManager(s.overlord.TaskRunner())
+	err := s.overlord.StartUp()
+	c.Assert(err, IsNil)
+	s.overlord.Loop()
+}
+
+func (s *ManagerSuite) TearDownTest(c *C) {
+	s.overlord.Stop()
+	s.restore()
+}
+
+func (s *ManagerSuite) writeSysctl(c *C, path, value string) {
+	path = filepath.Join(s.dir, path)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(path, []byte(value), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *ManagerSuite) readSysctl(c *C, path string) string {
+	data, err := os.ReadFile(filepath.Join(s.dir, path))
+	c.Assert(err, IsNil)
+	return string(data)
+}
+
+func (s *ManagerSuite) waitChange(c *C) *state.Change {
+	st := s.overlord.State()
+	for i := 0; i < 500; i++ {
+		st.Lock()
+		changes := st.Changes()
+		st.Unlock()
+		if len(changes) > 0 {
+			select {
+			case <-changes[len(changes)-1].Ready():
+				return changes[len(changes)-1]
+			case <-time.After(5 * time.Second):
+				c.Fatalf("timed out waiting for change to be ready")
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("timed out waiting for change")
+	return nil
+}
+
+func (s *ManagerSuite) TestApplySysctls(c *C) {
+	s.writeSysctl(c, "net/ipv4/ip_forward", "0\n")
+	s.writeSysctl(c, "net/ipv4/conf/eth0.100/rp_filter", "0\n")
+
+	s.manager.PlanChanged(&plan.Plan{Sysctls: map[string]*plan.Sysctl{
+		"net.ipv4.ip_forward": {Name: "net.ipv4.ip_forward", Value: "1"},
+		"net/ipv4/conf/eth0.100/rp_filter": {
+			Name:  "net/ipv4/conf/eth0.100/rp_filter",
+			Value: "2",
+		},
+	}})
+	change := s.waitChange(c)
+
+	st := s.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(change.Kind(), Equals, "apply-sysctls")
+	c.Check(change.Status(), Equals, state.DoneStatus)
+	tasks := change.Tasks()
+	c.Assert(tasks, HasLen, 1)
+	log := tasks[0].Log()
+	c.Assert(log, HasLen, 2)
+	c.Check(log[0], Matches, `.* INFO Set sysctl net.ipv4.ip_forward = 1`)
+	c.Check(log[1], Matches, `.* INFO Set sysctl net/ipv4/conf/eth0.100/rp_filter = 2`)
+
+	c.Check(s.readSysctl(c, "net/ipv4/ip_forward"), Equals, "1")
+	c.Check(s.readSysctl(c, "net/ipv4/conf/eth0.100/rp_filter"), Equals, "2")
+}
+
+func (s *ManagerSuite) TestUnchangedPlan(c *C) {
+	s.writeSysctl(c, "vm/swappiness", "60\n")
+
+	p := &plan.Plan{Sysctls: map[string]*plan.Sysctl{
+		"vm.swappiness": {Name: "vm.swappiness", Value: "10"},
+	}}
+	s.manager.PlanChanged(p)
+	s.waitChange(c)
+
+	// Plan changes that don't change sysctls don't create a new change.
+	s.manager.PlanChanged(p)
+	s.manager.PlanChanged(&plan.Plan{Sysctls: map[string]*plan.Sysctl{
+		"vm.swappiness": {Name: "vm.swappiness", Value: "10", Override: plan.MergeOverride},
+	}})
+	st := s.overlord.State()
+	st.Lock()
+	c.Check(st.Changes(), HasLen, 1)
+	st.Unlock()
+}
+
+func (s *ManagerSuite) TestApplyError(c *C) {
+	s.writeSysctl(c, "vm/swappiness", "60\n")
+
+	s.manager.PlanChanged(&plan.Plan{Sysctls: map[string]*plan.Sysctl{
+		"vm.swappiness":    {Name: "vm.swappiness", Value: "10"},
+		"kernel.not_there": {Name: "kernel.not_there", Value: "1"},
+	}})
+	change := s.waitChange(c)
+
+	st := s.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(change.Status(), Equals, state.ErrorStatus)
+	c.Check(change.Err(), ErrorMatches, `(?s).*sysctl "kernel.not_there": open .*kernel/not_there: no such file or directory.*`)
+
+	// Other sysctls are still applied.
+	c.Check(s.readSysctl(c, "vm/swappiness"), Equals, "10")
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package timesyncstate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// retryInterval is how long to wait before trying again when none of the
+// servers could be reached.
+var retryInterval = 30 * time.Second
+
+// Status is the time synchronisation status.
+type Status struct {
+	// Synchronized is true if the last synchronisation attempt succeeded.
+	Synchronized bool
+	// Server is the name of the time server last synchronised with.
+	Server string
+	// Offset is the last clock offset measured (and corrected).
+	Offset time.Duration
+	// LastSync is the time of the last successful synchronisation.
+	LastSync time.Time
+	// Error is the error from the last attempt, if it failed.
+	Error string
+}
+
+// TimeSyncManager keeps the system clock synchronised with the time servers
+// configured in the "time-servers" section of the plan. Servers are tried in
+// name order, and the first one that responds is used.
+type TimeSyncManager struct {
+	mu        sync.Mutex
+	servers   []*plan.TimeServer
+	status    Status
+	startedUp bool
+
+	tomb    tomb.Tomb
+	changed chan struct{}
+}
+
+// NewManager creates a new time sync manager.
+func NewManager() *TimeSyncManager {
+	return &TimeSyncManager{
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// PlanChanged handles updates to the plan (server configuration), and
+// triggers an immediate synchronisation with the new servers. Changes that
+// don't affect the "time-servers" section are ignored.
+func (m *TimeSyncManager) PlanChanged(p *plan.Plan, changed map[string]bool) {
+	if !changed["time-servers"] {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	servers := make([]*plan.TimeServer, 0, len(p.TimeServers))
+	for _, server := range p.TimeServers {
+		servers = append(servers, server)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Name < servers[j].Name
+	})
+	m.servers = servers
+	if len(servers) == 0 {
+		m.status = Status{}
+	}
+
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// StartUp implements StateStarterUp.StartUp, starting the synchronisation
+// loop.
+func (m *TimeSyncManager) StartUp() error {
+	m.startedUp = true
+	m.tomb.Go(m.loop)
+	return nil
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *TimeSyncManager) Ensure() error {
+	return nil
+}
+
+// Stop implements StateStopper.Stop.
+func (m *TimeSyncManager) Stop() {
+	if !m.startedUp {
+		return
+	}
+	m.tomb.Kill(nil)
+	m.tomb.Wait()
+}
+
+// Status returns the current time synchronisation status.
+func (m *TimeSyncManager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+func (m *TimeSyncManager) loop() error {
+	ctx := m.tomb.Context(context.Background())
+	for {
+		// The sync uses the latest servers, so discard any pending change
+		// signal to avoid synchronising twice in a row.
+		select {
+		case <-m.changed:
+		default:
+		}
+		wait := m.sync(ctx)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-m.changed:
+			timer.Stop()
+		case <-m.tomb.Dying():
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+// sync synchronises the clock with the first server that responds, and
+// returns how long to wait before synchronising again.
+func (m *TimeSyncManager) sync(ctx context.Context) time.Duration {
+	m.mu.Lock()
+	servers := m.servers
+	m.mu.Unlock()
+
+	if len(servers) == 0 {
+		// Nothing to do until the plan changes.
+		return 24 * time.Hour
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		offset, err := queryServer(ctx, server.Address)
+		if ctx.Err() != nil {
+			return 0
+		}
+		if err != nil {
+			logger.Debugf("Cannot query time server %q: %v", server.Name, err)
+			lastErr = fmt.Errorf("cannot query time server %q: %w", server.Name, err)
+			continue
+		}
+		err = adjustClock(offset)
+		if err != nil {
+			lastErr = fmt.Errorf("cannot adjust clock by %s: %w", offset, err)
+			break
+		}
+		logger.Debugf("Synchronised clock with time server %q (offset %s)", server.Name, offset)
+		m.setStatus(Status{
+			Synchronized: true,
+			Server:       server.Name,
+			Offset:       offset,
+			LastSync:     timeNow(),
+		})
+		return server.PollInterval.Value
+	}
+
+	logger.Noticef("Cannot synchronise clock: %v", lastErr)
+	m.mu.Lock()
+	m.status.Synchronized = false
+	m.status.Error = lastErr.Error()
+	m.mu.Unlock()
+	return retryInterval
+}
+
+func (m *TimeSyncManager) setStatus(status Status) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = status
+}
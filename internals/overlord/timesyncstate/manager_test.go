@@ -0,0 +1,242 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package timesyncstate
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type managerSuite struct {
+	mu      sync.Mutex
+	stepped []time.Duration
+	slewed  []time.Duration
+	restore []func()
+}
+
+var _ = Suite(&managerSuite{})
+
+func (s *managerSuite) SetUpTest(c *C) {
+	s.stepped = nil
+	s.slewed = nil
+	oldStep, oldSlew := stepClock, slewClock
+	stepClock = func(offset time.Duration) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.stepped = append(s.stepped, offset)
+		return nil
+	}
+	slewClock = func(offset time.Duration) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.slewed = append(s.slewed, offset)
+		return nil
+	}
+	oldTimeout := queryTimeout
+	queryTimeout = 200 * time.Millisecond
+	s.restore = []func(){func() {
+		stepClock, slewClock = oldStep, oldSlew
+		queryTimeout = oldTimeout
+	}}
+}
+
+func (s *managerSuite) TearDownTest(c *C) {
+	for _, restore := range s.restore {
+		restore()
+	}
+}
+
+// startServer starts a fake NTP server on localhost that reports its clock
+// as being ahead of the local clock by offset. It returns the server address.
+func (s *managerSuite) startServer(c *C, offset time.Duration) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s.restore = append(s.restore, func() { conn.Close() })
+	go func() {
+		request := make([]byte, ntpPacketSize)
+		for {
+			n, addr, err := conn.ReadFrom(request)
+			if err != nil {
+				return
+			}
+			if n < ntpPacketSize {
+				continue
+			}
+			now := toNTPTime(time.Now().Add(offset))
+			response := make([]byte, ntpPacketSize)
+			response[0] = 0<<6 | 4<<3 | 4
+			response[1] = 2
+			copy(response[24:32], request[40:48])
+			binary.BigEndian.PutUint64(response[32:], uint64(now))
+			binary.BigEndian.PutUint64(response[40:], uint64(now))
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// unusedAddress returns the address of a UDP port with nothing listening.
+func unusedAddress(c *C) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	return addr
+}
+
+func waitStatus(c *C, m *TimeSyncManager, cond func(Status) bool) Status {
+	for i := 0; i < 100; i++ {
+		status := m.Status()
+		if cond(status) {
+			return status
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Fatalf("timed out waiting for status, last status: %+v", m.Status())
+	return Status{}
+}
+
+var timeServersChanged = map[string]bool{"time-servers": true}
+
+func (s *managerSuite) TestNoServers(c *C) {
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{}, map[string]bool{})
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	c.Check(m.Status(), DeepEquals, Status{})
+}
+
+func (s *managerSuite) TestSync(c *C) {
+	addr := s.startServer(c, 5*time.Second)
+
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{TimeServers: map[string]*plan.TimeServer{
+		"local": {
+			Name:         "local",
+			Address:      addr,
+			PollInterval: plan.OptionalDuration{Value: time.Hour, IsSet: true},
+		},
+	}}, timeServersChanged)
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+
+	status := waitStatus(c, m, func(st Status) bool { return st.Synchronized })
+	c.Check(status.Server, Equals, "local")
+	c.Check(status.Error, Equals, "")
+	c.Check(status.LastSync.IsZero(), Equals, false)
+	c.Check((status.Offset-5*time.Second).Abs() < 100*time.Millisecond, Equals, true,
+		Commentf("offset %s", status.Offset))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.Check(s.stepped, DeepEquals, []time.Duration{status.Offset})
+	c.Check(s.slewed, HasLen, 0)
+}
+
+func (s *managerSuite) TestFallback(c *C) {
+	addr := s.startServer(c, 0)
+
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{TimeServers: map[string]*plan.TimeServer{
+		"a-down": {
+			Name:         "a-down",
+			Address:      unusedAddress(c),
+			PollInterval: plan.OptionalDuration{Value: time.Hour},
+		},
+		"b-up": {
+			Name:         "b-up",
+			Address:      addr,
+			PollInterval: plan.OptionalDuration{Value: time.Hour},
+		},
+	}}, timeServersChanged)
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+
+	status := waitStatus(c, m, func(st Status) bool { return st.Synchronized })
+	c.Check(status.Server, Equals, "b-up")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.Check(s.slewed, HasLen, 1)
+	c.Check(s.stepped, HasLen, 0)
+}
+
+func (s *managerSuite) TestUnreachable(c *C) {
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{TimeServers: map[string]*plan.TimeServer{
+		"down": {
+			Name:         "down",
+			Address:      unusedAddress(c),
+			PollInterval: plan.OptionalDuration{Value: time.Hour},
+		},
+	}}, timeServersChanged)
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+
+	status := waitStatus(c, m, func(st Status) bool { return st.Error != "" })
+	c.Check(status.Synchronized, Equals, false)
+	c.Check(status.Error, Matches, `cannot query time server "down": .*`)
+
+	// Changing the plan triggers a new attempt straight away.
+	addr := s.startServer(c, 0)
+	m.PlanChanged(&plan.Plan{TimeServers: map[string]*plan.TimeServer{
+		"up": {
+			Name:         "up",
+			Address:      addr,
+			PollInterval: plan.OptionalDuration{Value: time.Hour},
+		},
+	}}, timeServersChanged)
+	status = waitStatus(c, m, func(st Status) bool { return st.Synchronized })
+	c.Check(status.Server, Equals, "up")
+	c.Check(status.Error, Equals, "")
+}
+
+func (s *managerSuite) TestOtherSectionsChanged(c *C) {
+	m := NewManager()
+	m.PlanChanged(&plan.Plan{TimeServers: map[string]*plan.TimeServer{
+		"down": {
+			Name:         "down",
+			Address:      unusedAddress(c),
+			PollInterval: plan.OptionalDuration{Value: time.Hour},
+		},
+	}}, map[string]bool{"services": true})
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+
+	// The time servers section didn't change, so the servers aren't used.
+	time.Sleep(50 * time.Millisecond)
+	c.Check(m.Status(), DeepEquals, Status{})
+}
+
+func (s *managerSuite) TestStopWithoutStartUp(c *C) {
+	m := NewManager()
+	m.Stop()
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package timesyncstate
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ntpPort       = "123"
+	ntpPacketSize = 48
+
+	// Seconds between the NTP epoch (1900) and the Unix epoch (1970).
+	ntpEpochOffset = 2208988800
+
+	// Offsets larger than this are corrected by stepping the clock rather
+	// than slewing it (the same threshold as ntpd and chrony's default).
+	stepThreshold = 128 * time.Millisecond
+)
+
+var queryTimeout = 5 * time.Second
+
+// ntpTime is a 64-bit NTP timestamp: seconds since 1900 in the upper 32
+// bits, and the fraction of a second in the lower 32 bits.
+type ntpTime uint64
+
+func toNTPTime(t time.Time) ntpTime {
+	nsec := uint64(t.Sub(time.Unix(-ntpEpochOffset, 0)))
+	sec := nsec / 1e9
+	frac := (nsec - sec*1e9) << 32 / 1e9
+	return ntpTime(sec<<32 | frac)
+}
+
+func (t ntpTime) Time() time.Time {
+	sec := uint64(t) >> 32
+	frac := uint64(t) & 0xffffffff
+	nsec := frac * 1e9 >> 32
+	return time.Unix(int64(sec)-ntpEpochOffset, int64(nsec))
+}
+
+// queryServer sends a client request to the given NTP server (using the
+// SNTP subset of the protocol described in RFC 4330) and returns the offset
+// of the local clock from the server's clock.
+func queryServer(ctx context.Context, address string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, ntpPort)
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	request := make([]byte, ntpPacketSize)
+	request[0] = 0<<6 | 4<<3 | 3 // leap indicator 0, version 4, mode 3 (client)
+	sent := toNTPTime(timeNow())
+	binary.BigEndian.PutUint64(request[40:], uint64(sent))
+	_, err = conn.Write(request)
+	if err != nil {
+		return 0, err
+	}
+
+	response := make([]byte, ntpPacketSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return 0, err
+	}
+	received := timeNow()
+	return parseResponse(response[:n], sent, received)
+}
+
+// parseResponse validates an NTP server response, and calculates the clock
+// offset from the request and response timestamps.
+func parseResponse(response []byte, sent ntpTime, received time.Time) (time.Duration, error) {
+	if len(response) < ntpPacketSize {
+		return 0, fmt.Errorf("response too short (%d bytes)", len(response))
+	}
+	leap := response[0] >> 6
+	mode := response[0] & 0x7
+	stratum := response[1]
+	if mode != 4 {
+		return 0, fmt.Errorf("invalid response mode %d", mode)
+	}
+	if stratum == 0 {
+		// A "kiss-o'-death" packet: the server is telling us to go away.
+		return 0, fmt.Errorf("server sent kiss code %q", response[12:16])
+	}
+	if leap == 3 || stratum > 15 {
+		return 0, errors.New("server clock not synchronised")
+	}
+	origin := ntpTime(binary.BigEndian.Uint64(response[24:]))
+	if origin != sent {
+		return 0, errors.New("response doesn't match request")
+	}
+
+	// See RFC 4330, section 5: offset = ((T2 - T1) + (T3 - T4)) / 2
+	t1 := sent.Time()
+	t2 := ntpTime(binary.BigEndian.Uint64(response[32:])).Time()
+	t3 := ntpTime(binary.BigEndian.Uint64(response[40:])).Time()
+	t4 := received
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+var (
+	timeNow   = time.Now
+	stepClock = stepSystemClock
+	slewClock = slewSystemClock
+)
+
+// adjustClock corrects the system clock by the given offset, stepping it if
+// the offset is large, and otherwise slewing it gradually.
+func adjustClock(offset time.Duration) error {
+	if offset >= stepThreshold || offset <= -stepThreshold {
+		return stepClock(offset)
+	}
+	return slewClock(offset)
+}
+
+func stepSystemClock(offset time.Duration) error {
+	tv := unix.NsecToTimeval(time.Now().Add(offset).UnixNano())
+	return unix.Settimeofday(&tv)
+}
+
+func slewSystemClock(offset time.Duration) error {
+	// Like adjtime(3), have the kernel gradually apply the offset.
+	tx := unix.Timex{Modes: unix.ADJ_OFFSET_SINGLESHOT}
+	setTimexField(&tx.Offset, offset.Microseconds())
+	_, err := unix.Adjtimex(&tx)
+	return err
+}
+
+// setTimexField sets an integer field of unix.Timex, the types of which
+// vary between architectures.
+func setTimexField[T ~int32 | ~int64](field *T, value int64) {
+	*field = T(value)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package timesyncstate
+
+import (
+	"encoding/binary"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ntpSuite struct{}
+
+var _ = Suite(&ntpSuite{})
+
+func (s *ntpSuite) TestNTPTime(c *C) {
+	t := time.Date(2024, 5, 1, 12, 30, 15, 250000000, time.UTC)
+	n := toNTPTime(t)
+	c.Check(uint64(n)>>32, Equals, uint64(t.Unix()+ntpEpochOffset))
+	c.Check(uint64(n)&0xffffffff, Equals, uint64(1<<30)) // a quarter second
+	c.Check(n.Time().Equal(t), Equals, true)
+
+	// Conversion is accurate to within a nanosecond.
+	t = time.Date(2024, 5, 1, 12, 30, 15, 123456789, time.UTC)
+	c.Check(toNTPTime(t).Time().Sub(t).Abs() <= time.Nanosecond, Equals, true)
+}
+
+// makeResponse builds a server response to a request sent at t1, where the
+// server clock is ahead of the client clock by offset.
+func makeResponse(t1 time.Time, offset time.Duration) []byte {
+	response := make([]byte, ntpPacketSize)
+	response[0] = 0<<6 | 4<<3 | 4 // leap indicator 0, version 4, mode 4 (server)
+	response[1] = 2               // stratum
+	binary.BigEndian.PutUint64(response[24:], uint64(toNTPTime(t1)))
+	binary.BigEndian.PutUint64(response[32:], uint64(toNTPTime(t1.Add(offset+10*time.Millisecond))))
+	binary.BigEndian.PutUint64(response[40:], uint64(toNTPTime(t1.Add(offset+11*time.Millisecond))))
+	return response
+}
+
+func (s *ntpSuite) TestParseResponse(c *C) {
+	t1 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	t4 := t1.Add(21 * time.Millisecond) // 10ms each way, plus 1ms on the server
+
+	offset, err := parseResponse(makeResponse(t1, 2*time.Second), toNTPTime(t1), t4)
+	c.Assert(err, IsNil)
+	c.Check((offset-2*time.Second).Abs() < time.Microsecond, Equals, true, Commentf("offset %s", offset))
+
+	offset, err = parseResponse(makeResponse(t1, -5*time.Millisecond), toNTPTime(t1), t4)
+	c.Assert(err, IsNil)
+	c.Check((offset+5*time.Millisecond).Abs() < time.Microsecond, Equals, true, Commentf("offset %s", offset))
+}
+
+func (s *ntpSuite) TestParseResponseErrors(c *C) {
+	t1 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sent := toNTPTime(t1)
+	t4 := t1.Add(20 * time.Millisecond)
+
+	_, err := parseResponse(make([]byte, 10), sent, t4)
+	c.Check(err, ErrorMatches, `response too short \(10 bytes\)`)
+
+	response := makeResponse(t1, 0)
+	response[0] = 4<<3 | 3
+	_, err = parseResponse(response, sent, t4)
+	c.Check(err, ErrorMatches, `invalid response mode 3`)
+
+	response = makeResponse(t1, 0)
+	response[1] = 0
+	copy(response[12:], "RATE")
+	_, err = parseResponse(response, sent, t4)
+	c.Check(err, ErrorMatches, `server sent kiss code "RATE"`)
+
+	response = makeResponse(t1, 0)
+	response[0] |= 3 << 6
+	_, err = parseResponse(response, sent, t4)
+	c.Check(err, ErrorMatches, `server clock not synchronised`)
+
+	response = makeResponse(t1, 0)
+	_, err = parseResponse(response, toNTPTime(t1.Add(time.Second)), t4)
+	c.Check(err, ErrorMatches, `response doesn't match request`)
+}
+
+func (s *ntpSuite) TestAdjustClock(c *C) {
+	var stepped, slewed []time.Duration
+	restore := fakeClock(&stepped, &slewed)
+	defer restore()
+
+	for _, offset := range []time.Duration{
+		0,
+		127 * time.Millisecond,
+		-127 * time.Millisecond,
+		128 * time.Millisecond,
+		-time.Second,
+	} {
+		err := adjustClock(offset)
+		c.Assert(err, IsNil)
+	}
+	c.Check(slewed, DeepEquals, []time.Duration{0, 127 * time.Millisecond, -127 * time.Millisecond})
+	c.Check(stepped, DeepEquals, []time.Duration{128 * time.Millisecond, -time.Second})
+}
+
+func fakeClock(stepped, slewed *[]time.Duration) (restore func()) {
+	oldStep, oldSlew := stepClock, slewClock
+	stepClock = func(offset time.Duration) error {
+		*stepped = append(*stepped, offset)
+		return nil
+	}
+	slewClock = func(offset time.Duration) error {
+		*slewed = append(*slewed, offset)
+		return nil
+	}
+	return func() {
+		stepClock, slewClock = oldStep, oldSlew
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package watchdogstate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/overlord/checkstate"
+	"github.com/canonical/pebble/internals/overlord/servstate"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// magicClose is the character which, when written just before the device is
+// closed, tells the watchdog driver to disarm the watchdog.
+const magicClose = "V"
+
+// openDevice opens a watchdog device, arming the watchdog.
+var openDevice = func(path string) (io.WriteCloser, error) {
+	return os.OpenFile(path, os.O_WRONLY, 0)
+}
+
+// CheckManager is the interface the watchdog manager uses to get the status
+// of health checks.
+type CheckManager interface {
+	Checks() ([]*checkstate.CheckInfo, error)
+}
+
+// ServiceManager is the interface the watchdog manager uses to get the
+// status of services, and whether the daemon is in maintenance mode.
+type ServiceManager interface {
+	Services(names []string) ([]*servstate.ServiceInfo, error)
+	InMaintenance() bool
+}
+
+// WatchdogManager drives the hardware watchdogs configured in the
+// "watchdogs" section of the plan. Each watchdog device is opened (armed)
+// on startup and petted periodically, but only while all of its checks are
+// up and all of its services are active; otherwise the watchdog fires when
+// its timeout expires, resetting the system. In maintenance mode, when
+// services are stopped and checks fail on purpose, the watchdogs are petted
+// regardless, so that they still fire if Pebble itself hangs.
+type WatchdogManager struct {
+	checkMgr   CheckManager
+	serviceMgr ServiceManager
+
+	mu        sync.Mutex
+	configs   map[string]*plan.Watchdog
+	watchdogs map[string]*watchdog
+	startedUp bool
+}
+
+type watchdog struct {
+	config *plan.Watchdog
+	device io.WriteCloser
+	tomb   tomb.Tomb
+}
+
+// NewManager creates a new watchdog manager.
+func NewManager(checkMgr CheckManager, serviceMgr ServiceManager) *WatchdogManager {
+	return &WatchdogManager{
+		checkMgr:   checkMgr,
+		serviceMgr: serviceMgr,
+		watchdogs:  make(map[string]*watchdog),
+	}
+}
+
+// PlanChanged handles updates to the plan (server configuration). Watchdogs
+// removed from the plan are disarmed, and new ones are armed.
+func (m *WatchdogManager) PlanChanged(p *plan.Plan) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.configs = p.Watchdogs
+	if m.startedUp {
+		m.update()
+	}
+}
+
+// StartUp implements StateStarterUp.StartUp, arming the watchdogs in the
+// plan.
+func (m *WatchdogManager) StartUp() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.startedUp = true
+	m.update()
+	return nil
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *WatchdogManager) Ensure() error {
+	return nil
+}
+
+// Stop implements StateStopper.Stop. Each watchdog is either disarmed or
+// left to fire, according to its "on-stop" action.
+func (m *WatchdogManager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, w := range m.watchdogs {
+		w.stop(w.config.OnStop)
+		delete(m.watchdogs, name)
+	}
+}
+
+// update arms and disarms watchdogs to match the current configuration. It
+// must be called with m.mu held.
+func (m *WatchdogManager) update() {
+	for name, w := range m.watchdogs {
+		config, ok := m.configs[name]
+		if ok && reflect.DeepEqual(config, w.config) {
+			continue
+		}
+		w.stop(plan.WatchdogClose)
+		delete(m.watchdogs, name)
+	}
+
+	names := make([]string, 0, len(m.configs))
+	for name := range m.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := m.watchdogs[name]; ok {
+			continue
+		}
+		config := m.configs[name]
+		device, err := openDevice(config.Device)
+		if err != nil {
+			logger.Noticef("Cannot open watchdog %q: %v", name, err)
+			continue
+		}
+		logger.Noticef("Watchdog %q armed (device %s)", name, config.Device)
+		w := &watchdog{config: config, device: device}
+		w.tomb.Go(func() error {
+			m.run(w)
+			return nil
+		})
+		m.watchdogs[name] = w
+	}
+}
+
+// run pets the watchdog every interval while it's healthy.
+func (m *WatchdogManager) run(w *watchdog) {
+	ticker := time.NewTicker(w.config.Interval.Value)
+	defer ticker.Stop()
+
+	var lastProblem string
+	for {
+		problem := m.problem(w.config)
+		if problem == "" {
+			_, err := w.device.Write([]byte{0})
+			if err != nil {
+				problem = fmt.Sprintf("cannot write to device: %v", err)
+			}
+		}
+		if problem != lastProblem {
+			if problem == "" {
+				logger.Noticef("Watchdog %q is being petted again", w.config.Name)
+			} else {
+				logger.Noticef("Watchdog %q not petted: %s", w.config.Name, problem)
+			}
+			lastProblem = problem
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.tomb.Dying():
+			return
+		}
+	}
+}
+
+// problem returns the reason the watchdog shouldn't be petted, or "" if all
+// of its checks are up and services are active, or the daemon is in
+// maintenance mode.
+func (m *WatchdogManager) problem(config *plan.Watchdog) string {
+	if m.serviceMgr.InMaintenance() {
+		return ""
+	}
+	if len(config.Checks) > 0 {
+		infos, err := m.checkMgr.Checks()
+		if err != nil {
+			return fmt.Sprintf("cannot get check status: %v", err)
+		}
+		statuses := make(map[string]checkstate.CheckStatus, len(infos))
+		for _, info := range infos {
+			statuses[info.Name] = info.Status
+		}
+		for _, name := range config.Checks {
+			if statuses[name] != checkstate.CheckStatusUp {
+				return fmt.Sprintf("check %q is not up", name)
+			}
+		}
+	}
+	if len(config.Services) > 0 {
+		infos, err := m.serviceMgr.Services(config.Services)
+		if err != nil {
+			return fmt.Sprintf("cannot get service status: %v", err)
+		}
+		statuses := make(map[string]servstate.ServiceStatus, len(infos))
+		for _, info := range infos {
+			statuses[info.Name] = info.Current
+		}
+		for _, name := range config.Services {
+			if statuses[name] != servstate.StatusActive {
+				return fmt.Sprintf("service %q is not active", name)
+			}
+		}
+	}
+	return ""
+}
+
+// stop stops petting the watchdog and closes the device, disarming the
+// watchdog first if action is plan.WatchdogClose.
+func (w *watchdog) stop(action plan.WatchdogAction) {
+	w.tomb.Kill(nil)
+	w.tomb.Wait()
+
+	if action == plan.WatchdogFire {
+		logger.Noticef("Watchdog %q closed without disarming; it will fire", w.config.Name)
+	} else {
+		_, err := io.WriteString(w.device, magicClose)
+		if err != nil {
+			logger.Noticef("Cannot disarm watchdog %q: %v", w.config.Name, err)
+		} else {
+			logger.Noticef("Watchdog %q disarmed", w.config.Name)
+		}
+	}
+	err := w.device.Close()
+	if err != nil {
+		logger.Noticef("Cannot close watchdog %q: %v", w.config.Name, err)
+	}
+}
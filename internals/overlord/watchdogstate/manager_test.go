@@ -0,0 +1,295 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package watchdogstate
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/overlord/checkstate"
+	"github.com/canonical/pebble/internals/overlord/servstate"
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type fakeDevice struct {
+	mu     sync.Mutex
+	writes strings.Builder
+	closed bool
+}
+
+func (d *fakeDevice) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return 0, errors.New("device closed")
+	}
+	return d.writes.Write(p)
+}
+
+func (d *fakeDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	return nil
+}
+
+// state returns the number of pets, whether the watchdog was disarmed with
+// the magic close character, and whether the device is closed.
+func (d *fakeDevice) state() (pets int, disarmed, closed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	writes := d.writes.String()
+	return strings.Count(writes, "\x00"), strings.HasSuffix(writes, magicClose), d.closed
+}
+
+type fakeManagers struct {
+	mu       sync.Mutex
+	checks   map[string]checkstate.CheckStatus
+	services map[string]servstate.ServiceStatus
+
+	maintenance bool
+}
+
+func (f *fakeManagers) Checks() ([]*checkstate.CheckInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var infos []*checkstate.CheckInfo
+	for name, status := range f.checks {
+		infos = append(infos, &checkstate.CheckInfo{Name: name, Status: status})
+	}
+	return infos, nil
+}
+
+func (f *fakeManagers) Services(names []string) ([]*servstate.ServiceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var infos []*servstate.ServiceInfo
+	for _, name := range names {
+		infos = append(infos, &servstate.ServiceInfo{Name: name, Current: f.services[name]})
+	}
+	return infos, nil
+}
+
+func (f *fakeManagers) InMaintenance() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.maintenance
+}
+
+func (f *fakeManagers) setMaintenance(maintenance bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maintenance = maintenance
+}
+
+func (f *fakeManagers) setCheck(name string, status checkstate.CheckStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checks[name] = status
+}
+
+type managerSuite struct {
+	devices map[string]*fakeDevice
+	fake    *fakeManagers
+	restore func()
+}
+
+var _ = Suite(&managerSuite{})
+
+func (s *managerSuite) SetUpTest(c *C) {
+	s.devices = make(map[string]*fakeDevice)
+	s.fake = &fakeManagers{
+		checks:   make(map[string]checkstate.CheckStatus),
+		services: make(map[string]servstate.ServiceStatus),
+	}
+	old := openDevice
+	openDevice = func(path string) (io.WriteCloser, error) {
+		if path == "/dev/missing" {
+			return nil, errors.New("no such device")
+		}
+		device := &fakeDevice{}
+		s.devices[path] = device
+		return device, nil
+	}
+	s.restore = func() { openDevice = old }
+}
+
+func (s *managerSuite) TearDownTest(c *C) {
+	s.restore()
+}
+
+func watchdogPlan(watchdogs ...*plan.Watchdog) *plan.Plan {
+	p := &plan.Plan{Watchdogs: make(map[string]*plan.Watchdog)}
+	for _, w := range watchdogs {
+		if w.Interval.Value == 0 {
+			w.Interval.Value = time.Millisecond
+		}
+		if w.OnStop == plan.UnsetWatchdogAction {
+			w.OnStop = plan.WatchdogClose
+		}
+		p.Watchdogs[w.Name] = w
+	}
+	return p
+}
+
+func waitPets(c *C, device *fakeDevice, min int) {
+	for i := 0; i < 200; i++ {
+		pets, _, _ := device.state()
+		if pets >= min {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Fatalf("timed out waiting for %d pets", min)
+}
+
+func (s *managerSuite) TestPetAndDisarm(c *C) {
+	m := NewManager(s.fake, s.fake)
+	m.PlanChanged(watchdogPlan(&plan.Watchdog{Name: "hw", Device: "/dev/watchdog"}))
+	c.Assert(s.devices, HasLen, 0) // not armed until StartUp
+
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	device := s.devices["/dev/watchdog"]
+	c.Assert(device, NotNil)
+	waitPets(c, device, 3)
+
+	m.Stop()
+	_, disarmed, closed := device.state()
+	c.Check(disarmed, Equals, true)
+	c.Check(closed, Equals, true)
+}
+
+func (s *managerSuite) TestOnStopFire(c *C) {
+	m := NewManager(s.fake, s.fake)
+	m.PlanChanged(watchdogPlan(&plan.Watchdog{Name: "hw", Device: "/dev/watchdog", OnStop: plan.WatchdogFire}))
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	device := s.devices["/dev/watchdog"]
+	waitPets(c, device, 1)
+
+	m.Stop()
+	_, disarmed, closed := device.state()
+	c.Check(disarmed, Equals, false)
+	c.Check(closed, Equals, true)
+}
+
+func (s *managerSuite) TestNotPettedWhileUnhealthy(c *C) {
+	s.fake.checks["chk1"] = checkstate.CheckStatusUp
+	s.fake.services["srv1"] = servstate.StatusActive
+
+	m := NewManager(s.fake, s.fake)
+	m.PlanChanged(watchdogPlan(&plan.Watchdog{
+		Name:     "hw",
+		Device:   "/dev/watchdog",
+		Checks:   []string{"chk1"},
+		Services: []string{"srv1"},
+	}))
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+	device := s.devices["/dev/watchdog"]
+	waitPets(c, device, 1)
+
+	s.fake.setCheck("chk1", checkstate.CheckStatusDown)
+	time.Sleep(10 * time.Millisecond) // let any in-flight pet complete
+	before, _, _ := device.state()
+	time.Sleep(20 * time.Millisecond)
+	after, _, _ := device.state()
+	c.Check(after, Equals, before)
+
+	s.fake.setCheck("chk1", checkstate.CheckStatusUp)
+	waitPets(c, device, after+2)
+
+	s.fake.mu.Lock()
+	s.fake.services["srv1"] = servstate.StatusBackoff
+	s.fake.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	before, _, _ = device.state()
+	time.Sleep(20 * time.Millisecond)
+	after, _, _ = device.state()
+	c.Check(after, Equals, before)
+}
+
+func (s *managerSuite) TestPettedInMaintenance(c *C) {
+	s.fake.checks["chk1"] = checkstate.CheckStatusDown
+	s.fake.services["srv1"] = servstate.StatusInactive
+
+	m := NewManager(s.fake, s.fake)
+	m.PlanChanged(watchdogPlan(&plan.Watchdog{
+		Name:     "hw",
+		Device:   "/dev/watchdog",
+		Checks:   []string{"chk1"},
+		Services: []string{"srv1"},
+	}))
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+	device := s.devices["/dev/watchdog"]
+	time.Sleep(20 * time.Millisecond)
+	pets, _, _ := device.state()
+	c.Check(pets, Equals, 0)
+
+	// Stopped services and failing checks are expected in maintenance mode.
+	s.fake.setMaintenance(true)
+	waitPets(c, device, 3)
+
+	s.fake.setMaintenance(false)
+	time.Sleep(10 * time.Millisecond)
+	before, _, _ := device.state()
+	time.Sleep(20 * time.Millisecond)
+	after, _, _ := device.state()
+	c.Check(after, Equals, before)
+}
+
+func (s *managerSuite) TestPlanChanged(c *C) {
+	m := NewManager(s.fake, s.fake)
+	err := m.StartUp()
+	c.Assert(err, IsNil)
+	defer m.Stop()
+
+	m.PlanChanged(watchdogPlan(
+		&plan.Watchdog{Name: "a", Device: "/dev/watchdog0"},
+		&plan.Watchdog{Name: "b", Device: "/dev/watchdog1", OnStop: plan.WatchdogFire},
+		&plan.Watchdog{Name: "c", Device: "/dev/missing"},
+	))
+	c.Assert(s.devices, HasLen, 2)
+	a, b := s.devices["/dev/watchdog0"], s.devices["/dev/watchdog1"]
+	waitPets(c, a, 1)
+	waitPets(c, b, 1)
+
+	// Removed watchdogs are disarmed regardless of their on-stop action.
+	m.PlanChanged(watchdogPlan(&plan.Watchdog{Name: "a", Device: "/dev/watchdog0"}))
+	_, disarmed, closed := b.state()
+	c.Check(disarmed, Equals, true)
+	c.Check(closed, Equals, true)
+	_, _, closed = a.state()
+	c.Check(closed, Equals, false)
+
+	// Changed watchdogs are disarmed and armed again.
+	m.PlanChanged(watchdogPlan(&plan.Watchdog{Name: "a", Device: "/dev/watchdog0", Interval: plan.OptionalDuration{Value: time.Hour}}))
+	_, disarmed, closed = a.state()
+	c.Check(disarmed, Equals, true)
+	c.Check(closed, Equals, true)
+	c.Check(s.devices["/dev/watchdog0"] != a, Equals, true)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// qemuArchNames maps the architecture names used in plans (Go's GOARCH
+// names) to the names that qemu-user-static registers binfmt_misc
+// interpreters under, as "qemu-<name>".
+var qemuArchNames = map[string]string{
+	"386":     "i386",
+	"amd64":   "x86_64",
+	"arm":     "arm",
+	"arm64":   "aarch64",
+	"ppc64le": "ppc64le",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// nativeArchs lists the architectures whose binaries run natively on hosts
+// of another architecture, keyed by host architecture.
+var nativeArchs = map[string][]string{
+	"amd64": {"386"},
+}
+
+var (
+	hostArch  = runtime.GOARCH
+	binfmtDir = "/proc/sys/fs/binfmt_misc"
+)
+
+// HostArch returns the architecture of the host, as used in the "arch" field
+// of services and exec checks, for example "amd64" or "arm64".
+func HostArch() string {
+	return hostArch
+}
+
+func validArch(arch string) bool {
+	_, ok := qemuArchNames[arch]
+	return ok
+}
+
+func validArchNames() string {
+	names := make([]string, 0, len(qemuArchNames))
+	for name := range qemuArchNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// canExecArch reports whether programs built for the given architecture can
+// be run on the host, either natively or using an enabled binfmt_misc
+// interpreter such as those installed by qemu-user-static.
+func canExecArch(arch string) bool {
+	if arch == "" || arch == hostArch {
+		return true
+	}
+	for _, native := range nativeArchs[hostArch] {
+		if arch == native {
+			return true
+		}
+	}
+	f, err := os.Open(filepath.Join(binfmtDir, "qemu-"+qemuArchNames[arch]))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	// The first line of the entry is "enabled" or "disabled".
+	scanner := bufio.NewScanner(f)
+	return scanner.Scan() && scanner.Text() == "enabled"
+}
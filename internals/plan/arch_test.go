@@ -0,0 +1,146 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func parseArchPlan(c *C, layerYAML string) *plan.Plan {
+	layer, err := plan.ParseLayer(0, "layer-0", reindent(layerYAML))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	return &plan.Plan{
+		Layers:   []*plan.Layer{layer},
+		Services: combined.Services,
+		Checks:   combined.Checks,
+	}
+}
+
+func (s *S) TestArch(c *C) {
+	binfmtDir := c.MkDir()
+	restore := plan.FakeHostArch("amd64", binfmtDir)
+	defer restore()
+	c.Check(plan.HostArch(), Equals, "amd64")
+
+	p := parseArchPlan(c, `
+		services:
+			native:
+				override: replace
+				command: cmd
+				arch: amd64
+			compat:
+				override: replace
+				command: cmd
+				arch: "386"
+			any:
+				override: replace
+				command: cmd
+	`)
+	c.Check(p.Validate(), IsNil)
+	c.Check(p.Services["native"].Arch, Equals, "amd64")
+
+	// Foreign architectures need an enabled binfmt_misc interpreter.
+	p = parseArchPlan(c, `
+		services:
+			foreign:
+				override: replace
+				command: cmd
+				arch: arm64
+	`)
+	err := p.Validate()
+	c.Check(err, ErrorMatches, `plan service "foreign" is built for arm64, but the host is amd64 and no binfmt_misc interpreter is enabled for arm64 .*`)
+	_, ok := err.(*plan.FormatError)
+	c.Check(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
+
+	interpreter := filepath.Join(binfmtDir, "qemu-aarch64")
+	err = os.WriteFile(interpreter, []byte("disabled\ninterpreter /usr/bin/qemu-aarch64-static\n"), 0644)
+	c.Assert(err, IsNil)
+	c.Check(p.Validate(), NotNil)
+
+	err = os.WriteFile(interpreter, []byte("enabled\ninterpreter /usr/bin/qemu-aarch64-static\n"), 0644)
+	c.Assert(err, IsNil)
+	c.Check(p.Validate(), IsNil)
+
+	p = parseArchPlan(c, `
+		checks:
+			chk:
+				override: replace
+				exec:
+					command: cmd
+					arch: s390x
+	`)
+	c.Check(p.Validate(), ErrorMatches, `plan check "chk" is built for s390x, but the host is amd64 .*`)
+}
+
+func (s *S) TestArchInvalid(c *C) {
+	_, err := plan.ParseLayer(0, "layer-0", reindent(`
+		services:
+			svc:
+				override: replace
+				command: cmd
+				arch: x86
+	`))
+	c.Check(err, ErrorMatches, `plan service "svc" arch "x86" invalid \(must be one of: 386, amd64, arm, arm64, ppc64le, riscv64, s390x\)`)
+
+	_, err = plan.ParseLayer(0, "layer-0", reindent(`
+		checks:
+			chk:
+				override: replace
+				exec:
+					command: cmd
+					arch: aarch64
+	`))
+	c.Check(err, ErrorMatches, `plan check "chk" arch "aarch64" invalid .*`)
+}
+
+func (s *S) TestArchMerge(c *C) {
+	layer1, err := plan.ParseLayer(1, "label1", reindent(`
+		services:
+			svc:
+				override: replace
+				command: cmd
+				arch: arm64
+		checks:
+			chk:
+				override: replace
+				exec:
+					command: cmd
+					arch: arm64
+	`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(2, "label2", reindent(`
+		services:
+			svc:
+				override: merge
+				arch: amd64
+		checks:
+			chk:
+				override: merge
+				exec:
+					arch: amd64
+	`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer1, layer2)
+	c.Assert(err, IsNil)
+	c.Check(combined.Services["svc"].Arch, Equals, "amd64")
+	c.Check(combined.Checks["chk"].Exec.Arch, Equals, "amd64")
+}
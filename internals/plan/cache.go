@@ -0,0 +1,198 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/canonical/pebble/internals/osutil"
+)
+
+// cacheFormat is the version of the plan cache format. Change it whenever
+// the plan types or the way layers are combined change, so that plans
+// cached by an older build aren't used.
+const cacheFormat = 1
+
+type planCache struct {
+	Key  string `json:"key"`
+	Plan *Plan  `json:"plan"`
+}
+
+// CacheKey returns the key identifying the plan that ReadDir would return
+// for the given pebble directory. It covers everything the combined plan
+// depends on: the files in the layers directory (including fragments in
+// subdirectories), the device facts, the environment variables named in
+// those files, the host's architecture and binfmt_misc interpreters, the
+// plan types and registered extension sections, and the given version,
+// which should identify the build of Pebble.
+func CacheKey(dir, version string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "format %d\nversion %q\narch %q\n", cacheFormat, version, hostArch)
+	for _, arch := range sortedNames(qemuArchNames) {
+		fmt.Fprintf(h, "exec %q %t\n", arch, canExecArch(arch))
+	}
+	writeTypeSignature(h, reflect.TypeOf(Plan{}), make(map[reflect.Type]bool))
+	fmt.Fprintln(h)
+	for _, name := range extensionSectionNames() {
+		fmt.Fprintf(h, "section %q\n", name)
+	}
+	facts := currentFacts()
+	for _, name := range sortedNames(facts) {
+		fmt.Fprintf(h, "fact %q %q\n", name, facts[name])
+	}
+	contents, err := hashLayersDir(h, filepath.Join(dir, "layers"))
+	if err != nil {
+		return "", err
+	}
+	// Only environment variables named in the layer files can affect the
+	// plan, so ignore the others, such as those that change every time the
+	// daemon is started by a service manager.
+	environ := os.Environ()
+	sort.Strings(environ)
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		for _, data := range contents {
+			if bytes.Contains(data, []byte(name)) {
+				fmt.Fprintf(h, "env %q\n", kv)
+				break
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeTypeSignature writes a description of the type, including the
+// fields of structs it refers to, to w. This invalidates the cache when the
+// plan types change, even between builds with the same version.
+func writeTypeSignature(w io.Writer, t reflect.Type, seen map[reflect.Type]bool) {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		fmt.Fprintf(w, "%s(", t.Kind())
+		writeTypeSignature(w, t.Elem(), seen)
+		fmt.Fprint(w, ")")
+	case reflect.Map:
+		fmt.Fprint(w, "map(")
+		writeTypeSignature(w, t.Key(), seen)
+		fmt.Fprint(w, ",")
+		writeTypeSignature(w, t.Elem(), seen)
+		fmt.Fprint(w, ")")
+	case reflect.Struct:
+		fmt.Fprintf(w, "%s{", t)
+		if seen[t] {
+			fmt.Fprint(w, "}")
+			return
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fmt.Fprintf(w, "%s %q ", field.Name, field.Tag)
+			writeTypeSignature(w, field.Type, seen)
+			fmt.Fprint(w, ";")
+		}
+		fmt.Fprint(w, "}")
+	default:
+		fmt.Fprintf(w, "%s", t)
+	}
+}
+
+// hashLayersDir writes the names and content of the files in the layers
+// directory to h, skipping any changes being applied by WriteLayerFiles, and
+// returns their content.
+func hashLayersDir(h hash.Hash, layersDir string) ([][]byte, error) {
+	_, err := os.Stat(layersDir)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(h, "no layers\n")
+		return nil, nil
+	}
+	var contents [][]byte
+	err = filepath.WalkDir(layersDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(layersDir, path)
+		if err != nil {
+			return err
+		}
+		if name == layersPendingName || name == layersJournalName {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "file %q %d\n", filepath.ToSlash(name), len(data))
+		h.Write(data)
+		contents = append(contents, data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read layers directory: %w", err)
+	}
+	return contents, nil
+}
+
+// ReadCache returns the plan cached in the given file if it was written
+// with the given key, or nil if there's no cached plan or it has a
+// different key.
+func ReadCache(path, key string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read plan cache: %w", err)
+	}
+	var cache planCache
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse plan cache: %w", err)
+	}
+	if cache.Key != key || cache.Plan == nil {
+		return nil, nil
+	}
+	return cache.Plan, nil
+}
+
+// WriteCache atomically writes the plan to the given file, along with the
+// key (from CacheKey) it was read with.
+func WriteCache(path, key string, p *Plan) error {
+	data, err := json.Marshal(&planCache{Key: key, Plan: p})
+	if err != nil {
+		return fmt.Errorf("cannot marshal plan cache: %w", err)
+	}
+	err = osutil.AtomicWriteFile(path, data, 0600, 0)
+	if err != nil {
+		return fmt.Errorf("cannot write plan cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func (s *S) TestCacheKey(c *C) {
+	pebbleDir := writeLayerFiles(c, map[string]string{
+		"001-base.yaml": `
+			include: [fragments/common.yaml]
+			services:
+				srv1:
+					override: replace
+					command: echo ${PEBBLE_TEST_CACHE_VAR}
+		`,
+		"fragments/common.yaml": `
+			summary: Common
+		`,
+	})
+	os.Setenv("PEBBLE_TEST_CACHE_VAR", "one")
+	defer os.Unsetenv("PEBBLE_TEST_CACHE_VAR")
+
+	key, err := plan.CacheKey(pebbleDir, "v1")
+	c.Assert(err, IsNil)
+	again, err := plan.CacheKey(pebbleDir, "v1")
+	c.Assert(err, IsNil)
+	c.Check(again, Equals, key)
+
+	// Unrelated environment variables don't change the key.
+	os.Setenv("PEBBLE_TEST_UNRELATED", "x")
+	defer os.Unsetenv("PEBBLE_TEST_UNRELATED")
+	unrelated, err := plan.CacheKey(pebbleDir, "v1")
+	c.Assert(err, IsNil)
+	c.Check(unrelated, Equals, key)
+
+	changed := func() {
+		newKey, err := plan.CacheKey(pebbleDir, "v1")
+		c.Assert(err, IsNil)
+		c.Check(newKey, Not(Equals), key)
+		key = newKey
+	}
+
+	// Environment variables named in the layers do.
+	os.Setenv("PEBBLE_TEST_CACHE_VAR", "two")
+	changed()
+
+	// So do the layer files, including fragments.
+	fragmentPath := filepath.Join(pebbleDir, "layers", "fragments", "common.yaml")
+	err = os.WriteFile(fragmentPath, []byte("summary: Changed\n"), 0644)
+	c.Assert(err, IsNil)
+	changed()
+	err = os.WriteFile(filepath.Join(pebbleDir, "layers", "002-more.yaml"), []byte("summary: More\n"), 0644)
+	c.Assert(err, IsNil)
+	changed()
+
+	// So do the device facts.
+	plan.SetFacts(map[string]string{"model": "gw-2000"})
+	defer plan.SetFacts(nil)
+	changed()
+
+	// And the version.
+	otherVersion, err := plan.CacheKey(pebbleDir, "v2")
+	c.Assert(err, IsNil)
+	c.Check(otherVersion, Not(Equals), key)
+
+	// Pending changes to the layers directory are ignored.
+	err = os.Mkdir(filepath.Join(pebbleDir, "layers", ".pending"), 0700)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(pebbleDir, "layers", ".pending", "003-new.yaml"), []byte("summary: New\n"), 0644)
+	c.Assert(err, IsNil)
+	pending, err := plan.CacheKey(pebbleDir, "v1")
+	c.Assert(err, IsNil)
+	c.Check(pending, Equals, key)
+
+	// A missing layers directory is fine.
+	_, err = plan.CacheKey(c.MkDir(), "v1")
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestReadWriteCache(c *C) {
+	pebbleDir := writeLayerFiles(c, map[string]string{
+		"001-base.yaml": `
+			services:
+				srv1:
+					override: replace
+					command: cmd1
+					startup: enabled
+					environment:
+						A: a
+			checks:
+				chk1:
+					override: replace
+					period: 5s
+					exec:
+						command: check1
+		`,
+		"002-more.yaml": `
+			services:
+				srv2:
+					override: replace
+					command: cmd2
+					after: [srv1]
+		`,
+	})
+	p, err := plan.ReadDir(pebbleDir)
+	c.Assert(err, IsNil)
+	cachePath := filepath.Join(c.MkDir(), "plan-cache")
+
+	cached, err := plan.ReadCache(cachePath, "key")
+	c.Assert(err, IsNil)
+	c.Check(cached, IsNil)
+
+	err = plan.WriteCache(cachePath, "key", p)
+	c.Assert(err, IsNil)
+	cached, err = plan.ReadCache(cachePath, "key")
+	c.Assert(err, IsNil)
+	c.Check(cached, DeepEquals, p)
+
+	cached, err = plan.ReadCache(cachePath, "other")
+	c.Assert(err, IsNil)
+	c.Check(cached, IsNil)
+
+	err = os.WriteFile(cachePath, []byte("{"), 0600)
+	c.Assert(err, IsNil)
+	_, err = plan.ReadCache(cachePath, "key")
+	c.Assert(err, ErrorMatches, "cannot parse plan cache: .*")
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+type DiffAction string
+
+const (
+	DiffAdded   DiffAction = "added"
+	DiffRemoved DiffAction = "removed"
+	DiffChanged DiffAction = "changed"
+)
+
+// ItemDiff describes how a single item in a plan section, such as a service
+// or a check, differs between two plans.
+type ItemDiff struct {
+	// Section is the plan section, using its YAML name (e.g. "services").
+	Section string
+	Name    string
+	Action  DiffAction
+	// Fields lists the fields that differ, for changed items.
+	Fields []*FieldDiff
+}
+
+// FieldDiff describes how a single field of an item differs between two
+// plans. Values are in their YAML form, and nil if the field is unset.
+type FieldDiff struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// Diff returns the differences between two plans, ordered by section, item
+// name, and field name. The comparison uses the plans' YAML representation,
+// so it covers every section without needing to know its item type.
+func Diff(from, to *Plan) ([]*ItemDiff, error) {
+	fromSections, err := planSections(from)
+	if err != nil {
+		return nil, err
+	}
+	toSections, err := planSections(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []*ItemDiff
+	for _, section := range sortedKeys(fromSections, toSections) {
+		fromItems, toItems := fromSections[section], toSections[section]
+		for _, name := range sortedKeys(fromItems, toItems) {
+			fromItem, inFrom := fromItems[name]
+			toItem, inTo := toItems[name]
+			switch {
+			case !inFrom:
+				diffs = append(diffs, &ItemDiff{Section: section, Name: name, Action: DiffAdded})
+			case !inTo:
+				diffs = append(diffs, &ItemDiff{Section: section, Name: name, Action: DiffRemoved})
+			default:
+				var fields []*FieldDiff
+				for _, field := range sortedKeys(fromItem, toItem) {
+					oldValue, newValue := fromItem[field], toItem[field]
+					if !reflect.DeepEqual(oldValue, newValue) {
+						fields = append(fields, &FieldDiff{Field: field, Old: oldValue, New: newValue})
+					}
+				}
+				if len(fields) > 0 {
+					diffs = append(diffs, &ItemDiff{Section: section, Name: name, Action: DiffChanged, Fields: fields})
+				}
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// ChangedSections returns the set of sections, by YAML name (for example
+// "services"), that differ between two plans.
+func ChangedSections(from, to *Plan) (map[string]bool, error) {
+	diffs, err := Diff(from, to)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string]bool)
+	for _, diff := range diffs {
+		changed[diff.Section] = true
+	}
+	return changed, nil
+}
+
+// planSections converts a plan to a map of section name to item name to
+// field name to value, via its YAML representation. Items that are plain
+// values rather than maps (such as variables) have a single "value" field.
+func planSections(p *Plan) (map[string]map[string]map[string]interface{}, error) {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal plan: %w", err)
+	}
+	var raw map[string]map[string]interface{}
+	err = yaml.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal plan: %w", err)
+	}
+	sections := make(map[string]map[string]map[string]interface{}, len(raw))
+	for section, items := range raw {
+		sections[section] = make(map[string]map[string]interface{}, len(items))
+		for name, item := range items {
+			fields, ok := item.(map[string]interface{})
+			if !ok {
+				fields = map[string]interface{}{"value": item}
+			}
+			sections[section][name] = fields
+		}
+	}
+	return sections, nil
+}
+
+// sortedKeys returns the union of the keys of a and b, in sorted order.
+func sortedKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
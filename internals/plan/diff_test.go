@@ -0,0 +1,148 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func (s *S) parsePlan(c *C, layers ...string) *plan.Plan {
+	var parsed []*plan.Layer
+	for i, layerYAML := range layers {
+		layer, err := plan.ParseLayer(i+1, "layer", reindent(layerYAML))
+		c.Assert(err, IsNil)
+		parsed = append(parsed, layer)
+	}
+	p, err := plan.NewPlan(parsed)
+	c.Assert(err, IsNil)
+	return p
+}
+
+func (s *S) TestDiff(c *C) {
+	from := s.parsePlan(c, `
+		services:
+			srv1:
+				override: replace
+				command: cmd1
+				after: [srv2]
+			srv2:
+				override: replace
+				command: cmd2
+			srv3:
+				override: replace
+				command: cmd3
+		checks:
+			chk1:
+				override: replace
+				exec:
+					command: true
+`)
+	to := s.parsePlan(c, `
+		services:
+			srv1:
+				override: replace
+				command: cmd1 --new
+				startup: enabled
+			srv2:
+				override: replace
+				command: cmd2
+			srv4:
+				override: replace
+				command: cmd4
+		checks:
+			chk1:
+				override: replace
+				exec:
+					command: true
+		sysctls:
+			vm.swappiness:
+				override: replace
+				value: "10"
+`)
+
+	diffs, err := plan.Diff(from, to)
+	c.Assert(err, IsNil)
+	c.Assert(diffs, DeepEquals, []*plan.ItemDiff{{
+		Section: "services",
+		Name:    "srv1",
+		Action:  plan.DiffChanged,
+		Fields: []*plan.FieldDiff{
+			{Field: "after", Old: []interface{}{"srv2"}},
+			{Field: "command", Old: "cmd1", New: "cmd1 --new"},
+			{Field: "startup", New: "enabled"},
+		},
+	}, {
+		Section: "services",
+		Name:    "srv3",
+		Action:  plan.DiffRemoved,
+	}, {
+		Section: "services",
+		Name:    "srv4",
+		Action:  plan.DiffAdded,
+	}, {
+		Section: "sysctls",
+		Name:    "vm.swappiness",
+		Action:  plan.DiffAdded,
+	}})
+
+	// Diffing a plan with itself gives no differences.
+	diffs, err = plan.Diff(to, to)
+	c.Assert(err, IsNil)
+	c.Assert(diffs, HasLen, 0)
+
+	diffs, err = plan.Diff(&plan.Plan{}, &plan.Plan{})
+	c.Assert(err, IsNil)
+	c.Assert(diffs, HasLen, 0)
+}
+
+func (s *S) TestChangedSections(c *C) {
+	from := s.parsePlan(c, `
+		services:
+			srv1:
+				override: replace
+				command: cmd1
+		checks:
+			chk1:
+				override: replace
+				exec:
+					command: cmd
+	`)
+	to := s.parsePlan(c, `
+		services:
+			srv1:
+				override: replace
+				command: cmd1
+		checks:
+			chk1:
+				override: replace
+				exec:
+					command: cmd
+				period: 1m
+		log-targets:
+			tgt1:
+				override: replace
+				type: loki
+				location: http://localhost/
+	`)
+	changed, err := plan.ChangedSections(from, to)
+	c.Assert(err, IsNil)
+	c.Assert(changed, DeepEquals, map[string]bool{"checks": true, "log-targets": true})
+
+	changed, err = plan.ChangedSections(from, from)
+	c.Assert(err, IsNil)
+	c.Assert(changed, HasLen, 0)
+}
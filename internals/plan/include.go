@@ -0,0 +1,147 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey is the top-level key in a layer file that lists the fragments
+// to include.
+const includeKey = "include"
+
+// resolveIncludes merges the fragments listed in the "include" key of the
+// layer file with the given name, which is relative to the layers directory,
+// and returns the resulting YAML. Fragments are merged in the order listed,
+// and the including file's own content is merged last, so it takes
+// precedence. Fragments may include other fragments. If the file has no
+// includes, it returns nil.
+func resolveIncludes(layersDir, name string, data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte(includeKey)) {
+		// Avoid parsing the YAML twice in the common case.
+		return nil, nil
+	}
+	var doc map[string]interface{}
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		// Leave it to ParseLayer to report the error.
+		return nil, nil
+	}
+	if _, ok := doc[includeKey]; !ok {
+		return nil, nil
+	}
+	merged, err := mergeIncludes(layersDir, name, doc, nil)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(merged)
+}
+
+// mergeIncludes returns the document for the file with the given name with
+// its includes merged in. The stack holds the names of the files currently
+// being included, to detect cycles.
+func mergeIncludes(layersDir, name string, doc map[string]interface{}, stack []string) (map[string]interface{}, error) {
+	value, ok := doc[includeKey]
+	if !ok {
+		return doc, nil
+	}
+	delete(doc, includeKey)
+
+	includes, err := includePaths(value)
+	if err != nil {
+		return nil, &FormatError{
+			Message: fmt.Sprintf("invalid %q in %q: %v", includeKey, name, err),
+		}
+	}
+	stack = append(stack, name)
+	merged := make(map[string]interface{})
+	for _, include := range includes {
+		for _, s := range stack {
+			if s == include {
+				return nil, &FormatError{
+					Message: fmt.Sprintf("include cycle: %s -> %s", strings.Join(stack, " -> "), include),
+				}
+			}
+		}
+		data, err := os.ReadFile(filepath.Join(layersDir, filepath.FromSlash(include)))
+		if err != nil {
+			// Errors from package os generally include the path.
+			return nil, fmt.Errorf("cannot include %q in %q: %v", include, name, err)
+		}
+		var fragment map[string]interface{}
+		err = yaml.Unmarshal(data, &fragment)
+		if err != nil {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("cannot parse %q included in %q: %v", include, name, err),
+			}
+		}
+		fragment, err = mergeIncludes(layersDir, include, fragment, stack)
+		if err != nil {
+			return nil, err
+		}
+		mergeYAML(merged, fragment)
+	}
+	mergeYAML(merged, doc)
+	return merged, nil
+}
+
+// includePaths returns the cleaned paths from the value of an "include"
+// key, checking that each is relative and within the layers directory.
+func includePaths(value interface{}) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be a list of paths")
+	}
+	paths := make([]string, 0, len(list))
+	for _, item := range list {
+		p, ok := item.(string)
+		if !ok || p == "" {
+			return nil, fmt.Errorf("must be a list of paths")
+		}
+		cleaned := path.Clean(p)
+		if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return nil, fmt.Errorf("path %q must be relative to the layers directory", p)
+		}
+		paths = append(paths, cleaned)
+	}
+	return paths, nil
+}
+
+// mergeYAML deep merges src into dst: maps are merged key by key, and any
+// other value in src replaces the value in dst.
+func mergeYAML(dst, src map[string]interface{}) {
+	for key, srcValue := range src {
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeYAML(dstMap, srcMap)
+			continue
+		}
+		if srcIsMap {
+			// Copy, so that merging into it later doesn't modify src.
+			copied := make(map[string]interface{}, len(srcMap))
+			mergeYAML(copied, srcMap)
+			srcValue = copied
+		}
+		dst[key] = srcValue
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func writeLayerFiles(c *C, files map[string]string) string {
+	pebbleDir := c.MkDir()
+	for name, content := range files {
+		path := filepath.Join(pebbleDir, "layers", filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		c.Assert(err, IsNil)
+		err = os.WriteFile(path, reindent(content), 0644)
+		c.Assert(err, IsNil)
+	}
+	return pebbleDir
+}
+
+func (s *S) TestReadDirIncludes(c *C) {
+	pebbleDir := writeLayerFiles(c, map[string]string{
+		"fragments/base.yaml": `
+			services:
+				srv1:
+					override: replace
+					command: cmd1
+					startup: enabled
+					environment:
+						A: base
+						B: base
+		`,
+		"fragments/model.yaml": `
+			include: [fragments/base.yaml]
+			services:
+				srv1:
+					environment:
+						B: model
+		`,
+		"001-device.yaml": `
+			include:
+				- fragments/model.yaml
+				- ./fragments/../fragments/extra.yaml
+			summary: Device layer
+			services:
+				srv1:
+					command: cmd2
+		`,
+		"fragments/extra.yaml": `
+			services:
+				srv2:
+					override: replace
+					command: cmd3
+		`,
+	})
+
+	p, err := plan.ReadDir(pebbleDir)
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 1)
+	c.Assert(p.Layers[0].Summary, Equals, "Device layer")
+	c.Assert(p.Services["srv1"].Command, Equals, "cmd2")
+	c.Assert(p.Services["srv1"].Startup, Equals, plan.StartupEnabled)
+	c.Assert(p.Services["srv1"].Environment, DeepEquals, map[string]string{
+		"A": "base",
+		"B": "model",
+	})
+	c.Assert(p.Services["srv2"].Command, Equals, "cmd3")
+}
+
+func (s *S) TestReadDirIncludeErrors(c *C) {
+	tests := []struct {
+		files map[string]string
+		error string
+	}{{
+		files: map[string]string{
+			"001-device.yaml": `
+				include: fragments/base.yaml
+			`,
+		},
+		error: `invalid "include" in "001-device.yaml": must be a list of paths`,
+	}, {
+		files: map[string]string{
+			"001-device.yaml": `
+				include: [../secret.yaml]
+			`,
+		},
+		error: `invalid "include" in "001-device.yaml": path "../secret.yaml" must be relative to the layers directory`,
+	}, {
+		files: map[string]string{
+			"001-device.yaml": `
+				include: [/etc/passwd]
+			`,
+		},
+		error: `invalid "include" in "001-device.yaml": path "/etc/passwd" must be relative to the layers directory`,
+	}, {
+		files: map[string]string{
+			"001-device.yaml": `
+				include: [fragments/missing.yaml]
+			`,
+		},
+		error: `cannot include "fragments/missing.yaml" in "001-device.yaml": open .*: no such file or directory`,
+	}, {
+		files: map[string]string{
+			"001-device.yaml": `
+				include: [fragments/a.yaml]
+			`,
+			"fragments/a.yaml": `
+				include: [fragments/b.yaml]
+			`,
+			"fragments/b.yaml": `
+				include: [fragments/a.yaml]
+			`,
+		},
+		error: `include cycle: 001-device.yaml -> fragments/a.yaml -> fragments/b.yaml -> fragments/a.yaml`,
+	}, {
+		files: map[string]string{
+			"001-device.yaml": `
+				include: [fragments/a.yaml]
+			`,
+			"fragments/a.yaml": `
+				services: [
+			`,
+		},
+		error: `cannot parse "fragments/a.yaml" included in "001-device.yaml": .*`,
+	}, {
+		files: map[string]string{
+			"001-device.yaml": `
+				include: [fragments/a.yaml]
+			`,
+			"fragments/a.yaml": `
+				services:
+					srv1:
+						command: cmd
+			`,
+		},
+		error: `layer "device" must define "override" for service "srv1"`,
+	}}
+	for _, test := range tests {
+		pebbleDir := writeLayerFiles(c, test.files)
+		_, err := plan.ReadDir(pebbleDir)
+		c.Assert(err, ErrorMatches, test.error)
+	}
+}
+
+func (s *S) TestIncludeOnlyInLayerFiles(c *C) {
+	_, err := plan.ParseLayer(1, "layer", reindent(`
+		include: [fragments/base.yaml]
+	`))
+	c.Assert(err, ErrorMatches, `unknown section "include"`)
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/canonical/pebble/internals/osutil"
+)
+
+const (
+	// layersJournalName is the name of the journal in the layers directory
+	// that records a set of layer file changes being applied.
+	layersJournalName = ".journal"
+
+	// layersPendingName is the name of the directory in the layers
+	// directory that holds the new layer files until they're moved into
+	// place. Keeping it inside the layers directory ensures the files can
+	// be renamed, even when the layers directory is a separate mount (for
+	// example a ZFS dataset or an overlay filesystem).
+	layersPendingName = ".pending"
+)
+
+// layersJournal lists the layer files changed by WriteLayerFiles.
+type layersJournal struct {
+	Write  []string `json:"write,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// ReadLayersDirWithFiles returns the layers that ReadLayersDir would return
+// after the given changes were made with WriteLayerFiles, without changing
+// the layers directory. It can be used to validate a set of changes before
+// writing them.
+func ReadLayersDirWithFiles(dirname string, files map[string][]byte) ([]*Layer, error) {
+	var names []string
+	finfos, err := os.ReadDir(dirname)
+	if err != nil && !os.IsNotExist(err) {
+		// Errors from package os generally include the path.
+		return nil, fmt.Errorf("cannot read layers directory: %v", err)
+	}
+	for _, finfo := range finfos {
+		name := finfo.Name()
+		if finfo.IsDir() || !strings.HasSuffix(name, ".yaml") {
+			continue
+		}
+		if _, ok := files[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name, data := range files {
+		if data != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return readLayers(dirname, names, files)
+}
+
+// WriteLayerFiles makes a set of changes to the layers directory as a single
+// transaction. The files map is keyed by layer filename (for example
+// "001-base.yaml"), and a nil value removes that file. The layers directory
+// is created if it doesn't exist.
+//
+// The new files are first written to a pending directory, then the changes
+// are recorded in a journal and carried out. If the process is interrupted
+// (for example by a power loss) before the journal is written, none of the
+// changes are made, and after that, RecoverLayersDir completes them, so the
+// layers directory never holds a partial set of changes or a half-written
+// file.
+func WriteLayerFiles(dirname string, files map[string][]byte) error {
+	var journal layersJournal
+	for name, data := range files {
+		if !fnameExp.MatchString(name) {
+			return fmt.Errorf("invalid layer filename: %q (must look like \"123-some-label.yaml\")", name)
+		}
+		if data == nil {
+			journal.Remove = append(journal.Remove, name)
+		} else {
+			journal.Write = append(journal.Write, name)
+		}
+	}
+	sort.Strings(journal.Write)
+	sort.Strings(journal.Remove)
+
+	// Finish (or discard) any earlier set of changes first, so they're not
+	// mixed up with this one.
+	err := RecoverLayersDir(dirname)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dirname, 0755)
+	if err != nil {
+		return err
+	}
+	pendingDir := filepath.Join(dirname, layersPendingName)
+	err = os.Mkdir(pendingDir, 0700)
+	if err != nil {
+		return err
+	}
+	for _, name := range journal.Write {
+		err := osutil.AtomicWriteFile(filepath.Join(pendingDir, name), files[name], 0644, 0)
+		if err != nil {
+			os.RemoveAll(pendingDir)
+			return err
+		}
+	}
+
+	data, err := json.Marshal(&journal)
+	if err != nil {
+		os.RemoveAll(pendingDir)
+		return err
+	}
+	// Once the journal is written, the changes are committed.
+	err = osutil.AtomicWriteFile(filepath.Join(dirname, layersJournalName), data, 0600, 0)
+	if err != nil {
+		os.RemoveAll(pendingDir)
+		return err
+	}
+	return applyLayersJournal(dirname, &journal)
+}
+
+// RecoverLayersDir completes the set of changes being made by WriteLayerFiles
+// if it was interrupted after the changes were committed, or discards them
+// if it was interrupted before. It does nothing if the layers directory
+// doesn't exist.
+func RecoverLayersDir(dirname string) error {
+	data, err := os.ReadFile(filepath.Join(dirname, layersJournalName))
+	if os.IsNotExist(err) {
+		return os.RemoveAll(filepath.Join(dirname, layersPendingName))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read layers journal: %v", err)
+	}
+	var journal layersJournal
+	err = json.Unmarshal(data, &journal)
+	if err != nil {
+		return fmt.Errorf("cannot parse layers journal: %v", err)
+	}
+	return applyLayersJournal(dirname, &journal)
+}
+
+// applyLayersJournal carries out the changes recorded in the journal, and
+// then removes it. It can be called again if it's interrupted, as files
+// that have already been moved or removed are skipped.
+func applyLayersJournal(dirname string, journal *layersJournal) error {
+	pendingDir := filepath.Join(dirname, layersPendingName)
+	for _, name := range journal.Write {
+		err := os.Rename(filepath.Join(pendingDir, name), filepath.Join(dirname, name))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot apply layers journal: %v", err)
+		}
+	}
+	for _, name := range journal.Remove {
+		err := os.Remove(filepath.Join(dirname, name))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot apply layers journal: %v", err)
+		}
+	}
+	err := syncDir(dirname)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(dirname, layersJournalName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = syncDir(dirname)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(pendingDir)
+}
+
+// syncDir flushes the directory entries in dir to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	err = d.Sync()
+	// Some filesystems, such as certain overlay filesystems, don't support
+	// syncing directories, and order renames on their own.
+	if errors.Is(err, syscall.EINVAL) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func layersDirNames(c *C, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	c.Assert(err, IsNil)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func (s *S) TestWriteLayerFiles(c *C) {
+	layersDir := filepath.Join(c.MkDir(), "layers")
+
+	// The layers directory is created if needed.
+	err := plan.WriteLayerFiles(layersDir, map[string][]byte{
+		"001-one.yaml": []byte("summary: one\n"),
+		"002-two.yaml": []byte("summary: two\n"),
+	})
+	c.Assert(err, IsNil)
+	c.Check(layersDirNames(c, layersDir), DeepEquals, []string{"001-one.yaml", "002-two.yaml"})
+
+	err = plan.WriteLayerFiles(layersDir, map[string][]byte{
+		"001-one.yaml":   nil,
+		"002-two.yaml":   []byte("summary: two again\n"),
+		"003-three.yaml": []byte("summary: three\n"),
+	})
+	c.Assert(err, IsNil)
+	c.Check(layersDirNames(c, layersDir), DeepEquals, []string{"002-two.yaml", "003-three.yaml"})
+	layers, err := plan.ReadLayersDir(layersDir)
+	c.Assert(err, IsNil)
+	c.Assert(layers, HasLen, 2)
+	c.Check(layers[0].Summary, Equals, "two again")
+	c.Check(layers[1].Summary, Equals, "three")
+
+	err = plan.WriteLayerFiles(layersDir, map[string][]byte{
+		"bad.yaml": []byte("summary: bad\n"),
+	})
+	c.Assert(err, ErrorMatches, `invalid layer filename: "bad.yaml" .*`)
+	c.Check(layersDirNames(c, layersDir), DeepEquals, []string{"002-two.yaml", "003-three.yaml"})
+}
+
+func (s *S) TestRecoverLayersDir(c *C) {
+	layersDir := filepath.Join(c.MkDir(), "layers")
+
+	// A missing layers directory is fine.
+	err := plan.RecoverLayersDir(layersDir)
+	c.Assert(err, IsNil)
+
+	err = plan.WriteLayerFiles(layersDir, map[string][]byte{
+		"001-one.yaml": []byte("summary: one\n"),
+	})
+	c.Assert(err, IsNil)
+	pendingDir := filepath.Join(layersDir, ".pending")
+
+	// Changes that weren't committed are discarded.
+	err = os.Mkdir(pendingDir, 0700)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(pendingDir, "002-two.yaml"), []byte("summary: two\n"), 0644)
+	c.Assert(err, IsNil)
+	err = plan.RecoverLayersDir(layersDir)
+	c.Assert(err, IsNil)
+	c.Check(layersDirNames(c, layersDir), DeepEquals, []string{"001-one.yaml"})
+
+	// Committed changes are completed, including when some of them were
+	// already made.
+	err = os.Mkdir(pendingDir, 0700)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(pendingDir, "003-three.yaml"), []byte("summary: three\n"), 0644)
+	c.Assert(err, IsNil)
+	err = os.WriteFile(filepath.Join(layersDir, "002-two.yaml"), []byte("summary: two\n"), 0644)
+	c.Assert(err, IsNil)
+	journal := `{"write":["002-two.yaml","003-three.yaml"],"remove":["001-one.yaml"]}`
+	err = os.WriteFile(filepath.Join(layersDir, ".journal"), []byte(journal), 0600)
+	c.Assert(err, IsNil)
+	err = plan.RecoverLayersDir(layersDir)
+	c.Assert(err, IsNil)
+	c.Check(layersDirNames(c, layersDir), DeepEquals, []string{"002-two.yaml", "003-three.yaml"})
+
+	// A corrupt journal is reported rather than guessed at.
+	err = os.WriteFile(filepath.Join(layersDir, ".journal"), []byte("{"), 0600)
+	c.Assert(err, IsNil)
+	err = plan.RecoverLayersDir(layersDir)
+	c.Assert(err, ErrorMatches, "cannot parse layers journal: .*")
+}
+
+func (s *S) TestReadLayersDirWithFiles(c *C) {
+	pebbleDir := writeLayerFiles(c, map[string]string{
+		"001-one.yaml": `
+			summary: one
+		`,
+		"002-two.yaml": `
+			summary: two
+		`,
+		"fragments/base.yaml": `
+			description: base
+		`,
+	})
+	layersDir := filepath.Join(pebbleDir, "layers")
+
+	layers, err := plan.ReadLayersDirWithFiles(layersDir, map[string][]byte{
+		"001-one.yaml":   nil,
+		"002-two.yaml":   []byte("include: [fragments/base.yaml]\nsummary: two again\n"),
+		"003-three.yaml": []byte("summary: three\n"),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(layers, HasLen, 2)
+	c.Check(layers[0].Label, Equals, "two")
+	c.Check(layers[0].Summary, Equals, "two again")
+	c.Check(layers[0].Description, Equals, "base")
+	c.Check(layers[1].Label, Equals, "three")
+
+	// The directory itself isn't changed.
+	c.Check(layersDirNames(c, layersDir), DeepEquals, []string{"001-one.yaml", "002-two.yaml", "fragments"})
+
+	_, err = plan.ReadLayersDirWithFiles(layersDir, map[string][]byte{
+		"003-one.yaml": []byte("summary: one again\n"),
+	})
+	c.Assert(err, ErrorMatches, `invalid layer filename: "003-one.yaml" not unique .*`)
+}
@@ -16,13 +16,19 @@ package plan
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/canonical/x-go/strutil/shlex"
@@ -40,23 +46,61 @@ const (
 	defaultCheckPeriod    = 10 * time.Second
 	defaultCheckTimeout   = 3 * time.Second
 	defaultCheckThreshold = 3
+
+	defaultTimeServerPollInterval = 15 * time.Minute
+	minTimeServerPollInterval     = 16 * time.Second
+
+	defaultWatchdogDevice   = "/dev/watchdog"
+	defaultWatchdogInterval = 10 * time.Second
+
+	maxLogTargetBufferSize    = 100000
+	minLogTargetFlushInterval = 10 * time.Millisecond
+	maxLogTargetFlushInterval = 10 * time.Minute
 )
 
 type Plan struct {
-	Layers     []*Layer              `yaml:"-"`
-	Services   map[string]*Service   `yaml:"services,omitempty"`
-	Checks     map[string]*Check     `yaml:"checks,omitempty"`
-	LogTargets map[string]*LogTarget `yaml:"log-targets,omitempty"`
+	Layers        []*Layer                 `yaml:"-"`
+	Services      map[string]*Service      `yaml:"services,omitempty"`
+	Checks        map[string]*Check        `yaml:"checks,omitempty"`
+	LogTargets    map[string]*LogTarget    `yaml:"log-targets,omitempty"`
+	NoticeHooks   map[string]*NoticeHook   `yaml:"notice-hooks,omitempty"`
+	Network       *Network                 `yaml:"network,omitempty"`
+	Mounts        map[string]*Mount        `yaml:"mounts,omitempty"`
+	KernelModules map[string]*KernelModule `yaml:"kernel-modules,omitempty"`
+	Sysctls       map[string]*Sysctl       `yaml:"sysctls,omitempty"`
+	TimeServers   map[string]*TimeServer   `yaml:"time-servers,omitempty"`
+	Watchdogs     map[string]*Watchdog     `yaml:"watchdogs,omitempty"`
+	Devices       map[string]*Device       `yaml:"devices,omitempty"`
+	Secrets       map[string]*Secret       `yaml:"secrets,omitempty"`
+	Vars          map[string]string        `yaml:"vars,omitempty"`
+
+	// Sections holds the content of extension sections registered with
+	// RegisterSection, keyed by section name.
+	Sections map[string]interface{} `yaml:",inline"`
 }
 
 type Layer struct {
-	Order       int                   `yaml:"-"`
-	Label       string                `yaml:"-"`
-	Summary     string                `yaml:"summary,omitempty"`
-	Description string                `yaml:"description,omitempty"`
-	Services    map[string]*Service   `yaml:"services,omitempty"`
-	Checks      map[string]*Check     `yaml:"checks,omitempty"`
-	LogTargets  map[string]*LogTarget `yaml:"log-targets,omitempty"`
+	Order         int                      `yaml:"-"`
+	Label         string                   `yaml:"-"`
+	Summary       string                   `yaml:"summary,omitempty"`
+	Description   string                   `yaml:"description,omitempty"`
+	Services      map[string]*Service      `yaml:"services,omitempty"`
+	Checks        map[string]*Check        `yaml:"checks,omitempty"`
+	LogTargets    map[string]*LogTarget    `yaml:"log-targets,omitempty"`
+	NoticeHooks   map[string]*NoticeHook   `yaml:"notice-hooks,omitempty"`
+	Network       *Network                 `yaml:"network,omitempty"`
+	Mounts        map[string]*Mount        `yaml:"mounts,omitempty"`
+	KernelModules map[string]*KernelModule `yaml:"kernel-modules,omitempty"`
+	Sysctls       map[string]*Sysctl       `yaml:"sysctls,omitempty"`
+	TimeServers   map[string]*TimeServer   `yaml:"time-servers,omitempty"`
+	Watchdogs     map[string]*Watchdog     `yaml:"watchdogs,omitempty"`
+	Devices       map[string]*Device       `yaml:"devices,omitempty"`
+	Secrets       map[string]*Secret       `yaml:"secrets,omitempty"`
+	Vars          map[string]string        `yaml:"vars,omitempty"`
+
+	// Sections holds the content of extension sections registered with
+	// RegisterSection, keyed by section name.
+	Sections map[string]interface{} `yaml:",inline"`
 }
 
 type Service struct {
@@ -68,11 +112,41 @@ type Service struct {
 	Override    Override       `yaml:"override,omitempty"`
 	Command     string         `yaml:"command,omitempty"`
 
+	// Kind is how the service is run: as a process (the default), or as
+	// an OCI container, in which case Command is the bundle directory.
+	Kind ServiceKind `yaml:"kind,omitempty"`
+
+	// Image is the OCI image layout directory that an OCI service's bundle
+	// is unpacked from before the service starts, if set.
+	Image string `yaml:"image,omitempty"`
+
+	// Arch is the architecture the service's command is built for, if it
+	// may differ from the host's, for example "arm64".
+	Arch string `yaml:"arch,omitempty"`
+
+	// When is an expression that determines whether the service is
+	// included in the plan, evaluated against the device's facts.
+	When string `yaml:"when,omitempty"`
+
 	// Service dependencies
 	After    []string `yaml:"after,omitempty"`
 	Before   []string `yaml:"before,omitempty"`
 	Requires []string `yaml:"requires,omitempty"`
 
+	// RestartWith lists services that, when they restart, cause this
+	// service to be restarted after them.
+	RestartWith []string `yaml:"restart-with,omitempty"`
+
+	// Preconditions that are waited for before the service's command is
+	// run: paths that must exist, and TCP ports ("[host:]port") that must
+	// accept connections, for up to RequiresTimeout.
+	// RequiresDevice lists devices in the plan's "devices" section that
+	// must be ready, which is waited for in the same way.
+	RequiresPath    []string         `yaml:"requires-path,omitempty"`
+	RequiresPort    []string         `yaml:"requires-port,omitempty"`
+	RequiresDevice  []string         `yaml:"requires-device,omitempty"`
+	RequiresTimeout OptionalDuration `yaml:"requires-timeout,omitempty"`
+
 	// Options for command execution
 	Environment map[string]string `yaml:"environment,omitempty"`
 	UserID      *int              `yaml:"user-id,omitempty"`
@@ -80,6 +154,17 @@ type Service struct {
 	GroupID     *int              `yaml:"group-id,omitempty"`
 	Group       string            `yaml:"group,omitempty"`
 	WorkingDir  string            `yaml:"working-dir,omitempty"`
+	Stdin       ServiceStdin      `yaml:"stdin,omitempty"`
+	Isolation   *ServiceIsolation `yaml:"isolation,omitempty"`
+	Ulimits     map[string]Ulimit `yaml:"ulimits,omitempty"`
+
+	// Directories are created (if missing) before the service starts,
+	// keyed by absolute path.
+	Directories map[string]*ServiceDirectory `yaml:"directories,omitempty"`
+
+	// Secrets are resolved when the service starts and passed to it as
+	// environment variables or files, keyed by secret name.
+	Secrets map[string]*ServiceSecret `yaml:"secrets,omitempty"`
 
 	// Auto-restart and backoff functionality
 	OnSuccess      ServiceAction            `yaml:"on-success,omitempty"`
@@ -97,6 +182,10 @@ func (s *Service) Copy() *Service {
 	copied.After = append([]string(nil), s.After...)
 	copied.Before = append([]string(nil), s.Before...)
 	copied.Requires = append([]string(nil), s.Requires...)
+	copied.RestartWith = append([]string(nil), s.RestartWith...)
+	copied.RequiresPath = append([]string(nil), s.RequiresPath...)
+	copied.RequiresPort = append([]string(nil), s.RequiresPort...)
+	copied.RequiresDevice = append([]string(nil), s.RequiresDevice...)
 	if s.Environment != nil {
 		copied.Environment = make(map[string]string)
 		for k, v := range s.Environment {
@@ -115,6 +204,27 @@ func (s *Service) Copy() *Service {
 			copied.OnCheckFailure[k] = v
 		}
 	}
+	if s.Isolation != nil {
+		copied.Isolation = s.Isolation.Copy()
+	}
+	if s.Ulimits != nil {
+		copied.Ulimits = make(map[string]Ulimit)
+		for k, v := range s.Ulimits {
+			copied.Ulimits[k] = v
+		}
+	}
+	if s.Directories != nil {
+		copied.Directories = make(map[string]*ServiceDirectory)
+		for k, v := range s.Directories {
+			copied.Directories[k] = v.Copy()
+		}
+	}
+	if s.Secrets != nil {
+		copied.Secrets = make(map[string]*ServiceSecret)
+		for k, v := range s.Secrets {
+			copied.Secrets[k] = v.Copy()
+		}
+	}
 	return &copied
 }
 
@@ -132,6 +242,18 @@ func (s *Service) Merge(other *Service) {
 	if other.Command != "" {
 		s.Command = other.Command
 	}
+	if other.Kind != KindUnset {
+		s.Kind = other.Kind
+	}
+	if other.Image != "" {
+		s.Image = other.Image
+	}
+	if other.Arch != "" {
+		s.Arch = other.Arch
+	}
+	if other.When != "" {
+		s.When = other.When
+	}
 	if other.KillDelay.IsSet {
 		s.KillDelay = other.KillDelay
 	}
@@ -150,9 +272,43 @@ func (s *Service) Merge(other *Service) {
 	if other.WorkingDir != "" {
 		s.WorkingDir = other.WorkingDir
 	}
+	if other.Stdin != StdinUnset {
+		s.Stdin = other.Stdin
+	}
+	if other.Isolation != nil {
+		if s.Isolation == nil {
+			s.Isolation = &ServiceIsolation{}
+		}
+		s.Isolation.Merge(other.Isolation)
+	}
+	for k, v := range other.Ulimits {
+		if s.Ulimits == nil {
+			s.Ulimits = make(map[string]Ulimit)
+		}
+		s.Ulimits[k] = v
+	}
+	for k, v := range other.Directories {
+		if s.Directories == nil {
+			s.Directories = make(map[string]*ServiceDirectory)
+		}
+		s.Directories[k] = v.Copy()
+	}
+	for k, v := range other.Secrets {
+		if s.Secrets == nil {
+			s.Secrets = make(map[string]*ServiceSecret)
+		}
+		s.Secrets[k] = v.Copy()
+	}
 	s.After = append(s.After, other.After...)
 	s.Before = append(s.Before, other.Before...)
 	s.Requires = append(s.Requires, other.Requires...)
+	s.RestartWith = append(s.RestartWith, other.RestartWith...)
+	s.RequiresPath = append(s.RequiresPath, other.RequiresPath...)
+	s.RequiresPort = append(s.RequiresPort, other.RequiresPort...)
+	s.RequiresDevice = append(s.RequiresDevice, other.RequiresDevice...)
+	if other.RequiresTimeout.IsSet {
+		s.RequiresTimeout = other.RequiresTimeout
+	}
 	for k, v := range other.Environment {
 		if s.Environment == nil {
 			s.Environment = make(map[string]string)
@@ -182,6 +338,123 @@ func (s *Service) Merge(other *Service) {
 	}
 }
 
+// ServiceDirectory holds the ownership and permissions of a directory that
+// is created before a service starts. By default, it's owned by the
+// service's user and group, with mode 0755.
+type ServiceDirectory struct {
+	User    string `yaml:"user,omitempty"`
+	UserID  *int   `yaml:"user-id,omitempty"`
+	Group   string `yaml:"group,omitempty"`
+	GroupID *int   `yaml:"group-id,omitempty"`
+	Mode    string `yaml:"mode,omitempty"`
+}
+
+// Copy returns a deep copy of the directory options. A nil directory
+// (using the defaults) is copied as nil.
+func (d *ServiceDirectory) Copy() *ServiceDirectory {
+	if d == nil {
+		return nil
+	}
+	copied := *d
+	copied.UserID = copyIntPtr(d.UserID)
+	copied.GroupID = copyIntPtr(d.GroupID)
+	return &copied
+}
+
+// ParseMode returns the directory's permission bits, or 0755 if its mode
+// isn't set.
+func (d *ServiceDirectory) ParseMode() (os.FileMode, error) {
+	if d.Mode == "" {
+		return 0o755, nil
+	}
+	mode, err := strconv.ParseUint(d.Mode, 8, 32)
+	if err != nil || mode > 0o7777 {
+		return 0, fmt.Errorf("invalid mode %q", d.Mode)
+	}
+	perm := os.FileMode(mode).Perm()
+	if mode&0o4000 != 0 {
+		perm |= os.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		perm |= os.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		perm |= os.ModeSticky
+	}
+	return perm, nil
+}
+
+// ServiceSecret specifies how a secret is passed to a service: in an
+// environment variable, in a file readable only by the service's user, or
+// both.
+type ServiceSecret struct {
+	Environment string `yaml:"environment,omitempty"`
+	File        string `yaml:"file,omitempty"`
+}
+
+// Copy returns a deep copy of the service secret.
+func (s *ServiceSecret) Copy() *ServiceSecret {
+	if s == nil {
+		return nil
+	}
+	copied := *s
+	return &copied
+}
+
+// validUlimits are the resource names allowed in a service's ulimits,
+// named as in setrlimit(2) without the RLIMIT_ prefix.
+var validUlimits = map[string]bool{
+	"as":         true,
+	"core":       true,
+	"cpu":        true,
+	"data":       true,
+	"fsize":      true,
+	"locks":      true,
+	"memlock":    true,
+	"msgqueue":   true,
+	"nice":       true,
+	"nofile":     true,
+	"nproc":      true,
+	"rss":        true,
+	"rtprio":     true,
+	"rttime":     true,
+	"sigpending": true,
+	"stack":      true,
+}
+
+// ServiceIsolation holds the options for running a service in its own
+// Linux namespaces.
+type ServiceIsolation struct {
+	// PrivateTmp gives the service its own empty /tmp.
+	PrivateTmp bool `yaml:"private-tmp,omitempty"`
+
+	// ReadOnlyPaths are absolute paths that the service can't write to.
+	ReadOnlyPaths []string `yaml:"read-only-paths,omitempty"`
+
+	// PrivateNetwork gives the service its own network namespace, with
+	// only a loopback interface.
+	PrivateNetwork bool `yaml:"private-network,omitempty"`
+}
+
+// Copy returns a deep copy of the isolation options.
+func (i *ServiceIsolation) Copy() *ServiceIsolation {
+	copied := *i
+	copied.ReadOnlyPaths = append([]string(nil), i.ReadOnlyPaths...)
+	return &copied
+}
+
+// Merge merges the fields set in other into i. Read-only paths are
+// appended.
+func (i *ServiceIsolation) Merge(other *ServiceIsolation) {
+	if other.PrivateTmp {
+		i.PrivateTmp = true
+	}
+	i.ReadOnlyPaths = append(i.ReadOnlyPaths, other.ReadOnlyPaths...)
+	if other.PrivateNetwork {
+		i.PrivateNetwork = true
+	}
+}
+
 // Equal returns true when the two services are equal in value.
 func (s *Service) Equal(other *Service) bool {
 	if s == other {
@@ -277,6 +550,34 @@ const (
 	StartupDisabled ServiceStartup = "disabled"
 )
 
+// ServiceKind specifies how a service is run.
+type ServiceKind string
+
+const (
+	KindUnset ServiceKind = ""
+
+	// KindProcess runs the service's command as a process (the default).
+	KindProcess ServiceKind = "process"
+
+	// KindOCI runs the OCI bundle in the directory named by the service's
+	// command, using an OCI runtime such as runc.
+	KindOCI ServiceKind = "oci"
+)
+
+// ServiceStdin specifies where a service's standard input comes from.
+type ServiceStdin string
+
+const (
+	StdinUnset ServiceStdin = ""
+
+	// StdinNull connects standard input to the null device (the default).
+	StdinNull ServiceStdin = "null"
+
+	// StdinPipe connects standard input to a pipe that data can be sent
+	// to through the API while the service is running.
+	StdinPipe ServiceStdin = "pipe"
+)
+
 // Override specifies the layer override mechanism for an object.
 type Override string
 
@@ -306,6 +607,7 @@ type Check struct {
 	Name     string     `yaml:"-"`
 	Override Override   `yaml:"override,omitempty"`
 	Level    CheckLevel `yaml:"level,omitempty"`
+	When     string     `yaml:"when,omitempty"`
 
 	// Common check settings
 	Period    OptionalDuration `yaml:"period,omitempty"`
@@ -313,9 +615,13 @@ type Check struct {
 	Threshold int              `yaml:"threshold,omitempty"`
 
 	// Type-specific check settings (only one of these can be set)
-	HTTP *HTTPCheck `yaml:"http,omitempty"`
-	TCP  *TCPCheck  `yaml:"tcp,omitempty"`
-	Exec *ExecCheck `yaml:"exec,omitempty"`
+	HTTP   *HTTPCheck   `yaml:"http,omitempty"`
+	TCP    *TCPCheck    `yaml:"tcp,omitempty"`
+	Exec   *ExecCheck   `yaml:"exec,omitempty"`
+	Device *DeviceCheck `yaml:"device,omitempty"`
+
+	// Actions taken when the check goes from "down" back to "up"
+	OnRecovery *CheckRecovery `yaml:"on-recovery,omitempty"`
 }
 
 // Copy returns a deep copy of the check configuration.
@@ -330,6 +636,12 @@ func (c *Check) Copy() *Check {
 	if c.Exec != nil {
 		copied.Exec = c.Exec.Copy()
 	}
+	if c.Device != nil {
+		copied.Device = c.Device.Copy()
+	}
+	if c.OnRecovery != nil {
+		copied.OnRecovery = c.OnRecovery.Copy()
+	}
 	return &copied
 }
 
@@ -338,6 +650,9 @@ func (c *Check) Merge(other *Check) {
 	if other.Level != "" {
 		c.Level = other.Level
 	}
+	if other.When != "" {
+		c.When = other.When
+	}
 	if other.Period.IsSet {
 		c.Period = other.Period
 	}
@@ -365,6 +680,18 @@ func (c *Check) Merge(other *Check) {
 		}
 		c.Exec.Merge(other.Exec)
 	}
+	if other.Device != nil {
+		if c.Device == nil {
+			c.Device = &DeviceCheck{}
+		}
+		c.Device.Merge(other.Device)
+	}
+	if other.OnRecovery != nil {
+		if c.OnRecovery == nil {
+			c.OnRecovery = &CheckRecovery{}
+		}
+		c.OnRecovery.Merge(other.OnRecovery)
+	}
 }
 
 // CheckLevel specifies the optional check level.
@@ -429,6 +756,25 @@ func (c *TCPCheck) Merge(other *TCPCheck) {
 	}
 }
 
+// DeviceCheck holds the configuration for a device health check, which is
+// up while the named device in the plan's "devices" section is ready.
+type DeviceCheck struct {
+	Name string `yaml:"name,omitempty"`
+}
+
+// Copy returns a deep copy of the device check configuration.
+func (c *DeviceCheck) Copy() *DeviceCheck {
+	copied := *c
+	return &copied
+}
+
+// Merge merges the fields set in other into c.
+func (c *DeviceCheck) Merge(other *DeviceCheck) {
+	if other.Name != "" {
+		c.Name = other.Name
+	}
+}
+
 // ExecCheck holds the configuration for an exec health check.
 type ExecCheck struct {
 	Command        string            `yaml:"command,omitempty"`
@@ -439,6 +785,7 @@ type ExecCheck struct {
 	GroupID        *int              `yaml:"group-id,omitempty"`
 	Group          string            `yaml:"group,omitempty"`
 	WorkingDir     string            `yaml:"working-dir,omitempty"`
+	Arch           string            `yaml:"arch,omitempty"`
 }
 
 // Copy returns a deep copy of the exec check configuration.
@@ -488,6 +835,39 @@ func (c *ExecCheck) Merge(other *ExecCheck) {
 	if other.WorkingDir != "" {
 		c.WorkingDir = other.WorkingDir
 	}
+	if other.Arch != "" {
+		c.Arch = other.Arch
+	}
+}
+
+// CheckRecovery holds the actions taken when a check recovers.
+type CheckRecovery struct {
+	// Notice records a "check-recovered" notice with the check's name as key.
+	Notice bool `yaml:"notice,omitempty"`
+
+	// Exec is a command to run.
+	Exec string `yaml:"exec,omitempty"`
+
+	// Restart lists services to restart, if they're running.
+	Restart []string `yaml:"restart,omitempty"`
+}
+
+// Copy returns a deep copy of the recovery configuration.
+func (r *CheckRecovery) Copy() *CheckRecovery {
+	copied := *r
+	copied.Restart = append([]string(nil), r.Restart...)
+	return &copied
+}
+
+// Merge merges the fields set in other into r.
+func (r *CheckRecovery) Merge(other *CheckRecovery) {
+	if other.Notice {
+		r.Notice = true
+	}
+	if other.Exec != "" {
+		r.Exec = other.Exec
+	}
+	r.Restart = append(r.Restart, other.Restart...)
 }
 
 // LogTarget specifies a remote server to forward logs to.
@@ -498,6 +878,51 @@ type LogTarget struct {
 	Services []string          `yaml:"services"`
 	Override Override          `yaml:"override,omitempty"`
 	Labels   map[string]string `yaml:"labels,omitempty"`
+
+	// TenantID is sent in the X-Scope-OrgID header, for multi-tenant Loki
+	// servers.
+	TenantID string         `yaml:"tenant-id,omitempty"`
+	Auth     *LogTargetAuth `yaml:"auth,omitempty"`
+
+	// Tuning for high-throughput services. If unset, the log manager's
+	// defaults are used (see the logstate package).
+	BufferSize    int              `yaml:"buffer-size,omitempty"`
+	BatchSize     int              `yaml:"batch-size,omitempty"`
+	FlushInterval OptionalDuration `yaml:"flush-interval,omitempty"`
+}
+
+// LogTargetAuth specifies how to authenticate with a Loki server: using
+// basic authentication, or a bearer token. Secrets are read from files, so
+// they're not part of the plan.
+type LogTargetAuth struct {
+	Basic  *LogTargetBasicAuth  `yaml:"basic,omitempty"`
+	Bearer *LogTargetBearerAuth `yaml:"bearer,omitempty"`
+}
+
+// LogTargetBasicAuth holds the user name and password file for basic
+// authentication.
+type LogTargetBasicAuth struct {
+	User         string `yaml:"user,omitempty"`
+	PasswordFile string `yaml:"password-file,omitempty"`
+}
+
+// LogTargetBearerAuth holds the token file for bearer token authentication.
+type LogTargetBearerAuth struct {
+	TokenFile string `yaml:"token-file,omitempty"`
+}
+
+// Copy returns a deep copy of the authentication options.
+func (a *LogTargetAuth) Copy() *LogTargetAuth {
+	copied := *a
+	if a.Basic != nil {
+		basic := *a.Basic
+		copied.Basic = &basic
+	}
+	if a.Bearer != nil {
+		bearer := *a.Bearer
+		copied.Bearer = &bearer
+	}
+	return &copied
 }
 
 // LogTargetType defines the protocol to use to forward logs.
@@ -519,10 +944,14 @@ func (t *LogTarget) Copy() *LogTarget {
 			copied.Labels[k] = v
 		}
 	}
+	if t.Auth != nil {
+		copied.Auth = t.Auth.Copy()
+	}
 	return &copied
 }
 
-// Merge merges the fields set in other into t.
+// Merge merges the fields set in other into t. Authentication options are
+// replaced as a whole, so that a layer can switch between methods.
 func (t *LogTarget) Merge(other *LogTarget) {
 	if other.Type != "" {
 		t.Type = other.Type
@@ -537,383 +966,1810 @@ func (t *LogTarget) Merge(other *LogTarget) {
 		}
 		t.Labels[k] = v
 	}
+	if other.TenantID != "" {
+		t.TenantID = other.TenantID
+	}
+	if other.Auth != nil {
+		t.Auth = other.Auth.Copy()
+	}
+	if other.BufferSize != 0 {
+		t.BufferSize = other.BufferSize
+	}
+	if other.BatchSize != 0 {
+		t.BatchSize = other.BatchSize
+	}
+	if other.FlushInterval.IsSet {
+		t.FlushInterval = other.FlushInterval
+	}
 }
 
-// FormatError is the error returned when a layer has a format error, such as
-// a missing "override" field.
-type FormatError struct {
-	Message string
-}
+// NoticeHook specifies a command to run whenever a matching notice occurs.
+// The notice is written to the command's standard input in the same JSON
+// format as returned by the notices API.
+type NoticeHook struct {
+	Name     string   `yaml:"-"`
+	Override Override `yaml:"override,omitempty"`
 
-func (e *FormatError) Error() string {
-	return e.Message
+	// Notices to match (if empty, any type or key matches)
+	Types []string `yaml:"types,omitempty"`
+	Keys  []string `yaml:"keys,omitempty"`
+
+	// Options for command execution
+	Command     string            `yaml:"command,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+	UserID      *int              `yaml:"user-id,omitempty"`
+	User        string            `yaml:"user,omitempty"`
+	GroupID     *int              `yaml:"group-id,omitempty"`
+	Group       string            `yaml:"group,omitempty"`
+	WorkingDir  string            `yaml:"working-dir,omitempty"`
 }
 
-// CombineLayers combines the given layers into a single layer, with the later
-// layers overriding earlier ones.
-// Neither the individual layers nor the combined layer are validated here - the
-// caller should have validated the individual layers prior to calling, and
-// validate the combined output if required.
-func CombineLayers(layers ...*Layer) (*Layer, error) {
-	combined := &Layer{
-		Services:   make(map[string]*Service),
-		Checks:     make(map[string]*Check),
-		LogTargets: make(map[string]*LogTarget),
+// Copy returns a deep copy of the notice hook configuration.
+func (h *NoticeHook) Copy() *NoticeHook {
+	copied := *h
+	copied.Types = append([]string(nil), h.Types...)
+	copied.Keys = append([]string(nil), h.Keys...)
+	if h.Environment != nil {
+		copied.Environment = make(map[string]string, len(h.Environment))
+		for k, v := range h.Environment {
+			copied.Environment[k] = v
+		}
 	}
-	if len(layers) == 0 {
-		return combined, nil
+	if h.UserID != nil {
+		copied.UserID = copyIntPtr(h.UserID)
 	}
-	last := layers[len(layers)-1]
-	combined.Summary = last.Summary
-	combined.Description = last.Description
-	for _, layer := range layers {
-		for name, service := range layer.Services {
-			switch service.Override {
-			case MergeOverride:
-				if old, ok := combined.Services[name]; ok {
-					copied := old.Copy()
-					copied.Merge(service)
-					combined.Services[name] = copied
-					break
-				}
-				fallthrough
-			case ReplaceOverride:
-				combined.Services[name] = service.Copy()
-			case UnknownOverride:
-				return nil, &FormatError{
-					Message: fmt.Sprintf(`layer %q must define "override" for service %q`,
-						layer.Label, service.Name),
-				}
-			default:
-				return nil, &FormatError{
-					Message: fmt.Sprintf(`layer %q has invalid "override" value for service %q`,
-						layer.Label, service.Name),
-				}
-			}
-		}
+	if h.GroupID != nil {
+		copied.GroupID = copyIntPtr(h.GroupID)
+	}
+	return &copied
+}
 
-		for name, check := range layer.Checks {
-			switch check.Override {
-			case MergeOverride:
-				if old, ok := combined.Checks[name]; ok {
-					copied := old.Copy()
-					copied.Merge(check)
-					combined.Checks[name] = copied
-					break
-				}
-				fallthrough
-			case ReplaceOverride:
-				combined.Checks[name] = check.Copy()
-			case UnknownOverride:
-				return nil, &FormatError{
-					Message: fmt.Sprintf(`layer %q must define "override" for check %q`,
-						layer.Label, check.Name),
-				}
-			default:
-				return nil, &FormatError{
-					Message: fmt.Sprintf(`layer %q has invalid "override" value for check %q`,
-						layer.Label, check.Name),
-				}
-			}
+// Merge merges the fields set in other into h.
+func (h *NoticeHook) Merge(other *NoticeHook) {
+	h.Types = append(h.Types, other.Types...)
+	h.Keys = append(h.Keys, other.Keys...)
+	if other.Command != "" {
+		h.Command = other.Command
+	}
+	for k, v := range other.Environment {
+		if h.Environment == nil {
+			h.Environment = make(map[string]string)
 		}
+		h.Environment[k] = v
+	}
+	if other.UserID != nil {
+		h.UserID = copyIntPtr(other.UserID)
+	}
+	if other.User != "" {
+		h.User = other.User
+	}
+	if other.GroupID != nil {
+		h.GroupID = copyIntPtr(other.GroupID)
+	}
+	if other.Group != "" {
+		h.Group = other.Group
+	}
+	if other.WorkingDir != "" {
+		h.WorkingDir = other.WorkingDir
+	}
+}
 
-		for name, target := range layer.LogTargets {
-			switch target.Override {
-			case MergeOverride:
-				if old, ok := combined.LogTargets[name]; ok {
-					copied := old.Copy()
-					copied.Merge(target)
-					combined.LogTargets[name] = copied
-					break
-				}
-				fallthrough
-			case ReplaceOverride:
-				combined.LogTargets[name] = target.Copy()
-			case UnknownOverride:
-				return nil, &FormatError{
-					Message: fmt.Sprintf(`layer %q must define "override" for log target %q`,
-						layer.Label, target.Name),
-				}
-			default:
-				return nil, &FormatError{
-					Message: fmt.Sprintf(`layer %q has invalid "override" value for log target %q`,
-						layer.Label, target.Name),
-				}
-			}
-		}
+// Matches reports whether a notice with the given type and key should be
+// delivered to this hook.
+func (h *NoticeHook) Matches(noticeType, key string) bool {
+	if len(h.Types) > 0 && !containsString(h.Types, noticeType) {
+		return false
+	}
+	if len(h.Keys) > 0 && !containsString(h.Keys, key) {
+		return false
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Network specifies the static configuration of the network interfaces.
+// As with Netplan, the interfaces are grouped by kind, and keyed by
+// interface name.
+type Network struct {
+	Ethernets map[string]*NetworkInterface `yaml:"ethernets,omitempty"`
+	Wifis     map[string]*NetworkInterface `yaml:"wifis,omitempty"`
+}
+
+// NetworkInterface specifies the static configuration of a network
+// interface, named by the map key.
+type NetworkInterface struct {
+	Name        string         `yaml:"-"`
+	Override    Override       `yaml:"override,omitempty"`
+	Addresses   []string       `yaml:"addresses,omitempty"`
+	Routes      []NetworkRoute `yaml:"routes,omitempty"`
+	Nameservers Nameservers    `yaml:"nameservers,omitempty"`
+
+	// AccessPoints are the Wi-Fi networks a Wi-Fi interface may associate
+	// with, keyed by SSID.
+	AccessPoints map[string]*AccessPoint `yaml:"access-points,omitempty"`
+}
+
+// AccessPoint specifies how to associate with a Wi-Fi network.
+type AccessPoint struct {
+	// Password is the WPA passphrase, or empty for an open network.
+	Password string `yaml:"password,omitempty"`
+
+	// Hidden is set if the network doesn't broadcast its SSID, so it must
+	// be probed for by name.
+	Hidden bool `yaml:"hidden,omitempty"`
+}
+
+// NetworkRoute specifies a static route through a network interface.
+type NetworkRoute struct {
+	// To is the destination prefix, or "default" for the default route.
+	To string `yaml:"to,omitempty"`
+
+	// Via is the gateway's address. It may be omitted for destinations
+	// that are directly reachable through the interface.
+	Via string `yaml:"via,omitempty"`
+
+	Metric int `yaml:"metric,omitempty"`
+}
+
+// Nameservers specifies the DNS servers and search domains to use.
+type Nameservers struct {
+	Addresses []string `yaml:"addresses,omitempty"`
+	Search    []string `yaml:"search,omitempty"`
+}
+
+// Copy returns a deep copy of the network configuration.
+func (n *Network) Copy() *Network {
+	copied := &Network{}
+	if n.Ethernets != nil {
+		copied.Ethernets = make(map[string]*NetworkInterface, len(n.Ethernets))
+		for name, iface := range n.Ethernets {
+			copied.Ethernets[name] = iface.Copy()
+		}
+	}
+	if n.Wifis != nil {
+		copied.Wifis = make(map[string]*NetworkInterface, len(n.Wifis))
+		for name, iface := range n.Wifis {
+			copied.Wifis[name] = iface.Copy()
+		}
+	}
+	return copied
+}
+
+// Copy returns a deep copy of the network interface configuration.
+func (n *NetworkInterface) Copy() *NetworkInterface {
+	copied := *n
+	copied.Addresses = append([]string(nil), n.Addresses...)
+	copied.Routes = append([]NetworkRoute(nil), n.Routes...)
+	copied.Nameservers.Addresses = append([]string(nil), n.Nameservers.Addresses...)
+	copied.Nameservers.Search = append([]string(nil), n.Nameservers.Search...)
+	if n.AccessPoints != nil {
+		copied.AccessPoints = make(map[string]*AccessPoint, len(n.AccessPoints))
+		for ssid, ap := range n.AccessPoints {
+			copiedAP := *ap
+			copied.AccessPoints[ssid] = &copiedAP
+		}
+	}
+	return &copied
+}
+
+// Merge merges the fields set in other into n. Access points in other
+// replace those with the same SSID.
+func (n *NetworkInterface) Merge(other *NetworkInterface) {
+	n.Addresses = append(n.Addresses, other.Addresses...)
+	n.Routes = append(n.Routes, other.Routes...)
+	n.Nameservers.Addresses = append(n.Nameservers.Addresses, other.Nameservers.Addresses...)
+	n.Nameservers.Search = append(n.Nameservers.Search, other.Nameservers.Search...)
+	for ssid, ap := range other.AccessPoints {
+		if n.AccessPoints == nil {
+			n.AccessPoints = make(map[string]*AccessPoint)
+		}
+		copiedAP := *ap
+		n.AccessPoints[ssid] = &copiedAP
+	}
+}
+
+// Destination returns the route's destination prefix. The default route is
+// for the address family of the gateway, so it must have one.
+func (r *NetworkRoute) Destination() (netip.Prefix, error) {
+	if r.To != "default" {
+		return netip.ParsePrefix(r.To)
+	}
+	via, err := netip.ParseAddr(r.Via)
+	if err != nil {
+		return netip.Prefix{}, errors.New(`default route must define a valid "via" address`)
+	}
+	return netip.PrefixFrom(via, 0), nil
+}
+
+// Mount specifies a filesystem to be mounted by the service manager.
+type Mount struct {
+	Name     string   `yaml:"-"`
+	Override Override `yaml:"override,omitempty"`
+	Source   string   `yaml:"source,omitempty"`
+	Target   string   `yaml:"target,omitempty"`
+	Type     string   `yaml:"type,omitempty"`
+	Options  []string `yaml:"options,omitempty"`
+}
+
+// Copy returns a deep copy of the mount configuration.
+func (m *Mount) Copy() *Mount {
+	copied := *m
+	copied.Options = append([]string(nil), m.Options...)
+	return &copied
+}
+
+// Merge merges the fields set in other into m.
+func (m *Mount) Merge(other *Mount) {
+	if other.Source != "" {
+		m.Source = other.Source
+	}
+	if other.Target != "" {
+		m.Target = other.Target
+	}
+	if other.Type != "" {
+		m.Type = other.Type
+	}
+	m.Options = append(m.Options, other.Options...)
+}
+
+// Equal reports whether m and other describe the same mount, ignoring the
+// name and override fields.
+func (m *Mount) Equal(other *Mount) bool {
+	if m.Source != other.Source || m.Target != other.Target || m.Type != other.Type {
+		return false
+	}
+	if len(m.Options) != len(other.Options) {
+		return false
+	}
+	for i, option := range m.Options {
+		if option != other.Options[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsBind reports whether the mount is a bind mount, which is the only kind
+// of mount that doesn't require a filesystem type.
+func (m *Mount) IsBind() bool {
+	return containsString(m.Options, "bind") || containsString(m.Options, "rbind")
+}
+
+// KernelModule specifies a kernel module to load, named by the map key,
+// along with the parameters to load it with.
+type KernelModule struct {
+	Name       string            `yaml:"-"`
+	Override   Override          `yaml:"override,omitempty"`
+	Parameters map[string]string `yaml:"parameters,omitempty"`
+}
+
+// Copy returns a deep copy of the kernel module configuration.
+func (k *KernelModule) Copy() *KernelModule {
+	copied := *k
+	if k.Parameters != nil {
+		copied.Parameters = make(map[string]string, len(k.Parameters))
+		for name, value := range k.Parameters {
+			copied.Parameters[name] = value
+		}
+	}
+	return &copied
+}
+
+// Merge merges the fields set in other into k.
+func (k *KernelModule) Merge(other *KernelModule) {
+	for name, value := range other.Parameters {
+		if k.Parameters == nil {
+			k.Parameters = make(map[string]string)
+		}
+		k.Parameters[name] = value
+	}
+}
+
+// Sysctl specifies the value of a kernel parameter, named by the map key
+// using sysctl(8) notation, for example "net.ipv4.ip_forward".
+type Sysctl struct {
+	Name     string   `yaml:"-"`
+	Override Override `yaml:"override,omitempty"`
+	Value    string   `yaml:"value,omitempty"`
+}
+
+// Copy returns a deep copy of the sysctl configuration.
+func (s *Sysctl) Copy() *Sysctl {
+	copied := *s
+	return &copied
+}
+
+// Merge merges the fields set in other into s.
+func (s *Sysctl) Merge(other *Sysctl) {
+	if other.Value != "" {
+		s.Value = other.Value
+	}
+}
+
+// Path returns the path of the sysctl's file, relative to /proc/sys. As with
+// sysctl(8), if the name contains a "/" it's used as the separator, and any
+// "." characters are taken literally (for example, in interface names).
+func (s *Sysctl) Path() string {
+	if strings.Contains(s.Name, "/") {
+		return s.Name
+	}
+	return strings.ReplaceAll(s.Name, ".", "/")
+}
+
+// TimeServer specifies an NTP server used to synchronise the system clock.
+type TimeServer struct {
+	Name         string           `yaml:"-"`
+	Override     Override         `yaml:"override,omitempty"`
+	Address      string           `yaml:"address,omitempty"`
+	PollInterval OptionalDuration `yaml:"poll-interval,omitempty"`
+}
+
+// Copy returns a deep copy of the time server configuration.
+func (t *TimeServer) Copy() *TimeServer {
+	copied := *t
+	return &copied
+}
+
+// Merge merges the fields set in other into t.
+func (t *TimeServer) Merge(other *TimeServer) {
+	if other.Address != "" {
+		t.Address = other.Address
+	}
+	if other.PollInterval.IsSet {
+		t.PollInterval = other.PollInterval
+	}
+}
+
+// Watchdog specifies a hardware watchdog device that is kept from firing
+// (petted) only while the given checks and services are healthy.
+type Watchdog struct {
+	Name     string           `yaml:"-"`
+	Override Override         `yaml:"override,omitempty"`
+	Device   string           `yaml:"device,omitempty"`
+	Interval OptionalDuration `yaml:"interval,omitempty"`
+	Checks   []string         `yaml:"checks,omitempty"`
+	Services []string         `yaml:"services,omitempty"`
+	OnStop   WatchdogAction   `yaml:"on-stop,omitempty"`
+}
+
+// WatchdogAction defines what happens to a watchdog device when Pebble
+// stops petting it because it's shutting down or the watchdog was removed
+// from the plan.
+type WatchdogAction string
+
+const (
+	UnsetWatchdogAction WatchdogAction = ""
+
+	// Disarm the watchdog cleanly (using the "magic close" character).
+	WatchdogClose WatchdogAction = "close"
+
+	// Close the device without disarming the watchdog, so that it fires
+	// once its timeout expires.
+	WatchdogFire WatchdogAction = "fire"
+)
+
+// Copy returns a deep copy of the watchdog configuration.
+func (w *Watchdog) Copy() *Watchdog {
+	copied := *w
+	copied.Checks = append([]string(nil), w.Checks...)
+	copied.Services = append([]string(nil), w.Services...)
+	return &copied
+}
+
+// Merge merges the fields set in other into w.
+func (w *Watchdog) Merge(other *Watchdog) {
+	if other.Device != "" {
+		w.Device = other.Device
+	}
+	if other.Interval.IsSet {
+		w.Interval = other.Interval
+	}
+	w.Checks = append(w.Checks, other.Checks...)
+	w.Services = append(w.Services, other.Services...)
+	if other.OnStop != UnsetWatchdogAction {
+		w.OnStop = other.OnStop
+	}
+}
+
+// Device specifies a device that services and checks can depend on, such
+// as a USB modem that's only present once it has been enumerated. It's
+// ready when its node exists at Path and, if Subsystem is set, a device of
+// that kernel subsystem is present.
+type Device struct {
+	Name      string   `yaml:"-"`
+	Override  Override `yaml:"override,omitempty"`
+	Path      string   `yaml:"path,omitempty"`
+	Subsystem string   `yaml:"subsystem,omitempty"`
+}
+
+// Copy returns a deep copy of the device configuration.
+func (d *Device) Copy() *Device {
+	copied := *d
+	return &copied
+}
+
+// Merge merges the fields set in other into d.
+func (d *Device) Merge(other *Device) {
+	if other.Path != "" {
+		d.Path = other.Path
+	}
+	if other.Subsystem != "" {
+		d.Subsystem = other.Subsystem
+	}
+}
+
+// Secret specifies where a secret's value is read from when a service that
+// uses it starts. Only the secret's source is part of the plan: its value
+// is never stored in the plan or written out with it.
+type Secret struct {
+	Name     string        `yaml:"-"`
+	Override Override      `yaml:"override,omitempty"`
+	Backend  SecretBackend `yaml:"backend,omitempty"`
+
+	// Path is the file to read the secret from, for the "file" backend.
+	Path string `yaml:"path,omitempty"`
+
+	// Variable is the name of the daemon's environment variable holding
+	// the secret, for the "env" backend.
+	Variable string `yaml:"variable,omitempty"`
+
+	// Key is the description of the "user" key holding the secret in the
+	// daemon's kernel keyrings, for the "keyring" backend.
+	Key string `yaml:"key,omitempty"`
+
+	// Command is run to print the secret to its stdout, for the "command"
+	// backend.
+	Command string `yaml:"command,omitempty"`
+}
+
+// SecretBackend defines where a secret's value is read from.
+type SecretBackend string
+
+const (
+	UnsetSecretBackend   SecretBackend = ""
+	FileSecretBackend    SecretBackend = "file"
+	EnvSecretBackend     SecretBackend = "env"
+	KeyringSecretBackend SecretBackend = "keyring"
+	CommandSecretBackend SecretBackend = "command"
+)
+
+// Copy returns a deep copy of the secret configuration.
+func (s *Secret) Copy() *Secret {
+	copied := *s
+	return &copied
+}
+
+// Merge merges the fields set in other into s.
+func (s *Secret) Merge(other *Secret) {
+	if other.Backend != UnsetSecretBackend {
+		s.Backend = other.Backend
+	}
+	if other.Path != "" {
+		s.Path = other.Path
+	}
+	if other.Variable != "" {
+		s.Variable = other.Variable
+	}
+	if other.Key != "" {
+		s.Key = other.Key
+	}
+	if other.Command != "" {
+		s.Command = other.Command
+	}
+}
+
+// FormatError is the error returned when a layer has a format error, such as
+// a missing "override" field.
+type FormatError struct {
+	Message string
+
+	// Line and Column give the position in the layer's YAML of the item the
+	// error relates to, if known (they're zero otherwise).
+	Line   int
+	Column int
+}
+
+func (e *FormatError) Error() string {
+	return e.Message
+}
+
+// CombineLayers combines the given layers into a single layer, with the later
+// layers overriding earlier ones.
+// Neither the individual layers nor the combined layer are validated here - the
+// caller should have validated the individual layers prior to calling, and
+// validate the combined output if required.
+func CombineLayers(layers ...*Layer) (*Layer, error) {
+	combined := &Layer{
+		Services:   make(map[string]*Service),
+		Checks:     make(map[string]*Check),
+		LogTargets: make(map[string]*LogTarget),
+	}
+	if len(layers) == 0 {
+		return combined, nil
+	}
+	last := layers[len(layers)-1]
+	combined.Summary = last.Summary
+	combined.Description = last.Description
+	for _, layer := range layers {
+		for name, service := range layer.Services {
+			switch service.Override {
+			case MergeOverride:
+				if old, ok := combined.Services[name]; ok {
+					copied := old.Copy()
+					copied.Merge(service)
+					combined.Services[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.Services[name] = service.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for service %q`,
+						layer.Label, service.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for service %q`,
+						layer.Label, service.Name),
+				}
+			}
+		}
+
+		for name, check := range layer.Checks {
+			switch check.Override {
+			case MergeOverride:
+				if old, ok := combined.Checks[name]; ok {
+					copied := old.Copy()
+					copied.Merge(check)
+					combined.Checks[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.Checks[name] = check.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for check %q`,
+						layer.Label, check.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for check %q`,
+						layer.Label, check.Name),
+				}
+			}
+		}
+
+		for name, target := range layer.LogTargets {
+			switch target.Override {
+			case MergeOverride:
+				if old, ok := combined.LogTargets[name]; ok {
+					copied := old.Copy()
+					copied.Merge(target)
+					combined.LogTargets[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.LogTargets[name] = target.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for log target %q`,
+						layer.Label, target.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for log target %q`,
+						layer.Label, target.Name),
+				}
+			}
+		}
+
+		for name, hook := range layer.NoticeHooks {
+			if combined.NoticeHooks == nil {
+				combined.NoticeHooks = make(map[string]*NoticeHook)
+			}
+			switch hook.Override {
+			case MergeOverride:
+				if old, ok := combined.NoticeHooks[name]; ok {
+					copied := old.Copy()
+					copied.Merge(hook)
+					combined.NoticeHooks[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.NoticeHooks[name] = hook.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for notice hook %q`,
+						layer.Label, hook.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for notice hook %q`,
+						layer.Label, hook.Name),
+				}
+			}
+		}
+
+		if layer.Network != nil {
+			if combined.Network == nil {
+				combined.Network = &Network{}
+			}
+			var err error
+			combined.Network.Ethernets, err = combineNetworkInterfaces(layer.Label, combined.Network.Ethernets, layer.Network.Ethernets)
+			if err != nil {
+				return nil, err
+			}
+			combined.Network.Wifis, err = combineNetworkInterfaces(layer.Label, combined.Network.Wifis, layer.Network.Wifis)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for name, mount := range layer.Mounts {
+			if combined.Mounts == nil {
+				combined.Mounts = make(map[string]*Mount)
+			}
+			switch mount.Override {
+			case MergeOverride:
+				if old, ok := combined.Mounts[name]; ok {
+					copied := old.Copy()
+					copied.Merge(mount)
+					combined.Mounts[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.Mounts[name] = mount.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for mount %q`,
+						layer.Label, mount.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for mount %q`,
+						layer.Label, mount.Name),
+				}
+			}
+		}
+
+		for name, module := range layer.KernelModules {
+			if combined.KernelModules == nil {
+				combined.KernelModules = make(map[string]*KernelModule)
+			}
+			switch module.Override {
+			case MergeOverride:
+				if old, ok := combined.KernelModules[name]; ok {
+					copied := old.Copy()
+					copied.Merge(module)
+					combined.KernelModules[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.KernelModules[name] = module.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for kernel module %q`,
+						layer.Label, module.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for kernel module %q`,
+						layer.Label, module.Name),
+				}
+			}
+		}
+
+		for name, sysctl := range layer.Sysctls {
+			if combined.Sysctls == nil {
+				combined.Sysctls = make(map[string]*Sysctl)
+			}
+			switch sysctl.Override {
+			case MergeOverride:
+				if old, ok := combined.Sysctls[name]; ok {
+					copied := old.Copy()
+					copied.Merge(sysctl)
+					combined.Sysctls[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.Sysctls[name] = sysctl.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for sysctl %q`,
+						layer.Label, sysctl.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for sysctl %q`,
+						layer.Label, sysctl.Name),
+				}
+			}
+		}
+
+		for name, server := range layer.TimeServers {
+			if combined.TimeServers == nil {
+				combined.TimeServers = make(map[string]*TimeServer)
+			}
+			switch server.Override {
+			case MergeOverride:
+				if old, ok := combined.TimeServers[name]; ok {
+					copied := old.Copy()
+					copied.Merge(server)
+					combined.TimeServers[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.TimeServers[name] = server.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for time server %q`,
+						layer.Label, server.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for time server %q`,
+						layer.Label, server.Name),
+				}
+			}
+		}
+
+		for name, secret := range layer.Secrets {
+			if combined.Secrets == nil {
+				combined.Secrets = make(map[string]*Secret)
+			}
+			switch secret.Override {
+			case MergeOverride:
+				if old, ok := combined.Secrets[name]; ok {
+					copied := old.Copy()
+					copied.Merge(secret)
+					combined.Secrets[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.Secrets[name] = secret.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for secret %q`,
+						layer.Label, secret.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for secret %q`,
+						layer.Label, secret.Name),
+				}
+			}
+		}
+
+		for name, value := range layer.Vars {
+			if combined.Vars == nil {
+				combined.Vars = make(map[string]string)
+			}
+			combined.Vars[name] = value
+		}
+
+		for name, watchdog := range layer.Watchdogs {
+			if combined.Watchdogs == nil {
+				combined.Watchdogs = make(map[string]*Watchdog)
+			}
+			switch watchdog.Override {
+			case MergeOverride:
+				if old, ok := combined.Watchdogs[name]; ok {
+					copied := old.Copy()
+					copied.Merge(watchdog)
+					combined.Watchdogs[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.Watchdogs[name] = watchdog.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for watchdog %q`,
+						layer.Label, watchdog.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for watchdog %q`,
+						layer.Label, watchdog.Name),
+				}
+			}
+		}
+
+		for name, device := range layer.Devices {
+			if combined.Devices == nil {
+				combined.Devices = make(map[string]*Device)
+			}
+			switch device.Override {
+			case MergeOverride:
+				if old, ok := combined.Devices[name]; ok {
+					copied := old.Copy()
+					copied.Merge(device)
+					combined.Devices[name] = copied
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.Devices[name] = device.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for device %q`,
+						layer.Label, device.Name),
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for device %q`,
+						layer.Label, device.Name),
+				}
+			}
+		}
+	}
+
+	for _, layer := range layers {
+		combined.combineSections(layer)
+	}
+
+	// Set defaults where required.
+	for _, server := range combined.TimeServers {
+		if !server.PollInterval.IsSet {
+			server.PollInterval.Value = defaultTimeServerPollInterval
+		}
+	}
+
+	for _, watchdog := range combined.Watchdogs {
+		if watchdog.Device == "" {
+			watchdog.Device = defaultWatchdogDevice
+		}
+		if !watchdog.Interval.IsSet {
+			watchdog.Interval.Value = defaultWatchdogInterval
+		}
+		if watchdog.OnStop == UnsetWatchdogAction {
+			watchdog.OnStop = WatchdogClose
+		}
 	}
 
-	// Set defaults where required.
 	for _, service := range combined.Services {
 		if !service.BackoffDelay.IsSet {
 			service.BackoffDelay.Value = defaultBackoffDelay
 		}
-		if !service.BackoffFactor.IsSet {
-			service.BackoffFactor.Value = defaultBackoffFactor
+		if !service.BackoffFactor.IsSet {
+			service.BackoffFactor.Value = defaultBackoffFactor
+		}
+		if !service.BackoffLimit.IsSet {
+			service.BackoffLimit.Value = defaultBackoffLimit
+		}
+	}
+
+	for _, check := range combined.Checks {
+		if !check.Period.IsSet {
+			check.Period.Value = defaultCheckPeriod
+		}
+		if !check.Timeout.IsSet {
+			check.Timeout.Value = defaultCheckTimeout
+		}
+		if check.Timeout.Value > check.Period.Value {
+			// The effective timeout will be the period, so make that clear.
+			// `.IsSet` remains false so that the capped value does not appear
+			// in the combined plan output - and it's not *user* set - the
+			// effective default timeout is the minimum of (check.Period.Value,
+			// default timeout).
+			check.Timeout.Value = check.Period.Value
+		}
+		if check.Threshold == 0 {
+			// Default number of failures in a row before check triggers
+			// action, default is >1 to avoid flapping due to glitches. For
+			// what it's worth, Kubernetes probes uses a default of 3 too.
+			check.Threshold = defaultCheckThreshold
+		}
+	}
+
+	return combined, nil
+}
+
+// combineNetworkInterfaces combines the network interfaces of one kind from
+// a layer into those combined so far, returning the result.
+func combineNetworkInterfaces(label string, combined, layer map[string]*NetworkInterface) (map[string]*NetworkInterface, error) {
+	for name, iface := range layer {
+		if combined == nil {
+			combined = make(map[string]*NetworkInterface)
+		}
+		switch iface.Override {
+		case MergeOverride:
+			if old, ok := combined[name]; ok {
+				copied := old.Copy()
+				copied.Merge(iface)
+				combined[name] = copied
+				break
+			}
+			fallthrough
+		case ReplaceOverride:
+			combined[name] = iface.Copy()
+		case UnknownOverride:
+			return nil, &FormatError{
+				Message: fmt.Sprintf(`layer %q must define "override" for network interface %q`,
+					label, iface.Name),
+			}
+		default:
+			return nil, &FormatError{
+				Message: fmt.Sprintf(`layer %q has invalid "override" value for network interface %q`,
+					label, iface.Name),
+			}
+		}
+	}
+	return combined, nil
+}
+
+// Validate checks that the layer is valid. It returns nil if all the checks pass, or
+// an error if there are validation errors.
+// See also Plan.Validate, which does additional checks based on the combined
+// layers.
+func (layer *Layer) Validate() error {
+	if strings.HasPrefix(layer.Label, "pebble-") {
+		return &FormatError{
+			Message: `cannot use reserved label prefix "pebble-"`,
+		}
+	}
+
+	err := layer.validateSections()
+	if err != nil {
+		return err
+	}
+
+	for name, service := range layer.Services {
+		if name == "" {
+			return &FormatError{
+				Message: fmt.Sprintf("cannot use empty string as service name"),
+			}
+		}
+		if name == "pebble" {
+			// Disallow service name "pebble" to avoid ambiguity (for example,
+			// in log output).
+			return &FormatError{
+				Message: fmt.Sprintf("cannot use reserved service name %q", name),
+			}
+		}
+		// Deprecated service names
+		if name == "all" || name == "default" || name == "none" {
+			logger.Noticef("Using keyword %q as a service name is deprecated", name)
+		}
+		if strings.HasPrefix(name, "-") {
+			return &FormatError{
+				Message: fmt.Sprintf(`cannot use service name %q: starting with "-" not allowed`, name),
+			}
+		}
+		if strings.Contains(name, "/") || name == "." || name == ".." {
+			// The name is used in file paths, such as for persisted logs.
+			return &FormatError{
+				Message: fmt.Sprintf(`cannot use service name %q: must not contain "/" or be "." or ".."`, name),
+			}
+		}
+		if service == nil {
+			return &FormatError{
+				Message: fmt.Sprintf("service object cannot be null for service %q", name),
+			}
+		}
+		_, _, err := service.ParseCommand()
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("plan service %q command invalid: %v", name, err),
+			}
+		}
+		if service.Arch != "" && !validArch(service.Arch) {
+			return &FormatError{
+				Message: fmt.Sprintf("plan service %q arch %q invalid (must be one of: %s)",
+					name, service.Arch, validArchNames()),
+			}
+		}
+		err = validateServiceKind(service)
+		if err != nil {
+			return err
+		}
+		switch service.Stdin {
+		case StdinUnset, StdinNull, StdinPipe:
+		default:
+			return &FormatError{
+				Message: fmt.Sprintf("plan service %q stdin %q invalid (must be %q or %q)",
+					name, service.Stdin, StdinNull, StdinPipe),
+			}
+		}
+		if !validServiceAction(service.OnSuccess, ActionFailureShutdown) {
+			return &FormatError{
+				Message: fmt.Sprintf("plan service %q on-success action %q invalid", name, service.OnSuccess),
+			}
+		}
+		if !validServiceAction(service.OnFailure, ActionSuccessShutdown) {
+			return &FormatError{
+				Message: fmt.Sprintf("plan service %q on-failure action %q invalid", name, service.OnFailure),
+			}
+		}
+		for _, action := range service.OnCheckFailure {
+			if !validServiceAction(action, ActionSuccessShutdown) {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q on-check-failure action %q invalid", name, action),
+				}
+			}
+		}
+		for _, path := range service.RequiresPath {
+			if !filepath.IsAbs(path) {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q requires-path %q must be absolute", name, path),
+				}
+			}
+		}
+		for _, port := range service.RequiresPort {
+			_, err := PortAddress(port)
+			if err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q requires-port %q invalid: %v", name, port, err),
+				}
+			}
+		}
+		if service.BackoffFactor.IsSet && service.BackoffFactor.Value < 1 {
+			return &FormatError{
+				Message: fmt.Sprintf("plan service %q backoff-factor must be 1.0 or greater, not %g", name, service.BackoffFactor.Value),
+			}
+		}
+		if service.When != "" {
+			_, err := parseWhen(service.When)
+			if err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q when expression invalid: %v", name, err),
+				}
+			}
+		}
+		if service.Isolation != nil {
+			for _, path := range service.Isolation.ReadOnlyPaths {
+				if !filepath.IsAbs(path) {
+					return &FormatError{
+						Message: fmt.Sprintf("plan service %q read-only path %q must be absolute", name, path),
+					}
+				}
+			}
+		}
+		for path, dir := range service.Directories {
+			if !filepath.IsAbs(path) {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q directory %q must be absolute", name, path),
+				}
+			}
+			if dir == nil {
+				continue
+			}
+			if _, err := dir.ParseMode(); err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q directory %q %v", name, path, err),
+				}
+			}
+		}
+		for secretName, secret := range service.Secrets {
+			if secret == nil || (secret.Environment == "" && secret.File == "") {
+				return &FormatError{
+					Message: fmt.Sprintf(`plan service %q secret %q must set "environment" or "file"`, name, secretName),
+				}
+			}
+			if secret.Environment != "" && !varNameExp.MatchString(secret.Environment) {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q secret %q has invalid environment variable name %q",
+						name, secretName, secret.Environment),
+				}
+			}
+			if secret.File != "" && !filepath.IsAbs(secret.File) {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q secret %q file %q must be absolute", name, secretName, secret.File),
+				}
+			}
+		}
+		for resource, limit := range service.Ulimits {
+			if !validUlimits[resource] {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q ulimit %q unknown", name, resource),
+				}
+			}
+			if limit.Soft > limit.Hard {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q ulimit %q soft limit must not exceed hard limit", name, resource),
+				}
+			}
+		}
+	}
+
+	for name, check := range layer.Checks {
+		if name == "" {
+			return &FormatError{
+				Message: fmt.Sprintf("cannot use empty string as check name"),
+			}
+		}
+		if check == nil {
+			return &FormatError{
+				Message: fmt.Sprintf("check object cannot be null for check %q", name),
+			}
+		}
+		if name == "" {
+			return &FormatError{
+				Message: fmt.Sprintf("cannot use empty string as log target name"),
+			}
+		}
+		if check.Level != UnsetLevel && check.Level != AliveLevel && check.Level != ReadyLevel {
+			return &FormatError{
+				Message: fmt.Sprintf(`plan check %q level must be "alive" or "ready"`, name),
+			}
+		}
+		if check.Period.IsSet && check.Period.Value == 0 {
+			return &FormatError{
+				Message: fmt.Sprintf("plan check %q period must not be zero", name),
+			}
+		}
+		if check.Timeout.IsSet && check.Timeout.Value == 0 {
+			return &FormatError{
+				Message: fmt.Sprintf("plan check %q timeout must not be zero", name),
+			}
+		}
+		if check.When != "" {
+			_, err := parseWhen(check.When)
+			if err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("plan check %q when expression invalid: %v", name, err),
+				}
+			}
+		}
+
+		if check.OnRecovery != nil && check.OnRecovery.Exec != "" {
+			_, err := shlex.Split(check.OnRecovery.Exec)
+			if err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("plan check %q on-recovery exec command invalid: %v", name, err),
+				}
+			}
+		}
+
+		if check.Exec != nil {
+			_, err := shlex.Split(check.Exec.Command)
+			if err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("plan check %q command invalid: %v", name, err),
+				}
+			}
+			_, _, err = osutil.NormalizeUidGid(check.Exec.UserID, check.Exec.GroupID, check.Exec.User, check.Exec.Group)
+			if err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("plan check %q has invalid user/group: %v", name, err),
+				}
+			}
+			if check.Exec.Arch != "" && !validArch(check.Exec.Arch) {
+				return &FormatError{
+					Message: fmt.Sprintf("plan check %q arch %q invalid (must be one of: %s)",
+						name, check.Exec.Arch, validArchNames()),
+				}
+			}
+		}
+	}
+
+	for name, target := range layer.LogTargets {
+		if target == nil {
+			return &FormatError{
+				Message: fmt.Sprintf("log target object cannot be null for log target %q", name),
+			}
+		}
+		for labelName := range target.Labels {
+			// 'pebble_*' labels are reserved
+			if strings.HasPrefix(labelName, "pebble_") {
+				return &FormatError{
+					Message: fmt.Sprintf(`log target %q: label %q uses reserved prefix "pebble_"`, name, labelName),
+				}
+			}
+		}
+		switch target.Type {
+		case LokiTarget, SyslogTarget:
+			// valid, continue
+		case UnsetLogTarget:
+			// will be checked when the layers are combined
+		default:
+			return &FormatError{
+				Message: fmt.Sprintf(`log target %q has unsupported type %q, must be %q or %q`,
+					name, target.Type, LokiTarget, SyslogTarget),
+			}
+		}
+		if auth := target.Auth; auth != nil {
+			switch {
+			case auth.Basic != nil && auth.Bearer != nil:
+				return &FormatError{
+					Message: fmt.Sprintf(`log target %q auth must specify only one of "basic" or "bearer"`, name),
+				}
+			case auth.Basic != nil:
+				if auth.Basic.User == "" || auth.Basic.PasswordFile == "" {
+					return &FormatError{
+						Message: fmt.Sprintf(`log target %q basic auth must define "user" and "password-file"`, name),
+					}
+				}
+				if !filepath.IsAbs(auth.Basic.PasswordFile) {
+					return &FormatError{
+						Message: fmt.Sprintf(`log target %q password-file must be an absolute path`, name),
+					}
+				}
+			case auth.Bearer != nil:
+				if auth.Bearer.TokenFile == "" {
+					return &FormatError{
+						Message: fmt.Sprintf(`log target %q bearer auth must define "token-file"`, name),
+					}
+				}
+				if !filepath.IsAbs(auth.Bearer.TokenFile) {
+					return &FormatError{
+						Message: fmt.Sprintf(`log target %q token-file must be an absolute path`, name),
+					}
+				}
+			default:
+				return &FormatError{
+					Message: fmt.Sprintf(`log target %q auth must specify "basic" or "bearer"`, name),
+				}
+			}
+		}
+		if target.BufferSize < 0 || target.BufferSize > maxLogTargetBufferSize {
+			return &FormatError{
+				Message: fmt.Sprintf(`log target %q buffer-size must be between 1 and %d`,
+					name, maxLogTargetBufferSize),
+			}
+		}
+		if target.BatchSize < 0 {
+			return &FormatError{
+				Message: fmt.Sprintf(`log target %q batch-size must be 1 or greater`, name),
+			}
+		}
+		if target.FlushInterval.IsSet && (target.FlushInterval.Value < minLogTargetFlushInterval ||
+			target.FlushInterval.Value > maxLogTargetFlushInterval) {
+			return &FormatError{
+				Message: fmt.Sprintf(`log target %q flush-interval must be between %s and %s`,
+					name, minLogTargetFlushInterval, maxLogTargetFlushInterval),
+			}
+		}
+	}
+
+	for name, hook := range layer.NoticeHooks {
+		if name == "" {
+			return &FormatError{
+				Message: "cannot use empty string as notice hook name",
+			}
+		}
+		if hook == nil {
+			return &FormatError{
+				Message: fmt.Sprintf("notice hook object cannot be null for notice hook %q", name),
+			}
+		}
+		for _, noticeType := range hook.Types {
+			if noticeType == "" {
+				return &FormatError{
+					Message: fmt.Sprintf("plan notice hook %q cannot match empty notice type", name),
+				}
+			}
+		}
+		_, err := shlex.Split(hook.Command)
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("plan notice hook %q command invalid: %v", name, err),
+			}
+		}
+		_, _, err = osutil.NormalizeUidGid(hook.UserID, hook.GroupID, hook.User, hook.Group)
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("plan notice hook %q has invalid user/group: %v", name, err),
+			}
+		}
+	}
+
+	if layer.Network != nil {
+		err := layer.Network.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, mount := range layer.Mounts {
+		if name == "" {
+			return &FormatError{
+				Message: "cannot use empty string as mount name",
+			}
+		}
+		if mount == nil {
+			return &FormatError{
+				Message: fmt.Sprintf("mount object cannot be null for mount %q", name),
+			}
+		}
+		if mount.Target != "" && !filepath.IsAbs(mount.Target) {
+			return &FormatError{
+				Message: fmt.Sprintf("plan mount %q target must be an absolute path", name),
+			}
+		}
+		for _, option := range mount.Options {
+			if option == "" || strings.Contains(option, ",") {
+				return &FormatError{
+					Message: fmt.Sprintf("plan mount %q has invalid option %q", name, option),
+				}
+			}
+		}
+	}
+
+	for name, module := range layer.KernelModules {
+		if !kernelModuleExp.MatchString(name) {
+			return &FormatError{
+				Message: fmt.Sprintf("invalid kernel module name %q", name),
+			}
+		}
+		if module == nil {
+			return &FormatError{
+				Message: fmt.Sprintf("kernel module object cannot be null for kernel module %q", name),
+			}
+		}
+		for param, value := range module.Parameters {
+			if !kernelModuleExp.MatchString(param) {
+				return &FormatError{
+					Message: fmt.Sprintf("plan kernel module %q has invalid parameter name %q", name, param),
+				}
+			}
+			if strings.ContainsAny(value, " \t\n") {
+				return &FormatError{
+					Message: fmt.Sprintf("plan kernel module %q parameter %q value cannot contain whitespace", name, param),
+				}
+			}
+		}
+	}
+
+	for name, sysctl := range layer.Sysctls {
+		if !validSysctlName(name) {
+			return &FormatError{
+				Message: fmt.Sprintf("invalid sysctl name %q", name),
+			}
+		}
+		if sysctl == nil {
+			return &FormatError{
+				Message: fmt.Sprintf("sysctl object cannot be null for sysctl %q", name),
+			}
+		}
+		if strings.Contains(sysctl.Value, "\n") {
+			return &FormatError{
+				Message: fmt.Sprintf("plan sysctl %q value cannot contain newlines", name),
+			}
+		}
+	}
+
+	for name, server := range layer.TimeServers {
+		if name == "" {
+			return &FormatError{
+				Message: "cannot use empty string as time server name",
+			}
+		}
+		if server == nil {
+			return &FormatError{
+				Message: fmt.Sprintf("time server object cannot be null for time server %q", name),
+			}
 		}
-		if !service.BackoffLimit.IsSet {
-			service.BackoffLimit.Value = defaultBackoffLimit
+		if server.PollInterval.IsSet && server.PollInterval.Value < minTimeServerPollInterval {
+			return &FormatError{
+				Message: fmt.Sprintf("plan time server %q poll-interval must be %s or greater", name, minTimeServerPollInterval),
+			}
 		}
 	}
 
-	for _, check := range combined.Checks {
-		if !check.Period.IsSet {
-			check.Period.Value = defaultCheckPeriod
+	for name, watchdog := range layer.Watchdogs {
+		if name == "" {
+			return &FormatError{
+				Message: "cannot use empty string as watchdog name",
+			}
 		}
-		if !check.Timeout.IsSet {
-			check.Timeout.Value = defaultCheckTimeout
+		if watchdog == nil {
+			return &FormatError{
+				Message: fmt.Sprintf("watchdog object cannot be null for watchdog %q", name),
+			}
 		}
-		if check.Timeout.Value > check.Period.Value {
-			// The effective timeout will be the period, so make that clear.
-			// `.IsSet` remains false so that the capped value does not appear
-			// in the combined plan output - and it's not *user* set - the
-			// effective default timeout is the minimum of (check.Period.Value,
-			// default timeout).
-			check.Timeout.Value = check.Period.Value
+		if watchdog.Device != "" && !filepath.IsAbs(watchdog.Device) {
+			return &FormatError{
+				Message: fmt.Sprintf("plan watchdog %q device must be an absolute path", name),
+			}
 		}
-		if check.Threshold == 0 {
-			// Default number of failures in a row before check triggers
-			// action, default is >1 to avoid flapping due to glitches. For
-			// what it's worth, Kubernetes probes uses a default of 3 too.
-			check.Threshold = defaultCheckThreshold
+		if watchdog.Interval.IsSet && watchdog.Interval.Value == 0 {
+			return &FormatError{
+				Message: fmt.Sprintf("plan watchdog %q interval must not be zero", name),
+			}
 		}
-	}
-
-	return combined, nil
-}
-
-// Validate checks that the layer is valid. It returns nil if all the checks pass, or
-// an error if there are validation errors.
-// See also Plan.Validate, which does additional checks based on the combined
-// layers.
-func (layer *Layer) Validate() error {
-	if strings.HasPrefix(layer.Label, "pebble-") {
-		return &FormatError{
-			Message: `cannot use reserved label prefix "pebble-"`,
+		switch watchdog.OnStop {
+		case UnsetWatchdogAction, WatchdogClose, WatchdogFire:
+		default:
+			return &FormatError{
+				Message: fmt.Sprintf(`plan watchdog %q on-stop must be %q or %q`, name, WatchdogClose, WatchdogFire),
+			}
 		}
 	}
 
-	for name, service := range layer.Services {
+	for name, device := range layer.Devices {
 		if name == "" {
 			return &FormatError{
-				Message: fmt.Sprintf("cannot use empty string as service name"),
+				Message: "cannot use empty string as device name",
 			}
 		}
-		if name == "pebble" {
-			// Disallow service name "pebble" to avoid ambiguity (for example,
-			// in log output).
+		if device == nil {
 			return &FormatError{
-				Message: fmt.Sprintf("cannot use reserved service name %q", name),
+				Message: fmt.Sprintf("device object cannot be null for device %q", name),
 			}
 		}
-		// Deprecated service names
-		if name == "all" || name == "default" || name == "none" {
-			logger.Noticef("Using keyword %q as a service name is deprecated", name)
+		if device.Path != "" && !filepath.IsAbs(device.Path) {
+			return &FormatError{
+				Message: fmt.Sprintf("plan device %q path must be absolute", name),
+			}
 		}
-		if strings.HasPrefix(name, "-") {
+		if device.Subsystem != "" && !subsystemExp.MatchString(device.Subsystem) {
 			return &FormatError{
-				Message: fmt.Sprintf(`cannot use service name %q: starting with "-" not allowed`, name),
+				Message: fmt.Sprintf("plan device %q has invalid subsystem %q", name, device.Subsystem),
 			}
 		}
-		if service == nil {
+	}
+
+	for name, secret := range layer.Secrets {
+		if name == "" {
 			return &FormatError{
-				Message: fmt.Sprintf("service object cannot be null for service %q", name),
+				Message: "cannot use empty string as secret name",
 			}
 		}
-		_, _, err := service.ParseCommand()
-		if err != nil {
+		if secret == nil {
 			return &FormatError{
-				Message: fmt.Sprintf("plan service %q command invalid: %v", name, err),
+				Message: fmt.Sprintf("secret object cannot be null for secret %q", name),
 			}
 		}
-		if !validServiceAction(service.OnSuccess, ActionFailureShutdown) {
+		switch secret.Backend {
+		case UnsetSecretBackend, FileSecretBackend, EnvSecretBackend, KeyringSecretBackend, CommandSecretBackend:
+		default:
 			return &FormatError{
-				Message: fmt.Sprintf("plan service %q on-success action %q invalid", name, service.OnSuccess),
+				Message: fmt.Sprintf(`plan secret %q has invalid backend %q, must be %q, %q, %q, or %q`,
+					name, secret.Backend, FileSecretBackend, EnvSecretBackend, KeyringSecretBackend, CommandSecretBackend),
 			}
 		}
-		if !validServiceAction(service.OnFailure, ActionSuccessShutdown) {
+		if secret.Path != "" && !filepath.IsAbs(secret.Path) {
 			return &FormatError{
-				Message: fmt.Sprintf("plan service %q on-failure action %q invalid", name, service.OnFailure),
+				Message: fmt.Sprintf("plan secret %q path must be absolute", name),
 			}
 		}
-		for _, action := range service.OnCheckFailure {
-			if !validServiceAction(action, ActionSuccessShutdown) {
+		if secret.Command != "" {
+			if _, err := shlex.Split(secret.Command); err != nil {
 				return &FormatError{
-					Message: fmt.Sprintf("plan service %q on-check-failure action %q invalid", name, action),
+					Message: fmt.Sprintf("plan secret %q command invalid: %v", name, err),
 				}
 			}
 		}
-		if service.BackoffFactor.IsSet && service.BackoffFactor.Value < 1 {
+	}
+
+	for name := range layer.Vars {
+		if !varNameExp.MatchString(name) {
 			return &FormatError{
-				Message: fmt.Sprintf("plan service %q backoff-factor must be 1.0 or greater, not %g", name, service.BackoffFactor.Value),
+				Message: fmt.Sprintf("invalid variable name %q", name),
 			}
 		}
 	}
 
-	for name, check := range layer.Checks {
-		if name == "" {
+	return nil
+}
+
+// Validate checks that the combined layers form a valid plan.
+// See also Layer.Validate, which checks that the individual layers are valid.
+func (p *Plan) Validate() error {
+	err := p.validateSections()
+	if err != nil {
+		return err
+	}
+
+	for name, service := range p.Services {
+		if service.Command == "" {
 			return &FormatError{
-				Message: fmt.Sprintf("cannot use empty string as check name"),
+				Message: fmt.Sprintf(`plan must define "command" for service %q`, name),
 			}
 		}
-		if check == nil {
-			return &FormatError{
-				Message: fmt.Sprintf("check object cannot be null for check %q", name),
-			}
+		err := validateOCIService(service)
+		if err != nil {
+			return err
 		}
-		if name == "" {
+		if !canExecArch(service.Arch) {
 			return &FormatError{
-				Message: fmt.Sprintf("cannot use empty string as log target name"),
+				Message: fmt.Sprintf("plan service %q is built for %s, but the host is %s and no binfmt_misc interpreter is enabled for %s (for example, install qemu-user-static)",
+					name, service.Arch, hostArch, service.Arch),
 			}
 		}
-		if check.Level != UnsetLevel && check.Level != AliveLevel && check.Level != ReadyLevel {
-			return &FormatError{
-				Message: fmt.Sprintf(`plan check %q level must be "alive" or "ready"`, name),
+		for secretName := range service.Secrets {
+			if _, ok := p.Secrets[secretName]; !ok {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q specifies unknown secret %q", name, secretName),
+				}
 			}
 		}
-		if check.Period.IsSet && check.Period.Value == 0 {
-			return &FormatError{
-				Message: fmt.Sprintf("plan check %q period must not be zero", name),
+		for _, other := range service.RestartWith {
+			if _, ok := p.Services[other]; !ok {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q restart-with specifies non-existent service %q",
+						name, other),
+				}
+			}
+			if other == name {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q cannot restart with itself", name),
+				}
 			}
 		}
-		if check.Timeout.IsSet && check.Timeout.Value == 0 {
-			return &FormatError{
-				Message: fmt.Sprintf("plan check %q timeout must not be zero", name),
+		for _, device := range service.RequiresDevice {
+			if _, ok := p.Devices[device]; !ok {
+				return &FormatError{
+					Message: fmt.Sprintf("plan service %q requires-device specifies non-existent device %q",
+						name, device),
+				}
 			}
 		}
+	}
 
+	for name, check := range p.Checks {
+		numTypes := 0
+		if check.HTTP != nil {
+			if check.HTTP.URL == "" {
+				return &FormatError{
+					Message: fmt.Sprintf(`plan must set "url" for http check %q`, name),
+				}
+			}
+			numTypes++
+		}
+		if check.TCP != nil {
+			if check.TCP.Port == 0 {
+				return &FormatError{
+					Message: fmt.Sprintf(`plan must set "port" for tcp check %q`, name),
+				}
+			}
+			numTypes++
+		}
 		if check.Exec != nil {
-			_, err := shlex.Split(check.Exec.Command)
-			if err != nil {
+			if check.Exec.Command == "" {
 				return &FormatError{
-					Message: fmt.Sprintf("plan check %q command invalid: %v", name, err),
+					Message: fmt.Sprintf(`plan must set "command" for exec check %q`, name),
 				}
 			}
-			_, _, err = osutil.NormalizeUidGid(check.Exec.UserID, check.Exec.GroupID, check.Exec.User, check.Exec.Group)
-			if err != nil {
+			if !canExecArch(check.Exec.Arch) {
 				return &FormatError{
-					Message: fmt.Sprintf("plan check %q has invalid user/group: %v", name, err),
+					Message: fmt.Sprintf("plan check %q is built for %s, but the host is %s and no binfmt_misc interpreter is enabled for %s (for example, install qemu-user-static)",
+						name, check.Exec.Arch, hostArch, check.Exec.Arch),
+				}
+			}
+			_, contextExists := p.Services[check.Exec.ServiceContext]
+			if check.Exec.ServiceContext != "" && !contextExists {
+				return &FormatError{
+					Message: fmt.Sprintf("plan check %q service context specifies non-existent service %q",
+						name, check.Exec.ServiceContext),
 				}
 			}
+			numTypes++
 		}
-	}
-
-	for name, target := range layer.LogTargets {
-		if target == nil {
+		if check.Device != nil {
+			if check.Device.Name == "" {
+				return &FormatError{
+					Message: fmt.Sprintf(`plan must set "name" for device check %q`, name),
+				}
+			}
+			if _, ok := p.Devices[check.Device.Name]; !ok {
+				return &FormatError{
+					Message: fmt.Sprintf("plan check %q specifies non-existent device %q", name, check.Device.Name),
+				}
+			}
+			numTypes++
+		}
+		if numTypes != 1 {
 			return &FormatError{
-				Message: fmt.Sprintf("log target object cannot be null for log target %q", name),
+				Message: fmt.Sprintf(`plan must specify one of "http", "tcp", "exec", or "device" for check %q`, name),
 			}
 		}
-		for labelName := range target.Labels {
-			// 'pebble_*' labels are reserved
-			if strings.HasPrefix(labelName, "pebble_") {
-				return &FormatError{
-					Message: fmt.Sprintf(`log target %q: label %q uses reserved prefix "pebble_"`, name, labelName),
+		if check.OnRecovery != nil {
+			for _, service := range check.OnRecovery.Restart {
+				if _, ok := p.Services[service]; !ok {
+					return &FormatError{
+						Message: fmt.Sprintf("plan check %q on-recovery restarts non-existent service %q",
+							name, service),
+					}
 				}
 			}
 		}
+	}
+
+	for name, target := range p.LogTargets {
 		switch target.Type {
 		case LokiTarget, SyslogTarget:
 			// valid, continue
 		case UnsetLogTarget:
-			// will be checked when the layers are combined
-		default:
 			return &FormatError{
-				Message: fmt.Sprintf(`log target %q has unsupported type %q, must be %q or %q`,
-					name, target.Type, LokiTarget, SyslogTarget),
+				Message: fmt.Sprintf(`plan must define "type" (%q or %q) for log target %q`,
+					LokiTarget, SyslogTarget, name),
+			}
+		}
+
+		// Validate service names specified in log target.
+		for _, serviceName := range target.Services {
+			serviceName = strings.TrimPrefix(serviceName, "-")
+			if serviceName == "all" {
+				continue
+			}
+			if _, ok := p.Services[serviceName]; ok {
+				continue
+			}
+			return &FormatError{
+				Message: fmt.Sprintf(`log target %q specifies unknown service %q`,
+					target.Name, serviceName),
+			}
+		}
+
+		if target.Location == "" {
+			return &FormatError{
+				Message: fmt.Sprintf(`plan must define "location" for log target %q`, name),
+			}
+		}
+
+		if target.Type != LokiTarget && (target.TenantID != "" || target.Auth != nil) {
+			return &FormatError{
+				Message: fmt.Sprintf(`log target %q: "tenant-id" and "auth" are only supported for %q targets`,
+					name, LokiTarget),
+			}
+		}
+
+		if target.BatchSize != 0 && target.BufferSize != 0 && target.BatchSize > target.BufferSize {
+			return &FormatError{
+				Message: fmt.Sprintf(`log target %q batch-size (%d) must not be greater than buffer-size (%d)`,
+					name, target.BatchSize, target.BufferSize),
 			}
 		}
 	}
 
-	return nil
-}
+	for name, hook := range p.NoticeHooks {
+		// A command of only whitespace parses to no arguments.
+		if args, _ := shlex.Split(hook.Command); len(args) == 0 {
+			return &FormatError{
+				Message: fmt.Sprintf(`plan must define "command" for notice hook %q`, name),
+			}
+		}
+	}
 
-// Validate checks that the combined layers form a valid plan.
-// See also Layer.Validate, which checks that the individual layers are valid.
-func (p *Plan) Validate() error {
-	for name, service := range p.Services {
-		if service.Command == "" {
+	if p.Network != nil {
+		for name := range p.Network.Ethernets {
+			if _, ok := p.Network.Wifis[name]; ok {
+				return &FormatError{
+					Message: fmt.Sprintf("plan network interface %q defined as both an ethernet and a wifi", name),
+				}
+			}
+		}
+		for name, iface := range p.Network.Wifis {
+			if len(iface.AccessPoints) == 0 {
+				return &FormatError{
+					Message: fmt.Sprintf(`plan must define "access-points" for wifi %q`, name),
+				}
+			}
+		}
+	}
+
+	for name, sysctl := range p.Sysctls {
+		if sysctl.Value == "" {
+			return &FormatError{
+				Message: fmt.Sprintf(`plan must define "value" for sysctl %q`, name),
+			}
+		}
+	}
+
+	for name, server := range p.TimeServers {
+		if server.Address == "" {
+			return &FormatError{
+				Message: fmt.Sprintf(`plan must define "address" for time server %q`, name),
+			}
+		}
+	}
+
+	for name, secret := range p.Secrets {
+		var field, value string
+		switch secret.Backend {
+		case FileSecretBackend:
+			field, value = "path", secret.Path
+		case EnvSecretBackend:
+			field, value = "variable", secret.Variable
+		case KeyringSecretBackend:
+			field, value = "key", secret.Key
+		case CommandSecretBackend:
+			field, value = "command", secret.Command
+			// A command of only whitespace parses to no arguments.
+			if args, _ := shlex.Split(value); len(args) == 0 {
+				value = ""
+			}
+		default:
+			return &FormatError{
+				Message: fmt.Sprintf(`plan must define "backend" for secret %q`, name),
+			}
+		}
+		if value == "" {
 			return &FormatError{
-				Message: fmt.Sprintf(`plan must define "command" for service %q`, name),
+				Message: fmt.Sprintf(`plan must define %q for %s secret %q`, field, secret.Backend, name),
 			}
 		}
 	}
 
-	for name, check := range p.Checks {
-		numTypes := 0
-		if check.HTTP != nil {
-			if check.HTTP.URL == "" {
-				return &FormatError{
-					Message: fmt.Sprintf(`plan must set "url" for http check %q`, name),
-				}
+	for name, device := range p.Devices {
+		if device.Path == "" && device.Subsystem == "" {
+			return &FormatError{
+				Message: fmt.Sprintf(`plan must set "path" or "subsystem" for device %q`, name),
 			}
-			numTypes++
 		}
-		if check.TCP != nil {
-			if check.TCP.Port == 0 {
+	}
+
+	devices := make(map[string]string, len(p.Watchdogs))
+	for name, watchdog := range p.Watchdogs {
+		for _, checkName := range watchdog.Checks {
+			if _, ok := p.Checks[checkName]; !ok {
 				return &FormatError{
-					Message: fmt.Sprintf(`plan must set "port" for tcp check %q`, name),
+					Message: fmt.Sprintf(`watchdog %q specifies unknown check %q`, name, checkName),
 				}
 			}
-			numTypes++
 		}
-		if check.Exec != nil {
-			if check.Exec.Command == "" {
-				return &FormatError{
-					Message: fmt.Sprintf(`plan must set "command" for exec check %q`, name),
-				}
-			}
-			_, contextExists := p.Services[check.Exec.ServiceContext]
-			if check.Exec.ServiceContext != "" && !contextExists {
+		for _, serviceName := range watchdog.Services {
+			if _, ok := p.Services[serviceName]; !ok {
 				return &FormatError{
-					Message: fmt.Sprintf("plan check %q service context specifies non-existent service %q",
-						name, check.Exec.ServiceContext),
+					Message: fmt.Sprintf(`watchdog %q specifies unknown service %q`, name, serviceName),
 				}
 			}
-			numTypes++
 		}
-		if numTypes != 1 {
+		if other, ok := devices[watchdog.Device]; ok {
+			// Report the names in a stable order.
+			first, second := other, name
+			if second < first {
+				first, second = second, first
+			}
 			return &FormatError{
-				Message: fmt.Sprintf(`plan must specify one of "http", "tcp", or "exec" for check %q`, name),
+				Message: fmt.Sprintf("plan watchdogs %q and %q use the same device %q", first, second, watchdog.Device),
 			}
 		}
+		devices[watchdog.Device] = name
 	}
 
-	for name, target := range p.LogTargets {
-		switch target.Type {
-		case LokiTarget, SyslogTarget:
-			// valid, continue
-		case UnsetLogTarget:
+	targets := make(map[string]string, len(p.Mounts))
+	for name, mount := range p.Mounts {
+		if mount.Source == "" {
 			return &FormatError{
-				Message: fmt.Sprintf(`plan must define "type" (%q or %q) for log target %q`,
-					LokiTarget, SyslogTarget, name),
+				Message: fmt.Sprintf(`plan must define "source" for mount %q`, name),
 			}
 		}
-
-		// Validate service names specified in log target.
-		for _, serviceName := range target.Services {
-			serviceName = strings.TrimPrefix(serviceName, "-")
-			if serviceName == "all" {
-				continue
-			}
-			if _, ok := p.Services[serviceName]; ok {
-				continue
+		if mount.Target == "" {
+			return &FormatError{
+				Message: fmt.Sprintf(`plan must define "target" for mount %q`, name),
 			}
+		}
+		if mount.Type == "" && !mount.IsBind() {
 			return &FormatError{
-				Message: fmt.Sprintf(`log target %q specifies unknown service %q`,
-					target.Name, serviceName),
+				Message: fmt.Sprintf(`plan must define "type" for mount %q (unless it is a bind mount)`, name),
 			}
 		}
-
-		if target.Location == "" {
+		target := filepath.Clean(mount.Target)
+		if other, ok := targets[target]; ok {
+			// Report the names in a stable order.
+			first, second := other, name
+			if second < first {
+				first, second = second, first
+			}
 			return &FormatError{
-				Message: fmt.Sprintf(`plan must define "location" for log target %q`, name),
+				Message: fmt.Sprintf("plan mounts %q and %q have the same target %q", first, second, target),
 			}
 		}
+		targets[target] = name
 	}
 
 	// Ensure combined layers don't have cycles.
-	err := p.checkCycles()
+	err = p.checkCycles()
 	if err != nil {
 		return err
 	}
@@ -936,6 +2792,36 @@ func (p *Plan) StopOrder(names []string) ([]string, error) {
 	return order(p.Services, names, true)
 }
 
+// RestartWith returns the services that must be restarted when the named
+// services restart: those that list any of them in restart-with, directly
+// or through another such service. The named services aren't included.
+func (p *Plan) RestartWith(names []string) []string {
+	dependents := make(map[string][]string)
+	for name, service := range p.Services {
+		for _, other := range service.RestartWith {
+			dependents[other] = append(dependents[other], name)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		seen[name] = true
+	}
+	var result []string
+	pending := append([]string(nil), names...)
+	for i := 0; i < len(pending); i++ {
+		for _, dependent := range dependents[pending[i]] {
+			if !seen[dependent] {
+				seen[dependent] = true
+				result = append(result, dependent)
+				pending = append(pending, dependent)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
 func order(services map[string]*Service, names []string, stop bool) ([]string, error) {
 	// For stop, create a list of reversed dependencies.
 	predecessors := map[string][]string(nil)
@@ -1054,15 +2940,164 @@ func ParseLayer(order int, label string, data []byte) (*Layer, error) {
 			target.Name = name
 		}
 	}
+	for name, hook := range layer.NoticeHooks {
+		if hook != nil {
+			hook.Name = name
+		}
+	}
+	if layer.Network != nil {
+		for name, iface := range layer.Network.Ethernets {
+			if iface != nil {
+				iface.Name = name
+			}
+		}
+		for name, iface := range layer.Network.Wifis {
+			if iface != nil {
+				iface.Name = name
+			}
+		}
+	}
+	for name, mount := range layer.Mounts {
+		if mount != nil {
+			mount.Name = name
+		}
+	}
+	for name, module := range layer.KernelModules {
+		if module != nil {
+			module.Name = name
+		}
+	}
+	for name, sysctl := range layer.Sysctls {
+		if sysctl != nil {
+			sysctl.Name = name
+		}
+	}
+	for name, server := range layer.TimeServers {
+		if server != nil {
+			server.Name = name
+		}
+	}
+	for name, watchdog := range layer.Watchdogs {
+		if watchdog != nil {
+			watchdog.Name = name
+		}
+	}
+	for name, device := range layer.Devices {
+		if device != nil {
+			device.Name = name
+		}
+	}
+	for name, secret := range layer.Secrets {
+		if secret != nil {
+			secret.Name = name
+		}
+	}
 
 	err = layer.Validate()
 	if err != nil {
+		if formatErr, ok := err.(*FormatError); ok && formatErr.Line == 0 {
+			formatErr.Line, formatErr.Column = layer.errorPosition(data)
+		}
 		return nil, err
 	}
 
 	return &layer, err
 }
 
+// PortAddress returns the TCP address to connect to for a service's
+// requires-port entry, which is a port number, optionally preceded by a
+// host and a colon. The host defaults to localhost.
+func PortAddress(port string) (string, error) {
+	host := "localhost"
+	if strings.Contains(port, ":") {
+		var err error
+		host, port, err = net.SplitHostPort(port)
+		if err != nil {
+			return "", err
+		}
+		if host == "" {
+			return "", errors.New("host must not be empty")
+		}
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("port must be a number from 1 to 65535")
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func validateServiceKind(service *Service) error {
+	switch service.Kind {
+	case KindUnset, KindProcess, KindOCI:
+	default:
+		return &FormatError{
+			Message: fmt.Sprintf("plan service %q kind %q invalid (must be %q or %q)",
+				service.Name, service.Kind, KindProcess, KindOCI),
+		}
+	}
+	if service.Image != "" && !filepath.IsAbs(service.Image) {
+		return &FormatError{
+			Message: fmt.Sprintf("plan service %q image %q must be an absolute path", service.Name, service.Image),
+		}
+	}
+	return nil
+}
+
+var containerIDExp = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+
+// validateOCIService checks the combined options of an OCI service, which
+// are limited to those that apply to the runtime rather than the container:
+// the container's user, namespaces, and limits are set by its bundle.
+func validateOCIService(service *Service) error {
+	if service.Kind != KindOCI {
+		if service.Image != "" {
+			return &FormatError{
+				Message: fmt.Sprintf(`plan service %q can only have an image if its kind is %q`, service.Name, KindOCI),
+			}
+		}
+		return nil
+	}
+	if !containerIDExp.MatchString(service.Name) {
+		return &FormatError{
+			Message: fmt.Sprintf("plan service %q name invalid for an OCI service (must only contain letters, digits, and \"_.+-\")", service.Name),
+		}
+	}
+	base, extra, err := service.ParseCommand()
+	if err != nil {
+		return &FormatError{
+			Message: fmt.Sprintf("plan service %q command invalid: %v", service.Name, err),
+		}
+	}
+	if len(base) != 1 || len(extra) != 0 || !filepath.IsAbs(base[0]) {
+		return &FormatError{
+			Message: fmt.Sprintf("plan service %q command must be the absolute path of an OCI bundle directory", service.Name),
+		}
+	}
+	var unsupported []string
+	if service.UserID != nil || service.User != "" {
+		unsupported = append(unsupported, "user")
+	}
+	if service.GroupID != nil || service.Group != "" {
+		unsupported = append(unsupported, "group")
+	}
+	if service.Arch != "" {
+		unsupported = append(unsupported, "arch")
+	}
+	if service.Isolation != nil {
+		unsupported = append(unsupported, "isolation")
+	}
+	if len(service.Ulimits) > 0 {
+		unsupported = append(unsupported, "ulimits")
+	}
+	if len(unsupported) > 0 {
+		return &FormatError{
+			Message: fmt.Sprintf("plan service %q of kind %q cannot set %s (set them in the bundle's config.json)",
+				service.Name, KindOCI, strings.Join(unsupported, ", ")),
+		}
+	}
+	return nil
+}
+
 func validServiceAction(action ServiceAction, additionalValid ...ServiceAction) bool {
 	for _, v := range additionalValid {
 		if action == v {
@@ -1077,8 +3112,151 @@ func validServiceAction(action ServiceAction, additionalValid ...ServiceAction)
 	}
 }
 
+// networkInterfaceExp matches network interface names, which the kernel
+// limits to 15 characters.
+var networkInterfaceExp = regexp.MustCompile(`^[A-Za-z0-9_.@+-]{1,15}$`)
+
+func validNetworkInterfaceName(name string) bool {
+	return networkInterfaceExp.MatchString(name) && name != "." && name != ".."
+}
+
+// validate checks the network interfaces in a layer.
+func (n *Network) validate() error {
+	for name, iface := range n.Ethernets {
+		err := validateNetworkInterface(name, iface)
+		if err != nil {
+			return err
+		}
+		if len(iface.AccessPoints) > 0 {
+			return &FormatError{
+				Message: fmt.Sprintf(`plan network interface %q cannot define "access-points" (only valid for wifis)`, name),
+			}
+		}
+	}
+	for name, iface := range n.Wifis {
+		err := validateNetworkInterface(name, iface)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateNetworkInterface(name string, iface *NetworkInterface) error {
+	if !validNetworkInterfaceName(name) {
+		return &FormatError{
+			Message: fmt.Sprintf("invalid network interface name %q", name),
+		}
+	}
+	if iface == nil {
+		return &FormatError{
+			Message: fmt.Sprintf("network interface object cannot be null for network interface %q", name),
+		}
+	}
+	err := iface.validate()
+	if err != nil {
+		return &FormatError{
+			Message: fmt.Sprintf("plan network interface %q %v", name, err),
+		}
+	}
+	return nil
+}
+
+// validate checks the interface's addresses, routes, nameservers, and
+// access points, returning an error that completes a sentence starting with
+// the interface's name.
+func (n *NetworkInterface) validate() error {
+	for _, address := range n.Addresses {
+		if _, err := netip.ParsePrefix(address); err != nil {
+			return fmt.Errorf("has invalid address %q (must be an address with a prefix length)", address)
+		}
+	}
+	for _, route := range n.Routes {
+		dest, err := route.Destination()
+		if err != nil {
+			return fmt.Errorf("has invalid route to %q: %v", route.To, err)
+		}
+		if route.Via != "" {
+			via, err := netip.ParseAddr(route.Via)
+			if err != nil {
+				return fmt.Errorf("has invalid route to %q: invalid \"via\" address %q", route.To, route.Via)
+			}
+			if via.Is4() != dest.Addr().Is4() {
+				return fmt.Errorf("has invalid route to %q: \"via\" address %q is of a different family", route.To, route.Via)
+			}
+		}
+		if route.Metric < 0 {
+			return fmt.Errorf("has invalid route to %q: metric must not be negative", route.To)
+		}
+	}
+	for _, address := range n.Nameservers.Addresses {
+		if _, err := netip.ParseAddr(address); err != nil {
+			return fmt.Errorf("has invalid nameserver address %q", address)
+		}
+	}
+	for _, domain := range n.Nameservers.Search {
+		if domain == "" || strings.ContainsAny(domain, " \t\n") {
+			return fmt.Errorf("has invalid search domain %q", domain)
+		}
+	}
+	for ssid, ap := range n.AccessPoints {
+		if len(ssid) == 0 || len(ssid) > 32 {
+			return fmt.Errorf("has invalid access point SSID %q (must be 1 to 32 bytes)", ssid)
+		}
+		if ap == nil {
+			return fmt.Errorf("access point object cannot be null for SSID %q", ssid)
+		}
+		if ap.Password != "" && !validWPAPassphrase(ap.Password) {
+			return fmt.Errorf("has invalid password for access point %q (must be 8 to 63 printable ASCII characters)", ssid)
+		}
+	}
+	return nil
+}
+
+// validWPAPassphrase reports whether s is a valid WPA passphrase, which is
+// 8 to 63 printable ASCII characters.
+func validWPAPassphrase(s string) bool {
+	if len(s) < 8 || len(s) > 63 {
+		return false
+	}
+	for _, r := range s {
+		if r < ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// kernelModuleExp matches kernel module and parameter names.
+var kernelModuleExp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var subsystemExp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var sysctlSegmentExp = regexp.MustCompile(`^[A-Za-z0-9_:@+-]+$`)
+
+// validSysctlName reports whether name is a valid sysctl name, separated by
+// either "." or "/" (in which case the segments may also contain ".").
+func validSysctlName(name string) bool {
+	separator := "."
+	if strings.Contains(name, "/") {
+		separator = "/"
+	}
+	for _, segment := range strings.Split(name, separator) {
+		if segment == "." || segment == ".." {
+			return false
+		}
+		if !sysctlSegmentExp.MatchString(strings.ReplaceAll(segment, ".", "_")) {
+			return false
+		}
+	}
+	return true
+}
+
 var fnameExp = regexp.MustCompile("^([0-9]{3})-([a-z](?:-?[a-z0-9]){2,}).yaml$")
 
+// maxParseWorkers is the maximum number of layer files parsed concurrently.
+var maxParseWorkers = runtime.GOMAXPROCS(0)
+
 func ReadLayersDir(dirname string) ([]*Layer, error) {
 	finfos, err := os.ReadDir(dirname)
 	if err != nil {
@@ -1086,29 +3264,35 @@ func ReadLayersDir(dirname string) ([]*Layer, error) {
 		return nil, fmt.Errorf("cannot read layers directory: %v", err)
 	}
 
-	orders := make(map[int]string)
-	labels := make(map[string]int)
-
 	// Documentation says ReadDir result is already sorted by name.
 	// This is fundamental here so if reading changes make sure the
 	// sorting is preserved.
-	var layers []*Layer
+	var names []string
 	for _, finfo := range finfos {
 		if finfo.IsDir() || !strings.HasSuffix(finfo.Name(), ".yaml") {
 			continue
 		}
 		// TODO Consider enforcing permissions and ownership here to
 		//      avoid mistakes that could lead to hacks.
-		match := fnameExp.FindStringSubmatch(finfo.Name())
+		names = append(names, finfo.Name())
+	}
+	return readLayers(dirname, names, nil)
+}
+
+// readLayers parses the layer files with the given names, which must be
+// sorted, from the layers directory. The content of files in the contents
+// map is used instead of reading them.
+func readLayers(dirname string, names []string, contents map[string][]byte) ([]*Layer, error) {
+	orders := make(map[int]string)
+	labels := make(map[string]int)
+
+	var files []layerFile
+	for _, name := range names {
+		match := fnameExp.FindStringSubmatch(name)
 		if match == nil {
-			return nil, fmt.Errorf("invalid layer filename: %q (must look like \"123-some-label.yaml\")", finfo.Name())
+			return nil, fmt.Errorf("invalid layer filename: %q (must look like \"123-some-label.yaml\")", name)
 		}
 
-		data, err := os.ReadFile(filepath.Join(dirname, finfo.Name()))
-		if err != nil {
-			// Errors from package os generally include the path.
-			return nil, fmt.Errorf("cannot read layer file: %v", err)
-		}
 		label := match[2]
 		order, err := strconv.Atoi(match[1])
 		if err != nil {
@@ -1123,21 +3307,86 @@ func ReadLayersDir(dirname string) ([]*Layer, error) {
 			oldLabel = label
 		}
 		if dupOrder || dupLabel {
-			return nil, fmt.Errorf("invalid layer filename: %q not unique (have \"%03d-%s.yaml\" already)", finfo.Name(), oldOrder, oldLabel)
+			return nil, fmt.Errorf("invalid layer filename: %q not unique (have \"%03d-%s.yaml\" already)", name, oldOrder, oldLabel)
 		}
 
 		orders[order] = label
 		labels[label] = order
+		files = append(files, layerFile{name: name, order: order, label: label, data: contents[name]})
+	}
+
+	// Parse the files concurrently, as large layers can take a while. If
+	// several files have errors, report the first in order, as reading them
+	// one at a time would.
+	layers := make([]*Layer, len(files))
+	errs := make([]error, len(files))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < maxParseWorkers && w < len(files); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				layers[i], errs[i] = readLayerFile(dirname, files[i])
+			}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-		layer, err := ParseLayer(order, label, data)
+	for _, err := range errs {
 		if err != nil {
 			return nil, err
 		}
-		layers = append(layers, layer)
 	}
 	return layers, nil
 }
 
+type layerFile struct {
+	name  string
+	order int
+	label string
+	// data is the content of the file, if it's not to be read from the
+	// layers directory.
+	data []byte
+}
+
+// readLayerFile reads and parses a single file in the layers directory.
+func readLayerFile(dirname string, file layerFile) (*Layer, error) {
+	data := file.data
+	if data == nil {
+		var err error
+		data, err = os.ReadFile(filepath.Join(dirname, file.name))
+		if err != nil {
+			// Errors from package os generally include the path.
+			return nil, fmt.Errorf("cannot read layer file: %v", err)
+		}
+	}
+	merged, err := resolveIncludes(dirname, file.name, data)
+	if err != nil {
+		return nil, err
+	}
+	if merged != nil {
+		data = merged
+	}
+	layer, err := ParseLayer(file.order, file.label, data)
+	if err != nil {
+		// Positions in merged YAML don't correspond to the file.
+		if formatErr, ok := err.(*FormatError); ok && formatErr.Line > 0 && merged == nil {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("layer %s:%d:%d: %s", file.name, formatErr.Line, formatErr.Column, formatErr.Message),
+				Line:    formatErr.Line,
+				Column:  formatErr.Column,
+			}
+		}
+		return nil, err
+	}
+	return layer, nil
+}
+
 // ReadDir reads the configuration layers from the "layers" sub-directory in
 // dir, and returns the resulting Plan. If the "layers" sub-directory doesn't
 // exist, it returns a valid Plan with no layers.
@@ -1155,21 +3404,85 @@ func ReadDir(dir string) (*Plan, error) {
 	if err != nil {
 		return nil, err
 	}
+	return NewPlan(layers)
+}
+
+// SectionNames returns the YAML names of the plan's sections, such as
+// "services" and "checks", in the order they appear in the plan, followed
+// by the names of the registered extension sections.
+func SectionNames() []string {
+	return append(builtinSectionNames(), extensionSectionNames()...)
+}
+
+func builtinSectionNames() []string {
+	var names []string
+	planType := reflect.TypeOf(Plan{})
+	for i := 0; i < planType.NumField(); i++ {
+		name, _, _ := strings.Cut(planType.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Section returns the content of the plan section with the given YAML name,
+// which is a map of the section's items (or of the variables, for "vars"),
+// or nil if there's no section with that name.
+func (p *Plan) Section(name string) interface{} {
+	planValue := reflect.ValueOf(p).Elem()
+	planType := planValue.Type()
+	for i := 0; i < planType.NumField(); i++ {
+		fieldName, _, _ := strings.Cut(planType.Field(i).Tag.Get("yaml"), ",")
+		if fieldName == name && name != "-" {
+			return planValue.Field(i).Interface()
+		}
+	}
+	if _, ok := extensionSectionValidator(name); ok {
+		return sectionItems(p.Sections[name])
+	}
+	return nil
+}
+
+// NewPlan combines the given layers and returns the resulting Plan, after
+// checking that it's valid.
+func NewPlan(layers []*Layer) (*Plan, error) {
 	combined, err := CombineLayers(layers...)
 	if err != nil {
 		return nil, err
 	}
+	// Remove the excluded services and checks first, so that they can
+	// refer to variables that are only defined on some devices.
+	err = applyWhen(combined)
+	if err != nil {
+		return nil, err
+	}
+	err = expandPlanVars(combined)
+	if err != nil {
+		return nil, err
+	}
 	plan := &Plan{
-		Layers:     layers,
-		Services:   combined.Services,
-		Checks:     combined.Checks,
-		LogTargets: combined.LogTargets,
+		Layers:        layers,
+		Services:      combined.Services,
+		Checks:        combined.Checks,
+		LogTargets:    combined.LogTargets,
+		NoticeHooks:   combined.NoticeHooks,
+		Network:       combined.Network,
+		Mounts:        combined.Mounts,
+		KernelModules: combined.KernelModules,
+		Sysctls:       combined.Sysctls,
+		TimeServers:   combined.TimeServers,
+		Watchdogs:     combined.Watchdogs,
+		Devices:       combined.Devices,
+		Secrets:       combined.Secrets,
+		Vars:          combined.Vars,
+		Sections:      combined.Sections,
 	}
 	err = plan.Validate()
 	if err != nil {
 		return nil, err
 	}
-	return plan, err
+	return plan, nil
 }
 
 // MergeServiceContext merges the overrides on top of the service context
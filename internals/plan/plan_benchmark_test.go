@@ -0,0 +1,119 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// largeLayer returns the YAML for a layer with the given number of services
+// and checks, each service requiring the previous one.
+func largeLayer(layer, items int) string {
+	var sb strings.Builder
+	sb.WriteString("services:\n")
+	for i := 0; i < items; i++ {
+		fmt.Fprintf(&sb, "    svc-%d-%d:\n", layer, i)
+		sb.WriteString("        override: replace\n")
+		fmt.Fprintf(&sb, "        command: /usr/bin/server --id %d --port %d\n", i, 8000+i)
+		sb.WriteString("        startup: enabled\n")
+		if i > 0 {
+			fmt.Fprintf(&sb, "        requires: [svc-%d-%d]\n", layer, i-1)
+		}
+		sb.WriteString("        environment:\n")
+		fmt.Fprintf(&sb, "            INDEX: \"%d\"\n", i)
+	}
+	sb.WriteString("checks:\n")
+	for i := 0; i < items; i++ {
+		fmt.Fprintf(&sb, "    chk-%d-%d:\n", layer, i)
+		sb.WriteString("        override: replace\n")
+		sb.WriteString("        http:\n")
+		fmt.Fprintf(&sb, "            url: http://localhost:%d/health\n", 8000+i)
+	}
+	return sb.String()
+}
+
+func writeLargeLayers(b *testing.B, layers, items int) string {
+	pebbleDir := b.TempDir()
+	layersDir := filepath.Join(pebbleDir, "layers")
+	err := os.Mkdir(layersDir, 0755)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < layers; i++ {
+		name := fmt.Sprintf("%03d-layer-%d.yaml", i, i)
+		err := os.WriteFile(filepath.Join(layersDir, name), []byte(largeLayer(i, items)), 0644)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return pebbleDir
+}
+
+func BenchmarkReadDirSmall(b *testing.B) {
+	pebbleDir := writeLargeLayers(b, 3, 5)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := plan.ReadDir(pebbleDir)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadDirLarge(b *testing.B) {
+	pebbleDir := writeLargeLayers(b, 40, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := plan.ReadDir(pebbleDir)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseLayerLarge(b *testing.B) {
+	data := []byte(largeLayer(0, 100))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := plan.ParseLayer(1, "layer", data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCombineLayersLarge(b *testing.B) {
+	var layers []*plan.Layer
+	for i := 0; i < 40; i++ {
+		layer, err := plan.ParseLayer(i, fmt.Sprintf("layer-%d", i), []byte(largeLayer(i, 100)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		layers = append(layers, layer)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := plan.NewPlan(layers)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
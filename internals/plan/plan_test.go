@@ -515,6 +515,17 @@ var planTests = []planTest{{
 				command: cmd
 				backoff-factor: foo
 	`},
+}, {
+	summary: `Relative read-only path`,
+	error:   `plan service "svc1" read-only path "etc" must be absolute`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				isolation:
+					read-only-paths: [etc]
+	`},
 }, {
 	summary: `Invalid service command`,
 	error:   `plan service "svc1" command invalid: cannot parse service "svc1" command: EOF found when expecting closing quote`,
@@ -872,7 +883,7 @@ var planTests = []planTest{{
 	},
 }, {
 	summary: "One of http, tcp, or exec must be present for check",
-	error:   `plan must specify one of "http", "tcp", or "exec" for check "chk1"`,
+	error:   `plan must specify one of "http", "tcp", "exec", or "device" for check "chk1"`,
 	input: []string{`
 		checks:
 			chk1:
@@ -926,6 +937,313 @@ var planTests = []planTest{{
 					command: foo
 					service-context: nosvc
 	`},
+}, {
+	summary: `Invalid check on-recovery exec command`,
+	error:   `plan check "chk1" on-recovery exec command invalid: EOF found when expecting closing quote`,
+	input: []string{`
+		checks:
+			chk1:
+				override: replace
+				exec:
+					command: foo
+				on-recovery:
+					exec: bar '
+	`},
+}, {
+	summary: `Check on-recovery restarts non-existent service`,
+	error:   `plan check "chk1" on-recovery restarts non-existent service "nosvc"`,
+	input: []string{`
+		checks:
+			chk1:
+				override: replace
+				exec:
+					command: foo
+				on-recovery:
+					restart: [nosvc]
+	`},
+}, {
+	summary: `Invalid service stdin`,
+	error:   `plan service "svc1" stdin "tty" invalid \(must be "null" or "pipe"\)`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				stdin: tty
+	`},
+}, {
+	summary: `Invalid service kind`,
+	error:   `plan service "svc1" kind "vm" invalid \(must be "process" or "oci"\)`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				kind: vm
+	`},
+}, {
+	summary: `Image for a process service`,
+	error:   `plan service "svc1" can only have an image if its kind is "oci"`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				image: /images/foo
+	`},
+}, {
+	summary: `Relative OCI service image`,
+	error:   `plan service "svc1" image "images/foo" must be an absolute path`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				kind: oci
+				command: /bundles/foo
+				image: images/foo
+	`},
+}, {
+	summary: `OCI service command with arguments`,
+	error:   `plan service "svc1" command must be the absolute path of an OCI bundle directory`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				kind: oci
+				command: /bundles/foo --debug
+	`},
+}, {
+	summary: `OCI service with process options`,
+	error:   `plan service "svc1" of kind "oci" cannot set user, isolation \(set them in the bundle's config.json\)`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				kind: oci
+				command: /bundles/foo
+				user: nobody
+				isolation:
+					private-tmp: true
+	`},
+}, {
+	summary: `OCI service with invalid container name`,
+	error:   `plan service "svc 1" name invalid for an OCI service .*`,
+	input: []string{`
+		services:
+			svc 1:
+				override: replace
+				kind: oci
+				command: /bundles/foo
+	`},
+}, {
+	summary: `Relative service directory`,
+	error:   `plan service "svc1" directory "data" must be absolute`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				directories:
+					data: {}
+	`},
+}, {
+	summary: `Invalid service directory mode`,
+	error:   `plan service "svc1" directory "/data" invalid mode "0999"`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				directories:
+					/data:
+						mode: "0999"
+	`},
+}, {
+	summary: `Unknown service ulimit`,
+	error:   `plan service "svc1" ulimit "files" unknown`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				ulimits:
+					files: 1024
+	`},
+}, {
+	summary: `Invalid service ulimit value`,
+	error:   `cannot parse layer "layer-0": invalid ulimit "lots"`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				ulimits:
+					nofile: lots
+	`},
+}, {
+	summary: `Service ulimit soft limit above hard limit`,
+	error:   `plan service "svc1" ulimit "nofile" soft limit must not exceed hard limit`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				ulimits:
+					nofile: 4096:1024
+	`},
+}, {
+	summary: `Service secret without environment or file`,
+	error:   `plan service "svc1" secret "s1" must set "environment" or "file"`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				secrets:
+					s1: {}
+	`},
+}, {
+	summary: `Service secret with invalid environment variable name`,
+	error:   `plan service "svc1" secret "s1" has invalid environment variable name "A-B"`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				secrets:
+					s1:
+						environment: A-B
+	`},
+}, {
+	summary: `Service secret with relative file`,
+	error:   `plan service "svc1" secret "s1" file "run/s1" must be absolute`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				secrets:
+					s1:
+						file: run/s1
+	`},
+}, {
+	summary: `Service with unknown secret`,
+	error:   `plan service "svc1" specifies unknown secret "s1"`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				secrets:
+					s1:
+						environment: S1
+	`},
+}, {
+	summary: `Secret with invalid backend`,
+	error:   `plan secret "s1" has invalid backend "vault", must be "file", "env", "keyring", or "command"`,
+	input: []string{`
+		secrets:
+			s1:
+				override: replace
+				backend: vault
+	`},
+}, {
+	summary: `Secret without backend`,
+	error:   `plan must define "backend" for secret "s1"`,
+	input: []string{`
+		secrets:
+			s1:
+				override: replace
+				path: /run/s1
+	`},
+}, {
+	summary: `File secret without path`,
+	error:   `plan must define "path" for file secret "s1"`,
+	input: []string{`
+		secrets:
+			s1:
+				override: replace
+				backend: file
+	`},
+}, {
+	summary: `Command secret with blank command`,
+	error:   `plan must define "command" for command secret "s1"`,
+	input: []string{`
+		secrets:
+			s1:
+				override: replace
+				backend: command
+				command: "  "
+	`},
+}, {
+	summary: `Secret with relative path`,
+	error:   `plan secret "s1" path must be absolute`,
+	input: []string{`
+		secrets:
+			s1:
+				override: replace
+				backend: file
+				path: run/s1
+	`},
+}, {
+	summary: `Secret without override`,
+	error:   `layer "layer-0" must define "override" for secret "s1"`,
+	input: []string{`
+		secrets:
+			s1:
+				backend: env
+				variable: S1
+	`},
+}, {
+	summary: `Service restart-with non-existent service`,
+	error:   `plan service "svc1" restart-with specifies non-existent service "nosvc"`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				restart-with: [nosvc]
+	`},
+}, {
+	summary: `Service restart-with itself`,
+	error:   `plan service "svc1" cannot restart with itself`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				restart-with: [svc1]
+	`},
+}, {
+	summary: `Service requires-path must be absolute`,
+	error:   `plan service "svc1" requires-path "run/db.sock" must be absolute`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				requires-path: [run/db.sock]
+	`},
+}, {
+	summary: `Service requires-port out of range`,
+	error:   `plan service "svc1" requires-port "70000" invalid: port must be a number from 1 to 65535`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				requires-port: [70000]
+	`},
+}, {
+	summary: `Service requires-port without host`,
+	error:   `plan service "svc1" requires-port ":5432" invalid: host must not be empty`,
+	input: []string{`
+		services:
+			svc1:
+				override: replace
+				command: foo
+				requires-port: [":5432"]
+	`},
 }, {
 	summary: "Simple layer with log targets",
 	input: []string{`
@@ -1170,66 +1488,868 @@ var planTests = []planTest{{
 		},
 	},
 }, {
-	summary: "Log target requires type field",
-	error:   `plan must define "type" \("loki" or "syslog"\) for log target "tgt1"`,
+	summary: "Overriding notice hooks",
 	input: []string{`
-		log-targets:
-			tgt1:
-				location: http://10.1.77.196:3100/loki/api/v1/push
+		notice-hooks:
+			hook1:
+				override: merge
+				types: [custom]
+				keys: [example.com/a]
+				command: /bin/hook1
+				environment:
+					VAR1: foo
+			hook2:
 				override: merge
+				command: /bin/hook2 --old
+`, `
+		notice-hooks:
+			hook1:
+				override: merge
+				keys: [example.com/b]
+				environment:
+					VAR2: bar
+			hook2:
+				override: replace
+				types: [change-update]
+				command: /bin/hook2 --new
 `},
+	result: &plan.Layer{
+		Services:   map[string]*plan.Service{},
+		Checks:     map[string]*plan.Check{},
+		LogTargets: map[string]*plan.LogTarget{},
+		NoticeHooks: map[string]*plan.NoticeHook{
+			"hook1": {
+				Name:     "hook1",
+				Override: plan.MergeOverride,
+				Types:    []string{"custom"},
+				Keys:     []string{"example.com/a", "example.com/b"},
+				Command:  "/bin/hook1",
+				Environment: map[string]string{
+					"VAR1": "foo",
+					"VAR2": "bar",
+				},
+			},
+			"hook2": {
+				Name:     "hook2",
+				Override: plan.ReplaceOverride,
+				Types:    []string{"change-update"},
+				Command:  "/bin/hook2 --new",
+			},
+		},
+	},
 }, {
-	summary: "Log target location must be specified",
-	error:   `plan must define "location" for log target "tgt1"`,
+	summary: "Notice hook requires command field",
+	error:   `plan must define "command" for notice hook "hook1"`,
 	input: []string{`
-		log-targets:
-			tgt1:
-				type: loki
-				services: [all]
+		notice-hooks:
+			hook1:
 				override: merge
-`}}, {
-	summary: "Unsupported log target type",
-	error:   `log target "tgt1" has unsupported type "foobar", must be "loki" or "syslog"`,
+				types: [custom]
+`},
+}, {
+	summary: "Notice hook requires a non-blank command",
+	error:   `plan must define "command" for notice hook "hook1"`,
 	input: []string{`
-		log-targets:
-			tgt1:
-				type: foobar
-				location: http://10.1.77.196:3100/loki/api/v1/push
-				override: merge
+		notice-hooks:
+			hook1:
+				override: replace
+				types: [custom]
+				command: "  "
 `},
 }, {
-	summary: "Log target specifies invalid service",
-	error:   `log target "tgt1" specifies unknown service "nonexistent"`,
+	summary: "Notice hook requires override field",
+	error:   `layer "layer-0" must define "override" for notice hook "hook1"`,
 	input: []string{`
-		log-targets:
-			tgt1:
-				type: loki
-				location: http://10.1.77.196:3100/loki/api/v1/push
-				services: [nonexistent]
-				override: merge
+		notice-hooks:
+			hook1:
+				command: /bin/hook1
 `},
 }, {
-	summary: `Service name can't start with "-"`,
-	error:   `cannot use service name "-svc1": starting with "-" not allowed`,
+	summary: "Invalid notice hook command",
+	error:   `plan notice hook "hook1" command invalid: EOF found when expecting closing quote`,
 	input: []string{`
-		services:
-			-svc1:
-				command: foo
+		notice-hooks:
+			hook1:
 				override: merge
+				command: foo '
 `},
 }, {
-	summary: "Log forwarding labels override",
+	summary: "Overriding network interfaces",
 	input: []string{`
-		log-targets:
-			tgt1:
-				override: merge
-				type: loki
-				location: https://my.loki.server/loki/api/v1/push
-				labels:
-					label1: foo11
-					label2: foo12
-			tgt2:
-				override: merge
+		network:
+			ethernets:
+				eth0:
+					override: merge
+					addresses:
+						- 192.168.1.10/24
+					routes:
+						- to: default
+						  via: 192.168.1.1
+					nameservers:
+						addresses: [192.168.1.1]
+			wifis:
+				wlan0:
+					override: merge
+					addresses:
+						- 10.0.0.2/8
+					access-points:
+						home:
+							password: correct-horse
+						office:
+							password: battery-staple
+`, `
+		network:
+			ethernets:
+				eth0:
+					override: merge
+					addresses:
+						- fd00::10/64
+					routes:
+						- to: fd01::/64
+						  via: fd00::1
+						  metric: 100
+					nameservers:
+						search: [example.com]
+			wifis:
+				wlan0:
+					override: merge
+					access-points:
+						office:
+							password: new-password
+						cafe:
+							hidden: true
+`},
+	result: &plan.Layer{
+		Services:   map[string]*plan.Service{},
+		Checks:     map[string]*plan.Check{},
+		LogTargets: map[string]*plan.LogTarget{},
+		Network: &plan.Network{
+			Ethernets: map[string]*plan.NetworkInterface{
+				"eth0": {
+					Name:      "eth0",
+					Override:  plan.MergeOverride,
+					Addresses: []string{"192.168.1.10/24", "fd00::10/64"},
+					Routes: []plan.NetworkRoute{
+						{To: "default", Via: "192.168.1.1"},
+						{To: "fd01::/64", Via: "fd00::1", Metric: 100},
+					},
+					Nameservers: plan.Nameservers{
+						Addresses: []string{"192.168.1.1"},
+						Search:    []string{"example.com"},
+					},
+				},
+			},
+			Wifis: map[string]*plan.NetworkInterface{
+				"wlan0": {
+					Name:      "wlan0",
+					Override:  plan.MergeOverride,
+					Addresses: []string{"10.0.0.2/8"},
+					AccessPoints: map[string]*plan.AccessPoint{
+						"home":   {Password: "correct-horse"},
+						"office": {Password: "new-password"},
+						"cafe":   {Hidden: true},
+					},
+				},
+			},
+		},
+	},
+}, {
+	summary: "Invalid network interface name",
+	error:   `invalid network interface name "eth0/../x"`,
+	input: []string{`
+		network:
+			ethernets:
+				eth0/../x:
+					override: merge
+`},
+}, {
+	summary: "Invalid network interface address",
+	error:   `plan network interface "eth0" has invalid address "192.168.1.10" \(must be an address with a prefix length\)`,
+	input: []string{`
+		network:
+			ethernets:
+				eth0:
+					override: merge
+					addresses: [192.168.1.10]
+`},
+}, {
+	summary: "Default route requires gateway",
+	error:   `plan network interface "eth0" has invalid route to "default": default route must define a valid "via" address`,
+	input: []string{`
+		network:
+			ethernets:
+				eth0:
+					override: merge
+					routes:
+						- to: default
+`},
+}, {
+	summary: "Route gateway must match destination family",
+	error:   `plan network interface "eth0" has invalid route to "10.0.0.0/8": "via" address "fd00::1" is of a different family`,
+	input: []string{`
+		network:
+			ethernets:
+				eth0:
+					override: merge
+					routes:
+						- to: 10.0.0.0/8
+						  via: fd00::1
+`},
+}, {
+	summary: "Access points are only valid for wifis",
+	error:   `plan network interface "eth0" cannot define "access-points" \(only valid for wifis\)`,
+	input: []string{`
+		network:
+			ethernets:
+				eth0:
+					override: merge
+					access-points:
+						home: {}
+`},
+}, {
+	summary: "Invalid access point password",
+	error:   `plan network interface "wlan0" has invalid password for access point "home" \(must be 8 to 63 printable ASCII characters\)`,
+	input: []string{`
+		network:
+			wifis:
+				wlan0:
+					override: merge
+					access-points:
+						home:
+							password: short
+`},
+}, {
+	summary: "Wifi requires access points",
+	error:   `plan must define "access-points" for wifi "wlan0"`,
+	input: []string{`
+		network:
+			wifis:
+				wlan0:
+					override: merge
+					addresses: [10.0.0.2/8]
+`},
+}, {
+	summary: "Interface can't be both an ethernet and a wifi",
+	error:   `plan network interface "eth0" defined as both an ethernet and a wifi`,
+	input: []string{`
+		network:
+			ethernets:
+				eth0:
+					override: merge
+`, `
+		network:
+			wifis:
+				eth0:
+					override: merge
+					access-points:
+						home: {}
+`},
+}, {
+	summary: "Overriding mounts",
+	input: []string{`
+		mounts:
+			data:
+				override: merge
+				source: /dev/sdb1
+				target: /data
+				type: ext4
+				options: [noatime]
+			cache:
+				override: merge
+				source: tmpfs
+				target: /data/cache
+				type: tmpfs
+`, `
+		mounts:
+			data:
+				override: merge
+				options: [ro]
+			cache:
+				override: replace
+				source: /srv/cache
+				target: /data/cache
+				options: [bind]
+`},
+	result: &plan.Layer{
+		Services:   map[string]*plan.Service{},
+		Checks:     map[string]*plan.Check{},
+		LogTargets: map[string]*plan.LogTarget{},
+		Mounts: map[string]*plan.Mount{
+			"data": {
+				Name:     "data",
+				Override: plan.MergeOverride,
+				Source:   "/dev/sdb1",
+				Target:   "/data",
+				Type:     "ext4",
+				Options:  []string{"noatime", "ro"},
+			},
+			"cache": {
+				Name:     "cache",
+				Override: plan.ReplaceOverride,
+				Source:   "/srv/cache",
+				Target:   "/data/cache",
+				Options:  []string{"bind"},
+			},
+		},
+	},
+}, {
+	summary: "Mount requires type unless bind mount",
+	error:   `plan must define "type" for mount "data" \(unless it is a bind mount\)`,
+	input: []string{`
+		mounts:
+			data:
+				override: merge
+				source: /dev/sdb1
+				target: /data
+`},
+}, {
+	summary: "Mount target must be absolute",
+	error:   `plan mount "data" target must be an absolute path`,
+	input: []string{`
+		mounts:
+			data:
+				override: merge
+				source: /dev/sdb1
+				target: data
+				type: ext4
+`},
+}, {
+	summary: "Mounts cannot share a target",
+	error:   `plan mounts "a" and "b" have the same target "/data"`,
+	input: []string{`
+		mounts:
+			a:
+				override: merge
+				source: /dev/sdb1
+				target: /data
+				type: ext4
+			b:
+				override: merge
+				source: /dev/sdc1
+				target: /data/
+				type: ext4
+`},
+}, {
+	summary: "Overriding kernel modules",
+	input: []string{`
+		kernel-modules:
+			i2c-dev:
+				override: merge
+				parameters:
+					debug: "1"
+			wireguard:
+				override: merge
+				parameters:
+					foo: bar
+`, `
+		kernel-modules:
+			i2c-dev:
+				override: merge
+				parameters:
+					bus: "2"
+			wireguard:
+				override: replace
+`},
+	result: &plan.Layer{
+		Services:   map[string]*plan.Service{},
+		Checks:     map[string]*plan.Check{},
+		LogTargets: map[string]*plan.LogTarget{},
+		KernelModules: map[string]*plan.KernelModule{
+			"i2c-dev": {
+				Name:     "i2c-dev",
+				Override: plan.MergeOverride,
+				Parameters: map[string]string{
+					"debug": "1",
+					"bus":   "2",
+				},
+			},
+			"wireguard": {
+				Name:     "wireguard",
+				Override: plan.ReplaceOverride,
+			},
+		},
+	},
+}, {
+	summary: "Invalid kernel module name",
+	error:   `invalid kernel module name "../foo"`,
+	input: []string{`
+		kernel-modules:
+			../foo:
+				override: merge
+`},
+}, {
+	summary: "Invalid kernel module parameter value",
+	error:   `plan kernel module "foo" parameter "bar" value cannot contain whitespace`,
+	input: []string{`
+		kernel-modules:
+			foo:
+				override: merge
+				parameters:
+					bar: x y
+`},
+}, {
+	summary: "Overriding sysctls",
+	input: []string{`
+		sysctls:
+			net.ipv4.ip_forward:
+				override: merge
+				value: "0"
+			vm.swappiness:
+				override: merge
+				value: "60"
+`, `
+		sysctls:
+			net.ipv4.ip_forward:
+				override: merge
+				value: "1"
+			net/ipv4/conf/eth0.100/rp_filter:
+				override: replace
+				value: "2"
+`},
+	result: &plan.Layer{
+		Services:   map[string]*plan.Service{},
+		Checks:     map[string]*plan.Check{},
+		LogTargets: map[string]*plan.LogTarget{},
+		Sysctls: map[string]*plan.Sysctl{
+			"net.ipv4.ip_forward": {
+				Name:     "net.ipv4.ip_forward",
+				Override: plan.MergeOverride,
+				Value:    "1",
+			},
+			"vm.swappiness": {
+				Name:     "vm.swappiness",
+				Override: plan.MergeOverride,
+				Value:    "60",
+			},
+			"net/ipv4/conf/eth0.100/rp_filter": {
+				Name:     "net/ipv4/conf/eth0.100/rp_filter",
+				Override: plan.ReplaceOverride,
+				Value:    "2",
+			},
+		},
+	},
+}, {
+	summary: "Sysctl requires value",
+	error:   `plan must define "value" for sysctl "vm.swappiness"`,
+	input: []string{`
+		sysctls:
+			vm.swappiness:
+				override: merge
+`},
+}, {
+	summary: "Invalid sysctl name",
+	error:   `invalid sysctl name "net/../../etc/passwd"`,
+	input: []string{`
+		sysctls:
+			net/../../etc/passwd:
+				override: merge
+				value: "1"
+`},
+}, {
+	summary: "Overriding time servers",
+	input: []string{`
+		time-servers:
+			pool:
+				override: merge
+				address: pool.ntp.org
+			local:
+				override: merge
+				address: 10.0.0.1:123
+				poll-interval: 1m
+`, `
+		time-servers:
+			pool:
+				override: merge
+				poll-interval: 1h
+			local:
+				override: replace
+				address: 10.0.0.2
+`},
+	result: &plan.Layer{
+		Services:   map[string]*plan.Service{},
+		Checks:     map[string]*plan.Check{},
+		LogTargets: map[string]*plan.LogTarget{},
+		TimeServers: map[string]*plan.TimeServer{
+			"pool": {
+				Name:         "pool",
+				Override:     plan.MergeOverride,
+				Address:      "pool.ntp.org",
+				PollInterval: plan.OptionalDuration{Value: time.Hour, IsSet: true},
+			},
+			"local": {
+				Name:         "local",
+				Override:     plan.ReplaceOverride,
+				Address:      "10.0.0.2",
+				PollInterval: plan.OptionalDuration{Value: 15 * time.Minute},
+			},
+		},
+	},
+}, {
+	summary: "Time server requires address",
+	error:   `plan must define "address" for time server "pool"`,
+	input: []string{`
+		time-servers:
+			pool:
+				override: merge
+				poll-interval: 1h
+`},
+}, {
+	summary: "Time server poll-interval too short",
+	error:   `plan time server "pool" poll-interval must be 16s or greater`,
+	input: []string{`
+		time-servers:
+			pool:
+				override: merge
+				address: pool.ntp.org
+				poll-interval: 1s
+`},
+}, {
+	summary: "Overriding watchdogs",
+	input: []string{`
+		services:
+			srv1:
+				override: replace
+				command: cmd
+		checks:
+			chk1:
+				override: replace
+				exec:
+					command: true
+		watchdogs:
+			hw:
+				override: merge
+				checks: [chk1]
+			other:
+				override: merge
+				device: /dev/watchdog1
+				interval: 5s
+				on-stop: fire
+`, `
+		watchdogs:
+			hw:
+				override: merge
+				services: [srv1]
+				interval: 1s
+			other:
+				override: replace
+				device: /dev/watchdog2
+`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"srv1": {
+				Name:          "srv1",
+				Override:      plan.ReplaceOverride,
+				Command:       "cmd",
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+		Checks: map[string]*plan.Check{
+			"chk1": {
+				Name:      "chk1",
+				Override:  plan.ReplaceOverride,
+				Period:    plan.OptionalDuration{Value: defaultCheckPeriod},
+				Timeout:   plan.OptionalDuration{Value: defaultCheckTimeout},
+				Threshold: defaultCheckThreshold,
+				Exec:      &plan.ExecCheck{Command: "true"},
+			},
+		},
+		LogTargets: map[string]*plan.LogTarget{},
+		Watchdogs: map[string]*plan.Watchdog{
+			"hw": {
+				Name:     "hw",
+				Override: plan.MergeOverride,
+				Device:   "/dev/watchdog",
+				Interval: plan.OptionalDuration{Value: time.Second, IsSet: true},
+				Checks:   []string{"chk1"},
+				Services: []string{"srv1"},
+				OnStop:   plan.WatchdogClose,
+			},
+			"other": {
+				Name:     "other",
+				Override: plan.ReplaceOverride,
+				Device:   "/dev/watchdog2",
+				Interval: plan.OptionalDuration{Value: 10 * time.Second},
+				OnStop:   plan.WatchdogClose,
+			},
+		},
+	},
+}, {
+	summary: "Watchdog with unknown check",
+	error:   `watchdog "hw" specifies unknown check "chk1"`,
+	input: []string{`
+		watchdogs:
+			hw:
+				override: merge
+				checks: [chk1]
+`},
+}, {
+	summary: "Watchdog with unknown service",
+	error:   `watchdog "hw" specifies unknown service "srv1"`,
+	input: []string{`
+		watchdogs:
+			hw:
+				override: merge
+				services: [srv1]
+`},
+}, {
+	summary: "Invalid watchdog on-stop action",
+	error:   `plan watchdog "hw" on-stop must be "close" or "fire"`,
+	input: []string{`
+		watchdogs:
+			hw:
+				override: merge
+				on-stop: reboot
+`},
+}, {
+	summary: "Watchdogs cannot share a device",
+	error:   `plan watchdogs "a" and "b" use the same device "/dev/watchdog"`,
+	input: []string{`
+		watchdogs:
+			a:
+				override: merge
+			b:
+				override: merge
+				device: /dev/watchdog
+`},
+}, {
+	summary: "Overriding devices",
+	input: []string{`
+		services:
+			srv1:
+				override: replace
+				command: cmd
+				requires-device: [modem]
+		checks:
+			chk1:
+				override: replace
+				device:
+					name: modem
+		devices:
+			modem:
+				override: merge
+				path: /dev/ttyUSB0
+			gpu:
+				override: merge
+				subsystem: drm
+`, `
+		devices:
+			modem:
+				override: merge
+				path: /dev/serial/by-id/usb-modem
+				subsystem: tty
+			gpu:
+				override: replace
+				path: /dev/dri/card0
+`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"srv1": {
+				Name:           "srv1",
+				Override:       plan.ReplaceOverride,
+				Command:        "cmd",
+				RequiresDevice: []string{"modem"},
+				BackoffDelay:   plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor:  plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:   plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+		Checks: map[string]*plan.Check{
+			"chk1": {
+				Name:      "chk1",
+				Override:  plan.ReplaceOverride,
+				Period:    plan.OptionalDuration{Value: defaultCheckPeriod},
+				Timeout:   plan.OptionalDuration{Value: defaultCheckTimeout},
+				Threshold: defaultCheckThreshold,
+				Device:    &plan.DeviceCheck{Name: "modem"},
+			},
+		},
+		LogTargets: map[string]*plan.LogTarget{},
+		Devices: map[string]*plan.Device{
+			"modem": {
+				Name:      "modem",
+				Override:  plan.MergeOverride,
+				Path:      "/dev/serial/by-id/usb-modem",
+				Subsystem: "tty",
+			},
+			"gpu": {
+				Name:     "gpu",
+				Override: plan.ReplaceOverride,
+				Path:     "/dev/dri/card0",
+			},
+		},
+	},
+}, {
+	summary: "Device path must be absolute",
+	error:   `plan device "modem" path must be absolute`,
+	input: []string{`
+		devices:
+			modem:
+				override: merge
+				path: ttyUSB0
+`},
+}, {
+	summary: "Invalid device subsystem",
+	error:   `plan device "modem" has invalid subsystem "../tty"`,
+	input: []string{`
+		devices:
+			modem:
+				override: merge
+				subsystem: ../tty
+`},
+}, {
+	summary: "Device without path or subsystem",
+	error:   `plan must set "path" or "subsystem" for device "modem"`,
+	input: []string{`
+		devices:
+			modem:
+				override: merge
+`},
+}, {
+	summary: "Device without override",
+	error:   `layer "layer-0" must define "override" for device "modem"`,
+	input: []string{`
+		devices:
+			modem:
+				path: /dev/ttyUSB0
+`},
+}, {
+	summary: "Service requires unknown device",
+	error:   `plan service "srv1" requires-device specifies non-existent device "modem"`,
+	input: []string{`
+		services:
+			srv1:
+				override: replace
+				command: cmd
+				requires-device: [modem]
+`},
+}, {
+	summary: "Device check with unknown device",
+	error:   `plan check "chk1" specifies non-existent device "modem"`,
+	input: []string{`
+		checks:
+			chk1:
+				override: replace
+				device:
+					name: modem
+`},
+}, {
+	summary: "Device check without name",
+	error:   `plan must set "name" for device check "chk1"`,
+	input: []string{`
+		checks:
+			chk1:
+				override: replace
+				device: {}
+`},
+}, {
+	summary: "Unknown service field",
+	error:   `cannot parse layer "layer-0": yaml: unmarshal errors:\n  line 4: field commnd not found in type plan.Service`,
+	input: []string{`
+		services:
+			srv1:
+				override: replace
+				commnd: foo
+`},
+}, {
+	summary: "Unknown check field",
+	error:   `(?s)cannot parse layer "layer-0": .*line 5: field urll not found in type plan.HTTPCheck`,
+	input: []string{`
+		checks:
+			chk1:
+				override: replace
+				http:
+					urll: http://localhost/
+`},
+}, {
+	summary: "Unknown log target field",
+	error:   `(?s)cannot parse layer "layer-0": .*line 4: field tpye not found in type plan.LogTarget`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: replace
+				tpye: loki
+`},
+}, {
+	summary: "Log target requires type field",
+	error:   `plan must define "type" \("loki" or "syslog"\) for log target "tgt1"`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				location: http://10.1.77.196:3100/loki/api/v1/push
+				override: merge
+`},
+}, {
+	summary: "Log target location must be specified",
+	error:   `plan must define "location" for log target "tgt1"`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				type: loki
+				services: [all]
+				override: merge
+`}}, {
+	summary: "Unsupported log target type",
+	error:   `log target "tgt1" has unsupported type "foobar", must be "loki" or "syslog"`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				type: foobar
+				location: http://10.1.77.196:3100/loki/api/v1/push
+				override: merge
+`},
+}, {
+	summary: "Log target specifies invalid service",
+	error:   `log target "tgt1" specifies unknown service "nonexistent"`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				type: loki
+				location: http://10.1.77.196:3100/loki/api/v1/push
+				services: [nonexistent]
+				override: merge
+`},
+}, {
+	summary: `Service name can't start with "-"`,
+	error:   `cannot use service name "-svc1": starting with "-" not allowed`,
+	input: []string{`
+		services:
+			-svc1:
+				command: foo
+				override: merge
+`},
+}, {
+	summary: `Service name can't contain "/"`,
+	error:   `cannot use service name "../svc1": must not contain "/" or be "." or ".."`,
+	input: []string{`
+		services:
+			../svc1:
+				command: foo
+				override: merge
+`},
+}, {
+	summary: `Service name can't be ".."`,
+	error:   `cannot use service name "..": must not contain "/" or be "." or ".."`,
+	input: []string{`
+		services:
+			"..":
+				command: foo
+				override: merge
+`},
+}, {
+	summary: "Log forwarding labels override",
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				labels:
+					label1: foo11
+					label2: foo12
+			tgt2:
+				override: merge
 				type: loki
 				location: https://my.loki.server/loki/api/v1/push
 				labels:
@@ -1308,40 +2428,221 @@ var planTests = []planTest{{
 		Checks:   map[string]*plan.Check{},
 		LogTargets: map[string]*plan.LogTarget{
 			"tgt1": {
-				Name:     "tgt1",
-				Override: plan.MergeOverride,
-				Type:     plan.LokiTarget,
-				Location: "https://my.loki.server/loki/api/v1/push",
-				Labels: map[string]string{
-					"label1": "foo11",
-					"label2": "bar12",
-					"label3": "bar13",
-				},
-			},
-			"tgt2": {
-				Name:     "tgt2",
-				Override: plan.ReplaceOverride,
-				Type:     plan.LokiTarget,
-				Location: "https://new.loki.server/loki/api/v1/push",
-				Labels: map[string]string{
-					"label2": "bar22",
-					"label3": "bar23",
-				},
+				Name:     "tgt1",
+				Override: plan.MergeOverride,
+				Type:     plan.LokiTarget,
+				Location: "https://my.loki.server/loki/api/v1/push",
+				Labels: map[string]string{
+					"label1": "foo11",
+					"label2": "bar12",
+					"label3": "bar13",
+				},
+			},
+			"tgt2": {
+				Name:     "tgt2",
+				Override: plan.ReplaceOverride,
+				Type:     plan.LokiTarget,
+				Location: "https://new.loki.server/loki/api/v1/push",
+				Labels: map[string]string{
+					"label2": "bar22",
+					"label3": "bar23",
+				},
+			},
+		},
+	},
+}, {
+	summary: "Reserved log target labels",
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				labels:
+					pebble_service: illegal
+`},
+	error: `log target "tgt1": label "pebble_service" uses reserved prefix "pebble_"`,
+}, {
+	summary: "Log target tenant and auth merge",
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				tenant-id: tenant1
+				auth:
+					basic:
+						user: user1
+						password-file: /etc/loki/password
+	`, `
+		log-targets:
+			tgt1:
+				override: merge
+				auth:
+					bearer:
+						token-file: /etc/loki/token
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{},
+		Checks:   map[string]*plan.Check{},
+		LogTargets: map[string]*plan.LogTarget{
+			"tgt1": {
+				Name:     "tgt1",
+				Type:     plan.LokiTarget,
+				Location: "https://my.loki.server/loki/api/v1/push",
+				Override: plan.MergeOverride,
+				TenantID: "tenant1",
+				Auth: &plan.LogTargetAuth{
+					Bearer: &plan.LogTargetBearerAuth{TokenFile: "/etc/loki/token"},
+				},
+			},
+		},
+	},
+}, {
+	summary: "Log target auth with both methods",
+	error:   `log target "tgt1" auth must specify only one of "basic" or "bearer"`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				auth:
+					basic:
+						user: user1
+						password-file: /etc/loki/password
+					bearer:
+						token-file: /etc/loki/token
+	`},
+}, {
+	summary: "Log target auth without a method",
+	error:   `log target "tgt1" auth must specify "basic" or "bearer"`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				auth: {}
+	`},
+}, {
+	summary: "Log target basic auth without password file",
+	error:   `log target "tgt1" basic auth must define "user" and "password-file"`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				auth:
+					basic:
+						user: user1
+	`},
+}, {
+	summary: "Log target bearer auth with relative token file",
+	error:   `log target "tgt1" token-file must be an absolute path`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				auth:
+					bearer:
+						token-file: token
+	`},
+}, {
+	summary: "Log target tenant ID for syslog target",
+	error:   `log target "tgt1": "tenant-id" and "auth" are only supported for "loki" targets`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: syslog
+				location: udp://10.1.77.196:514
+				tenant-id: tenant1
+	`},
+}, {
+	summary: "Log target buffering and batch tuning merge",
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				buffer-size: 1000
+				flush-interval: 5s
+	`, `
+		log-targets:
+			tgt1:
+				override: merge
+				batch-size: 500
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{},
+		Checks:   map[string]*plan.Check{},
+		LogTargets: map[string]*plan.LogTarget{
+			"tgt1": {
+				Name:          "tgt1",
+				Type:          plan.LokiTarget,
+				Location:      "https://my.loki.server/loki/api/v1/push",
+				Override:      plan.MergeOverride,
+				BufferSize:    1000,
+				BatchSize:     500,
+				FlushInterval: plan.OptionalDuration{Value: 5 * time.Second, IsSet: true},
 			},
 		},
 	},
 }, {
-	summary: "Reserved log target labels",
+	summary: "Log target buffer size too large",
+	error:   `log target "tgt1" buffer-size must be between 1 and 100000`,
 	input: []string{`
 		log-targets:
 			tgt1:
 				override: merge
 				type: loki
 				location: https://my.loki.server/loki/api/v1/push
-				labels:
-					pebble_service: illegal
-`},
-	error: `log target "tgt1": label "pebble_service" uses reserved prefix "pebble_"`,
+				buffer-size: 100001
+	`},
+}, {
+	summary: "Log target negative batch size",
+	error:   `log target "tgt1" batch-size must be 1 or greater`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				batch-size: -1
+	`},
+}, {
+	summary: "Log target flush interval too short",
+	error:   `log target "tgt1" flush-interval must be between 10ms and 10m0s`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				flush-interval: 1ms
+	`},
+}, {
+	summary: "Log target batch size greater than buffer size",
+	error:   `log target "tgt1" batch-size \(200\) must not be greater than buffer-size \(100\)`,
+	input: []string{`
+		log-targets:
+			tgt1:
+				override: merge
+				type: loki
+				location: https://my.loki.server/loki/api/v1/push
+				buffer-size: 100
+	`, `
+		log-targets:
+			tgt1:
+				override: merge
+				batch-size: 200
+	`},
 }, {
 	summary: "Required field two layers deep",
 	input: []string{`
@@ -1402,6 +2703,299 @@ var planTests = []planTest{{
 	error: `plan must define "command" for service "srv1"`,
 }}
 
+func (s *S) TestServiceIsolationMerge(c *C) {
+	layer1, err := plan.ParseLayer(0, "layer-0", reindent(`
+		services:
+			svc1:
+				override: replace
+				command: cmd
+				isolation:
+					private-tmp: true
+					read-only-paths: [/etc]
+	`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(1, "layer-1", reindent(`
+		services:
+			svc1:
+				override: merge
+				isolation:
+					read-only-paths: [/usr]
+					private-network: true
+	`))
+	c.Assert(err, IsNil)
+
+	combined, err := plan.CombineLayers(layer1, layer2)
+	c.Assert(err, IsNil)
+	c.Check(combined.Services["svc1"].Isolation, DeepEquals, &plan.ServiceIsolation{
+		PrivateTmp:     true,
+		ReadOnlyPaths:  []string{"/etc", "/usr"},
+		PrivateNetwork: true,
+	})
+	// Merging doesn't modify the layers.
+	c.Check(layer1.Services["svc1"].Isolation.ReadOnlyPaths, DeepEquals, []string{"/etc"})
+}
+
+func (s *S) TestServiceDirectories(c *C) {
+	layer1, err := plan.ParseLayer(0, "layer-0", reindent(`
+		services:
+			svc1:
+				override: replace
+				command: cmd
+				directories:
+					/var/lib/svc1:
+						user: nobody
+						mode: 0700
+					/run/svc1:
+	`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(1, "layer-1", reindent(`
+		services:
+			svc1:
+				override: merge
+				directories:
+					/var/lib/svc1:
+						mode: "0750"
+					/var/cache/svc1: {}
+	`))
+	c.Assert(err, IsNil)
+
+	combined, err := plan.CombineLayers(layer1, layer2)
+	c.Assert(err, IsNil)
+	dirs := combined.Services["svc1"].Directories
+	c.Assert(dirs, HasLen, 3)
+	c.Check(dirs["/var/lib/svc1"], DeepEquals, &plan.ServiceDirectory{Mode: "0750"})
+	c.Check(dirs["/var/cache/svc1"], DeepEquals, &plan.ServiceDirectory{})
+	c.Check(dirs["/run/svc1"], IsNil)
+	// Merging doesn't modify the layers.
+	c.Check(layer1.Services["svc1"].Directories["/var/lib/svc1"], DeepEquals, &plan.ServiceDirectory{User: "nobody", Mode: "0700"})
+
+	mode, err := dirs["/var/lib/svc1"].ParseMode()
+	c.Assert(err, IsNil)
+	c.Check(mode, Equals, os.FileMode(0o750))
+	mode, err = dirs["/var/cache/svc1"].ParseMode()
+	c.Assert(err, IsNil)
+	c.Check(mode, Equals, os.FileMode(0o755))
+	mode, err = (&plan.ServiceDirectory{Mode: "1777"}).ParseMode()
+	c.Assert(err, IsNil)
+	c.Check(mode, Equals, os.ModeSticky|0o777)
+}
+
+func (s *S) TestServiceUlimits(c *C) {
+	layer1, err := plan.ParseLayer(0, "layer-0", reindent(`
+		services:
+			svc1:
+				override: replace
+				command: cmd
+				ulimits:
+					nofile: 1024:4096
+					core: unlimited
+	`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(1, "layer-1", reindent(`
+		services:
+			svc1:
+				override: merge
+				ulimits:
+					nofile: 65536
+					memlock: 0:unlimited
+	`))
+	c.Assert(err, IsNil)
+
+	combined, err := plan.CombineLayers(layer1, layer2)
+	c.Assert(err, IsNil)
+	c.Check(combined.Services["svc1"].Ulimits, DeepEquals, map[string]plan.Ulimit{
+		"nofile":  {Soft: 65536, Hard: 65536},
+		"core":    {Soft: plan.UlimitUnlimited, Hard: plan.UlimitUnlimited},
+		"memlock": {Soft: 0, Hard: plan.UlimitUnlimited},
+	})
+	// Merging doesn't modify the layers.
+	c.Check(layer1.Services["svc1"].Ulimits["nofile"], Equals, plan.Ulimit{Soft: 1024, Hard: 4096})
+
+	// Limits round-trip through YAML.
+	data, err := yaml.Marshal(combined.Services["svc1"].Ulimits)
+	c.Assert(err, IsNil)
+	var ulimits map[string]plan.Ulimit
+	err = yaml.Unmarshal(data, &ulimits)
+	c.Assert(err, IsNil)
+	c.Check(ulimits, DeepEquals, combined.Services["svc1"].Ulimits)
+}
+
+func (s *S) TestSecrets(c *C) {
+	layer1, err := plan.ParseLayer(0, "layer-0", reindent(`
+		secrets:
+			db:
+				override: replace
+				backend: file
+				path: /run/secrets/db
+			token:
+				override: replace
+				backend: env
+				variable: TOKEN
+		services:
+			svc1:
+				override: replace
+				command: cmd
+				secrets:
+					db:
+						environment: DB_PASSWORD
+	`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(1, "layer-1", reindent(`
+		secrets:
+			db:
+				override: merge
+				backend: command
+				command: fetch-secret db
+		services:
+			svc1:
+				override: merge
+				secrets:
+					token:
+						file: /run/svc1/token
+	`))
+	c.Assert(err, IsNil)
+
+	p, err := plan.NewPlan([]*plan.Layer{layer1, layer2})
+	c.Assert(err, IsNil)
+	c.Check(p.Secrets, DeepEquals, map[string]*plan.Secret{
+		"db": {
+			Name:     "db",
+			Override: plan.ReplaceOverride,
+			Backend:  plan.CommandSecretBackend,
+			Path:     "/run/secrets/db",
+			Command:  "fetch-secret db",
+		},
+		"token": {
+			Name:     "token",
+			Override: plan.ReplaceOverride,
+			Backend:  plan.EnvSecretBackend,
+			Variable: "TOKEN",
+		},
+	})
+	c.Check(p.Services["svc1"].Secrets, DeepEquals, map[string]*plan.ServiceSecret{
+		"db":    {Environment: "DB_PASSWORD"},
+		"token": {File: "/run/svc1/token"},
+	})
+	// Merging doesn't modify the layers.
+	c.Check(layer1.Secrets["db"].Backend, Equals, plan.FileSecretBackend)
+	c.Check(layer1.Services["svc1"].Secrets, HasLen, 1)
+}
+
+func (s *S) TestCheckOnRecoveryMerge(c *C) {
+	layer1, err := plan.ParseLayer(0, "layer-0", reindent(`
+		services:
+			svc1:
+				override: replace
+				command: cmd
+			svc2:
+				override: replace
+				command: cmd
+		checks:
+			chk1:
+				override: replace
+				exec:
+					command: foo
+				on-recovery:
+					exec: notify-ops chk1
+					restart: [svc1]
+	`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(1, "layer-1", reindent(`
+		checks:
+			chk1:
+				override: merge
+				on-recovery:
+					notice: true
+					restart: [svc2]
+	`))
+	c.Assert(err, IsNil)
+
+	combined, err := plan.CombineLayers(layer1, layer2)
+	c.Assert(err, IsNil)
+	c.Check(combined.Checks["chk1"].OnRecovery, DeepEquals, &plan.CheckRecovery{
+		Notice:  true,
+		Exec:    "notify-ops chk1",
+		Restart: []string{"svc1", "svc2"},
+	})
+	// Merging doesn't modify the layers.
+	c.Check(layer1.Checks["chk1"].OnRecovery.Restart, DeepEquals, []string{"svc1"})
+}
+
+func (s *S) TestRestartWith(c *C) {
+	layer, err := plan.ParseLayer(0, "layer-0", reindent(`
+		services:
+			db:
+				override: replace
+				command: cmd
+			api:
+				override: replace
+				command: cmd
+				restart-with: [db]
+			worker:
+				override: replace
+				command: cmd
+				restart-with: [api, db]
+			web:
+				override: replace
+				command: cmd
+				restart-with: [api]
+			other:
+				override: replace
+				command: cmd
+	`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	p := plan.Plan{Services: combined.Services}
+
+	c.Check(p.RestartWith([]string{"db"}), DeepEquals, []string{"api", "web", "worker"})
+	c.Check(p.RestartWith([]string{"api"}), DeepEquals, []string{"web", "worker"})
+	c.Check(p.RestartWith([]string{"api", "web"}), DeepEquals, []string{"worker"})
+	c.Check(p.RestartWith([]string{"other"}), HasLen, 0)
+}
+
+func (s *S) TestRequiresPreconditions(c *C) {
+	layer1, err := plan.ParseLayer(0, "layer-0", reindent(`
+		services:
+			api:
+				override: replace
+				command: cmd
+				requires-path: [/run/db.sock]
+				requires-port: [5432]
+	`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(1, "layer-1", reindent(`
+		services:
+			api:
+				override: merge
+				requires-path: [/dev/ttyUSB0]
+				requires-port: ["cache:6379"]
+				requires-timeout: 1m
+	`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer1, layer2)
+	c.Assert(err, IsNil)
+
+	api := combined.Services["api"]
+	c.Check(api.RequiresPath, DeepEquals, []string{"/run/db.sock", "/dev/ttyUSB0"})
+	c.Check(api.RequiresPort, DeepEquals, []string{"5432", "cache:6379"})
+	c.Check(api.RequiresTimeout, Equals, plan.OptionalDuration{Value: time.Minute, IsSet: true})
+	// Merging doesn't modify the layers.
+	c.Check(layer1.Services["api"].RequiresPath, DeepEquals, []string{"/run/db.sock"})
+
+	addr, err := plan.PortAddress("5432")
+	c.Assert(err, IsNil)
+	c.Check(addr, Equals, "localhost:5432")
+	addr, err = plan.PortAddress("cache:6379")
+	c.Assert(err, IsNil)
+	c.Check(addr, Equals, "cache:6379")
+	addr, err = plan.PortAddress("[::1]:80")
+	c.Assert(err, IsNil)
+	c.Check(addr, Equals, "[::1]:80")
+	_, err = plan.PortAddress("db:http")
+	c.Check(err, ErrorMatches, "port must be a number from 1 to 65535")
+}
+
 func (s *S) TestParseLayer(c *C) {
 	for _, test := range planTests {
 		c.Logf(test.summary)
@@ -1440,10 +3034,20 @@ func (s *S) TestParseLayer(c *C) {
 			}
 			if err == nil {
 				p := &plan.Plan{
-					Layers:     sup.Layers,
-					Services:   result.Services,
-					Checks:     result.Checks,
-					LogTargets: result.LogTargets,
+					Layers:        sup.Layers,
+					Services:      result.Services,
+					Checks:        result.Checks,
+					LogTargets:    result.LogTargets,
+					NoticeHooks:   result.NoticeHooks,
+					Network:       result.Network,
+					Mounts:        result.Mounts,
+					KernelModules: result.KernelModules,
+					Sysctls:       result.Sysctls,
+					TimeServers:   result.TimeServers,
+					Watchdogs:     result.Watchdogs,
+					Devices:       result.Devices,
+					Secrets:       result.Secrets,
+					Vars:          result.Vars,
 				}
 				err = p.Validate()
 			}
@@ -1458,6 +3062,20 @@ func (s *S) TestParseLayer(c *C) {
 	}
 }
 
+func (s *S) TestSysctlPath(c *C) {
+	for _, test := range []struct {
+		name string
+		path string
+	}{
+		{"vm.swappiness", "vm/swappiness"},
+		{"net.ipv4.conf.eth0.rp_filter", "net/ipv4/conf/eth0/rp_filter"},
+		{"net/ipv4/conf/eth0.100/rp_filter", "net/ipv4/conf/eth0.100/rp_filter"},
+	} {
+		sysctl := &plan.Sysctl{Name: test.name}
+		c.Check(sysctl.Path(), Equals, test.path)
+	}
+}
+
 func (s *S) TestCombineLayersCycle(c *C) {
 	// Even if individual layers don't have cycles, combined layers might.
 	layer1, err := plan.ParseLayer(1, "label1", []byte(`
@@ -1589,7 +3207,8 @@ func (s *S) TestReadDir(c *C) {
 		}
 		if err != nil || test.error != "" {
 			if test.error != "" {
-				c.Assert(err, ErrorMatches, test.error)
+				// Errors for a single item include the file and position.
+				c.Assert(err, ErrorMatches, `(layer \d{3}-layer-\d+\.yaml:\d+:\d+: )?(`+test.error+`)`)
 			} else {
 				c.Assert(err, IsNil)
 			}
@@ -1651,6 +3270,28 @@ func (s *S) TestReadDirDupNames(c *C) {
 	}
 }
 
+func (s *S) TestReadDirFirstError(c *C) {
+	pebbleDir := c.MkDir()
+	layersDir := filepath.Join(pebbleDir, "layers")
+	err := os.Mkdir(layersDir, 0755)
+	c.Assert(err, IsNil)
+
+	// Layers are parsed concurrently, but the error from the first file in
+	// order is reported.
+	for i := 1; i <= 20; i++ {
+		content := "summary: ok\n"
+		if i >= 5 {
+			content = fmt.Sprintf("services:\n    srv%d:\n        override: replace\n        command: foo\n        on-success: bogus\n", i)
+		}
+		err := os.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%03d-layer-%d.yaml", i, i)), []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+	for i := 0; i < 10; i++ {
+		_, err = plan.ReadDir(pebbleDir)
+		c.Assert(err, ErrorMatches, `layer 005-layer-5.yaml:2:5: plan service "srv5" on-success action "bogus" invalid`)
+	}
+}
+
 func (s *S) TestMarshalLayer(c *C) {
 	layerBytes := reindent(`
 		summary: Simple layer
@@ -1939,3 +3580,123 @@ func (s *S) TestPebbleLabelPrefixReserved(c *C) {
 	_, err := plan.ParseLayer(0, "pebble-foo", []byte("{}"))
 	c.Check(err, ErrorMatches, `cannot use reserved label prefix "pebble-"`)
 }
+
+func (s *S) TestSections(c *C) {
+	names := plan.SectionNames()
+	c.Check(names[:3], DeepEquals, []string{"services", "checks", "log-targets"})
+	for _, name := range names {
+		c.Check(name, Not(Equals), "layers")
+	}
+
+	p := &plan.Plan{
+		Services: map[string]*plan.Service{"svc1": {Name: "svc1", Command: "cmd"}},
+	}
+	c.Check(p.Section("services"), DeepEquals, p.Services)
+	c.Check(p.Section("checks"), DeepEquals, map[string]*plan.Check(nil))
+	c.Check(p.Section("foo"), IsNil)
+	c.Check(p.Section("-"), IsNil)
+}
+
+func (s *S) TestExtensionSections(c *C) {
+	var validated map[string]interface{}
+	err := plan.RegisterSection("test-devices", func(items map[string]interface{}) error {
+		validated = items
+		for name, item := range items {
+			if _, ok := item.(map[string]interface{})["path"]; !ok {
+				return fmt.Errorf("device %q must define a path", name)
+			}
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+	defer plan.UnregisterSection("test-devices")
+
+	err = plan.RegisterSection("test-devices", nil)
+	c.Check(err, ErrorMatches, `cannot register section "test-devices": it's already registered`)
+	err = plan.RegisterSection("services", nil)
+	c.Check(err, ErrorMatches, `cannot register section "services": it's a built-in section`)
+	err = plan.RegisterSection("Bad_Name", nil)
+	c.Check(err, ErrorMatches, `invalid section name "Bad_Name"`)
+
+	names := plan.SectionNames()
+	c.Check(names[len(names)-1], Equals, "test-devices")
+
+	layer1, err := plan.ParseLayer(1, "layer1", reindent(`
+		test-devices:
+			dev1:
+				path: /dev/a
+			dev2:
+				path: /dev/b
+	`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(2, "layer2", reindent(`
+		test-devices:
+			dev2:
+				path: /dev/c
+	`))
+	c.Assert(err, IsNil)
+	p, err := plan.NewPlan([]*plan.Layer{layer1, layer2})
+	c.Assert(err, IsNil)
+	expected := map[string]interface{}{
+		"dev1": map[string]interface{}{"path": "/dev/a"},
+		"dev2": map[string]interface{}{"path": "/dev/c"},
+	}
+	c.Check(p.Section("test-devices"), DeepEquals, expected)
+	c.Check(validated, DeepEquals, expected)
+
+	data, err := yaml.Marshal(p)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `
+test-devices:
+    dev1:
+        path: /dev/a
+    dev2:
+        path: /dev/c
+`[1:])
+
+	layer3, err := plan.ParseLayer(3, "layer3", reindent(`
+		test-devices:
+			dev3: {}
+	`))
+	c.Assert(err, IsNil)
+	_, err = plan.NewPlan([]*plan.Layer{layer1, layer3})
+	c.Check(err, ErrorMatches, `invalid section "test-devices": device "dev3" must define a path`)
+
+	_, err = plan.ParseLayer(4, "layer4", reindent(`
+		test-devices: [dev1]
+	`))
+	c.Check(err, ErrorMatches, `section "test-devices" must be a map of items`)
+
+	plan.UnregisterSection("test-devices")
+	_, err = plan.ParseLayer(1, "layer1", reindent(`
+		test-devices:
+			dev1:
+				path: /dev/a
+	`))
+	c.Check(err, ErrorMatches, `unknown section "test-devices"`)
+}
+
+func (s *S) TestOCIService(c *C) {
+	layer1, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			app:
+				override: replace
+				kind: oci
+				command: /bundles/app
+				image: /images/app-1
+	`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(2, "layer2", reindent(`
+		services:
+			app:
+				override: merge
+				image: /images/app-2
+	`))
+	c.Assert(err, IsNil)
+	p, err := plan.NewPlan([]*plan.Layer{layer1, layer2})
+	c.Assert(err, IsNil)
+	service := p.Services["app"]
+	c.Check(service.Kind, Equals, plan.KindOCI)
+	c.Check(service.Command, Equals, "/bundles/app")
+	c.Check(service.Image, Equals, "/images/app-2")
+}
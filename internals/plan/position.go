@@ -0,0 +1,98 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// errorPosition finds the item that makes the layer fail validation, and
+// returns the line and column of its name in the layer's YAML, or zeros if
+// no single item is at fault. It's only used after validation has failed,
+// so it doesn't matter that it validates each item again.
+func (layer *Layer) errorPosition(data []byte) (line, column int) {
+	var root yaml.Node
+	err := yaml.Unmarshal(data, &root)
+	if err != nil || len(root.Content) == 0 {
+		return 0, 0
+	}
+	if (&Layer{Label: layer.Label}).Validate() != nil {
+		// The error isn't about any of the items.
+		return 0, 0
+	}
+
+	layerValue := reflect.ValueOf(layer).Elem()
+	layerType := layerValue.Type()
+	for i := 0; i < layerType.NumField(); i++ {
+		field := layerType.Field(i)
+		section := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		items := layerValue.Field(i)
+		if items.Kind() != reflect.Map || section == "" || section == "-" {
+			continue
+		}
+		keys := items.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		for _, key := range keys {
+			// Validate a layer with just this item.
+			single := &Layer{Label: layer.Label}
+			singleItems := reflect.MakeMap(items.Type())
+			singleItems.SetMapIndex(key, items.MapIndex(key))
+			reflect.ValueOf(single).Elem().Field(i).Set(singleItems)
+			if single.Validate() == nil {
+				continue
+			}
+			node := mappingKey(mappingValue(root.Content[0], section), key.String())
+			if node == nil {
+				return 0, 0
+			}
+			return node.Line, node.Column
+		}
+	}
+	return 0, 0
+}
+
+// mappingValue returns the value node for the given key in a mapping node,
+// or nil if it's not found.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingKey returns the key node for the given key in a mapping node, or
+// nil if it's not found.
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+var positionLayer = `
+	services:
+		srv1:
+			override: replace
+			command: cmd
+		srv2:
+			override: replace
+			command: cmd
+			on-success: bogus
+	checks:
+		chk1:
+			override: replace
+			http:
+				url: http://localhost/
+`
+
+func (s *S) TestParseLayerErrorPosition(c *C) {
+	_, err := plan.ParseLayer(1, "base", reindent(positionLayer))
+	c.Assert(err, ErrorMatches, `plan service "srv2" on-success action "bogus" invalid`)
+	formatErr, ok := err.(*plan.FormatError)
+	c.Assert(ok, Equals, true)
+	c.Assert(formatErr.Line, Equals, 5)
+	c.Assert(formatErr.Column, Equals, 5)
+
+	// Errors that aren't about a single item have no position.
+	_, err = plan.ParseLayer(1, "pebble-base", reindent(positionLayer))
+	c.Assert(err, ErrorMatches, `cannot use reserved label prefix "pebble-"`)
+	formatErr, ok = err.(*plan.FormatError)
+	c.Assert(ok, Equals, true)
+	c.Assert(formatErr.Line, Equals, 0)
+	c.Assert(formatErr.Column, Equals, 0)
+}
+
+func (s *S) TestReadDirErrorPosition(c *C) {
+	pebbleDir := writeLayerFiles(c, map[string]string{
+		"001-base.yaml": positionLayer,
+	})
+	_, err := plan.ReadDir(pebbleDir)
+	c.Assert(err, ErrorMatches, `layer 001-base.yaml:5:5: plan service "srv2" on-success action "bogus" invalid`)
+
+	// Positions aren't reported for layers that include fragments, as the
+	// error may be in any of the files.
+	pebbleDir = writeLayerFiles(c, map[string]string{
+		"001-base.yaml": `
+			include: [fragments/a.yaml]
+		`,
+		"fragments/a.yaml": positionLayer,
+	})
+	_, err = plan.ReadDir(pebbleDir)
+	c.Assert(err, ErrorMatches, `plan service "srv2" on-success action "bogus" invalid`)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/canonical/x-go/strutil"
+)
+
+// SectionValidator checks the combined items of an extension section, which
+// map each item's name to its content as decoded from YAML.
+type SectionValidator func(items map[string]interface{}) error
+
+var sectionNameExp = regexp.MustCompile("^[a-z](?:-?[a-z0-9])*$")
+
+var (
+	extensionSectionsLock sync.Mutex
+	extensionSections     = make(map[string]SectionValidator)
+)
+
+// RegisterSection registers an extension section with the given YAML name,
+// so that layers may include it alongside the built-in sections such as
+// "services". The section must be a map of named items: items in later
+// layers replace items with the same name in earlier layers. Pebble doesn't
+// interpret the items, but validate (if non-nil) is called with the combined
+// items whenever the plan is combined.
+//
+// Sections must be registered before the plan is loaded.
+func RegisterSection(name string, validate SectionValidator) error {
+	if !sectionNameExp.MatchString(name) {
+		return fmt.Errorf("invalid section name %q", name)
+	}
+	if strutil.ListContains(builtinSectionNames(), name) || name == "summary" || name == "description" {
+		return fmt.Errorf("cannot register section %q: it's a built-in section", name)
+	}
+
+	extensionSectionsLock.Lock()
+	defer extensionSectionsLock.Unlock()
+	if _, ok := extensionSections[name]; ok {
+		return fmt.Errorf("cannot register section %q: it's already registered", name)
+	}
+	extensionSections[name] = validate
+	return nil
+}
+
+// UnregisterSection removes the extension section with the given name.
+func UnregisterSection(name string) {
+	extensionSectionsLock.Lock()
+	defer extensionSectionsLock.Unlock()
+	delete(extensionSections, name)
+}
+
+// extensionSectionNames returns the names of the registered extension
+// sections, sorted.
+func extensionSectionNames() []string {
+	extensionSectionsLock.Lock()
+	defer extensionSectionsLock.Unlock()
+	names := make([]string, 0, len(extensionSections))
+	for name := range extensionSections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func extensionSectionValidator(name string) (validate SectionValidator, ok bool) {
+	extensionSectionsLock.Lock()
+	defer extensionSectionsLock.Unlock()
+	validate, ok = extensionSections[name]
+	return validate, ok
+}
+
+// sectionItems returns the items of an extension section's content.
+func sectionItems(content interface{}) map[string]interface{} {
+	items, _ := content.(map[string]interface{})
+	return items
+}
+
+// validateSections checks that the layer's extension sections are
+// registered and are maps of named items.
+func (layer *Layer) validateSections() error {
+	for name, content := range layer.Sections {
+		if _, ok := extensionSectionValidator(name); !ok {
+			return &FormatError{
+				Message: fmt.Sprintf("unknown section %q", name),
+			}
+		}
+		if content == nil {
+			continue
+		}
+		if _, ok := content.(map[string]interface{}); !ok {
+			return &FormatError{
+				Message: fmt.Sprintf("section %q must be a map of items", name),
+			}
+		}
+	}
+	return nil
+}
+
+// combineSections adds the items of the layer's extension sections to the
+// combined layer, replacing items with the same name.
+func (combined *Layer) combineSections(layer *Layer) {
+	for name, content := range layer.Sections {
+		if combined.Sections == nil {
+			combined.Sections = make(map[string]interface{})
+		}
+		items := sectionItems(combined.Sections[name])
+		if items == nil {
+			items = make(map[string]interface{})
+			combined.Sections[name] = items
+		}
+		for itemName, item := range sectionItems(content) {
+			items[itemName] = item
+		}
+	}
+}
+
+// validateSections calls the validators of the plan's extension sections.
+func (p *Plan) validateSections() error {
+	names := make([]string, 0, len(p.Sections))
+	for name := range p.Sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		validate, ok := extensionSectionValidator(name)
+		if !ok {
+			return &FormatError{
+				Message: fmt.Sprintf("unknown section %q", name),
+			}
+		}
+		if validate == nil {
+			continue
+		}
+		err := validate(sectionItems(p.Sections[name]))
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("invalid section %q: %v", name, err),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultKillDelay is the time the service manager waits for a service to
+// stop before killing it, if the service doesn't set kill-delay.
+const defaultKillDelay = 5 * time.Second
+
+// SystemdUnits converts the plan's services to systemd service units. The
+// result maps each unit's file name ("<service>.service") to its content.
+//
+// The conversion is necessarily approximate: settings that systemd has no
+// equivalent for, such as the backoff factor and check failure actions, are
+// noted in comments in the unit.
+func (p *Plan) SystemdUnits() (map[string]string, error) {
+	units := make(map[string]string, len(p.Services))
+	for _, name := range sortedNames(p.Services) {
+		unit, err := systemdUnit(p.Services[name])
+		if err != nil {
+			return nil, err
+		}
+		units[systemdUnitName(name)] = unit
+	}
+	return units, nil
+}
+
+func systemdUnitName(service string) string {
+	return service + ".service"
+}
+
+func systemdUnit(service *Service) (string, error) {
+	base, extra, err := service.ParseCommand()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by Pebble from service %q.\n", service.Name)
+
+	b.WriteString("\n[Unit]\n")
+	description := service.Summary
+	if description == "" {
+		description = fmt.Sprintf("Pebble service %s", service.Name)
+	}
+	writeSystemdSetting(&b, "Description", description)
+	writeSystemdUnitList(&b, "After", service.After)
+	writeSystemdUnitList(&b, "Before", service.Before)
+	writeSystemdUnitList(&b, "Requires", service.Requires)
+
+	b.WriteString("\n[Service]\n")
+	writeSystemdSetting(&b, "Type", "simple")
+	writeSystemdSetting(&b, "ExecStart", systemdCommand(append(base, extra...)))
+	for _, key := range sortedNames(service.Environment) {
+		writeSystemdSetting(&b, "Environment", systemdQuote(key+"="+service.Environment[key]))
+	}
+	switch {
+	case service.User != "":
+		writeSystemdSetting(&b, "User", service.User)
+	case service.UserID != nil:
+		writeSystemdSetting(&b, "User", strconv.Itoa(*service.UserID))
+	}
+	switch {
+	case service.Group != "":
+		writeSystemdSetting(&b, "Group", service.Group)
+	case service.GroupID != nil:
+		writeSystemdSetting(&b, "Group", strconv.Itoa(*service.GroupID))
+	}
+	if service.WorkingDir != "" {
+		writeSystemdSetting(&b, "WorkingDirectory", service.WorkingDir)
+	}
+	writeSystemdSetting(&b, "Restart", systemdRestart(service))
+	if service.BackoffDelay.Value > 0 {
+		writeSystemdSetting(&b, "RestartSec", systemdDuration(service.BackoffDelay.Value))
+	}
+	killDelay := defaultKillDelay
+	if service.KillDelay.IsSet {
+		killDelay = service.KillDelay.Value
+	}
+	writeSystemdSetting(&b, "TimeoutStopSec", systemdDuration(killDelay))
+	for _, note := range systemdUnsupported(service) {
+		fmt.Fprintf(&b, "# Not converted: %s\n", note)
+	}
+
+	if service.Startup == StartupEnabled {
+		b.WriteString("\n[Install]\n")
+		writeSystemdSetting(&b, "WantedBy", "multi-user.target")
+	}
+	return b.String(), nil
+}
+
+func writeSystemdSetting(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "%s=%s\n", key, value)
+}
+
+func writeSystemdUnitList(b *strings.Builder, key string, services []string) {
+	if len(services) == 0 {
+		return
+	}
+	units := make([]string, len(services))
+	for i, service := range services {
+		units[i] = systemdUnitName(service)
+	}
+	writeSystemdSetting(b, key, strings.Join(units, " "))
+}
+
+// systemdRestart returns the systemd Restart setting that's closest to the
+// service's on-success and on-failure actions. Pebble restarts services on
+// both by default.
+func systemdRestart(service *Service) string {
+	restarts := func(action ServiceAction) bool {
+		return action == ActionUnset || action == ActionRestart
+	}
+	onSuccess, onFailure := restarts(service.OnSuccess), restarts(service.OnFailure)
+	switch {
+	case onSuccess && onFailure:
+		return "always"
+	case onSuccess:
+		return "on-success"
+	case onFailure:
+		return "on-failure"
+	default:
+		return "no"
+	}
+}
+
+// systemdUnsupported returns descriptions of the service's settings that
+// don't have a systemd equivalent.
+func systemdUnsupported(service *Service) []string {
+	var notes []string
+	for _, action := range []struct {
+		field  string
+		action ServiceAction
+	}{
+		{"on-success", service.OnSuccess},
+		{"on-failure", service.OnFailure},
+	} {
+		if action.action != ActionUnset && action.action != ActionRestart && action.action != ActionIgnore {
+			notes = append(notes, fmt.Sprintf("%s: %s", action.field, action.action))
+		}
+	}
+	if service.BackoffFactor.IsSet {
+		notes = append(notes, fmt.Sprintf("backoff-factor: %g", service.BackoffFactor.Value))
+	}
+	if service.BackoffLimit.IsSet {
+		notes = append(notes, fmt.Sprintf("backoff-limit: %s", service.BackoffLimit.Value))
+	}
+	for _, check := range sortedNames(service.OnCheckFailure) {
+		notes = append(notes, fmt.Sprintf("on-check-failure: %s: %s", check, service.OnCheckFailure[check]))
+	}
+	return notes
+}
+
+// systemdCommand returns the command line for ExecStart, quoting each
+// argument as needed. Unlike other settings, ExecStart expands "$", so it's
+// escaped too.
+func systemdCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = systemdQuote(strings.ReplaceAll(arg, "$", "$$"))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// systemdQuote quotes s for use as a single word in a systemd setting, and
+// escapes "%" so it's not treated as a specifier.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// systemdDuration formats d as a systemd time span.
+func systemdDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+	return strconv.FormatInt(int64(d/time.Millisecond), 10) + "ms"
+}
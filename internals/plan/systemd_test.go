@@ -0,0 +1,91 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *S) TestSystemdUnits(c *C) {
+	p := s.parsePlan(c, `
+		services:
+			db:
+				override: replace
+				command: /usr/bin/db --data "/var/lib/my db"
+				startup: enabled
+				user: dbuser
+				group-id: 1000
+				working-dir: /var/lib
+				kill-delay: 10s
+			web:
+				override: replace
+				summary: Web server
+				command: /usr/bin/web --port $PORT [ --verbose ]
+				requires: [db]
+				after: [db]
+				environment:
+					PORT: "80%"
+					GREETING: hello world
+				on-success: shutdown
+				on-failure: restart
+				backoff-delay: 2s
+				backoff-factor: 1.5
+				on-check-failure:
+					up: restart
+	`)
+	units, err := p.SystemdUnits()
+	c.Assert(err, IsNil)
+	c.Assert(units, DeepEquals, map[string]string{
+		"db.service": `
+# Generated by Pebble from service "db".
+
+[Unit]
+Description=Pebble service db
+
+[Service]
+Type=simple
+ExecStart=/usr/bin/db --data "/var/lib/my db"
+User=dbuser
+Group=1000
+WorkingDirectory=/var/lib
+Restart=always
+RestartSec=500ms
+TimeoutStopSec=10s
+
+[Install]
+WantedBy=multi-user.target
+`[1:],
+		"web.service": `
+# Generated by Pebble from service "web".
+
+[Unit]
+Description=Web server
+After=db.service
+Requires=db.service
+
+[Service]
+Type=simple
+ExecStart=/usr/bin/web --port $$PORT --verbose
+Environment="GREETING=hello world"
+Environment=PORT=80%%
+Restart=on-failure
+RestartSec=2s
+TimeoutStopSec=5s
+# Not converted: on-success: shutdown
+# Not converted: backoff-factor: 1.5
+# Not converted: on-check-failure: up: restart
+`[1:],
+	})
+}
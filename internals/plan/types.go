@@ -3,6 +3,7 @@ package plan
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -65,3 +66,60 @@ func (o *OptionalFloat) UnmarshalYAML(value *yaml.Node) error {
 	o.IsSet = true
 	return nil
 }
+
+// UlimitUnlimited is the value of a resource limit with no limit.
+const UlimitUnlimited = ^uint64(0)
+
+// Ulimit is a soft and hard resource limit. In YAML, it's either a single
+// value used for both, or "soft:hard". A value is a non-negative integer
+// or "unlimited".
+type Ulimit struct {
+	Soft uint64
+	Hard uint64
+}
+
+func (u Ulimit) MarshalYAML() (interface{}, error) {
+	if u.Soft == u.Hard {
+		return formatUlimitValue(u.Soft), nil
+	}
+	return formatUlimitValue(u.Soft) + ":" + formatUlimitValue(u.Hard), nil
+}
+
+func (u *Ulimit) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("ulimit must be a YAML string or number")
+	}
+	softStr, hardStr, hasHard := strings.Cut(value.Value, ":")
+	soft, err := parseUlimitValue(softStr)
+	if err != nil {
+		return fmt.Errorf("invalid ulimit %q", value.Value)
+	}
+	hard := soft
+	if hasHard {
+		hard, err = parseUlimitValue(hardStr)
+		if err != nil {
+			return fmt.Errorf("invalid ulimit %q", value.Value)
+		}
+	}
+	u.Soft = soft
+	u.Hard = hard
+	return nil
+}
+
+func formatUlimitValue(v uint64) string {
+	if v == UlimitUnlimited {
+		return "unlimited"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func parseUlimitValue(s string) (uint64, error) {
+	if s == "unlimited" {
+		return UlimitUnlimited, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || v == UlimitUnlimited {
+		return 0, fmt.Errorf("invalid ulimit value %q", s)
+	}
+	return v, nil
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	varNameExp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// varRefExp matches "${name}" and "$ENV{name}", optionally escaped with
+	// an extra leading "$".
+	varRefExp = regexp.MustCompile(`\$(\$?)(ENV)?\{([^}]*)\}`)
+
+	factsLock sync.RWMutex
+	facts     map[string]string
+)
+
+// SetFacts sets the facts about the device, such as those collected by the
+// inventory manager, that "when" expressions are evaluated against. Facts
+// with a value are also available to every plan as variables named
+// "inventory_<fact>", though a variable defined in the plan's "vars" section
+// takes precedence. Plans created before the call aren't affected.
+func SetFacts(newFacts map[string]string) {
+	factsLock.Lock()
+	defer factsLock.Unlock()
+	facts = make(map[string]string, len(newFacts))
+	for name, value := range newFacts {
+		facts[name] = value
+	}
+}
+
+func currentFacts() map[string]string {
+	factsLock.RLock()
+	defer factsLock.RUnlock()
+	return facts
+}
+
+// planVars returns the variables derived from the facts, overridden by the
+// given plan variables.
+func planVars(vars map[string]string) map[string]string {
+	facts := currentFacts()
+	if len(facts) == 0 {
+		return vars
+	}
+	merged := make(map[string]string, len(facts)+len(vars))
+	for name, value := range facts {
+		if value != "" {
+			merged["inventory_"+name] = value
+		}
+	}
+	for name, value := range vars {
+		merged[name] = value
+	}
+	return merged
+}
+
+// expandVars replaces the variable references in s. "${name}" is replaced
+// by the value of the plan variable with that name, or if there's no such
+// variable, the daemon environment variable. "$ENV{name}" always refers to
+// the daemon environment. A reference to an undefined variable is an error.
+// "$${" and "$$ENV{" can be used to include a literal "${" or "$ENV{".
+func expandVars(s string, vars map[string]string) (string, error) {
+	var err error
+	expanded := varRefExp.ReplaceAllStringFunc(s, func(ref string) string {
+		match := varRefExp.FindStringSubmatch(ref)
+		escaped, env, name := match[1] != "", match[2] != "", match[3]
+		if escaped {
+			return ref[1:]
+		}
+		if err != nil {
+			return ""
+		}
+		if !varNameExp.MatchString(name) {
+			err = fmt.Errorf("invalid variable name %q", name)
+			return ""
+		}
+		if !env {
+			if value, ok := vars[name]; ok {
+				return value
+			}
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			if env {
+				err = fmt.Errorf("environment variable %q not set", name)
+			} else {
+				err = fmt.Errorf("variable %q not defined", name)
+			}
+			return ""
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// expandPlanVars expands the variable references in the service commands,
+// service environment values, and HTTP check URLs of the combined layer.
+// The layer's items must not be shared with any other layer.
+func expandPlanVars(combined *Layer) error {
+	vars := planVars(combined.Vars)
+	for _, name := range sortedNames(combined.Services) {
+		service := combined.Services[name]
+		command, err := expandVars(service.Command, vars)
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("cannot expand service %q command: %v", name, err),
+			}
+		}
+		service.Command = command
+		for key, value := range service.Environment {
+			expanded, err := expandVars(value, vars)
+			if err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("cannot expand service %q environment variable %q: %v", name, key, err),
+				}
+			}
+			service.Environment[key] = expanded
+		}
+	}
+	for _, name := range sortedNames(combined.Checks) {
+		check := combined.Checks[name]
+		if check.HTTP == nil {
+			continue
+		}
+		url, err := expandVars(check.HTTP.URL, vars)
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("cannot expand check %q URL: %v", name, err),
+			}
+		}
+		check.HTTP.URL = url
+	}
+	return nil
+}
+
+// sortedNames returns the keys of m in sorted order, so that errors are
+// reported deterministically.
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpandEnvironment returns a copy of a service's environment with the
+// "$name" references in its values replaced. A name that's another key in
+// the environment refers to that key's (expanded) value; otherwise, and for
+// a key referring to itself (as in "PATH: /opt/bin:$PATH"), it refers to the
+// daemon environment. Undefined names expand to an empty string, and "$$"
+// is a literal "$". References that form a cycle are an error.
+//
+// This is done when the service starts, after plan variables ("${name}")
+// have been expanded, so "${" is left as is.
+func ExpandEnvironment(environment map[string]string) (map[string]string, error) {
+	expanded := make(map[string]string, len(environment))
+	expanding := make(map[string]bool)
+
+	var expand func(key string) (string, error)
+	expand = func(key string) (string, error) {
+		if value, ok := expanded[key]; ok {
+			return value, nil
+		}
+		if expanding[key] {
+			return "", fmt.Errorf("environment variable %q refers to itself through other variables", key)
+		}
+		expanding[key] = true
+		defer delete(expanding, key)
+
+		value, err := expandEnvRefs(environment[key], func(name string) (string, error) {
+			if _, ok := environment[name]; ok && name != key {
+				return expand(name)
+			}
+			return os.Getenv(name), nil
+		})
+		if err != nil {
+			return "", err
+		}
+		expanded[key] = value
+		return value, nil
+	}
+
+	for _, key := range sortedNames(environment) {
+		_, err := expand(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// expandEnvRefs replaces the "$name" references and "$$" escapes in s,
+// using lookup to find each name's value.
+func expandEnvRefs(s string, lookup func(name string) (string, error)) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(s) && isEnvNameChar(s[end], end == i+1) {
+			end++
+		}
+		if end == i+1 || (end < len(s) && s[end] == '{') {
+			// Not a reference (or "$ENV{" left over from plan variables).
+			b.WriteByte(s[i])
+			continue
+		}
+		value, err := lookup(s[i+1 : end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+		i = end - 1
+	}
+	return b.String(), nil
+}
+
+func isEnvNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (!first && c >= '0' && c <= '9')
+}
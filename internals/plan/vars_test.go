@@ -0,0 +1,185 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	"os"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func (s *S) TestVars(c *C) {
+	os.Setenv("PEBBLE_TEST_VAR", "from-env")
+	defer os.Unsetenv("PEBBLE_TEST_VAR")
+	os.Setenv("PEBBLE_TEST_PORT", "9000")
+	defer os.Unsetenv("PEBBLE_TEST_PORT")
+
+	p := s.parsePlan(c, `
+		vars:
+			greeting: hello
+			PEBBLE_TEST_PORT: "8080"
+		services:
+			srv1:
+				override: replace
+				command: echo ${greeting} $ENV{PEBBLE_TEST_VAR} $${greeting} $HOME
+				environment:
+					PORT: ${PEBBLE_TEST_PORT}
+					ENV_PORT: $ENV{PEBBLE_TEST_PORT}
+		checks:
+			chk1:
+				override: replace
+				http:
+					url: http://localhost:${PEBBLE_TEST_PORT}/health
+	`, `
+		vars:
+			greeting: hi
+		services:
+			srv2:
+				override: replace
+				command: echo ${PEBBLE_TEST_VAR}
+	`)
+	c.Assert(p.Vars, DeepEquals, map[string]string{
+		"greeting":         "hi",
+		"PEBBLE_TEST_PORT": "8080",
+	})
+	c.Assert(p.Services["srv1"].Command, Equals, "echo hi from-env ${greeting} $HOME")
+	c.Assert(p.Services["srv1"].Environment, DeepEquals, map[string]string{
+		"PORT":     "8080",
+		"ENV_PORT": "9000",
+	})
+	c.Assert(p.Services["srv2"].Command, Equals, "echo from-env")
+	c.Assert(p.Checks["chk1"].HTTP.URL, Equals, "http://localhost:8080/health")
+
+	// The layers themselves are left unexpanded.
+	c.Assert(p.Layers[0].Services["srv1"].Command, Equals, "echo ${greeting} $ENV{PEBBLE_TEST_VAR} $${greeting} $HOME")
+}
+
+func (s *S) TestVarsErrors(c *C) {
+	os.Unsetenv("PEBBLE_TEST_UNSET")
+	tests := []struct {
+		layer string
+		error string
+	}{{
+		layer: `
+			services:
+				srv1:
+					override: replace
+					command: echo ${PEBBLE_TEST_UNSET}
+		`,
+		error: `cannot expand service "srv1" command: variable "PEBBLE_TEST_UNSET" not defined`,
+	}, {
+		layer: `
+			vars:
+				PEBBLE_TEST_UNSET: x
+			services:
+				srv1:
+					override: replace
+					command: echo
+					environment:
+						FOO: $ENV{PEBBLE_TEST_UNSET}
+		`,
+		error: `cannot expand service "srv1" environment variable "FOO": environment variable "PEBBLE_TEST_UNSET" not set`,
+	}, {
+		layer: `
+			checks:
+				chk1:
+					override: replace
+					http:
+						url: http://localhost/${bad-name}
+		`,
+		error: `cannot expand check "chk1" URL: invalid variable name "bad-name"`,
+	}}
+	for _, test := range tests {
+		layer, err := plan.ParseLayer(1, "layer", reindent(test.layer))
+		c.Assert(err, IsNil)
+		_, err = plan.NewPlan([]*plan.Layer{layer})
+		c.Assert(err, ErrorMatches, test.error)
+		_, ok := err.(*plan.FormatError)
+		c.Assert(ok, Equals, true)
+	}
+
+	_, err := plan.ParseLayer(1, "layer", reindent(`
+		vars:
+			bad-name: x
+	`))
+	c.Assert(err, ErrorMatches, `invalid variable name "bad-name"`)
+}
+
+func (s *S) TestFactVars(c *C) {
+	plan.SetFacts(map[string]string{
+		"model":  "Gateway 3000",
+		"serial": "SN-1234",
+		"vendor": "",
+	})
+	defer plan.SetFacts(nil)
+
+	p := s.parsePlan(c, `
+		vars:
+			inventory_serial: overridden
+		services:
+			srv1:
+				override: replace
+				command: echo ${inventory_model} ${inventory_serial}
+	`)
+	// Fact variables aren't part of the plan's own variables.
+	c.Assert(p.Vars, DeepEquals, map[string]string{
+		"inventory_serial": "overridden",
+	})
+	c.Assert(p.Services["srv1"].Command, Equals, "echo Gateway 3000 overridden")
+
+	// Facts without a value aren't defined.
+	layer, err := plan.ParseLayer(1, "layer", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: echo ${inventory_vendor}
+	`))
+	c.Assert(err, IsNil)
+	_, err = plan.NewPlan([]*plan.Layer{layer})
+	c.Assert(err, ErrorMatches, `cannot expand service "srv1" command: variable "inventory_vendor" not defined`)
+}
+
+func (s *S) TestExpandEnvironment(c *C) {
+	os.Setenv("PEBBLE_TEST_PATH", "/usr/bin:/bin")
+	defer os.Unsetenv("PEBBLE_TEST_PATH")
+
+	env, err := plan.ExpandEnvironment(map[string]string{
+		"PEBBLE_TEST_PATH": "/opt/app/bin:$PEBBLE_TEST_PATH",
+		"APP_HOME":         "/opt/app",
+		"APP_CONFIG":       "$APP_HOME/etc/$APP_NAME.conf",
+		"APP_NAME":         "app",
+		"PRICE":            "$$5 or $ 5 or $",
+		"UNSET":            "[$PEBBLE_TEST_UNSET]",
+		"LEFTOVER":         "${x} $ENV{y}",
+	})
+	c.Assert(err, IsNil)
+	c.Check(env, DeepEquals, map[string]string{
+		"PEBBLE_TEST_PATH": "/opt/app/bin:/usr/bin:/bin",
+		"APP_HOME":         "/opt/app",
+		"APP_CONFIG":       "/opt/app/etc/app.conf",
+		"APP_NAME":         "app",
+		"PRICE":            "$5 or $ 5 or $",
+		"UNSET":            "[]",
+		"LEFTOVER":         "${x} $ENV{y}",
+	})
+
+	_, err = plan.ExpandEnvironment(map[string]string{
+		"A": "$B",
+		"B": "x$A",
+	})
+	c.Check(err, ErrorMatches, `environment variable "A" refers to itself through other variables`)
+}
@@ -0,0 +1,357 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package plan
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A "when" expression decides whether a service or check is included in the
+// plan. It compares facts about the device, such as "model", and environment
+// variables, given as "env.NAME", with string literals or each other:
+//
+//	model == "gw-2000" && env.SITE != "lab"
+//
+// Comparisons can be combined with "&&", "||", "!", and parentheses, with
+// the usual precedence.
+type whenExpr interface {
+	eval(facts map[string]string) (bool, error)
+}
+
+type whenOperand struct {
+	literal bool
+	value   string // literal value, fact name, or environment variable name
+	env     bool
+}
+
+func (o whenOperand) lookup(facts map[string]string) (string, error) {
+	switch {
+	case o.literal:
+		return o.value, nil
+	case o.env:
+		return os.Getenv(o.value), nil
+	}
+	value, ok := facts[o.value]
+	if !ok {
+		return "", fmt.Errorf("unknown fact %q", o.value)
+	}
+	return value, nil
+}
+
+type whenCompare struct {
+	left, right whenOperand
+	equal       bool
+}
+
+func (c *whenCompare) eval(facts map[string]string) (bool, error) {
+	left, err := c.left.lookup(facts)
+	if err != nil {
+		return false, err
+	}
+	right, err := c.right.lookup(facts)
+	if err != nil {
+		return false, err
+	}
+	return (left == right) == c.equal, nil
+}
+
+type whenNot struct {
+	expr whenExpr
+}
+
+func (n *whenNot) eval(facts map[string]string) (bool, error) {
+	result, err := n.expr.eval(facts)
+	return !result, err
+}
+
+type whenLogical struct {
+	left, right whenExpr
+	and         bool
+}
+
+func (l *whenLogical) eval(facts map[string]string) (bool, error) {
+	left, err := l.left.eval(facts)
+	if err != nil {
+		return false, err
+	}
+	// Unlike in most languages, the right-hand side is always evaluated, so
+	// that an unknown fact is reported regardless of the device's facts.
+	right, err := l.right.eval(facts)
+	if err != nil {
+		return false, err
+	}
+	if l.and {
+		return left && right, nil
+	}
+	return left || right, nil
+}
+
+// parseWhen parses a "when" expression.
+func parseWhen(s string) (whenExpr, error) {
+	tokens, err := tokenizeWhen(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &whenParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+// evalWhen parses and evaluates a "when" expression against the given facts.
+func evalWhen(s string, facts map[string]string) (bool, error) {
+	expr, err := parseWhen(s)
+	if err != nil {
+		return false, err
+	}
+	return expr.eval(facts)
+}
+
+// whenToken is an operator, a parenthesis, a string literal (still quoted),
+// or an identifier.
+type whenToken string
+
+func (t whenToken) String() string {
+	return strconv.Quote(string(t))
+}
+
+func (t whenToken) isOperand() bool {
+	return t[0] == '"' || isIdentChar(t[0])
+}
+
+var whenOperators = []string{"==", "!=", "&&", "||", "!", "(", ")"}
+
+func tokenizeWhen(s string) ([]whenToken, error) {
+	var tokens []whenToken
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, whenToken(s[i:end+1]))
+			i = end + 1
+		case isIdentChar(c):
+			end := i
+			for end < len(s) && (isIdentChar(s[end]) || s[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, whenToken(s[i:end]))
+			i = end
+		default:
+			found := false
+			for _, op := range whenOperators {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, whenToken(op))
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return tokens, nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+type whenParser struct {
+	tokens []whenToken
+	pos    int
+}
+
+func (p *whenParser) peek() whenToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *whenParser) next() (whenToken, error) {
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *whenParser) parseOr() (whenExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &whenLogical{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseAnd() (whenExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &whenLogical{left: left, right: right, and: true}
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseUnary() (whenExpr, error) {
+	switch p.peek() {
+	case "!":
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &whenNot{expr: expr}, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t != ")" {
+			return nil, fmt.Errorf("expected \")\", not %s", t)
+		}
+		return expr, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *whenParser) parseCompare() (whenExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if op != "==" && op != "!=" {
+		return nil, fmt.Errorf("expected \"==\" or \"!=\", not %s", op)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &whenCompare{left: left, right: right, equal: op == "=="}, nil
+}
+
+func (p *whenParser) parseOperand() (whenOperand, error) {
+	t, err := p.next()
+	if err != nil {
+		return whenOperand{}, err
+	}
+	if !t.isOperand() {
+		return whenOperand{}, fmt.Errorf("expected fact or string, not %s", t)
+	}
+	if t[0] == '"' {
+		value, err := strconv.Unquote(string(t))
+		if err != nil {
+			return whenOperand{}, fmt.Errorf("invalid string %s", t)
+		}
+		return whenOperand{literal: true, value: value}, nil
+	}
+	name := string(t)
+	if env, ok := strings.CutPrefix(name, "env."); ok {
+		if !varNameExp.MatchString(env) {
+			return whenOperand{}, fmt.Errorf("invalid environment variable name %q", env)
+		}
+		return whenOperand{env: true, value: env}, nil
+	}
+	if !varNameExp.MatchString(name) {
+		return whenOperand{}, fmt.Errorf("invalid fact name %q", name)
+	}
+	return whenOperand{value: name}, nil
+}
+
+// applyWhen removes the services and checks whose "when" expression is false
+// from the combined layer.
+func applyWhen(combined *Layer) error {
+	facts := currentFacts()
+	for _, name := range sortedNames(combined.Services) {
+		service := combined.Services[name]
+		if service.When == "" {
+			continue
+		}
+		ok, err := evalWhen(service.When, facts)
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("cannot evaluate service %q when expression: %v", name, err),
+			}
+		}
+		if !ok {
+			delete(combined.Services, name)
+		}
+	}
+	for _, name := range sortedNames(combined.Checks) {
+		check := combined.Checks[name]
+		if check.When == "" {
+			continue
+		}
+		ok, err := evalWhen(check.When, facts)
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("cannot evaluate check %q when expression: %v", name, err),
+			}
+		}
+		if !ok {
+			delete(combined.Checks, name)
+		}
+	}
+	return nil
+}
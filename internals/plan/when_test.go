@@ -0,0 +1,219 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package plan_test
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+func (s *S) TestWhen(c *C) {
+	plan.SetFacts(map[string]string{
+		"model":  "gw-2000",
+		"vendor": "ACME",
+		"serial": "",
+	})
+	defer plan.SetFacts(nil)
+	os.Setenv("PEBBLE_TEST_SITE", "lab")
+	defer os.Unsetenv("PEBBLE_TEST_SITE")
+	os.Unsetenv("PEBBLE_TEST_UNSET")
+
+	tests := []struct {
+		when    string
+		include bool
+	}{
+		{`model == "gw-2000"`, true},
+		{`model == "gw-3000"`, false},
+		{`model != "gw-3000"`, true},
+		{`"gw-2000" == model`, true},
+		{`serial == ""`, true},
+		{`env.PEBBLE_TEST_SITE == "lab"`, true},
+		{`env.PEBBLE_TEST_UNSET == ""`, true},
+		{`model == "gw-2000" && vendor == "ACME"`, true},
+		{`model == "gw-2000" && vendor == "Other"`, false},
+		{`model == "gw-3000" || vendor == "ACME"`, true},
+		{`!(model == "gw-2000")`, false},
+		{`!model == "gw-3000"`, true},
+		{`model == "gw-3000" || model == "gw-2000" && vendor == "Other"`, false},
+		{`(model == "gw-3000" || model == "gw-2000") && vendor == "ACME"`, true},
+		{`model=="gw-2000"&&env.PEBBLE_TEST_SITE!="prod"`, true},
+		{`vendor == "AC\"ME"`, false},
+	}
+	for _, test := range tests {
+		p := s.parsePlan(c, fmt.Sprintf(`
+			services:
+				srv1:
+					override: replace
+					command: cmd
+					when: '%s'
+				srv2:
+					override: replace
+					command: cmd
+			checks:
+				chk1:
+					override: replace
+					when: '%s'
+					exec:
+						command: cmd
+		`, test.when, test.when))
+		var services, checks []string
+		for name := range p.Services {
+			services = append(services, name)
+		}
+		for name := range p.Checks {
+			checks = append(checks, name)
+		}
+		sort.Strings(services)
+		if test.include {
+			c.Check(services, DeepEquals, []string{"srv1", "srv2"}, Commentf("%s", test.when))
+			c.Check(checks, DeepEquals, []string{"chk1"}, Commentf("%s", test.when))
+		} else {
+			c.Check(services, DeepEquals, []string{"srv2"}, Commentf("%s", test.when))
+			c.Check(checks, IsNil, Commentf("%s", test.when))
+		}
+	}
+}
+
+func (s *S) TestWhenMerge(c *C) {
+	plan.SetFacts(map[string]string{"model": "gw-2000"})
+	defer plan.SetFacts(nil)
+
+	p := s.parsePlan(c, `
+		services:
+			srv1:
+				override: replace
+				command: cmd
+				when: model == "gw-3000"
+	`, `
+		services:
+			srv1:
+				override: merge
+				when: model == "gw-2000"
+	`)
+	c.Assert(p.Services["srv1"], NotNil)
+	c.Check(p.Services["srv1"].When, Equals, `model == "gw-2000"`)
+
+	// The layers keep the services that are excluded.
+	c.Check(p.Layers[0].Services["srv1"].When, Equals, `model == "gw-3000"`)
+}
+
+func (s *S) TestWhenSkipsVars(c *C) {
+	plan.SetFacts(map[string]string{"model": "gw-2000"})
+	defer plan.SetFacts(nil)
+	os.Unsetenv("PEBBLE_TEST_UNSET")
+
+	// Excluded services can refer to variables that aren't defined.
+	p := s.parsePlan(c, `
+		services:
+			srv1:
+				override: replace
+				command: cmd ${PEBBLE_TEST_UNSET}
+				when: model == "gw-3000"
+	`)
+	c.Check(p.Services, HasLen, 0)
+}
+
+func (s *S) TestWhenErrors(c *C) {
+	plan.SetFacts(map[string]string{"model": "gw-2000"})
+	defer plan.SetFacts(nil)
+
+	parseErrors := []struct {
+		when  string
+		error string
+	}{
+		{`model`, `unexpected end of expression`},
+		{`model == `, `unexpected end of expression`},
+		{`model = "x"`, `unexpected character '='`},
+		{`model == "x`, `unterminated string`},
+		{`model == "x" &&`, `unexpected end of expression`},
+		{`model == "x" model`, `unexpected "model"`},
+		{`(model == "x"`, `unexpected end of expression`},
+		{`(model == "x" "y"`, `expected "\)", not "\\"y\\""`},
+		{`== "x"`, `expected fact or string, not "=="`},
+		{`model "x"`, `expected "==" or "!=", not "\\"x\\""`},
+		{`a.b == "x"`, `invalid fact name "a.b"`},
+		{`env.1X == "x"`, `invalid environment variable name "1X"`},
+		{`model == "\q"`, `invalid string "\\"\\\\q\\""`},
+		{` `, `empty expression`},
+	}
+	for _, test := range parseErrors {
+		for _, kind := range []string{"service", "check"} {
+			var layerYAML string
+			if kind == "service" {
+				layerYAML = `
+					services:
+						item:
+							override: replace
+							command: cmd
+							when: ` + quoteYAML(test.when)
+			} else {
+				layerYAML = `
+					checks:
+						item:
+							override: replace
+							when: ` + quoteYAML(test.when) + `
+							exec:
+								command: cmd`
+			}
+			_, err := plan.ParseLayer(1, "layer", reindent(layerYAML))
+			c.Check(err, ErrorMatches, fmt.Sprintf(`plan %s "item" when expression invalid: %s`, kind, test.error),
+				Commentf("%s", test.when))
+		}
+	}
+
+	layer, err := plan.ParseLayer(1, "layer", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: cmd
+				when: colour == "red"
+	`))
+	c.Assert(err, IsNil)
+	_, err = plan.NewPlan([]*plan.Layer{layer})
+	c.Assert(err, ErrorMatches, `cannot evaluate service "srv1" when expression: unknown fact "colour"`)
+	_, ok := err.(*plan.FormatError)
+	c.Assert(ok, Equals, true)
+
+	// Unknown facts are reported even if the result is already known.
+	layer, err = plan.ParseLayer(1, "layer", reindent(`
+		checks:
+			chk1:
+				override: replace
+				when: model == "gw-3000" && colour == "red"
+				exec:
+					command: cmd
+	`))
+	c.Assert(err, IsNil)
+	_, err = plan.NewPlan([]*plan.Layer{layer})
+	c.Assert(err, ErrorMatches, `cannot evaluate check "chk1" when expression: unknown fact "colour"`)
+}
+
+// quoteYAML quotes s as a single-quoted YAML string.
+func quoteYAML(s string) string {
+	quoted := "'"
+	for _, r := range s {
+		if r == '\'' {
+			quoted += "''"
+		} else {
+			quoted += string(r)
+		}
+	}
+	return quoted + "'"
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package profiler periodically writes CPU and heap profiles of the running
+// process to a directory, keeping only the most recent ones, so that
+// performance problems can be diagnosed after the fact.
+package profiler
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internals/logger"
+	"github.com/canonical/pebble/internals/osutil"
+)
+
+// maxCPUDuration is the longest time the CPU is sampled for in each
+// interval. Sampling has a small runtime cost, so it's kept short relative to
+// the interval.
+var maxCPUDuration = 10 * time.Second
+
+const timestampFormat = "20060102T150405.000Z"
+
+// Options configures a Profiler.
+type Options struct {
+	// Dir is the directory profiles are written to. It's created if it
+	// doesn't exist.
+	Dir string
+
+	// Interval is how often profiles are taken.
+	Interval time.Duration
+
+	// Keep is how many profiles of each kind (CPU and heap) are kept. Older
+	// profiles are removed.
+	Keep int
+}
+
+// Profiler writes CPU and heap profiles at a regular interval.
+type Profiler struct {
+	opts Options
+	tomb tomb.Tomb
+}
+
+// Start creates the profiles directory and starts taking profiles.
+func Start(opts Options) (*Profiler, error) {
+	if opts.Interval <= 0 {
+		return nil, fmt.Errorf("profile interval must be positive, not %s", opts.Interval)
+	}
+	if opts.Keep < 1 {
+		return nil, fmt.Errorf("number of profiles to keep must be at least 1, not %d", opts.Keep)
+	}
+	err := os.MkdirAll(opts.Dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profiler{opts: opts}
+	p.tomb.Go(p.loop)
+	return p, nil
+}
+
+// Stop stops taking profiles, waiting for any profile in progress to be
+// written.
+func (p *Profiler) Stop() {
+	p.tomb.Kill(nil)
+	p.tomb.Wait()
+}
+
+func (p *Profiler) loop() error {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.profile()
+		case <-p.tomb.Dying():
+			return nil
+		}
+	}
+}
+
+// profile takes a CPU and a heap profile and removes old profiles. Errors
+// are logged rather than stopping the profiler, as they may be transient.
+func (p *Profiler) profile() {
+	timestamp := time.Now().UTC().Format(timestampFormat)
+
+	err := p.writeCPUProfile(timestamp)
+	if err != nil {
+		logger.Noticef("Cannot write CPU profile: %v", err)
+	}
+	err = p.writeHeapProfile(timestamp)
+	if err != nil {
+		logger.Noticef("Cannot write heap profile: %v", err)
+	}
+
+	for _, kind := range []string{"cpu", "heap"} {
+		err := p.prune(kind)
+		if err != nil {
+			logger.Noticef("Cannot remove old %s profiles: %v", kind, err)
+		}
+	}
+}
+
+func (p *Profiler) writeCPUProfile(timestamp string) error {
+	duration := p.opts.Interval / 2
+	if duration > maxCPUDuration {
+		duration = maxCPUDuration
+	}
+
+	var buf bytes.Buffer
+	// Fails if a CPU profile is already being taken, for example via the
+	// debug API.
+	err := pprof.StartCPUProfile(&buf)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-time.After(duration):
+	case <-p.tomb.Dying():
+	}
+	pprof.StopCPUProfile()
+
+	return osutil.AtomicWriteFile(p.path("cpu", timestamp), buf.Bytes(), 0600, 0)
+}
+
+func (p *Profiler) writeHeapProfile(timestamp string) error {
+	var buf bytes.Buffer
+	err := pprof.Lookup("heap").WriteTo(&buf, 0)
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(p.path("heap", timestamp), buf.Bytes(), 0600, 0)
+}
+
+func (p *Profiler) path(kind, timestamp string) string {
+	return filepath.Join(p.opts.Dir, kind+"-"+timestamp+".pprof")
+}
+
+// prune removes all but the most recent opts.Keep profiles of the given kind.
+func (p *Profiler) prune(kind string) error {
+	entries, err := os.ReadDir(p.opts.Dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, kind+"-") && strings.HasSuffix(name, ".pprof") {
+			names = append(names, name)
+		}
+	}
+	if len(names) <= p.opts.Keep {
+		return nil
+	}
+	// The timestamp format sorts chronologically.
+	sort.Strings(names)
+	for _, name := range names[:len(names)-p.opts.Keep] {
+		err := os.Remove(filepath.Join(p.opts.Dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
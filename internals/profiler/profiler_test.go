@@ -0,0 +1,114 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package profiler_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/profiler"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type profilerSuite struct{}
+
+var _ = Suite(&profilerSuite{})
+
+// listProfiles returns the sorted names of the profiles of the given kind.
+func listProfiles(c *C, dir, kind string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, kind+"-*.pprof"))
+	c.Assert(err, IsNil)
+	sort.Strings(names)
+	return names
+}
+
+func (s *profilerSuite) TestProfilesRotated(c *C) {
+	restore := profiler.FakeMaxCPUDuration(5 * time.Millisecond)
+	defer restore()
+
+	dir := filepath.Join(c.MkDir(), "profiles")
+	p, err := profiler.Start(profiler.Options{
+		Dir:      dir,
+		Interval: 20 * time.Millisecond,
+		Keep:     2,
+	})
+	c.Assert(err, IsNil)
+
+	// Wait until more profiles than are kept have been taken.
+	var seen []string
+	for i := 0; i < 500 && len(seen) < 4; i++ {
+		for _, name := range listProfiles(c, dir, "heap") {
+			if len(seen) == 0 || name > seen[len(seen)-1] {
+				seen = append(seen, name)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.Stop()
+	c.Assert(len(seen) >= 4, Equals, true, Commentf("saw %d heap profiles", len(seen)))
+
+	heap := listProfiles(c, dir, "heap")
+	cpu := listProfiles(c, dir, "cpu")
+	c.Check(heap, HasLen, 2)
+	c.Check(cpu, HasLen, 2)
+	// The oldest profiles were removed.
+	c.Check(heap[0] > seen[0], Equals, true)
+
+	for _, name := range append(heap, cpu...) {
+		c.Check(filepath.Base(name), Matches, `(cpu|heap)-\d{8}T\d{6}\.\d{3}Z\.pprof`)
+		data, err := os.ReadFile(name)
+		c.Assert(err, IsNil)
+		// Profiles are gzipped protobuf.
+		c.Check(data[:2], DeepEquals, []byte{0x1f, 0x8b})
+		fi, err := os.Stat(name)
+		c.Assert(err, IsNil)
+		c.Check(fi.Mode().Perm(), Equals, os.FileMode(0600))
+	}
+}
+
+func (s *profilerSuite) TestCPUProfileInUse(c *C) {
+	restore := profiler.FakeMaxCPUDuration(5 * time.Millisecond)
+	defer restore()
+
+	// Another CPU profile is running, so only heap profiles are written.
+	c.Assert(pprof.StartCPUProfile(io.Discard), IsNil)
+	defer pprof.StopCPUProfile()
+
+	dir := c.MkDir()
+	p, err := profiler.Start(profiler.Options{Dir: dir, Interval: 10 * time.Millisecond, Keep: 5})
+	c.Assert(err, IsNil)
+	for i := 0; i < 500 && len(listProfiles(c, dir, "heap")) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.Stop()
+
+	c.Check(listProfiles(c, dir, "heap"), Not(HasLen), 0)
+	c.Check(listProfiles(c, dir, "cpu"), HasLen, 0)
+}
+
+func (s *profilerSuite) TestInvalidOptions(c *C) {
+	_, err := profiler.Start(profiler.Options{Dir: c.MkDir(), Keep: 1})
+	c.Check(err, ErrorMatches, `profile interval must be positive, not 0s`)
+	_, err = profiler.Start(profiler.Options{Dir: c.MkDir(), Interval: time.Minute})
+	c.Check(err, ErrorMatches, `number of profiles to keep must be at least 1, not 0`)
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package secrets
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/canonical/pebble/internals/plan"
+)
+
+// readKeyring reads the payload of the "user" key with the secret's
+// description, searching the daemon's session keyring (which is linked to
+// the user's keyrings) and the keyrings linked to it.
+func readKeyring(secret *plan.Secret) ([]byte, error) {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_SESSION_KEYRING, "user", secret.Key, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find key %q: %w", secret.Key, err)
+	}
+	// The key may change size between calls, so loop until it fits.
+	for {
+		size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read key %q: %w", secret.Key, err)
+		}
+		buf := make([]byte, size)
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read key %q: %w", secret.Key, err)
+		}
+		if n <= size {
+			return buf[:n], nil
+		}
+	}
+}
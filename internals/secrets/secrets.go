@@ -0,0 +1,121 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package secrets reads the values of the secrets declared in the plan from
+// their backends: files, the daemon's environment, the kernel keyrings, or
+// the output of a command.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/canonical/x-go/strutil/shlex"
+
+	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/reaper"
+	"github.com/canonical/pebble/internals/servicelog"
+)
+
+const (
+	maxErrorOutputBytes = 512
+	maxErrorOutputLines = 5
+	commandWaitDelay    = time.Second
+)
+
+// commandTimeout is how long a secret's command may run before it's killed.
+var commandTimeout = 30 * time.Second
+
+// backends maps each backend to the function that reads a secret from it.
+var backends = map[plan.SecretBackend]func(secret *plan.Secret) ([]byte, error){
+	plan.FileSecretBackend:    readFile,
+	plan.EnvSecretBackend:     readEnv,
+	plan.KeyringSecretBackend: readKeyring,
+	plan.CommandSecretBackend: readCommand,
+}
+
+// Resolve returns the current value of the secret, read from its backend.
+func Resolve(secret *plan.Secret) ([]byte, error) {
+	read, ok := backends[secret.Backend]
+	if !ok {
+		return nil, fmt.Errorf("cannot read secret %q: unknown backend %q", secret.Name, secret.Backend)
+	}
+	value, err := read(secret)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read secret %q: %w", secret.Name, err)
+	}
+	return value, nil
+}
+
+func readFile(secret *plan.Secret) ([]byte, error) {
+	return os.ReadFile(secret.Path)
+}
+
+func readEnv(secret *plan.Secret) ([]byte, error) {
+	value, ok := os.LookupEnv(secret.Variable)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %q not set", secret.Variable)
+	}
+	return []byte(value), nil
+}
+
+// readCommand runs the secret's command and returns its output, without
+// any trailing newlines (as a shell's command substitution does).
+func readCommand(secret *plan.Secret) ([]byte, error) {
+	args, err := shlex.Split(secret.Command)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse command: %v", err)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	// Only stderr is sent to the ring buffer for errors, so the secret
+	// itself is never logged.
+	var stdout bytes.Buffer
+	stderr := servicelog.NewRingBuffer(maxErrorOutputBytes)
+	defer stderr.Close()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = commandWaitDelay
+	err = reaper.StartCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	exitCode, err := reaper.WaitCommand(cmd)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("command timed out after %s", commandTimeout)
+	}
+	if err == nil && exitCode > 0 {
+		err = fmt.Errorf("exit status %d", exitCode)
+	}
+	if err != nil {
+		output, linesErr := servicelog.LastLines(stderr, maxErrorOutputLines, "    ", false)
+		if linesErr != nil || output == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w; stderr:\n%s", err, output)
+	}
+	return bytes.TrimRight(stdout.Bytes(), "\n"), nil
+}
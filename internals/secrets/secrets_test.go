@@ -0,0 +1,101 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package secrets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/plan"
+	"github.com/canonical/pebble/internals/reaper"
+	"github.com/canonical/pebble/internals/secrets"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type secretsSuite struct{}
+
+var _ = Suite(&secretsSuite{})
+
+func (s *secretsSuite) SetUpSuite(c *C) {
+	err := reaper.Start()
+	c.Assert(err, IsNil)
+}
+
+func (s *secretsSuite) TearDownSuite(c *C) {
+	err := reaper.Stop()
+	c.Assert(err, IsNil)
+}
+
+func (s *secretsSuite) TestFile(c *C) {
+	path := filepath.Join(c.MkDir(), "secret")
+	err := os.WriteFile(path, []byte("s3cret\n"), 0o600)
+	c.Assert(err, IsNil)
+
+	value, err := secrets.Resolve(&plan.Secret{Name: "s1", Backend: plan.FileSecretBackend, Path: path})
+	c.Assert(err, IsNil)
+	c.Check(string(value), Equals, "s3cret\n")
+
+	_, err = secrets.Resolve(&plan.Secret{Name: "s2", Backend: plan.FileSecretBackend, Path: path + "-missing"})
+	c.Check(err, ErrorMatches, `cannot read secret "s2": open .*/secret-missing: no such file or directory`)
+}
+
+func (s *secretsSuite) TestEnv(c *C) {
+	os.Setenv("PEBBLE_SECRETS_TEST", "from-env")
+	defer os.Unsetenv("PEBBLE_SECRETS_TEST")
+
+	value, err := secrets.Resolve(&plan.Secret{Name: "s1", Backend: plan.EnvSecretBackend, Variable: "PEBBLE_SECRETS_TEST"})
+	c.Assert(err, IsNil)
+	c.Check(string(value), Equals, "from-env")
+
+	_, err = secrets.Resolve(&plan.Secret{Name: "s2", Backend: plan.EnvSecretBackend, Variable: "PEBBLE_SECRETS_TEST_UNSET"})
+	c.Check(err, ErrorMatches, `cannot read secret "s2": environment variable "PEBBLE_SECRETS_TEST_UNSET" not set`)
+}
+
+func (s *secretsSuite) TestCommand(c *C) {
+	value, err := secrets.Resolve(&plan.Secret{Name: "s1", Backend: plan.CommandSecretBackend, Command: `/bin/sh -c "echo line1; echo line2"`})
+	c.Assert(err, IsNil)
+	c.Check(string(value), Equals, "line1\nline2")
+}
+
+func (s *secretsSuite) TestCommandFails(c *C) {
+	_, err := secrets.Resolve(&plan.Secret{Name: "s1", Backend: plan.CommandSecretBackend, Command: `/bin/sh -c "echo not-logged; echo oops >&2; exit 3"`})
+	c.Check(err, ErrorMatches, `(?s)cannot read secret "s1": exit status 3; stderr:\n    oops\n?`)
+	c.Check(err, Not(ErrorMatches), `(?s).*not-logged.*`)
+}
+
+func (s *secretsSuite) TestCommandTimeout(c *C) {
+	restore := secrets.FakeCommandTimeout(50 * time.Millisecond)
+	defer restore()
+
+	_, err := secrets.Resolve(&plan.Secret{Name: "s1", Backend: plan.CommandSecretBackend, Command: "sleep 10"})
+	c.Check(err, ErrorMatches, `cannot read secret "s1": command timed out after 50ms`)
+}
+
+func (s *secretsSuite) TestCommandEmpty(c *C) {
+	_, err := secrets.Resolve(&plan.Secret{Name: "s1", Backend: plan.CommandSecretBackend, Command: "  "})
+	c.Check(err, ErrorMatches, `cannot read secret "s1": empty command`)
+}
+
+func (s *secretsSuite) TestUnknownBackend(c *C) {
+	_, err := secrets.Resolve(&plan.Secret{Name: "s1", Backend: "vault"})
+	c.Check(err, ErrorMatches, `cannot read secret "s1": unknown backend "vault"`)
+}
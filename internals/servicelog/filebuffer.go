@@ -0,0 +1,124 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package servicelog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// The file backing a RingBuffer starts with a fixed-size header, followed
+// by the buffer's data:
+//
+//	magic       [8]byte  "pebblog1"
+//	size        uint64   size of the data in bytes
+//	readIndex   uint64   RingPos of the oldest byte
+//	writeIndex  uint64   RingPos after the newest byte
+//
+// All integers are little-endian. The data holds log lines in the same
+// format as an in-memory buffer, each with its timestamp.
+const fileHeaderSize = 32
+
+var fileMagic = []byte("pebblog1")
+
+// OpenFileRingBuffer opens a RingBuffer of the given size that's backed by
+// a memory-mapped file at path, creating the file if needed. Data written
+// to the buffer is kept in the file, so it's available again when the file
+// is next opened, for example after a restart.
+//
+// If the file exists but was written with a different size, or its header
+// is invalid, its contents are discarded.
+func OpenFileRingBuffer(path string, size int) (*RingBuffer, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid ring buffer size %d", size)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	// The mapping remains valid after the file is closed.
+	defer f.Close()
+
+	fileSize := fileHeaderSize + size
+	err = f.Truncate(int64(fileSize))
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := unix.Mmap(int(f.Fd()), 0, fileSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("cannot map %q: %w", path, err)
+	}
+
+	rb := &RingBuffer{
+		data:    mapping[fileHeaderSize:],
+		header:  mapping[:fileHeaderSize],
+		mapping: mapping,
+	}
+	rb.loadHeader()
+	// A partial line may have been written before the buffer was last
+	// closed; terminate it so later writes start on a new line.
+	if rb.buffered() > 0 && rb.lastByte() != '\n' {
+		rb.Write([]byte{'\n'})
+	}
+	runtime.SetFinalizer(rb, (*RingBuffer).unmap)
+	return rb, nil
+}
+
+// loadHeader restores the buffer positions from the file header, or
+// initializes the header if it isn't valid for this buffer.
+func (rb *RingBuffer) loadHeader() {
+	size := uint64(len(rb.data))
+	readIndex := binary.LittleEndian.Uint64(rb.header[16:])
+	writeIndex := binary.LittleEndian.Uint64(rb.header[24:])
+	if bytes.Equal(rb.header[:8], fileMagic) &&
+		binary.LittleEndian.Uint64(rb.header[8:]) == size &&
+		readIndex <= writeIndex && writeIndex-readIndex <= size {
+		rb.readIndex = RingPos(readIndex)
+		rb.writeIndex = RingPos(writeIndex)
+		return
+	}
+	copy(rb.header, fileMagic)
+	binary.LittleEndian.PutUint64(rb.header[8:], size)
+	rb.saveHeader()
+}
+
+// saveHeader records the buffer positions in the file header, if the buffer
+// is backed by a file. The caller must hold the write lock.
+func (rb *RingBuffer) saveHeader() {
+	if rb.header == nil {
+		return
+	}
+	binary.LittleEndian.PutUint64(rb.header[16:], uint64(rb.readIndex))
+	binary.LittleEndian.PutUint64(rb.header[24:], uint64(rb.writeIndex))
+}
+
+func (rb *RingBuffer) lastByte() byte {
+	return rb.data[(rb.writeIndex-1)%RingPos(len(rb.data))]
+}
+
+// unmap releases the file mapping once the buffer is no longer referenced.
+// It can't be done when the buffer is closed, as readers may continue to
+// use it after that.
+func (rb *RingBuffer) unmap() {
+	if rb.mapping != nil {
+		_ = unix.Munmap(rb.mapping)
+		rb.mapping = nil
+	}
+}
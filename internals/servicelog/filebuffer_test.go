@@ -0,0 +1,137 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package servicelog_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/servicelog"
+)
+
+type fileBufferSuite struct{}
+
+var _ = Suite(&fileBufferSuite{})
+
+func readAll(c *C, rb *servicelog.RingBuffer) string {
+	var buf bytes.Buffer
+	_, _, err := rb.WriteTo(&buf, servicelog.TailPosition)
+	c.Assert(err, IsNil)
+	return buf.String()
+}
+
+func (s *fileBufferSuite) TestReopen(c *C) {
+	path := filepath.Join(c.MkDir(), "svc.log")
+
+	rb, err := servicelog.OpenFileRingBuffer(path, 16)
+	c.Assert(err, IsNil)
+	_, err = fmt.Fprint(rb, "line 1\nline 2\n")
+	c.Assert(err, IsNil)
+	c.Assert(rb.Close(), IsNil)
+
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Size(), Equals, int64(32+16))
+
+	// The data and positions are restored, and the buffer is writable
+	// again, wrapping around as usual.
+	rb, err = servicelog.OpenFileRingBuffer(path, 16)
+	c.Assert(err, IsNil)
+	c.Assert(readAll(c, rb), Equals, "line 1\nline 2\n")
+	start, end := rb.Positions()
+	c.Assert(start, Equals, servicelog.RingPos(0))
+	c.Assert(end, Equals, servicelog.RingPos(14))
+	_, err = fmt.Fprint(rb, "line 3\n")
+	c.Assert(err, IsNil)
+	c.Assert(readAll(c, rb), Equals, "1\nline 2\nline 3\n")
+
+	rb, err = servicelog.OpenFileRingBuffer(path, 16)
+	c.Assert(err, IsNil)
+	c.Assert(readAll(c, rb), Equals, "1\nline 2\nline 3\n")
+	start, end = rb.Positions()
+	c.Assert(start, Equals, servicelog.RingPos(5))
+	c.Assert(end, Equals, servicelog.RingPos(21))
+}
+
+func (s *fileBufferSuite) TestPartialLine(c *C) {
+	path := filepath.Join(c.MkDir(), "svc.log")
+
+	rb, err := servicelog.OpenFileRingBuffer(path, 32)
+	c.Assert(err, IsNil)
+	_, err = fmt.Fprint(rb, "line 1\npartial")
+	c.Assert(err, IsNil)
+
+	rb, err = servicelog.OpenFileRingBuffer(path, 32)
+	c.Assert(err, IsNil)
+	c.Assert(readAll(c, rb), Equals, "line 1\npartial\n")
+}
+
+func (s *fileBufferSuite) TestSizeChanged(c *C) {
+	path := filepath.Join(c.MkDir(), "svc.log")
+
+	rb, err := servicelog.OpenFileRingBuffer(path, 32)
+	c.Assert(err, IsNil)
+	_, err = fmt.Fprint(rb, "line 1\n")
+	c.Assert(err, IsNil)
+
+	rb, err = servicelog.OpenFileRingBuffer(path, 64)
+	c.Assert(err, IsNil)
+	c.Assert(readAll(c, rb), Equals, "")
+	c.Assert(rb.Size(), Equals, 64)
+}
+
+func (s *fileBufferSuite) TestInvalidHeader(c *C) {
+	path := filepath.Join(c.MkDir(), "svc.log")
+	err := os.WriteFile(path, bytes.Repeat([]byte("x"), 48), 0600)
+	c.Assert(err, IsNil)
+
+	rb, err := servicelog.OpenFileRingBuffer(path, 16)
+	c.Assert(err, IsNil)
+	c.Assert(readAll(c, rb), Equals, "")
+	_, err = fmt.Fprint(rb, "line 1\n")
+	c.Assert(err, IsNil)
+	c.Assert(readAll(c, rb), Equals, "line 1\n")
+}
+
+func (s *fileBufferSuite) TestIterator(c *C) {
+	path := filepath.Join(c.MkDir(), "svc.log")
+
+	rb, err := servicelog.OpenFileRingBuffer(path, 1024)
+	c.Assert(err, IsNil)
+	w := servicelog.NewFormatWriter(rb, "svc")
+	fmt.Fprintln(w, "first")
+	fmt.Fprintln(w, "second")
+	c.Assert(rb.Close(), IsNil)
+
+	rb, err = servicelog.OpenFileRingBuffer(path, 1024)
+	c.Assert(err, IsNil)
+	it := rb.HeadIterator(1)
+	defer it.Close()
+	parser := servicelog.NewParser(it, 1024)
+	c.Assert(it.Next(nil), Equals, true)
+	c.Assert(parser.Next(), Equals, true)
+	c.Assert(parser.Entry().Service, Equals, "svc")
+	c.Assert(parser.Entry().Message, Equals, "second\n")
+	c.Assert(parser.Next(), Equals, false)
+}
+
+func (s *fileBufferSuite) TestInvalidSize(c *C) {
+	_, err := servicelog.OpenFileRingBuffer(filepath.Join(c.MkDir(), "svc.log"), 0)
+	c.Assert(err, ErrorMatches, "invalid ring buffer size 0")
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package servicelog
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Filter selects log entries by time range and message pattern. The zero
+// value matches all entries.
+type Filter struct {
+	// Since, if set, excludes entries logged before this time.
+	Since time.Time
+
+	// Until, if set, excludes entries logged after this time.
+	Until time.Time
+
+	// Pattern, if set, excludes entries whose message doesn't match it.
+	Pattern *regexp.Regexp
+}
+
+// IsZero reports whether the filter matches all entries.
+func (f *Filter) IsZero() bool {
+	return f.Since.IsZero() && f.Until.IsZero() && f.Pattern == nil
+}
+
+// Match reports whether the entry passes the filter.
+func (f *Filter) Match(entry Entry) bool {
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if f.After(entry) {
+		return false
+	}
+	if f.Pattern != nil && !f.Pattern.MatchString(strings.TrimSuffix(entry.Message, "\n")) {
+		return false
+	}
+	return true
+}
+
+// After reports whether the entry was logged after the end of the filter's
+// time range. As entries are written in order, no later entries from the
+// same service can match either.
+func (f *Filter) After(entry Entry) bool {
+	return !f.Until.IsZero() && entry.Time.After(f.Until)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package servicelog_test
+
+import (
+	"regexp"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internals/servicelog"
+)
+
+type filterSuite struct{}
+
+var _ = Suite(&filterSuite{})
+
+func (s *filterSuite) TestMatch(c *C) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := servicelog.Entry{Time: t0, Service: "svc", Message: "connection refused\n"}
+
+	tests := []struct {
+		filter servicelog.Filter
+		match  bool
+		after  bool
+	}{
+		{servicelog.Filter{}, true, false},
+		{servicelog.Filter{Since: t0}, true, false},
+		{servicelog.Filter{Since: t0.Add(time.Second)}, false, false},
+		{servicelog.Filter{Until: t0}, true, false},
+		{servicelog.Filter{Until: t0.Add(-time.Second)}, false, true},
+		{servicelog.Filter{Since: t0.Add(-time.Minute), Until: t0.Add(time.Minute)}, true, false},
+		{servicelog.Filter{Pattern: regexp.MustCompile("refused")}, true, false},
+		{servicelog.Filter{Pattern: regexp.MustCompile("^connection refused$")}, true, false},
+		{servicelog.Filter{Pattern: regexp.MustCompile("timeout")}, false, false},
+	}
+	for i, test := range tests {
+		c.Check(test.filter.Match(entry), Equals, test.match, Commentf("test %d", i))
+		c.Check(test.filter.After(entry), Equals, test.after, Commentf("test %d", i))
+	}
+
+	c.Check((&servicelog.Filter{}).IsZero(), Equals, true)
+	c.Check((&servicelog.Filter{Since: t0}).IsZero(), Equals, false)
+}
@@ -42,6 +42,11 @@ type RingBuffer struct {
 	writeClosed bool
 	data        []byte
 
+	// header and mapping are set if the buffer is backed by a file; see
+	// OpenFileRingBuffer.
+	header  []byte
+	mapping []byte
+
 	iteratorMutex sync.RWMutex
 	iteratorList  []*iterator
 }
@@ -121,6 +126,7 @@ func (rb *RingBuffer) Write(p []byte) (written int, err error) {
 		copy(rb.data[:high], p[lowLength:])
 	}
 	rb.writeIndex += RingPos(writeLength)
+	rb.saveHeader()
 	if writeLength < len(p) {
 		return writeLength, io.ErrShortWrite
 	}
@@ -318,6 +324,7 @@ func (rb *RingBuffer) discard(n int) error {
 		n = buffered
 	}
 	rb.readIndex = rb.readIndex + RingPos(n)
+	rb.saveHeader()
 	return nil
 }
 
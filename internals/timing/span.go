@@ -52,6 +52,7 @@ func Start(label, summary string, tags map[string]string) *Span {
 		Summary: summary,
 		Tags:    tags,
 		Base:    uint64(now.Unix()),
+		A:       uint64(now.Nanosecond()),
 	}
 	// Preserve the monotonic clock so all operations are monotonic to this instant.
 	// See the documentation of the time package for details on monotonic clocks.
@@ -136,3 +137,48 @@ func countSpans(s *Span) int {
 	}
 	return count
 }
+
+// GetSaver is implemented by the state, to persist timings.
+type GetSaver interface {
+	// GetMaybeTimings gets the saved timings. It does not return an error
+	// if there are none.
+	GetMaybeTimings(timings interface{}) error
+	// SaveTimings saves the timings.
+	SaveTimings(timings interface{})
+}
+
+// MaxTimings is the maximum number of timings kept by Save. The oldest
+// timings are dropped first.
+var MaxTimings = 100
+
+// Save appends the span to the timings saved in st. The state must be
+// locked by the caller.
+func (s *Span) Save(st GetSaver) error {
+	var timings []json.RawMessage
+	err := st.GetMaybeTimings(&timings)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	timings = append(timings, data)
+	if len(timings) > MaxTimings {
+		timings = timings[len(timings)-MaxTimings:]
+	}
+	st.SaveTimings(timings)
+	return nil
+}
+
+// Get returns the timings saved in st, oldest first. The nested spans of
+// each returned span are flattened, with their Depth set. The state must be
+// locked by the caller.
+func Get(st GetSaver) ([]*Span, error) {
+	var timings []*Span
+	err := st.GetMaybeTimings(&timings)
+	if err != nil {
+		return nil, err
+	}
+	return timings, nil
+}
@@ -124,6 +124,7 @@ func (s *spanSuite) TestSave(c *C) {
 			"task":   "0",
 		},
 		"base": json.Number("1577840460"),
+		"a":    json.Number("1000000"),
 		"b":    json.Number("6000000"),
 		"spans": []interface{}{
 			map[string]interface{}{
@@ -148,6 +149,7 @@ func (s *spanSuite) TestSave(c *C) {
 			"task":   "1",
 		},
 		"base": json.Number("1577840460"),
+		"a":    json.Number("7000000"),
 		"b":    json.Number("12000000"),
 		"spans": []interface{}{
 			map[string]interface{}{
@@ -186,6 +188,7 @@ func (s *spanSuite) testDurationThreshold(c *C, threshold time.Duration, expecte
 func (s *spanSuite) TestDurationThresholdAll(c *C) {
 	s.testDurationThreshold(c, 0, map[string]interface{}{
 		"base": json.Number("1577840460"),
+		"a":    json.Number("1000000"),
 		"b":    json.Number("8000000"),
 		"spans": []interface{}{
 			map[string]interface{}{
@@ -216,6 +219,7 @@ func (s *spanSuite) TestDurationThresholdAll(c *C) {
 func (s *spanSuite) TestDurationThreshold(c *C) {
 	s.testDurationThreshold(c, 3000000, map[string]interface{}{
 		"base": json.Number("1577840460"),
+		"a":    json.Number("1000000"),
 		"b":    json.Number("8000000"),
 		"spans": []interface{}{
 			map[string]interface{}{
@@ -239,6 +243,7 @@ func (s *spanSuite) TestDurationThreshold(c *C) {
 func (s *spanSuite) TestDurationThresholdRootOnly(c *C) {
 	s.testDurationThreshold(c, 4000000, map[string]interface{}{
 		"base": json.Number("1577840460"),
+		"a":    json.Number("1000000"),
 		"b":    json.Number("8000000"),
 		"spans": []interface{}{
 			map[string]interface{}{
@@ -251,3 +256,53 @@ func (s *spanSuite) TestDurationThresholdRootOnly(c *C) {
 		},
 	})
 }
+
+func (s *spanSuite) TestSaveGet(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	timings, err := timing.Get(s.st)
+	c.Assert(err, IsNil)
+	c.Check(timings, HasLen, 0)
+
+	span1 := timing.Start("", "", map[string]string{"startup": "load-state"})
+	nested := span1.StartNested("read-state", "read state from disk")
+	nested.Stop()
+	span1.Stop()
+	c.Assert(span1.Save(s.st), IsNil)
+
+	span2 := timing.Start("", "", map[string]string{"startup": "load-plan"})
+	span2.Stop()
+	c.Assert(span2.Save(s.st), IsNil)
+
+	timings, err = timing.Get(s.st)
+	c.Assert(err, IsNil)
+	c.Assert(timings, HasLen, 2)
+	c.Check(encodeDecode(timings[0]), DeepEquals, encodeDecode(span1))
+	c.Check(encodeDecode(timings[1]), DeepEquals, encodeDecode(span2))
+	c.Check(timings[0].Spans, HasLen, 1)
+	c.Check(timings[0].Spans[0].Label, Equals, "read-state")
+	c.Check(timings[0].Spans[0].Depth, Equals, 1)
+}
+
+func (s *spanSuite) TestSaveMaxTimings(c *C) {
+	old := timing.MaxTimings
+	timing.MaxTimings = 3
+	defer func() { timing.MaxTimings = old }()
+
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	for i := 0; i < 5; i++ {
+		span := timing.Start("", "", map[string]string{"n": fmt.Sprint(i)})
+		span.Stop()
+		c.Assert(span.Save(s.st), IsNil)
+	}
+
+	timings, err := timing.Get(s.st)
+	c.Assert(err, IsNil)
+	c.Assert(timings, HasLen, 3)
+	for i, span := range timings {
+		c.Check(span.Tags["n"], Equals, fmt.Sprint(i+2))
+	}
+}